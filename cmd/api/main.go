@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/handler"
 	"github.com/schooltj/internal/repository"
 	"github.com/schooltj/internal/service"
@@ -55,24 +61,72 @@ func main() {
 	schoolRepo := repository.NewSchoolRepository(repo.DB)
 	studentRepo := repository.NewStudentRepository(repo.DB)
 	teacherRepo := repository.NewTeacherRepository(repo.DB) // Added TeacherRepo
-	authService := service.NewAuthService(userRepo, schoolRepo, studentRepo, jwtSecret)
-	authHandler := handler.NewAuthHandler(authService)
+	sessionRepo := repository.NewSessionRepository(repo.DB)
 	courseRepo := repository.NewCourseRepository(repo.DB)
+	schoolMemberRepo := repository.NewSchoolMemberRepository(repo.DB)
+	branchRepo := repository.NewBranchRepository(repo.DB)
+	sectionRepo := repository.NewSectionRepository(repo.DB)
+	policy := service.NewPolicy(courseRepo, schoolRepo, studentRepo, schoolMemberRepo, branchRepo, sectionRepo)
+	emailService := service.NewEmailService()
+	appURL := envOr("APP_URL", "http://localhost:5173")
+	emailVerificationService := service.NewEmailVerificationService(userRepo, repository.NewEmailVerificationRepository(repo.DB), emailService, appURL)
+	var smsSender service.SMSSender = service.NewLogSMSSender()
+	if gatewayURL := os.Getenv("SMS_GATEWAY_URL"); gatewayURL != "" {
+		smsSender = service.NewHTTPSMSSender(gatewayURL, os.Getenv("SMS_API_KEY"), os.Getenv("SMS_SENDER"))
+	} else if os.Getenv("APP_ENV") == "production" {
+		log.Println("SMS_GATEWAY_URL is not set — one-time codes will only be logged")
+	}
+	phoneOTPService := service.NewPhoneOTPService(userRepo, repository.NewPhoneOTPRepository(repo.DB), smsSender)
+	twoFactorService := service.NewTwoFactorService(repository.NewTwoFactorRepository(repo.DB), userRepo, policy)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	lockout := service.LoginLockout{
+		Threshold: envInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		Duration:  envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+	}
+	auditRepo := repository.NewAuditRepository(repo.DB)
+	var oidcProviders []*service.OIDCProvider
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		oidcProviders = append(oidcProviders, service.NewGoogleProvider(clientID, os.Getenv("GOOGLE_CLIENT_SECRET"),
+			envOr("GOOGLE_REDIRECT_URL", appURL+"/auth/callback/google")))
+	}
+	authService := service.NewAuthService(userRepo, schoolRepo, studentRepo, sessionRepo, emailVerificationService, phoneOTPService, twoFactorService, auditRepo,
+		repository.NewIdentityRepository(repo.DB), lockout, jwtSecret, oidcProviders)
+	passwordResetService := service.NewPasswordResetService(userRepo, repository.NewPasswordResetRepository(repo.DB), sessionRepo, emailService, appURL)
+	authHandler := handler.NewAuthHandler(authService, passwordResetService, emailVerificationService, phoneOTPService)
 	notificationRepo := repository.NewNotificationRepository(repo.DB)
 	announcementRepo := repository.NewAnnouncementRepository(repo.DB)
-	courseService := service.NewCourseService(courseRepo, schoolRepo, userRepo, studentRepo, notificationRepo, announcementRepo)
-	schoolService := service.NewSchoolService(schoolRepo, authService, courseService)
+	exchangeRateRepo := repository.NewExchangeRateRepository(repo.DB)
+	exchangeRateService := service.NewExchangeRateService(exchangeRateRepo, policy)
+	exchangeRateHandler := handler.NewExchangeRateHandler(exchangeRateService)
+	pricingRepo := repository.NewPricingRepository(repo.DB)
+	pricingService := service.NewPricingService(pricingRepo, courseRepo, schoolRepo, exchangeRateService, policy)
+	pricingHandler := handler.NewPricingHandler(pricingService)
+	payoutRepo := repository.NewPayoutRepository(repo.DB)
+	payoutService := service.NewPayoutService(payoutRepo, schoolRepo, exchangeRateService, policy)
+	payoutHandler := handler.NewPayoutHandler(payoutService)
+	invoiceRepo := repository.NewInvoiceRepository(repo.DB)
+	invoiceService := service.NewInvoiceService(invoiceRepo, courseRepo, pricingService, exchangeRateService, policy)
+	invoiceHandler := handler.NewInvoiceHandler(invoiceService)
+	invoiceWorker := service.NewInvoiceWorker(invoiceService, envDuration("INVOICE_GENERATE_INTERVAL", time.Hour))
+	courseService := service.NewCourseService(courseRepo, schoolRepo, branchRepo, sectionRepo, userRepo, studentRepo, notificationRepo, announcementRepo, invoiceService, policy)
+	waitlistWorker := service.NewWaitlistWorker(courseService, envDuration("WAITLIST_OFFER_CHECK_INTERVAL", 5*time.Minute))
+	schoolService := service.NewSchoolService(schoolRepo, repository.NewTeacherInvitationRepository(repo.DB), schoolMemberRepo, branchRepo, userRepo, authService,
+		passwordResetService, courseService, emailService, policy, appURL)
 	schoolHandler := handler.NewSchoolHandler(schoolService, schoolRepo, courseRepo)
 	courseHandler := handler.NewCourseHandler(courseService)
+	sectionHandler := handler.NewSectionHandler(service.NewSectionService(sectionRepo, courseRepo, schoolRepo, notificationRepo, courseService, policy))
+	branchHandler := handler.NewBranchHandler(service.NewBranchService(branchRepo, schoolRepo, courseRepo, policy))
 	ratingRepo := repository.NewRatingRepository(repo.DB)
 	ratingService := service.NewRatingService(ratingRepo)
 	ratingHandler := handler.NewRatingHandler(ratingService, ratingRepo)
-	studentService := service.NewStudentService(studentRepo)
+	adminService := service.NewAdminService(repository.NewAdminRepository(repo.DB), userRepo, schoolRepo, ratingRepo, sessionRepo, auditRepo, authService)
+	adminHandler := handler.NewAdminHandler(adminService)
+	studentService := service.NewStudentService(studentRepo, policy)
 	studentHandler := handler.NewStudentHandler(studentService)
 	teacherService := service.NewTeacherService(teacherRepo)    // Added TeacherService
 	teacherHandler := handler.NewTeacherHandler(teacherService) // Added TeacherHandler
 	attendanceRepo := repository.NewAttendanceRepository(repo.DB)
-	attendanceService := service.NewAttendanceService(attendanceRepo)
+	attendanceService := service.NewAttendanceService(attendanceRepo, policy)
 	attendanceHandler := handler.NewAttendanceHandler(attendanceService)
 	paymentRepo := repository.NewPaymentRepository(repo.DB)
 
@@ -83,33 +137,81 @@ func main() {
 		alifMerchantID = "demo_merchant"
 		alifSecret = "demo_secret"
 	}
-	alifProvider := service.NewAlifProvider(alifMerchantID, alifSecret)
+	alifProvider := service.NewAlifProvider(alifMerchantID, alifSecret, os.Getenv("ALIF_API_URL"), os.Getenv("ALIF_CALLBACK_URL"), os.Getenv("ALIF_RETURN_URL"))
 
-	paymentService := service.NewPaymentService(paymentRepo, []service.PaymentProvider{alifProvider})
-	paymentHandler := handler.NewPaymentHandler(paymentService)
-	announcementService := service.NewAnnouncementService(announcementRepo)
+	humoMerchantID := os.Getenv("HUMO_MERCHANT_ID")
+	humoSecret := os.Getenv("HUMO_SECRET")
+	if humoMerchantID == "" && os.Getenv("APP_ENV") != "production" {
+		humoMerchantID = "demo_merchant"
+		humoSecret = "demo_secret"
+	}
+	humoProvider := service.NewHumoProvider(humoMerchantID, humoSecret, os.Getenv("HUMO_API_URL"), os.Getenv("HUMO_CALLBACK_URL"), os.Getenv("HUMO_RETURN_URL"))
+
+	kortiMilliTerminalID := os.Getenv("KORTI_MILLI_TERMINAL_ID")
+	kortiMilliSecret := os.Getenv("KORTI_MILLI_SECRET")
+	if kortiMilliTerminalID == "" && os.Getenv("APP_ENV") != "production" {
+		kortiMilliTerminalID = "demo_terminal"
+		kortiMilliSecret = "demo_secret"
+	}
+	kortiMilliProvider := service.NewKortiMilliProvider(kortiMilliTerminalID, kortiMilliSecret, os.Getenv("KORTI_MILLI_API_URL"), os.Getenv("KORTI_MILLI_CALLBACK_URL"), os.Getenv("KORTI_MILLI_RETURN_URL"))
+
+	receiptRepo := repository.NewReceiptRepository(repo.DB)
+	receiptService := service.NewReceiptService(receiptRepo, paymentRepo, courseRepo, schoolRepo, policy)
+
+	paymentService := service.NewPaymentService(paymentRepo, invoiceService, receiptService, pricingService, exchangeRateService, policy, []service.PaymentProvider{
+		alifProvider,
+		humoProvider,
+		kortiMilliProvider,
+		service.NewManualProvider(domain.PaymentMethodCash, paymentRepo),
+		service.NewManualProvider(domain.PaymentMethodCard, paymentRepo),
+		service.NewManualProvider(domain.PaymentMethodTransfer, paymentRepo),
+		service.NewManualProvider(domain.PaymentMethodOther, paymentRepo),
+	})
+	paymentHandler := handler.NewPaymentHandler(paymentService, receiptService)
+	paymentReconciler := service.NewPaymentReconciler(paymentService,
+		envDuration("PAYMENT_RECONCILE_INTERVAL", 5*time.Minute),
+		envDuration("PAYMENT_PENDING_STALE_AFTER", 15*time.Minute),
+		envDuration("PAYMENT_PENDING_EXPIRE_AFTER", 24*time.Hour),
+	)
+	announcementService := service.NewAnnouncementService(announcementRepo, policy)
 	announcementHandler := handler.NewAnnouncementHandler(announcementService)
-	dashboardHandler := handler.NewDashboardHandler(repo.DB)
+	dashboardHandler := handler.NewDashboardHandler(repo.DB, policy)
+	// Rate limits for unauthenticated auth endpoints. Buckets live in memory unless
+	// RATE_LIMIT_BACKEND=db, which shares them between API instances.
+	var rateLimiter service.RateLimiter = service.NewMemoryRateLimiter()
+	if envOr("RATE_LIMIT_BACKEND", "memory") == "db" {
+		rateLimiter = service.NewDBRateLimiter(repository.NewRateLimitRepository(repo.DB))
+	}
+	loginIPLimit := handler.RateLimitMiddleware(rateLimiter, "login-ip",
+		envRateLimit("RATE_LIMIT_LOGIN_IP", service.RateLimit{Requests: 20, Per: time.Minute}), handler.ClientIPKey)
+	loginAccountLimit := handler.RateLimitMiddleware(rateLimiter, "login-account",
+		envRateLimit("RATE_LIMIT_LOGIN_ACCOUNT", service.RateLimit{Requests: 5, Per: time.Minute}), handler.LoginAccountKey)
+	authIPLimit := handler.RateLimitMiddleware(rateLimiter, "auth-ip",
+		envRateLimit("RATE_LIMIT_AUTH_IP", service.RateLimit{Requests: 10, Per: time.Minute}), handler.ClientIPKey)
+	idempotent := handler.IdempotencyMiddleware(repository.NewIdempotencyRepository(repo.DB))
+	verified := handler.RequireVerifiedEmail(emailVerificationService)
 	settingsHandler := handler.NewSettingsHandler(authService)
 	gradeRepo := repository.NewGradeRepository(repo.DB)
-	gradeService := service.NewGradeService(gradeRepo)
+	gradeService := service.NewGradeService(gradeRepo, courseRepo, policy)
 	gradeHandler := handler.NewGradeHandler(gradeService)
 	notificationService := service.NewNotificationService(notificationRepo)
 	notificationHandler := handler.NewNotificationHandler(notificationService)
 	assignmentRepo := repository.NewAssignmentRepository(repo.DB)
-	assignmentService := service.NewAssignmentService(assignmentRepo)
+	assignmentService := service.NewAssignmentService(assignmentRepo, courseRepo, policy)
 	assignmentHandler := handler.NewAssignmentHandler(assignmentService)
 	messageRepo := repository.NewMessageRepository(repo.DB)
-	messageService := service.NewMessageService(messageRepo)
+	guardianRepo := repository.NewGuardianRepository(repo.DB)
+	messageService := service.NewMessageService(messageRepo, guardianRepo)
 	messageHandler := handler.NewMessageHandler(messageService)
+	guardianService := service.NewGuardianService(guardianRepo, userRepo, policy, emailService, smsSender,
+		gradeService, attendanceService, assignmentService, paymentService, invoiceService, appURL)
+	guardianHandler := handler.NewGuardianHandler(guardianService)
 	courseContentRepo := repository.NewCourseContentRepository(repo.DB)
-	courseContentService := service.NewCourseContentService(courseContentRepo, courseRepo, studentRepo)
+	courseContentService := service.NewCourseContentService(courseContentRepo, studentRepo, policy)
 	courseContentHandler := handler.NewCourseContentHandler(courseContentService)
 
 	// Phase 3: Communication & Engagement
-	emailService := service.NewEmailService()
-	_ = emailService // used by handlers via direct calls
-	wsHandler := handler.NewWSHandler(messageService, jwtSecret)
+	wsHandler := handler.NewWSHandler(messageService, authService)
 	calendarHandler := handler.NewCalendarHandler(repo.DB)
 
 	// CORS config from environment
@@ -118,14 +220,21 @@ func main() {
 		allowedOrigins = strings.Split(envOrigins, ",")
 	}
 
+	// Reverse proxies whose X-Forwarded-For is believed when rate limiting and auditing.
+	trustedProxies, err := handler.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(handler.ClientIPMiddleware(trustedProxies))
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", handler.IdempotencyKeyHeader},
+		ExposedHeaders:   []string{"Link", "Retry-After", handler.IdempotentReplayedHeader, handler.UnconvertedCurrenciesHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -136,19 +245,49 @@ func main() {
 	})
 
 	// Auth routes (under /api prefix)
-	r.Post("/api/auth/register", authHandler.Register)
-	r.Post("/api/auth/login", authHandler.Login)
+	r.With(authIPLimit).Post("/api/auth/register", authHandler.Register)
+	r.With(loginIPLimit, loginAccountLimit).Post("/api/auth/login", authHandler.Login)
+	r.Post("/api/auth/refresh", authHandler.Refresh)
+	r.With(authIPLimit).Post("/api/auth/otp/request", authHandler.RequestOTP)
+	r.With(loginIPLimit, loginAccountLimit).Post("/api/auth/otp/verify", authHandler.VerifyOTP)
+	r.With(loginIPLimit).Post("/api/auth/2fa/verify", authHandler.VerifyTwoFactor)
+	r.Get("/api/auth/oidc/providers", authHandler.ListOIDCProviders)
+	r.With(authIPLimit).Get("/api/auth/oidc/{provider}/start", authHandler.BeginOIDCLogin)
+	r.With(loginIPLimit).Post("/api/auth/oidc/{provider}/callback", authHandler.CompleteOIDCLogin)
+	r.With(authIPLimit).Post("/api/auth/oidc/signup", authHandler.CompleteOIDCSignup)
+	r.With(authIPLimit).Post("/api/auth/forgot-password", authHandler.ForgotPassword)
+	r.With(authIPLimit).Post("/api/auth/reset-password", authHandler.ResetPassword)
+	r.With(authIPLimit).Get("/api/auth/verify-email", authHandler.VerifyEmail)
+	r.With(authIPLimit).Get("/api/teacher-invitations/lookup", schoolHandler.LookupTeacherInvitation)
+	r.With(authIPLimit).Post("/api/teacher-invitations/register", schoolHandler.RegisterInvitedTeacher)
+	r.With(authIPLimit).Post("/api/auth/verify-email", authHandler.VerifyEmail)
 
 	// Legacy routes (backward compatibility)
-	r.Post("/register", authHandler.Register)
-	r.Post("/login", authHandler.Login)
+	r.With(authIPLimit).Post("/register", authHandler.Register)
+	r.With(loginIPLimit, loginAccountLimit).Post("/login", authHandler.Login)
 
 	// SSE stream — uses its own JWT auth via ?token= query param
 	r.Get("/api/ws", wsHandler.Stream)
 
+	// Payment gateway webhooks — authenticated by provider signature, not JWT
+	r.Post("/api/payments/callback/{provider}", paymentHandler.HandleCallback)
+
 	r.Group(func(r chi.Router) {
 		r.Use(handler.AuthMiddleware(authService))
 
+		// Session routes
+		r.Post("/api/auth/logout", authHandler.Logout)
+		r.Post("/api/auth/logout-all", authHandler.LogoutAll)
+		r.Post("/api/auth/resend-verification", authHandler.ResendVerification)
+		r.Get("/api/auth/sessions", authHandler.ListSessions)
+		r.Get("/api/auth/identities", authHandler.ListIdentities)
+		r.Delete("/api/auth/sessions/{id}", authHandler.RevokeSession)
+		r.Get("/api/auth/2fa", twoFactorHandler.Status)
+		r.Post("/api/auth/2fa/setup", twoFactorHandler.Setup)
+		r.Post("/api/auth/2fa/enable", twoFactorHandler.Enable)
+		r.Post("/api/auth/2fa/disable", twoFactorHandler.Disable)
+		r.Post("/api/auth/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
 		// Profile routes (under /api prefix)
 		r.Get("/api/me", authHandler.GetProfile)
 		r.Put("/api/me", authHandler.UpdateProfile)
@@ -165,6 +304,26 @@ func main() {
 		r.Get("/api/users/{id}", authHandler.GetPublicProfile)
 		r.Get("/api/schools/teachers", schoolHandler.ListTeachers)
 		r.Post("/api/schools/teachers", schoolHandler.AddTeacher)
+		r.Get("/api/schools/{id}/teacher-invitations", schoolHandler.ListTeacherInvitations)
+		r.Post("/api/schools/{id}/teacher-invitations", schoolHandler.InviteTeacher)
+		r.Delete("/api/schools/{id}/teachers/{teacherId}", schoolHandler.RemoveTeacher)
+		r.Get("/api/schools/my/membership", schoolHandler.MyMembership)
+		r.Get("/api/schools/{id}/members", schoolHandler.ListMembers)
+		r.Post("/api/schools/{id}/members", schoolHandler.AddMember)
+		r.Put("/api/schools/{id}/members/{userId}", schoolHandler.UpdateMember)
+		r.Delete("/api/schools/{id}/members/{userId}", schoolHandler.RemoveMember)
+		r.Get("/api/schools/{id}/branches", branchHandler.ListBranches)
+		r.Post("/api/schools/{id}/branches", branchHandler.CreateBranch)
+		r.Put("/api/branches/{id}", branchHandler.UpdateBranch)
+		r.Delete("/api/branches/{id}", branchHandler.DeleteBranch)
+		r.Get("/api/branches/{id}/rooms", branchHandler.ListRooms)
+		r.Post("/api/branches/{id}/rooms", branchHandler.CreateRoom)
+		r.Delete("/api/rooms/{id}", branchHandler.DeleteRoom)
+		r.Put("/api/schools/{id}/teachers/{teacherId}/branch", branchHandler.SetTeacherBranch)
+		r.Put("/api/courses/{id}/branch", branchHandler.SetCourseBranch)
+		r.Post("/api/teacher-invitations/accept", schoolHandler.AcceptTeacherInvitation)
+		r.Post("/api/teacher-invitations/{id}/resend", schoolHandler.ResendTeacherInvitation)
+		r.Delete("/api/teacher-invitations/{id}", schoolHandler.RevokeTeacherInvitation)
 
 		// Global Teachers APIs
 		r.Get("/api/teachers", teacherHandler.ListAllTeachers) // Added new route
@@ -183,14 +342,19 @@ func main() {
 		r.Get("/api/courses/{id}", courseHandler.GetByID)
 		r.Put("/api/courses/{id}", courseHandler.Update)
 		r.Delete("/api/courses/{id}", courseHandler.Delete)
-		r.Post("/api/courses/{id}/invite", courseHandler.Invite)
-		r.Post("/api/courses/{id}/request-access", courseHandler.RequestAccess)
-		r.Post("/api/invitations/{id}/respond", courseHandler.RespondInvitation)
+		r.With(idempotent).Post("/api/courses/{id}/invite", courseHandler.Invite)
+		r.With(verified, idempotent).Post("/api/courses/{id}/request-access", courseHandler.RequestAccess)
+		r.With(verified, idempotent).Post("/api/invitations/{id}/respond", courseHandler.RespondInvitation)
 		r.Get("/api/my-enrollments", courseHandler.MyEnrollments)
 		r.Get("/api/courses/{id}/enrollments", courseHandler.CourseEnrollments)
-		r.Post("/api/enrollments/{id}/approve", courseHandler.ApproveEnrollment)
+		r.With(idempotent).Post("/api/enrollments/{id}/approve", courseHandler.ApproveEnrollment)
 		r.Put("/api/courses/{id}/cover-image", courseHandler.UpdateCoverImage)
 		r.Delete("/api/enrollments/{id}/cancel", courseHandler.CancelEnrollment)
+		r.Get("/api/courses/{id}/sections", sectionHandler.ListSections)
+		r.Post("/api/courses/{id}/sections", sectionHandler.CreateSection)
+		r.Put("/api/sections/{id}", sectionHandler.UpdateSection)
+		r.Delete("/api/sections/{id}", sectionHandler.DeleteSection)
+		r.Put("/api/enrollments/{id}/section", sectionHandler.SetEnrollmentSection)
 
 		// Course content routes (curriculum & materials)
 		r.Get("/api/courses/{id}/curriculum", courseContentHandler.ListTopics)
@@ -221,6 +385,20 @@ func main() {
 		r.Get("/api/students/connections", studentHandler.ListConnections)
 		r.Get("/api/my-students", studentHandler.ListMyStudents)
 
+		// Guardian routes
+		r.Post("/api/students/{id}/guardians", guardianHandler.Invite)
+		r.Get("/api/students/{id}/guardians", guardianHandler.ListGuardians)
+		r.Delete("/api/guardians/{id}", guardianHandler.Revoke)
+		r.Post("/api/guardians/accept", guardianHandler.Accept)
+		r.Get("/api/children", guardianHandler.ListChildren)
+		r.Get("/api/children/{id}/grades", guardianHandler.ChildGrades)
+		r.Get("/api/children/{id}/attendance", guardianHandler.ChildAttendance)
+		r.Get("/api/children/{id}/attendance/summary", guardianHandler.ChildAttendanceSummary)
+		r.Get("/api/children/{id}/assignments", guardianHandler.ChildAssignments)
+		r.Get("/api/children/{id}/payments", guardianHandler.ChildPayments)
+		r.Get("/api/children/{id}/balance", guardianHandler.ChildBalance)
+		r.Get("/api/children/{id}/teachers", guardianHandler.ChildTeachers)
+
 		// Attendance routes
 		r.Post("/api/courses/{id}/attendance", attendanceHandler.MarkAttendance)
 		r.Get("/api/courses/{id}/attendance", attendanceHandler.GetSessionAttendance)
@@ -229,11 +407,42 @@ func main() {
 		r.Get("/api/my-attendance/summary", attendanceHandler.MyAttendanceSummary)
 
 		// Payment routes
-		r.Post("/api/payments", paymentHandler.RecordPayment)
+		r.With(idempotent).Post("/api/payments", paymentHandler.RecordPayment)
 		r.Get("/api/payments", paymentHandler.ListPayments)
 		r.Get("/api/my-payments", paymentHandler.MyPayments)
-		r.Post("/api/payments/initiate", paymentHandler.InitiatePayment)
-		r.Post("/api/payments/callback/alif", paymentHandler.HandleAlifCallback)
+		r.With(verified, idempotent).Post("/api/payments/initiate", paymentHandler.InitiatePayment)
+		r.Get("/api/payments/reconciliations", paymentHandler.ListReconciliations)
+		r.With(idempotent).Post("/api/payments/{id}/refund", paymentHandler.RefundPayment)
+		r.Get("/api/payments/{id}/refunds", paymentHandler.ListRefunds)
+		r.Get("/api/payments/{id}/receipt", paymentHandler.DownloadReceipt)
+
+		// Invoicing routes
+		r.Get("/api/my-balance", invoiceHandler.MyBalance)
+		r.Get("/api/courses/{id}/debtors", invoiceHandler.CourseDebtors)
+
+		// Pricing routes
+		r.Get("/api/courses/{id}/price", pricingHandler.GetPrice)
+		r.Post("/api/courses/{id}/promo-code", pricingHandler.ApplyPromoCode)
+		r.Post("/api/promo-codes", pricingHandler.CreatePromoCode)
+		r.Get("/api/promo-codes", pricingHandler.ListPromoCodes)
+		r.Delete("/api/promo-codes/{id}", pricingHandler.DeactivatePromoCode)
+		r.Post("/api/scholarships", pricingHandler.CreateScholarship)
+		r.Get("/api/scholarships", pricingHandler.ListScholarships)
+		r.Delete("/api/scholarships/{id}", pricingHandler.DeleteScholarship)
+		r.Put("/api/schools/my/sibling-discount", pricingHandler.SetSiblingDiscount)
+
+		// Teacher payout routes
+		r.Get("/api/schools/my/payout-settings", payoutHandler.GetSettings)
+		r.Put("/api/schools/my/payout-settings", payoutHandler.UpdateSettings)
+		r.Get("/api/schools/my/two-factor-policy", twoFactorHandler.GetSchoolPolicy)
+		r.Put("/api/schools/my/two-factor-policy", twoFactorHandler.SetSchoolPolicy)
+		r.Get("/api/payouts", payoutHandler.ListStatements)
+		r.Post("/api/payouts/{id}/mark-paid", payoutHandler.MarkPaid)
+		r.Get("/api/my-earnings", payoutHandler.MyEarnings)
+
+		// Exchange rate routes
+		r.Get("/api/exchange-rates", exchangeRateHandler.ListRates)
+		r.Post("/api/exchange-rates", exchangeRateHandler.SetRate)
 
 		// Announcement routes
 		r.Post("/api/announcements", announcementHandler.Create)
@@ -249,6 +458,7 @@ func main() {
 		r.Get("/api/analytics/revenue-trend", dashboardHandler.GetRevenueTrend)
 		r.Get("/api/analytics/attendance-trend", dashboardHandler.GetAttendanceTrend)
 		r.Get("/api/analytics/course-breakdown", dashboardHandler.GetCourseBreakdown)
+		r.Get("/api/analytics/branch-breakdown", dashboardHandler.GetBranchBreakdown)
 		r.Get("/api/analytics/export", dashboardHandler.ExportCSV)
 
 		// Calendar export
@@ -258,7 +468,7 @@ func main() {
 		r.Post("/api/settings/change-password", settingsHandler.ChangePassword)
 
 		// Grade routes
-		r.Post("/api/courses/{id}/grades", gradeHandler.CreateGrade)
+		r.With(idempotent).Post("/api/courses/{id}/grades", gradeHandler.CreateGrade)
 		r.Get("/api/courses/{id}/grades", gradeHandler.ListCourseGrades)
 		r.Get("/api/my-grades", gradeHandler.MyGrades)
 
@@ -281,6 +491,23 @@ func main() {
 		r.Get("/api/messages/conversations", messageHandler.ListConversations)
 		r.Get("/api/messages/unread-count", messageHandler.UnreadCount)
 		r.Get("/api/messages/{userId}", messageHandler.GetConversation)
+
+		// Platform admin console
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(handler.RequireRole(domain.RoleAdmin))
+			r.Get("/users", adminHandler.ListUsers)
+			r.Post("/users/{id}/suspend", adminHandler.SuspendUser)
+			r.Post("/users/{id}/unsuspend", adminHandler.UnsuspendUser)
+			r.Post("/users/{id}/impersonate", adminHandler.Impersonate)
+			r.Get("/schools", adminHandler.ListSchools)
+			r.Post("/schools/{id}/verify", adminHandler.VerifySchool)
+			r.Get("/ratings", adminHandler.ListRatings)
+			r.Post("/ratings/{id}/hide", adminHandler.HideRating)
+			r.Post("/ratings/{id}/restore", adminHandler.RestoreRating)
+			r.Delete("/ratings/{id}", adminHandler.DeleteRating)
+			r.Get("/metrics", adminHandler.Metrics)
+			r.Get("/audit-log", adminHandler.AuditLog)
+		})
 	})
 
 	port := os.Getenv("PORT")
@@ -288,8 +515,69 @@ func main() {
 		port = "8080"
 	}
 
+	// Background workers live as long as the server does
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	paymentReconciler.Start(ctx)
+	waitlistWorker.Start(ctx)
+	invoiceWorker.Start(ctx)
+
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
 	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	paymentReconciler.Stop()
+	waitlistWorker.Stop()
+	invoiceWorker.Stop()
+}
+
+// envOr reads a string from the environment, falling back to def.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envDuration reads a time.Duration (e.g. "10m") from the environment, falling back to def.
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("Invalid %s=%q, using %s", key, v, def)
+	}
+	return def
+}
+
+// envInt reads an integer from the environment, falling back to def.
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s=%q, using %d", key, v, def)
+	}
+	return def
+}
+
+// envRateLimit reads a rate limit such as "10/1m" from the environment, falling back to def.
+func envRateLimit(key string, def service.RateLimit) service.RateLimit {
+	if v := os.Getenv(key); v != "" {
+		if limit, err := service.ParseRateLimit(v); err == nil {
+			return limit
+		}
+		log.Printf("Invalid %s=%q, using %d/%s", key, v, def.Requests, def.Per)
+	}
+	return def
 }
@@ -11,44 +11,254 @@ const (
 	RoleSchoolAdmin Role = "school_admin"
 	RoleTeacher     Role = "teacher"
 	RoleStudent     Role = "student"
+	RoleParent      Role = "parent" // parent or guardian of one or more students
 )
 
 type User struct {
-	ID           string    `json:"id"` // UUID
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	PasswordHash string    `json:"-"`
-	Role         Role      `json:"role"`
-	SchoolName   *string   `json:"school_name,omitempty"`
-	AvatarURL    *string   `json:"avatar_url"`
-	RatingAvg    float64   `json:"rating_avg"`
-	RatingCount  int       `json:"rating_count"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               string     `json:"id"`                          // UUID
+	Email            string     `json:"email"`                       // empty for accounts registered with a phone number only
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"` // nil until the address is confirmed
+	EmailAssumed     bool       `json:"email_assumed,omitempty"`     // verified only because the account predates verification; nobody confirmed it
+	Phone            *string    `json:"phone,omitempty"`             // E.164, e.g. +992901234567
+	PhoneVerifiedAt  *time.Time `json:"phone_verified_at,omitempty"` // set once a code sent to the phone is entered
+	Name             string     `json:"name"`
+	PasswordHash     string     `json:"-"`
+	Role             Role       `json:"role"`
+	SchoolName       *string    `json:"school_name,omitempty"`
+	BranchName       *string    `json:"branch_name,omitempty"` // a teacher's branch, in school teacher lists
+	AvatarURL        *string    `json:"avatar_url"`
+	RatingAvg        float64    `json:"rating_avg"`
+	RatingCount      int        `json:"rating_count"`
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"` // set while an admin has suspended the account
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
-type School struct {
+// PhoneOTP is a one-time code sent to a phone number by SMS. Only its hash is kept.
+type PhoneOTP struct {
+	ID        string
+	Phone     string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// Session is one signed-in device. Access tokens carry its ID, so revoking the session
+// cuts the device off.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"` // the session making the request
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// ImpersonatorUserID is the admin who opened the session as this user for support.
+	ImpersonatorUserID *string `json:"impersonator_user_id,omitempty"`
+}
+
+// AuthTokens is what a login or refresh hands to the client. When the account has
+// two-factor authentication on, a password login yields only TwoFactorToken, which is
+// traded for real tokens together with a code from the authenticator app.
+type AuthTokens struct {
+	Token                  string `json:"token,omitempty"` // short-lived access token
+	RefreshToken           string `json:"refresh_token,omitempty"`
+	ExpiresIn              int    `json:"expires_in,omitempty"` // seconds until Token expires
+	TwoFactorRequired      bool   `json:"two_factor_required,omitempty"`
+	TwoFactorToken         string `json:"two_factor_token,omitempty"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"` // the school requires 2FA; only setting it up is allowed
+	// A first sign-in with an external provider yields only SignupToken, which is traded
+	// for real tokens once the user picks a role.
+	SignupRequired bool   `json:"signup_required,omitempty"`
+	SignupToken    string `json:"signup_token,omitempty"`
+	SignupEmail    string `json:"signup_email,omitempty"`
+	SignupName     string `json:"signup_name,omitempty"`
+}
+
+// UserIdentity is an account at an external OpenID Connect provider that signs in as a user.
+type UserIdentity struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Provider    string     `json:"provider"` // e.g. google
+	Subject     string     `json:"-"`        // the provider's stable ID for the account
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Audit actions.
+const (
+	AuditAccountLocked        = "account.locked"
+	AuditIdentityLinked       = "account.identity.linked" // an external sign-in provider account was linked
+	AuditUserSuspended        = "admin.user.suspended"
+	AuditUserUnsuspended      = "admin.user.unsuspended"
+	AuditSchoolVerified       = "admin.school.verified"
+	AuditSchoolUnverified     = "admin.school.unverified"
+	AuditRatingHidden         = "admin.rating.hidden"
+	AuditRatingRestored       = "admin.rating.restored"
+	AuditRatingDeleted        = "admin.rating.deleted"
+	AuditImpersonationStarted = "admin.impersonation.started"
+	AuditImpersonatedRequest  = "admin.impersonation.request" // a change made while impersonating
+)
+
+// AuditEntry records a security-relevant event.
+type AuditEntry struct {
 	ID          string    `json:"id"`
-	AdminUserID string    `json:"admin_user_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	TaxID       string    `json:"tax_id,omitempty"`
-	Phone       string    `json:"phone,omitempty"`
-	Email       string    `json:"email,omitempty"`
-	Address     string    `json:"address,omitempty"`
-	City        string    `json:"city,omitempty"`
-	Website     string    `json:"website,omitempty"`
-	LogoURL     string    `json:"logo_url,omitempty"`
-	IsVerified  bool      `json:"is_verified"`
-	RatingAvg   float64   `json:"rating_avg"`
-	RatingCount int       `json:"rating_count"`
+	ActorUserID *string   `json:"actor_user_id,omitempty"` // nil for events without a signed-in actor
+	Action      string    `json:"action"`
+	TargetType  string    `json:"target_type"`
+	TargetID    string    `json:"target_id"`
+	IPAddress   string    `json:"ip_address"`
+	Details     string    `json:"details,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PlatformMetrics summarizes the whole platform for the admin console. Money is in the
+// base currency.
+type PlatformMetrics struct {
+	UsersByRole        map[Role]int `json:"users_by_role"`
+	NewUsers30d        int          `json:"new_users_30d"`
+	SuspendedUsers     int          `json:"suspended_users"`
+	Schools            int          `json:"schools"`
+	UnverifiedSchools  int          `json:"unverified_schools"`
+	Courses            int          `json:"courses"`
+	ActiveEnrollments  int          `json:"active_enrollments"`
+	PendingEnrollments int          `json:"pending_enrollments"`
+	Revenue30d         float64      `json:"revenue_30d"`
+	PendingPayments    int          `json:"pending_payments"`
+	HiddenRatings      int          `json:"hidden_ratings"`
+	Currency           string       `json:"currency"`
+}
+
+// TwoFactorStatus describes a user's two-factor authentication.
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"` // a school the user teaches at enforces it
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment is the secret a user loads into their authenticator app.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`      // base32, for typing in by hand
+	OTPAuthURL string `json:"otpauth_url"` // otpauth:// URI, usually shown as a QR code
+}
+
+type School struct {
+	ID                string    `json:"id"`
+	AdminUserID       string    `json:"admin_user_id"` // the owner; other staff are in school_members
+	Name              string    `json:"name"`
+	Description       string    `json:"description,omitempty"`
+	TaxID             string    `json:"tax_id,omitempty"`
+	Phone             string    `json:"phone,omitempty"`
+	Email             string    `json:"email,omitempty"`
+	Address           string    `json:"address,omitempty"`
+	City              string    `json:"city,omitempty"`
+	Website           string    `json:"website,omitempty"`
+	LogoURL           string    `json:"logo_url,omitempty"`
+	ReportingCurrency string    `json:"reporting_currency"` // revenue analytics are converted to it
+	IsVerified        bool      `json:"is_verified"`
+	RatingAvg         float64   `json:"rating_avg"`
+	RatingCount       int       `json:"rating_count"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+
+	// Verification review, populated for platform admins.
+	VerificationNote string     `json:"verification_note,omitempty"`
+	VerifiedAt       *time.Time `json:"verified_at,omitempty"`
+}
+
+// SchoolRole is a staff member's role at a school.
+type SchoolRole string
+
+const (
+	SchoolRoleOwner      SchoolRole = "owner" // created the school; cannot be removed
+	SchoolRoleAdmin      SchoolRole = "admin"
+	SchoolRoleAccountant SchoolRole = "accountant"
+	SchoolRoleRegistrar  SchoolRole = "registrar"
+	// Runs one branch and sees only its courses, students and figures.
+	SchoolRoleBranchManager SchoolRole = "branch_manager"
+)
+
+// SchoolPermission is something a school role allows at its school.
+type SchoolPermission string
+
+const (
+	SchoolPermProfile     SchoolPermission = "profile"     // edit the school's public profile
+	SchoolPermDelete      SchoolPermission = "delete"      // delete the school
+	SchoolPermStaff       SchoolPermission = "staff"       // add and remove staff
+	SchoolPermSecurity    SchoolPermission = "security"    // require two-factor authentication
+	SchoolPermTeachers    SchoolPermission = "teachers"    // invite and remove teachers
+	SchoolPermCourses     SchoolPermission = "courses"     // create and run courses
+	SchoolPermEnrollments SchoolPermission = "enrollments" // invite students and answer requests
+	SchoolPermStudents    SchoolPermission = "students"    // see student records, manage guardians
+	SchoolPermPayments    SchoolPermission = "payments"    // record and refund payments, pricing and discounts
+	SchoolPermPayouts     SchoolPermission = "payouts"     // teacher payout settings and statements
+	SchoolPermReports     SchoolPermission = "reports"     // revenue analytics and exports
+)
+
+// SchoolRolePermissions is the permission set of each school role.
+var SchoolRolePermissions = map[SchoolRole][]SchoolPermission{
+	SchoolRoleOwner: {SchoolPermProfile, SchoolPermDelete, SchoolPermStaff, SchoolPermSecurity, SchoolPermTeachers, SchoolPermCourses,
+		SchoolPermEnrollments, SchoolPermStudents, SchoolPermPayments, SchoolPermPayouts, SchoolPermReports},
+	SchoolRoleAdmin: {SchoolPermProfile, SchoolPermStaff, SchoolPermSecurity, SchoolPermTeachers, SchoolPermCourses,
+		SchoolPermEnrollments, SchoolPermStudents, SchoolPermPayments, SchoolPermPayouts, SchoolPermReports},
+	SchoolRoleAccountant: {SchoolPermPayments, SchoolPermPayouts, SchoolPermReports},
+	SchoolRoleRegistrar:  {SchoolPermTeachers, SchoolPermCourses, SchoolPermEnrollments, SchoolPermStudents},
+	SchoolRoleBranchManager: {SchoolPermCourses, SchoolPermEnrollments, SchoolPermStudents, SchoolPermPayments,
+		SchoolPermReports},
+}
+
+// Has reports whether the role's permission set includes p.
+func (r SchoolRole) Has(p SchoolPermission) bool {
+	for _, granted := range SchoolRolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// SchoolMember is a staff account at a school.
+type SchoolMember struct {
+	SchoolID    string             `json:"school_id"`
+	UserID      string             `json:"user_id"`
+	Name        string             `json:"name,omitempty"`  // populated on read
+	Email       string             `json:"email,omitempty"` // populated on read
+	Role        SchoolRole         `json:"role"`
+	BranchID    *string            `json:"branch_id,omitempty"`   // set for branch managers only
+	BranchName  string             `json:"branch_name,omitempty"` // populated on read
+	Permissions []SchoolPermission `json:"permissions,omitempty"`
+	AddedBy     *string            `json:"added_by,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// SchoolBranch is one of a school's locations.
+type SchoolBranch struct {
+	ID        string    `json:"id"`
+	SchoolID  string    `json:"school_id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	City      string    `json:"city,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BranchRoom is a room at a branch that classes are held in.
+type BranchRoom struct {
+	ID        string    `json:"id"`
+	BranchID  string    `json:"branch_id"`
+	Name      string    `json:"name"`
+	Capacity  *int      `json:"capacity,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type TeacherProfile struct {
 	UserID     string    `json:"user_id"` // PK, FK to User
 	SchoolID   *string   `json:"school_id,omitempty"`
+	BranchID   *string   `json:"branch_id,omitempty"` // the branch of the school they teach at
 	Bio        string    `json:"bio"`
 	Subjects   []string  `json:"subjects"` // JSON
 	HourlyRate float64   `json:"hourly_rate"`
@@ -67,6 +277,73 @@ type Student struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+const (
+	GuardianLinkPending = "pending"
+	GuardianLinkActive  = "active"
+	GuardianLinkRevoked = "revoked"
+)
+
+// GuardianLink connects a parent account to a student. It starts as an invitation to an
+// email address or phone number and is active once a parent accepts it.
+type GuardianLink struct {
+	ID             string     `json:"id"`
+	StudentUserID  string     `json:"student_user_id"`
+	StudentName    string     `json:"student_name,omitempty"` // populated on read
+	GuardianUserID *string    `json:"guardian_user_id,omitempty"`
+	GuardianName   string     `json:"guardian_name,omitempty"` // populated on read
+	Relationship   string     `json:"relationship,omitempty"`  // e.g. mother, father, guardian
+	InvitedEmail   string     `json:"invited_email,omitempty"`
+	InvitedPhone   string     `json:"invited_phone,omitempty"`
+	InvitedBy      string     `json:"invited_by"`
+	Status         string     `json:"status"` // pending, active, revoked
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Teacher invitation statuses.
+const (
+	TeacherInvitationPending  = "pending"
+	TeacherInvitationAccepted = "accepted"
+	TeacherInvitationRevoked  = "revoked"
+)
+
+// TeacherInvitation asks the owner of an email address to teach at a school. An existing
+// teacher account accepts it while signed in; anyone else sets a password to create one.
+type TeacherInvitation struct {
+	ID         string     `json:"id"`
+	SchoolID   string     `json:"school_id"`
+	SchoolName string     `json:"school_name,omitempty"` // populated on read
+	Email      string     `json:"email"`
+	Bio        string     `json:"bio,omitempty"` // set on the teacher's profile if it has none
+	InvitedBy  string     `json:"invited_by"`
+	Status     string     `json:"status"` // pending, accepted, revoked
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedBy *string    `json:"accepted_by,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Child is a student as their guardian sees them.
+type Child struct {
+	UserID       string  `json:"user_id"`
+	Name         string  `json:"name"`
+	AvatarURL    *string `json:"avatar_url,omitempty"`
+	GradeLevel   string  `json:"grade_level,omitempty"`
+	SchoolID     *string `json:"school_id,omitempty"`
+	SchoolName   string  `json:"school_name,omitempty"`
+	Relationship string  `json:"relationship,omitempty"`
+}
+
+// ChildTeacher is a teacher of one of a child's courses, whom the guardian may message.
+type ChildTeacher struct {
+	UserID      string  `json:"user_id"`
+	Name        string  `json:"name"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	CourseID    string  `json:"course_id"`
+	CourseTitle string  `json:"course_title"`
+}
+
 type Schedule struct {
 	Days      []string `json:"days"`       // e.g. ["Mon", "Wed"]
 	StartDate string   `json:"start_date"` // YYYY-MM-DD
@@ -76,29 +353,86 @@ type Schedule struct {
 }
 
 type Course struct {
-	ID                   string    `json:"id"`
-	Title                string    `json:"title"`
-	Description          string    `json:"description,omitempty"`
-	Schedule             *Schedule `json:"schedule,omitempty"`
-	SchoolID             *string   `json:"school_id,omitempty"`
-	SchoolName           string    `json:"school_name,omitempty"`
-	TeacherID            *string   `json:"teacher_id,omitempty"`
-	TeacherName          string    `json:"teacher_name,omitempty"`
-	TeacherEmail         string    `json:"teacher_email,omitempty"`
-	TeacherAvatar        *string   `json:"teacher_avatar,omitempty"` // populated on read
-	CoverImageURL        *string   `json:"cover_image_url,omitempty"`
-	CategoryID           *string   `json:"category_id,omitempty"`
-	CategoryName         string    `json:"category_name,omitempty"`
-	Tags                 []string  `json:"tags,omitempty"`
-	Difficulty           string    `json:"difficulty,omitempty"` // beginner, intermediate, advanced
-	Language             string    `json:"language,omitempty"`
-	Price                float64   `json:"price"`
-	RatingAvg            float64   `json:"rating_avg"`
-	RatingCount          int       `json:"rating_count"`
-	PendingRequestsCount int       `json:"pending_requests_count,omitempty"`
-	ViewCount            int       `json:"view_count,omitempty"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                   string          `json:"id"`
+	Title                string          `json:"title"`
+	Description          string          `json:"description,omitempty"`
+	Schedule             *Schedule       `json:"schedule,omitempty"`
+	SchoolID             *string         `json:"school_id,omitempty"`
+	SchoolName           string          `json:"school_name,omitempty"`
+	BranchID             *string         `json:"branch_id,omitempty"`
+	BranchName           string          `json:"branch_name,omitempty"`  // populated on read
+	MaxStudents          *int            `json:"max_students,omitempty"` // seat limit; nil means unlimited
+	TeacherID            *string         `json:"teacher_id,omitempty"`
+	TeacherName          string          `json:"teacher_name,omitempty"`
+	TeacherEmail         string          `json:"teacher_email,omitempty"`
+	TeacherAvatar        *string         `json:"teacher_avatar,omitempty"` // populated on read
+	CoverImageURL        *string         `json:"cover_image_url,omitempty"`
+	CategoryID           *string         `json:"category_id,omitempty"`
+	CategoryName         string          `json:"category_name,omitempty"`
+	Tags                 []string        `json:"tags,omitempty"`
+	Difficulty           string          `json:"difficulty,omitempty"` // beginner, intermediate, advanced
+	Language             string          `json:"language,omitempty"`
+	Price                float64         `json:"price"`
+	Currency             string          `json:"currency"`      // ISO 4217, e.g. TJS
+	BillingCycle         string          `json:"billing_cycle"` // one_time, monthly
+	RatingAvg            float64         `json:"rating_avg"`
+	RatingCount          int             `json:"rating_count"`
+	PendingRequestsCount int             `json:"pending_requests_count,omitempty"`
+	ViewCount            int             `json:"view_count,omitempty"`
+	Sections             []CourseSection `json:"sections,omitempty"` // populated on the detail read
+	CreatedAt            time.Time       `json:"created_at"`
+	UpdatedAt            time.Time       `json:"updated_at"`
+}
+
+// CourseSection is one group of a course, meeting on its own schedule with its own teacher
+// and seats. The curriculum and materials stay the course's.
+type CourseSection struct {
+	ID           string    `json:"id"`
+	CourseID     string    `json:"course_id"`
+	Name         string    `json:"name"`
+	Schedule     *Schedule `json:"schedule,omitempty"`
+	TeacherID    *string   `json:"teacher_id,omitempty"`
+	TeacherName  string    `json:"teacher_name,omitempty"` // populated on read
+	MaxStudents  *int      `json:"max_students,omitempty"` // seat limit; nil means only the course's
+	StudentCount int       `json:"student_count"`          // active students; populated on read
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const (
+	BillingCycleOneTime = "one_time"
+	BillingCycleMonthly = "monthly"
+)
+
+const (
+	CurrencyTJS = "TJS"
+	CurrencyUSD = "USD"
+	CurrencyRUB = "RUB"
+	CurrencyEUR = "EUR"
+
+	// BaseCurrency is the currency exchange rates are quoted in.
+	BaseCurrency = CurrencyTJS
+)
+
+// SupportedCurrencies lists the currencies courses can be priced in.
+var SupportedCurrencies = map[string]bool{
+	CurrencyTJS: true,
+	CurrencyUSD: true,
+	CurrencyRUB: true,
+	CurrencyEUR: true,
+}
+
+const RateSourceManual = "manual"
+
+// ExchangeRate is how many units of BaseCurrency one unit of Currency is worth from EffectiveAt on.
+type ExchangeRate struct {
+	ID          string    `json:"id"`
+	Currency    string    `json:"currency"`
+	Rate        float64   `json:"rate"`
+	EffectiveAt time.Time `json:"effective_at"`
+	Source      string    `json:"source"` // manual, or the institution the admin copied it from
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type Category struct {
@@ -120,9 +454,15 @@ type Enrollment struct {
 	StudentAvatar *string   `json:"student_avatar,omitempty"`
 	CourseID      string    `json:"course_id"`
 	CourseName    string    `json:"course_name,omitempty"`
+	SectionID     *string   `json:"section_id,omitempty"`
+	SectionName   string    `json:"section_name,omitempty"` // populated on read
 	EnrolledAt    time.Time `json:"enrolled_at"`
 	Status        string    `json:"status"`
 	Progress      float64   `json:"progress,omitempty"`
+	// WaitlistPosition is 1 for the next student to be offered a seat; set while waitlisted.
+	WaitlistPosition *int `json:"waitlist_position,omitempty"`
+	// OfferExpiresAt is when a seat offered to a waitlisted student is given to the next one.
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"`
 }
 
 type TopicCompletion struct {
@@ -148,6 +488,10 @@ const (
 	EnrollmentStatusInvited   = "invited"
 	EnrollmentStatusRejected  = "rejected"
 	EnrollmentStatusPending   = "pending"
+	// Approved but the course is full; waiting in line for a seat.
+	EnrollmentStatusWaitlisted = "waitlisted"
+	// A seat freed up and is held for a waitlisted student until they accept or the offer expires.
+	EnrollmentStatusOffered = "offered"
 )
 
 type Rating struct {
@@ -159,12 +503,17 @@ type Rating struct {
 	Score      int       `json:"score"`
 	Comment    string    `json:"comment"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// Moderation, populated for platform admins. Hidden ratings are not shown or counted.
+	HiddenAt       *time.Time `json:"hidden_at,omitempty"`
+	ModerationNote string     `json:"moderation_note,omitempty"`
 }
 
 type Attendance struct {
 	ID            string    `json:"id"`
 	EnrollmentID  string    `json:"enrollment_id"`
 	CourseID      string    `json:"course_id"`
+	SectionID     *string   `json:"section_id,omitempty"` // the section the session was for
 	StudentUserID string    `json:"student_user_id"`
 	StudentName   string    `json:"student_name,omitempty"`
 	StudentAvatar *string   `json:"student_avatar,omitempty"` // populated on read
@@ -194,16 +543,21 @@ type AttendanceSummary struct {
 }
 
 const (
-	PaymentMethodCash     = "cash"
-	PaymentMethodCard     = "card"
-	PaymentMethodTransfer = "transfer"
-	PaymentMethodAlif     = "alif"
+	PaymentMethodCash       = "cash"
+	PaymentMethodCard       = "card"
+	PaymentMethodTransfer   = "transfer"
+	PaymentMethodAlif       = "alif"
+	PaymentMethodHumo       = "humo"
+	PaymentMethodKortiMilli = "korti_milli"
+	PaymentMethodOther      = "other"
 )
 
 const (
-	PaymentStatusPending = "pending"
-	PaymentStatusSuccess = "success"
-	PaymentStatusFailed  = "failed"
+	PaymentStatusPending           = "pending"
+	PaymentStatusSuccess           = "success"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
 )
 
 type Payment struct {
@@ -213,9 +567,14 @@ type Payment struct {
 	StudentAvatar  *string   `json:"student_avatar,omitempty"` // populated on read
 	CourseID       string    `json:"course_id"`
 	CourseTitle    string    `json:"course_title,omitempty"`
+	SectionID      *string   `json:"section_id,omitempty"`   // the student's section; populated on read
+	SectionName    string    `json:"section_name,omitempty"` // populated on read
 	Amount         float64   `json:"amount"`
-	Method         string    `json:"method"`      // cash, card, transfer, alif
-	Status         string    `json:"status"`      // pending, success, failed
+	Currency       string    `json:"currency"`
+	ExchangeRate   float64   `json:"exchange_rate"` // BaseCurrency per unit of Currency when paid
+	RefundedAmount float64   `json:"refunded_amount"`
+	Method         string    `json:"method"`      // cash, card, transfer, alif, humo, korti_milli
+	Status         string    `json:"status"`      // pending, success, failed, refunded, partially_refunded
 	ExternalID     string    `json:"external_id"` // Provider's reference ID
 	Note           string    `json:"note,omitempty"`
 	ReceiptURL     string    `json:"receipt_url,omitempty"`
@@ -225,6 +584,236 @@ type Payment struct {
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+const (
+	ReconcileReasonProvider = "provider" // the gateway reported a final status
+	ReconcileReasonExpired  = "expired"  // never finished within the expiry window
+)
+
+// Receipt is the numbered PDF issued for a settled payment.
+// Numbers are sequential per issuer: the course's school, or its teacher if independent.
+type Receipt struct {
+	ID        string    `json:"id"`
+	PaymentID string    `json:"payment_id"`
+	IssuerID  string    `json:"issuer_id"`
+	Number    int       `json:"number"`
+	FilePath  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	RefundStatusPending = "pending"
+	RefundStatusSuccess = "success"
+	RefundStatusFailed  = "failed"
+)
+
+// Refund is money returned against a payment; a payment may have several partial refunds.
+type Refund struct {
+	ID         string    `json:"id"`
+	PaymentID  string    `json:"payment_id"`
+	Amount     float64   `json:"amount"`
+	Reason     string    `json:"reason,omitempty"`
+	Status     string    `json:"status"`      // pending, success, failed
+	ExternalID string    `json:"external_id"` // Provider's refund reference, empty for manual methods
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PaymentReconciliation records a status change applied by the background reconciler.
+type PaymentReconciliation struct {
+	ID          string    `json:"id"`
+	PaymentID   string    `json:"payment_id"`
+	Provider    string    `json:"provider"`
+	ExternalID  string    `json:"external_id"`
+	OldStatus   string    `json:"old_status"`
+	NewStatus   string    `json:"new_status"`
+	Reason      string    `json:"reason"` // provider, expired
+	StudentName string    `json:"student_name,omitempty"`
+	CourseTitle string    `json:"course_title,omitempty"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	InvoiceStatusOpen          = "open"
+	InvoiceStatusPartiallyPaid = "partially_paid"
+	InvoiceStatusPaid          = "paid"
+	InvoiceStatusVoid          = "void"
+)
+
+// Invoice is a tuition charge for one enrollment and billing period.
+type Invoice struct {
+	ID            string    `json:"id"`
+	EnrollmentID  string    `json:"enrollment_id"`
+	StudentUserID string    `json:"student_user_id"`
+	StudentName   string    `json:"student_name,omitempty"`
+	CourseID      string    `json:"course_id"`
+	CourseTitle   string    `json:"course_title,omitempty"`
+	Amount        float64   `json:"amount"`
+	AmountPaid    float64   `json:"amount_paid"`
+	Currency      string    `json:"currency"`     // the course's currency
+	Status        string    `json:"status"`       // open, partially_paid, paid, void
+	PeriodStart   string    `json:"period_start"` // YYYY-MM-DD
+	PeriodEnd     *string   `json:"period_end,omitempty"`
+	DueDate       string    `json:"due_date"` // YYYY-MM-DD
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CourseBalance summarises a student's invoices for one course.
+// Outstanding only counts invoices that are already due.
+type CourseBalance struct {
+	CourseID    string    `json:"course_id"`
+	CourseTitle string    `json:"course_title"`
+	Currency    string    `json:"currency"`
+	Invoiced    float64   `json:"invoiced"`
+	Paid        float64   `json:"paid"`
+	Outstanding float64   `json:"outstanding"`
+	Invoices    []Invoice `json:"invoices"`
+}
+
+// StudentBalance totals a student's courses. Outstanding is in BaseCurrency at today's
+// rates; OutstandingByCurrency holds the exact amounts owed in each course currency.
+type StudentBalance struct {
+	Outstanding           float64            `json:"outstanding"` // in BaseCurrency
+	OutstandingByCurrency map[string]float64 `json:"outstanding_by_currency"`
+	// UnconvertedCurrencies are currencies Outstanding leaves out because they have no
+	// exchange rate yet; OutstandingByCurrency still has them.
+	UnconvertedCurrencies []string        `json:"unconverted_currencies,omitempty"`
+	Courses               []CourseBalance `json:"courses"`
+}
+
+// Debtor is a student with overdue tuition in a course.
+type Debtor struct {
+	StudentUserID   string  `json:"student_user_id"`
+	StudentName     string  `json:"student_name"`
+	StudentEmail    string  `json:"student_email"`
+	StudentAvatar   *string `json:"student_avatar,omitempty"`
+	Outstanding     float64 `json:"outstanding"`
+	Currency        string  `json:"currency"`
+	OverdueInvoices int     `json:"overdue_invoices"`
+	OldestDueDate   string  `json:"oldest_due_date"` // YYYY-MM-DD
+}
+
+const (
+	DiscountTypePercent = "percent"
+	DiscountTypeFixed   = "fixed"
+)
+
+const (
+	PriceAdjustmentScholarship = "scholarship"
+	PriceAdjustmentSibling     = "sibling"
+	PriceAdjustmentPromo       = "promo"
+)
+
+// PromoCode is a discount code. It applies to the courses of SchoolID, narrowed to
+// CourseID when set; a code with neither is valid platform-wide.
+type PromoCode struct {
+	ID           string     `json:"id"`
+	Code         string     `json:"code"`
+	SchoolID     *string    `json:"school_id,omitempty"`
+	CourseID     *string    `json:"course_id,omitempty"`
+	CreatedBy    string     `json:"created_by"`
+	DiscountType string     `json:"discount_type"` // percent, fixed
+	Value        float64    `json:"value"`
+	Currency     string     `json:"currency"`           // of a fixed Value
+	MaxUses      *int       `json:"max_uses,omitempty"` // nil means unlimited
+	UsedCount    int        `json:"used_count"`
+	ValidFrom    *time.Time `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time `json:"valid_until,omitempty"`
+	IsActive     bool       `json:"is_active"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Scholarship is a standing discount a school grants one student, for one course or all of them.
+type Scholarship struct {
+	ID            string    `json:"id"`
+	SchoolID      string    `json:"school_id"`
+	StudentUserID string    `json:"student_user_id"`
+	StudentName   string    `json:"student_name,omitempty"`
+	CourseID      *string   `json:"course_id,omitempty"` // nil covers every course of the school
+	CourseTitle   *string   `json:"course_title,omitempty"`
+	DiscountType  string    `json:"discount_type"` // percent, fixed
+	Value         float64   `json:"value"`
+	Currency      string    `json:"currency"` // of a fixed Value
+	Note          string    `json:"note,omitempty"`
+	ValidUntil    *string   `json:"valid_until,omitempty"` // YYYY-MM-DD, inclusive
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PriceAdjustment is one discount applied while computing a student's price.
+type PriceAdjustment struct {
+	Kind   string  `json:"kind"` // scholarship, sibling, promo
+	Label  string  `json:"label"`
+	Amount float64 `json:"amount"`
+}
+
+// PriceQuote is what a student actually pays for a course (per period for monthly courses).
+type PriceQuote struct {
+	CourseID       string            `json:"course_id"`
+	BasePrice      float64           `json:"base_price"`
+	Adjustments    []PriceAdjustment `json:"adjustments"`
+	EffectivePrice float64           `json:"effective_price"`
+	Currency       string            `json:"currency"`
+	BillingCycle   string            `json:"billing_cycle"`
+}
+
+const (
+	PayoutModePercentage = "percentage"
+	PayoutModeHourly     = "hourly"
+)
+
+const (
+	PayoutStatusPending = "pending"
+	PayoutStatusPaid    = "paid"
+)
+
+// PayoutSettings is how a school splits the revenue of its courses with their teachers.
+type PayoutSettings struct {
+	Mode                string  `json:"mode"`                  // percentage, hourly
+	TeacherSharePercent float64 `json:"teacher_share_percent"` // used in percentage mode
+}
+
+// PayoutStatement is what a school owes one teacher for one month, in the school's reporting currency.
+type PayoutStatement struct {
+	ID          string       `json:"id"`
+	SchoolID    string       `json:"school_id"`
+	SchoolName  string       `json:"school_name,omitempty"`
+	TeacherID   string       `json:"teacher_id"`
+	TeacherName string       `json:"teacher_name,omitempty"`
+	Period      string       `json:"period"` // YYYY-MM
+	Mode        string       `json:"mode"`   // percentage, hourly
+	Currency    string       `json:"currency"`
+	Revenue     float64      `json:"revenue"` // net revenue of the teacher's courses
+	Sessions    int          `json:"sessions"`
+	Hours       float64      `json:"hours"`
+	Amount      float64      `json:"amount"`
+	Status      string       `json:"status"` // pending, paid
+	PaidAt      *time.Time   `json:"paid_at,omitempty"`
+	PaidBy      *string      `json:"paid_by,omitempty"`
+	Reference   string       `json:"reference,omitempty"`
+	Lines       []PayoutLine `json:"lines"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// PayoutLine is one course's contribution to a payout statement.
+type PayoutLine struct {
+	CourseID    string  `json:"course_id"`
+	CourseTitle string  `json:"course_title,omitempty"`
+	Revenue     float64 `json:"revenue"`
+	Sessions    int     `json:"sessions"`
+	Hours       float64 `json:"hours"`
+	Rate        float64 `json:"rate"` // hourly rate in hourly mode, 0 otherwise
+	Amount      float64 `json:"amount"`
+}
+
+// TeacherEarnings totals a teacher's payout statements per currency.
+type TeacherEarnings struct {
+	Pending    map[string]float64 `json:"pending"`
+	Paid       map[string]float64 `json:"paid"`
+	Statements []PayoutStatement  `json:"statements"`
+}
+
 type Announcement struct {
 	ID           string    `json:"id"`
 	CourseID     *string   `json:"course_id,omitempty"`
@@ -245,6 +834,7 @@ type Grade struct {
 	StudentAvatar *string    `json:"student_avatar,omitempty"` // populated on read
 	CourseID      string     `json:"course_id"`
 	CourseTitle   string     `json:"course_title,omitempty"`
+	SectionID     *string    `json:"section_id,omitempty"` // the student's section when graded
 	Title         string     `json:"title"`
 	Score         float64    `json:"score"`
 	LetterGrade   string     `json:"letter_grade,omitempty"`
@@ -268,7 +858,8 @@ type Notification struct {
 type Assignment struct {
 	ID          string    `json:"id"`
 	CourseID    string    `json:"course_id"`
-	CourseTitle string    `json:"course_title"` // populated on read
+	CourseTitle string    `json:"course_title"`         // populated on read
+	SectionID   *string   `json:"section_id,omitempty"` // set for one section's assignment
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	DueDate     time.Time `json:"due_date"`
@@ -337,3 +928,23 @@ type CourseMaterial struct {
 	UploadedBy  string    `json:"uploaded_by"`
 	CreatedAt   time.Time `json:"created_at"`
 }
+
+const (
+	IdempotencyStatusProcessing = "processing"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// IdempotencyRecord remembers the response to a request sent with an Idempotency-Key header.
+type IdempotencyRecord struct {
+	ID                  string
+	UserID              string
+	Key                 string
+	Method              string
+	Path                string
+	RequestHash         string
+	Status              string // processing, completed
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        []byte
+	CreatedAt           time.Time
+}
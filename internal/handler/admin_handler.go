@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+// AdminHandler serves the platform admin console under /api/admin. Its routes are
+// mounted behind RequireRole(domain.RoleAdmin).
+type AdminHandler struct {
+	service *service.AdminService
+}
+
+func NewAdminHandler(s *service.AdminService) *AdminHandler {
+	return &AdminHandler{service: s}
+}
+
+// optionalBool reads a true/false query parameter; it is nil when absent or malformed.
+func optionalBool(r *http.Request, name string) *bool {
+	b, err := strconv.ParseBool(r.URL.Query().Get(name))
+	if err != nil {
+		return nil
+	}
+	return &b
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(r *http.Request) (int, int) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// adminError writes the response for an error from the admin service.
+func adminError(w http.ResponseWriter, method string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, repository.ErrSchoolNotFound), errors.Is(err, repository.ErrRatingNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrCannotSuspendSelf), errors.Is(err, service.ErrCannotImpersonate):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("[AdminHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+type adminReasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListUsers handles GET /api/admin/users?q=&role=&suspended=&limit=&offset=
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+	users, err := h.service.ListUsers(r.Context(), repository.UserListFilter{
+		Query:     r.URL.Query().Get("q"),
+		Role:      domain.Role(r.URL.Query().Get("role")),
+		Suspended: optionalBool(r, "suspended"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		adminError(w, "ListUsers", err)
+		return
+	}
+	if users == nil {
+		users = []domain.User{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// SuspendUser handles POST /api/admin/users/{id}/suspend
+func (h *AdminHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req adminReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SuspendUser(r.Context(), admin, chi.URLParam(r, "id"), req.Reason, clientIP(r)); err != nil {
+		adminError(w, "SuspendUser", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnsuspendUser handles POST /api/admin/users/{id}/unsuspend
+func (h *AdminHandler) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.UnsuspendUser(r.Context(), admin, chi.URLParam(r, "id"), clientIP(r)); err != nil {
+		adminError(w, "UnsuspendUser", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Impersonate handles POST /api/admin/users/{id}/impersonate. The response carries an
+// access token for the user that cannot be refreshed.
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req adminReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	tokens, err := h.service.Impersonate(r.Context(), admin, chi.URLParam(r, "id"), req.Reason, sessionDevice(r))
+	if err != nil {
+		adminError(w, "Impersonate", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// ListSchools handles GET /api/admin/schools?verified=
+func (h *AdminHandler) ListSchools(w http.ResponseWriter, r *http.Request) {
+	schools, err := h.service.ListSchools(r.Context(), optionalBool(r, "verified"))
+	if err != nil {
+		adminError(w, "ListSchools", err)
+		return
+	}
+	if schools == nil {
+		schools = []domain.School{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schools)
+}
+
+// VerifySchool handles POST /api/admin/schools/{id}/verify
+func (h *AdminHandler) VerifySchool(w http.ResponseWriter, r *http.Request) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Verified bool   `json:"verified"`
+		Note     string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.ReviewSchool(r.Context(), admin, chi.URLParam(r, "id"), req.Verified, req.Note, clientIP(r)); err != nil {
+		adminError(w, "VerifySchool", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRatings handles GET /api/admin/ratings?hidden=&limit=&offset=
+func (h *AdminHandler) ListRatings(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+	ratings, err := h.service.ListRatings(r.Context(), optionalBool(r, "hidden"), limit, offset)
+	if err != nil {
+		adminError(w, "ListRatings", err)
+		return
+	}
+	if ratings == nil {
+		ratings = []repository.RatingWithReviewer{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
+
+// HideRating handles POST /api/admin/ratings/{id}/hide
+func (h *AdminHandler) HideRating(w http.ResponseWriter, r *http.Request) {
+	h.setRatingHidden(w, r, true)
+}
+
+// RestoreRating handles POST /api/admin/ratings/{id}/restore
+func (h *AdminHandler) RestoreRating(w http.ResponseWriter, r *http.Request) {
+	h.setRatingHidden(w, r, false)
+}
+
+func (h *AdminHandler) setRatingHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SetRatingHidden(r.Context(), admin, chi.URLParam(r, "id"), hidden, req.Note, clientIP(r)); err != nil {
+		adminError(w, "SetRatingHidden", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteRating handles DELETE /api/admin/ratings/{id}?reason=
+func (h *AdminHandler) DeleteRating(w http.ResponseWriter, r *http.Request) {
+	admin, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.DeleteRating(r.Context(), admin, chi.URLParam(r, "id"), r.URL.Query().Get("reason"), clientIP(r)); err != nil {
+		adminError(w, "DeleteRating", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Metrics handles GET /api/admin/metrics
+func (h *AdminHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.service.Metrics(r.Context())
+	if err != nil {
+		adminError(w, "Metrics", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
+// AuditLog handles GET /api/admin/audit-log?actor_id=&action=&target_type=&target_id=&limit=&offset=
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+	q := r.URL.Query()
+	entries, err := h.service.AuditLog(r.Context(), repository.AuditFilter{
+		ActorUserID: q.Get("actor_id"),
+		Action:      q.Get("action"),
+		TargetType:  q.Get("target_type"),
+		TargetID:    q.Get("target_id"),
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		adminError(w, "AuditLog", err)
+		return
+	}
+	if entries == nil {
+		entries = []domain.AuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
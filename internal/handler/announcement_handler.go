@@ -26,10 +26,8 @@ type createAnnouncementRequest struct {
 
 // Create handles POST /api/announcements
 func (h *AnnouncementHandler) Create(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -47,8 +45,12 @@ func (h *AnnouncementHandler) Create(w http.ResponseWriter, r *http.Request) {
 		IsPinned: req.IsPinned,
 	}
 
-	err := h.service.Create(r.Context(), userID, role, a)
+	err := h.service.Create(r.Context(), actor, a)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -69,8 +71,12 @@ func (h *AnnouncementHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	courseID := r.URL.Query().Get("course_id")
 	if courseID != "" {
-		announcements, err := h.service.ListByCourse(r.Context(), courseID)
+		announcements, err := h.service.ListByCourse(r.Context(), service.Actor{UserID: userID, Role: role}, courseID)
 		if err != nil {
+			if status := accessErrorStatus(err); status != 0 {
+				http.Error(w, err.Error(), status)
+				return
+			}
 			http.Error(w, "failed to fetch announcements", http.StatusInternalServerError)
 			return
 		}
@@ -20,7 +20,11 @@ func NewAssignmentHandler(s *service.AssignmentService) *AssignmentHandler {
 
 // Create handles POST /api/courses/{id}/assignments
 func (h *AssignmentHandler) Create(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	courseID := chi.URLParam(r, "id")
 
 	var a domain.Assignment
@@ -29,9 +33,12 @@ func (h *AssignmentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.CourseID = courseID
-	a.CreatedBy = userID
 
-	if err := h.service.Create(r.Context(), &a); err != nil {
+	if err := h.service.Create(r.Context(), actor, &a); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AssignmentHandler.Create] error: %v", err)
 		http.Error(w, "failed to create assignment", http.StatusInternalServerError)
 		return
@@ -42,11 +49,20 @@ func (h *AssignmentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(a)
 }
 
-// ListByCourse handles GET /api/courses/{id}/assignments
+// ListByCourse handles GET /api/courses/{id}/assignments?section_id=
 func (h *AssignmentHandler) ListByCourse(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	courseID := chi.URLParam(r, "id")
-	assignments, err := h.service.ListByCourse(r.Context(), courseID)
+	assignments, err := h.service.ListByCourse(r.Context(), actor, courseID, r.URL.Query().Get("section_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AssignmentHandler.ListByCourse] error: %v", err)
 		http.Error(w, "failed to fetch assignments", http.StatusInternalServerError)
 		return
@@ -76,7 +92,11 @@ func (h *AssignmentHandler) MyAssignments(w http.ResponseWriter, r *http.Request
 
 // Submit handles POST /api/assignments/{id}/submit
 func (h *AssignmentHandler) Submit(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	assignmentID := chi.URLParam(r, "id")
 
 	var sub domain.Submission
@@ -85,9 +105,12 @@ func (h *AssignmentHandler) Submit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	sub.AssignmentID = assignmentID
-	sub.StudentUserID = userID
 
-	if err := h.service.Submit(r.Context(), &sub); err != nil {
+	if err := h.service.Submit(r.Context(), actor, &sub); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AssignmentHandler.Submit] error: %v", err)
 		http.Error(w, "failed to submit", http.StatusInternalServerError)
 		return
@@ -98,11 +121,20 @@ func (h *AssignmentHandler) Submit(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(sub)
 }
 
-// ListSubmissions handles GET /api/assignments/{id}/submissions
+// ListSubmissions handles GET /api/assignments/{id}/submissions?section_id=
 func (h *AssignmentHandler) ListSubmissions(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	assignmentID := chi.URLParam(r, "id")
-	submissions, err := h.service.ListSubmissions(r.Context(), assignmentID)
+	submissions, err := h.service.ListSubmissions(r.Context(), actor, assignmentID, r.URL.Query().Get("section_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AssignmentHandler.ListSubmissions] error: %v", err)
 		http.Error(w, "failed to fetch submissions", http.StatusInternalServerError)
 		return
@@ -121,6 +153,11 @@ type gradeSubmissionRequest struct {
 
 // GradeSubmission handles POST /api/submissions/{id}/grade
 func (h *AssignmentHandler) GradeSubmission(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	submissionID := chi.URLParam(r, "id")
 	var req gradeSubmissionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -128,7 +165,11 @@ func (h *AssignmentHandler) GradeSubmission(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := h.service.GradeSubmission(r.Context(), submissionID, req.Score, req.Feedback); err != nil {
+	if err := h.service.GradeSubmission(r.Context(), actor, submissionID, req.Score, req.Feedback); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AssignmentHandler.GradeSubmission] error: %v", err)
 		http.Error(w, "failed to grade submission", http.StatusInternalServerError)
 		return
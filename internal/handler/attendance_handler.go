@@ -19,17 +19,17 @@ func NewAttendanceHandler(s *service.AttendanceService) *AttendanceHandler {
 }
 
 type markAttendanceRequest struct {
-	Date    string                     `json:"date"`
-	Records []service.AttendanceRecord `json:"records"`
+	Date      string                     `json:"date"`
+	SectionID string                     `json:"section_id"` // set when marking one section's session
+	Records   []service.AttendanceRecord `json:"records"`
 }
 
 // MarkAttendance handles POST /api/courses/{id}/attendance
 func (h *AttendanceHandler) MarkAttendance(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+	actor, ok := actorFrom(r)
 	courseID := chi.URLParam(r, "id")
 
-	if !ok || !okRole || courseID == "" {
+	if !ok || courseID == "" {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -40,7 +40,11 @@ func (h *AttendanceHandler) MarkAttendance(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := h.service.MarkAttendance(r.Context(), userID, role, courseID, req.Date, req.Records); err != nil {
+	if err := h.service.MarkAttendance(r.Context(), actor, courseID, req.SectionID, req.Date, req.Records); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -49,9 +53,9 @@ func (h *AttendanceHandler) MarkAttendance(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(map[string]string{"message": "attendance recorded"})
 }
 
-// GetSessionAttendance handles GET /api/courses/{id}/attendance?date=
+// GetSessionAttendance handles GET /api/courses/{id}/attendance?date=&section_id=
 func (h *AttendanceHandler) GetSessionAttendance(w http.ResponseWriter, r *http.Request) {
-	_, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	courseID := chi.URLParam(r, "id")
 	date := r.URL.Query().Get("date")
 
@@ -60,8 +64,12 @@ func (h *AttendanceHandler) GetSessionAttendance(w http.ResponseWriter, r *http.
 		return
 	}
 
-	records, err := h.service.GetSessionAttendance(r.Context(), courseID, date)
+	records, err := h.service.GetSessionAttendance(r.Context(), actor, courseID, r.URL.Query().Get("section_id"), date)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AttendanceHandler.GetSessionAttendance] error: %v", err)
 		http.Error(w, "failed to fetch attendance", http.StatusInternalServerError)
 		return
@@ -72,9 +80,9 @@ func (h *AttendanceHandler) GetSessionAttendance(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(records)
 }
 
-// GetCourseRoster handles GET /api/courses/{id}/roster
+// GetCourseRoster handles GET /api/courses/{id}/roster?section_id=
 func (h *AttendanceHandler) GetCourseRoster(w http.ResponseWriter, r *http.Request) {
-	_, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	courseID := chi.URLParam(r, "id")
 
 	if !ok || courseID == "" {
@@ -82,8 +90,12 @@ func (h *AttendanceHandler) GetCourseRoster(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	roster, err := h.service.GetCourseRoster(r.Context(), courseID)
+	roster, err := h.service.GetCourseRoster(r.Context(), actor, courseID, r.URL.Query().Get("section_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[AttendanceHandler.GetCourseRoster] error: %v", err)
 		http.Error(w, "failed to fetch roster", http.StatusInternalServerError)
 		return
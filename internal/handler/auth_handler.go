@@ -2,30 +2,38 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
 	"github.com/schooltj/internal/service"
 )
 
 type AuthHandler struct {
-	service *service.AuthService
+	service       *service.AuthService
+	resets        *service.PasswordResetService
+	verifications *service.EmailVerificationService
+	otps          *service.PhoneOTPService
 }
 
-func NewAuthHandler(s *service.AuthService) *AuthHandler {
-	return &AuthHandler{service: s}
+func NewAuthHandler(s *service.AuthService, resets *service.PasswordResetService, verifications *service.EmailVerificationService, otps *service.PhoneOTPService) *AuthHandler {
+	return &AuthHandler{service: s, resets: resets, verifications: verifications, otps: otps}
 }
 
 type registerRequest struct {
 	Email    string      `json:"email"`
+	Phone    string      `json:"phone"`
 	Password string      `json:"password"`
 	Role     domain.Role `json:"role"`
 }
 
 type loginRequest struct {
 	Email    string `json:"email"`
+	Phone    string `json:"phone"` // alternative to email
 	Password string `json:"password"`
 }
 
@@ -45,12 +53,17 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		req.Role = domain.RoleStudent // default
 	}
 
-	user, err := h.service.Register(r.Context(), req.Email, req.Password, req.Role)
+	user, err := h.service.Register(r.Context(), req.Email, req.Phone, req.Password, req.Role, clientIP(r))
 	if err != nil {
-		if err == service.ErrEmailAlreadyExists {
+		if err == service.ErrEmailAlreadyExists || err == service.ErrPhoneAlreadyExists {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
+		if err == service.ErrEmailOrPhoneRequired || err == service.ErrInvalidPhone || err == service.ErrSignupRoleNotAllowed {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[AuthHandler.Register] error: %v", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -66,18 +79,307 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.service.Login(r.Context(), req.Email, req.Password)
+	login := req.Email
+	if login == "" {
+		login = req.Phone
+	}
+	tokens, err := h.service.Login(r.Context(), login, req.Password, sessionDevice(r))
 	if err != nil {
 		if err == service.ErrInvalidCredentials {
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, service.ErrAccountSuspended) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		log.Printf("Login error: %v", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Refresh handles POST /api/auth/refresh
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), req.RefreshToken, sessionDevice(r))
+	if err != nil {
+		log.Printf("[AuthHandler.Refresh] error: %v", err)
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, service.ErrAccountSuspended) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Logout handles POST /api/auth/logout
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	sessionID, okSession := r.Context().Value(SessionContextKey).(string)
+	if !ok || !okSession {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), userID, sessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		log.Printf("[AuthHandler.Logout] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll handles POST /api/auth/logout-all
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.LogoutAll(r.Context(), userID); err != nil {
+		log.Printf("[AuthHandler.LogoutAll] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions handles GET /api/auth/sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value(SessionContextKey).(string)
+
+	sessions, err := h.service.ListSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		log.Printf("[AuthHandler.ListSessions] error: %v", err)
+		http.Error(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []domain.Session{}
+	}
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/{id}
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[AuthHandler.RevokeSession] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword handles POST /api/auth/forgot-password
+// The response is the same whether or not the email belongs to an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.resets.RequestReset(r.Context(), req.Email); err != nil {
+		log.Printf("[AuthHandler.ForgotPassword] error: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "if an account exists for this email, a reset link has been sent"})
+}
+
+// ResetPassword handles POST /api/auth/reset-password
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.resets.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasswordTooShort), errors.Is(err, repository.ErrResetTokenInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("[AuthHandler.ResetPassword] error: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "password has been reset"})
+}
+
+// VerifyEmail handles GET /api/auth/verify-email?token= and POST /api/auth/verify-email
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+
+	if err := h.verifications.Verify(r.Context(), token); err != nil {
+		if errors.Is(err, repository.ErrVerificationTokenInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[AuthHandler.VerifyEmail] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "email address verified"})
+}
+
+// ResendVerification handles POST /api/auth/resend-verification
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.verifications.Resend(r.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("[AuthHandler.ResendVerification] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "verification email sent"})
+}
+
+// RequestOTP handles POST /api/auth/otp/request
+// The response is the same whether or not the phone belongs to an account.
+func (h *AuthHandler) RequestOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.otps.RequestCode(r.Context(), req.Phone, clientIP(r)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPhone):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, service.ErrOTPRateLimited):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		log.Printf("[AuthHandler.RequestOTP] error: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "if an account exists for this phone, a code has been sent"})
+}
+
+// VerifyOTP handles POST /api/auth/otp/verify
+func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.LoginWithCode(r.Context(), req.Phone, req.Code, sessionDevice(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPhone):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrOTPInvalid), errors.Is(err, service.ErrInvalidCredentials):
+			http.Error(w, "code is invalid or has expired", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrAccountSuspended):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("[AuthHandler.VerifyOTP] error: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// VerifyTwoFactor handles POST /api/auth/2fa/verify. It answers 401 for a wrong code or a
+// used-up challenge and 429 once the account locks.
+func (h *AuthHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TwoFactorToken string `json:"two_factor_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.VerifyTwoFactor(r.Context(), req.TwoFactorToken, req.Code, sessionDevice(r))
+	if err != nil {
+		var locked *service.AccountLockedError
+		switch {
+		case errors.As(err, &locked):
+			writeTooManyRequests(w, time.Until(locked.Until), locked.Error())
+		case errors.Is(err, service.ErrInvalidTwoFactorToken), errors.Is(err, service.ErrInvalidTwoFactorCode):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, service.ErrAccountSuspended):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("[AuthHandler.VerifyTwoFactor] error: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func sessionDevice(r *http.Request) service.SessionDevice {
+	return service.SessionDevice{UserAgent: r.UserAgent(), IP: clientIP(r)}
 }
 
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/schooltj/internal/service"
+)
+
+func TestRegisterRejectsPrivilegedRoles(t *testing.T) {
+	// The role check comes before any lookup, so the service needs no repositories here.
+	auth := service.NewAuthService(nil, nil, nil, nil, nil, nil, nil, nil, nil, service.LoginLockout{}, "test-secret", nil)
+	h := NewAuthHandler(auth, nil, nil, nil)
+
+	for _, role := range []string{"admin", "superuser"} {
+		t.Run(role, func(t *testing.T) {
+			body := `{"email":"mallory@example.com","password":"hunter22","role":"` + role + `"}`
+			rec := httptest.NewRecorder()
+			h.Register(rec, httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("register as %s: status %d, want %d", role, rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCompleteOIDCLoginRequiresStateCookie(t *testing.T) {
+	// The cookie is checked before the state is looked up, so the service needs no repositories here.
+	auth := service.NewAuthService(nil, nil, nil, nil, nil, nil, nil, nil, nil, service.LoginLockout{}, "test-secret", nil)
+	h := NewAuthHandler(auth, nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"another browser's state", &http.Cookie{Name: oidcStateCookie, Value: "state-2"}},
+		{"empty cookie", &http.Cookie{Name: oidcStateCookie, Value: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/google/callback", strings.NewReader(`{"code":"code-1","state":"state-1"}`))
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			h.CompleteOIDCLogin(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
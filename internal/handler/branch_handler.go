@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type BranchHandler struct {
+	service *service.BranchService
+}
+
+func NewBranchHandler(s *service.BranchService) *BranchHandler {
+	return &BranchHandler{service: s}
+}
+
+// branchError writes the response for an error from managing branches and rooms.
+func branchError(w http.ResponseWriter, method string, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrBranchNameRequired), errors.Is(err, service.ErrRoomNameRequired),
+		errors.Is(err, service.ErrInvalidRoomCapacity), errors.Is(err, service.ErrIndependentCourseBranch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrTeacherNotInSchool):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrRoomNameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[BranchHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ListBranches handles GET /api/schools/{id}/branches
+func (h *BranchHandler) ListBranches(w http.ResponseWriter, r *http.Request) {
+	branches, err := h.service.ListBranches(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		branchError(w, "ListBranches", err)
+		return
+	}
+	if branches == nil {
+		branches = []domain.SchoolBranch{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branches)
+}
+
+// CreateBranch handles POST /api/schools/{id}/branches
+func (h *BranchHandler) CreateBranch(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req service.BranchInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	branch, err := h.service.CreateBranch(r.Context(), actor, chi.URLParam(r, "id"), req)
+	if err != nil {
+		branchError(w, "CreateBranch", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(branch)
+}
+
+// UpdateBranch handles PUT /api/branches/{id}
+func (h *BranchHandler) UpdateBranch(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req service.BranchInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	branch, err := h.service.UpdateBranch(r.Context(), actor, chi.URLParam(r, "id"), req)
+	if err != nil {
+		branchError(w, "UpdateBranch", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branch)
+}
+
+// DeleteBranch handles DELETE /api/branches/{id}
+func (h *BranchHandler) DeleteBranch(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.DeleteBranch(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		branchError(w, "DeleteBranch", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRooms handles GET /api/branches/{id}/rooms
+func (h *BranchHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rooms, err := h.service.ListRooms(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		branchError(w, "ListRooms", err)
+		return
+	}
+	if rooms == nil {
+		rooms = []domain.BranchRoom{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rooms)
+}
+
+// CreateRoom handles POST /api/branches/{id}/rooms
+func (h *BranchHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Name     string `json:"name"`
+		Capacity *int   `json:"capacity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	room, err := h.service.CreateRoom(r.Context(), actor, chi.URLParam(r, "id"), req.Name, req.Capacity)
+	if err != nil {
+		branchError(w, "CreateRoom", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(room)
+}
+
+// DeleteRoom handles DELETE /api/rooms/{id}
+func (h *BranchHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.DeleteRoom(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		branchError(w, "DeleteRoom", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetTeacherBranch handles PUT /api/schools/{id}/teachers/{teacherId}/branch with
+// {"branch_id": null} to take the teacher off any branch.
+func (h *BranchHandler) SetTeacherBranch(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		BranchID *string `json:"branch_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SetTeacherBranch(r.Context(), actor, chi.URLParam(r, "id"), chi.URLParam(r, "teacherId"), req.BranchID); err != nil {
+		branchError(w, "SetTeacherBranch", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCourseBranch handles PUT /api/courses/{id}/branch with {"branch_id": null} to take
+// the course off any branch.
+func (h *BranchHandler) SetCourseBranch(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		BranchID *string `json:"branch_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	course, err := h.service.SetCourseBranch(r.Context(), actor, chi.URLParam(r, "id"), req.BranchID)
+	if err != nil {
+		branchError(w, "SetCourseBranch", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(course)
+}
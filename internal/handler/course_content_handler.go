@@ -27,7 +27,7 @@ type addTopicRequest struct {
 }
 
 func (h *CourseContentHandler) AddTopic(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -47,7 +47,7 @@ func (h *CourseContentHandler) AddTopic(w http.ResponseWriter, r *http.Request)
 		SortOrder:   req.SortOrder,
 	}
 
-	if err := h.service.AddTopic(r.Context(), userID, topic); err != nil {
+	if err := h.service.AddTopic(r.Context(), actor, topic); err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -57,15 +57,14 @@ func (h *CourseContentHandler) AddTopic(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *CourseContentHandler) ListTopics(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	courseID := chi.URLParam(r, "id")
 
-	topics, err := h.service.ListTopics(r.Context(), userID, role, courseID)
+	topics, err := h.service.ListTopics(r.Context(), actor, courseID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -85,7 +84,7 @@ type updateTopicRequest struct {
 }
 
 func (h *CourseContentHandler) UpdateTopic(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -109,7 +108,7 @@ func (h *CourseContentHandler) UpdateTopic(w http.ResponseWriter, r *http.Reques
 		topic.Visible = *req.Visible
 	}
 
-	if err := h.service.UpdateTopic(r.Context(), userID, topic); err != nil {
+	if err := h.service.UpdateTopic(r.Context(), actor, topic); err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -119,14 +118,14 @@ func (h *CourseContentHandler) UpdateTopic(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *CourseContentHandler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	topicID := chi.URLParam(r, "topicId")
 
-	if err := h.service.DeleteTopic(r.Context(), userID, topicID); err != nil {
+	if err := h.service.DeleteTopic(r.Context(), actor, topicID); err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -138,7 +137,7 @@ func (h *CourseContentHandler) DeleteTopic(w http.ResponseWriter, r *http.Reques
 // ── Course Materials ──
 
 func (h *CourseContentHandler) UploadMaterial(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -158,7 +157,7 @@ func (h *CourseContentHandler) UploadMaterial(w http.ResponseWriter, r *http.Req
 	}
 	defer file.Close()
 
-	material, err := h.service.UploadMaterial(r.Context(), userID, courseID, nil, header, file)
+	material, err := h.service.UploadMaterial(r.Context(), actor, courseID, nil, header, file)
 	if err != nil {
 		log.Printf("[CourseContentHandler.UploadMaterial] error: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -170,15 +169,14 @@ func (h *CourseContentHandler) UploadMaterial(w http.ResponseWriter, r *http.Req
 }
 
 func (h *CourseContentHandler) ListMaterials(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	courseID := chi.URLParam(r, "id")
 
-	materials, err := h.service.ListMaterials(r.Context(), userID, role, courseID)
+	materials, err := h.service.ListMaterials(r.Context(), actor, courseID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -188,15 +186,14 @@ func (h *CourseContentHandler) ListMaterials(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *CourseContentHandler) DownloadMaterial(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	materialID := chi.URLParam(r, "id")
 
-	m, err := h.service.GetMaterial(r.Context(), userID, role, materialID)
+	m, err := h.service.GetMaterial(r.Context(), actor, materialID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -208,14 +205,14 @@ func (h *CourseContentHandler) DownloadMaterial(w http.ResponseWriter, r *http.R
 }
 
 func (h *CourseContentHandler) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	materialID := chi.URLParam(r, "id")
 
-	if err := h.service.DeleteMaterial(r.Context(), userID, materialID); err != nil {
+	if err := h.service.DeleteMaterial(r.Context(), actor, materialID); err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -227,7 +224,7 @@ func (h *CourseContentHandler) DeleteMaterial(w http.ResponseWriter, r *http.Req
 // ── Topic Materials ──
 
 func (h *CourseContentHandler) UploadTopicMaterial(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -248,7 +245,7 @@ func (h *CourseContentHandler) UploadTopicMaterial(w http.ResponseWriter, r *htt
 	}
 	defer file.Close()
 
-	material, err := h.service.UploadMaterial(r.Context(), userID, courseID, &topicID, header, file)
+	material, err := h.service.UploadMaterial(r.Context(), actor, courseID, &topicID, header, file)
 	if err != nil {
 		log.Printf("[CourseContentHandler.UploadTopicMaterial] error: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -260,15 +257,14 @@ func (h *CourseContentHandler) UploadTopicMaterial(w http.ResponseWriter, r *htt
 }
 
 func (h *CourseContentHandler) ListTopicMaterials(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	topicID := chi.URLParam(r, "topicId")
 
-	materials, err := h.service.ListTopicMaterials(r.Context(), userID, role, topicID)
+	materials, err := h.service.ListTopicMaterials(r.Context(), actor, topicID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 
@@ -20,15 +22,19 @@ func NewCourseHandler(s *service.CourseService) *CourseHandler {
 }
 
 type createCourseRequest struct {
-	Title       string           `json:"title"`
-	Description string           `json:"description"`
-	Schedule    *domain.Schedule `json:"schedule"`
-	Price       float64          `json:"price"`
-	Language    string           `json:"language"`
-	CategoryID  *string          `json:"category_id"`
-	Difficulty  string           `json:"difficulty"`
-	Tags        []string         `json:"tags"`
-	TeacherID   *string          `json:"teacher_id,omitempty"` // Required for SchoolAdmin
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	Schedule     *domain.Schedule `json:"schedule"`
+	Price        float64          `json:"price"`
+	Currency     string           `json:"currency"`      // TJS (default), USD, RUB, EUR
+	BillingCycle string           `json:"billing_cycle"` // one_time (default), monthly
+	Language     string           `json:"language"`
+	CategoryID   *string          `json:"category_id"`
+	Difficulty   string           `json:"difficulty"`
+	Tags         []string         `json:"tags"`
+	TeacherID    *string          `json:"teacher_id,omitempty"` // Required for SchoolAdmin
+	BranchID     *string          `json:"branch_id,omitempty"`  // School courses only; a branch manager's go to their branch
+	MaxStudents  *int             `json:"max_students"`         // Seat limit; omitted or null for none
 }
 
 func (h *CourseHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -46,8 +52,12 @@ func (h *CourseHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	course, err := h.service.CreateCourse(r.Context(), userID, role, req.Title, req.Description, req.Schedule, req.Price, req.Language, req.CategoryID, req.Difficulty, req.Tags, req.TeacherID)
+	course, err := h.service.CreateCourse(r.Context(), userID, role, req.Title, req.Description, req.Schedule, req.Price, req.Currency, req.BillingCycle, req.Language, req.CategoryID, req.Difficulty, req.Tags, req.TeacherID, req.BranchID, req.MaxStudents)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -65,7 +75,7 @@ func (h *CourseHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	courses, err := h.service.ListCourses(r.Context(), userID, role)
+	courses, err := h.service.ListCourses(r.Context(), userID, role, r.URL.Query().Get("branch_id"))
 	if err != nil {
 		log.Printf("[CourseHandler.List] error: %v", err)
 		http.Error(w, "failed to fetch courses", http.StatusInternalServerError)
@@ -80,7 +90,8 @@ func (h *CourseHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 type inviteStudentRequest struct {
-	Email string `json:"email"`
+	Email     string  `json:"email"`
+	SectionID *string `json:"section_id"`
 }
 
 func (h *CourseHandler) Invite(w http.ResponseWriter, r *http.Request) {
@@ -99,8 +110,12 @@ func (h *CourseHandler) Invite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.service.InviteStudent(r.Context(), userID, role, courseID, req.Email)
+	err := h.service.InviteStudent(r.Context(), userID, role, courseID, req.Email, req.SectionID)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -128,14 +143,18 @@ func (h *CourseHandler) RespondInvitation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.service.RespondToInvitation(r.Context(), userID, enrollmentID, req.Accept)
+	status, err := h.service.RespondToInvitation(r.Context(), userID, enrollmentID, req.Accept)
 	if err != nil {
+		if errors.Is(err, service.ErrWaitlistOfferExpired) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "response recorded"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "response recorded", "status": status})
 }
 
 func (h *CourseHandler) RequestAccess(w http.ResponseWriter, r *http.Request) {
@@ -153,8 +172,21 @@ func (h *CourseHandler) RequestAccess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.service.RequestEnrollment(r.Context(), userID, courseID)
+	// The body is optional; it names the section the student wants to join.
+	var req struct {
+		SectionID *string `json:"section_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.RequestEnrollment(r.Context(), userID, courseID, req.SectionID)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -192,6 +224,10 @@ func (h *CourseHandler) CourseEnrollments(w http.ResponseWriter, r *http.Request
 
 	enrollments, err := h.service.GetCourseEnrollments(r.Context(), userID, role, courseID)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -219,14 +255,18 @@ func (h *CourseHandler) ApproveEnrollment(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.service.ApproveOrRejectEnrollment(r.Context(), userID, role, enrollmentID, req.Approve)
+	status, err := h.service.ApproveOrRejectEnrollment(r.Context(), userID, role, enrollmentID, req.Approve)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "enrollment updated"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "enrollment updated", "status": status})
 }
 
 type updateCoverImageRequest struct {
@@ -234,6 +274,11 @@ type updateCoverImageRequest struct {
 }
 
 func (h *CourseHandler) UpdateCoverImage(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	courseID := chi.URLParam(r, "id")
 	if courseID == "" {
 		http.Error(w, "invalid course", http.StatusBadRequest)
@@ -251,7 +296,11 @@ func (h *CourseHandler) UpdateCoverImage(w http.ResponseWriter, r *http.Request)
 		url = &req.CoverImageURL
 	}
 
-	if err := h.service.UpdateCoverImage(r.Context(), courseID, url); err != nil {
+	if err := h.service.UpdateCoverImage(r.Context(), actor, courseID, url); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("UpdateCoverImage error: %v", err)
 		http.Error(w, "failed to update cover image", http.StatusInternalServerError)
 		return
@@ -306,14 +355,17 @@ func (h *CourseHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 }
 
 type updateCourseRequest struct {
-	Title       string           `json:"title"`
-	Description string           `json:"description"`
-	Schedule    *domain.Schedule `json:"schedule"`
-	Price       float64          `json:"price"`
-	Language    string           `json:"language"`
-	CategoryID  *string          `json:"category_id"`
-	Difficulty  string           `json:"difficulty"`
-	Tags        []string         `json:"tags"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	Schedule     *domain.Schedule `json:"schedule"`
+	Price        float64          `json:"price"`
+	Currency     string           `json:"currency"`      // TJS (default), USD, RUB, EUR
+	BillingCycle string           `json:"billing_cycle"` // one_time (default), monthly
+	Language     string           `json:"language"`
+	CategoryID   *string          `json:"category_id"`
+	Difficulty   string           `json:"difficulty"`
+	Tags         []string         `json:"tags"`
+	MaxStudents  *int             `json:"max_students"` // Seat limit; null removes it
 }
 
 func (h *CourseHandler) Update(w http.ResponseWriter, r *http.Request) {
@@ -332,8 +384,12 @@ func (h *CourseHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	course, err := h.service.UpdateCourse(r.Context(), userID, role, courseID, req.Title, req.Description, req.Schedule, req.Price, req.Language, req.CategoryID, req.Difficulty, req.Tags)
+	course, err := h.service.UpdateCourse(r.Context(), userID, role, courseID, req.Title, req.Description, req.Schedule, req.Price, req.Currency, req.BillingCycle, req.Language, req.CategoryID, req.Difficulty, req.Tags, req.MaxStudents)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -353,6 +409,10 @@ func (h *CourseHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.DeleteCourse(r.Context(), userID, role, courseID); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
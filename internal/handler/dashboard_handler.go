@@ -7,28 +7,147 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/service"
 )
 
+// Revenue counts money actually received (settled payments) minus what was refunded.
+// Pending and failed gateway payments never brought money in.
+const settledPaymentStatuses = "('success', 'partially_refunded', 'refunded')"
+
+// UnconvertedCurrenciesHeader lists, on revenue reports returned as plain lists, the
+// payment currencies left out because the reporting currency has no exchange rate yet.
+const UnconvertedCurrenciesHeader = "Unconverted-Currencies"
+
+// reportingCurrency is the currency a scope's revenue figures are converted to: the school's
+// reporting currency for school staff, the teacher's own currency, and the base currency
+// platform-wide.
+func (h *DashboardHandler) reportingCurrency(scope *service.ReportScope) string {
+	var currency string
+	switch {
+	case scope.SchoolID != "":
+		h.db.QueryRow("SELECT reporting_currency FROM schools WHERE id = ?", scope.SchoolID).Scan(&currency)
+	case scope.TeacherID != "":
+		h.db.QueryRow("SELECT currency FROM teacher_profiles WHERE user_id = ?", scope.TeacherID).Scan(&currency)
+	}
+	currency = strings.ToUpper(currency)
+	if !domain.SupportedCurrencies[currency] {
+		return domain.BaseCurrency
+	}
+	return currency
+}
+
+// unconvertedCurrencies lists the currencies of settled payments in scope that cannot be
+// converted to currency, which has no exchange rate yet. Revenue figures leave them out.
+func (h *DashboardHandler) unconvertedCurrencies(f *reportFilter, currency string) []string {
+	if currency == domain.BaseCurrency {
+		return nil
+	}
+	query := "SELECT DISTINCT p.currency FROM payments p"
+	where := " WHERE p.status IN " + settledPaymentStatuses + " AND " + inCurrency("p.amount", "p", currency) + " IS NULL"
+	if !f.Platform {
+		query += " JOIN courses c ON p.course_id = c.id"
+		where += " AND " + f.cond
+	}
+	rows, err := h.db.Query(query+where+" ORDER BY p.currency", f.args...)
+	if err != nil {
+		log.Printf("[DashboardHandler] unconverted currencies: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	var currencies []string
+	for rows.Next() {
+		var c string
+		if rows.Scan(&c) == nil {
+			currencies = append(currencies, c)
+		}
+	}
+	return currencies
+}
+
+// flagUnconverted sets UnconvertedCurrenciesHeader when revenue left some currencies out.
+func (h *DashboardHandler) flagUnconverted(w http.ResponseWriter, f *reportFilter, currency string) {
+	if currencies := h.unconvertedCurrencies(f, currency); len(currencies) > 0 {
+		w.Header().Set(UnconvertedCurrenciesHeader, strings.Join(currencies, ","))
+	}
+}
+
+// reportFilter is what a dashboard request covers.
+type reportFilter struct {
+	*service.ReportScope
+	cond string        // the condition on courses aliased c; empty platform-wide
+	args []interface{} // cond's arguments
+}
+
+// reportScope asks the policy what the actor's dashboards cover. Staff of a whole school
+// may narrow it to one branch with the branch_id query parameter.
+func (h *DashboardHandler) reportScope(r *http.Request, actor service.Actor) (*reportFilter, error) {
+	scope, err := h.policy.ReportScope(r.Context(), actor)
+	if err != nil {
+		return nil, err
+	}
+	f := &reportFilter{ReportScope: scope}
+	switch {
+	case scope.Platform:
+	case scope.SchoolID != "":
+		branchID := scope.BranchID
+		if branchID == "" {
+			branchID = r.URL.Query().Get("branch_id")
+		}
+		f.cond, f.args = "c.school_id = ?", []interface{}{scope.SchoolID}
+		if branchID != "" {
+			f.cond, f.args = "c.school_id = ? AND c.branch_id = ?", []interface{}{scope.SchoolID, branchID}
+		}
+	case scope.TeacherID != "":
+		// The teacher's own courses and the courses where they teach a section.
+		f.cond = "(c.teacher_id = ? OR EXISTS (SELECT 1 FROM course_sections cs WHERE cs.course_id = c.id AND cs.teacher_id = ?))"
+		f.args = []interface{}{scope.TeacherID, scope.TeacherID}
+	default:
+		f.cond = "1 = 0"
+	}
+	return f, nil
+}
+
+// inCurrency converts expr, an amount in the currency of the payment aliased p, to currency
+// using the rates in force when the payment was made: the payment's own rate snapshot and
+// the target currency's rate at paid_at (its earliest rate if none was entered yet). It is
+// NULL for a payment in another currency when currency has no rate at all, so sums leave
+// the payment out (see unconvertedCurrencies) rather than guess a rate.
+// currency is inlined, so it must come from reportingCurrency.
+func inCurrency(expr, p, currency string) string {
+	if currency == domain.BaseCurrency {
+		return fmt.Sprintf("(%s) * %s.exchange_rate", expr, p)
+	}
+	return fmt.Sprintf(`CASE WHEN %[2]s.currency = '%[3]s' THEN (%[1]s) ELSE (%[1]s) * %[2]s.exchange_rate / COALESCE(
+		(SELECT er.rate FROM exchange_rates er WHERE er.currency = '%[3]s' AND er.effective_at <= %[2]s.paid_at ORDER BY er.effective_at DESC LIMIT 1),
+		(SELECT er.rate FROM exchange_rates er WHERE er.currency = '%[3]s' ORDER BY er.effective_at ASC LIMIT 1)) END`, expr, p, currency)
+}
+
 type DashboardHandler struct {
-	db *sql.DB
+	db     *sql.DB
+	policy *service.Policy
 }
 
-func NewDashboardHandler(db *sql.DB) *DashboardHandler {
-	return &DashboardHandler{db: db}
+func NewDashboardHandler(db *sql.DB, policy *service.Policy) *DashboardHandler {
+	return &DashboardHandler{db: db, policy: policy}
 }
 
 type DashboardStats struct {
-	TotalStudents    int     `json:"total_students"`
-	TotalCourses     int     `json:"total_courses"`
-	AvgGrade         float64 `json:"avg_grade"`
-	TotalRevenue     float64 `json:"total_revenue"`
-	ActiveEnrolments int     `json:"active_enrolments"`
-	AvgAttendance    float64 `json:"avg_attendance"`
-	RecentPayments   int     `json:"recent_payments"`
-	PendingRequests  int     `json:"pending_requests"`
+	TotalStudents int     `json:"total_students"`
+	TotalCourses  int     `json:"total_courses"`
+	AvgGrade      float64 `json:"avg_grade"`
+	TotalRevenue  float64 `json:"total_revenue"`
+	Currency      string  `json:"currency"` // of TotalRevenue
+	// UnconvertedCurrencies are payment currencies TotalRevenue leaves out because
+	// Currency has no exchange rate yet.
+	UnconvertedCurrencies []string `json:"unconverted_currencies,omitempty"`
+	ActiveEnrolments      int      `json:"active_enrolments"`
+	AvgAttendance         float64  `json:"avg_attendance"`
+	RecentPayments        int      `json:"recent_payments"`
+	PendingRequests       int      `json:"pending_requests"`
 }
 
 type RecentActivity struct {
@@ -39,57 +158,27 @@ type RecentActivity struct {
 
 // GetStats handles GET /api/dashboard/stats
 func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetStats] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	var stats DashboardStats
+	stats.Currency = h.reportingCurrency(f.ReportScope)
+	revenue := inCurrency("p.amount - p.refunded_amount", "p", stats.Currency)
 
-	switch role {
-	case domain.RoleSchoolAdmin:
-		// Scope to the admin's school
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
-		if schoolID != "" {
-			h.db.QueryRow("SELECT COUNT(DISTINCT e.student_user_id) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.school_id = ? AND e.status = 'active'", schoolID).Scan(&stats.TotalStudents)
-			h.db.QueryRow("SELECT COUNT(*) FROM courses WHERE school_id = ?", schoolID).Scan(&stats.TotalCourses)
-			h.db.QueryRow("SELECT COALESCE(AVG(g.score), 0) FROM grades g JOIN courses c ON g.course_id = c.id WHERE c.school_id = ?", schoolID).Scan(&stats.AvgGrade)
-			h.db.QueryRow("SELECT COALESCE(SUM(p.amount), 0) FROM payments p JOIN courses c ON p.course_id = c.id WHERE c.school_id = ?", schoolID).Scan(&stats.TotalRevenue)
-			h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.school_id = ? AND e.status = 'active'", schoolID).Scan(&stats.ActiveEnrolments)
-			h.db.QueryRow(`
-				SELECT COALESCE(
-					ROUND(SUM(CASE WHEN a.status = 'present' THEN 1 ELSE 0 END) * 100.0 / NULLIF(COUNT(*), 0), 1),
-				0) FROM attendance a JOIN enrollments e ON a.enrollment_id = e.id JOIN courses c ON e.course_id = c.id WHERE c.school_id = ?
-			`, schoolID).Scan(&stats.AvgAttendance)
-			h.db.QueryRow("SELECT COUNT(*) FROM payments p JOIN courses c ON p.course_id = c.id WHERE c.school_id = ? AND p.paid_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)", schoolID).Scan(&stats.RecentPayments)
-			h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.school_id = ? AND e.status = 'pending'", schoolID).Scan(&stats.PendingRequests)
-		}
-
-	case domain.RoleTeacher:
-		// Scope to the teacher's own courses
-		h.db.QueryRow("SELECT COUNT(DISTINCT e.student_user_id) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.teacher_id = ? AND e.status = 'active'", userID).Scan(&stats.TotalStudents)
-		h.db.QueryRow("SELECT COUNT(*) FROM courses WHERE teacher_id = ?", userID).Scan(&stats.TotalCourses)
-		h.db.QueryRow("SELECT COALESCE(AVG(g.score), 0) FROM grades g JOIN courses c ON g.course_id = c.id WHERE c.teacher_id = ?", userID).Scan(&stats.AvgGrade)
-		h.db.QueryRow("SELECT COALESCE(SUM(p.amount), 0) FROM payments p JOIN courses c ON p.course_id = c.id WHERE c.teacher_id = ?", userID).Scan(&stats.TotalRevenue)
-		h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.teacher_id = ? AND e.status = 'active'", userID).Scan(&stats.ActiveEnrolments)
-		h.db.QueryRow(`
-			SELECT COALESCE(
-				ROUND(SUM(CASE WHEN a.status = 'present' THEN 1 ELSE 0 END) * 100.0 / NULLIF(COUNT(*), 0), 1),
-			0) FROM attendance a JOIN enrollments e ON a.enrollment_id = e.id JOIN courses c ON e.course_id = c.id WHERE c.teacher_id = ?
-		`, userID).Scan(&stats.AvgAttendance)
-		h.db.QueryRow("SELECT COUNT(*) FROM payments p JOIN courses c ON p.course_id = c.id WHERE c.teacher_id = ? AND p.paid_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)", userID).Scan(&stats.RecentPayments)
-		h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE c.teacher_id = ? AND e.status = 'pending'", userID).Scan(&stats.PendingRequests)
-
-	case domain.RoleAdmin:
-		// Global Scope
+	if f.Platform {
 		h.db.QueryRow("SELECT COUNT(DISTINCT student_user_id) FROM enrollments WHERE status = 'active'").Scan(&stats.TotalStudents)
 		h.db.QueryRow("SELECT COUNT(*) FROM courses").Scan(&stats.TotalCourses)
 		h.db.QueryRow("SELECT COALESCE(AVG(score), 0) FROM grades").Scan(&stats.AvgGrade)
-		h.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM payments").Scan(&stats.TotalRevenue)
+		h.db.QueryRow("SELECT COALESCE(SUM(" + revenue + "), 0) FROM payments p WHERE p.status IN " + settledPaymentStatuses).Scan(&stats.TotalRevenue)
 		h.db.QueryRow("SELECT COUNT(*) FROM enrollments WHERE status = 'active'").Scan(&stats.ActiveEnrolments)
 		h.db.QueryRow(`
 			SELECT COALESCE(
@@ -98,6 +187,26 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		`).Scan(&stats.AvgAttendance)
 		h.db.QueryRow("SELECT COUNT(*) FROM payments WHERE paid_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)").Scan(&stats.RecentPayments)
 		h.db.QueryRow("SELECT COUNT(*) FROM enrollments WHERE status = 'pending'").Scan(&stats.PendingRequests)
+	} else {
+		// Scope to the staff member's school or branch, or the teacher's own courses
+		scope, args := f.cond, f.args
+		h.db.QueryRow("SELECT COUNT(DISTINCT e.student_user_id) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE "+scope+" AND e.status = 'active'", args...).Scan(&stats.TotalStudents)
+		h.db.QueryRow("SELECT COUNT(*) FROM courses c WHERE "+scope, args...).Scan(&stats.TotalCourses)
+		h.db.QueryRow("SELECT COALESCE(AVG(g.score), 0) FROM grades g JOIN courses c ON g.course_id = c.id WHERE "+scope, args...).Scan(&stats.AvgGrade)
+		if f.Revenue {
+			h.db.QueryRow("SELECT COALESCE(SUM("+revenue+"), 0) FROM payments p JOIN courses c ON p.course_id = c.id WHERE "+scope+" AND p.status IN "+settledPaymentStatuses, args...).Scan(&stats.TotalRevenue)
+		}
+		h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE "+scope+" AND e.status = 'active'", args...).Scan(&stats.ActiveEnrolments)
+		h.db.QueryRow(`
+			SELECT COALESCE(
+				ROUND(SUM(CASE WHEN a.status = 'present' THEN 1 ELSE 0 END) * 100.0 / NULLIF(COUNT(*), 0), 1),
+			0) FROM attendance a JOIN enrollments e ON a.enrollment_id = e.id JOIN courses c ON e.course_id = c.id WHERE `+scope,
+			args...).Scan(&stats.AvgAttendance)
+		h.db.QueryRow("SELECT COUNT(*) FROM payments p JOIN courses c ON p.course_id = c.id WHERE "+scope+" AND p.paid_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)", args...).Scan(&stats.RecentPayments)
+		h.db.QueryRow("SELECT COUNT(*) FROM enrollments e JOIN courses c ON e.course_id = c.id WHERE "+scope+" AND e.status = 'pending'", args...).Scan(&stats.PendingRequests)
+	}
+	if f.Revenue {
+		stats.UnconvertedCurrencies = h.unconvertedCurrencies(f, stats.Currency)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -106,41 +215,29 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 
 // GetActivity handles GET /api/dashboard/activity
 func (h *DashboardHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetActivity] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	var activities []RecentActivity
 
-	// Build scope filter based on role
-	var courseFilter string
-	var args []interface{}
-
-	switch role {
-	case domain.RoleTeacher:
-		courseFilter = "c.teacher_id = ?"
-		args = append(args, userID)
-	case domain.RoleSchoolAdmin:
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
-		if schoolID == "" {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode([]RecentActivity{})
-			return
-		}
-		courseFilter = "c.school_id = ?"
-		args = append(args, schoolID)
-	case domain.RoleAdmin:
-		courseFilter = "1=1"
-	default:
+	if f.Empty() {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]RecentActivity{})
 		return
 	}
+	courseFilter, args := f.cond, f.args
+	if f.Platform {
+		courseFilter = "1=1"
+	}
 
 	// Recent enrollments scoped to user's courses (or global)
 	rows, err := h.db.Query(`
@@ -236,28 +333,26 @@ type CourseBreakdownItem struct {
 
 // GetEnrollmentTrend handles GET /api/analytics/enrollment-trend
 func (h *DashboardHandler) GetEnrollmentTrend(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetEnrollmentTrend] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	joinClause := ""
 	whereClause := "WHERE e.enrolled_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH)"
 	var args []interface{}
 
-	if role == domain.RoleSchoolAdmin {
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
+	if !f.Platform {
 		joinClause = "JOIN courses c ON e.course_id = c.id"
-		whereClause += " AND c.school_id = ?"
-		args = append(args, schoolID)
-	} else if role == domain.RoleTeacher {
-		joinClause = "JOIN courses c ON e.course_id = c.id"
-		whereClause += " AND c.teacher_id = ?"
-		args = append(args, userID)
+		whereClause += " AND " + f.cond
+		args = append(args, f.args...)
 	}
 
 	query := fmt.Sprintf(`
@@ -282,38 +377,52 @@ func (h *DashboardHandler) GetEnrollmentTrend(w http.ResponseWriter, r *http.Req
 
 // GetRevenueTrend handles GET /api/analytics/revenue-trend
 func (h *DashboardHandler) GetRevenueTrend(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetRevenueTrend] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	joinClause := ""
-	whereClause := "WHERE p.paid_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH)"
-	var args []interface{}
+	scopeClause := ""
+	var scopeArgs []interface{}
 
-	if role == domain.RoleSchoolAdmin {
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
-		joinClause = "JOIN courses c ON p.course_id = c.id"
-		whereClause += " AND c.school_id = ?"
-		args = append(args, schoolID)
-	} else if role == domain.RoleTeacher {
+	if !f.Revenue {
+		http.Error(w, service.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	if !f.Platform {
 		joinClause = "JOIN courses c ON p.course_id = c.id"
-		whereClause += " AND c.teacher_id = ?"
-		args = append(args, userID)
+		scopeClause = " AND " + f.cond
+		scopeArgs = append(scopeArgs, f.args...)
 	}
 
+	// Payments count in the month they were received, refunds in the month they were issued.
+	// Both are converted to the reporting currency at the rate of the original payment.
+	currency := h.reportingCurrency(f.ReportScope)
 	query := fmt.Sprintf(`
-		SELECT DATE_FORMAT(p.paid_at, '%%Y-%%m') AS month, COALESCE(SUM(p.amount), 0) AS total
-		FROM payments p
-		%s
-		%s
+		SELECT month, COALESCE(SUM(total), 0) AS total FROM (
+			SELECT DATE_FORMAT(p.paid_at, '%%Y-%%m') AS month, %[4]s AS total
+			FROM payments p
+			%[1]s
+			WHERE p.paid_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) AND p.status IN %[3]s %[2]s
+			UNION ALL
+			SELECT DATE_FORMAT(rf.created_at, '%%Y-%%m') AS month, %[5]s AS total
+			FROM refunds rf
+			JOIN payments p ON rf.payment_id = p.id
+			%[1]s
+			WHERE rf.created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) AND rf.status = 'success' %[2]s
+		) t
 		GROUP BY month
 		ORDER BY month ASC
-	`, joinClause, whereClause)
+	`, joinClause, scopeClause, settledPaymentStatuses, inCurrency("p.amount", "p", currency), inCurrency("-rf.amount", "p", currency))
+	args := append(append([]interface{}{}, scopeArgs...), scopeArgs...)
 
 	rows, err := h.db.Query(query, args...)
 	if err != nil {
@@ -322,34 +431,33 @@ func (h *DashboardHandler) GetRevenueTrend(w http.ResponseWriter, r *http.Reques
 	}
 	defer rows.Close()
 	result := fillMonthlyGaps(rows, 12)
+	h.flagUnconverted(w, f, currency)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
 // GetAttendanceTrend handles GET /api/analytics/attendance-trend
 func (h *DashboardHandler) GetAttendanceTrend(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetAttendanceTrend] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	joinClause := ""
 	whereClause := "WHERE a.date >= DATE_SUB(NOW(), INTERVAL 12 MONTH)"
 	var args []interface{}
 
-	if role == domain.RoleSchoolAdmin {
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
+	if !f.Platform {
 		joinClause = "JOIN courses c ON a.course_id = c.id"
-		whereClause += " AND c.school_id = ?"
-		args = append(args, schoolID)
-	} else if role == domain.RoleTeacher {
-		joinClause = "JOIN courses c ON a.course_id = c.id"
-		whereClause += " AND c.teacher_id = ?"
-		args = append(args, userID)
+		whereClause += " AND " + f.cond
+		args = append(args, f.args...)
 	}
 
 	query := fmt.Sprintf(`
@@ -375,34 +483,38 @@ func (h *DashboardHandler) GetAttendanceTrend(w http.ResponseWriter, r *http.Req
 
 // GetCourseBreakdown handles GET /api/analytics/course-breakdown
 func (h *DashboardHandler) GetCourseBreakdown(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
-
-	if !ok || !okRole {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetCourseBreakdown] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !f.Revenue {
+		http.Error(w, service.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
 
 	whereClause := "WHERE 1=1"
 	var args []interface{}
 
-	if role == domain.RoleSchoolAdmin {
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
-		whereClause += " AND c.school_id = ?"
-		args = append(args, schoolID)
-	} else if role == domain.RoleTeacher {
-		whereClause += " AND c.teacher_id = ?"
-		args = append(args, userID)
+	if !f.Platform {
+		whereClause += " AND " + f.cond
+		args = append(args, f.args...)
 	}
 
+	currency := h.reportingCurrency(f.ReportScope)
 	query := fmt.Sprintf(`
 		SELECT c.title,
 		       COUNT(DISTINCT e.id) AS enrollments,
-		       COALESCE(SUM(p.amount), 0) AS revenue
+		       COALESCE(SUM(`+inCurrency("p.amount - p.refunded_amount", "p", currency)+`), 0) AS revenue
 		FROM courses c
 		LEFT JOIN enrollments e ON e.course_id = c.id AND e.status = 'active'
-		LEFT JOIN payments p ON p.course_id = c.id
+		LEFT JOIN payments p ON p.course_id = c.id AND p.status IN `+settledPaymentStatuses+`
 		%s
 		GROUP BY c.id, c.title
 		ORDER BY enrollments DESC
@@ -424,72 +536,160 @@ func (h *DashboardHandler) GetCourseBreakdown(w http.ResponseWriter, r *http.Req
 	if items == nil {
 		items = []CourseBreakdownItem{}
 	}
+	h.flagUnconverted(w, f, currency)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 }
 
-// ExportCSV handles GET /api/analytics/export
-func (h *DashboardHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+type BranchBreakdownItem struct {
+	BranchID    *string `json:"branch_id"` // nil for the school's courses on no branch
+	BranchName  string  `json:"branch_name"`
+	Courses     int     `json:"courses"`
+	Students    int     `json:"students"`
+	Enrollments int     `json:"enrollments"`
+	Revenue     float64 `json:"revenue"`
+	Currency    string  `json:"currency"`
+}
 
-	if !ok || !okRole {
+// GetBranchBreakdown handles GET /api/analytics/branch-breakdown. It compares a school's
+// branches; a branch manager sees only their own.
+func (h *DashboardHandler) GetBranchBreakdown(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetBranchBreakdown] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if f.SchoolID == "" || !f.Revenue {
+		http.Error(w, service.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", `attachment; filename="analytics_export.csv"`)
+	// Enrollments and payments are summed per course first so that joining both does not
+	// multiply either.
+	currency := h.reportingCurrency(f.ReportScope)
+	query := `
+		SELECT c.branch_id, COALESCE(b.name, ''), COUNT(*),
+		       COALESCE(SUM(ec.students), 0), COALESCE(SUM(ec.enrollments), 0), COALESCE(SUM(pc.revenue), 0)
+		FROM courses c
+		LEFT JOIN school_branches b ON c.branch_id = b.id
+		LEFT JOIN (
+			SELECT e.course_id, COUNT(DISTINCT e.student_user_id) AS students, COUNT(*) AS enrollments
+			FROM enrollments e WHERE e.status = 'active' GROUP BY e.course_id
+		) ec ON ec.course_id = c.id
+		LEFT JOIN (
+			SELECT p.course_id, SUM(` + inCurrency("p.amount - p.refunded_amount", "p", currency) + `) AS revenue
+			FROM payments p WHERE p.status IN ` + settledPaymentStatuses + ` GROUP BY p.course_id
+		) pc ON pc.course_id = c.id
+		WHERE ` + f.cond + `
+		GROUP BY c.branch_id, b.name
+		ORDER BY b.name IS NULL, b.name
+	`
+	rows, err := h.db.Query(query, f.args...)
+	if err != nil {
+		log.Printf("[DashboardHandler.GetBranchBreakdown] error: %v", err)
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	var items []BranchBreakdownItem
+	for rows.Next() {
+		item := BranchBreakdownItem{Currency: currency}
+		if err := rows.Scan(&item.BranchID, &item.BranchName, &item.Courses, &item.Students, &item.Enrollments, &item.Revenue); err != nil {
+			log.Printf("[DashboardHandler.GetBranchBreakdown] scan error: %v", err)
+			http.Error(w, "query error", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+	if items == nil {
+		items = []BranchBreakdownItem{}
+	}
+	h.flagUnconverted(w, f, currency)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
 
-	cw := csv.NewWriter(w)
-	defer cw.Flush()
+// ExportCSV handles GET /api/analytics/export
+func (h *DashboardHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	f, err := h.reportScope(r, actor)
+	if err != nil {
+		log.Printf("[DashboardHandler.ExportCSV] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	filterJoin := ""
 	filterWhere := ""
 	var args []interface{}
 
-	if role == domain.RoleSchoolAdmin {
-		var schoolID string
-		h.db.QueryRow("SELECT id FROM schools WHERE admin_user_id = ?", userID).Scan(&schoolID)
-		filterJoin = " JOIN courses c ON c.id = entity.course_id "
-		filterWhere = " AND c.school_id = ?"
-		args = append(args, schoolID)
-	} else if role == domain.RoleTeacher {
+	if !f.Revenue {
+		http.Error(w, service.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	if !f.Platform {
 		filterJoin = " JOIN courses c ON c.id = entity.course_id "
-		filterWhere = " AND c.teacher_id = ?"
-		args = append(args, userID)
+		filterWhere = " AND " + f.cond
+		args = append(args, f.args...)
 	}
 
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="analytics_export.csv"`)
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	currency := h.reportingCurrency(f.ReportScope)
+
 	// Section 1: Summary stats
 	cw.Write([]string{"Section", "Metric", "Value"})
 	var students, courses, teachers int
 	var revenue float64
 
-	if role == domain.RoleAdmin {
+	if f.Platform {
 		h.db.QueryRow("SELECT COUNT(DISTINCT student_user_id) FROM enrollments").Scan(&students)
 		h.db.QueryRow("SELECT COUNT(*) FROM courses").Scan(&courses)
 		h.db.QueryRow("SELECT COUNT(*) FROM teacher_profiles").Scan(&teachers)
-		h.db.QueryRow("SELECT COALESCE(SUM(amount),0) FROM payments").Scan(&revenue)
+		h.db.QueryRow("SELECT COALESCE(SUM(" + inCurrency("p.amount - p.refunded_amount", "p", currency) + "),0) FROM payments p WHERE p.status IN " + settledPaymentStatuses).Scan(&revenue)
 	} else {
 		studentQ := fmt.Sprintf("SELECT COUNT(DISTINCT entity.student_user_id) FROM enrollments entity %s WHERE 1=1 %s", filterJoin, filterWhere)
 		h.db.QueryRow(studentQ, args...).Scan(&students)
-		courseQ := fmt.Sprintf("SELECT COUNT(*) FROM courses c WHERE 1=1 AND c.school_id = ?")
-		if role == domain.RoleTeacher {
-			courseQ = fmt.Sprintf("SELECT COUNT(*) FROM courses c WHERE 1=1 AND c.teacher_id = ?")
+		courseQ := fmt.Sprintf("SELECT COUNT(*) FROM courses c WHERE 1=1 %s", filterWhere)
+		if f.TeacherID != "" {
 			teachers = 1
 		} else {
-			teacherQ := fmt.Sprintf("SELECT COUNT(*) FROM users WHERE role = 'teacher' AND school_id = ?")
-			h.db.QueryRow(teacherQ, args...).Scan(&teachers)
+			// Teachers of the courses in scope, or of one of their sections.
+			teacherQ := `
+				SELECT COUNT(DISTINCT t.teacher_id) FROM (
+					SELECT c.teacher_id FROM courses c WHERE c.teacher_id IS NOT NULL AND ` + f.cond + `
+					UNION
+					SELECT cs.teacher_id FROM course_sections cs JOIN courses c ON cs.course_id = c.id
+					WHERE cs.teacher_id IS NOT NULL AND ` + f.cond + `
+				) t`
+			h.db.QueryRow(teacherQ, append(append([]interface{}{}, f.args...), f.args...)...).Scan(&teachers)
 		}
 		h.db.QueryRow(courseQ, args...).Scan(&courses)
-		revQ := fmt.Sprintf("SELECT COALESCE(SUM(entity.amount),0) FROM payments entity %s WHERE 1=1 %s", filterJoin, filterWhere)
+		revQ := fmt.Sprintf("SELECT COALESCE(SUM(%s),0) FROM payments entity %s WHERE entity.status IN %s %s", inCurrency("entity.amount - entity.refunded_amount", "entity", currency), filterJoin, settledPaymentStatuses, filterWhere)
 		h.db.QueryRow(revQ, args...).Scan(&revenue)
 	}
 
 	cw.Write([]string{"Summary", "Total Students", fmt.Sprintf("%d", students)})
 	cw.Write([]string{"Summary", "Total Courses", fmt.Sprintf("%d", courses)})
 	cw.Write([]string{"Summary", "Total Teachers", fmt.Sprintf("%d", teachers)})
-	cw.Write([]string{"Summary", "Total Revenue (TJS)", fmt.Sprintf("%.2f", revenue)})
+	cw.Write([]string{"Summary", "Total Revenue (" + currency + ")", fmt.Sprintf("%.2f", revenue)})
+	if unconverted := h.unconvertedCurrencies(f, currency); len(unconverted) > 0 {
+		cw.Write([]string{"Summary", "Revenue Not Included (no " + currency + " exchange rate)", strings.Join(unconverted, " ")})
+	}
 	cw.Write([]string{})
 
 	// Section 2: Monthly enrollment trend
@@ -512,13 +712,20 @@ func (h *DashboardHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	cw.Write([]string{})
 
 	// Section 3: Monthly revenue
-	cw.Write([]string{"Revenue Trend", "Month", "Revenue (TJS)"})
+	cw.Write([]string{"Revenue Trend", "Month", "Revenue (" + currency + ")"})
 	pQuery := fmt.Sprintf(`
-		SELECT DATE_FORMAT(entity.paid_at, '%%Y-%%m'), COALESCE(SUM(entity.amount),0)
-		FROM payments entity %s
-		WHERE entity.paid_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) %s
-		GROUP BY 1 ORDER BY 1`, filterJoin, filterWhere)
-	pRows, _ := h.db.Query(pQuery, args...)
+		SELECT month, COALESCE(SUM(total),0) FROM (
+			SELECT DATE_FORMAT(entity.paid_at, '%%Y-%%m') AS month, %[4]s AS total
+			FROM payments entity %[1]s
+			WHERE entity.paid_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) AND entity.status IN %[3]s %[2]s
+			UNION ALL
+			SELECT DATE_FORMAT(rf.created_at, '%%Y-%%m') AS month, %[5]s AS total
+			FROM refunds rf JOIN payments entity ON rf.payment_id = entity.id %[1]s
+			WHERE rf.created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) AND rf.status = 'success' %[2]s
+		) t
+		GROUP BY 1 ORDER BY 1`, filterJoin, filterWhere, settledPaymentStatuses,
+		inCurrency("entity.amount", "entity", currency), inCurrency("-rf.amount", "entity", currency))
+	pRows, _ := h.db.Query(pQuery, append(append([]interface{}{}, args...), args...)...)
 	if pRows != nil {
 		defer pRows.Close()
 		for pRows.Next() {
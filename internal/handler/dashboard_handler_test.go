@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+func TestReportScopeByBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     domain.SchoolRole
+		branch   string // the one the member is limited to
+		query    string
+		wantCond string
+		wantArgs []interface{}
+	}{
+		{"owner, whole school", domain.SchoolRoleOwner, "", "", "c.school_id = ?", []interface{}{"s1"}},
+		{"owner narrowing to a branch", domain.SchoolRoleOwner, "", "?branch_id=b2", "c.school_id = ? AND c.branch_id = ?", []interface{}{"s1", "b2"}},
+		{"branch manager", domain.SchoolRoleBranchManager, "b1", "", "c.school_id = ? AND c.branch_id = ?", []interface{}{"s1", "b1"}},
+		// A branch manager cannot widen their scope to another branch.
+		{"branch manager asking for another branch", domain.SchoolRoleBranchManager, "b1", "?branch_id=b2", "c.school_id = ? AND c.branch_id = ?", []interface{}{"s1", "b1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var branchID interface{}
+			if tt.branch != "" {
+				branchID = tt.branch
+			}
+			mock.ExpectQuery(`FROM school_members sm .* WHERE sm\.user_id = \?`).WithArgs("u1").
+				WillReturnRows(sqlmock.NewRows([]string{"school_id", "user_id", "name", "email", "role", "branch_id", "branch_name", "added_by", "created_at"}).
+					AddRow("s1", "u1", "Staff", "", string(tt.role), branchID, "", nil, time.Now()))
+			h := NewDashboardHandler(db, service.NewPolicy(nil, nil, nil, &repository.SchoolMemberRepository{DB: db}, nil, nil))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/dashboard/stats"+tt.query, nil)
+			f, err := h.reportScope(r, service.Actor{UserID: "u1", Role: domain.RoleSchoolAdmin})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.cond != tt.wantCond || !reflect.DeepEqual(f.args, tt.wantArgs) {
+				t.Fatalf("filter = %q %v, want %q %v", f.cond, f.args, tt.wantCond, tt.wantArgs)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReportScopeForStudentsCoversNothing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(`FROM school_members sm`).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"school_id", "user_id", "name", "email", "role", "branch_id", "branch_name", "added_by", "created_at"}))
+	h := NewDashboardHandler(db, service.NewPolicy(nil, nil, nil, &repository.SchoolMemberRepository{DB: db}, nil, nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/dashboard/stats?branch_id=b1", nil)
+	f, err := h.reportScope(r, service.Actor{UserID: "u1", Role: domain.RoleStudent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.cond != "1 = 0" {
+		t.Fatalf("cond = %q, want none of the courses", f.cond)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/service"
+)
+
+type ExchangeRateHandler struct {
+	service *service.ExchangeRateService
+}
+
+func NewExchangeRateHandler(s *service.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{service: s}
+}
+
+// ListRates handles GET /api/exchange-rates?currency=USD&limit=50
+func (h *ExchangeRateHandler) ListRates(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	rates, err := h.service.ListRates(r.Context(), r.URL.Query().Get("currency"), limit)
+	if err != nil {
+		log.Printf("[ExchangeRateHandler.ListRates] error: %v", err)
+		http.Error(w, "failed to fetch exchange rates", http.StatusInternalServerError)
+		return
+	}
+	if rates == nil {
+		rates = []domain.ExchangeRate{}
+	}
+	json.NewEncoder(w).Encode(rates)
+}
+
+// SetRate handles POST /api/exchange-rates
+func (h *ExchangeRateHandler) SetRate(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input service.ExchangeRateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rate, err := h.service.SetRate(r.Context(), actor, input)
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[ExchangeRateHandler.SetRate] error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rate)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/service"
+)
+
+func TestSetRateByRole(t *testing.T) {
+	// The policy decides on the platform without lookups, and an unsupported currency is
+	// refused before the rate is stored, so neither needs repositories here.
+	policy := service.NewPolicy(nil, nil, nil, nil, nil, nil)
+	h := NewExchangeRateHandler(service.NewExchangeRateService(nil, policy))
+
+	tests := []struct {
+		role domain.Role
+		want int
+	}{
+		{domain.RoleAdmin, http.StatusBadRequest},
+		{domain.RoleSchoolAdmin, http.StatusForbidden},
+		{domain.RoleTeacher, http.StatusForbidden},
+		{domain.RoleStudent, http.StatusForbidden},
+		{domain.RoleParent, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/exchange-rates", strings.NewReader(`{"currency":"XXX","rate":1}`))
+			ctx := context.WithValue(r.Context(), UserContextKey, "u1")
+			ctx = context.WithValue(ctx, RoleContextKey, tt.role)
+			rec := httptest.NewRecorder()
+			h.SetRate(rec, r.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
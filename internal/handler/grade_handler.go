@@ -20,7 +20,11 @@ func NewGradeHandler(s *service.GradeService) *GradeHandler {
 
 // CreateGrade handles POST /api/courses/{id}/grades
 func (h *GradeHandler) CreateGrade(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	courseID := chi.URLParam(r, "id")
 
 	var grade domain.Grade
@@ -29,11 +33,14 @@ func (h *GradeHandler) CreateGrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	grade.CourseID = courseID
-	grade.GradedBy = userID
 
-	if err := h.service.CreateGrade(r.Context(), &grade); err != nil {
+	if err := h.service.CreateGrade(r.Context(), actor, &grade); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[GradeHandler.CreateGrade] error: %v", err)
-		http.Error(w, "failed to create grade", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -42,11 +49,20 @@ func (h *GradeHandler) CreateGrade(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(grade)
 }
 
-// ListCourseGrades handles GET /api/courses/{id}/grades
+// ListCourseGrades handles GET /api/courses/{id}/grades?section_id=
 func (h *GradeHandler) ListCourseGrades(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	courseID := chi.URLParam(r, "id")
-	grades, err := h.service.ListByCourse(r.Context(), courseID)
+	grades, err := h.service.ListByCourse(r.Context(), actor, courseID, r.URL.Query().Get("section_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[GradeHandler.ListCourseGrades] error: %v", err)
 		http.Error(w, "failed to fetch grades", http.StatusInternalServerError)
 		return
@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type GuardianHandler struct {
+	service *service.GuardianService
+}
+
+func NewGuardianHandler(s *service.GuardianService) *GuardianHandler {
+	return &GuardianHandler{service: s}
+}
+
+type InviteGuardianRequest struct {
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"` // used when no email is given
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// Invite handles POST /api/students/{id}/guardians
+func (h *GuardianHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req InviteGuardianRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.service.Invite(r.Context(), actor, chi.URLParam(r, "id"), req.Email, req.Phone, req.Relationship)
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if errors.Is(err, service.ErrGuardianContactRequired) || errors.Is(err, service.ErrInvalidPhone) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[GuardianHandler.Invite] error: %v", err)
+		http.Error(w, "failed to send invitation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// ListGuardians handles GET /api/students/{id}/guardians
+func (h *GuardianHandler) ListGuardians(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	links, err := h.service.ListGuardians(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ListGuardians] error: %v", err)
+		http.Error(w, "failed to fetch guardians", http.StatusInternalServerError)
+		return
+	}
+	if links == nil {
+		links = []domain.GuardianLink{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// Revoke handles DELETE /api/guardians/{id}
+func (h *GuardianHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.Revoke(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.Revoke] error: %v", err)
+		http.Error(w, "failed to remove guardian", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Accept handles POST /api/guardians/accept
+func (h *GuardianHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	studentID, err := h.service.Accept(r.Context(), actor, req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotParentAccount), errors.Is(err, service.ErrGuardianInviteForOther):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, repository.ErrGuardianInviteInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrAlreadyGuardian):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("[GuardianHandler.Accept] error: %v", err)
+			http.Error(w, "failed to accept invitation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"student_user_id": studentID})
+}
+
+// ListChildren handles GET /api/children
+func (h *GuardianHandler) ListChildren(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	children, err := h.service.ListChildren(r.Context(), actor)
+	if err != nil {
+		log.Printf("[GuardianHandler.ListChildren] error: %v", err)
+		http.Error(w, "failed to fetch children", http.StatusInternalServerError)
+		return
+	}
+	if children == nil {
+		children = []domain.Child{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(children)
+}
+
+// ChildGrades handles GET /api/children/{id}/grades
+func (h *GuardianHandler) ChildGrades(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	grades, err := h.service.ChildGrades(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildGrades] error: %v", err)
+		http.Error(w, "failed to fetch grades", http.StatusInternalServerError)
+		return
+	}
+	if grades == nil {
+		grades = []domain.Grade{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grades)
+}
+
+// ChildAttendance handles GET /api/children/{id}/attendance
+func (h *GuardianHandler) ChildAttendance(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	records, err := h.service.ChildAttendance(r.Context(), actor, chi.URLParam(r, "id"), r.URL.Query().Get("course_id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildAttendance] error: %v", err)
+		http.Error(w, "failed to fetch attendance", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []domain.Attendance{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// ChildAttendanceSummary handles GET /api/children/{id}/attendance/summary
+func (h *GuardianHandler) ChildAttendanceSummary(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	summaries, err := h.service.ChildAttendanceSummary(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildAttendanceSummary] error: %v", err)
+		http.Error(w, "failed to fetch summary", http.StatusInternalServerError)
+		return
+	}
+	if summaries == nil {
+		summaries = []domain.AttendanceSummary{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// ChildAssignments handles GET /api/children/{id}/assignments
+func (h *GuardianHandler) ChildAssignments(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	assignments, err := h.service.ChildAssignments(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildAssignments] error: %v", err)
+		http.Error(w, "failed to fetch assignments", http.StatusInternalServerError)
+		return
+	}
+	if assignments == nil {
+		assignments = []domain.Assignment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assignments)
+}
+
+// ChildPayments handles GET /api/children/{id}/payments
+func (h *GuardianHandler) ChildPayments(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	payments, err := h.service.ChildPayments(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildPayments] error: %v", err)
+		http.Error(w, "failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+	if payments == nil {
+		payments = []domain.Payment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+// ChildBalance handles GET /api/children/{id}/balance
+func (h *GuardianHandler) ChildBalance(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	balance, err := h.service.ChildBalance(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildBalance] error: %v", err)
+		http.Error(w, "failed to fetch balance", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balance)
+}
+
+// ChildTeachers handles GET /api/children/{id}/teachers
+func (h *GuardianHandler) ChildTeachers(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	teachers, err := h.service.ChildTeachers(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[GuardianHandler.ChildTeachers] error: %v", err)
+		http.Error(w, "failed to fetch teachers", http.StatusInternalServerError)
+		return
+	}
+	if teachers == nil {
+		teachers = []domain.ChildTeacher{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teachers)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// IdempotencyMiddleware makes a mutation safe to retry. When a request carries an
+// Idempotency-Key header, the first response for that key is stored and returned again
+// for every retry of the same request by the same user. Reusing a key for a different
+// request is rejected, as is a retry that arrives while the first one is still running,
+// unless it has run past repository.IdempotencyLease. Server errors are not stored, so a
+// failed request can be retried with the same key. It must run after AuthMiddleware.
+func IdempotencyMiddleware(repo *repository.IdempotencyRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+			userID, ok := r.Context().Value(UserContextKey).(string)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentRequestBytes {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+			hash.Write(body)
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			rec, reserved, err := repo.Reserve(r.Context(), &domain.IdempotencyRecord{
+				UserID:      userID,
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				RequestHash: requestHash,
+			})
+			if err != nil {
+				log.Printf("[IdempotencyMiddleware] error: %v", err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case rec.RequestHash != requestHash:
+					http.Error(w, "idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+				case rec.Status != domain.IdempotencyStatusCompleted:
+					http.Error(w, "a request with this idempotency key is still being processed", http.StatusConflict)
+				default:
+					if rec.ResponseContentType != "" {
+						w.Header().Set("Content-Type", rec.ResponseContentType)
+					}
+					w.Header().Set(IdempotentReplayedHeader, "true")
+					w.WriteHeader(rec.ResponseStatus)
+					w.Write(rec.ResponseBody)
+				}
+				return
+			}
+
+			rw := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				// Use a fresh context: the request's may already be cancelled.
+				ctx := context.WithoutCancel(r.Context())
+				if p := recover(); p != nil {
+					if err := repo.Release(ctx, rec.ID); err != nil {
+						log.Printf("[IdempotencyMiddleware] error: %v", err)
+					}
+					panic(p)
+				}
+				if rw.status >= http.StatusInternalServerError {
+					err = repo.Release(ctx, rec.ID)
+				} else {
+					err = repo.Complete(ctx, rec.ID, rw.status, rw.Header().Get("Content-Type"), rw.body.Bytes())
+				}
+				if err != nil {
+					log.Printf("[IdempotencyMiddleware] error: %v", err)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// recordingResponseWriter passes a response through while keeping a copy of it.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+const idempotentBody = `{"amount":100}`
+
+// idempotentRequest is a POST by user-1 carrying key-1.
+func idempotentRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/payments", strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, "key-1")
+	return r.WithContext(context.WithValue(r.Context(), UserContextKey, "user-1"))
+}
+
+func idempotentHash(body string) string {
+	sum := sha256.Sum256([]byte(http.MethodPost + " /api/payments\n" + body))
+	return hex.EncodeToString(sum[:])
+}
+
+func newIdempotencyMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	mock.ExpectExec(`DELETE FROM idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+	return db, mock
+}
+
+// expectStored answers a reservation with the record already stored under the key.
+func expectStored(mock sqlmock.Sqlmock, hash, status string, responseStatus any, body []byte) {
+	mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM idempotency_keys WHERE user_id = \? AND idempotency_key = \?`).
+		WithArgs("user-1", "key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "idempotency_key", "method", "path", "request_hash", "status",
+			"response_status", "response_content_type", "response_body", "created_at"}).
+			AddRow("rec-1", "user-1", "key-1", http.MethodPost, "/api/payments", hash, status,
+				responseStatus, "application/json", body, time.Now()))
+}
+
+func TestIdempotencyMiddlewareStoredKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		hash       string
+		status     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"replays a completed response", idempotentHash(idempotentBody), domain.IdempotencyStatusCompleted, http.StatusCreated, `{"id":"pay-1"}`},
+		{"rejects a retry while processing", idempotentHash(idempotentBody), domain.IdempotencyStatusProcessing, http.StatusConflict, ""},
+		{"rejects the key for a different body", idempotentHash(`{"amount":1}`), domain.IdempotencyStatusCompleted, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newIdempotencyMock(t)
+			var responseStatus any
+			var body []byte
+			if tt.status == domain.IdempotencyStatusCompleted {
+				responseStatus, body = http.StatusCreated, []byte(`{"id":"pay-1"}`)
+			}
+			expectStored(mock, tt.hash, tt.status, responseStatus, body)
+
+			w := httptest.NewRecorder()
+			IdempotencyMiddleware(repository.NewIdempotencyRepository(db))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Fatal("handler ran for a stored key")
+			})).ServeHTTP(w, idempotentRequest(idempotentBody))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				if w.Body.String() != tt.wantBody || w.Header().Get(IdempotentReplayedHeader) != "true" {
+					t.Fatalf("replay = %q (replayed %q), want %q", w.Body.String(), w.Header().Get(IdempotentReplayedHeader), tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareStoresResponse(t *testing.T) {
+	db, mock := newIdempotencyMock(t)
+	mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE idempotency_keys SET status = 'completed'`).
+		WithArgs(http.StatusCreated, "application/json", []byte(`{"id":"pay-1"}`), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	IdempotencyMiddleware(repository.NewIdempotencyRepository(db))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"pay-1"}`))
+	})).ServeHTTP(w, idempotentRequest(idempotentBody))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotencyMiddlewareReleasesFailedRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}},
+		{"panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newIdempotencyMock(t)
+			mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`DELETE FROM idempotency_keys WHERE id = \?`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			defer func() {
+				if p := recover(); p != nil && p != "boom" {
+					panic(p)
+				}
+			}()
+			IdempotencyMiddleware(repository.NewIdempotencyRepository(db))(tt.handler).
+				ServeHTTP(httptest.NewRecorder(), idempotentRequest(idempotentBody))
+		})
+	}
+}
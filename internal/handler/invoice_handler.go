@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/service"
+)
+
+type InvoiceHandler struct {
+	service *service.InvoiceService
+}
+
+func NewInvoiceHandler(s *service.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{service: s}
+}
+
+// MyBalance handles GET /api/my-balance
+func (h *InvoiceHandler) MyBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	balance, err := h.service.MyBalance(r.Context(), userID)
+	if err != nil {
+		log.Printf("[InvoiceHandler.MyBalance] error: %v", err)
+		http.Error(w, "failed to fetch balance", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(balance)
+}
+
+// CourseDebtors handles GET /api/courses/{id}/debtors?section_id=
+func (h *InvoiceHandler) CourseDebtors(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+	courseID := chi.URLParam(r, "id")
+
+	if !ok || !okRole {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	debtors, err := h.service.CourseDebtors(r.Context(), userID, role, courseID, r.URL.Query().Get("section_id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if debtors == nil {
+		debtors = []domain.Debtor{}
+	}
+	json.NewEncoder(w).Encode(debtors)
+}
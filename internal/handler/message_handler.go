@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -20,16 +21,23 @@ func NewMessageHandler(s *service.MessageService) *MessageHandler {
 
 // Send handles POST /api/messages
 func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	var m domain.Message
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	m.FromUserID = userID
 
-	if err := h.service.Send(r.Context(), &m); err != nil {
+	if err := h.service.Send(r.Context(), actor, &m); err != nil {
+		if errors.Is(err, service.ErrMessageRecipientNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		log.Printf("[MessageHandler.Send] error: %v", err)
 		http.Error(w, "failed to send message", http.StatusInternalServerError)
 		return
@@ -2,19 +2,26 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
 	"github.com/schooltj/internal/service"
 )
 
 type contextKey string
 
 const (
-	UserContextKey contextKey = "user"
-	RoleContextKey contextKey = "role"
+	UserContextKey         contextKey = "user"
+	RoleContextKey         contextKey = "role"
+	SessionContextKey      contextKey = "session"
+	ImpersonatorContextKey contextKey = "impersonator" // the admin acting as the user, if any
+	ClientIPContextKey     contextKey = "client_ip"    // set by ClientIPMiddleware
 )
 
 func AuthMiddleware(authService *service.AuthService) func(http.Handler) http.Handler {
@@ -36,7 +43,7 @@ func AuthMiddleware(authService *service.AuthService) func(http.Handler) http.Ha
 			}
 
 			tokenString := parts[1]
-			claims, err := authService.VerifyToken(tokenString)
+			claims, err := authService.VerifyToken(r.Context(), tokenString)
 			if err != nil {
 				fmt.Printf("AuthMiddleware: Token verification failed: %v\n", err)
 				http.Error(w, "invalid token", http.StatusUnauthorized)
@@ -52,9 +59,200 @@ func AuthMiddleware(authService *service.AuthService) func(http.Handler) http.Ha
 				return
 			}
 
+			if setup, _ := claims["tfa_setup"].(bool); setup && !allowedDuringTwoFactorSetup(r) {
+				http.Error(w, "your school requires two-factor authentication; set it up to continue", http.StatusForbidden)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), UserContextKey, userID)
 			ctx = context.WithValue(ctx, RoleContextKey, domain.Role(roleStr))
+			ctx = context.WithValue(ctx, SessionContextKey, claims["sid"])
+
+			if adminID, _ := claims["imp"].(string); adminID != "" {
+				if blockedDuringImpersonation(r) {
+					http.Error(w, "not available while impersonating a user", http.StatusForbidden)
+					return
+				}
+				if r.Method != http.MethodGet {
+					authService.AuditImpersonatedRequest(r.Context(), adminID, userID, r.Method, r.URL.Path, clientIP(r))
+				}
+				ctx = context.WithValue(ctx, ImpersonatorContextKey, adminID)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// allowedDuringTwoFactorSetup lists what a teacher who still has to set up two-factor
+// authentication may do: manage their sign-in and read their own profile.
+func allowedDuringTwoFactorSetup(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/auth/") {
+		return true
+	}
+	return r.Method == http.MethodGet && (r.URL.Path == "/api/me" || r.URL.Path == "/me")
+}
+
+// blockedDuringImpersonation lists what an admin may not do as another user: change how
+// the user signs in.
+func blockedDuringImpersonation(r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/auth/2fa/") ||
+		r.URL.Path == "/api/auth/logout-all" ||
+		r.URL.Path == "/api/settings/change-password" ||
+		r.URL.Path == "/api/me" || r.URL.Path == "/me"
+}
+
+// RequireRole lets a request through only for users with one of the roles. It must run
+// after AuthMiddleware.
+func RequireRole(roles ...domain.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(RoleContextKey).(domain.Role)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// RequireVerifiedEmail lets a request through only once the user has confirmed their
+// email address. It guards enrollment and payment routes and must run after AuthMiddleware.
+func RequireVerifiedEmail(verifications *service.EmailVerificationService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(UserContextKey).(string)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err := verifications.RequireVerified(r.Context(), userID); err != nil {
+				if errors.Is(err, service.ErrEmailNotVerified) {
+					http.Error(w, "verify your email address to continue", http.StatusForbidden)
+					return
+				}
+				log.Printf("[RequireVerifiedEmail] error: %v", err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseTrustedProxies parses a comma-separated list of the addresses or CIDR ranges of the
+// reverse proxies in front of the API, such as "10.0.0.0/8,127.0.0.1".
+func ParseTrustedProxies(spec string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q: %w", part, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// ClientIPMiddleware works out the address each request came from. X-Forwarded-For is
+// believed only for requests that arrive from a trusted proxy, and then only back to the
+// nearest address that is not one, since a client can put anything in the header.
+func ClientIPMiddleware(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedFor(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIPContextKey, ip)))
+		})
+	}
+}
+
+func forwardedFor(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteHost(r)
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrustedProxy(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// clientIP is the address a request came from, as ClientIPMiddleware worked it out.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPContextKey).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// actorFrom returns the signed-in user that AuthMiddleware put on the request.
+func actorFrom(r *http.Request) (service.Actor, bool) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+	return service.Actor{UserID: userID, Role: role}, ok && okRole
+}
+
+// accessErrorStatus is the status for an error from a service's authorization check:
+// 403 when the policy refused, 404 when the resource does not exist, 0 for other errors.
+func accessErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrCourseNotFound), errors.Is(err, repository.ErrSchoolNotFound), errors.Is(err, repository.ErrEnrollmentNotFound),
+		errors.Is(err, service.ErrAssignmentNotFound), errors.Is(err, service.ErrSubmissionNotFound),
+		errors.Is(err, repository.ErrUserNotFound), errors.Is(err, repository.ErrGuardianLinkNotFound),
+		errors.Is(err, repository.ErrSchoolMemberNotFound), errors.Is(err, repository.ErrBranchNotFound), errors.Is(err, repository.ErrRoomNotFound),
+		errors.Is(err, repository.ErrSectionNotFound):
+		return http.StatusNotFound
+	}
+	return 0
+}
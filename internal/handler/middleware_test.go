@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustsForwardedForOnlyFromProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:5123", "", "203.0.113.7"},
+		{"direct client spoofing the header", "203.0.113.7:5123", "198.51.100.1", "203.0.113.7"},
+		{"through a proxy", "10.1.2.3:443", "198.51.100.1", "198.51.100.1"},
+		{"through two proxies", "127.0.0.1:443", "198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"client prepends a fake hop", "10.1.2.3:443", "192.0.2.99, 198.51.100.1", "198.51.100.1"},
+		{"proxy with garbage header", "10.1.2.3:443", "not-an-ip", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			var got string
+			ClientIPMiddleware(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8,proxy.internal"); err == nil {
+		t.Fatal("expected an error for a host name")
+	}
+}
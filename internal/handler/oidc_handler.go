@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+// oidcStateCookie holds the state of a sign-in with a provider in the browser that started
+// it. The callback must come with the same state, so a provider redirect lured into
+// another browser cannot sign that browser in.
+const oidcStateCookie = "oidc_state"
+
+// oidcError writes the response for an error from signing in with a provider.
+func oidcError(w http.ResponseWriter, method string, err error) {
+	var locked *service.AccountLockedError
+	switch {
+	case errors.Is(err, service.ErrUnknownOIDCProvider):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrLoginStateInvalid), errors.Is(err, service.ErrInvalidSignupToken),
+		errors.Is(err, service.ErrInvalidIDToken):
+		log.Printf("[AuthHandler.%s] rejected: %v", method, err)
+		http.Error(w, "sign-in failed, try again", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrSignupRoleNotAllowed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrOIDCEmailUnverified), errors.Is(err, service.ErrAccountSuspended):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrOIDCAccountUnverified), errors.Is(err, service.ErrEmailAlreadyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.As(err, &locked):
+		writeTooManyRequests(w, time.Until(locked.Until), locked.Error())
+	default:
+		log.Printf("[AuthHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ListOIDCProviders handles GET /api/auth/oidc/providers
+func (h *AuthHandler) ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.service.OIDCProviders())
+}
+
+// BeginOIDCLogin handles GET /api/auth/oidc/{provider}/start. The client sends the browser
+// to the returned URL; the provider redirects back to the app with a code and state.
+func (h *AuthHandler) BeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	url, state, err := h.service.BeginOIDCLogin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		oidcError(w, "BeginOIDCLogin", err)
+		return
+	}
+	// Browsers keep Secure cookies from http://localhost too, so this works in development.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(service.OIDCLoginExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"authorization_url": url})
+}
+
+// CompleteOIDCLogin handles POST /api/auth/oidc/{provider}/callback with the code and
+// state from the provider's redirect. A first-time user gets signup_required and a
+// signup_token instead of tokens.
+func (h *AuthHandler) CompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || req.State == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		oidcError(w, "CompleteOIDCLogin", repository.ErrLoginStateInvalid)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+
+	tokens, err := h.service.CompleteOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req.Code, req.State, sessionDevice(r))
+	if err != nil {
+		oidcError(w, "CompleteOIDCLogin", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// CompleteOIDCSignup handles POST /api/auth/oidc/signup
+func (h *AuthHandler) CompleteOIDCSignup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SignupToken string      `json:"signup_token"`
+		Role        domain.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.CompleteOIDCSignup(r.Context(), req.SignupToken, req.Role, sessionDevice(r))
+	if err != nil {
+		oidcError(w, "CompleteOIDCSignup", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// ListIdentities handles GET /api/auth/identities
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	identities, err := h.service.ListIdentities(r.Context(), userID)
+	if err != nil {
+		log.Printf("[AuthHandler.ListIdentities] error: %v", err)
+		http.Error(w, "failed to fetch linked accounts", http.StatusInternalServerError)
+		return
+	}
+	if identities == nil {
+		identities = []domain.UserIdentity{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
@@ -2,19 +2,26 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
 	"github.com/schooltj/internal/service"
 )
 
 type PaymentHandler struct {
-	service *service.PaymentService
+	service  *service.PaymentService
+	receipts *service.ReceiptService
 }
 
-func NewPaymentHandler(s *service.PaymentService) *PaymentHandler {
-	return &PaymentHandler{service: s}
+func NewPaymentHandler(s *service.PaymentService, receipts *service.ReceiptService) *PaymentHandler {
+	return &PaymentHandler{service: s, receipts: receipts}
 }
 
 // RecordPayment handles POST /api/payments
@@ -35,6 +42,10 @@ func (h *PaymentHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
 
 	payment, err := h.service.RecordPayment(r.Context(), userID, role, input)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -43,7 +54,7 @@ func (h *PaymentHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(payment)
 }
 
-// ListPayments handles GET /api/payments?course_id=
+// ListPayments handles GET /api/payments?course_id=&branch_id=&section_id=
 func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(UserContextKey).(string)
 	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
@@ -54,8 +65,12 @@ func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	courseID := r.URL.Query().Get("course_id")
-	payments, err := h.service.ListPayments(r.Context(), userID, role, courseID)
+	payments, err := h.service.ListPayments(r.Context(), userID, role, courseID, r.URL.Query().Get("branch_id"), r.URL.Query().Get("section_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[PaymentHandler.ListPayments] error: %v", err)
 		http.Error(w, "failed to fetch payments", http.StatusInternalServerError)
 		return
@@ -86,15 +101,135 @@ func (h *PaymentHandler) MyPayments(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(payments)
 }
 
+// ListReconciliations handles GET /api/payments/reconciliations?limit=&branch_id=
+// It reports the status changes made by the background reconciler.
+func (h *PaymentHandler) ListReconciliations(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	recs, err := h.service.ListReconciliations(r.Context(), actor, limit, r.URL.Query().Get("branch_id"))
+	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[PaymentHandler.ListReconciliations] error: %v", err)
+		http.Error(w, "failed to fetch reconciliations", http.StatusInternalServerError)
+		return
+	}
+	if recs == nil {
+		recs = []domain.PaymentReconciliation{}
+	}
+	json.NewEncoder(w).Encode(recs)
+}
+
+// RefundPayment handles POST /api/payments/{id}/refund
+func (h *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+
+	if !ok || !okRole {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input service.RefundInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := h.service.RefundPayment(r.Context(), userID, role, chi.URLParam(r, "id"), input)
+	if err != nil {
+		log.Printf("[PaymentHandler.RefundPayment] error: %v", err)
+		writePaymentError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refund)
+}
+
+// ListRefunds handles GET /api/payments/{id}/refunds
+func (h *PaymentHandler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+
+	if !ok || !okRole {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	refunds, err := h.service.ListRefunds(r.Context(), userID, role, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("[PaymentHandler.ListRefunds] error: %v", err)
+		writePaymentError(w, err)
+		return
+	}
+	if refunds == nil {
+		refunds = []domain.Refund{}
+	}
+	json.NewEncoder(w).Encode(refunds)
+}
+
+// DownloadReceipt handles GET /api/payments/{id}/receipt
+func (h *PaymentHandler) DownloadReceipt(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	role, okRole := r.Context().Value(RoleContextKey).(domain.Role)
+
+	if !ok || !okRole {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	receipt, err := h.receipts.GetForDownload(r.Context(), userID, role, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("[PaymentHandler.DownloadReceipt] error: %v", err)
+		if errors.Is(err, service.ErrReceiptUnavailable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writePaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"receipt-%06d.pdf\"", receipt.Number))
+	w.Header().Set("Content-Type", "application/pdf")
+	http.ServeFile(w, r, receipt.FilePath)
+}
+
+// writePaymentError maps payment service errors onto HTTP statuses.
+func writePaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPaymentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrPaymentForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, repository.ErrRefundExceedsPayment), errors.Is(err, repository.ErrPaymentNotRefundable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrRefundRejected):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// InitiatePaymentRequest carries no amount: the server charges the student's effective price.
 type InitiatePaymentRequest struct {
-	CourseID string  `json:"course_id"`
-	Amount   float64 `json:"amount"`
-	Provider string  `json:"provider"` // alif, humo, etc.
+	CourseID  string `json:"course_id"`
+	Provider  string `json:"provider"`             // alif, humo, korti_milli
+	PromoCode string `json:"promo_code,omitempty"` // redeemed for the course before checkout
+	// StudentUserID lets a parent pay for one of their children. It defaults to the payer.
+	StudentUserID string `json:"student_user_id,omitempty"`
 }
 
 // InitiatePayment handles POST /api/payments/initiate
 func (h *PaymentHandler) InitiatePayment(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -106,10 +241,21 @@ func (h *PaymentHandler) InitiatePayment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	redirectURL, err := h.service.InitiateExternalPayment(r.Context(), userID, req.CourseID, req.Provider, req.Amount)
+	redirectURL, err := h.service.InitiateExternalPayment(r.Context(), actor, req.StudentUserID, req.CourseID, req.Provider, req.PromoCode)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[PaymentHandler.InitiatePayment] error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, service.ErrPromoCodeInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrPromoCodeExhausted):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -118,19 +264,27 @@ func (h *PaymentHandler) InitiatePayment(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// HandleAlifCallback handles POST /api/payments/callback/alif
-func (h *PaymentHandler) HandleAlifCallback(w http.ResponseWriter, r *http.Request) {
-	// For webhooks, we often can't use the standard auth middleware
-	// We might need a separate way to parse payload or just raw body
-	var payload interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+// HandleCallback handles POST /api/payments/callback/{provider}
+// It is mounted outside AuthMiddleware: each gateway authenticates by signing the body.
+func (h *PaymentHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.ProcessWebhook(r.Context(), "alif", payload); err != nil {
-		log.Printf("[PaymentHandler.HandleAlifCallback] error: %v", err)
-		http.Error(w, "processing failed", http.StatusInternalServerError)
+	if err := h.service.ProcessWebhook(r.Context(), provider, body, r.Header); err != nil {
+		log.Printf("[PaymentHandler.HandleCallback] %s error: %v", provider, err)
+		switch {
+		case errors.Is(err, service.ErrUnknownProvider):
+			http.Error(w, "unknown provider", http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidSignature):
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+		default:
+			http.Error(w, "processing failed", http.StatusInternalServerError)
+		}
 		return
 	}
 
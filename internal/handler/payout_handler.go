@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type PayoutHandler struct {
+	service *service.PayoutService
+}
+
+func NewPayoutHandler(s *service.PayoutService) *PayoutHandler {
+	return &PayoutHandler{service: s}
+}
+
+// GetSettings handles GET /api/schools/my/payout-settings
+func (h *PayoutHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.service.GetSettings(r.Context(), actor)
+	if err != nil {
+		log.Printf("[PayoutHandler.GetSettings] error: %v", err)
+		writePayoutError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings handles PUT /api/schools/my/payout-settings
+func (h *PayoutHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req domain.PayoutSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.service.UpdateSettings(r.Context(), actor, req)
+	if err != nil {
+		log.Printf("[PayoutHandler.UpdateSettings] error: %v", err)
+		writePayoutError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(settings)
+}
+
+// ListStatements handles GET /api/payouts?period=YYYY-MM
+func (h *PayoutHandler) ListStatements(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	statements, err := h.service.ListStatements(r.Context(), actor, r.URL.Query().Get("period"))
+	if err != nil {
+		log.Printf("[PayoutHandler.ListStatements] error: %v", err)
+		writePayoutError(w, err)
+		return
+	}
+	if statements == nil {
+		statements = []domain.PayoutStatement{}
+	}
+	json.NewEncoder(w).Encode(statements)
+}
+
+// MarkPaid handles POST /api/payouts/{id}/mark-paid
+func (h *PayoutHandler) MarkPaid(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Reference string `json:"reference"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	statement, err := h.service.MarkPaid(r.Context(), actor, chi.URLParam(r, "id"), req.Reference)
+	if err != nil {
+		log.Printf("[PayoutHandler.MarkPaid] error: %v", err)
+		writePayoutError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(statement)
+}
+
+// MyEarnings handles GET /api/my-earnings
+func (h *PayoutHandler) MyEarnings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	earnings, err := h.service.MyEarnings(r.Context(), actor)
+	if err != nil {
+		log.Printf("[PayoutHandler.MyEarnings] error: %v", err)
+		writePayoutError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(earnings)
+}
+
+// writePayoutError maps payout service errors onto HTTP statuses.
+func writePayoutError(w http.ResponseWriter, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrPayoutStatementPaid), errors.Is(err, service.ErrNoExchangeRate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
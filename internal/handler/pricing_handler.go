@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type PricingHandler struct {
+	service *service.PricingService
+}
+
+func NewPricingHandler(s *service.PricingService) *PricingHandler {
+	return &PricingHandler{service: s}
+}
+
+// GetPrice handles GET /api/courses/{id}/price?promo_code=
+func (h *PricingHandler) GetPrice(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	quote, err := h.service.Quote(r.Context(), userID, chi.URLParam(r, "id"), r.URL.Query().Get("promo_code"))
+	if err != nil {
+		log.Printf("[PricingHandler.GetPrice] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(quote)
+}
+
+// ApplyPromoCode handles POST /api/courses/{id}/promo-code
+func (h *PricingHandler) ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.service.ApplyPromoCode(r.Context(), userID, chi.URLParam(r, "id"), req.Code)
+	if err != nil {
+		log.Printf("[PricingHandler.ApplyPromoCode] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(quote)
+}
+
+// CreatePromoCode handles POST /api/promo-codes
+func (h *PricingHandler) CreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input service.PromoCodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	promo, err := h.service.CreatePromoCode(r.Context(), actor, input)
+	if err != nil {
+		log.Printf("[PricingHandler.CreatePromoCode] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promo)
+}
+
+// ListPromoCodes handles GET /api/promo-codes
+func (h *PricingHandler) ListPromoCodes(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := h.service.ListPromoCodes(r.Context(), actor)
+	if err != nil {
+		log.Printf("[PricingHandler.ListPromoCodes] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	if codes == nil {
+		codes = []domain.PromoCode{}
+	}
+	json.NewEncoder(w).Encode(codes)
+}
+
+// DeactivatePromoCode handles DELETE /api/promo-codes/{id}
+func (h *PricingHandler) DeactivatePromoCode(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeactivatePromoCode(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		log.Printf("[PricingHandler.DeactivatePromoCode] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateScholarship handles POST /api/scholarships
+func (h *PricingHandler) CreateScholarship(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input service.ScholarshipInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	scholarship, err := h.service.CreateScholarship(r.Context(), actor, input)
+	if err != nil {
+		log.Printf("[PricingHandler.CreateScholarship] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(scholarship)
+}
+
+// ListScholarships handles GET /api/scholarships
+func (h *PricingHandler) ListScholarships(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scholarships, err := h.service.ListScholarships(r.Context(), actor)
+	if err != nil {
+		log.Printf("[PricingHandler.ListScholarships] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	if scholarships == nil {
+		scholarships = []domain.Scholarship{}
+	}
+	json.NewEncoder(w).Encode(scholarships)
+}
+
+// DeleteScholarship handles DELETE /api/scholarships/{id}
+func (h *PricingHandler) DeleteScholarship(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeleteScholarship(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		log.Printf("[PricingHandler.DeleteScholarship] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetSiblingDiscount handles PUT /api/schools/my/sibling-discount
+func (h *PricingHandler) SetSiblingDiscount(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Percent float64 `json:"percent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetSiblingDiscount(r.Context(), actor, req.Percent); err != nil {
+		log.Printf("[PricingHandler.SetSiblingDiscount] error: %v", err)
+		writePricingError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]float64{"percent": req.Percent})
+}
+
+// writePricingError maps pricing service errors onto HTTP statuses.
+func writePricingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, repository.ErrCourseNotFound), errors.Is(err, repository.ErrSchoolNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrPricingForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrPromoCodeTaken), errors.Is(err, repository.ErrPromoCodeExhausted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schooltj/internal/service"
+)
+
+// fakeLimiter answers every Take with its fields and records the keys asked for.
+type fakeLimiter struct {
+	allowed    bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (f *fakeLimiter) Take(ctx context.Context, key string, limit service.RateLimit) (bool, time.Duration, error) {
+	f.keys = append(f.keys, key)
+	return f.allowed, f.retryAfter, f.err
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		limiter        *fakeLimiter
+		key            string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"tokens left", &fakeLimiter{allowed: true}, "203.0.113.7", http.StatusOK, ""},
+		{"bucket empty", &fakeLimiter{retryAfter: 2500 * time.Millisecond}, "203.0.113.7", http.StatusTooManyRequests, "3"},
+		{"next token due at once", &fakeLimiter{retryAfter: time.Millisecond}, "203.0.113.7", http.StatusTooManyRequests, "1"},
+		// A broken limiter must not lock everyone out.
+		{"limiter failing", &fakeLimiter{err: errors.New("db down")}, "203.0.113.7", http.StatusOK, ""},
+		{"no key", &fakeLimiter{}, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			limit := service.RateLimit{Requests: 10, Per: time.Minute}
+			h := RateLimitMiddleware(tt.limiter, "login-ip", limit, func(*http.Request) string { return tt.key })(next)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Fatalf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if tt.key == "" && len(tt.limiter.keys) != 0 {
+				t.Fatalf("limiter asked for %v, want nothing", tt.limiter.keys)
+			}
+			if tt.key != "" && (len(tt.limiter.keys) != 1 || tt.limiter.keys[0] != "login-ip:"+tt.key) {
+				t.Fatalf("limiter asked for %v, want [login-ip:%s]", tt.limiter.keys, tt.key)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareWithMemoryLimiter(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RateLimitMiddleware(service.NewMemoryRateLimiter(), "login-ip", service.RateLimit{Requests: 2, Per: time.Minute}, ClientIPKey)(next)
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.RemoteAddr = "203.0.113.7:4321"
+		h.ServeHTTP(rec, r)
+		codes = append(codes, rec.Code)
+		if i == 2 && rec.Header().Get("Retry-After") != "30" {
+			t.Fatalf("Retry-After = %q, want 30", rec.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("statuses %v, want [200 200 429]", codes)
+	}
+}
+
+func TestLoginAccountKey(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"email":" Teacher@Example.com "}`, "teacher@example.com"},
+		// However a number is written, in either field, it is the same account.
+		{`{"email":"+992 90 123 4567"}`, "+992901234567"},
+		{`{"email":"90-123-45-67"}`, "+992901234567"},
+		{`{"email":"00992901234567"}`, "+992901234567"},
+		{`{"phone":"(90) 123 45 67"}`, "+992901234567"},
+		{`{"email":"","phone":"+992901234567"}`, "+992901234567"},
+		{`{"email":"Not A Number"}`, "not a number"},
+		{`{}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(tt.body))
+		if got := LoginAccountKey(r); got != tt.want {
+			t.Errorf("LoginAccountKey(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+		// The handler still gets the whole body.
+		if body, _ := io.ReadAll(r.Body); string(body) != tt.body {
+			t.Errorf("body left = %q, want %q", body, tt.body)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/schooltj/internal/domain"
@@ -21,47 +23,352 @@ func NewSchoolHandler(s *service.SchoolService, sr *repository.SchoolRepository,
 	return &SchoolHandler{service: s, schoolRepo: sr, courseRepo: cr}
 }
 
-type addTeacherRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Bio      string `json:"bio"`
+type inviteTeacherRequest struct {
+	Email string `json:"email"`
+	Bio   string `json:"bio"`
 }
 
+// teacherInvitationError writes the response for an error from inviting or removing teachers.
+func teacherInvitationError(w http.ResponseWriter, method string, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrTeacherInviteNotFound), errors.Is(err, repository.ErrTeacherNotInSchool):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTeacherEmailRequired), errors.Is(err, repository.ErrTeacherInviteInvalid),
+		errors.Is(err, service.ErrPasswordTooShort):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrNotTeacherAccount), errors.Is(err, service.ErrInvitationForOtherUser):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrInviteeNotTeacher), errors.Is(err, repository.ErrTeacherInvitationPending),
+		errors.Is(err, repository.ErrTeacherAlreadyInSchool), errors.Is(err, repository.ErrTeacherAtAnotherSchool),
+		errors.Is(err, service.ErrEmailAlreadyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[SchoolHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// AddTeacher handles POST /api/schools/teachers, inviting a teacher to the caller's school.
 func (h *SchoolHandler) AddTeacher(w http.ResponseWriter, r *http.Request) {
-	adminID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var req addTeacherRequest
+	var req inviteTeacherRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	user, err := h.service.AddTeacherToSchool(r.Context(), adminID, req.Email, req.Password, req.Bio)
+	inv, err := h.service.InviteTeacherToMySchool(r.Context(), actor, req.Email, req.Bio)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		teacherInvitationError(w, "AddTeacher", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
+
+// InviteTeacher handles POST /api/schools/{id}/teacher-invitations
+func (h *SchoolHandler) InviteTeacher(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req inviteTeacherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.service.InviteTeacher(r.Context(), actor, chi.URLParam(r, "id"), req.Email, req.Bio)
+	if err != nil {
+		teacherInvitationError(w, "InviteTeacher", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
+
+// ListTeacherInvitations handles GET /api/schools/{id}/teacher-invitations
+func (h *SchoolHandler) ListTeacherInvitations(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	invitations, err := h.service.ListTeacherInvitations(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		teacherInvitationError(w, "ListTeacherInvitations", err)
+		return
+	}
+	if invitations == nil {
+		invitations = []domain.TeacherInvitation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// ResendTeacherInvitation handles POST /api/teacher-invitations/{id}/resend
+func (h *SchoolHandler) ResendTeacherInvitation(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	inv, err := h.service.ResendTeacherInvitation(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		teacherInvitationError(w, "ResendTeacherInvitation", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inv)
+}
+
+// RevokeTeacherInvitation handles DELETE /api/teacher-invitations/{id}
+func (h *SchoolHandler) RevokeTeacherInvitation(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.RevokeTeacherInvitation(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		teacherInvitationError(w, "RevokeTeacherInvitation", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LookupTeacherInvitation handles GET /api/teacher-invitations/lookup?token=
+func (h *SchoolHandler) LookupTeacherInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, hasAccount, err := h.service.LookupTeacherInvitation(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		teacherInvitationError(w, "LookupTeacherInvitation", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"school_id":   inv.SchoolID,
+		"school_name": inv.SchoolName,
+		"email":       inv.Email,
+		"expires_at":  inv.ExpiresAt,
+		"has_account": hasAccount,
+	})
+}
+
+// AcceptTeacherInvitation handles POST /api/teacher-invitations/accept
+func (h *SchoolHandler) AcceptTeacherInvitation(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	inv, err := h.service.AcceptTeacherInvitation(r.Context(), actor, req.Token)
+	if err != nil {
+		teacherInvitationError(w, "AcceptTeacherInvitation", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inv)
+}
+
+// RegisterInvitedTeacher handles POST /api/teacher-invitations/register, creating the
+// account of an invited teacher who has none. They sign in afterwards as usual.
+func (h *SchoolHandler) RegisterInvitedTeacher(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	user, err := h.service.RegisterInvitedTeacher(r.Context(), req.Token, req.Name, req.Password)
+	if err != nil {
+		teacherInvitationError(w, "RegisterInvitedTeacher", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
 
+// RemoveTeacher handles DELETE /api/schools/{id}/teachers/{teacherId}
+func (h *SchoolHandler) RemoveTeacher(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.RemoveTeacher(r.Context(), actor, chi.URLParam(r, "id"), chi.URLParam(r, "teacherId")); err != nil {
+		teacherInvitationError(w, "RemoveTeacher", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// schoolMemberError writes the response for an error from managing a school's staff.
+func schoolMemberError(w http.ResponseWriter, method string, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrStaffEmailRequired), errors.Is(err, service.ErrInvalidStaffRole),
+		errors.Is(err, service.ErrBranchRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrSchoolOwnerFixed), errors.Is(err, service.ErrOwnerManagesAdmins):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrNotStaffAccount), errors.Is(err, repository.ErrAlreadySchoolStaff),
+		errors.Is(err, service.ErrEmailAlreadyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[SchoolHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// MyMembership handles GET /api/schools/my/membership
+func (h *SchoolHandler) MyMembership(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	member, err := h.service.MyMembership(r.Context(), actor)
+	if err != nil {
+		schoolMemberError(w, "MyMembership", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// ListMembers handles GET /api/schools/{id}/members
+func (h *SchoolHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	members, err := h.service.ListMembers(r.Context(), actor, chi.URLParam(r, "id"))
+	if err != nil {
+		schoolMemberError(w, "ListMembers", err)
+		return
+	}
+	if members == nil {
+		members = []domain.SchoolMember{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddMember handles POST /api/schools/{id}/members. An email without an account gets a
+// staff account and a link to choose its password.
+func (h *SchoolHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Email    string            `json:"email"`
+		Name     string            `json:"name"`
+		Role     domain.SchoolRole `json:"role"`
+		BranchID *string           `json:"branch_id"` // required for a branch_manager
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.AddMember(r.Context(), actor, chi.URLParam(r, "id"), req.Email, req.Name, req.Role, req.BranchID)
+	if err != nil {
+		schoolMemberError(w, "AddMember", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+// UpdateMember handles PUT /api/schools/{id}/members/{userId}
+func (h *SchoolHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Role     domain.SchoolRole `json:"role"`
+		BranchID *string           `json:"branch_id"` // required for a branch_manager
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.UpdateMemberRole(r.Context(), actor, chi.URLParam(r, "id"), chi.URLParam(r, "userId"), req.Role, req.BranchID)
+	if err != nil {
+		schoolMemberError(w, "UpdateMember", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// RemoveMember handles DELETE /api/schools/{id}/members/{userId}
+func (h *SchoolHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.RemoveMember(r.Context(), actor, chi.URLParam(r, "id"), chi.URLParam(r, "userId")); err != nil {
+		schoolMemberError(w, "RemoveMember", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *SchoolHandler) ListTeachers(w http.ResponseWriter, r *http.Request) {
-	adminID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	teachers, err := h.service.ListTeachers(r.Context(), adminID)
+	teachers, err := h.service.ListTeachers(r.Context(), actor, r.URL.Query().Get("branch_id"))
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[SchoolHandler.ListTeachers] error: %v", err)
 		http.Error(w, "failed to fetch teachers", http.StatusInternalServerError)
 		return
 	}
+	if teachers == nil {
+		teachers = []domain.User{}
+	}
 
 	json.NewEncoder(w).Encode(teachers)
 }
@@ -91,7 +398,7 @@ func (h *SchoolHandler) GetSchoolDetail(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	teachers, _ := h.schoolRepo.ListTeachers(r.Context(), id)
+	teachers, _ := h.schoolRepo.ListTeachers(r.Context(), id, "")
 	if teachers == nil {
 		teachers = []domain.User{}
 	}
@@ -113,28 +420,34 @@ func (h *SchoolHandler) GetSchoolDetail(w http.ResponseWriter, r *http.Request)
 
 // UpdateSchool handles PUT /api/schools/my
 func (h *SchoolHandler) UpdateSchool(w http.ResponseWriter, r *http.Request) {
-	adminID, ok := r.Context().Value(UserContextKey).(string)
+	actor, ok := actorFrom(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	school, err := h.schoolRepo.GetSchoolByAdminID(r.Context(), adminID)
+	school, err := h.service.MySchool(r.Context(), actor, service.ActionManageSchool)
 	if err != nil {
-		http.Error(w, "school not found", http.StatusNotFound)
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[SchoolHandler.UpdateSchool] error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Phone       string `json:"phone"`
-		Email       string `json:"email"`
-		Address     string `json:"address"`
-		City        string `json:"city"`
-		Website     string `json:"website"`
-		LogoURL     string `json:"logo_url"`
-		TaxID       string `json:"tax_id"`
+		Name              string `json:"name"`
+		Description       string `json:"description"`
+		Phone             string `json:"phone"`
+		Email             string `json:"email"`
+		Address           string `json:"address"`
+		City              string `json:"city"`
+		Website           string `json:"website"`
+		LogoURL           string `json:"logo_url"`
+		TaxID             string `json:"tax_id"`
+		ReportingCurrency string `json:"reporting_currency"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -154,6 +467,13 @@ func (h *SchoolHandler) UpdateSchool(w http.ResponseWriter, r *http.Request) {
 	if req.TaxID != "" {
 		school.TaxID = req.TaxID
 	}
+	if req.ReportingCurrency != "" {
+		if !domain.SupportedCurrencies[strings.ToUpper(req.ReportingCurrency)] {
+			http.Error(w, "unsupported reporting currency", http.StatusBadRequest)
+			return
+		}
+		school.ReportingCurrency = strings.ToUpper(req.ReportingCurrency)
+	}
 
 	if err := h.schoolRepo.UpdateSchool(r.Context(), school); err != nil {
 		log.Printf("[SchoolHandler.UpdateSchool] error: %v", err)
@@ -177,15 +497,16 @@ func (h *SchoolHandler) UpdateSchoolByID(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Phone       string `json:"phone"`
-		Email       string `json:"email"`
-		Address     string `json:"address"`
-		City        string `json:"city"`
-		Website     string `json:"website"`
-		LogoURL     string `json:"logo_url"`
-		TaxID       string `json:"tax_id"`
+		Name              string `json:"name"`
+		Description       string `json:"description"`
+		Phone             string `json:"phone"`
+		Email             string `json:"email"`
+		Address           string `json:"address"`
+		City              string `json:"city"`
+		Website           string `json:"website"`
+		LogoURL           string `json:"logo_url"`
+		TaxID             string `json:"tax_id"`
+		ReportingCurrency string `json:"reporting_currency"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -193,19 +514,24 @@ func (h *SchoolHandler) UpdateSchoolByID(w http.ResponseWriter, r *http.Request)
 	}
 
 	updates := &domain.School{
-		Name:        req.Name,
-		Description: req.Description,
-		Phone:       req.Phone,
-		Email:       req.Email,
-		Address:     req.Address,
-		City:        req.City,
-		Website:     req.Website,
-		LogoURL:     req.LogoURL,
-		TaxID:       req.TaxID,
+		Name:              req.Name,
+		Description:       req.Description,
+		Phone:             req.Phone,
+		Email:             req.Email,
+		Address:           req.Address,
+		City:              req.City,
+		Website:           req.Website,
+		LogoURL:           req.LogoURL,
+		TaxID:             req.TaxID,
+		ReportingCurrency: strings.ToUpper(req.ReportingCurrency),
 	}
 
 	school, err := h.service.UpdateSchoolByID(r.Context(), userID, role, schoolID, updates)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[SchoolHandler.UpdateSchoolByID] error: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -227,6 +553,10 @@ func (h *SchoolHandler) DeleteSchool(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.DeleteSchool(r.Context(), userID, role, schoolID); err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
 		log.Printf("[SchoolHandler.DeleteSchool] error: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
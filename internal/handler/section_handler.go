@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type SectionHandler struct {
+	service *service.SectionService
+}
+
+func NewSectionHandler(s *service.SectionService) *SectionHandler {
+	return &SectionHandler{service: s}
+}
+
+// sectionError writes the response for an error from managing course sections.
+func sectionError(w http.ResponseWriter, method string, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrSectionNameRequired), errors.Is(err, service.ErrInvalidMaxStudents),
+		errors.Is(err, service.ErrIndependentSectionTeacher):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrTeacherNotInSchool):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrSectionNameTaken), errors.Is(err, repository.ErrSectionFull):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[SectionHandler.%s] error: %v", method, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ListSections handles GET /api/courses/{id}/sections
+func (h *SectionHandler) ListSections(w http.ResponseWriter, r *http.Request) {
+	sections, err := h.service.ListSections(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		sectionError(w, "ListSections", err)
+		return
+	}
+	if sections == nil {
+		sections = []domain.CourseSection{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sections)
+}
+
+// CreateSection handles POST /api/courses/{id}/sections
+func (h *SectionHandler) CreateSection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req service.SectionInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	section, err := h.service.CreateSection(r.Context(), actor, chi.URLParam(r, "id"), req)
+	if err != nil {
+		sectionError(w, "CreateSection", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(section)
+}
+
+// UpdateSection handles PUT /api/sections/{id}
+func (h *SectionHandler) UpdateSection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req service.SectionInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	section, err := h.service.UpdateSection(r.Context(), actor, chi.URLParam(r, "id"), req)
+	if err != nil {
+		sectionError(w, "UpdateSection", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(section)
+}
+
+// DeleteSection handles DELETE /api/sections/{id}
+func (h *SectionHandler) DeleteSection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.service.DeleteSection(r.Context(), actor, chi.URLParam(r, "id")); err != nil {
+		sectionError(w, "DeleteSection", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetEnrollmentSection handles PUT /api/enrollments/{id}/section. A null section_id takes
+// the student out of their section.
+func (h *SectionHandler) SetEnrollmentSection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		SectionID *string `json:"section_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	enrollment, err := h.service.SetEnrollmentSection(r.Context(), actor, chi.URLParam(r, "id"), req.SectionID)
+	if err != nil {
+		sectionError(w, "SetEnrollmentSection", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
@@ -40,7 +40,8 @@ func (h *SettingsHandler) ChangePassword(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.authService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword); err != nil {
+	sessionID, _ := r.Context().Value(SessionContextKey).(string)
+	if err := h.authService.ChangePassword(r.Context(), userID, sessionID, req.CurrentPassword, req.NewPassword); err != nil {
 		log.Printf("[SettingsHandler.ChangePassword] error: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
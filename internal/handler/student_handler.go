@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -62,6 +63,11 @@ func (h *StudentHandler) ListMyStudents(w http.ResponseWriter, r *http.Request)
 
 	students, err := h.service.GetMyStudents(r.Context(), userID, role)
 	if err != nil {
+		if status := accessErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("[StudentHandler.ListMyStudents] error: %v", err)
 		http.Error(w, "failed to fetch my students", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/schooltj/internal/repository"
+	"github.com/schooltj/internal/service"
+)
+
+type TwoFactorHandler struct {
+	service *service.TwoFactorService
+}
+
+func NewTwoFactorHandler(s *service.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{service: s}
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Status handles GET /api/auth/2fa
+func (h *TwoFactorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.service.Status(r.Context(), userID)
+	if err != nil {
+		log.Printf("[TwoFactorHandler.Status] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// Setup handles POST /api/auth/2fa/setup
+func (h *TwoFactorHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.service.BeginSetup(r.Context(), userID)
+	if err != nil {
+		log.Printf("[TwoFactorHandler.Setup] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// Enable handles POST /api/auth/2fa/enable
+// The recovery codes in the response are shown once. Clients that were asked to set up
+// two-factor authentication should refresh their token afterwards.
+func (h *TwoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.service.Enable(r.Context(), userID, req.Code)
+	if err != nil {
+		log.Printf("[TwoFactorHandler.Enable] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// Disable handles POST /api/auth/2fa/disable
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Disable(r.Context(), userID, req.Password, req.Code); err != nil {
+		log.Printf("[TwoFactorHandler.Disable] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes handles POST /api/auth/2fa/recovery-codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		log.Printf("[TwoFactorHandler.RegenerateRecoveryCodes] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+type twoFactorPolicy struct {
+	RequireTeacher2FA bool `json:"require_teacher_2fa"`
+}
+
+// GetSchoolPolicy handles GET /api/schools/my/two-factor-policy
+func (h *TwoFactorHandler) GetSchoolPolicy(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	required, err := h.service.GetSchoolPolicy(r.Context(), actor)
+	if err != nil {
+		log.Printf("[TwoFactorHandler.GetSchoolPolicy] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(twoFactorPolicy{RequireTeacher2FA: required})
+}
+
+// SetSchoolPolicy handles PUT /api/schools/my/two-factor-policy
+func (h *TwoFactorHandler) SetSchoolPolicy(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetSchoolPolicy(r.Context(), actor, req.RequireTeacher2FA); err != nil {
+		log.Printf("[TwoFactorHandler.SetSchoolPolicy] error: %v", err)
+		writeTwoFactorError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(req)
+}
+
+// writeTwoFactorError maps two-factor service errors onto HTTP statuses.
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	if status := accessErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, repository.ErrUserNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrInvalidCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, service.ErrTwoFactorEnforced):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, repository.ErrTwoFactorAlreadyEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrTwoFactorNotStarted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
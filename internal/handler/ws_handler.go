@@ -6,7 +6,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 	"github.com/schooltj/internal/service"
 )
@@ -135,11 +134,11 @@ func (c *Client) readPump() {
 // WSHandler handles the WebSocket upgrade for real-time messaging.
 type WSHandler struct {
 	messageService *service.MessageService
-	jwtSecret      string
+	authService    *service.AuthService
 }
 
-func NewWSHandler(ms *service.MessageService, jwtSecret string) *WSHandler {
-	return &WSHandler{messageService: ms, jwtSecret: jwtSecret}
+func NewWSHandler(ms *service.MessageService, as *service.AuthService) *WSHandler {
+	return &WSHandler{messageService: ms, authService: as}
 }
 
 // Stream handles GET /api/ws  — upgraded to WebSockets
@@ -149,13 +148,8 @@ func (h *WSHandler) Stream(w http.ResponseWriter, r *http.Request) {
 	tokenStr := r.URL.Query().Get("token")
 	userID := ""
 	if tokenStr != "" {
-		tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return []byte(h.jwtSecret), nil
-		}, jwt.WithValidMethods([]string{"HS256"}))
-		if err == nil && tok.Valid {
-			if claims, ok := tok.Claims.(jwt.MapClaims); ok {
-				userID, _ = claims["sub"].(string)
-			}
+		if claims, err := h.authService.VerifyToken(r.Context(), tokenStr); err == nil {
+			userID, _ = claims["sub"].(string)
 		}
 	}
 	if userID == "" {
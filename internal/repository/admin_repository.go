@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/schooltj/internal/domain"
+)
+
+// AdminRepository answers platform-wide questions for the admin console.
+type AdminRepository struct {
+	DB *sql.DB
+}
+
+func NewAdminRepository(db *sql.DB) *AdminRepository {
+	return &AdminRepository{DB: db}
+}
+
+// PlatformMetrics counts users, schools, courses, enrollments, payments and ratings
+// across the platform. Revenue is settled payments less refunds over the last 30 days, in
+// the base currency.
+func (r *AdminRepository) PlatformMetrics(ctx context.Context) (*domain.PlatformMetrics, error) {
+	m := &domain.PlatformMetrics{UsersByRole: map[domain.Role]int{}, Currency: domain.BaseCurrency}
+
+	rows, err := r.DB.QueryContext(ctx, `SELECT role, COUNT(*) FROM users GROUP BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role domain.Role
+		var n int
+		if err := rows.Scan(&role, &n); err != nil {
+			return nil, err
+		}
+		m.UsersByRole[role] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = r.DB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE created_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)),
+			(SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL),
+			(SELECT COUNT(*) FROM schools),
+			(SELECT COUNT(*) FROM schools WHERE NOT is_verified),
+			(SELECT COUNT(*) FROM courses),
+			(SELECT COUNT(*) FROM enrollments WHERE status = 'active'),
+			(SELECT COUNT(*) FROM enrollments WHERE status = 'pending'),
+			(SELECT COALESCE(SUM((amount - refunded_amount) * exchange_rate), 0) FROM payments
+			 WHERE status IN ('success', 'partially_refunded', 'refunded') AND paid_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)),
+			(SELECT COUNT(*) FROM payments WHERE status = 'pending'),
+			(SELECT COUNT(*) FROM ratings WHERE hidden_at IS NOT NULL)`).
+		Scan(&m.NewUsers30d, &m.SuspendedUsers, &m.Schools, &m.UnverifiedSchools, &m.Courses, &m.ActiveEnrollments,
+			&m.PendingEnrollments, &m.Revenue30d, &m.PendingPayments, &m.HiddenRatings)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
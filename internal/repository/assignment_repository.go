@@ -18,18 +18,20 @@ func NewAssignmentRepository(db *sql.DB) *AssignmentRepository {
 
 func (r *AssignmentRepository) Create(ctx context.Context, a *domain.Assignment) error {
 	a.ID = uuid.New().String()
-	query := `INSERT INTO assignments (id, course_id, title, description, due_date, max_score, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := r.DB.ExecContext(ctx, query, a.ID, a.CourseID, a.Title, a.Description, a.DueDate, a.MaxScore, a.CreatedBy)
+	query := `INSERT INTO assignments (id, course_id, section_id, title, description, due_date, max_score, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, a.ID, a.CourseID, a.SectionID, a.Title, a.Description, a.DueDate, a.MaxScore, a.CreatedBy)
 	return err
 }
 
-func (r *AssignmentRepository) ListByCourse(ctx context.Context, courseID string) ([]domain.Assignment, error) {
-	query := `SELECT a.id, a.course_id, COALESCE(c.title, '') as course_title, a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
+// ListByCourse returns the course's assignments. When sectionID is set it returns only those
+// for the whole course and for that section; an empty sectionID means the whole course's.
+func (r *AssignmentRepository) ListByCourse(ctx context.Context, courseID string, sectionID *string) ([]domain.Assignment, error) {
+	query := `SELECT a.id, a.course_id, a.section_id, COALESCE(c.title, '') as course_title, a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
 		FROM assignments a
 		JOIN courses c ON a.course_id = c.id
-		WHERE a.course_id = ?
+		WHERE a.course_id = ? AND (? IS NULL OR a.section_id IS NULL OR a.section_id = ?)
 		ORDER BY a.created_at DESC`
-	rows, err := r.DB.QueryContext(ctx, query, courseID)
+	rows, err := r.DB.QueryContext(ctx, query, courseID, sectionID, sectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +39,7 @@ func (r *AssignmentRepository) ListByCourse(ctx context.Context, courseID string
 	var assignments []domain.Assignment
 	for rows.Next() {
 		var a domain.Assignment
-		if err := rows.Scan(&a.ID, &a.CourseID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.CourseID, &a.SectionID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
 			return nil, err
 		}
 		assignments = append(assignments, a)
@@ -46,10 +48,11 @@ func (r *AssignmentRepository) ListByCourse(ctx context.Context, courseID string
 }
 
 func (r *AssignmentRepository) ListForStudent(ctx context.Context, studentID string) ([]domain.Assignment, error) {
-	query := `SELECT a.id, a.course_id, COALESCE(c.title, '') as course_title, a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
+	query := `SELECT a.id, a.course_id, a.section_id, COALESCE(c.title, '') as course_title, a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
 		FROM assignments a
 		JOIN courses c ON a.course_id = c.id
 		JOIN enrollments e ON e.course_id = a.course_id AND e.student_user_id = ? AND e.status = 'active'
+		WHERE a.section_id IS NULL OR a.section_id = e.section_id
 		ORDER BY a.due_date ASC, a.created_at DESC`
 	rows, err := r.DB.QueryContext(ctx, query, studentID)
 	if err != nil {
@@ -59,7 +62,7 @@ func (r *AssignmentRepository) ListForStudent(ctx context.Context, studentID str
 	var assignments []domain.Assignment
 	for rows.Next() {
 		var a domain.Assignment
-		if err := rows.Scan(&a.ID, &a.CourseID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.CourseID, &a.SectionID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
 			return nil, err
 		}
 		assignments = append(assignments, a)
@@ -68,12 +71,12 @@ func (r *AssignmentRepository) ListForStudent(ctx context.Context, studentID str
 }
 
 func (r *AssignmentRepository) GetByID(ctx context.Context, id string) (*domain.Assignment, error) {
-	query := `SELECT a.id, a.course_id, COALESCE(c.title, ''), a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
+	query := `SELECT a.id, a.course_id, a.section_id, COALESCE(c.title, ''), a.title, COALESCE(a.description, ''), a.due_date, a.max_score, a.created_by, a.created_at, a.updated_at
 		FROM assignments a
 		JOIN courses c ON a.course_id = c.id
 		WHERE a.id = ?`
 	var a domain.Assignment
-	err := r.DB.QueryRowContext(ctx, query, id).Scan(&a.ID, &a.CourseID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&a.ID, &a.CourseID, &a.SectionID, &a.CourseTitle, &a.Title, &a.Description, &a.DueDate, &a.MaxScore, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -94,13 +97,29 @@ func (r *AssignmentRepository) GradeSubmission(ctx context.Context, submissionID
 	return err
 }
 
-func (r *AssignmentRepository) ListSubmissions(ctx context.Context, assignmentID string) ([]domain.Submission, error) {
+// GetSubmissionCourse returns the course a submission was handed in to and the section it
+// belongs to: the assignment's, or else the student's. The section is empty if neither has one.
+func (r *AssignmentRepository) GetSubmissionCourse(ctx context.Context, submissionID string) (courseID, sectionID string, err error) {
+	err = r.DB.QueryRowContext(ctx, `
+		SELECT a.course_id, COALESCE(a.section_id, e.section_id, '')
+		FROM submissions s
+		JOIN assignments a ON s.assignment_id = a.id
+		LEFT JOIN enrollments e ON e.course_id = a.course_id AND e.student_user_id = s.student_user_id
+		WHERE s.id = ?`, submissionID).Scan(&courseID, &sectionID)
+	return courseID, sectionID, err
+}
+
+// ListSubmissions returns the work handed in for an assignment, or only that of one
+// section's students when sectionID is set.
+func (r *AssignmentRepository) ListSubmissions(ctx context.Context, assignmentID, sectionID string) ([]domain.Submission, error) {
 	query := `SELECT s.id, s.assignment_id, s.student_user_id, COALESCE(u.name, u.email) as student_name, u.avatar_url as student_avatar, COALESCE(s.content, ''), COALESCE(s.link, ''), s.score, COALESCE(s.feedback, ''), s.submitted_at, s.graded_at
 		FROM submissions s
 		JOIN users u ON s.student_user_id = u.id
-		WHERE s.assignment_id = ?
+		JOIN assignments a ON s.assignment_id = a.id
+		LEFT JOIN enrollments e ON e.course_id = a.course_id AND e.student_user_id = s.student_user_id
+		WHERE s.assignment_id = ? AND (? = '' OR e.section_id = ?)
 		ORDER BY s.submitted_at DESC`
-	rows, err := r.DB.QueryContext(ctx, query, assignmentID)
+	rows, err := r.DB.QueryContext(ctx, query, assignmentID, sectionID, sectionID)
 	if err != nil {
 		return nil, err
 	}
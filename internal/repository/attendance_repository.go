@@ -22,25 +22,26 @@ func (r *AttendanceRepository) MarkAttendance(ctx context.Context, a *domain.Att
 		a.ID = uuid.New().String()
 	}
 	query := `
-		INSERT INTO attendance (id, enrollment_id, course_id, student_user_id, date, status, note, marked_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE status = VALUES(status), note = VALUES(note), marked_by = VALUES(marked_by)
+		INSERT INTO attendance (id, enrollment_id, course_id, section_id, student_user_id, date, status, note, marked_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE status = VALUES(status), note = VALUES(note), marked_by = VALUES(marked_by), section_id = VALUES(section_id)
 	`
-	_, err := r.DB.ExecContext(ctx, query, a.ID, a.EnrollmentID, a.CourseID, a.StudentUserID, a.Date, a.Status, a.Note, a.MarkedBy)
+	_, err := r.DB.ExecContext(ctx, query, a.ID, a.EnrollmentID, a.CourseID, a.SectionID, a.StudentUserID, a.Date, a.Status, a.Note, a.MarkedBy)
 	return err
 }
 
-// GetByCourseAndDate returns attendance for all enrolled students on a specific date.
-func (r *AttendanceRepository) GetByCourseAndDate(ctx context.Context, courseID, date string) ([]domain.Attendance, error) {
+// GetByCourseAndDate returns attendance for all enrolled students on a specific date, or
+// only for one section's session when sectionID is set.
+func (r *AttendanceRepository) GetByCourseAndDate(ctx context.Context, courseID, sectionID, date string) ([]domain.Attendance, error) {
 	query := `
-		SELECT a.id, a.enrollment_id, a.course_id, a.student_user_id, a.date, a.status, COALESCE(a.note,''), a.marked_by, a.created_at,
+		SELECT a.id, a.enrollment_id, a.course_id, a.section_id, a.student_user_id, a.date, a.status, COALESCE(a.note,''), a.marked_by, a.created_at,
 		       COALESCE(u.name, u.email) as student_name, u.avatar_url as student_avatar
 		FROM attendance a
 		JOIN users u ON a.student_user_id = u.id
-		WHERE a.course_id = ? AND a.date = ?
+		WHERE a.course_id = ? AND a.date = ? AND (? = '' OR a.section_id = ?)
 		ORDER BY u.name
 	`
-	rows, err := r.DB.QueryContext(ctx, query, courseID, date)
+	rows, err := r.DB.QueryContext(ctx, query, courseID, date, sectionID, sectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +51,7 @@ func (r *AttendanceRepository) GetByCourseAndDate(ctx context.Context, courseID,
 	for rows.Next() {
 		var a domain.Attendance
 		var avatarURL sql.NullString
-		if err := rows.Scan(&a.ID, &a.EnrollmentID, &a.CourseID, &a.StudentUserID, &a.Date, &a.Status, &a.Note, &a.MarkedBy, &a.CreatedAt, &a.StudentName, &avatarURL); err != nil {
+		if err := rows.Scan(&a.ID, &a.EnrollmentID, &a.CourseID, &a.SectionID, &a.StudentUserID, &a.Date, &a.Status, &a.Note, &a.MarkedBy, &a.CreatedAt, &a.StudentName, &avatarURL); err != nil {
 			return nil, err
 		}
 		if avatarURL.Valid {
@@ -159,8 +160,9 @@ func (r *AttendanceRepository) GetCourseAttendanceSummary(ctx context.Context, c
 	return summaries, nil
 }
 
-// GetEnrolledStudentsForCourse returns student info for all active enrollments in a course.
-func (r *AttendanceRepository) GetEnrolledStudentsForCourse(ctx context.Context, courseID string) ([]struct {
+// GetEnrolledStudentsForCourse returns student info for all active enrollments in a course,
+// or in one of its sections when sectionID is set.
+func (r *AttendanceRepository) GetEnrolledStudentsForCourse(ctx context.Context, courseID, sectionID string) ([]struct {
 	EnrollmentID  string
 	StudentUserID string
 	StudentName   string
@@ -169,10 +171,10 @@ func (r *AttendanceRepository) GetEnrolledStudentsForCourse(ctx context.Context,
 		SELECT e.id, e.student_user_id, COALESCE(u.name, u.email) as student_name
 		FROM enrollments e
 		JOIN users u ON e.student_user_id = u.id
-		WHERE e.course_id = ? AND e.status = 'active'
+		WHERE e.course_id = ? AND e.status = 'active' AND (? = '' OR e.section_id = ?)
 		ORDER BY u.name
 	`
-	rows, err := r.DB.QueryContext(ctx, query, courseID)
+	rows, err := r.DB.QueryContext(ctx, query, courseID, sectionID, sectionID)
 	if err != nil {
 		return nil, err
 	}
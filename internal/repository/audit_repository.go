@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, entry *domain.AuditEntry) error {
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = time.Now()
+	query := `
+		INSERT INTO audit_log (id, actor_user_id, action, target_type, target_id, ip_address, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, entry.ID, entry.ActorUserID, entry.Action, entry.TargetType, entry.TargetID,
+		entry.IPAddress, nullIfEmpty(entry.Details), entry.CreatedAt)
+	return err
+}
+
+// AuditFilter narrows the audit log. Zero values match everything.
+type AuditFilter struct {
+	ActorUserID string
+	Action      string
+	TargetType  string
+	TargetID    string
+	Limit       int
+	Offset      int
+}
+
+// List returns audit entries matching the filter, newest first.
+func (r *AuditRepository) List(ctx context.Context, f AuditFilter) ([]domain.AuditEntry, error) {
+	query := `SELECT id, actor_user_id, action, target_type, target_id, ip_address, COALESCE(details, ''), created_at FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if f.ActorUserID != "" {
+		query += ` AND actor_user_id = ?`
+		args = append(args, f.ActorUserID)
+	}
+	if f.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		query += ` AND target_type = ?`
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		query += ` AND target_id = ?`
+		args = append(args, f.TargetID)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []domain.AuditEntry
+	for rows.Next() {
+		var e domain.AuditEntry
+		var actorID sql.NullString
+		if err := rows.Scan(&e.ID, &actorID, &e.Action, &e.TargetType, &e.TargetID, &e.IPAddress, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			e.ActorUserID = &actorID.String
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrBranchNotFound = errors.New("branch not found")
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrRoomNameTaken  = errors.New("the branch already has a room with this name")
+)
+
+type BranchRepository struct {
+	DB *sql.DB
+}
+
+func NewBranchRepository(db *sql.DB) *BranchRepository {
+	return &BranchRepository{DB: db}
+}
+
+const branchSelect = `
+	SELECT id, school_id, name, COALESCE(address, ''), COALESCE(city, ''), COALESCE(phone, ''), created_at, updated_at
+	FROM school_branches
+`
+
+func (r *BranchRepository) scanBranches(ctx context.Context, query string, args ...interface{}) ([]domain.SchoolBranch, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var branches []domain.SchoolBranch
+	for rows.Next() {
+		var b domain.SchoolBranch
+		if err := rows.Scan(&b.ID, &b.SchoolID, &b.Name, &b.Address, &b.City, &b.Phone, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		branches = append(branches, b)
+	}
+	return branches, rows.Err()
+}
+
+func (r *BranchRepository) Create(ctx context.Context, b *domain.SchoolBranch) error {
+	b.ID = uuid.New().String()
+	b.CreatedAt = time.Now()
+	b.UpdatedAt = b.CreatedAt
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO school_branches (id, school_id, name, address, city, phone) VALUES (?, ?, ?, ?, ?, ?)`,
+		b.ID, b.SchoolID, b.Name, b.Address, b.City, b.Phone)
+	return err
+}
+
+func (r *BranchRepository) GetByID(ctx context.Context, id string) (*domain.SchoolBranch, error) {
+	branches, err := r.scanBranches(ctx, branchSelect+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, ErrBranchNotFound
+	}
+	return &branches[0], nil
+}
+
+// ListBySchool returns the school's branches by name.
+func (r *BranchRepository) ListBySchool(ctx context.Context, schoolID string) ([]domain.SchoolBranch, error) {
+	return r.scanBranches(ctx, branchSelect+` WHERE school_id = ? ORDER BY name`, schoolID)
+}
+
+func (r *BranchRepository) Update(ctx context.Context, b *domain.SchoolBranch) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE school_branches SET name = ?, address = ?, city = ?, phone = ? WHERE id = ?`,
+		b.Name, b.Address, b.City, b.Phone, b.ID)
+	return err
+}
+
+// Delete removes the branch with its rooms and its managers' memberships. Its courses and
+// teachers stay with the school, on no branch.
+func (r *BranchRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM school_branches WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBranchNotFound
+	}
+	return nil
+}
+
+// CreateRoom adds a room to a branch. Room names are unique within a branch.
+func (r *BranchRepository) CreateRoom(ctx context.Context, room *domain.BranchRoom) error {
+	var taken bool
+	if err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM branch_rooms WHERE branch_id = ? AND name = ?)`,
+		room.BranchID, room.Name).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrRoomNameTaken
+	}
+	room.ID = uuid.New().String()
+	room.CreatedAt = time.Now()
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO branch_rooms (id, branch_id, name, capacity) VALUES (?, ?, ?, ?)`,
+		room.ID, room.BranchID, room.Name, room.Capacity)
+	return err
+}
+
+func (r *BranchRepository) GetRoom(ctx context.Context, id string) (*domain.BranchRoom, error) {
+	var room domain.BranchRoom
+	err := r.DB.QueryRowContext(ctx, `SELECT id, branch_id, name, capacity, created_at FROM branch_rooms WHERE id = ?`, id).
+		Scan(&room.ID, &room.BranchID, &room.Name, &room.Capacity, &room.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (r *BranchRepository) ListRooms(ctx context.Context, branchID string) ([]domain.BranchRoom, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, branch_id, name, capacity, created_at FROM branch_rooms WHERE branch_id = ? ORDER BY name`, branchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []domain.BranchRoom
+	for rows.Next() {
+		var room domain.BranchRoom
+		if err := rows.Scan(&room.ID, &room.BranchID, &room.Name, &room.Capacity, &room.CreatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (r *BranchRepository) DeleteRoom(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM branch_rooms WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/schooltj/internal/domain"
@@ -13,6 +14,7 @@ import (
 
 var ErrCourseNotFound = errors.New("course not found")
 var ErrEnrollmentNotFound = errors.New("enrollment not found")
+var ErrCourseFull = errors.New("the course is full")
 
 type CourseRepository struct {
 	DB *sql.DB
@@ -32,24 +34,26 @@ func (r *CourseRepository) CreateCourse(ctx context.Context, course *domain.Cour
 		}
 	}
 
-	query := `INSERT INTO courses (id, title, description, schedule, school_id, teacher_id, price, cover_image_url, language, category_id, difficulty, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
-	_, err := r.DB.ExecContext(ctx, query, course.ID, course.Title, course.Description, scheduleJSON, course.SchoolID, course.TeacherID, course.Price, course.CoverImageURL, course.Language, course.CategoryID, course.Difficulty)
+	query := `INSERT INTO courses (id, title, description, schedule, school_id, branch_id, teacher_id, price, currency, billing_cycle, cover_image_url, language, category_id, difficulty, max_students, created_at, updated_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	_, err := r.DB.ExecContext(ctx, query, course.ID, course.Title, course.Description, scheduleJSON, course.SchoolID, course.BranchID, course.TeacherID, course.Price, course.Currency, course.BillingCycle, course.CoverImageURL, course.Language, course.CategoryID, course.Difficulty, course.MaxStudents)
 	return err
 }
 
 func (r *CourseRepository) GetCourseByID(ctx context.Context, id string) (*domain.Course, error) {
 	query := `
-		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.cover_image_url, c.language,
+		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.currency, c.billing_cycle, c.cover_image_url, c.language,
 		       c.category_id, cat.name as category_name, c.difficulty, c.created_at, c.updated_at,
 		       COALESCE(u.name, 'Unknown Teacher') as teacher_name,
 		       COALESCE(u.email, '') as teacher_email,
 		       u.avatar_url,
 		       COALESCE(s.name, '') as school_name,
+		       c.branch_id, COALESCE(b.name, '') as branch_name, c.max_students,
 		       c.rating_avg, c.rating_count
 		FROM courses c
 		LEFT JOIN users u ON c.teacher_id = u.id
 		LEFT JOIN schools s ON c.school_id = s.id
+		LEFT JOIN school_branches b ON c.branch_id = b.id
 		LEFT JOIN categories cat ON c.category_id = cat.id
 		WHERE c.id = ?
 	`
@@ -68,8 +72,8 @@ func (r *CourseRepository) GetCourseByID(ctx context.Context, id string) (*domai
 	var catName sql.NullString
 
 	err := row.Scan(&course.ID, &course.Title, &course.Description, &scheduleJSON, &schoolID, &teacherID,
-		&course.Price, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt,
-		&teacherName, &teacherEmail, &avatarURL, &schoolName, &course.RatingAvg, &course.RatingCount)
+		&course.Price, &course.Currency, &course.BillingCycle, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt,
+		&teacherName, &teacherEmail, &avatarURL, &schoolName, &course.BranchID, &course.BranchName, &course.MaxStudents, &course.RatingAvg, &course.RatingCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCourseNotFound
@@ -109,6 +113,7 @@ func (r *CourseRepository) GetCourseByID(ctx context.Context, id string) (*domai
 
 type CourseFilter struct {
 	SchoolID   *string
+	BranchID   *string
 	TeacherID  *string
 	CategoryID *string
 	Difficulty *string
@@ -130,9 +135,14 @@ func (r *CourseRepository) ListCourses(ctx context.Context, filter CourseFilter)
 		conditions = append(conditions, "c.school_id = ?")
 		args = append(args, *filter.SchoolID)
 	}
+	if filter.BranchID != nil {
+		conditions = append(conditions, "c.branch_id = ?")
+		args = append(args, *filter.BranchID)
+	}
 	if filter.TeacherID != nil {
-		conditions = append(conditions, "c.teacher_id = ?")
-		args = append(args, *filter.TeacherID)
+		// A teacher works with the courses they teach and those they teach a section of.
+		conditions = append(conditions, "(c.teacher_id = ? OR EXISTS (SELECT 1 FROM course_sections cs WHERE cs.course_id = c.id AND cs.teacher_id = ?))")
+		args = append(args, *filter.TeacherID, *filter.TeacherID)
 	}
 	if filter.CategoryID != nil {
 		conditions = append(conditions, "c.category_id = ?")
@@ -148,18 +158,20 @@ func (r *CourseRepository) ListCourses(ctx context.Context, filter CourseFilter)
 	}
 
 	query := `
-		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.cover_image_url, c.language, 
+		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.currency, c.billing_cycle, c.cover_image_url, c.language, 
 		       c.category_id, cat.name as category_name, c.difficulty, c.created_at, c.updated_at,
 		       COALESCE(u.name, 'Unknown Teacher') as teacher_name,
 			   COALESCE(u.email, '') as teacher_email,
 			   u.avatar_url,
 		       COALESCE(s.name, '') as school_name,
+		       c.branch_id, COALESCE(b.name, '') as branch_name, c.max_students,
 			   (SELECT COUNT(*) FROM enrollments e2 WHERE e2.course_id = c.id AND e2.status = 'pending') as pending_requests_count,
 			   COALESCE(cv.view_count, 0) as view_count,
 			   c.rating_avg, c.rating_count
 		FROM courses c
 		LEFT JOIN users u ON c.teacher_id = u.id
 		LEFT JOIN schools s ON c.school_id = s.id
+		LEFT JOIN school_branches b ON c.branch_id = b.id
 		LEFT JOIN categories cat ON c.category_id = cat.id
 		LEFT JOIN course_views cv ON cv.course_id = c.id AND cv.student_id = ?
 	`
@@ -190,7 +202,7 @@ func (r *CourseRepository) ListCourses(ctx context.Context, filter CourseFilter)
 		var catName sql.NullString
 
 		if err := rows.Scan(&course.ID, &course.Title, &course.Description, &scheduleJSON, &schoolID, &teacherID,
-			&course.Price, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt, &teacherName, &teacherEmail, &avatarURL, &schoolName, &course.PendingRequestsCount, &course.ViewCount, &course.RatingAvg, &course.RatingCount); err != nil {
+			&course.Price, &course.Currency, &course.BillingCycle, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt, &teacherName, &teacherEmail, &avatarURL, &schoolName, &course.BranchID, &course.BranchName, &course.MaxStudents, &course.PendingRequestsCount, &course.ViewCount, &course.RatingAvg, &course.RatingCount); err != nil {
 			return nil, err
 		}
 
@@ -233,15 +245,15 @@ func (r *CourseRepository) CreateEnrollment(ctx context.Context, enrollment *dom
 		enrollment.Status = domain.EnrollmentStatusInvited
 	}
 
-	query := `INSERT INTO enrollments (id, student_user_id, course_id, enrolled_at, status) VALUES (?, ?, ?, NOW(), ?)`
-	_, err := r.DB.ExecContext(ctx, query, enrollment.ID, enrollment.StudentUserID, enrollment.CourseID, enrollment.Status)
+	query := `INSERT INTO enrollments (id, student_user_id, course_id, section_id, enrolled_at, status) VALUES (?, ?, ?, ?, NOW(), ?)`
+	_, err := r.DB.ExecContext(ctx, query, enrollment.ID, enrollment.StudentUserID, enrollment.CourseID, enrollment.SectionID, enrollment.Status)
 	return err
 }
 
 func (r *CourseRepository) GetEnrollmentByID(ctx context.Context, id string) (*domain.Enrollment, error) {
-	query := `SELECT id, student_user_id, course_id, enrolled_at, status FROM enrollments WHERE id = ?`
+	query := `SELECT id, student_user_id, course_id, section_id, enrolled_at, status, offer_expires_at FROM enrollments WHERE id = ?`
 	var e domain.Enrollment
-	err := r.DB.QueryRowContext(ctx, query, id).Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.EnrolledAt, &e.Status)
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.SectionID, &e.EnrolledAt, &e.Status, &e.OfferExpiresAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrEnrollmentNotFound
@@ -272,6 +284,306 @@ func (r *CourseRepository) DeleteEnrollment(ctx context.Context, enrollmentID st
 	return err
 }
 
+// waitlistPositionColumn selects a waitlisted enrollment e's place in its course's line,
+// 1 being next, and NULL for any other enrollment. Only those waiting for the same section
+// or for no section, who can take any of the course's seats, are ahead of e.
+const waitlistPositionColumn = `
+	CASE WHEN e.status = 'waitlisted' THEN 1 + (
+		SELECT COUNT(*) FROM enrollments w
+		WHERE w.course_id = e.course_id AND w.status = 'waitlisted'
+		  AND (w.section_id <=> e.section_id OR w.section_id IS NULL)
+		  AND (w.waitlisted_at < e.waitlisted_at OR (w.waitlisted_at = e.waitlisted_at AND w.id < e.id))
+	) END`
+
+// rowQuerier is a *sql.DB or a *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// holdsSeat is true for an enrollment e that takes up one of its course's seats: an
+// active student or an unexpired offer.
+const holdsSeat = `(e.status = 'active' OR (e.status = 'offered' AND e.offer_expires_at > NOW()))`
+
+// courseFull reports whether the course has no seat for someone new joining the section,
+// or no section when sectionID is empty: the course's or the section's seats are taken, or
+// others are already waiting in line for the same section.
+func courseFull(ctx context.Context, q rowQuerier, courseID, sectionID string) (bool, error) {
+	var full bool
+	err := q.QueryRowContext(ctx, `
+		SELECT (c.max_students IS NOT NULL AND
+				(SELECT COUNT(*) FROM enrollments e WHERE e.course_id = c.id AND `+holdsSeat+`) >= c.max_students)
+			OR (cs.max_students IS NOT NULL AND
+				(SELECT COUNT(*) FROM enrollments e WHERE e.section_id = cs.id AND `+holdsSeat+`) >= cs.max_students)
+			OR EXISTS (SELECT 1 FROM enrollments w WHERE w.course_id = c.id AND w.status = 'waitlisted' AND w.section_id <=> cs.id)
+		FROM courses c
+		LEFT JOIN course_sections cs ON cs.id = ? AND cs.course_id = c.id
+		WHERE c.id = ?`, sectionID, courseID).Scan(&full)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrCourseNotFound
+	}
+	return full, err
+}
+
+// CourseFull reports whether someone joining the course, in the section if sectionID is
+// set, would have to wait for a seat.
+func (r *CourseRepository) CourseFull(ctx context.Context, courseID, sectionID string) (bool, error) {
+	return courseFull(ctx, r.DB, courseID, sectionID)
+}
+
+// ActivateEnrollment makes an enrollment in the from status active if the course, and its
+// section, has a seat for it. A seat offered to the student is theirs until the offer
+// expires; anyone else gets ErrCourseFull when the seats are taken or others are waiting.
+// It returns ErrEnrollmentNotFound if the enrollment is no longer in the from status.
+func (r *CourseRepository) ActivateEnrollment(ctx context.Context, enrollmentID, from string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the course first, as PromoteWaitlist does, so seats are counted one at a time.
+	var courseID string
+	var sectionID sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT course_id, section_id FROM enrollments WHERE id = ?`, enrollmentID).Scan(&courseID, &sectionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEnrollmentNotFound
+		}
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM courses WHERE id = ? FOR UPDATE`, courseID).Scan(&courseID); err != nil {
+		return err
+	}
+	var current string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM enrollments
+		WHERE id = ? AND status = ? AND (status <> 'offered' OR offer_expires_at > NOW()) FOR UPDATE`,
+		enrollmentID, from).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEnrollmentNotFound
+		}
+		return err
+	}
+	if from != domain.EnrollmentStatusOffered {
+		full, err := courseFull(ctx, tx, courseID, sectionID.String)
+		if err != nil {
+			return err
+		}
+		if full {
+			return ErrCourseFull
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE enrollments SET status = ?, waitlisted_at = NULL, offer_expires_at = NULL WHERE id = ?`,
+		domain.EnrollmentStatusActive, enrollmentID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WaitlistEnrollment puts an enrollment in the from status at the end of its course's line.
+func (r *CourseRepository) WaitlistEnrollment(ctx context.Context, enrollmentID, from string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE enrollments SET status = ?, waitlisted_at = NOW(), offer_expires_at = NULL WHERE id = ? AND status = ?`,
+		domain.EnrollmentStatusWaitlisted, enrollmentID, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEnrollmentNotFound
+	}
+	return nil
+}
+
+// unlimitedSeats stands for the free seats of a course or section without a limit.
+const unlimitedSeats = int64(1<<31 - 1)
+
+// sectionSeatsLeft returns how many more students the section has seats for.
+func sectionSeatsLeft(ctx context.Context, q rowQuerier, sectionID string) (int64, error) {
+	var maxStudents sql.NullInt64
+	var taken int64
+	err := q.QueryRowContext(ctx, `
+		SELECT cs.max_students, (SELECT COUNT(*) FROM enrollments e WHERE e.section_id = cs.id AND `+holdsSeat+`)
+		FROM course_sections cs WHERE cs.id = ?`, sectionID).Scan(&maxStudents, &taken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSectionNotFound
+	}
+	if err != nil || !maxStudents.Valid {
+		return unlimitedSeats, err
+	}
+	return maxStudents.Int64 - taken, nil
+}
+
+// PromoteWaitlist offers the course's free seats to the students first in line, holding
+// each seat until offerExpiresAt, and returns the enrollments it made offers for. Students
+// waiting for a section that is still full keep their place while those behind them for
+// other sections move up.
+func (r *CourseRepository) PromoteWaitlist(ctx context.Context, courseID string, offerExpiresAt time.Time) ([]domain.Enrollment, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var maxStudents sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT max_students FROM courses WHERE id = ? FOR UPDATE`, courseID).Scan(&maxStudents); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+	// Without a limit everyone waiting gets a seat.
+	free := unlimitedSeats
+	if maxStudents.Valid {
+		var taken int64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM enrollments e WHERE e.course_id = ? AND `+holdsSeat, courseID).Scan(&taken); err != nil {
+			return nil, err
+		}
+		free = maxStudents.Int64 - taken
+	}
+	if free <= 0 {
+		return nil, tx.Commit()
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, student_user_id, course_id, section_id, enrolled_at FROM enrollments
+		WHERE course_id = ? AND status = 'waitlisted'
+		ORDER BY waitlisted_at, id FOR UPDATE`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	var waiting []domain.Enrollment
+	for rows.Next() {
+		var e domain.Enrollment
+		if err := rows.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.SectionID, &e.EnrolledAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		waiting = append(waiting, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sectionFree := make(map[string]int64)
+	var offered []domain.Enrollment
+	for _, e := range waiting {
+		if free <= 0 {
+			break
+		}
+		if e.SectionID != nil {
+			left, ok := sectionFree[*e.SectionID]
+			if !ok {
+				if left, err = sectionSeatsLeft(ctx, tx, *e.SectionID); err != nil {
+					return nil, err
+				}
+			}
+			if left <= 0 {
+				sectionFree[*e.SectionID] = left
+				continue
+			}
+			sectionFree[*e.SectionID] = left - 1
+		}
+		free--
+		e.Status = domain.EnrollmentStatusOffered
+		e.OfferExpiresAt = &offerExpiresAt
+		offered = append(offered, e)
+	}
+
+	for _, e := range offered {
+		if _, err := tx.ExecContext(ctx, `UPDATE enrollments SET status = ?, offer_expires_at = ? WHERE id = ?`,
+			domain.EnrollmentStatusOffered, offerExpiresAt, e.ID); err != nil {
+			return nil, err
+		}
+	}
+	return offered, tx.Commit()
+}
+
+// SetEnrollmentSection moves an enrollment to one of its course's sections, or to none. A
+// student holding a seat can only move to a section with a seat free; one waiting in line
+// keeps their place.
+func (r *CourseRepository) SetEnrollmentSection(ctx context.Context, enrollmentID string, sectionID *string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var courseID string
+	if err := tx.QueryRowContext(ctx, `SELECT course_id FROM enrollments WHERE id = ?`, enrollmentID).Scan(&courseID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEnrollmentNotFound
+		}
+		return err
+	}
+	// Seats are counted under the course's lock, as in ActivateEnrollment.
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM courses WHERE id = ? FOR UPDATE`, courseID).Scan(&courseID); err != nil {
+		return err
+	}
+	if sectionID != nil {
+		var seated bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM enrollments e WHERE e.id = ? AND NOT (e.section_id <=> ?) AND `+holdsSeat+`)
+			FROM course_sections WHERE id = ? AND course_id = ?`, enrollmentID, *sectionID, *sectionID, courseID).Scan(&seated)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSectionNotFound
+			}
+			return err
+		}
+		if seated {
+			left, err := sectionSeatsLeft(ctx, tx, *sectionID)
+			if err != nil {
+				return err
+			}
+			if left <= 0 {
+				return ErrSectionFull
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE enrollments SET section_id = ? WHERE id = ?`, sectionID, enrollmentID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExpireWaitlistOffers deletes seat offers whose time ran out and returns them, so their
+// seats can be offered to the next in line.
+func (r *CourseRepository) ExpireWaitlistOffers(ctx context.Context) ([]domain.Enrollment, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, student_user_id, course_id, enrolled_at, status, offer_expires_at FROM enrollments
+		WHERE status = 'offered' AND offer_expires_at <= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []domain.Enrollment
+	for rows.Next() {
+		var e domain.Enrollment
+		if err := rows.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.EnrolledAt, &e.Status, &e.OfferExpiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// An offer accepted since it was read is no longer expired and is left alone.
+	var expired []domain.Enrollment
+	for _, e := range candidates {
+		res, err := r.DB.ExecContext(ctx, `DELETE FROM enrollments WHERE id = ? AND status = 'offered' AND offer_expires_at <= NOW()`, e.ID)
+		if err != nil {
+			return expired, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			expired = append(expired, e)
+		}
+	}
+	return expired, nil
+}
+
 func (r *CourseRepository) GetEnrollmentsByStudent(ctx context.Context, studentID string) ([]*domain.Enrollment, error) {
 	query := `SELECT id, student_user_id, course_id, enrolled_at, status FROM enrollments WHERE student_user_id = ? ORDER BY enrolled_at DESC`
 	rows, err := r.DB.QueryContext(ctx, query, studentID)
@@ -291,12 +603,33 @@ func (r *CourseRepository) GetEnrollmentsByStudent(ctx context.Context, studentI
 	return enrollments, nil
 }
 
+// ListActiveEnrollments returns every active enrollment, oldest first, for billing.
+func (r *CourseRepository) ListActiveEnrollments(ctx context.Context) ([]*domain.Enrollment, error) {
+	query := `SELECT id, student_user_id, course_id, enrolled_at, status FROM enrollments WHERE status = 'active' ORDER BY enrolled_at`
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var enrollments []*domain.Enrollment
+	for rows.Next() {
+		var e domain.Enrollment
+		if err := rows.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.EnrolledAt, &e.Status); err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, &e)
+	}
+	return enrollments, rows.Err()
+}
+
 // GetEnrollmentsByCourse gets enrollments for a course, useful for teachers to see who is invited/enrolled
 func (r *CourseRepository) GetEnrollmentsByCourse(ctx context.Context, courseID string) ([]*domain.Enrollment, error) {
-	query := `SELECT e.id, e.student_user_id, e.course_id, e.enrolled_at, e.status,
+	query := `SELECT e.id, e.student_user_id, e.course_id, e.section_id, COALESCE(es.name, ''), e.enrolled_at, e.status, e.offer_expires_at, ` + waitlistPositionColumn + `,
 	           COALESCE(u.name, '') as student_name, u.avatar_url
 	           FROM enrollments e
 	           LEFT JOIN users u ON e.student_user_id = u.id
+	           LEFT JOIN course_sections es ON e.section_id = es.id
 	           WHERE e.course_id = ? ORDER BY e.enrolled_at DESC`
 	rows, err := r.DB.QueryContext(ctx, query, courseID)
 	if err != nil {
@@ -309,7 +642,7 @@ func (r *CourseRepository) GetEnrollmentsByCourse(ctx context.Context, courseID
 		var e domain.Enrollment
 		var studentName sql.NullString
 		var avatarURL sql.NullString
-		if err := rows.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.EnrolledAt, &e.Status, &studentName, &avatarURL); err != nil {
+		if err := rows.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.SectionID, &e.SectionName, &e.EnrolledAt, &e.Status, &e.OfferExpiresAt, &e.WaitlistPosition, &studentName, &avatarURL); err != nil {
 			return nil, err
 		}
 		if studentName.Valid {
@@ -325,11 +658,11 @@ func (r *CourseRepository) GetEnrollmentsByCourse(ctx context.Context, courseID
 
 // Check if already enrolled or invited
 func (r *CourseRepository) GetEnrollmentByStudentAndCourse(ctx context.Context, studentID, courseID string) (*domain.Enrollment, error) {
-	query := `SELECT id, student_user_id, course_id, enrolled_at, status FROM enrollments WHERE student_user_id = ? AND course_id = ?`
+	query := `SELECT id, student_user_id, course_id, section_id, enrolled_at, status FROM enrollments WHERE student_user_id = ? AND course_id = ?`
 	row := r.DB.QueryRowContext(ctx, query, studentID, courseID)
 
 	var e domain.Enrollment
-	err := row.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.EnrolledAt, &e.Status)
+	err := row.Scan(&e.ID, &e.StudentUserID, &e.CourseID, &e.SectionID, &e.EnrolledAt, &e.Status)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrEnrollmentNotFound
@@ -342,19 +675,22 @@ func (r *CourseRepository) GetEnrollmentByStudentAndCourse(ctx context.Context,
 // Helper to get detailed enrollment (with course info) could be in service or join query here.
 // For "My Courses" or "Invitations", we usually want course details.
 type EnrollmentWithCourse struct {
-	Enrollment domain.Enrollment `json:"enrollment"`
-	Course     domain.Course     `json:"course"`
+	Enrollment domain.Enrollment     `json:"enrollment"`
+	Course     domain.Course         `json:"course"`
+	Section    *domain.CourseSection `json:"section,omitempty"` // the student's section, with its schedule and teacher
 }
 
 func (r *CourseRepository) GetStudentEnrollmentsWithCourse(ctx context.Context, studentID string) ([]EnrollmentWithCourse, error) {
 	query := `
-		SELECT e.id, e.student_user_id, e.course_id, e.enrolled_at, e.status,
-		       c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.cover_image_url, c.language,
+		SELECT e.id, e.student_user_id, e.course_id, e.section_id, e.enrolled_at, e.status, e.offer_expires_at, ` + waitlistPositionColumn + `,
+		       COALESCE(es.name, ''), es.schedule, es.teacher_id, COALESCE(esu.name, ''),
+		       c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.currency, c.billing_cycle, c.cover_image_url, c.language,
 			   c.category_id, cat.name as category_name, c.difficulty, c.created_at, c.updated_at,
 		       COALESCE(u.name, 'Unknown Teacher') as teacher_name,
 			   COALESCE(u.email, '') as teacher_email,
 			   u.avatar_url,
 		       COALESCE(s.name, '') as school_name,
+		       c.branch_id, COALESCE(b.name, '') as branch_name, c.max_students,
 			   (SELECT COUNT(*) FROM enrollments e2 WHERE e2.course_id = c.id AND e2.status = 'pending') as pending_requests_count,
 			   COALESCE(cv.view_count, 0) as view_count,
 			   c.rating_avg, c.rating_count
@@ -362,8 +698,11 @@ func (r *CourseRepository) GetStudentEnrollmentsWithCourse(ctx context.Context,
 		JOIN courses c ON e.course_id = c.id
 		LEFT JOIN users u ON c.teacher_id = u.id
 		LEFT JOIN schools s ON c.school_id = s.id
+		LEFT JOIN school_branches b ON c.branch_id = b.id
 		LEFT JOIN categories cat ON c.category_id = cat.id
 		LEFT JOIN course_views cv ON cv.course_id = c.id AND cv.student_id = e.student_user_id
+		LEFT JOIN course_sections es ON e.section_id = es.id
+		LEFT JOIN users esu ON es.teacher_id = esu.id
 		WHERE e.student_user_id = ?
 		ORDER BY e.enrolled_at DESC
 	`
@@ -387,12 +726,16 @@ func (r *CourseRepository) GetStudentEnrollmentsWithCourse(ctx context.Context,
 
 		var catID sql.NullString
 		var catName sql.NullString
+		var section domain.CourseSection
+		var sectionScheduleJSON []byte
 
 		err := rows.Scan(
-			&ec.Enrollment.ID, &ec.Enrollment.StudentUserID, &ec.Enrollment.CourseID, &ec.Enrollment.EnrolledAt, &ec.Enrollment.Status,
+			&ec.Enrollment.ID, &ec.Enrollment.StudentUserID, &ec.Enrollment.CourseID, &ec.Enrollment.SectionID, &ec.Enrollment.EnrolledAt, &ec.Enrollment.Status,
+			&ec.Enrollment.OfferExpiresAt, &ec.Enrollment.WaitlistPosition,
+			&ec.Enrollment.SectionName, &sectionScheduleJSON, &section.TeacherID, &section.TeacherName,
 			&ec.Course.ID, &ec.Course.Title, &ec.Course.Description, &scheduleJSON, &schoolID, &teacherID,
-			&ec.Course.Price, &coverImageURL, &ec.Course.Language, &catID, &catName, &ec.Course.Difficulty, &ec.Course.CreatedAt, &ec.Course.UpdatedAt,
-			&teacherName, &teacherEmail, &avatarURL, &schoolName, &ec.Course.PendingRequestsCount, &ec.Course.ViewCount, &ec.Course.RatingAvg, &ec.Course.RatingCount,
+			&ec.Course.Price, &ec.Course.Currency, &ec.Course.BillingCycle, &coverImageURL, &ec.Course.Language, &catID, &catName, &ec.Course.Difficulty, &ec.Course.CreatedAt, &ec.Course.UpdatedAt,
+			&teacherName, &teacherEmail, &avatarURL, &schoolName, &ec.Course.BranchID, &ec.Course.BranchName, &ec.Course.MaxStudents, &ec.Course.PendingRequestsCount, &ec.Course.ViewCount, &ec.Course.RatingAvg, &ec.Course.RatingCount,
 		)
 		if err != nil {
 			return nil, err
@@ -424,6 +767,18 @@ func (r *CourseRepository) GetStudentEnrollmentsWithCourse(ctx context.Context,
 			ec.Course.CategoryID = &catID.String
 			ec.Course.CategoryName = catName.String
 		}
+		if ec.Enrollment.SectionID != nil {
+			section.ID = *ec.Enrollment.SectionID
+			section.CourseID = ec.Enrollment.CourseID
+			section.Name = ec.Enrollment.SectionName
+			if len(sectionScheduleJSON) > 0 {
+				var s domain.Schedule
+				if err := json.Unmarshal(sectionScheduleJSON, &s); err == nil {
+					section.Schedule = &s
+				}
+			}
+			ec.Section = &section
+		}
 		result = append(result, ec)
 	}
 	return result, nil
@@ -447,6 +802,14 @@ func (r *CourseRepository) UpdateCoverImage(ctx context.Context, courseID string
 	return err
 }
 
+// HasBillingHistory reports whether any invoice or payment was made for the course.
+func (r *CourseRepository) HasBillingHistory(ctx context.Context, courseID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM invoices WHERE course_id = ?) OR EXISTS (SELECT 1 FROM payments WHERE course_id = ?)`
+	err := r.DB.QueryRowContext(ctx, query, courseID, courseID).Scan(&exists)
+	return exists, err
+}
+
 func (r *CourseRepository) UpdateCourse(ctx context.Context, course *domain.Course) error {
 	var scheduleJSON interface{} = nil
 	if course.Schedule != nil {
@@ -455,8 +818,8 @@ func (r *CourseRepository) UpdateCourse(ctx context.Context, course *domain.Cour
 		}
 	}
 
-	query := `UPDATE courses SET title = ?, description = ?, schedule = ?, price = ?, language = ?, category_id = ?, difficulty = ?, updated_at = NOW() WHERE id = ?`
-	result, err := r.DB.ExecContext(ctx, query, course.Title, course.Description, scheduleJSON, course.Price, course.Language, course.CategoryID, course.Difficulty, course.ID)
+	query := `UPDATE courses SET title = ?, description = ?, schedule = ?, price = ?, currency = ?, billing_cycle = ?, language = ?, category_id = ?, difficulty = ?, max_students = ?, updated_at = NOW() WHERE id = ?`
+	result, err := r.DB.ExecContext(ctx, query, course.Title, course.Description, scheduleJSON, course.Price, course.Currency, course.BillingCycle, course.Language, course.CategoryID, course.Difficulty, course.MaxStudents, course.ID)
 	if err != nil {
 		return err
 	}
@@ -487,18 +850,20 @@ func (r *CourseRepository) DeleteCourse(ctx context.Context, id string) error {
 
 func (r *CourseRepository) GetCourseByIDWithDetails(ctx context.Context, userID, id string) (*domain.Course, error) {
 	query := `
-		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.cover_image_url, c.language, 
+		SELECT c.id, c.title, c.description, c.schedule, c.school_id, c.teacher_id, c.price, c.currency, c.billing_cycle, c.cover_image_url, c.language, 
 		       c.category_id, cat.name as category_name, c.difficulty, c.created_at, c.updated_at,
 		       COALESCE(u.name, 'Unknown Teacher') as teacher_name,
 			   COALESCE(u.email, '') as teacher_email,
 			   u.avatar_url,
 		       COALESCE(s.name, '') as school_name,
+		       c.branch_id, COALESCE(b.name, '') as branch_name, c.max_students,
 			   (SELECT COUNT(*) FROM enrollments e2 WHERE e2.course_id = c.id AND e2.status = 'pending') as pending_requests_count,
 			   COALESCE(cv.view_count, 0) as view_count,
 			   c.rating_avg, c.rating_count
 		FROM courses c
 		LEFT JOIN users u ON c.teacher_id = u.id
 		LEFT JOIN schools s ON c.school_id = s.id
+		LEFT JOIN school_branches b ON c.branch_id = b.id
 		LEFT JOIN categories cat ON c.category_id = cat.id
 		LEFT JOIN course_views cv ON cv.course_id = c.id AND cv.student_id = ?
 		WHERE c.id = ?
@@ -519,7 +884,7 @@ func (r *CourseRepository) GetCourseByIDWithDetails(ctx context.Context, userID,
 	var catName sql.NullString
 
 	err := row.Scan(&course.ID, &course.Title, &course.Description, &scheduleJSON, &schoolID, &teacherID,
-		&course.Price, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt, &teacherName, &teacherEmail, &avatarURL, &schoolName, &course.PendingRequestsCount, &course.ViewCount, &course.RatingAvg, &course.RatingCount)
+		&course.Price, &course.Currency, &course.BillingCycle, &coverImageURL, &course.Language, &catID, &catName, &course.Difficulty, &course.CreatedAt, &course.UpdatedAt, &teacherName, &teacherEmail, &avatarURL, &schoolName, &course.BranchID, &course.BranchName, &course.MaxStudents, &course.PendingRequestsCount, &course.ViewCount, &course.RatingAvg, &course.RatingCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCourseNotFound
@@ -561,6 +926,12 @@ func (r *CourseRepository) GetCourseByIDWithDetails(ctx context.Context, userID,
 	return &course, nil
 }
 
+// SetCourseBranch moves the course to a branch of its school, or to none when branchID is nil.
+func (r *CourseRepository) SetCourseBranch(ctx context.Context, courseID string, branchID *string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE courses SET branch_id = ?, updated_at = NOW() WHERE id = ?`, branchID, courseID)
+	return err
+}
+
 // Category Management
 func (r *CourseRepository) CreateCategory(ctx context.Context, cat *domain.Category) error {
 	cat.ID = uuid.New().String()
@@ -628,3 +999,43 @@ func (r *CourseRepository) AddTagToCourse(ctx context.Context, courseID, tagName
 	_, err = r.DB.ExecContext(ctx, "INSERT INTO course_tags (course_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", courseID, tagID)
 	return err
 }
+
+// CourseAccess describes how one user is connected to a course. Empty fields mean no
+// connection: an unassigned teacher, an independent course, or no enrollment.
+type CourseAccess struct {
+	TeacherID         string
+	SchoolID          string
+	BranchID          string
+	SchoolRole        domain.SchoolRole // the user's role on the staff of the course's school
+	MemberBranchID    string            // the branch the user manages, for a branch manager
+	EnrollmentStatus  string
+	EnrollmentSection string // the section the user is enrolled in
+	TeachesSection    bool   // the user teaches one of the course's sections
+}
+
+// GetCourseAccess loads what the authorization policy needs to know about a user and a course.
+// A student enrolled more than once is judged by an active or completed enrollment, then
+// by the newest one.
+func (r *CourseRepository) GetCourseAccess(ctx context.Context, courseID, userID string) (*CourseAccess, error) {
+	query := `
+		SELECT COALESCE(c.teacher_id, ''), COALESCE(c.school_id, ''), COALESCE(c.branch_id, ''), COALESCE(sm.role, ''), COALESCE(sm.branch_id, ''),
+		       COALESCE(e.status, ''), COALESCE(e.section_id, ''),
+		       EXISTS (SELECT 1 FROM course_sections cs WHERE cs.course_id = c.id AND cs.teacher_id = ?)
+		FROM courses c
+		LEFT JOIN school_members sm ON sm.school_id = c.school_id AND sm.user_id = ?
+		LEFT JOIN enrollments e ON e.id = (
+			SELECT e2.id FROM enrollments e2 WHERE e2.course_id = c.id AND e2.student_user_id = ?
+			ORDER BY e2.status IN ('active', 'completed') DESC, e2.enrolled_at DESC, e2.id DESC LIMIT 1)
+		WHERE c.id = ?
+	`
+	var a CourseAccess
+	err := r.DB.QueryRowContext(ctx, query, userID, userID, userID, courseID).Scan(&a.TeacherID, &a.SchoolID, &a.BranchID, &a.SchoolRole, &a.MemberBranchID,
+		&a.EnrollmentStatus, &a.EnrollmentSection, &a.TeachesSection)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
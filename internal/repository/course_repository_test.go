@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+)
+
+func newCourseMock(t *testing.T) (*CourseRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return &CourseRepository{DB: db}, mock
+}
+
+// expectCourseLock answers the locked read of course c1's seat limit; nil for none.
+func expectCourseLock(mock sqlmock.Sqlmock, maxStudents any) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT max_students FROM courses WHERE id = \? FOR UPDATE`).WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"max_students"}).AddRow(maxStudents))
+}
+
+// expectWaiting answers the locked read of c1's line, given as enrollment ID and section
+// pairs in the order the database returns them.
+func expectWaiting(mock sqlmock.Sqlmock, line ...[2]string) {
+	rows := sqlmock.NewRows([]string{"id", "student_user_id", "course_id", "section_id", "enrolled_at"})
+	for _, w := range line {
+		var section any
+		if w[1] != "" {
+			section = w[1]
+		}
+		rows.AddRow(w[0], "student-"+w[0], "c1", section, time.Now())
+	}
+	mock.ExpectQuery(`WHERE course_id = \? AND status = 'waitlisted'\s+ORDER BY waitlisted_at, id FOR UPDATE`).WithArgs("c1").WillReturnRows(rows)
+}
+
+func expectOffer(mock sqlmock.Sqlmock, id string, expires time.Time) {
+	mock.ExpectExec(`UPDATE enrollments SET status = \?, offer_expires_at = \? WHERE id = \?`).
+		WithArgs(domain.EnrollmentStatusOffered, expires, id).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func offeredIDs(offered []domain.Enrollment) []string {
+	ids := make([]string, len(offered))
+	for i, e := range offered {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestPromoteWaitlistOffersFreeSeatsInLineOrder(t *testing.T) {
+	repo, mock := newCourseMock(t)
+	expires := time.Now().Add(48 * time.Hour)
+
+	// Five seats, three taken: two are free.
+	expectCourseLock(mock, 5)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM enrollments e WHERE e.course_id = \? AND \(e.status = 'active' OR \(e.status = 'offered' AND e.offer_expires_at > NOW\(\)\)\)`).
+		WithArgs("c1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	expectWaiting(mock, [2]string{"w1", "full"}, [2]string{"w2", ""}, [2]string{"w3", "full"}, [2]string{"w4", "open"}, [2]string{"w5", ""})
+	// w1 waits for a section with no seat left; the section is counted once.
+	mock.ExpectQuery(`SELECT cs.max_students, .* FROM course_sections cs WHERE cs.id = \?`).WithArgs("full").
+		WillReturnRows(sqlmock.NewRows([]string{"max_students", "taken"}).AddRow(2, 2))
+	mock.ExpectQuery(`SELECT cs.max_students, .* FROM course_sections cs WHERE cs.id = \?`).WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"max_students", "taken"}).AddRow(2, 0))
+	expectOffer(mock, "w2", expires)
+	expectOffer(mock, "w4", expires)
+	mock.ExpectCommit()
+
+	offered, err := repo.PromoteWaitlist(context.Background(), "c1", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := offeredIDs(offered); len(ids) != 2 || ids[0] != "w2" || ids[1] != "w4" {
+		t.Fatalf("offered %v, want [w2 w4]", ids)
+	}
+	for _, e := range offered {
+		if e.Status != domain.EnrollmentStatusOffered || e.OfferExpiresAt == nil || !e.OfferExpiresAt.Equal(expires) {
+			t.Fatalf("offer %s = %s until %v, want offered until %v", e.ID, e.Status, e.OfferExpiresAt, expires)
+		}
+	}
+}
+
+func TestPromoteWaitlistWithoutFreeSeats(t *testing.T) {
+	repo, mock := newCourseMock(t)
+
+	// Seats held by unexpired offers count as taken, so nobody is read from the line.
+	expectCourseLock(mock, 3)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM enrollments e`).WithArgs("c1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectCommit()
+
+	offered, err := repo.PromoteWaitlist(context.Background(), "c1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offered) != 0 {
+		t.Fatalf("offered %v, want none", offeredIDs(offered))
+	}
+}
+
+func TestPromoteWaitlistWithoutASeatLimit(t *testing.T) {
+	repo, mock := newCourseMock(t)
+	expires := time.Now().Add(time.Hour)
+
+	expectCourseLock(mock, nil)
+	expectWaiting(mock, [2]string{"w1", ""}, [2]string{"w2", ""})
+	expectOffer(mock, "w1", expires)
+	expectOffer(mock, "w2", expires)
+	mock.ExpectCommit()
+
+	offered, err := repo.PromoteWaitlist(context.Background(), "c1", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offered) != 2 {
+		t.Fatalf("offered %v, want everyone waiting", offeredIDs(offered))
+	}
+}
+
+func TestPromoteWaitlistForMissingCourse(t *testing.T) {
+	repo, mock := newCourseMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT max_students FROM courses WHERE id = \? FOR UPDATE`).WithArgs("c1").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := repo.PromoteWaitlist(context.Background(), "c1", time.Now()); !errors.Is(err, ErrCourseNotFound) {
+		t.Fatalf("err = %v, want ErrCourseNotFound", err)
+	}
+}
+
+func TestActivateEnrollmentChecksSeatsUnderTheCourseLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		full    bool
+		wantErr error
+	}{
+		{"approved request with a seat", domain.EnrollmentStatusPending, false, nil},
+		{"approved request without a seat", domain.EnrollmentStatusPending, true, ErrCourseFull},
+		// An offered seat is already counted as the student's.
+		{"accepted offer", domain.EnrollmentStatusOffered, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newCourseMock(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT course_id, section_id FROM enrollments WHERE id = \?`).WithArgs("e1").
+				WillReturnRows(sqlmock.NewRows([]string{"course_id", "section_id"}).AddRow("c1", nil))
+			mock.ExpectQuery(`SELECT id FROM courses WHERE id = \? FOR UPDATE`).WithArgs("c1").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("c1"))
+			mock.ExpectQuery(`SELECT status FROM enrollments\s+WHERE id = \? AND status = \? .* FOR UPDATE`).WithArgs("e1", tt.from).
+				WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(tt.from))
+			if tt.from != domain.EnrollmentStatusOffered {
+				mock.ExpectQuery(`FROM courses c\s+LEFT JOIN course_sections cs`).WithArgs("", "c1").
+					WillReturnRows(sqlmock.NewRows([]string{"full"}).AddRow(tt.full))
+			}
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE enrollments SET status = \?, waitlisted_at = NULL, offer_expires_at = NULL WHERE id = \?`).
+					WithArgs(domain.EnrollmentStatusActive, "e1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if err := repo.ActivateEnrollment(context.Background(), "e1", tt.from); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetEnrollmentSectionChecksTheNewSectionsSeats(t *testing.T) {
+	tests := []struct {
+		name     string
+		seated   bool // the student holds a seat rather than waiting in line
+		seatsMax int
+		taken    int
+		wantErr  error
+	}{
+		{"seated student to a section with room", true, 10, 9, nil},
+		{"seated student to a full section", true, 10, 10, ErrSectionFull},
+		// Someone waiting takes no seat by moving, so keeps their place in line.
+		{"waiting student to a full section", false, 10, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newCourseMock(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT course_id FROM enrollments WHERE id = \?`).WithArgs("e1").
+				WillReturnRows(sqlmock.NewRows([]string{"course_id"}).AddRow("c1"))
+			mock.ExpectQuery(`SELECT id FROM courses WHERE id = \? FOR UPDATE`).WithArgs("c1").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("c1"))
+			mock.ExpectQuery(`FROM course_sections WHERE id = \? AND course_id = \?`).WithArgs("e1", "sec2", "sec2", "c1").
+				WillReturnRows(sqlmock.NewRows([]string{"seated"}).AddRow(tt.seated))
+			if tt.seated {
+				mock.ExpectQuery(`SELECT cs.max_students, .* FROM course_sections cs WHERE cs.id = \?`).WithArgs("sec2").
+					WillReturnRows(sqlmock.NewRows([]string{"max_students", "taken"}).AddRow(tt.seatsMax, tt.taken))
+			}
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE enrollments SET section_id = \? WHERE id = \?`).WithArgs("sec2", "e1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			section := "sec2"
+			if err := repo.SetEnrollmentSection(context.Background(), "e1", &section); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetEnrollmentSectionOfAnotherCourse(t *testing.T) {
+	repo, mock := newCourseMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT course_id FROM enrollments WHERE id = \?`).WithArgs("e1").
+		WillReturnRows(sqlmock.NewRows([]string{"course_id"}).AddRow("c1"))
+	mock.ExpectQuery(`SELECT id FROM courses WHERE id = \? FOR UPDATE`).WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("c1"))
+	mock.ExpectQuery(`FROM course_sections WHERE id = \? AND course_id = \?`).WithArgs("e1", "other", "other", "c1").
+		WillReturnRows(sqlmock.NewRows([]string{"seated"}))
+	mock.ExpectRollback()
+
+	section := "other"
+	if err := repo.SetEnrollmentSection(context.Background(), "e1", &section); !errors.Is(err, ErrSectionNotFound) {
+		t.Fatalf("err = %v, want ErrSectionNotFound", err)
+	}
+}
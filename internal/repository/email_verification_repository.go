@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrVerificationTokenInvalid = errors.New("verification link is invalid or has expired")
+
+type EmailVerificationRepository struct {
+	DB *sql.DB
+}
+
+func NewEmailVerificationRepository(db *sql.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{DB: db}
+}
+
+// Create stores a new verification token for the user, invalidating any earlier unused ones.
+func (r *EmailVerificationRepository) Create(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO email_verification_tokens (id, user_id, token_hash, expires_at) VALUES (?, ?, ?, ?)`,
+		uuid.New().String(), userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify marks the token's user verified and the token used. Tokens that are unknown,
+// used or expired yield ErrVerificationTokenInvalid.
+func (r *EmailVerificationRepository) Verify(ctx context.Context, tokenHash string) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id, userID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id FROM email_verification_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW() FOR UPDATE`, tokenHash).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrVerificationTokenInvalid
+		}
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE email_verification_tokens SET used_at = NOW() WHERE id = ?`, id); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), email_verification_assumed = FALSE WHERE id = ?`, userID); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+type ExchangeRateRepository struct {
+	DB *sql.DB
+}
+
+func NewExchangeRateRepository(db *sql.DB) *ExchangeRateRepository {
+	return &ExchangeRateRepository{DB: db}
+}
+
+func (r *ExchangeRateRepository) Create(ctx context.Context, rate *domain.ExchangeRate) error {
+	rate.ID = uuid.New().String()
+	rate.CreatedAt = time.Now()
+	query := `INSERT INTO exchange_rates (id, currency, rate, effective_at, source, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, rate.ID, rate.Currency, rate.Rate, rate.EffectiveAt, rate.Source, rate.CreatedBy, rate.CreatedAt)
+	return err
+}
+
+// RateAt returns the rate of a currency in force at the given time, or sql.ErrNoRows.
+func (r *ExchangeRateRepository) RateAt(ctx context.Context, currency string, at time.Time) (float64, error) {
+	var rate float64
+	query := `SELECT rate FROM exchange_rates WHERE currency = ? AND effective_at <= ? ORDER BY effective_at DESC LIMIT 1`
+	err := r.DB.QueryRowContext(ctx, query, currency, at).Scan(&rate)
+	return rate, err
+}
+
+// List returns the most recent rates, optionally for one currency.
+func (r *ExchangeRateRepository) List(ctx context.Context, currency string, limit int) ([]domain.ExchangeRate, error) {
+	query := `SELECT id, currency, rate, effective_at, source, created_by, created_at FROM exchange_rates`
+	var args []interface{}
+	if currency != "" {
+		query += ` WHERE currency = ?`
+		args = append(args, currency)
+	}
+	query += ` ORDER BY effective_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []domain.ExchangeRate
+	for rows.Next() {
+		var rate domain.ExchangeRate
+		if err := rows.Scan(&rate.ID, &rate.Currency, &rate.Rate, &rate.EffectiveAt, &rate.Source, &rate.CreatedBy, &rate.CreatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
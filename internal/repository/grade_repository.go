@@ -18,19 +18,21 @@ func NewGradeRepository(db *sql.DB) *GradeRepository {
 
 func (r *GradeRepository) Create(ctx context.Context, g *domain.Grade) error {
 	g.ID = uuid.New().String()
-	query := `INSERT INTO grades (id, student_user_id, course_id, title, score, letter_grade, comment, graded_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := r.DB.ExecContext(ctx, query, g.ID, g.StudentUserID, g.CourseID, g.Title, g.Score, g.LetterGrade, g.Comment, g.GradedBy)
+	query := `INSERT INTO grades (id, student_user_id, course_id, section_id, title, score, letter_grade, comment, graded_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, g.ID, g.StudentUserID, g.CourseID, g.SectionID, g.Title, g.Score, g.LetterGrade, g.Comment, g.GradedBy)
 	return err
 }
 
-func (r *GradeRepository) ListByCourse(ctx context.Context, courseID string) ([]domain.Grade, error) {
-	query := `SELECT g.id, g.student_user_id, COALESCE(u.name, u.email) as student_name, u.avatar_url as student_avatar, g.course_id, COALESCE(c.title, '') as course_title, g.title, g.score, g.letter_grade, COALESCE(g.comment, ''), g.graded_by, g.graded_at, g.created_at
+// ListByCourse returns the course's grades, or only those given in one of its sections when
+// sectionID is set.
+func (r *GradeRepository) ListByCourse(ctx context.Context, courseID, sectionID string) ([]domain.Grade, error) {
+	query := `SELECT g.id, g.student_user_id, COALESCE(u.name, u.email) as student_name, u.avatar_url as student_avatar, g.course_id, g.section_id, COALESCE(c.title, '') as course_title, g.title, g.score, g.letter_grade, COALESCE(g.comment, ''), g.graded_by, g.graded_at, g.created_at
 		FROM grades g
 		JOIN users u ON g.student_user_id = u.id
 		JOIN courses c ON g.course_id = c.id
-		WHERE g.course_id = ?
+		WHERE g.course_id = ? AND (? = '' OR g.section_id = ?)
 		ORDER BY g.graded_at DESC`
-	rows, err := r.DB.QueryContext(ctx, query, courseID)
+	rows, err := r.DB.QueryContext(ctx, query, courseID, sectionID, sectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +41,7 @@ func (r *GradeRepository) ListByCourse(ctx context.Context, courseID string) ([]
 	for rows.Next() {
 		var g domain.Grade
 		var avatarURL sql.NullString
-		if err := rows.Scan(&g.ID, &g.StudentUserID, &g.StudentName, &avatarURL, &g.CourseID, &g.CourseTitle, &g.Title, &g.Score, &g.LetterGrade, &g.Comment, &g.GradedBy, &g.GradedAt, &g.CreatedAt); err != nil {
+		if err := rows.Scan(&g.ID, &g.StudentUserID, &g.StudentName, &avatarURL, &g.CourseID, &g.SectionID, &g.CourseTitle, &g.Title, &g.Score, &g.LetterGrade, &g.Comment, &g.GradedBy, &g.GradedAt, &g.CreatedAt); err != nil {
 			return nil, err
 		}
 		if avatarURL.Valid {
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrGuardianInviteInvalid = errors.New("invitation is invalid or has expired")
+	ErrGuardianLinkNotFound  = errors.New("guardian link not found")
+	ErrAlreadyGuardian       = errors.New("you are already linked to this student")
+)
+
+type GuardianRepository struct {
+	DB *sql.DB
+}
+
+func NewGuardianRepository(db *sql.DB) *GuardianRepository {
+	return &GuardianRepository{DB: db}
+}
+
+const guardianLinkSelect = `
+	SELECT gl.id, gl.student_user_id, COALESCE(su.name, ''), gl.guardian_user_id, COALESCE(gu.name, ''),
+	       gl.relationship, gl.invited_email, gl.invited_phone, gl.invited_by, gl.status,
+	       gl.expires_at, gl.accepted_at, gl.created_at
+	FROM guardian_links gl
+	JOIN users su ON gl.student_user_id = su.id
+	LEFT JOIN users gu ON gl.guardian_user_id = gu.id
+`
+
+func (r *GuardianRepository) scanLinks(ctx context.Context, query string, args ...interface{}) ([]domain.GuardianLink, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []domain.GuardianLink
+	for rows.Next() {
+		var l domain.GuardianLink
+		var guardianID sql.NullString
+		if err := rows.Scan(&l.ID, &l.StudentUserID, &l.StudentName, &guardianID, &l.GuardianName,
+			&l.Relationship, &l.InvitedEmail, &l.InvitedPhone, &l.InvitedBy, &l.Status,
+			&l.ExpiresAt, &l.AcceptedAt, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		if guardianID.Valid {
+			l.GuardianUserID = &guardianID.String
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// CreateInvite stores a pending link that whoever holds the token can accept.
+func (r *GuardianRepository) CreateInvite(ctx context.Context, l *domain.GuardianLink, tokenHash string) error {
+	l.ID = uuid.New().String()
+	l.Status = domain.GuardianLinkPending
+	l.CreatedAt = time.Now()
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO guardian_links (id, student_user_id, relationship, invited_email, invited_phone, invited_by, token_hash, status, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.ID, l.StudentUserID, l.Relationship, l.InvitedEmail, l.InvitedPhone, l.InvitedBy, tokenHash, l.Status, l.ExpiresAt)
+	return err
+}
+
+// Accept links the guardian to the student of a pending, unexpired invitation and uses
+// up its token. It returns the student's ID.
+func (r *GuardianRepository) Accept(ctx context.Context, tokenHash, guardianID string) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id, studentID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, student_user_id FROM guardian_links
+		WHERE token_hash = ? AND status = ? AND expires_at > NOW() FOR UPDATE`,
+		tokenHash, domain.GuardianLinkPending).Scan(&id, &studentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrGuardianInviteInvalid
+		}
+		return "", err
+	}
+
+	var linked bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM guardian_links WHERE student_user_id = ? AND guardian_user_id = ? AND status = ?)`,
+		studentID, guardianID, domain.GuardianLinkActive).Scan(&linked)
+	if err != nil {
+		return "", err
+	}
+	if linked {
+		return "", ErrAlreadyGuardian
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE guardian_links SET guardian_user_id = ?, status = ?, token_hash = NULL, accepted_at = NOW()
+		WHERE id = ?`, guardianID, domain.GuardianLinkActive, id)
+	if err != nil {
+		return "", err
+	}
+	return studentID, tx.Commit()
+}
+
+// GetPendingByToken returns the pending, unexpired invitation with the given token.
+func (r *GuardianRepository) GetPendingByToken(ctx context.Context, tokenHash string) (*domain.GuardianLink, error) {
+	links, err := r.scanLinks(ctx, guardianLinkSelect+` WHERE gl.token_hash = ? AND gl.status = ? AND gl.expires_at > NOW()`,
+		tokenHash, domain.GuardianLinkPending)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, ErrGuardianInviteInvalid
+	}
+	return &links[0], nil
+}
+
+func (r *GuardianRepository) GetByID(ctx context.Context, id string) (*domain.GuardianLink, error) {
+	links, err := r.scanLinks(ctx, guardianLinkSelect+` WHERE gl.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, ErrGuardianLinkNotFound
+	}
+	return &links[0], nil
+}
+
+// ListByStudent returns the student's pending and active links, newest first.
+func (r *GuardianRepository) ListByStudent(ctx context.Context, studentID string) ([]domain.GuardianLink, error) {
+	return r.scanLinks(ctx, guardianLinkSelect+`
+		WHERE gl.student_user_id = ? AND gl.status <> ?
+		ORDER BY gl.created_at DESC`, studentID, domain.GuardianLinkRevoked)
+}
+
+// Revoke ends a pending or active link.
+func (r *GuardianRepository) Revoke(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE guardian_links SET status = ?, token_hash = NULL WHERE id = ? AND status <> ?`,
+		domain.GuardianLinkRevoked, id, domain.GuardianLinkRevoked)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGuardianLinkNotFound
+	}
+	return nil
+}
+
+// ListChildren returns the students the guardian has an active link to.
+func (r *GuardianRepository) ListChildren(ctx context.Context, guardianID string) ([]domain.Child, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.avatar_url, COALESCE(st.grade_level, ''), st.school_id, COALESCE(s.name, ''), gl.relationship
+		FROM guardian_links gl
+		JOIN users u ON gl.student_user_id = u.id
+		LEFT JOIN students st ON st.user_id = u.id
+		LEFT JOIN schools s ON st.school_id = s.id
+		WHERE gl.guardian_user_id = ? AND gl.status = ?
+		ORDER BY u.name`, guardianID, domain.GuardianLinkActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []domain.Child
+	for rows.Next() {
+		var c domain.Child
+		var avatarURL, schoolID sql.NullString
+		if err := rows.Scan(&c.UserID, &c.Name, &avatarURL, &c.GradeLevel, &schoolID, &c.SchoolName, &c.Relationship); err != nil {
+			return nil, err
+		}
+		if avatarURL.Valid {
+			c.AvatarURL = &avatarURL.String
+		}
+		if schoolID.Valid {
+			c.SchoolID = &schoolID.String
+		}
+		children = append(children, c)
+	}
+	return children, rows.Err()
+}
+
+// ListChildTeachers returns the teachers of the student's active and completed courses.
+func (r *GuardianRepository) ListChildTeachers(ctx context.Context, studentID string) ([]domain.ChildTeacher, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.avatar_url, c.id, c.title
+		FROM enrollments e
+		JOIN courses c ON e.course_id = c.id
+		JOIN users u ON c.teacher_id = u.id
+		WHERE e.student_user_id = ? AND e.status IN (?, ?)
+		ORDER BY c.title`, studentID, domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teachers []domain.ChildTeacher
+	for rows.Next() {
+		var t domain.ChildTeacher
+		var avatarURL sql.NullString
+		if err := rows.Scan(&t.UserID, &t.Name, &avatarURL, &t.CourseID, &t.CourseTitle); err != nil {
+			return nil, err
+		}
+		if avatarURL.Valid {
+			t.AvatarURL = &avatarURL.String
+		}
+		teachers = append(teachers, t)
+	}
+	return teachers, rows.Err()
+}
+
+// TeachesChildOf reports whether the teacher runs an active or completed course of one of
+// the guardian's children.
+func (r *GuardianRepository) TeachesChildOf(ctx context.Context, guardianID, teacherID string) (bool, error) {
+	var ok bool
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM guardian_links gl
+			JOIN enrollments e ON e.student_user_id = gl.student_user_id
+			JOIN courses c ON e.course_id = c.id
+			WHERE gl.guardian_user_id = ? AND gl.status = ?
+			  AND e.status IN (?, ?) AND c.teacher_id = ?
+		)`, guardianID, domain.GuardianLinkActive, domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted, teacherID).Scan(&ok)
+	return ok, err
+}
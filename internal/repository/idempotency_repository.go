@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+const (
+	// IdempotencyKeyTTL is how long a key is remembered; after that it can be reused.
+	IdempotencyKeyTTL = 24 * time.Hour
+	// IdempotencyLease is how long a request may hold its key while processing. A key
+	// still processing after that was left behind by a crashed server and can be retried.
+	IdempotencyLease = 5 * time.Minute
+)
+
+type IdempotencyRepository struct {
+	DB *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{DB: db}
+}
+
+// Reserve claims the user's key for a request. It returns the new processing record and
+// true, or the record already stored under the key and false. Expired keys and processing
+// keys whose lease ran out are claimed again.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	now := time.Now()
+	_, err := r.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ? AND (created_at < ? OR (status = 'processing' AND created_at < ?))`,
+		rec.UserID, rec.Key, now.Add(-IdempotencyKeyTTL), now.Add(-IdempotencyLease))
+	if err != nil {
+		return nil, false, err
+	}
+
+	rec.ID = uuid.New().String()
+	rec.Status = domain.IdempotencyStatusProcessing
+	rec.CreatedAt = now
+	res, err := r.DB.ExecContext(ctx, `
+		INSERT IGNORE INTO idempotency_keys (id, user_id, idempotency_key, method, path, request_hash, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.UserID, rec.Key, rec.Method, rec.Path, rec.RequestHash, rec.Status, rec.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return rec, true, nil
+	}
+
+	var existing domain.IdempotencyRecord
+	var status sql.NullInt64
+	err = r.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, idempotency_key, method, path, request_hash, status, response_status, response_content_type, response_body, created_at
+		FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`, rec.UserID, rec.Key).
+		Scan(&existing.ID, &existing.UserID, &existing.Key, &existing.Method, &existing.Path, &existing.RequestHash, &existing.Status,
+			&status, &existing.ResponseContentType, &existing.ResponseBody, &existing.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	existing.ResponseStatus = int(status.Int64)
+	return &existing, false, nil
+}
+
+// Complete stores the response for a reserved key.
+func (r *IdempotencyRepository) Complete(ctx context.Context, id string, status int, contentType string, body []byte) error {
+	_, err := r.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status = 'completed', response_status = ?, response_content_type = ?, response_body = ?, completed_at = NOW()
+		WHERE id = ?`, status, contentType, body, id)
+	return err
+}
+
+// Release forgets a reserved key so the request can be retried.
+func (r *IdempotencyRepository) Release(ctx context.Context, id string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+)
+
+// cutoff matches a time the given age before now.
+type cutoff time.Duration
+
+func (c cutoff) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	d := time.Since(t) - time.Duration(c)
+	return d >= 0 && d < time.Minute
+}
+
+func TestReserveReclaimsKeysPastTheirLease(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Completed keys are kept for a day; a processing key only for its lease.
+	mock.ExpectExec(`DELETE FROM idempotency_keys\s+WHERE user_id = \? AND idempotency_key = \? AND \(created_at < \? OR \(status = 'processing' AND created_at < \?\)\)`).
+		WithArgs("user-1", "key-1", cutoff(IdempotencyKeyTTL), cutoff(IdempotencyLease)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec, reserved, err := NewIdempotencyRepository(db).Reserve(context.Background(), &domain.IdempotencyRecord{UserID: "user-1", Key: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reserved || rec.Status != domain.IdempotencyStatusProcessing {
+		t.Fatalf("reserved = %v with status %q, want a new processing record", reserved, rec.Status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrLoginStateInvalid = errors.New("sign-in attempt is invalid or has expired")
+	ErrIdentityNotFound  = errors.New("identity not found")
+)
+
+type IdentityRepository struct {
+	DB *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{DB: db}
+}
+
+// CreateLoginState stores a login in progress, dropping expired ones along the way.
+func (r *IdentityRepository) CreateLoginState(ctx context.Context, stateHash, provider, nonce, codeVerifier string, expiresAt time.Time) error {
+	if _, err := r.DB.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, stateHash, provider, nonce, codeVerifier, expiresAt)
+	return err
+}
+
+// ConsumeLoginState removes an unexpired login state and returns its provider, nonce and
+// code verifier. A state can be consumed only once.
+func (r *IdentityRepository) ConsumeLoginState(ctx context.Context, stateHash string) (provider, nonce, codeVerifier string, err error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT provider, nonce, code_verifier FROM oidc_login_states
+		WHERE state_hash = ? AND expires_at > NOW() FOR UPDATE`, stateHash).Scan(&provider, &nonce, &codeVerifier)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", "", ErrLoginStateInvalid
+		}
+		return "", "", "", err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE state_hash = ?`, stateHash); err != nil {
+		return "", "", "", err
+	}
+	return provider, nonce, codeVerifier, tx.Commit()
+}
+
+// GetUserID returns the user the provider's account signs in as.
+func (r *IdentityRepository) GetUserID(ctx context.Context, provider, subject string) (string, error) {
+	var userID string
+	err := r.DB.QueryRowContext(ctx, `SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`, provider, subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrIdentityNotFound
+	}
+	return userID, err
+}
+
+// Link lets the provider's account sign in as the user.
+func (r *IdentityRepository) Link(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.ID = uuid.New().String()
+	identity.CreatedAt = time.Now()
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	return err
+}
+
+// RecordLogin notes that the identity was just used to sign in.
+func (r *IdentityRepository) RecordLogin(ctx context.Context, provider, subject, email string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE user_identities SET last_login_at = NOW(), email = ? WHERE provider = ? AND subject = ?`, email, provider, subject)
+	return err
+}
+
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID string) ([]domain.UserIdentity, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []domain.UserIdentity
+	for rows.Next() {
+		var i domain.UserIdentity
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		if lastLogin.Valid {
+			i.LastLoginAt = &lastLogin.Time
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
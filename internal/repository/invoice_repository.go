@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+type InvoiceRepository struct {
+	DB *sql.DB
+}
+
+func NewInvoiceRepository(db *sql.DB) *InvoiceRepository {
+	return &InvoiceRepository{DB: db}
+}
+
+// CreateIfMissing inserts an invoice unless one already exists for the same
+// enrollment and period. It reports whether a row was created.
+func (r *InvoiceRepository) CreateIfMissing(ctx context.Context, inv *domain.Invoice) (bool, error) {
+	if inv.ID == "" {
+		inv.ID = uuid.New().String()
+	}
+	if inv.Status == "" {
+		inv.Status = domain.InvoiceStatusOpen
+	}
+	query := `
+		INSERT IGNORE INTO invoices (id, enrollment_id, student_user_id, course_id, amount, status, period_start, period_end, due_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.DB.ExecContext(ctx, query, inv.ID, inv.EnrollmentID, inv.StudentUserID, inv.CourseID, inv.Amount, inv.Status, inv.PeriodStart, inv.PeriodEnd, inv.DueDate)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// FirstPeriodStart returns the earliest billed period of an enrollment, or "" if none.
+func (r *InvoiceRepository) FirstPeriodStart(ctx context.Context, enrollmentID string) (string, error) {
+	var start sql.NullString
+	query := `SELECT DATE_FORMAT(MIN(period_start), '%Y-%m-%d') FROM invoices WHERE enrollment_id = ?`
+	if err := r.DB.QueryRowContext(ctx, query, enrollmentID).Scan(&start); err != nil {
+		return "", err
+	}
+	return start.String, nil
+}
+
+const invoiceBaseSelect = `
+	SELECT i.id, i.enrollment_id, i.student_user_id, COALESCE(u.name, u.email) as student_name,
+	       i.course_id, c.title as course_title, i.amount, i.amount_paid, c.currency, i.status,
+	       DATE_FORMAT(i.period_start, '%Y-%m-%d'), DATE_FORMAT(i.period_end, '%Y-%m-%d'), DATE_FORMAT(i.due_date, '%Y-%m-%d'),
+	       i.created_at
+	FROM invoices i
+	JOIN users u ON i.student_user_id = u.id
+	JOIN courses c ON i.course_id = c.id
+`
+
+// ListByStudent returns all non-void invoices of a student, oldest first.
+func (r *InvoiceRepository) ListByStudent(ctx context.Context, studentUserID string) ([]domain.Invoice, error) {
+	query := invoiceBaseSelect + ` WHERE i.student_user_id = ? AND i.status != 'void' ORDER BY c.title, i.period_start`
+	return r.scan(ctx, query, studentUserID)
+}
+
+// ListByCourse returns all non-void invoices of a course.
+func (r *InvoiceRepository) ListByCourse(ctx context.Context, courseID string) ([]domain.Invoice, error) {
+	query := invoiceBaseSelect + ` WHERE i.course_id = ? AND i.status != 'void' ORDER BY i.period_start, student_name`
+	return r.scan(ctx, query, courseID)
+}
+
+// ListDebtorsByCourse returns students whose invoices due on or before asOf are not fully paid.
+func (r *InvoiceRepository) ListDebtorsByCourse(ctx context.Context, courseID, sectionID, asOf string) ([]domain.Debtor, error) {
+	query := `
+		SELECT i.student_user_id, COALESCE(u.name, u.email), COALESCE(u.email, ''), u.avatar_url,
+		       SUM(i.amount - i.amount_paid) as outstanding, COUNT(*),
+		       DATE_FORMAT(MIN(i.due_date), '%Y-%m-%d')
+		FROM invoices i
+		JOIN users u ON i.student_user_id = u.id
+		WHERE i.course_id = ? AND i.status IN ('open', 'partially_paid') AND i.due_date <= ?
+		  AND (? = '' OR EXISTS (SELECT 1 FROM enrollments e WHERE e.id = i.enrollment_id AND e.section_id = ?))
+		GROUP BY i.student_user_id, u.name, u.email, u.avatar_url
+		HAVING outstanding > 0
+		ORDER BY outstanding DESC
+	`
+	rows, err := r.DB.QueryContext(ctx, query, courseID, asOf, sectionID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var debtors []domain.Debtor
+	for rows.Next() {
+		var d domain.Debtor
+		var avatarURL sql.NullString
+		if err := rows.Scan(&d.StudentUserID, &d.StudentName, &d.StudentEmail, &avatarURL, &d.Outstanding, &d.OverdueInvoices, &d.OldestDueDate); err != nil {
+			return nil, err
+		}
+		if avatarURL.Valid {
+			d.StudentAvatar = &avatarURL.String
+		}
+		debtors = append(debtors, d)
+	}
+	return debtors, nil
+}
+
+// ReleasePayment trims a payment's allocations so they do not exceed what is left of it
+// after refunds. The most recent allocations are released first and their invoices reopen.
+func (r *InvoiceRepository) ReleasePayment(ctx context.Context, paymentID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var kept float64
+	if err := tx.QueryRowContext(ctx, `SELECT amount - refunded_amount FROM payments WHERE id = ? FOR UPDATE`, paymentID).Scan(&kept); err != nil {
+		return err
+	}
+
+	type allocation struct {
+		id        string
+		invoiceID string
+		amount    float64
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, invoice_id, amount FROM invoice_allocations
+		WHERE payment_id = ?
+		ORDER BY created_at DESC
+		FOR UPDATE
+	`, paymentID)
+	if err != nil {
+		return err
+	}
+	var allocations []allocation
+	var allocated float64
+	for rows.Next() {
+		var a allocation
+		if err := rows.Scan(&a.id, &a.invoiceID, &a.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		allocated += a.amount
+		allocations = append(allocations, a)
+	}
+	rows.Close()
+
+	excess := math.Round((allocated-kept)*100) / 100
+	for _, a := range allocations {
+		if excess <= 0 {
+			break
+		}
+		take := math.Min(a.amount, excess)
+		if take >= a.amount {
+			_, err = tx.ExecContext(ctx, `DELETE FROM invoice_allocations WHERE id = ?`, a.id)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE invoice_allocations SET amount = amount - ? WHERE id = ?`, take, a.id)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE invoices
+			SET amount_paid = GREATEST(amount_paid - ?, 0),
+			    status = IF(amount_paid <= 0, 'open', IF(amount_paid >= amount, 'paid', 'partially_paid'))
+			WHERE id = ? AND status != 'void'
+		`, take, a.invoiceID); err != nil {
+			return err
+		}
+		excess = math.Round((excess-take)*100) / 100
+	}
+
+	return tx.Commit()
+}
+
+// AllocatePayments spreads a student's successful, not yet allocated payments for a
+// course over their open invoices, oldest due date first. The invoices are locked for
+// the duration so concurrent calls cannot allocate the same money twice.
+func (r *InvoiceRepository) AllocatePayments(ctx context.Context, studentUserID, courseID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type openInvoice struct {
+		id        string
+		remaining float64
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, amount - amount_paid FROM invoices
+		WHERE student_user_id = ? AND course_id = ? AND status IN ('open', 'partially_paid')
+		ORDER BY due_date, period_start
+		FOR UPDATE
+	`, studentUserID, courseID)
+	if err != nil {
+		return err
+	}
+	var invoices []openInvoice
+	for rows.Next() {
+		var inv openInvoice
+		if err := rows.Scan(&inv.id, &inv.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		invoices = append(invoices, inv)
+	}
+	rows.Close()
+	if len(invoices) == 0 {
+		return nil
+	}
+
+	type unallocated struct {
+		id        string
+		remaining float64
+	}
+	rows, err = tx.QueryContext(ctx, `
+		SELECT p.id, p.amount - p.refunded_amount - COALESCE(SUM(a.amount), 0) as remaining
+		FROM payments p
+		LEFT JOIN invoice_allocations a ON a.payment_id = p.id
+		WHERE p.student_user_id = ? AND p.course_id = ? AND p.status IN ('success', 'partially_refunded')
+		GROUP BY p.id, p.amount, p.refunded_amount, p.paid_at
+		HAVING remaining > 0
+		ORDER BY p.paid_at
+	`, studentUserID, courseID)
+	if err != nil {
+		return err
+	}
+	var payments []unallocated
+	for rows.Next() {
+		var p unallocated
+		if err := rows.Scan(&p.id, &p.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+
+	i := 0
+	for _, p := range payments {
+		for p.remaining > 0.005 && i < len(invoices) {
+			amount := math.Min(p.remaining, invoices[i].remaining)
+			amount = math.Round(amount*100) / 100
+
+			if _, err := tx.ExecContext(ctx, `INSERT INTO invoice_allocations (id, invoice_id, payment_id, amount) VALUES (?, ?, ?, ?)`,
+				uuid.New().String(), invoices[i].id, p.id, amount); err != nil {
+				return err
+			}
+			// MySQL applies SET assignments left to right, so status sees the new amount_paid.
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE invoices
+				SET amount_paid = amount_paid + ?,
+				    status = IF(amount_paid >= amount, 'paid', 'partially_paid')
+				WHERE id = ?
+			`, amount, invoices[i].id); err != nil {
+				return err
+			}
+
+			p.remaining -= amount
+			invoices[i].remaining -= amount
+			if invoices[i].remaining <= 0.005 {
+				i++
+			}
+		}
+		if i >= len(invoices) {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *InvoiceRepository) scan(ctx context.Context, query string, args ...interface{}) ([]domain.Invoice, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []domain.Invoice
+	for rows.Next() {
+		var inv domain.Invoice
+		var periodEnd sql.NullString
+		if err := rows.Scan(&inv.ID, &inv.EnrollmentID, &inv.StudentUserID, &inv.StudentName, &inv.CourseID, &inv.CourseTitle,
+			&inv.Amount, &inv.AmountPaid, &inv.Currency, &inv.Status, &inv.PeriodStart, &periodEnd, &inv.DueDate, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		if periodEnd.Valid {
+			inv.PeriodEnd = &periodEnd.String
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, nil
+}
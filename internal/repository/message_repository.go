@@ -59,7 +59,7 @@ func (r *MessageRepository) ListConversations(ctx context.Context, userID string
 	query := `SELECT
 		sub.other_id,
 		COALESCE(u.name, u.email) as user_name,
-		u.email as user_email,
+		COALESCE(u.email, '') as user_email,
 		u.avatar_url,
 		sub.content as last_message,
 		sub.created_at as last_time,
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrResetTokenInvalid = errors.New("reset link is invalid or has expired")
+
+type PasswordResetRepository struct {
+	DB *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{DB: db}
+}
+
+// Create stores a new reset token for the user, invalidating any earlier unused ones.
+func (r *PasswordResetRepository) Create(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at) VALUES (?, ?, ?, ?)`,
+		uuid.New().String(), userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword sets the password of the token's user and marks the token used, in one
+// transaction. Tokens that are unknown, used or expired yield ErrResetTokenInvalid.
+func (r *PasswordResetRepository) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id, userID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW() FOR UPDATE`, tokenHash).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrResetTokenInvalid
+		}
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE id = ?`, id); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ?, failed_login_count = 0, locked_until = NULL, updated_at = NOW() WHERE id = ?`, hashedPassword, userID); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
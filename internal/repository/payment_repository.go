@@ -3,6 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"math"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/schooltj/internal/domain"
@@ -24,28 +27,59 @@ func (r *PaymentRepository) RecordPayment(ctx context.Context, p *domain.Payment
 	if p.Status == "" {
 		p.Status = domain.PaymentStatusSuccess // Default to success for manual records
 	}
+	if p.Currency == "" {
+		p.Currency = domain.BaseCurrency
+	}
+	if p.ExchangeRate == 0 {
+		p.ExchangeRate = 1
+	}
 	query := `
-		INSERT INTO payments (id, student_user_id, course_id, amount, method, status, external_id, note, receipt_url, recorded_by, paid_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO payments (id, student_user_id, course_id, amount, currency, exchange_rate, method, status, external_id, note, receipt_url, recorded_by, paid_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := r.DB.ExecContext(ctx, query, p.ID, p.StudentUserID, p.CourseID, p.Amount, p.Method, p.Status, p.ExternalID, p.Note, p.ReceiptURL, p.RecordedBy, p.PaidAt)
+	_, err := r.DB.ExecContext(ctx, query, p.ID, p.StudentUserID, p.CourseID, p.Amount, p.Currency, p.ExchangeRate, p.Method, p.Status, p.ExternalID, p.Note, p.ReceiptURL, p.RecordedBy, p.PaidAt)
 	return err
 }
 
-// UpdateStatus updates the status and external ID of an existing payment.
-func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, status string, externalID string) error {
-	query := `UPDATE payments SET status = ?, external_id = ?, updated_at = NOW() WHERE id = ?`
-	_, err := r.DB.ExecContext(ctx, query, status, externalID, id)
-	return err
+// UpdateStatus updates the status and external ID of a pending payment. It reports false
+// if the payment was no longer pending, e.g. because a callback settled it first.
+func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, status string, externalID string) (bool, error) {
+	query := `UPDATE payments SET status = ?, external_id = ?, updated_at = NOW() WHERE id = ? AND status = ?`
+	res, err := r.DB.ExecContext(ctx, query, status, externalID, id, domain.PaymentStatusPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CourseCurrency returns the currency a course is priced in; payments for it use the same one.
+func (r *PaymentRepository) CourseCurrency(ctx context.Context, courseID string) (string, error) {
+	var currency string
+	err := r.DB.QueryRowContext(ctx, `SELECT currency FROM courses WHERE id = ?`, courseID).Scan(&currency)
+	return currency, err
 }
 
-// UpdateStatusByExternalID updates the status of a payment found by its external provider ID.
-func (r *PaymentRepository) UpdateStatusByExternalID(ctx context.Context, externalID string, status string) error {
-	query := `UPDATE payments SET status = ?, updated_at = NOW() WHERE external_id = ?`
-	_, err := r.DB.ExecContext(ctx, query, status, externalID)
+// SetReceiptURL points a payment at its generated receipt unless the client already supplied one.
+func (r *PaymentRepository) SetReceiptURL(ctx context.Context, id, url string) error {
+	query := `UPDATE payments SET receipt_url = ? WHERE id = ? AND (receipt_url IS NULL OR receipt_url = '')`
+	_, err := r.DB.ExecContext(ctx, query, url, id)
 	return err
 }
 
+// UpdateStatusByExternalID moves a pending payment, found by its external provider ID, to
+// status. It reports false if the payment was no longer pending, so that of two callbacks
+// racing for the same payment only one applies its outcome.
+func (r *PaymentRepository) UpdateStatusByExternalID(ctx context.Context, externalID string, status string) (bool, error) {
+	query := `UPDATE payments SET status = ?, updated_at = NOW() WHERE external_id = ? AND status = ?`
+	res, err := r.DB.ExecContext(ctx, query, status, externalID, domain.PaymentStatusPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
 func (r *PaymentRepository) GetByExternalID(ctx context.Context, externalID string) (*domain.Payment, error) {
 	query := paymentBaseSelect + ` WHERE p.external_id = ?`
 	payments, err := r.scan(ctx, query, externalID)
@@ -72,20 +106,23 @@ func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Pay
 
 const paymentBaseSelect = `
 	SELECT p.id, p.student_user_id, COALESCE(u.name, u.email) as student_name, u.avatar_url as student_avatar,
-	       p.course_id, c.title as course_title,
-	       p.amount, p.method, p.status, p.external_id, COALESCE(p.note,''), COALESCE(p.receipt_url,''),
+	       p.course_id, c.title as course_title, sec.id, COALESCE(sec.name, ''),
+	       p.amount, p.currency, p.exchange_rate, p.refunded_amount, p.method, p.status, p.external_id, COALESCE(p.note,''), COALESCE(p.receipt_url,''),
 	       p.recorded_by, COALESCE(rb.name, rb.email) as recorded_by_name,
 	       p.paid_at, p.created_at
 	FROM payments p
 	JOIN users u ON p.student_user_id = u.id
 	JOIN courses c ON p.course_id = c.id
 	JOIN users rb ON p.recorded_by = rb.id
+	LEFT JOIN course_sections sec ON sec.id = (
+		SELECT e.section_id FROM enrollments e WHERE e.course_id = p.course_id AND e.student_user_id = p.student_user_id LIMIT 1)
 `
 
-// ListByCourse returns all payments for a course.
-func (r *PaymentRepository) ListByCourse(ctx context.Context, courseID string) ([]domain.Payment, error) {
-	query := paymentBaseSelect + ` WHERE p.course_id = ? ORDER BY p.paid_at DESC`
-	return r.scan(ctx, query, courseID)
+// ListByCourse returns all payments for a course, or those from one of its sections'
+// students when sectionID is set.
+func (r *PaymentRepository) ListByCourse(ctx context.Context, courseID, sectionID string) ([]domain.Payment, error) {
+	query := paymentBaseSelect + ` WHERE p.course_id = ? AND (? = '' OR sec.id = ?) ORDER BY p.paid_at DESC`
+	return r.scan(ctx, query, courseID, sectionID, sectionID)
 }
 
 // ListByStudent returns all payments for a student.
@@ -94,19 +131,17 @@ func (r *PaymentRepository) ListByStudent(ctx context.Context, studentUserID str
 	return r.scan(ctx, query, studentUserID)
 }
 
-// ListByTeacher returns payments from courses where the given user is the teacher.
+// ListByTeacher returns payments from courses where the given user is the teacher, and
+// from the students of sections they teach.
 func (r *PaymentRepository) ListByTeacher(ctx context.Context, teacherID string) ([]domain.Payment, error) {
-	query := paymentBaseSelect + ` WHERE c.teacher_id = ? ORDER BY p.paid_at DESC`
-	return r.scan(ctx, query, teacherID)
+	query := paymentBaseSelect + ` WHERE c.teacher_id = ? OR sec.teacher_id = ? ORDER BY p.paid_at DESC`
+	return r.scan(ctx, query, teacherID, teacherID)
 }
 
-// ListBySchoolAdmin returns payments from courses belonging to the admin's school.
-func (r *PaymentRepository) ListBySchoolAdmin(ctx context.Context, adminID string) ([]domain.Payment, error) {
-	query := paymentBaseSelect + `
-		WHERE c.school_id = (SELECT id FROM schools WHERE admin_user_id = ? LIMIT 1)
-		ORDER BY p.paid_at DESC
-	`
-	return r.scan(ctx, query, adminID)
+// ListBySchool returns payments from courses belonging to the school.
+func (r *PaymentRepository) ListBySchool(ctx context.Context, schoolID, branchID string) ([]domain.Payment, error) {
+	query := paymentBaseSelect + ` WHERE c.school_id = ? AND (? = '' OR c.branch_id = ?) ORDER BY p.paid_at DESC`
+	return r.scan(ctx, query, schoolID, branchID, branchID)
 }
 
 // ListAll returns all payments (for admin).
@@ -115,6 +150,14 @@ func (r *PaymentRepository) ListAll(ctx context.Context) ([]domain.Payment, erro
 	return r.scan(ctx, query)
 }
 
+// StudentSection returns the section the student is in on the course, or "" for none.
+func (r *PaymentRepository) StudentSection(ctx context.Context, courseID, studentUserID string) (string, error) {
+	var sectionID string
+	err := r.DB.QueryRowContext(ctx, `SELECT COALESCE((SELECT section_id FROM enrollments WHERE course_id = ? AND student_user_id = ? LIMIT 1), '')`,
+		courseID, studentUserID).Scan(&sectionID)
+	return sectionID, err
+}
+
 // GetTotalPaidForEnrollment returns the total amount paid by a student for a course.
 func (r *PaymentRepository) GetTotalPaidForEnrollment(ctx context.Context, studentUserID, courseID string) (float64, error) {
 	query := `SELECT COALESCE(SUM(amount), 0) FROM payments WHERE student_user_id = ? AND course_id = ?`
@@ -123,6 +166,203 @@ func (r *PaymentRepository) GetTotalPaidForEnrollment(ctx context.Context, stude
 	return total, err
 }
 
+// ErrRefundExceedsPayment is returned when a refund would return more than was paid.
+var ErrRefundExceedsPayment = errors.New("refund exceeds refundable amount")
+
+// ErrPaymentNotRefundable is returned for payments that never settled.
+var ErrPaymentNotRefundable = errors.New("only successful payments can be refunded")
+
+// refreshRefundStatus recomputes a payment's status from its refunded_amount.
+// MySQL applies SET assignments left to right, so it must follow the refunded_amount update.
+const refreshRefundStatus = `status = IF(refunded_amount <= 0, 'success', IF(refunded_amount >= amount, 'refunded', 'partially_refunded'))`
+
+// ReserveRefund records a pending refund and counts it against the payment in one
+// transaction, so concurrent refunds cannot return more than was paid.
+// An amount of 0 refunds whatever is left.
+func (r *PaymentRepository) ReserveRefund(ctx context.Context, ref *domain.Refund) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var amount, refunded float64
+	var status string
+	err = tx.QueryRowContext(ctx, `SELECT amount, refunded_amount, status FROM payments WHERE id = ? FOR UPDATE`, ref.PaymentID).
+		Scan(&amount, &refunded, &status)
+	if err != nil {
+		return err
+	}
+	if status != domain.PaymentStatusSuccess && status != domain.PaymentStatusPartiallyRefunded {
+		return ErrPaymentNotRefundable
+	}
+
+	left := math.Round((amount-refunded)*100) / 100
+	if ref.Amount == 0 {
+		ref.Amount = left
+	}
+	ref.Amount = math.Round(ref.Amount*100) / 100
+	if ref.Amount <= 0 || ref.Amount > left {
+		return ErrRefundExceedsPayment
+	}
+
+	if ref.ID == "" {
+		ref.ID = uuid.New().String()
+	}
+	ref.Status = domain.RefundStatusPending
+	if _, err := tx.ExecContext(ctx, `INSERT INTO refunds (id, payment_id, amount, reason, status, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		ref.ID, ref.PaymentID, ref.Amount, ref.Reason, ref.Status, ref.CreatedBy); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE payments SET refunded_amount = refunded_amount + ?, `+refreshRefundStatus+`, updated_at = NOW() WHERE id = ?`,
+		ref.Amount, ref.PaymentID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompleteRefund marks a reserved refund as done. It reports false if the refund was no
+// longer pending.
+func (r *PaymentRepository) CompleteRefund(ctx context.Context, refundID, externalID string) (bool, error) {
+	query := `UPDATE refunds SET status = ?, external_id = ?, updated_at = NOW() WHERE id = ? AND status = ?`
+	result, err := r.DB.ExecContext(ctx, query, domain.RefundStatusSuccess, externalID, refundID, domain.RefundStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// FailRefund marks a reserved refund as failed and releases its amount on the payment.
+func (r *PaymentRepository) FailRefund(ctx context.Context, ref *domain.Refund) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE refunds SET status = ?, updated_at = NOW() WHERE id = ? AND status = ?`,
+		domain.RefundStatusFailed, ref.ID, domain.RefundStatusPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE payments SET refunded_amount = GREATEST(refunded_amount - ?, 0), `+refreshRefundStatus+`, updated_at = NOW() WHERE id = ?`,
+		ref.Amount, ref.PaymentID); err != nil {
+		return err
+	}
+	ref.Status = domain.RefundStatusFailed
+	return tx.Commit()
+}
+
+// ListRefunds returns all refunds of a payment, newest first.
+func (r *PaymentRepository) ListRefunds(ctx context.Context, paymentID string) ([]domain.Refund, error) {
+	return r.scanRefunds(ctx, refundSelect+` WHERE payment_id = ? ORDER BY created_at DESC`, paymentID)
+}
+
+// ListStalePendingRefunds returns refunds still pending that were requested before the
+// given time, oldest first.
+func (r *PaymentRepository) ListStalePendingRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Refund, error) {
+	return r.scanRefunds(ctx, refundSelect+` WHERE status = ? AND created_at < ? ORDER BY created_at ASC LIMIT ?`,
+		domain.RefundStatusPending, before, limit)
+}
+
+const refundSelect = `
+	SELECT id, payment_id, amount, COALESCE(reason,''), status, COALESCE(external_id,''), created_by, created_at
+	FROM refunds
+`
+
+func (r *PaymentRepository) scanRefunds(ctx context.Context, query string, args ...interface{}) ([]domain.Refund, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []domain.Refund
+	for rows.Next() {
+		var ref domain.Refund
+		if err := rows.Scan(&ref.ID, &ref.PaymentID, &ref.Amount, &ref.Reason, &ref.Status, &ref.ExternalID, &ref.CreatedBy, &ref.CreatedAt); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, ref)
+	}
+	return refunds, nil
+}
+
+// ListStalePending returns pending payments created before the given time, those never
+// checked first and then those checked longest ago.
+func (r *PaymentRepository) ListStalePending(ctx context.Context, before time.Time, limit int) ([]domain.Payment, error) {
+	query := paymentBaseSelect + ` WHERE p.status = ? AND p.created_at < ?
+		ORDER BY p.last_checked_at IS NOT NULL, p.last_checked_at ASC, p.created_at ASC LIMIT ?`
+	return r.scan(ctx, query, domain.PaymentStatusPending, before, limit)
+}
+
+// MarkChecked records that the reconciler asked about a payment, which sends it to the
+// back of the queue. It leaves updated_at alone as the payment itself did not change.
+func (r *PaymentRepository) MarkChecked(ctx context.Context, id string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE payments SET last_checked_at = NOW(), updated_at = updated_at WHERE id = ?`, id)
+	return err
+}
+
+// RecordReconciliation stores a status change made by the reconciler.
+func (r *PaymentRepository) RecordReconciliation(ctx context.Context, rec *domain.PaymentReconciliation) error {
+	if rec.ID == "" {
+		rec.ID = uuid.New().String()
+	}
+	query := `
+		INSERT INTO payment_reconciliations (id, payment_id, provider, external_id, old_status, new_status, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.DB.ExecContext(ctx, query, rec.ID, rec.PaymentID, rec.Provider, rec.ExternalID, rec.OldStatus, rec.NewStatus, rec.Reason)
+	return err
+}
+
+const reconciliationBaseSelect = `
+	SELECT pr.id, pr.payment_id, pr.provider, COALESCE(pr.external_id,''), pr.old_status, pr.new_status, COALESCE(pr.reason,''),
+	       COALESCE(u.name, u.email) as student_name, c.title as course_title, p.amount, pr.created_at
+	FROM payment_reconciliations pr
+	JOIN payments p ON pr.payment_id = p.id
+	JOIN users u ON p.student_user_id = u.id
+	JOIN courses c ON p.course_id = c.id
+`
+
+// ListReconciliations returns the most recent reconciler changes across all schools.
+func (r *PaymentRepository) ListReconciliations(ctx context.Context, limit int) ([]domain.PaymentReconciliation, error) {
+	query := reconciliationBaseSelect + ` ORDER BY pr.created_at DESC LIMIT ?`
+	return r.scanReconciliations(ctx, query, limit)
+}
+
+// ListReconciliationsBySchool returns reconciler changes for payments in the school.
+func (r *PaymentRepository) ListReconciliationsBySchool(ctx context.Context, schoolID, branchID string, limit int) ([]domain.PaymentReconciliation, error) {
+	query := reconciliationBaseSelect + ` WHERE c.school_id = ? AND (? = '' OR c.branch_id = ?) ORDER BY pr.created_at DESC LIMIT ?`
+	return r.scanReconciliations(ctx, query, schoolID, branchID, branchID, limit)
+}
+
+func (r *PaymentRepository) scanReconciliations(ctx context.Context, query string, args ...interface{}) ([]domain.PaymentReconciliation, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []domain.PaymentReconciliation
+	for rows.Next() {
+		var rec domain.PaymentReconciliation
+		if err := rows.Scan(&rec.ID, &rec.PaymentID, &rec.Provider, &rec.ExternalID, &rec.OldStatus, &rec.NewStatus, &rec.Reason,
+			&rec.StudentName, &rec.CourseTitle, &rec.Amount, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
 func (r *PaymentRepository) scan(ctx context.Context, query string, args ...interface{}) ([]domain.Payment, error) {
 	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -134,8 +374,8 @@ func (r *PaymentRepository) scan(ctx context.Context, query string, args ...inte
 	for rows.Next() {
 		var p domain.Payment
 		var avatarURL sql.NullString
-		if err := rows.Scan(&p.ID, &p.StudentUserID, &p.StudentName, &avatarURL, &p.CourseID, &p.CourseTitle,
-			&p.Amount, &p.Method, &p.Status, &p.ExternalID, &p.Note, &p.ReceiptURL, &p.RecordedBy, &p.RecordedByName, &p.PaidAt, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.StudentUserID, &p.StudentName, &avatarURL, &p.CourseID, &p.CourseTitle, &p.SectionID, &p.SectionName,
+			&p.Amount, &p.Currency, &p.ExchangeRate, &p.RefundedAmount, &p.Method, &p.Status, &p.ExternalID, &p.Note, &p.ReceiptURL, &p.RecordedBy, &p.RecordedByName, &p.PaidAt, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		if avatarURL.Valid {
@@ -0,0 +1,399 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var ErrPayoutStatementPaid = errors.New("payout statement is already paid")
+
+type PayoutRepository struct {
+	DB *sql.DB
+}
+
+func NewPayoutRepository(db *sql.DB) *PayoutRepository {
+	return &PayoutRepository{DB: db}
+}
+
+func (r *PayoutRepository) GetPayoutSettings(ctx context.Context, schoolID string) (*domain.PayoutSettings, error) {
+	var settings domain.PayoutSettings
+	err := r.DB.QueryRowContext(ctx, `SELECT payout_mode, teacher_share_percent FROM schools WHERE id = ?`, schoolID).
+		Scan(&settings.Mode, &settings.TeacherSharePercent)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *PayoutRepository) SetPayoutSettings(ctx context.Context, schoolID string, settings domain.PayoutSettings) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE schools SET payout_mode = ?, teacher_share_percent = ?, updated_at = NOW() WHERE id = ?`,
+		settings.Mode, settings.TeacherSharePercent, schoolID)
+	return err
+}
+
+// payoutTeachers pairs each course with the teachers paid for it: its own teacher and
+// the teachers of its sections. A course's sessions and students belong to the teacher of
+// their section, and to the course's own teacher when they are in no section or their
+// section has no teacher.
+const payoutTeachers = `
+	SELECT id AS course_id, teacher_id FROM courses WHERE teacher_id IS NOT NULL
+	UNION
+	SELECT course_id, teacher_id FROM course_sections WHERE teacher_id IS NOT NULL
+`
+
+// paymentTeacher is the teacher a payment aliased p on the course aliased c is paid to:
+// the teacher of the section of the student's latest enrollment, else the course's.
+const paymentTeacher = `COALESCE((
+	SELECT s.teacher_id FROM enrollments e LEFT JOIN course_sections s ON e.section_id = s.id
+	WHERE e.course_id = p.course_id AND e.student_user_id = p.student_user_id
+	ORDER BY e.enrolled_at DESC LIMIT 1), c.teacher_id)`
+
+// ListTeacherCourses returns the school's courses once for each teacher paid for them,
+// optionally only one teacher's, with TeacherID set to that teacher. Only the fields
+// payouts need are populated.
+func (r *PayoutRepository) ListTeacherCourses(ctx context.Context, schoolID, teacherID string) ([]domain.Course, error) {
+	query := `
+		SELECT c.id, c.title, c.schedule, t.teacher_id, COALESCE(u.name, u.email)
+		FROM courses c
+		JOIN (` + payoutTeachers + `) t ON t.course_id = c.id
+		JOIN users u ON t.teacher_id = u.id
+		WHERE c.school_id = ?`
+	args := []interface{}{schoolID}
+	if teacherID != "" {
+		query += ` AND t.teacher_id = ?`
+		args = append(args, teacherID)
+	}
+	query += ` ORDER BY c.title`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []domain.Course
+	for rows.Next() {
+		var course domain.Course
+		var scheduleJSON []byte
+		var teacherID string
+		if err := rows.Scan(&course.ID, &course.Title, &scheduleJSON, &teacherID, &course.TeacherName); err != nil {
+			return nil, err
+		}
+		course.TeacherID = &teacherID
+		course.Schedule = parseSchedule(scheduleJSON)
+		courses = append(courses, course)
+	}
+	return courses, nil
+}
+
+// ListTeacherSchoolIDs returns the schools where the teacher runs at least one course or section.
+func (r *PayoutRepository) ListTeacherSchoolIDs(ctx context.Context, teacherID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT c.school_id
+		FROM courses c
+		JOIN (` + payoutTeachers + `) t ON t.course_id = c.id
+		WHERE t.teacher_id = ? AND c.school_id IS NOT NULL`
+	rows, err := r.DB.QueryContext(ctx, query, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ListRevenueMovements returns the money a course took in during [from, to) from the
+// students the teacher is paid for: settled payments by paid_at, and successful refunds by
+// the date they were issued with a negative Amount. Each movement carries the currency,
+// rate snapshot and paid_at of its payment.
+func (r *PayoutRepository) ListRevenueMovements(ctx context.Context, courseID, teacherID string, from, to time.Time) ([]domain.Payment, error) {
+	query := `
+		SELECT p.amount, p.currency, p.exchange_rate, p.paid_at
+		FROM payments p
+		JOIN courses c ON p.course_id = c.id
+		WHERE p.course_id = ? AND ` + paymentTeacher + ` = ?
+		  AND p.status IN ('success', 'partially_refunded', 'refunded') AND p.paid_at >= ? AND p.paid_at < ?
+		UNION ALL
+		SELECT -rf.amount, p.currency, p.exchange_rate, p.paid_at
+		FROM refunds rf
+		JOIN payments p ON rf.payment_id = p.id
+		JOIN courses c ON p.course_id = c.id
+		WHERE p.course_id = ? AND ` + paymentTeacher + ` = ?
+		  AND rf.status = 'success' AND rf.created_at >= ? AND rf.created_at < ?
+	`
+	rows, err := r.DB.QueryContext(ctx, query, courseID, teacherID, from, to, courseID, teacherID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []domain.Payment
+	for rows.Next() {
+		var p domain.Payment
+		if err := rows.Scan(&p.Amount, &p.Currency, &p.ExchangeRate, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		p.CourseID = courseID
+		movements = append(movements, p)
+	}
+	return movements, nil
+}
+
+// PayoutSessions is how many sessions a teacher held for one section of a course, or for
+// the course itself, and the schedule that sets their length.
+type PayoutSessions struct {
+	Sessions int
+	Schedule *domain.Schedule // the section's, else the course's
+}
+
+// CountSessions counts, per section, the days in [from, to) on which attendance was taken
+// for the course in the sessions the teacher is paid for.
+func (r *PayoutRepository) CountSessions(ctx context.Context, courseID, teacherID string, from, to time.Time) ([]PayoutSessions, error) {
+	query := `
+		SELECT COUNT(DISTINCT a.date), ANY_VALUE(COALESCE(s.schedule, c.schedule))
+		FROM attendance a
+		JOIN courses c ON a.course_id = c.id
+		LEFT JOIN course_sections s ON a.section_id = s.id
+		WHERE a.course_id = ? AND COALESCE(s.teacher_id, c.teacher_id) = ? AND a.date >= ? AND a.date < ?
+		GROUP BY a.section_id
+	`
+	rows, err := r.DB.QueryContext(ctx, query, courseID, teacherID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []PayoutSessions
+	for rows.Next() {
+		var ps PayoutSessions
+		var scheduleJSON []byte
+		if err := rows.Scan(&ps.Sessions, &scheduleJSON); err != nil {
+			return nil, err
+		}
+		ps.Schedule = parseSchedule(scheduleJSON)
+		sessions = append(sessions, ps)
+	}
+	return sessions, rows.Err()
+}
+
+func parseSchedule(scheduleJSON []byte) *domain.Schedule {
+	if len(scheduleJSON) == 0 {
+		return nil
+	}
+	var schedule domain.Schedule
+	if err := json.Unmarshal(scheduleJSON, &schedule); err != nil {
+		return nil
+	}
+	return &schedule
+}
+
+// DeleteStalePendingStatements removes the school's pending statements for a period
+// (YYYY-MM), optionally only one teacher's, except those of the teachers in keep: after a
+// recomputation they are the teachers with nothing to be paid any more.
+func (r *PayoutRepository) DeleteStalePendingStatements(ctx context.Context, schoolID, period, teacherID string, keep []string) error {
+	query := `DELETE FROM payout_statements WHERE school_id = ? AND period = ? AND status = 'pending'`
+	args := []interface{}{schoolID, period + "-01"}
+	if teacherID != "" {
+		query += ` AND teacher_id = ?`
+		args = append(args, teacherID)
+	}
+	if len(keep) > 0 {
+		query += ` AND teacher_id NOT IN (?` + strings.Repeat(", ?", len(keep)-1) + `)`
+		for _, id := range keep {
+			args = append(args, id)
+		}
+	}
+	_, err := r.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// SaveStatement creates or recomputes the statement for the school, teacher and period,
+// replacing its lines. Paid statements are frozen and yield ErrPayoutStatementPaid.
+func (r *PayoutRepository) SaveStatement(ctx context.Context, st *domain.PayoutStatement) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	period := st.Period + "-01"
+	var id, status string
+	err = tx.QueryRowContext(ctx, `SELECT id, status FROM payout_statements WHERE school_id = ? AND teacher_id = ? AND period = ? FOR UPDATE`,
+		st.SchoolID, st.TeacherID, period).Scan(&id, &status)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		id = uuid.New().String()
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO payout_statements (id, school_id, teacher_id, period, mode, currency, revenue, sessions, hours, amount, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending')`,
+			id, st.SchoolID, st.TeacherID, period, st.Mode, st.Currency, st.Revenue, st.Sessions, st.Hours, st.Amount)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case status == domain.PayoutStatusPaid:
+		return ErrPayoutStatementPaid
+	default:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payout_statements SET mode = ?, currency = ?, revenue = ?, sessions = ?, hours = ?, amount = ?
+			WHERE id = ?`,
+			st.Mode, st.Currency, st.Revenue, st.Sessions, st.Hours, st.Amount, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM payout_lines WHERE statement_id = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	for _, line := range st.Lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO payout_lines (id, statement_id, course_id, revenue, sessions, hours, rate, amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), id, line.CourseID, line.Revenue, line.Sessions, line.Hours, line.Rate, line.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	st.ID = id
+	st.Status = domain.PayoutStatusPending
+	return nil
+}
+
+const payoutStatementSelect = `
+	SELECT ps.id, ps.school_id, s.name, ps.teacher_id, COALESCE(u.name, u.email), DATE_FORMAT(ps.period, '%Y-%m'),
+	       ps.mode, ps.currency, ps.revenue, ps.sessions, ps.hours, ps.amount, ps.status,
+	       ps.paid_at, ps.paid_by, ps.reference, ps.created_at, ps.updated_at
+	FROM payout_statements ps
+	JOIN schools s ON ps.school_id = s.id
+	JOIN users u ON ps.teacher_id = u.id
+`
+
+func (r *PayoutRepository) GetStatement(ctx context.Context, id string) (*domain.PayoutStatement, error) {
+	statements, err := r.queryStatements(ctx, payoutStatementSelect+` WHERE ps.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &statements[0], nil
+}
+
+// ListStatementsBySchool returns the school's statements for a period (YYYY-MM).
+func (r *PayoutRepository) ListStatementsBySchool(ctx context.Context, schoolID, period string) ([]domain.PayoutStatement, error) {
+	return r.queryStatements(ctx, payoutStatementSelect+` WHERE ps.school_id = ? AND ps.period = ? ORDER BY u.name`, schoolID, period+"-01")
+}
+
+// ListStatementsByTeacher returns a teacher's statements across schools, newest first.
+func (r *PayoutRepository) ListStatementsByTeacher(ctx context.Context, teacherID string, limit int) ([]domain.PayoutStatement, error) {
+	return r.queryStatements(ctx, payoutStatementSelect+` WHERE ps.teacher_id = ? ORDER BY ps.period DESC, s.name LIMIT ?`, teacherID, limit)
+}
+
+// MarkStatementPaid settles a pending statement of the school.
+func (r *PayoutRepository) MarkStatementPaid(ctx context.Context, id, schoolID, paidBy, reference string) error {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE payout_statements SET status = 'paid', paid_at = NOW(), paid_by = ?, reference = ?
+		WHERE id = ? AND school_id = ? AND status = 'pending'`,
+		paidBy, reference, id, schoolID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var status string
+	if err := r.DB.QueryRowContext(ctx, `SELECT status FROM payout_statements WHERE id = ? AND school_id = ?`, id, schoolID).Scan(&status); err != nil {
+		return err
+	}
+	return ErrPayoutStatementPaid
+}
+
+func (r *PayoutRepository) queryStatements(ctx context.Context, query string, args ...interface{}) ([]domain.PayoutStatement, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []domain.PayoutStatement
+	for rows.Next() {
+		var st domain.PayoutStatement
+		var paidAt sql.NullTime
+		var paidBy sql.NullString
+		if err := rows.Scan(&st.ID, &st.SchoolID, &st.SchoolName, &st.TeacherID, &st.TeacherName, &st.Period,
+			&st.Mode, &st.Currency, &st.Revenue, &st.Sessions, &st.Hours, &st.Amount, &st.Status,
+			&paidAt, &paidBy, &st.Reference, &st.CreatedAt, &st.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if paidAt.Valid {
+			st.PaidAt = &paidAt.Time
+		}
+		if paidBy.Valid {
+			st.PaidBy = &paidBy.String
+		}
+		st.Lines = []domain.PayoutLine{}
+		statements = append(statements, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return statements, nil
+	}
+
+	return statements, r.attachLines(ctx, statements)
+}
+
+func (r *PayoutRepository) attachLines(ctx context.Context, statements []domain.PayoutStatement) error {
+	index := make(map[string]int, len(statements))
+	placeholders := make([]string, len(statements))
+	args := make([]interface{}, len(statements))
+	for i, st := range statements {
+		index[st.ID] = i
+		placeholders[i] = "?"
+		args[i] = st.ID
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT pl.statement_id, pl.course_id, COALESCE(c.title, ''), pl.revenue, pl.sessions, pl.hours, pl.rate, pl.amount
+		FROM payout_lines pl
+		LEFT JOIN courses c ON pl.course_id = c.id
+		WHERE pl.statement_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY c.title`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var statementID string
+		var line domain.PayoutLine
+		if err := rows.Scan(&statementID, &line.CourseID, &line.CourseTitle, &line.Revenue, &line.Sessions, &line.Hours, &line.Rate, &line.Amount); err != nil {
+			return err
+		}
+		i := index[statementID]
+		statements[i].Lines = append(statements[i].Lines, line)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var ErrOTPInvalid = errors.New("code is invalid or has expired")
+
+type PhoneOTPRepository struct {
+	DB *sql.DB
+}
+
+func NewPhoneOTPRepository(db *sql.DB) *PhoneOTPRepository {
+	return &PhoneOTPRepository{DB: db}
+}
+
+// Create stores a new code for the phone, invalidating any earlier unused ones.
+func (r *PhoneOTPRepository) Create(ctx context.Context, phone, codeHash, ip string, expiresAt time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE phone_otps SET consumed_at = NOW() WHERE phone = ? AND consumed_at IS NULL`, phone); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO phone_otps (id, phone, code_hash, ip_address, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), phone, codeHash, ip, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CountSentToPhone counts the codes issued for a phone since a point in time.
+func (r *PhoneOTPRepository) CountSentToPhone(ctx context.Context, phone string, since time.Time) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM phone_otps WHERE phone = ? AND created_at >= ?`, phone, since).Scan(&n)
+	return n, err
+}
+
+// CountRequestedFromIP counts the codes requested from an IP address since a point in time.
+func (r *PhoneOTPRepository) CountRequestedFromIP(ctx context.Context, ip string, since time.Time) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM phone_otps WHERE ip_address = ? AND created_at >= ?`, ip, since).Scan(&n)
+	return n, err
+}
+
+// Consume checks a code against the phone's latest live one. A wrong code uses up an
+// attempt; once maxAttempts are spent the code is dead. A matching code is consumed so it
+// works only once. Either failure yields ErrOTPInvalid.
+func (r *PhoneOTPRepository) Consume(ctx context.Context, phone, codeHash string, maxAttempts int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var otp domain.PhoneOTP
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, phone, code_hash, attempts, expires_at FROM phone_otps
+		WHERE phone = ? AND consumed_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC LIMIT 1 FOR UPDATE`, phone).
+		Scan(&otp.ID, &otp.Phone, &otp.CodeHash, &otp.Attempts, &otp.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOTPInvalid
+		}
+		return err
+	}
+
+	if otp.CodeHash != codeHash {
+		// Commit the spent attempt even though the caller gets an error.
+		_, err = tx.ExecContext(ctx, `
+			UPDATE phone_otps SET attempts = attempts + 1, consumed_at = IF(attempts >= ?, NOW(), consumed_at)
+			WHERE id = ?`, maxAttempts, otp.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrOTPInvalid
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE phone_otps SET consumed_at = NOW() WHERE id = ?`, otp.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
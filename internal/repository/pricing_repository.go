@@ -0,0 +1,434 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var ErrPromoCodeExhausted = errors.New("promo code usage limit reached")
+
+type PricingRepository struct {
+	DB *sql.DB
+}
+
+func NewPricingRepository(db *sql.DB) *PricingRepository {
+	return &PricingRepository{DB: db}
+}
+
+const promoCodeSelect = `
+	SELECT id, code, school_id, course_id, created_by, discount_type, value, currency, max_uses, used_count,
+	       valid_from, valid_until, is_active, created_at
+	FROM promo_codes
+`
+
+func (r *PricingRepository) CreatePromoCode(ctx context.Context, p *domain.PromoCode) error {
+	p.ID = uuid.New().String()
+	p.IsActive = true
+	p.CreatedAt = time.Now()
+	query := `
+		INSERT INTO promo_codes (id, code, school_id, course_id, created_by, discount_type, value, currency, max_uses, valid_from, valid_until, is_active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.DB.ExecContext(ctx, query, p.ID, p.Code, p.SchoolID, p.CourseID, p.CreatedBy, p.DiscountType, p.Value, p.Currency, p.MaxUses, p.ValidFrom, p.ValidUntil, p.IsActive, p.CreatedAt)
+	return err
+}
+
+func (r *PricingRepository) GetPromoCodeByID(ctx context.Context, id string) (*domain.PromoCode, error) {
+	return r.scanPromoCode(r.DB.QueryRowContext(ctx, promoCodeSelect+` WHERE id = ?`, id))
+}
+
+// GetPromoCodeByCode looks a code up case-insensitively.
+func (r *PricingRepository) GetPromoCodeByCode(ctx context.Context, code string) (*domain.PromoCode, error) {
+	return r.scanPromoCode(r.DB.QueryRowContext(ctx, promoCodeSelect+` WHERE UPPER(code) = UPPER(?)`, code))
+}
+
+// GetRedeemedPromoCode returns the code a student redeemed for a course, or sql.ErrNoRows.
+func (r *PricingRepository) GetRedeemedPromoCode(ctx context.Context, studentUserID, courseID string) (*domain.PromoCode, error) {
+	query := promoCodeSelect + ` WHERE id = (SELECT promo_code_id FROM promo_redemptions WHERE student_user_id = ? AND course_id = ?)`
+	return r.scanPromoCode(r.DB.QueryRowContext(ctx, query, studentUserID, courseID))
+}
+
+// ListPromoCodes returns the codes scoped to a school, or platform-wide codes when schoolID is empty.
+func (r *PricingRepository) ListPromoCodes(ctx context.Context, schoolID string) ([]domain.PromoCode, error) {
+	if schoolID == "" {
+		return r.listPromoCodes(ctx, promoCodeSelect+` ORDER BY created_at DESC`)
+	}
+	return r.listPromoCodes(ctx, promoCodeSelect+` WHERE school_id = ? ORDER BY created_at DESC`, schoolID)
+}
+
+// ListPromoCodesByCreator returns the codes a user created.
+func (r *PricingRepository) ListPromoCodesByCreator(ctx context.Context, userID string) ([]domain.PromoCode, error) {
+	return r.listPromoCodes(ctx, promoCodeSelect+` WHERE created_by = ? ORDER BY created_at DESC`, userID)
+}
+
+// DeactivatePromoCode stops the code from being redeemed or applied any more.
+func (r *PricingRepository) DeactivatePromoCode(ctx context.Context, id string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE promo_codes SET is_active = FALSE WHERE id = ?`, id)
+	return err
+}
+
+// RedeemPromoCode attaches a code to a student's course. The code row is locked so
+// concurrent redemptions cannot exceed max_uses. Redeeming the same code again is a no-op;
+// a different code replaces the previous one and frees its use.
+func (r *PricingRepository) RedeemPromoCode(ctx context.Context, promoCodeID, studentUserID, courseID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockPromoUse(ctx, tx, promoCodeID); err != nil {
+		return err
+	}
+	previous, err := lockRedemption(ctx, tx, studentUserID, courseID)
+	if err != nil {
+		return err
+	}
+	if previous == promoCodeID {
+		return nil
+	}
+	if err := takePromoUse(ctx, tx, promoCodeID); err != nil {
+		return err
+	}
+	if err := attachPromoCode(ctx, tx, previous, promoCodeID, studentUserID, courseID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReservePromoCode holds one use of a code for a pending checkout until the payment
+// settles (ConfirmPromoReservation) or fails (ReleasePromoReservation). It reports false,
+// holding nothing, when the student already redeemed the code for the course.
+func (r *PricingRepository) ReservePromoCode(ctx context.Context, promoCodeID, studentUserID, courseID, paymentID string) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := lockPromoUse(ctx, tx, promoCodeID); err != nil {
+		return false, err
+	}
+	previous, err := lockRedemption(ctx, tx, studentUserID, courseID)
+	if err != nil {
+		return false, err
+	}
+	if previous == promoCodeID {
+		return false, nil
+	}
+	if err := takePromoUse(ctx, tx, promoCodeID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO promo_reservations (payment_id, promo_code_id, student_user_id, course_id) VALUES (?, ?, ?, ?)`,
+		paymentID, promoCodeID, studentUserID, courseID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ConfirmPromoReservation redeems the code a settled payment reserved, replacing any code
+// the student redeemed for the course before. It is a no-op when the payment reserved nothing.
+func (r *PricingRepository) ConfirmPromoReservation(ctx context.Context, paymentID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var promoCodeID, studentUserID, courseID string
+	err = tx.QueryRowContext(ctx, `SELECT promo_code_id, student_user_id, course_id FROM promo_reservations WHERE payment_id = ? FOR UPDATE`, paymentID).
+		Scan(&promoCodeID, &studentUserID, &courseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := lockPromoUse(ctx, tx, promoCodeID); err != nil {
+		return err
+	}
+	previous, err := lockRedemption(ctx, tx, studentUserID, courseID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM promo_reservations WHERE payment_id = ?`, paymentID); err != nil {
+		return err
+	}
+	if previous == promoCodeID {
+		// Another checkout redeemed it first; the use this one held is not needed.
+		if err := givePromoUse(ctx, tx, promoCodeID); err != nil {
+			return err
+		}
+	} else if err := attachPromoCode(ctx, tx, previous, promoCodeID, studentUserID, courseID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReleasePromoReservation gives back the use a failed or expired payment held. It is a
+// no-op when the payment reserved nothing.
+func (r *PricingRepository) ReleasePromoReservation(ctx context.Context, paymentID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var promoCodeID string
+	err = tx.QueryRowContext(ctx, `SELECT promo_code_id FROM promo_reservations WHERE payment_id = ? FOR UPDATE`, paymentID).Scan(&promoCodeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM promo_reservations WHERE payment_id = ?`, paymentID); err != nil {
+		return err
+	}
+	if err := givePromoUse(ctx, tx, promoCodeID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockPromoUse locks a code's row so its use count can be checked and changed safely.
+func lockPromoUse(ctx context.Context, tx *sql.Tx, promoCodeID string) error {
+	var id string
+	return tx.QueryRowContext(ctx, `SELECT id FROM promo_codes WHERE id = ? FOR UPDATE`, promoCodeID).Scan(&id)
+}
+
+// lockRedemption returns the code a student redeemed for a course, or "" if none.
+func lockRedemption(ctx context.Context, tx *sql.Tx, studentUserID, courseID string) (string, error) {
+	var previous string
+	err := tx.QueryRowContext(ctx, `SELECT promo_code_id FROM promo_redemptions WHERE student_user_id = ? AND course_id = ? FOR UPDATE`, studentUserID, courseID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return previous, nil
+}
+
+// takePromoUse counts one more use of a locked code, or returns ErrPromoCodeExhausted.
+func takePromoUse(ctx context.Context, tx *sql.Tx, promoCodeID string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE promo_codes SET used_count = used_count + 1 WHERE id = ? AND (max_uses IS NULL OR used_count < max_uses)`, promoCodeID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrPromoCodeExhausted
+	}
+	return nil
+}
+
+func givePromoUse(ctx context.Context, tx *sql.Tx, promoCodeID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE promo_codes SET used_count = GREATEST(used_count - 1, 0) WHERE id = ?`, promoCodeID)
+	return err
+}
+
+// attachPromoCode records the student's redemption of a code whose use is already
+// counted, freeing the use of the previous code if there was one.
+func attachPromoCode(ctx context.Context, tx *sql.Tx, previous, promoCodeID, studentUserID, courseID string) error {
+	if previous != "" {
+		if err := givePromoUse(ctx, tx, previous); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM promo_redemptions WHERE student_user_id = ? AND course_id = ?`, studentUserID, courseID); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO promo_redemptions (id, promo_code_id, student_user_id, course_id) VALUES (?, ?, ?, ?)`,
+		uuid.New().String(), promoCodeID, studentUserID, courseID)
+	return err
+}
+
+const scholarshipSelect = `
+	SELECT sc.id, sc.school_id, sc.student_user_id, COALESCE(u.name, u.email), sc.course_id, c.title,
+	       sc.discount_type, sc.value, sc.currency, COALESCE(sc.note, ''), DATE_FORMAT(sc.valid_until, '%Y-%m-%d'),
+	       sc.created_by, sc.created_at
+	FROM scholarships sc
+	JOIN users u ON sc.student_user_id = u.id
+	LEFT JOIN courses c ON sc.course_id = c.id
+`
+
+func (r *PricingRepository) CreateScholarship(ctx context.Context, s *domain.Scholarship) error {
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now()
+	query := `
+		INSERT INTO scholarships (id, school_id, student_user_id, course_id, discount_type, value, currency, note, valid_until, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.DB.ExecContext(ctx, query, s.ID, s.SchoolID, s.StudentUserID, s.CourseID, s.DiscountType, s.Value, s.Currency, s.Note, s.ValidUntil, s.CreatedBy, s.CreatedAt)
+	return err
+}
+
+func (r *PricingRepository) ListScholarshipsBySchool(ctx context.Context, schoolID string) ([]domain.Scholarship, error) {
+	return r.listScholarships(ctx, scholarshipSelect+` WHERE sc.school_id = ? ORDER BY sc.created_at DESC`, schoolID)
+}
+
+// FindScholarship returns the scholarship in force for a student's course on asOf (YYYY-MM-DD).
+// A course-specific scholarship wins over a school-wide one; sql.ErrNoRows if there is none.
+func (r *PricingRepository) FindScholarship(ctx context.Context, schoolID, studentUserID, courseID, asOf string) (*domain.Scholarship, error) {
+	query := scholarshipSelect + `
+		WHERE sc.school_id = ? AND sc.student_user_id = ? AND (sc.course_id = ? OR sc.course_id IS NULL)
+		  AND (sc.valid_until IS NULL OR sc.valid_until >= ?)
+		ORDER BY sc.course_id IS NULL, sc.created_at DESC
+		LIMIT 1
+	`
+	list, err := r.listScholarships(ctx, query, schoolID, studentUserID, courseID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+// DeleteScholarship removes a scholarship of the given school; sql.ErrNoRows if it does not exist there.
+func (r *PricingRepository) DeleteScholarship(ctx context.Context, id, schoolID string) error {
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM scholarships WHERE id = ? AND school_id = ?`, id, schoolID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PricingRepository) GetSiblingDiscount(ctx context.Context, schoolID string) (float64, error) {
+	var percent float64
+	err := r.DB.QueryRowContext(ctx, `SELECT sibling_discount_percent FROM schools WHERE id = ?`, schoolID).Scan(&percent)
+	return percent, err
+}
+
+func (r *PricingRepository) SetSiblingDiscount(ctx context.Context, schoolID string, percent float64) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE schools SET sibling_discount_percent = ?, updated_at = NOW() WHERE id = ?`, percent, schoolID)
+	return err
+}
+
+// HasEarlierSibling reports whether another student with the same parent or guardian
+// enrolled at the school before this student did, i.e. whether this student is a second
+// or later sibling there. Enrollments are compared by their first active enrollment at
+// the school; a student not enrolled there yet comes after every enrolled sibling.
+func (r *PricingRepository) HasEarlierSibling(ctx context.Context, studentUserID, schoolID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM students me
+			JOIN students sib ON sib.user_id != me.user_id
+			     AND LOWER(TRIM(sib.parent_name)) = LOWER(TRIM(me.parent_name))
+			JOIN enrollments e ON e.student_user_id = sib.user_id AND e.status = 'active'
+			JOIN courses c ON e.course_id = c.id AND c.school_id = ?
+			LEFT JOIN (
+				SELECT MIN(me_e.enrolled_at) AS enrolled_at
+				FROM enrollments me_e
+				JOIN courses me_c ON me_e.course_id = me_c.id
+				WHERE me_e.student_user_id = ? AND me_e.status = 'active' AND me_c.school_id = ?
+			) mine ON TRUE
+			WHERE me.user_id = ? AND TRIM(COALESCE(me.parent_name, '')) != ''
+			  AND (mine.enrolled_at IS NULL
+			       OR e.enrolled_at < mine.enrolled_at
+			       OR (e.enrolled_at = mine.enrolled_at AND sib.user_id < me.user_id))
+		)
+	`
+	var exists bool
+	err := r.DB.QueryRowContext(ctx, query, schoolID, studentUserID, schoolID, studentUserID).Scan(&exists)
+	return exists, err
+}
+
+func (r *PricingRepository) scanPromoCode(row *sql.Row) (*domain.PromoCode, error) {
+	var p domain.PromoCode
+	var schoolID, courseID sql.NullString
+	var maxUses sql.NullInt64
+	var validFrom, validUntil sql.NullTime
+	if err := row.Scan(&p.ID, &p.Code, &schoolID, &courseID, &p.CreatedBy, &p.DiscountType, &p.Value, &p.Currency, &maxUses, &p.UsedCount,
+		&validFrom, &validUntil, &p.IsActive, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	fillPromoCode(&p, schoolID, courseID, maxUses, validFrom, validUntil)
+	return &p, nil
+}
+
+func (r *PricingRepository) listPromoCodes(ctx context.Context, query string, args ...interface{}) ([]domain.PromoCode, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []domain.PromoCode
+	for rows.Next() {
+		var p domain.PromoCode
+		var schoolID, courseID sql.NullString
+		var maxUses sql.NullInt64
+		var validFrom, validUntil sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Code, &schoolID, &courseID, &p.CreatedBy, &p.DiscountType, &p.Value, &p.Currency, &maxUses, &p.UsedCount,
+			&validFrom, &validUntil, &p.IsActive, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		fillPromoCode(&p, schoolID, courseID, maxUses, validFrom, validUntil)
+		codes = append(codes, p)
+	}
+	return codes, nil
+}
+
+func fillPromoCode(p *domain.PromoCode, schoolID, courseID sql.NullString, maxUses sql.NullInt64, validFrom, validUntil sql.NullTime) {
+	if schoolID.Valid {
+		p.SchoolID = &schoolID.String
+	}
+	if courseID.Valid {
+		p.CourseID = &courseID.String
+	}
+	if maxUses.Valid {
+		n := int(maxUses.Int64)
+		p.MaxUses = &n
+	}
+	if validFrom.Valid {
+		p.ValidFrom = &validFrom.Time
+	}
+	if validUntil.Valid {
+		p.ValidUntil = &validUntil.Time
+	}
+}
+
+func (r *PricingRepository) listScholarships(ctx context.Context, query string, args ...interface{}) ([]domain.Scholarship, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scholarships []domain.Scholarship
+	for rows.Next() {
+		var s domain.Scholarship
+		var courseID, courseTitle, validUntil sql.NullString
+		if err := rows.Scan(&s.ID, &s.SchoolID, &s.StudentUserID, &s.StudentName, &courseID, &courseTitle,
+			&s.DiscountType, &s.Value, &s.Currency, &s.Note, &validUntil, &s.CreatedBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if courseID.Valid {
+			s.CourseID = &courseID.String
+		}
+		if courseTitle.Valid {
+			s.CourseTitle = &courseTitle.String
+		}
+		if validUntil.Valid {
+			s.ValidUntil = &validUntil.String
+		}
+		scholarships = append(scholarships, s)
+	}
+	return scholarships, nil
+}
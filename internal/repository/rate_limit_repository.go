@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+type RateLimitRepository struct {
+	DB *sql.DB
+}
+
+func NewRateLimitRepository(db *sql.DB) *RateLimitRepository {
+	return &RateLimitRepository{DB: db}
+}
+
+// Take removes one token from the bucket stored under key, creating it full if it does
+// not exist. Buckets hold up to burst tokens and regain perSecond tokens every second.
+// When the bucket is empty nothing is taken and the wait for the next token is returned.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, burst, perSecond float64, now time.Time) (bool, time.Duration, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	// Make sure the row exists so it can be locked even on the first request.
+	if _, err := tx.ExecContext(ctx, `INSERT IGNORE INTO rate_limit_buckets (bucket_key, tokens, updated_at) VALUES (?, ?, ?)`, key, burst, now); err != nil {
+		return false, 0, err
+	}
+	var tokens float64
+	var updatedAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = ? FOR UPDATE`, key).Scan(&tokens, &updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, 0, errors.New("rate limit bucket vanished")
+		}
+		return false, 0, err
+	}
+
+	if elapsed := now.Sub(updatedAt).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*perSecond)
+	}
+	allowed := tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		tokens--
+	} else {
+		retryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE rate_limit_buckets SET tokens = ?, updated_at = ? WHERE bucket_key = ?`, tokens, now, key); err != nil {
+		return false, 0, err
+	}
+	return allowed, retryAfter, tx.Commit()
+}
+
+// DeleteIdleSince drops buckets untouched since before, which have refilled by then.
+func (r *RateLimitRepository) DeleteIdleSince(ctx context.Context, before time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < ?`, before)
+	return err
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRateLimitTake(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		tokens     float64 // stored in the bucket
+		idle       time.Duration
+		wantLeft   float64
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{"new bucket", 5, 0, 4, true, 0},
+		{"refilled while idle", 0.5, 10 * time.Second, 0, true, 0},
+		{"refill capped at the burst", 2, time.Hour, 4, true, 0},
+		{"empty", 0.25, 0, 0.25, false, 15 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			// A burst of 5 regaining a token every 20s.
+			mock.ExpectBegin()
+			mock.ExpectExec(`INSERT IGNORE INTO rate_limit_buckets \(bucket_key, tokens, updated_at\) VALUES \(\?, \?, \?\)`).
+				WithArgs("login:ip", 5.0, now).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = \? FOR UPDATE`).WithArgs("login:ip").
+				WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(tt.tokens, now.Add(-tt.idle)))
+			mock.ExpectExec(`UPDATE rate_limit_buckets SET tokens = \?, updated_at = \? WHERE bucket_key = \?`).
+				WithArgs(tt.wantLeft, now, "login:ip").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			allowed, retryAfter, err := NewRateLimitRepository(db).Take(context.Background(), "login:ip", 5, 0.05, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.allowed || retryAfter != tt.retryAfter {
+				t.Fatalf("Take = %v, %v; want %v, %v", allowed, retryAfter, tt.allowed, tt.retryAfter)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/schooltj/internal/domain"
 )
 
+var ErrRatingNotFound = errors.New("rating not found")
+
 type RatingRepository struct {
 	DB *sql.DB
 }
@@ -31,35 +33,40 @@ func (r *RatingRepository) CreateRating(ctx context.Context, rating *domain.Rati
 		return err
 	}
 
-	// Update aggregates
+	if err := refreshRatingAggregates(ctx, tx, rating); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshRatingAggregates recomputes the average and count of the rating's target from
+// its visible ratings.
+func refreshRatingAggregates(ctx context.Context, tx *sql.Tx, rating *domain.Rating) error {
+	var err error
 	if rating.ToUserID != nil {
 		updateQuery := `
 			UPDATE users 
-			SET rating_avg = (SELECT AVG(score) FROM ratings WHERE to_user_id = ?),
-			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_user_id = ?)
+			SET rating_avg = COALESCE((SELECT AVG(score) FROM ratings WHERE to_user_id = ? AND hidden_at IS NULL), 0),
+			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_user_id = ? AND hidden_at IS NULL)
 			WHERE id = ?`
 		_, err = tx.ExecContext(ctx, updateQuery, *rating.ToUserID, *rating.ToUserID, *rating.ToUserID)
 	} else if rating.ToSchoolID != nil {
 		updateQuery := `
 			UPDATE schools 
-			SET rating_avg = (SELECT AVG(score) FROM ratings WHERE to_school_id = ?),
-			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_school_id = ?)
+			SET rating_avg = COALESCE((SELECT AVG(score) FROM ratings WHERE to_school_id = ? AND hidden_at IS NULL), 0),
+			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_school_id = ? AND hidden_at IS NULL)
 			WHERE id = ?`
 		_, err = tx.ExecContext(ctx, updateQuery, *rating.ToSchoolID, *rating.ToSchoolID, *rating.ToSchoolID)
 	} else if rating.ToCourseID != nil {
 		updateQuery := `
 			UPDATE courses 
-			SET rating_avg = (SELECT AVG(score) FROM ratings WHERE to_course_id = ?),
-			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_course_id = ?)
+			SET rating_avg = COALESCE((SELECT AVG(score) FROM ratings WHERE to_course_id = ? AND hidden_at IS NULL), 0),
+			    rating_count = (SELECT COUNT(*) FROM ratings WHERE to_course_id = ? AND hidden_at IS NULL)
 			WHERE id = ?`
 		_, err = tx.ExecContext(ctx, updateQuery, *rating.ToCourseID, *rating.ToCourseID, *rating.ToCourseID)
 	}
-
-	if err != nil {
-		return err
-	}
-
-	return tx.Commit()
+	return err
 }
 
 func (r *RatingRepository) CheckCollaboration(ctx context.Context, fromUserID string, toUserID *string, toSchoolID *string, toCourseID *string) (bool, error) {
@@ -130,7 +137,7 @@ func (r *RatingRepository) ListRatingsForCourse(ctx context.Context, courseID st
 		       COALESCE(u.name, u.email) as reviewer_name
 		FROM ratings rat
 		JOIN users u ON rat.from_user_id = u.id
-		WHERE rat.to_course_id = ?
+		WHERE rat.to_course_id = ? AND rat.hidden_at IS NULL
 		ORDER BY rat.created_at DESC
 	`
 	rows, err := r.DB.QueryContext(ctx, query, courseID)
@@ -161,7 +168,7 @@ func (r *RatingRepository) ListRatingsForUser(ctx context.Context, userID string
 		       COALESCE(u.name, u.email) as reviewer_name
 		FROM ratings rat
 		JOIN users u ON rat.from_user_id = u.id
-		WHERE rat.to_user_id = ?
+		WHERE rat.to_user_id = ? AND rat.hidden_at IS NULL
 		ORDER BY rat.created_at DESC
 	`
 	rows, err := r.DB.QueryContext(ctx, query, userID)
@@ -187,7 +194,7 @@ func (r *RatingRepository) ListRatingsForSchool(ctx context.Context, schoolID st
 		       COALESCE(u.name, u.email) as reviewer_name
 		FROM ratings rat
 		JOIN users u ON rat.from_user_id = u.id
-		WHERE rat.to_school_id = ?
+		WHERE rat.to_school_id = ? AND rat.hidden_at IS NULL
 		ORDER BY rat.created_at DESC
 	`
 	rows, err := r.DB.QueryContext(ctx, query, schoolID)
@@ -206,3 +213,105 @@ func (r *RatingRepository) ListRatingsForSchool(ctx context.Context, schoolID st
 	}
 	return ratings, nil
 }
+
+// ListForModeration returns ratings with their reviewers, newest first, including hidden
+// ones. A non-nil hidden keeps only ratings in that state.
+func (r *RatingRepository) ListForModeration(ctx context.Context, hidden *bool, limit, offset int) ([]RatingWithReviewer, error) {
+	query := `
+		SELECT rat.id, rat.from_user_id, rat.to_user_id, rat.to_school_id, rat.to_course_id, rat.score, COALESCE(rat.comment, ''), rat.created_at,
+		       rat.hidden_at, COALESCE(rat.moderation_note, ''), COALESCE(u.name, u.email) as reviewer_name
+		FROM ratings rat
+		JOIN users u ON rat.from_user_id = u.id`
+	var args []interface{}
+	if hidden != nil {
+		if *hidden {
+			query += ` WHERE rat.hidden_at IS NOT NULL`
+		} else {
+			query += ` WHERE rat.hidden_at IS NULL`
+		}
+	}
+	query += ` ORDER BY rat.created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []RatingWithReviewer
+	for rows.Next() {
+		var rr RatingWithReviewer
+		var hiddenAt sql.NullTime
+		if err := rows.Scan(&rr.ID, &rr.FromUserID, &rr.ToUserID, &rr.ToSchoolID, &rr.ToCourseID, &rr.Score, &rr.Comment, &rr.CreatedAt,
+			&hiddenAt, &rr.ModerationNote, &rr.ReviewerName); err != nil {
+			return nil, err
+		}
+		if hiddenAt.Valid {
+			rr.HiddenAt = &hiddenAt.Time
+		}
+		ratings = append(ratings, rr)
+	}
+	return ratings, rows.Err()
+}
+
+// lockRating loads a rating's target for update.
+func lockRating(ctx context.Context, tx *sql.Tx, id string) (*domain.Rating, error) {
+	var rating domain.Rating
+	err := tx.QueryRowContext(ctx, `SELECT id, to_user_id, to_school_id, to_course_id FROM ratings WHERE id = ? FOR UPDATE`, id).
+		Scan(&rating.ID, &rating.ToUserID, &rating.ToSchoolID, &rating.ToCourseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRatingNotFound
+		}
+		return nil, err
+	}
+	return &rating, nil
+}
+
+// SetHidden hides a rating from listings and averages, or shows it again.
+func (r *RatingRepository) SetHidden(ctx context.Context, id string, hidden bool, note, moderatorID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rating, err := lockRating(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if hidden {
+		_, err = tx.ExecContext(ctx, `UPDATE ratings SET hidden_at = COALESCE(hidden_at, NOW()), hidden_by = ?, moderation_note = ? WHERE id = ?`, moderatorID, nullIfEmpty(note), id)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE ratings SET hidden_at = NULL, hidden_by = NULL, moderation_note = ? WHERE id = ?`, nullIfEmpty(note), id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := refreshRatingAggregates(ctx, tx, rating); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes a rating for good.
+func (r *RatingRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rating, err := lockRating(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ratings WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := refreshRatingAggregates(ctx, tx, rating); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
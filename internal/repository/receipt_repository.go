@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+type ReceiptRepository struct {
+	DB *sql.DB
+}
+
+func NewReceiptRepository(db *sql.DB) *ReceiptRepository {
+	return &ReceiptRepository{DB: db}
+}
+
+// GetByPaymentID returns the receipt of a payment, or sql.ErrNoRows if none was issued.
+func (r *ReceiptRepository) GetByPaymentID(ctx context.Context, paymentID string) (*domain.Receipt, error) {
+	query := `SELECT id, payment_id, issuer_id, number, file_path, created_at FROM receipts WHERE payment_id = ?`
+	var rec domain.Receipt
+	err := r.DB.QueryRowContext(ctx, query, paymentID).Scan(&rec.ID, &rec.PaymentID, &rec.IssuerID, &rec.Number, &rec.FilePath, &rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Issue takes the issuer's next receipt number and stores the receipt produced by render.
+// The counter row stays locked until the receipt is saved, so numbers are gapless:
+// if render or the insert fails, the number is not consumed.
+func (r *ReceiptRepository) Issue(ctx context.Context, paymentID, issuerID string, render func(number int) (filePath string, err error)) (*domain.Receipt, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT IGNORE INTO receipt_counters (issuer_id, last_number) VALUES (?, 0)`, issuerID); err != nil {
+		return nil, err
+	}
+	var last int
+	if err := tx.QueryRowContext(ctx, `SELECT last_number FROM receipt_counters WHERE issuer_id = ? FOR UPDATE`, issuerID).Scan(&last); err != nil {
+		return nil, err
+	}
+
+	rec := &domain.Receipt{
+		ID:        uuid.New().String(),
+		PaymentID: paymentID,
+		IssuerID:  issuerID,
+		Number:    last + 1,
+	}
+	if rec.FilePath, err = render(rec.Number); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO receipts (id, payment_id, issuer_id, number, file_path) VALUES (?, ?, ?, ?, ?)`,
+		rec.ID, rec.PaymentID, rec.IssuerID, rec.Number, rec.FilePath); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE receipt_counters SET last_number = ? WHERE issuer_id = ?`, rec.Number, issuerID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrSchoolMemberNotFound = errors.New("this person is not on the school's staff")
+	ErrAlreadySchoolStaff   = errors.New("this account is already on the staff of a school")
+)
+
+type SchoolMemberRepository struct {
+	DB *sql.DB
+}
+
+func NewSchoolMemberRepository(db *sql.DB) *SchoolMemberRepository {
+	return &SchoolMemberRepository{DB: db}
+}
+
+const schoolMemberSelect = `
+	SELECT sm.school_id, sm.user_id, u.name, COALESCE(u.email, ''), sm.role, sm.branch_id, COALESCE(b.name, ''), sm.added_by, sm.created_at
+	FROM school_members sm
+	JOIN users u ON sm.user_id = u.id
+	LEFT JOIN school_branches b ON sm.branch_id = b.id
+`
+
+func (r *SchoolMemberRepository) scanMembers(ctx context.Context, query string, args ...interface{}) ([]domain.SchoolMember, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []domain.SchoolMember
+	for rows.Next() {
+		var m domain.SchoolMember
+		var addedBy sql.NullString
+		if err := rows.Scan(&m.SchoolID, &m.UserID, &m.Name, &m.Email, &m.Role, &m.BranchID, &m.BranchName, &addedBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if addedBy.Valid {
+			m.AddedBy = &addedBy.String
+		}
+		m.Permissions = domain.SchoolRolePermissions[m.Role]
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetByUser returns the user's membership. A staff account belongs to at most one school.
+func (r *SchoolMemberRepository) GetByUser(ctx context.Context, userID string) (*domain.SchoolMember, error) {
+	members, err := r.scanMembers(ctx, schoolMemberSelect+` WHERE sm.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, ErrSchoolMemberNotFound
+	}
+	return &members[0], nil
+}
+
+// Get returns the user's membership of the school.
+func (r *SchoolMemberRepository) Get(ctx context.Context, schoolID, userID string) (*domain.SchoolMember, error) {
+	m, err := r.GetByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m.SchoolID != schoolID {
+		return nil, ErrSchoolMemberNotFound
+	}
+	return m, nil
+}
+
+// ListBySchool returns the school's staff, the owner first.
+func (r *SchoolMemberRepository) ListBySchool(ctx context.Context, schoolID string) ([]domain.SchoolMember, error) {
+	return r.scanMembers(ctx, schoolMemberSelect+`
+		WHERE sm.school_id = ?
+		ORDER BY FIELD(sm.role, 'owner', 'admin', 'accountant', 'registrar', 'branch_manager'), u.name`, schoolID)
+}
+
+// Add puts the user on the school's staff. A user already on a school's staff cannot join
+// another.
+func (r *SchoolMemberRepository) Add(ctx context.Context, m *domain.SchoolMember) error {
+	var exists bool
+	if err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM school_members WHERE user_id = ?)`, m.UserID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadySchoolStaff
+	}
+	m.CreatedAt = time.Now()
+	m.Permissions = domain.SchoolRolePermissions[m.Role]
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO school_members (school_id, user_id, role, branch_id, added_by) VALUES (?, ?, ?, ?, ?)`,
+		m.SchoolID, m.UserID, m.Role, m.BranchID, m.AddedBy)
+	return err
+}
+
+// UpdateRole changes a member's role and the branch it is limited to. The owner's role is fixed.
+func (r *SchoolMemberRepository) UpdateRole(ctx context.Context, schoolID, userID string, role domain.SchoolRole, branchID *string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE school_members SET role = ?, branch_id = ? WHERE school_id = ? AND user_id = ? AND role <> ?`,
+		role, branchID, schoolID, userID, domain.SchoolRoleOwner)
+	return err
+}
+
+// Remove takes a member off the school's staff. The owner cannot be removed.
+func (r *SchoolMemberRepository) Remove(ctx context.Context, schoolID, userID string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM school_members WHERE school_id = ? AND user_id = ? AND role <> ?`,
+		schoolID, userID, domain.SchoolRoleOwner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSchoolMemberNotFound
+	}
+	return nil
+}
@@ -9,6 +9,10 @@ import (
 	"github.com/schooltj/internal/domain"
 )
 
+var ErrSchoolNotFound = errors.New("school not found")
+var ErrTeacherProfileNotFound = errors.New("teacher profile not found")
+var ErrTeacherNotInSchool = errors.New("this teacher does not teach at the school")
+
 type SchoolRepository struct {
 	DB *sql.DB
 }
@@ -17,11 +21,25 @@ func NewSchoolRepository(db *sql.DB) *SchoolRepository {
 	return &SchoolRepository{DB: db}
 }
 
+// CreateSchool creates the school with its admin user as the owner on its staff.
 func (r *SchoolRepository) CreateSchool(ctx context.Context, school *domain.School) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	school.ID = uuid.New().String()
 	query := `INSERT INTO schools (id, admin_user_id, name, created_at, updated_at) VALUES (?, ?, ?, NOW(), NOW())`
-	_, err := r.DB.ExecContext(ctx, query, school.ID, school.AdminUserID, school.Name)
-	return err
+	if _, err := tx.ExecContext(ctx, query, school.ID, school.AdminUserID, school.Name); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO school_members (school_id, user_id, role) VALUES (?, ?, ?)`,
+		school.ID, school.AdminUserID, domain.SchoolRoleOwner)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Teacher Profile
@@ -42,16 +60,46 @@ func (r *SchoolRepository) AddTeacherToSchool(ctx context.Context, schoolID stri
 	return err
 }
 
+// RemoveTeacher detaches the teacher from the school. Their courses and sections there are
+// left without a teacher, so they lose access to them; grades and attendance records stay
+// with the school.
+func (r *SchoolRepository) RemoveTeacher(ctx context.Context, schoolID, teacherUserID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE teacher_profiles SET school_id = NULL, branch_id = NULL, updated_at = NOW() WHERE user_id = ? AND school_id = ?`, teacherUserID, schoolID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTeacherNotInSchool
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE courses SET teacher_id = NULL WHERE school_id = ? AND teacher_id = ?`, schoolID, teacherUserID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE course_sections cs JOIN courses c ON c.id = cs.course_id
+		SET cs.teacher_id = NULL
+		WHERE c.school_id = ? AND cs.teacher_id = ?`, schoolID, teacherUserID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (r *SchoolRepository) GetTeacherProfile(ctx context.Context, userID string) (*domain.TeacherProfile, error) {
-	query := `SELECT user_id, school_id, bio, subjects, hourly_rate, currency, created_at, updated_at FROM teacher_profiles WHERE user_id = ?`
+	query := `SELECT user_id, school_id, branch_id, bio, subjects, hourly_rate, currency, created_at, updated_at FROM teacher_profiles WHERE user_id = ?`
 	row := r.DB.QueryRowContext(ctx, query, userID)
 
 	var profile domain.TeacherProfile
 	var subjectsJSON string
-	err := row.Scan(&profile.UserID, &profile.SchoolID, &profile.Bio, &subjectsJSON, &profile.HourlyRate, &profile.Currency, &profile.CreatedAt, &profile.UpdatedAt)
+	err := row.Scan(&profile.UserID, &profile.SchoolID, &profile.BranchID, &profile.Bio, &subjectsJSON, &profile.HourlyRate, &profile.Currency, &profile.CreatedAt, &profile.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("teacher profile not found")
+			return nil, ErrTeacherProfileNotFound
 		}
 		return nil, err
 	}
@@ -59,31 +107,45 @@ func (r *SchoolRepository) GetTeacherProfile(ctx context.Context, userID string)
 	return &profile, nil
 }
 
-func (r *SchoolRepository) GetSchoolByAdminID(ctx context.Context, adminID string) (*domain.School, error) {
-	query := `SELECT id, admin_user_id, name, created_at, updated_at FROM schools WHERE admin_user_id = ?`
-	row := r.DB.QueryRowContext(ctx, query, adminID)
-
-	var school domain.School
-	err := row.Scan(&school.ID, &school.AdminUserID, &school.Name, &school.CreatedAt, &school.UpdatedAt)
+// SetTeacherBranch assigns a teacher of the school to one of its branches, or to none
+// when branchID is nil.
+func (r *SchoolRepository) SetTeacherBranch(ctx context.Context, schoolID, teacherUserID string, branchID *string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE teacher_profiles SET branch_id = ?, updated_at = NOW() WHERE user_id = ? AND school_id = ?`,
+		branchID, teacherUserID, schoolID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("school not found")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM teacher_profiles WHERE user_id = ? AND school_id = ?)`,
+			teacherUserID, schoolID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrTeacherNotInSchool
 		}
-		return nil, err
 	}
-	return &school, nil
+	return nil
 }
 
-func (r *SchoolRepository) ListTeachers(ctx context.Context, schoolID string) ([]domain.User, error) {
+// ListTeachers returns the school's teachers, only those of one branch if branchID is set.
+func (r *SchoolRepository) ListTeachers(ctx context.Context, schoolID, branchID string) ([]domain.User, error) {
 	query := `
-		SELECT u.id, u.email, u.name, u.role, u.avatar_url, u.rating_avg, u.rating_count, u.created_at, u.updated_at, s.name as school_name
+		SELECT u.id, COALESCE(u.email, ''), u.name, u.role, u.avatar_url, u.rating_avg, u.rating_count, u.created_at, u.updated_at, s.name as school_name,
+		       b.name as branch_name
 		FROM users u
 		JOIN teacher_profiles tp ON u.id = tp.user_id
 		LEFT JOIN schools s ON tp.school_id = s.id
+		LEFT JOIN school_branches b ON tp.branch_id = b.id
 		WHERE tp.school_id = ?
-		ORDER BY u.rating_avg DESC, u.created_at DESC
 	`
-	rows, err := r.DB.QueryContext(ctx, query, schoolID)
+	args := []interface{}{schoolID}
+	if branchID != "" {
+		query += ` AND tp.branch_id = ?`
+		args = append(args, branchID)
+	}
+	query += ` ORDER BY u.rating_avg DESC, u.created_at DESC`
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -92,26 +154,29 @@ func (r *SchoolRepository) ListTeachers(ctx context.Context, schoolID string) ([
 	var teachers []domain.User
 	for rows.Next() {
 		var u domain.User
-		var schoolName sql.NullString
-		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.AvatarURL, &u.RatingAvg, &u.RatingCount, &u.CreatedAt, &u.UpdatedAt, &schoolName); err != nil {
+		var schoolName, branchName sql.NullString
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.AvatarURL, &u.RatingAvg, &u.RatingCount, &u.CreatedAt, &u.UpdatedAt, &schoolName, &branchName); err != nil {
 			return nil, err
 		}
 		if schoolName.Valid {
 			u.SchoolName = &schoolName.String
 		}
+		if branchName.Valid {
+			u.BranchName = &branchName.String
+		}
 		teachers = append(teachers, u)
 	}
 	return teachers, nil
 }
 
 func (r *SchoolRepository) GetSchoolByID(ctx context.Context, id string) (*domain.School, error) {
-	query := `SELECT id, admin_user_id, name, COALESCE(description, ''), COALESCE(tax_id, ''), COALESCE(phone, ''), COALESCE(email, ''), COALESCE(address, ''), COALESCE(city, ''), COALESCE(website, ''), COALESCE(logo_url, ''), is_verified, rating_avg, rating_count, created_at, updated_at FROM schools WHERE id = ?`
+	query := `SELECT id, admin_user_id, name, COALESCE(description, ''), COALESCE(tax_id, ''), COALESCE(phone, ''), COALESCE(email, ''), COALESCE(address, ''), COALESCE(city, ''), COALESCE(website, ''), COALESCE(logo_url, ''), reporting_currency, is_verified, rating_avg, rating_count, created_at, updated_at FROM schools WHERE id = ?`
 	row := r.DB.QueryRowContext(ctx, query, id)
 	var school domain.School
-	err := row.Scan(&school.ID, &school.AdminUserID, &school.Name, &school.Description, &school.TaxID, &school.Phone, &school.Email, &school.Address, &school.City, &school.Website, &school.LogoURL, &school.IsVerified, &school.RatingAvg, &school.RatingCount, &school.CreatedAt, &school.UpdatedAt)
+	err := row.Scan(&school.ID, &school.AdminUserID, &school.Name, &school.Description, &school.TaxID, &school.Phone, &school.Email, &school.Address, &school.City, &school.Website, &school.LogoURL, &school.ReportingCurrency, &school.IsVerified, &school.RatingAvg, &school.RatingCount, &school.CreatedAt, &school.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("school not found")
+			return nil, ErrSchoolNotFound
 		}
 		return nil, err
 	}
@@ -136,9 +201,53 @@ func (r *SchoolRepository) ListSchools(ctx context.Context) ([]domain.School, er
 	return schools, nil
 }
 
+// ListForReview returns schools with their verification review, unverified first. A
+// non-nil verified keeps only schools in that state.
+func (r *SchoolRepository) ListForReview(ctx context.Context, verified *bool) ([]domain.School, error) {
+	query := `SELECT id, admin_user_id, name, COALESCE(city, ''), COALESCE(email, ''), COALESCE(phone, ''), COALESCE(tax_id, ''), is_verified, COALESCE(verification_note, ''), verified_at, created_at, updated_at FROM schools`
+	var args []interface{}
+	if verified != nil {
+		query += ` WHERE is_verified = ?`
+		args = append(args, *verified)
+	}
+	query += ` ORDER BY is_verified ASC, created_at ASC`
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var schools []domain.School
+	for rows.Next() {
+		var s domain.School
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.AdminUserID, &s.Name, &s.City, &s.Email, &s.Phone, &s.TaxID, &s.IsVerified, &s.VerificationNote, &verifiedAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if verifiedAt.Valid {
+			s.VerifiedAt = &verifiedAt.Time
+		}
+		schools = append(schools, s)
+	}
+	return schools, rows.Err()
+}
+
+// SetVerification records an admin's review of the school.
+func (r *SchoolRepository) SetVerification(ctx context.Context, schoolID string, verified bool, note, reviewerID string) error {
+	query := `UPDATE schools SET is_verified = ?, verification_note = ?, verified_at = IF(?, NOW(), NULL), verified_by = ?, updated_at = NOW() WHERE id = ?`
+	result, err := r.DB.ExecContext(ctx, query, verified, nullIfEmpty(note), verified, reviewerID, schoolID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSchoolNotFound
+	}
+	return nil
+}
+
 func (r *SchoolRepository) UpdateSchool(ctx context.Context, school *domain.School) error {
-	query := `UPDATE schools SET name = ?, description = ?, phone = ?, email = ?, address = ?, city = ?, website = ?, logo_url = ?, tax_id = ?, updated_at = NOW() WHERE id = ?`
-	_, err := r.DB.ExecContext(ctx, query, school.Name, school.Description, school.Phone, school.Email, school.Address, school.City, school.Website, school.LogoURL, school.TaxID, school.ID)
+	// An empty reporting currency keeps the current one.
+	query := `UPDATE schools SET name = ?, description = ?, phone = ?, email = ?, address = ?, city = ?, website = ?, logo_url = ?, tax_id = ?, reporting_currency = COALESCE(UPPER(NULLIF(?, '')), reporting_currency), updated_at = NOW() WHERE id = ?`
+	_, err := r.DB.ExecContext(ctx, query, school.Name, school.Description, school.Phone, school.Email, school.Address, school.City, school.Website, school.LogoURL, school.TaxID, school.ReportingCurrency, school.ID)
 	return err
 }
 
@@ -152,7 +261,7 @@ func (r *SchoolRepository) DeleteSchool(ctx context.Context, id string) error {
 		return err
 	}
 	if rows == 0 {
-		return errors.New("school not found")
+		return ErrSchoolNotFound
 	}
 	return nil
 }
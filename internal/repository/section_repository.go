@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrSectionNotFound  = errors.New("section not found")
+	ErrSectionNameTaken = errors.New("the course already has a section with this name")
+	ErrSectionFull      = errors.New("the section is full")
+)
+
+type SectionRepository struct {
+	DB *sql.DB
+}
+
+func NewSectionRepository(db *sql.DB) *SectionRepository {
+	return &SectionRepository{DB: db}
+}
+
+const sectionSelect = `
+	SELECT cs.id, cs.course_id, cs.name, cs.schedule, cs.teacher_id, COALESCE(u.name, ''), cs.max_students,
+	       (SELECT COUNT(*) FROM enrollments e WHERE e.section_id = cs.id AND e.status = 'active'),
+	       cs.created_at, cs.updated_at
+	FROM course_sections cs
+	LEFT JOIN users u ON cs.teacher_id = u.id
+`
+
+func (r *SectionRepository) scanSections(ctx context.Context, query string, args ...interface{}) ([]domain.CourseSection, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sections []domain.CourseSection
+	for rows.Next() {
+		var s domain.CourseSection
+		var scheduleJSON []byte
+		if err := rows.Scan(&s.ID, &s.CourseID, &s.Name, &scheduleJSON, &s.TeacherID, &s.TeacherName, &s.MaxStudents,
+			&s.StudentCount, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if len(scheduleJSON) > 0 {
+			var sched domain.Schedule
+			if err := json.Unmarshal(scheduleJSON, &sched); err == nil {
+				s.Schedule = &sched
+			}
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+func scheduleValue(schedule *domain.Schedule) (interface{}, error) {
+	if schedule == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// nameTaken reports whether another section of the course already has the name.
+func (r *SectionRepository) nameTaken(ctx context.Context, s *domain.CourseSection) (bool, error) {
+	var taken bool
+	err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM course_sections WHERE course_id = ? AND name = ? AND id <> ?)`,
+		s.CourseID, s.Name, s.ID).Scan(&taken)
+	return taken, err
+}
+
+// Create adds a section to a course. Section names are unique within a course.
+func (r *SectionRepository) Create(ctx context.Context, s *domain.CourseSection) error {
+	taken, err := r.nameTaken(ctx, s)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSectionNameTaken
+	}
+	schedule, err := scheduleValue(s.Schedule)
+	if err != nil {
+		return err
+	}
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	_, err = r.DB.ExecContext(ctx, `INSERT INTO course_sections (id, course_id, name, schedule, teacher_id, max_students) VALUES (?, ?, ?, ?, ?, ?)`,
+		s.ID, s.CourseID, s.Name, schedule, s.TeacherID, s.MaxStudents)
+	return err
+}
+
+func (r *SectionRepository) GetByID(ctx context.Context, id string) (*domain.CourseSection, error) {
+	sections, err := r.scanSections(ctx, sectionSelect+` WHERE cs.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		return nil, ErrSectionNotFound
+	}
+	return &sections[0], nil
+}
+
+// ListByCourse returns the course's sections by name.
+func (r *SectionRepository) ListByCourse(ctx context.Context, courseID string) ([]domain.CourseSection, error) {
+	return r.scanSections(ctx, sectionSelect+` WHERE cs.course_id = ? ORDER BY cs.name`, courseID)
+}
+
+func (r *SectionRepository) Update(ctx context.Context, s *domain.CourseSection) error {
+	taken, err := r.nameTaken(ctx, s)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSectionNameTaken
+	}
+	schedule, err := scheduleValue(s.Schedule)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.ExecContext(ctx, `UPDATE course_sections SET name = ?, schedule = ?, teacher_id = ?, max_students = ? WHERE id = ?`,
+		s.Name, schedule, s.TeacherID, s.MaxStudents, s.ID)
+	return err
+}
+
+// Delete removes a section. Its students, attendance, grades and assignments stay with the
+// course, in no section.
+func (r *SectionRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM course_sections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSectionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrSessionRevoked     = errors.New("session has been revoked or has expired")
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+type SessionRepository struct {
+	DB *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session, tokenHash string) error {
+	session.ID = uuid.New().String()
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+	query := `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, created_at, last_used_at, expires_at, impersonator_user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, session.ID, session.UserID, tokenHash, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastUsedAt, session.ExpiresAt, session.ImpersonatorUserID)
+	return err
+}
+
+// Rotate swaps a session's refresh token for a new one and extends the session to expiresAt.
+// Presenting the token that was replaced last means it leaked, so the session is revoked
+// and ErrRefreshTokenReused returned.
+func (r *SessionRepository) Rotate(ctx context.Context, tokenHash, newHash, userAgent, ip string, expiresAt time.Time) (*domain.Session, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var session domain.Session
+	var currentHash string
+	var revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, refresh_token_hash, created_at, expires_at, revoked_at
+		FROM sessions WHERE refresh_token_hash = ? OR previous_token_hash = ? FOR UPDATE`, tokenHash, tokenHash).
+		Scan(&session.ID, &session.UserID, &currentHash, &session.CreatedAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if revokedAt.Valid || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
+	}
+	if currentHash != tokenHash {
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = ?`, session.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	session.UserAgent = userAgent
+	session.IPAddress = ip
+	session.LastUsedAt = time.Now()
+	session.ExpiresAt = expiresAt
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions SET previous_token_hash = refresh_token_hash, refresh_token_hash = ?, user_agent = ?, ip_address = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ?`, newHash, userAgent, ip, session.LastUsedAt, expiresAt, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &session, tx.Commit()
+}
+
+// IsActive reports whether a session exists and is neither revoked nor expired.
+func (r *SessionRepository) IsActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := r.DB.QueryRowContext(ctx, `SELECT revoked_at IS NULL AND expires_at > NOW() FROM sessions WHERE id = ?`, id).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+// ListActive returns a user's active sessions, most recently used first.
+func (r *SessionRepository) ListActive(ctx context.Context, userID string) ([]domain.Session, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, impersonator_user_id
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		var s domain.Session
+		var impersonatorID sql.NullString
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &impersonatorID); err != nil {
+			return nil, err
+		}
+		if impersonatorID.Valid {
+			s.ImpersonatorUserID = &impersonatorID.String
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// Revoke ends one of the user's sessions.
+func (r *SessionRepository) Revoke(ctx context.Context, id, userID string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of the user except exceptID, which may be empty.
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID, exceptID string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`, userID, exceptID)
+	return err
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/schooltj/internal/domain"
@@ -61,7 +60,7 @@ func (r *StudentRepository) GetByUserID(ctx context.Context, userID string) (*do
 // Sorts by rating_avg DESC by default.
 func (r *StudentRepository) ListStudents(ctx context.Context, limit, offset int, search string) ([]domain.User, error) {
 	query := `
-		SELECT id, email, name, role, rating_avg, rating_count, created_at, updated_at
+		SELECT id, COALESCE(email, ''), name, role, rating_avg, rating_count, created_at, updated_at
 		FROM users
 		WHERE role = 'student'
 	`
@@ -92,18 +91,19 @@ func (r *StudentRepository) ListStudents(ctx context.Context, limit, offset int,
 	return students, nil
 }
 
-// ListStudentsBySchool fetches students who are enrolled in courses belonging to the given school.
-func (r *StudentRepository) ListStudentsBySchool(ctx context.Context, schoolID string) ([]domain.User, error) {
+// ListStudentsBySchool fetches students who are enrolled in courses belonging to the given
+// school, or only to its branch when branchID is set.
+func (r *StudentRepository) ListStudentsBySchool(ctx context.Context, schoolID, branchID string) ([]domain.User, error) {
 	// A student is linked to a school if they have an enrollment in a course that belongs to that school.
 	query := `
-		SELECT DISTINCT u.id, u.email, u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
+		SELECT DISTINCT u.id, COALESCE(u.email, ''), u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
 		FROM users u
 		JOIN enrollments e ON u.id = e.student_user_id
 		JOIN courses c ON e.course_id = c.id
-		WHERE c.school_id = ?
+		WHERE c.school_id = ? AND (? = '' OR c.branch_id = ?)
 		ORDER BY u.name ASC
 	`
-	rows, err := r.DB.QueryContext(ctx, query, schoolID)
+	rows, err := r.DB.QueryContext(ctx, query, schoolID, branchID, branchID)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +124,7 @@ func (r *StudentRepository) ListStudentsBySchool(ctx context.Context, schoolID s
 func (r *StudentRepository) ListStudentsByTeacher(ctx context.Context, teacherID string) ([]domain.User, error) {
 	// A student is linked to a teacher if they have an enrollment in a course taught by that teacher.
 	query := `
-		SELECT DISTINCT u.id, u.email, u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
+		SELECT DISTINCT u.id, COALESCE(u.email, ''), u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
 		FROM users u
 		JOIN enrollments e ON u.id = e.student_user_id
 		JOIN courses c ON e.course_id = c.id
@@ -148,24 +148,10 @@ func (r *StudentRepository) ListStudentsByTeacher(ctx context.Context, teacherID
 	return students, nil
 }
 
-// GetStudentsBySchoolAdminID is a helper to get students for a school admin using their user ID
-func (r *StudentRepository) GetStudentsBySchoolAdminID(ctx context.Context, adminUserID string) ([]domain.User, error) {
-	// First find the school ID for this admin
-	var schoolID string
-	err := r.DB.QueryRowContext(ctx, "SELECT id FROM schools WHERE admin_user_id = ?", adminUserID).Scan(&schoolID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("school not found for admin %s", adminUserID)
-		}
-		return nil, err
-	}
-	return r.ListStudentsBySchool(ctx, schoolID)
-}
-
 // ListStudentsByCourse fetches students enrolled in a specific course, sorted by rating.
 func (r *StudentRepository) ListStudentsByCourse(ctx context.Context, courseID string, limit, offset int, search string) ([]domain.User, error) {
 	query := `
-		SELECT DISTINCT u.id, u.email, u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
+		SELECT DISTINCT u.id, COALESCE(u.email, ''), u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
 		FROM users u
 		JOIN enrollments e ON u.id = e.student_user_id
 		WHERE e.course_id = ? AND u.role = 'student' AND e.status = 'active'
@@ -200,7 +186,7 @@ func (r *StudentRepository) ListStudentsByCourse(ctx context.Context, courseID s
 // ListStudentsByConnection fetches students who share at least one course with the given user.
 func (r *StudentRepository) ListStudentsByConnection(ctx context.Context, userID string, limit, offset int, search string) ([]domain.User, error) {
 	query := `
-		SELECT DISTINCT u.id, u.email, u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
+		SELECT DISTINCT u.id, COALESCE(u.email, ''), u.name, u.role, u.rating_avg, u.rating_count, u.created_at, u.updated_at
 		FROM users u
 		JOIN enrollments e2 ON u.id = e2.student_user_id
 		WHERE e2.course_id IN (
@@ -240,7 +226,7 @@ func (r *StudentRepository) ListStudentsByConnection(ctx context.Context, userID
 // SearchStudentSuggestions returns lightweight autocomplete results (top 8 matches).
 func (r *StudentRepository) SearchStudentSuggestions(ctx context.Context, query string) ([]domain.User, error) {
 	sqlQuery := `
-		SELECT id, email, name, role, rating_avg, rating_count, created_at, updated_at
+		SELECT id, COALESCE(email, ''), name, role, rating_avg, rating_count, created_at, updated_at
 		FROM users
 		WHERE role = 'student' AND name LIKE ?
 		ORDER BY rating_avg DESC
@@ -338,3 +324,68 @@ func (r *StudentRepository) GetCertificate(ctx context.Context, studentID, cours
 	}
 	return &c, nil
 }
+
+// StudentAccess describes how one user is connected to a student. Only active and
+// completed enrollments connect a student to a school: an invitation or a request does not.
+type StudentAccess struct {
+	SchoolRole domain.SchoolRole // role on the staff of the student's school, or a school the student takes a course at; a branch manager's only if the course is at their branch
+	Guardian   bool              // has an active guardian link to the student
+}
+
+// GetStudentAccess loads what the authorization policy needs to know about a user and a
+// student. It returns ErrUserNotFound if no student has the ID.
+func (r *StudentRepository) GetStudentAccess(ctx context.Context, studentID, userID string) (*StudentAccess, error) {
+	query := `
+		SELECT
+			COALESCE((SELECT sm.role FROM school_members sm
+			          WHERE sm.user_id = ?
+			            AND (sm.branch_id IS NULL
+			                 AND (sm.school_id IN (SELECT st.school_id FROM students st WHERE st.user_id = u.id)
+			                   OR sm.school_id IN (SELECT c.school_id FROM enrollments e JOIN courses c ON e.course_id = c.id
+			                                       WHERE e.student_user_id = u.id AND e.status IN (?, ?)))
+			              OR sm.branch_id IN (SELECT c.branch_id FROM enrollments e JOIN courses c ON e.course_id = c.id
+			                                  WHERE e.student_user_id = u.id AND e.status IN (?, ?)))), ''),
+			EXISTS (SELECT 1 FROM guardian_links gl
+			        WHERE gl.student_user_id = u.id AND gl.guardian_user_id = ? AND gl.status = 'active')
+		FROM users u
+		WHERE u.id = ? AND u.role = 'student'
+	`
+	var a StudentAccess
+	err := r.DB.QueryRowContext(ctx, query, userID,
+		domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted, domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted,
+		userID, studentID).Scan(&a.SchoolRole, &a.Guardian)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// StaffCourseIDs returns the courses the student takes, actively or completed, at the
+// school the staff member works at, or at their branch for a branch manager.
+func (r *StudentRepository) StaffCourseIDs(ctx context.Context, studentID, staffUserID string) ([]string, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT DISTINCT c.id
+		FROM enrollments e
+		JOIN courses c ON e.course_id = c.id
+		JOIN school_members sm ON sm.school_id = c.school_id AND sm.user_id = ?
+		WHERE e.student_user_id = ? AND e.status IN (?, ?)
+		  AND (sm.branch_id IS NULL OR sm.branch_id = c.branch_id)`,
+		staffUserID, studentID, domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
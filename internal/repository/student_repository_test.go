@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+)
+
+func TestGetStudentAccessCountsOnlyActiveAndCompletedEnrollments(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+		// Every enrollment that can connect staff to the student must be filtered by status;
+		// an invitation or a request made by the school connects nobody.
+		joins := regexp.MustCompile(`FROM enrollments e JOIN courses c ON e\.course_id = c\.id\s+WHERE e\.student_user_id = u\.id AND e\.status IN \(\?, \?\)`)
+		if n, total := len(joins.FindAllString(actual, -1)), strings.Count(actual, "FROM enrollments"); n != 2 || total != 2 {
+			t.Errorf("%d of %d enrollment lookups filter by status, want 2 of 2:\n%s", n, total, actual)
+		}
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	active, completed := domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted
+	mock.ExpectQuery("").
+		WithArgs("staff-1", active, completed, active, completed, "staff-1", "student-1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "guardian"}).AddRow("", false))
+
+	access, err := NewStudentRepository(db).GetStudentAccess(context.Background(), "student-1", "staff-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.SchoolRole != "" || access.Guardian {
+		t.Fatalf("access = %+v, want none", access)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaffCourseIDsCountsOnlyActiveAndCompletedEnrollments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`JOIN school_members sm ON sm.school_id = c.school_id AND sm.user_id = \?\s+WHERE e.student_user_id = \? AND e.status IN \(\?, \?\)\s+AND \(sm.branch_id IS NULL OR sm.branch_id = c.branch_id\)`).
+		WithArgs("staff-1", "student-1", domain.EnrollmentStatusActive, domain.EnrollmentStatusCompleted).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("c1").AddRow("c2"))
+
+	ids, err := NewStudentRepository(db).StaffCourseIDs(context.Background(), "student-1", "staff-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "c1" || ids[1] != "c2" {
+		t.Fatalf("ids = %v, want [c1 c2]", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/schooltj/internal/domain"
+)
+
+var (
+	ErrTeacherInviteInvalid     = errors.New("invitation is invalid or has expired")
+	ErrTeacherInviteNotFound    = errors.New("invitation not found")
+	ErrTeacherAtAnotherSchool   = errors.New("this teacher already teaches at another school")
+	ErrTeacherAlreadyInSchool   = errors.New("this teacher already teaches at the school")
+	ErrTeacherInvitationPending = errors.New("this address already has a pending invitation; resend it instead")
+)
+
+type TeacherInvitationRepository struct {
+	DB *sql.DB
+}
+
+func NewTeacherInvitationRepository(db *sql.DB) *TeacherInvitationRepository {
+	return &TeacherInvitationRepository{DB: db}
+}
+
+const teacherInvitationSelect = `
+	SELECT ti.id, ti.school_id, s.name, ti.email, COALESCE(ti.bio, ''), ti.invited_by, ti.status,
+	       ti.expires_at, ti.accepted_by, ti.accepted_at, ti.created_at
+	FROM teacher_invitations ti
+	JOIN schools s ON ti.school_id = s.id
+`
+
+func (r *TeacherInvitationRepository) scanInvitations(ctx context.Context, query string, args ...interface{}) ([]domain.TeacherInvitation, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []domain.TeacherInvitation
+	for rows.Next() {
+		var inv domain.TeacherInvitation
+		var acceptedBy sql.NullString
+		var acceptedAt sql.NullTime
+		if err := rows.Scan(&inv.ID, &inv.SchoolID, &inv.SchoolName, &inv.Email, &inv.Bio, &inv.InvitedBy, &inv.Status,
+			&inv.ExpiresAt, &acceptedBy, &acceptedAt, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		if acceptedBy.Valid {
+			inv.AcceptedBy = &acceptedBy.String
+		}
+		if acceptedAt.Valid {
+			inv.AcceptedAt = &acceptedAt.Time
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// Create stores a pending invitation that the holder of the token can accept. An address
+// can have only one unexpired pending invitation to a school.
+func (r *TeacherInvitationRepository) Create(ctx context.Context, inv *domain.TeacherInvitation, tokenHash string) error {
+	var pending bool
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM teacher_invitations WHERE school_id = ? AND email = ? AND status = ? AND expires_at > NOW())`,
+		inv.SchoolID, inv.Email, domain.TeacherInvitationPending).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrTeacherInvitationPending
+	}
+
+	inv.ID = uuid.New().String()
+	inv.Status = domain.TeacherInvitationPending
+	inv.CreatedAt = time.Now()
+	_, err = r.DB.ExecContext(ctx, `
+		INSERT INTO teacher_invitations (id, school_id, email, bio, invited_by, token_hash, status, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.ID, inv.SchoolID, inv.Email, inv.Bio, inv.InvitedBy, tokenHash, inv.Status, inv.ExpiresAt)
+	return err
+}
+
+func (r *TeacherInvitationRepository) GetByID(ctx context.Context, id string) (*domain.TeacherInvitation, error) {
+	invitations, err := r.scanInvitations(ctx, teacherInvitationSelect+` WHERE ti.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(invitations) == 0 {
+		return nil, ErrTeacherInviteNotFound
+	}
+	return &invitations[0], nil
+}
+
+// GetPendingByToken returns the pending, unexpired invitation the token belongs to.
+func (r *TeacherInvitationRepository) GetPendingByToken(ctx context.Context, tokenHash string) (*domain.TeacherInvitation, error) {
+	invitations, err := r.scanInvitations(ctx, teacherInvitationSelect+`
+		WHERE ti.token_hash = ? AND ti.status = ? AND ti.expires_at > NOW()`,
+		tokenHash, domain.TeacherInvitationPending)
+	if err != nil {
+		return nil, err
+	}
+	if len(invitations) == 0 {
+		return nil, ErrTeacherInviteInvalid
+	}
+	return &invitations[0], nil
+}
+
+// ListBySchool returns the school's pending and accepted invitations, newest first.
+func (r *TeacherInvitationRepository) ListBySchool(ctx context.Context, schoolID string) ([]domain.TeacherInvitation, error) {
+	return r.scanInvitations(ctx, teacherInvitationSelect+`
+		WHERE ti.school_id = ? AND ti.status <> ?
+		ORDER BY ti.created_at DESC`, schoolID, domain.TeacherInvitationRevoked)
+}
+
+// Renew gives a pending invitation a new token and expiry; the old link stops working.
+func (r *TeacherInvitationRepository) Renew(ctx context.Context, id, tokenHash string, expiresAt time.Time) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE teacher_invitations SET token_hash = ?, expires_at = ? WHERE id = ? AND status = ?`,
+		tokenHash, expiresAt, id, domain.TeacherInvitationPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTeacherInviteInvalid
+	}
+	return nil
+}
+
+// Revoke withdraws a pending invitation.
+func (r *TeacherInvitationRepository) Revoke(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE teacher_invitations SET status = ?, token_hash = NULL WHERE id = ? AND status = ?`,
+		domain.TeacherInvitationRevoked, id, domain.TeacherInvitationPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTeacherInviteInvalid
+	}
+	return nil
+}
+
+// Accept links the teacher's profile to the school of a pending, unexpired invitation and
+// uses the invitation up. A teacher belongs to at most one school, so one already teaching
+// elsewhere must be removed there first. The invitation's bio fills an empty profile bio.
+func (r *TeacherInvitationRepository) Accept(ctx context.Context, id, teacherID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var schoolID, bio string
+	err = tx.QueryRowContext(ctx, `
+		SELECT school_id, COALESCE(bio, '') FROM teacher_invitations
+		WHERE id = ? AND status = ? AND expires_at > NOW() FOR UPDATE`,
+		id, domain.TeacherInvitationPending).Scan(&schoolID, &bio)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTeacherInviteInvalid
+		}
+		return err
+	}
+
+	var current sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT school_id FROM teacher_profiles WHERE user_id = ? FOR UPDATE`, teacherID).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTeacherProfileNotFound
+		}
+		return err
+	}
+	if current.Valid && current.String == schoolID {
+		return ErrTeacherAlreadyInSchool
+	}
+	if current.Valid {
+		return ErrTeacherAtAnotherSchool
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE teacher_profiles SET school_id = ?, bio = IF(COALESCE(bio, '') = '', ?, bio), updated_at = NOW()
+		WHERE user_id = ?`, schoolID, bio, teacherID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE teacher_invitations SET status = ?, token_hash = NULL, accepted_by = ?, accepted_at = NOW()
+		WHERE id = ?`, domain.TeacherInvitationAccepted, teacherID, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -23,7 +23,7 @@ func (r *TeacherRepository) ListTeachers(ctx context.Context, limit, offset int,
 	query := `
 		SELECT 
 			u.id, 
-			u.email, 
+			COALESCE(u.email, ''), 
 			u.name, 
 			u.role, 
 			u.avatar_url, 
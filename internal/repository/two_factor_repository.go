@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+type TwoFactorRepository struct {
+	DB *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{DB: db}
+}
+
+// GetTOTP returns the user's TOTP secret (empty if none), whether enrollment was completed,
+// and the last time step a code was accepted for.
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID string) (string, bool, int64, error) {
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	err := r.DB.QueryRowContext(ctx, `SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users WHERE id = ?`, userID).
+		Scan(&secret, &enabled, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, 0, ErrUserNotFound
+	}
+	return secret.String, enabled, lastStep, err
+}
+
+// SetPendingSecret stores a secret for an enrollment that is not confirmed yet.
+func (r *TwoFactorRepository) SetPendingSecret(ctx context.Context, userID, secret string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled_at IS NULL`, secret, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+	return nil
+}
+
+// Enable completes enrollment: step is the time step of the code that confirmed it, and
+// codeHashes become the user's recovery codes.
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET totp_enabled_at = NOW(), totp_last_step = ? WHERE id = ? AND totp_enabled_at IS NULL`, step, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Disable turns two-factor authentication off and drops the recovery codes.
+func (r *TwoFactorRepository) Disable(ctx context.Context, userID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep records that a code for step was accepted. It reports false if a code for that
+// step or a later one was already used, which makes every code single-use.
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CreateChallenge opens a second-factor challenge for the user until expiresAt, clearing
+// their expired ones.
+func (r *TwoFactorRepository) CreateChallenge(ctx context.Context, userID string, expiresAt time.Time) (string, error) {
+	if _, err := r.DB.ExecContext(ctx, `DELETE FROM two_factor_challenges WHERE user_id = ? AND expires_at <= NOW()`, userID); err != nil {
+		return "", err
+	}
+	id := uuid.New().String()
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO two_factor_challenges (id, user_id, expires_at) VALUES (?, ?, ?)`, id, userID, expiresAt)
+	return id, err
+}
+
+// UseChallengeAttempt takes one of the challenge's attempts. It reports false if the
+// challenge is unknown, expired, another user's, or has no attempts left.
+func (r *TwoFactorRepository) UseChallengeAttempt(ctx context.Context, challengeID, userID string, maxAttempts int) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE two_factor_challenges SET attempts = attempts + 1
+		WHERE id = ? AND user_id = ? AND expires_at > NOW() AND attempts < ?`, challengeID, userID, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteChallenge ends a challenge so its token cannot be used again.
+func (r *TwoFactorRepository) DeleteChallenge(ctx context.Context, challengeID string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM two_factor_challenges WHERE id = ?`, challengeID)
+	return err
+}
+
+// ReplaceRecoveryCodes swaps all of the user's recovery codes for new ones.
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO two_factor_recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)`, uuid.New().String(), userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes used. It reports false if
+// the user has no such unused code.
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE two_factor_recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CountRecoveryCodes counts the user's unused recovery codes.
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM two_factor_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// IsRequiredForTeacher reports whether a school the teacher belongs to, or runs a course
+// at, requires two-factor authentication from its teachers.
+func (r *TwoFactorRepository) IsRequiredForTeacher(ctx context.Context, teacherID string) (bool, error) {
+	var required bool
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM schools s
+			WHERE s.require_teacher_2fa
+			  AND (s.id IN (SELECT school_id FROM teacher_profiles WHERE user_id = ?)
+			    OR s.id IN (SELECT school_id FROM courses WHERE teacher_id = ?))
+		)`, teacherID, teacherID).Scan(&required)
+	return required, err
+}
+
+func (r *TwoFactorRepository) GetSchoolPolicy(ctx context.Context, schoolID string) (bool, error) {
+	var required bool
+	err := r.DB.QueryRowContext(ctx, `SELECT require_teacher_2fa FROM schools WHERE id = ?`, schoolID).Scan(&required)
+	return required, err
+}
+
+func (r *TwoFactorRepository) SetSchoolPolicy(ctx context.Context, schoolID string, required bool) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE schools SET require_teacher_2fa = ?, updated_at = NOW() WHERE id = ?`, required, schoolID)
+	return err
+}
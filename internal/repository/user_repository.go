@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/schooltj/internal/domain"
@@ -21,8 +22,8 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User) error {
 	user.ID = uuid.New().String()
-	query := `INSERT INTO users (id, email, name, password_hash, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, NOW(), NOW())`
-	_, err := r.DB.ExecContext(ctx, query, user.ID, user.Email, user.Name, user.PasswordHash, user.Role)
+	query := `INSERT INTO users (id, email, phone, name, password_hash, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	_, err := r.DB.ExecContext(ctx, query, user.ID, nullIfEmpty(user.Email), user.Phone, user.Name, user.PasswordHash, user.Role)
 	if err != nil {
 		return err
 	}
@@ -30,46 +31,85 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User) erro
 }
 
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, email, name, password_hash, role, avatar_url, rating_avg, rating_count, created_at, updated_at FROM users WHERE email = ?`
-	row := r.DB.QueryRowContext(ctx, query, email)
+	return r.getUser(ctx, "email", email)
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+	return r.getUser(ctx, "id", id)
+}
+
+// GetUserByPhone looks a user up by an E.164 phone number.
+func (r *UserRepository) GetUserByPhone(ctx context.Context, phone string) (*domain.User, error) {
+	return r.getUser(ctx, "phone", phone)
+}
+
+// getUser loads the user whose column equals value. column is always a constant.
+func (r *UserRepository) getUser(ctx context.Context, column, value string) (*domain.User, error) {
+	query := `SELECT id, email, email_verified_at, email_verification_assumed, phone, phone_verified_at, name, password_hash, role, avatar_url, rating_avg, rating_count, suspended_at, COALESCE(suspension_reason, ''), created_at, updated_at FROM users WHERE ` + column + ` = ?`
+	row := r.DB.QueryRowContext(ctx, query, value)
 
 	var user domain.User
-	var avatarURL sql.NullString
-	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.Role, &avatarURL, &user.RatingAvg, &user.RatingCount, &user.CreatedAt, &user.UpdatedAt)
+	var email, phone, avatarURL sql.NullString
+	var verifiedAt, phoneVerifiedAt, suspendedAt sql.NullTime
+	err := row.Scan(&user.ID, &email, &verifiedAt, &user.EmailAssumed, &phone, &phoneVerifiedAt, &user.Name, &user.PasswordHash, &user.Role, &avatarURL, &user.RatingAvg, &user.RatingCount, &suspendedAt, &user.SuspensionReason, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
+	user.Email = email.String
 	if avatarURL.Valid {
 		user.AvatarURL = &avatarURL.String
 	}
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if phone.Valid {
+		user.Phone = &phone.String
+	}
+	if phoneVerifiedAt.Valid {
+		user.PhoneVerifiedAt = &phoneVerifiedAt.Time
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
 	return &user, nil
 }
 
-func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
-	query := `SELECT id, email, name, password_hash, role, avatar_url, rating_avg, rating_count, created_at, updated_at FROM users WHERE id = ?`
-	row := r.DB.QueryRowContext(ctx, query, id)
+// UpdateUser saves the name and email. A changed email has to be verified again.
+func (r *UserRepository) UpdateUser(ctx context.Context, user *domain.User) error {
+	query := `UPDATE users SET email_verified_at = IF(email = ?, email_verified_at, NULL), email = ?, name = ?, updated_at = NOW() WHERE id = ?`
+	_, err := r.DB.ExecContext(ctx, query, user.Email, nullIfEmpty(user.Email), user.Name, user.ID)
+	return err
+}
 
-	var user domain.User
-	var avatarURL sql.NullString
-	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.Role, &avatarURL, &user.RatingAvg, &user.RatingCount, &user.CreatedAt, &user.UpdatedAt)
+// MarkPhoneVerified records that the user proved they own their phone number.
+func (r *UserRepository) MarkPhoneVerified(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET phone_verified_at = COALESCE(phone_verified_at, NOW()), updated_at = NOW() WHERE id = ?`, userID)
+	return err
+}
+
+// ReleaseUnverifiedPhone takes the phone number off the account holding it if the account
+// never proved it owns the number and no code sent to it is still live. It reports
+// whether the number was released.
+func (r *UserRepository) ReleaseUnverifiedPhone(ctx context.Context, phone string) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE users SET phone = NULL, updated_at = NOW()
+		WHERE phone = ? AND phone_verified_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM phone_otps o WHERE o.phone = ? AND o.consumed_at IS NULL AND o.expires_at > NOW())`,
+		phone, phone)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-	if avatarURL.Valid {
-		user.AvatarURL = &avatarURL.String
+		return false, err
 	}
-	return &user, nil
+	n, err := res.RowsAffected()
+	return n == 1, err
 }
 
-func (r *UserRepository) UpdateUser(ctx context.Context, user *domain.User) error {
-	query := `UPDATE users SET email = ?, name = ?, updated_at = NOW() WHERE id = ?`
-	_, err := r.DB.ExecContext(ctx, query, user.Email, user.Name, user.ID)
+// MarkEmailVerified records that the address was confirmed some other way than our own
+// verification email, e.g. by a sign-in provider.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), email_verification_assumed = FALSE, updated_at = NOW() WHERE id = ?`, userID)
 	return err
 }
 
@@ -86,7 +126,7 @@ func (r *UserRepository) UpdatePassword(ctx context.Context, userID, hashedPassw
 }
 
 func (r *UserRepository) SearchUsers(ctx context.Context, q string) ([]domain.User, error) {
-	query := `SELECT id, email, COALESCE(name, '') as name, role, avatar_url, rating_avg, rating_count FROM users WHERE name LIKE ? OR email LIKE ? ORDER BY name LIMIT 10`
+	query := `SELECT id, COALESCE(email, ''), COALESCE(name, '') as name, role, avatar_url, rating_avg, rating_count FROM users WHERE name LIKE ? OR email LIKE ? ORDER BY name LIMIT 10`
 	pattern := "%" + q + "%"
 	rows, err := r.DB.QueryContext(ctx, query, pattern, pattern)
 	if err != nil {
@@ -107,3 +147,141 @@ func (r *UserRepository) SearchUsers(ctx context.Context, q string) ([]domain.Us
 	}
 	return users, nil
 }
+
+// IsEmailVerified reports whether the user has confirmed their contact details: their
+// email address, or their phone number for accounts that signed up with one.
+func (r *UserRepository) IsEmailVerified(ctx context.Context, userID string) (bool, error) {
+	var verified bool
+	err := r.DB.QueryRowContext(ctx, `SELECT email_verified_at IS NOT NULL OR phone_verified_at IS NOT NULL FROM users WHERE id = ?`, userID).Scan(&verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	return verified, err
+}
+
+// GetLockedUntil returns when the user's account unlocks, nil if it is not locked.
+func (r *UserRepository) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `SELECT locked_until FROM users WHERE id = ? AND locked_until > NOW()`, userID).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockedUntil.Time, nil
+}
+
+// RecordLoginFailure counts a wrong password. The threshold-th failure in a row locks the
+// account until lockUntil and resets the count; it reports whether this call locked it.
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, userID string, threshold int, lockUntil time.Time) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	if err := tx.QueryRowContext(ctx, `SELECT failed_login_count FROM users WHERE id = ? FOR UPDATE`, userID).Scan(&failures); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	failures++
+	locked := failures >= threshold
+	if locked {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET failed_login_count = 0, locked_until = ? WHERE id = ?`, lockUntil, userID)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET failed_login_count = ? WHERE id = ?`, failures, userID)
+	}
+	if err != nil {
+		return false, err
+	}
+	return locked, tx.Commit()
+}
+
+// ResetLoginFailures clears the failure count after a successful sign-in.
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = ? AND (failed_login_count > 0 OR locked_until IS NOT NULL)`, userID)
+	return err
+}
+
+// UserListFilter narrows the admin user list. Zero values match everything.
+type UserListFilter struct {
+	Query     string // matched against name, email and phone
+	Role      domain.Role
+	Suspended *bool
+	Limit     int
+	Offset    int
+}
+
+// ListUsers returns users matching the filter, newest first.
+func (r *UserRepository) ListUsers(ctx context.Context, f UserListFilter) ([]domain.User, error) {
+	query := `SELECT id, COALESCE(email, ''), email_verified_at, phone, name, role, suspended_at, COALESCE(suspension_reason, ''), created_at FROM users WHERE 1 = 1`
+	var args []interface{}
+	if f.Query != "" {
+		pattern := "%" + f.Query + "%"
+		query += ` AND (name LIKE ? OR email LIKE ? OR phone LIKE ?)`
+		args = append(args, pattern, pattern, pattern)
+	}
+	if f.Role != "" {
+		query += ` AND role = ?`
+		args = append(args, f.Role)
+	}
+	if f.Suspended != nil {
+		if *f.Suspended {
+			query += ` AND suspended_at IS NOT NULL`
+		} else {
+			query += ` AND suspended_at IS NULL`
+		}
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []domain.User
+	for rows.Next() {
+		var u domain.User
+		var phone sql.NullString
+		var verifiedAt, suspendedAt sql.NullTime
+		if err := rows.Scan(&u.ID, &u.Email, &verifiedAt, &phone, &u.Name, &u.Role, &suspendedAt, &u.SuspensionReason, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		if verifiedAt.Valid {
+			u.EmailVerifiedAt = &verifiedAt.Time
+		}
+		if phone.Valid {
+			u.Phone = &phone.String
+		}
+		if suspendedAt.Valid {
+			u.SuspendedAt = &suspendedAt.Time
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Suspend blocks the user from signing in until Unsuspend. An already suspended account
+// keeps its original suspension time.
+func (r *UserRepository) Suspend(ctx context.Context, userID, reason string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()), suspension_reason = ? WHERE id = ?`, reason, userID)
+	return err
+}
+
+func (r *UserRepository) Unsuspend(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET suspended_at = NULL, suspension_reason = NULL WHERE id = ?`, userID)
+	return err
+}
+
+// nullIfEmpty stores an empty optional string as NULL, which unique indexes allow many of.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+const (
+	adminPageSize    = 50
+	adminMaxPageSize = 200
+)
+
+var (
+	ErrReasonRequired    = errors.New("a reason is required")
+	ErrCannotSuspendSelf = errors.New("you cannot suspend your own account")
+)
+
+// AdminService backs the platform admin console: managing accounts, reviewing schools,
+// moderating ratings and platform metrics. Routes reach it only through admin-only
+// middleware; every change it makes is written to the audit log.
+type AdminService struct {
+	repo        *repository.AdminRepository
+	userRepo    *repository.UserRepository
+	schoolRepo  *repository.SchoolRepository
+	ratingRepo  *repository.RatingRepository
+	sessionRepo *repository.SessionRepository
+	audit       *repository.AuditRepository
+	auth        *AuthService
+}
+
+func NewAdminService(repo *repository.AdminRepository, userRepo *repository.UserRepository, schoolRepo *repository.SchoolRepository, ratingRepo *repository.RatingRepository,
+	sessionRepo *repository.SessionRepository, audit *repository.AuditRepository, auth *AuthService) *AdminService {
+	return &AdminService{
+		repo:        repo,
+		userRepo:    userRepo,
+		schoolRepo:  schoolRepo,
+		ratingRepo:  ratingRepo,
+		sessionRepo: sessionRepo,
+		audit:       audit,
+		auth:        auth,
+	}
+}
+
+// pageLimit clamps a requested page size.
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return adminPageSize
+	}
+	if limit > adminMaxPageSize {
+		return adminMaxPageSize
+	}
+	return limit
+}
+
+func (s *AdminService) record(ctx context.Context, admin Actor, action, targetType, targetID, ip, details string) error {
+	return s.audit.Create(ctx, &domain.AuditEntry{
+		ActorUserID: &admin.UserID,
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		IPAddress:   ip,
+		Details:     details,
+	})
+}
+
+func (s *AdminService) ListUsers(ctx context.Context, filter repository.UserListFilter) ([]domain.User, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	filter.Limit = pageLimit(filter.Limit)
+	return s.userRepo.ListUsers(ctx, filter)
+}
+
+// SuspendUser blocks the account from signing in and ends its sessions.
+func (s *AdminService) SuspendUser(ctx context.Context, admin Actor, userID, reason, ip string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	if userID == admin.UserID {
+		return ErrCannotSuspendSelf
+	}
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.Suspend(ctx, userID, reason); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAll(ctx, userID, ""); err != nil {
+		return err
+	}
+	return s.record(ctx, admin, domain.AuditUserSuspended, "user", userID, ip, reason)
+}
+
+func (s *AdminService) UnsuspendUser(ctx context.Context, admin Actor, userID, ip string) error {
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.Unsuspend(ctx, userID); err != nil {
+		return err
+	}
+	return s.record(ctx, admin, domain.AuditUserUnsuspended, "user", userID, ip, "")
+}
+
+// Impersonate signs the admin in as the user for support. A reason is required and kept
+// in the audit log.
+func (s *AdminService) Impersonate(ctx context.Context, admin Actor, userID, reason string, device SessionDevice) (*domain.AuthTokens, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	return s.auth.Impersonate(ctx, admin, userID, reason, device)
+}
+
+func (s *AdminService) ListSchools(ctx context.Context, verified *bool) ([]domain.School, error) {
+	return s.schoolRepo.ListForReview(ctx, verified)
+}
+
+// ReviewSchool marks a school verified or not, with a note explaining the decision.
+func (s *AdminService) ReviewSchool(ctx context.Context, admin Actor, schoolID string, verified bool, note, ip string) error {
+	note = strings.TrimSpace(note)
+	if err := s.schoolRepo.SetVerification(ctx, schoolID, verified, note, admin.UserID); err != nil {
+		return err
+	}
+	action := domain.AuditSchoolVerified
+	if !verified {
+		action = domain.AuditSchoolUnverified
+	}
+	return s.record(ctx, admin, action, "school", schoolID, ip, note)
+}
+
+func (s *AdminService) ListRatings(ctx context.Context, hidden *bool, limit, offset int) ([]repository.RatingWithReviewer, error) {
+	return s.ratingRepo.ListForModeration(ctx, hidden, pageLimit(limit), offset)
+}
+
+// SetRatingHidden hides a rating from listings and averages, or restores it.
+func (s *AdminService) SetRatingHidden(ctx context.Context, admin Actor, ratingID string, hidden bool, note, ip string) error {
+	note = strings.TrimSpace(note)
+	if err := s.ratingRepo.SetHidden(ctx, ratingID, hidden, note, admin.UserID); err != nil {
+		return err
+	}
+	action := domain.AuditRatingHidden
+	if !hidden {
+		action = domain.AuditRatingRestored
+	}
+	return s.record(ctx, admin, action, "rating", ratingID, ip, note)
+}
+
+func (s *AdminService) DeleteRating(ctx context.Context, admin Actor, ratingID, reason, ip string) error {
+	if err := s.ratingRepo.Delete(ctx, ratingID); err != nil {
+		return err
+	}
+	return s.record(ctx, admin, domain.AuditRatingDeleted, "rating", ratingID, ip, strings.TrimSpace(reason))
+}
+
+func (s *AdminService) Metrics(ctx context.Context) (*domain.PlatformMetrics, error) {
+	return s.repo.PlatformMetrics(ctx)
+}
+
+func (s *AdminService) AuditLog(ctx context.Context, filter repository.AuditFilter) ([]domain.AuditEntry, error) {
+	filter.Limit = pageLimit(filter.Limit)
+	return s.audit.List(ctx, filter)
+}
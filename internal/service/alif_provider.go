@@ -1,22 +1,51 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/schooltj/internal/domain"
 )
 
+const defaultAlifBaseURL = "https://api.alifpay.tj/v1"
+
 // AlifProvider implements Alif Pay (Alif Mobi) integration.
+//
+// Every request to Alif carries the merchant ID and an HMAC-SHA256 signature
+// of the request body (or of the transaction ID for status lookups) keyed with Secret.
+// Callbacks are signed the same way over the raw body in the X-Signature header.
 type AlifProvider struct {
-	MerchantID string
-	Secret     string
+	MerchantID  string
+	Secret      string
+	BaseURL     string // e.g. https://api.alifpay.tj/v1, overridable for tests
+	CallbackURL string // where Alif POSTs payment notifications
+	ReturnURL   string // where the payer is sent after checkout
+	HTTPClient  *http.Client
 }
 
-func NewAlifProvider(merchantID, secret string) *AlifProvider {
+func NewAlifProvider(merchantID, secret, baseURL, callbackURL, returnURL string) *AlifProvider {
+	if baseURL == "" {
+		baseURL = defaultAlifBaseURL
+	}
 	return &AlifProvider{
-		MerchantID: merchantID,
-		Secret:     secret,
+		MerchantID:  merchantID,
+		Secret:      secret,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		CallbackURL: callbackURL,
+		ReturnURL:   returnURL,
+		HTTPClient:  &http.Client{Timeout: 15 * time.Second},
 	}
 }
 
@@ -24,27 +53,195 @@ func (p *AlifProvider) Name() string {
 	return domain.PaymentMethodAlif
 }
 
+type alifCheckoutRequest struct {
+	MerchantID  string `json:"merchant_id"`
+	OrderID     string `json:"order_id"`
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	ReturnURL   string `json:"return_url,omitempty"`
+}
+
+type alifCheckoutResponse struct {
+	TransactionID string `json:"transaction_id"`
+	CheckoutURL   string `json:"checkout_url"`
+	Status        string `json:"status"`
+}
+
+type alifStatusResponse struct {
+	TransactionID string `json:"transaction_id"`
+	OrderID       string `json:"order_id"`
+	Status        string `json:"status"`
+	Amount        string `json:"amount"`
+}
+
 func (p *AlifProvider) InitiatePayment(ctx context.Context, pay *domain.Payment) (string, string, error) {
-	// In a real implementation, this would send a request to Alif's payment API
-	// e.g. POST https://api.alifpay.tj/v1/checkout
-	// with MerchantID and Amount.
+	currency := pay.Currency
+	if currency == "" {
+		currency = domain.BaseCurrency
+	}
+	body, err := json.Marshal(alifCheckoutRequest{
+		MerchantID:  p.MerchantID,
+		OrderID:     pay.ID,
+		Amount:      fmt.Sprintf("%.2f", pay.Amount),
+		Currency:    currency,
+		CallbackURL: p.CallbackURL,
+		ReturnURL:   p.ReturnURL,
+	})
+	if err != nil {
+		return "", "", err
+	}
 
-	// For now, we simulate a provider transaction ID and a checkout URL.
-	providerID := fmt.Sprintf("ALF-%s", pay.ID)
-	mockRedirectURL := fmt.Sprintf("https://alifpay.tj/pay/%s?amount=%.2f", providerID, pay.Amount)
+	var resp alifCheckoutResponse
+	if err := p.do(ctx, http.MethodPost, p.BaseURL+"/checkout", body, body, &resp); err != nil {
+		return "", "", fmt.Errorf("alif checkout: %w", err)
+	}
+	if resp.TransactionID == "" || resp.CheckoutURL == "" {
+		return "", "", errors.New("alif checkout: incomplete response")
+	}
 
-	return mockRedirectURL, providerID, nil
+	return resp.CheckoutURL, resp.TransactionID, nil
 }
 
-func (p *AlifProvider) HandleCallback(ctx context.Context, payload interface{}) (string, string, error) {
-	// Typically Alif sends a JSON/Form POST with 'transaction_id', 'status', and 'signature'.
-	// This would involve signature verification.
+func (p *AlifProvider) HandleCallback(ctx context.Context, body []byte, header http.Header) (string, string, float64, error) {
+	if !verifyHMACSHA256(p.Secret, body, header.Get("X-Signature")) {
+		return "", "", 0, ErrInvalidSignature
+	}
+
+	var payload alifStatusResponse
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", 0, fmt.Errorf("alif callback: %w", err)
+	}
+	if payload.TransactionID == "" {
+		return "", "", 0, errors.New("alif callback: missing transaction_id")
+	}
+	amount, err := alifAmount(payload.Amount)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("alif callback: %w", err)
+	}
+
+	return payload.TransactionID, alifStatus(payload.Status), amount, nil
+}
+
+func (p *AlifProvider) GetStatus(ctx context.Context, providerID string) (string, float64, error) {
+	var resp alifStatusResponse
+	endpoint := p.BaseURL + "/status/" + url.PathEscape(providerID)
+	if err := p.do(ctx, http.MethodGet, endpoint, nil, []byte(providerID), &resp); err != nil {
+		return "", 0, fmt.Errorf("alif status: %w", err)
+	}
+	amount, err := alifAmount(resp.Amount)
+	if err != nil {
+		return "", 0, fmt.Errorf("alif status: %w", err)
+	}
+	return alifStatus(resp.Status), amount, nil
+}
+
+// alifAmount reads an amount Alif reports as a decimal string, 0 if it reports none.
+func alifAmount(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
 
-	// Mock logic:
-	return "ALF-MOCK-ID", domain.PaymentStatusSuccess, nil
+type alifRefundRequest struct {
+	MerchantID    string `json:"merchant_id"`
+	TransactionID string `json:"transaction_id"`
+	Amount        string `json:"amount"`
+	Reason        string `json:"reason,omitempty"`
 }
 
-func (p *AlifProvider) GetStatus(ctx context.Context, providerID string) (string, error) {
-	// Query Alif API for status: GET https://api.alifpay.tj/v1/status/{providerID}
-	return domain.PaymentStatusSuccess, nil
+type alifRefundResponse struct {
+	RefundID string `json:"refund_id"`
+	Status   string `json:"status"`
+}
+
+func (p *AlifProvider) Refund(ctx context.Context, pay *domain.Payment, amount float64, reason string) (string, error) {
+	body, err := json.Marshal(alifRefundRequest{
+		MerchantID:    p.MerchantID,
+		TransactionID: pay.ExternalID,
+		Amount:        fmt.Sprintf("%.2f", amount),
+		Reason:        reason,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp alifRefundResponse
+	if err := p.do(ctx, http.MethodPost, p.BaseURL+"/refund", body, body, &resp); err != nil {
+		return "", fmt.Errorf("alif refund: %w", err)
+	}
+	if alifStatus(resp.Status) == domain.PaymentStatusFailed {
+		return "", fmt.Errorf("alif refund: %s", resp.Status)
+	}
+	return resp.RefundID, nil
+}
+
+// do sends a signed request to the Alif API and decodes the JSON response into out.
+// signed is the byte string covered by the X-Signature header.
+func (p *AlifProvider) do(ctx context.Context, method, endpoint string, body, signed []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Merchant-ID", p.MerchantID)
+	req.Header.Set("X-Signature", signHMACSHA256(p.Secret, signed))
+
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// alifStatus maps Alif transaction states onto our payment statuses.
+func alifStatus(s string) string {
+	switch strings.ToLower(s) {
+	case "approved", "paid", "success", "completed":
+		return domain.PaymentStatusSuccess
+	case "canceled", "cancelled", "declined", "failed", "expired":
+		return domain.PaymentStatusFailed
+	default:
+		return domain.PaymentStatusPending
+	}
+}
+
+func hmacSHA256(secret string, data []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func signHMACSHA256(secret string, data []byte) string {
+	return hex.EncodeToString(hmacSHA256(secret, data))
+}
+
+// verifyHMACSHA256 compares a hex signature in constant time.
+func verifyHMACSHA256(secret string, data []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	return hmac.Equal(hmacSHA256(secret, data), got)
 }
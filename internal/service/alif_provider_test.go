@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/schooltj/internal/domain"
+)
+
+// alifStandIn is a local stand-in for the Alif API that checks every request is signed.
+func alifStandIn(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, body []byte)) *AlifProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Merchant-ID"); got != "merchant-1" {
+			t.Errorf("X-Merchant-ID = %q", got)
+		}
+		handle(w, r, body)
+	}))
+	t.Cleanup(srv.Close)
+	return NewAlifProvider("merchant-1", "alif-secret", srv.URL, "https://school.tj/api/payments/webhook/alif", "https://school.tj/return")
+}
+
+func TestAlifInitiatePayment(t *testing.T) {
+	p := alifStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.Method != http.MethodPost || r.URL.Path != "/checkout" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if !verifyHMACSHA256("alif-secret", body, r.Header.Get("X-Signature")) {
+			t.Error("checkout request signature does not cover the body")
+		}
+		var req alifCheckoutRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.OrderID != "pay-1" || req.Amount != "150.50" || req.Currency != domain.CurrencyTJS || req.MerchantID != "merchant-1" {
+			t.Errorf("checkout request %+v", req)
+		}
+		json.NewEncoder(w).Encode(alifCheckoutResponse{TransactionID: "tx-1", CheckoutURL: "https://alif.tj/pay/tx-1", Status: "created"})
+	})
+
+	redirect, txID, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 150.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect != "https://alif.tj/pay/tx-1" || txID != "tx-1" {
+		t.Fatalf("got %q, %q", redirect, txID)
+	}
+}
+
+func TestAlifInitiatePaymentRejected(t *testing.T) {
+	p := alifStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		http.Error(w, `{"error":"bad merchant"}`, http.StatusUnauthorized)
+	})
+	if _, _, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 10}); err == nil {
+		t.Fatal("expected an error for a rejected checkout")
+	}
+}
+
+func TestAlifGetStatus(t *testing.T) {
+	tests := []struct {
+		alif string
+		want string
+	}{
+		{"approved", domain.PaymentStatusSuccess},
+		{"PAID", domain.PaymentStatusSuccess},
+		{"declined", domain.PaymentStatusFailed},
+		{"expired", domain.PaymentStatusFailed},
+		{"processing", domain.PaymentStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alif, func(t *testing.T) {
+			p := alifStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+				if r.Method != http.MethodGet || r.URL.Path != "/status/tx-1" {
+					t.Errorf("request %s %s", r.Method, r.URL.Path)
+				}
+				if !verifyHMACSHA256("alif-secret", []byte("tx-1"), r.Header.Get("X-Signature")) {
+					t.Error("status request signature does not cover the transaction ID")
+				}
+				json.NewEncoder(w).Encode(alifStatusResponse{TransactionID: "tx-1", Status: tt.alif, Amount: "150.50"})
+			})
+			got, amount, err := p.GetStatus(context.Background(), "tx-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || amount != 150.50 {
+				t.Fatalf("status %q for %v, want %q for 150.50", got, amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlifHandleCallback(t *testing.T) {
+	p := NewAlifProvider("merchant-1", "alif-secret", "", "", "")
+	body := []byte(`{"transaction_id":"tx-1","order_id":"pay-1","status":"approved","amount":"150.50"}`)
+
+	header := http.Header{}
+	header.Set("X-Signature", signHMACSHA256("alif-secret", body))
+	txID, status, amount, err := p.HandleCallback(context.Background(), body, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txID != "tx-1" || status != domain.PaymentStatusSuccess || amount != 150.50 {
+		t.Fatalf("got %q, %q, %v", txID, status, amount)
+	}
+
+	forged := http.Header{}
+	forged.Set("X-Signature", signHMACSHA256("wrong-secret", body))
+	for name, h := range map[string]http.Header{"unsigned": {}, "wrong key": forged} {
+		if _, _, _, err := p.HandleCallback(context.Background(), body, h); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s callback: err %v, want ErrInvalidSignature", name, err)
+		}
+	}
+	tampered := []byte(`{"transaction_id":"tx-2","order_id":"pay-1","status":"approved","amount":"150.50"}`)
+	if _, _, _, err := p.HandleCallback(context.Background(), tampered, header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered callback: err %v, want ErrInvalidSignature", err)
+	}
+}
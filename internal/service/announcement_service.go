@@ -2,31 +2,43 @@ package service
 
 import (
 	"context"
-	"errors"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
 type AnnouncementService struct {
-	repo *repository.AnnouncementRepository
+	repo   *repository.AnnouncementRepository
+	policy *Policy
 }
 
-func NewAnnouncementService(repo *repository.AnnouncementRepository) *AnnouncementService {
-	return &AnnouncementService{repo: repo}
+func NewAnnouncementService(repo *repository.AnnouncementRepository, policy *Policy) *AnnouncementService {
+	return &AnnouncementService{repo: repo, policy: policy}
 }
 
-// Create makes a new announcement (teacher/admin only).
-func (s *AnnouncementService) Create(ctx context.Context, authorID string, role domain.Role, a *domain.Announcement) error {
-	if role != domain.RoleTeacher && role != domain.RoleSchoolAdmin && role != domain.RoleAdmin {
-		return errors.New("only teachers and admins can create announcements")
+// Create makes a new announcement. Course announcements are posted by the course's staff;
+// announcements without a course reach everyone and are for platform admins.
+func (s *AnnouncementService) Create(ctx context.Context, actor Actor, a *domain.Announcement) error {
+	resource := Platform()
+	action := ActionAnnounceGlobally
+	if a.CourseID != nil && *a.CourseID != "" {
+		resource = CourseResource(*a.CourseID)
+		action = ActionTeachCourse
+	} else {
+		a.CourseID = nil
 	}
-	a.AuthorID = authorID
+	if err := s.policy.Can(ctx, actor, action, resource); err != nil {
+		return err
+	}
+	a.AuthorID = actor.UserID
 	return s.repo.Create(ctx, a)
 }
 
 // ListByCourse returns announcements for a specific course.
-func (s *AnnouncementService) ListByCourse(ctx context.Context, courseID string) ([]domain.Announcement, error) {
+func (s *AnnouncementService) ListByCourse(ctx context.Context, actor Actor, courseID string) ([]domain.Announcement, error) {
+	if err := s.policy.Can(ctx, actor, ActionViewCourse, CourseResource(courseID)); err != nil {
+		return nil, err
+	}
 	return s.repo.ListByCourse(ctx, courseID)
 }
 
@@ -2,25 +2,76 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
+var (
+	ErrAssignmentNotFound = errors.New("assignment not found")
+	ErrSubmissionNotFound = errors.New("submission not found")
+)
+
 type AssignmentService struct {
-	repo *repository.AssignmentRepository
+	repo       *repository.AssignmentRepository
+	courseRepo *repository.CourseRepository
+	policy     *Policy
 }
 
-func NewAssignmentService(repo *repository.AssignmentRepository) *AssignmentService {
-	return &AssignmentService{repo: repo}
+func NewAssignmentService(repo *repository.AssignmentRepository, courseRepo *repository.CourseRepository, policy *Policy) *AssignmentService {
+	return &AssignmentService{repo: repo, courseRepo: courseRepo, policy: policy}
 }
 
-func (s *AssignmentService) Create(ctx context.Context, a *domain.Assignment) error {
+// Create sets an assignment for the course, or for one of its sections when a.SectionID is
+// set; the section's teacher may set those.
+func (s *AssignmentService) Create(ctx context.Context, actor Actor, a *domain.Assignment) error {
+	if a.SectionID != nil && *a.SectionID == "" {
+		a.SectionID = nil
+	}
+	resource, err := s.policy.CourseOrSection(ctx, a.CourseID, sectionKey(a.SectionID))
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return err
+	}
+	a.CreatedBy = actor.UserID
 	return s.repo.Create(ctx, a)
 }
 
-func (s *AssignmentService) ListByCourse(ctx context.Context, courseID string) ([]domain.Assignment, error) {
-	return s.repo.ListByCourse(ctx, courseID)
+// ListByCourse returns the course's assignments, or the whole course's and one section's
+// when sectionID is set. Those who do not teach it see only the whole course's and their
+// own section's.
+func (s *AssignmentService) ListByCourse(ctx context.Context, actor Actor, courseID, sectionID string) ([]domain.Assignment, error) {
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionViewCourse, resource); err != nil {
+		return nil, err
+	}
+
+	var only *string
+	if sectionID != "" {
+		only = &sectionID
+	}
+	err = s.policy.Can(ctx, actor, ActionTeachCourse, resource)
+	if errors.Is(err, ErrForbidden) {
+		enrollment, err := s.courseRepo.GetEnrollmentByStudentAndCourse(ctx, actor.UserID, courseID)
+		if err != nil && !errors.Is(err, repository.ErrEnrollmentNotFound) {
+			return nil, err
+		}
+		own := ""
+		if enrollment != nil && enrollment.SectionID != nil {
+			own = *enrollment.SectionID
+		}
+		only = &own
+	} else if err != nil {
+		return nil, err
+	}
+	return s.repo.ListByCourse(ctx, courseID, only)
 }
 
 func (s *AssignmentService) ListForStudent(ctx context.Context, studentID string) ([]domain.Assignment, error) {
@@ -28,19 +79,69 @@ func (s *AssignmentService) ListForStudent(ctx context.Context, studentID string
 }
 
 func (s *AssignmentService) GetByID(ctx context.Context, id string) (*domain.Assignment, error) {
-	return s.repo.GetByID(ctx, id)
+	a, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAssignmentNotFound
+	}
+	return a, err
 }
 
-func (s *AssignmentService) Submit(ctx context.Context, sub *domain.Submission) error {
+// Submit hands in the actor's work. Only students enrolled in the course may submit, and
+// only those in its section for a section's assignment.
+func (s *AssignmentService) Submit(ctx context.Context, actor Actor, sub *domain.Submission) error {
+	a, err := s.GetByID(ctx, sub.AssignmentID)
+	if err != nil {
+		return err
+	}
+	resource, err := s.policy.CourseOrSection(ctx, a.CourseID, sectionKey(a.SectionID))
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionSubmitWork, resource); err != nil {
+		return err
+	}
+	sub.StudentUserID = actor.UserID
 	return s.repo.CreateSubmission(ctx, sub)
 }
 
-func (s *AssignmentService) GradeSubmission(ctx context.Context, submissionID string, score float64, feedback string) error {
+// GradeSubmission scores handed-in work. The teacher of the submission's section may grade it.
+func (s *AssignmentService) GradeSubmission(ctx context.Context, actor Actor, submissionID string, score float64, feedback string) error {
+	courseID, sectionID, err := s.repo.GetSubmissionCourse(ctx, submissionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSubmissionNotFound
+		}
+		return err
+	}
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return err
+	}
 	return s.repo.GradeSubmission(ctx, submissionID, score, feedback)
 }
 
-func (s *AssignmentService) ListSubmissions(ctx context.Context, assignmentID string) ([]domain.Submission, error) {
-	return s.repo.ListSubmissions(ctx, assignmentID)
+// ListSubmissions returns the work handed in for an assignment, or only that of one
+// section's students when sectionID is set. A section's assignment is always listed for
+// its section.
+func (s *AssignmentService) ListSubmissions(ctx context.Context, actor Actor, assignmentID, sectionID string) ([]domain.Submission, error) {
+	a, err := s.GetByID(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.SectionID != nil {
+		sectionID = *a.SectionID
+	}
+	resource, err := s.policy.CourseOrSection(ctx, a.CourseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSubmissions(ctx, assignmentID, sectionID)
 }
 
 func (s *AssignmentService) MySubmissions(ctx context.Context, studentID string) ([]domain.Submission, error) {
@@ -9,11 +9,12 @@ import (
 )
 
 type AttendanceService struct {
-	repo *repository.AttendanceRepository
+	repo   *repository.AttendanceRepository
+	policy *Policy
 }
 
-func NewAttendanceService(repo *repository.AttendanceRepository) *AttendanceService {
-	return &AttendanceService{repo: repo}
+func NewAttendanceService(repo *repository.AttendanceRepository, policy *Policy) *AttendanceService {
+	return &AttendanceService{repo: repo, policy: policy}
 }
 
 type AttendanceRecord struct {
@@ -23,23 +24,51 @@ type AttendanceRecord struct {
 	Note          string `json:"note"`
 }
 
-// MarkAttendance allows a teacher/admin to mark attendance for a course session.
-func (s *AttendanceService) MarkAttendance(ctx context.Context, markedByID string, role domain.Role, courseID string, date string, records []AttendanceRecord) error {
-	if role != domain.RoleTeacher && role != domain.RoleSchoolAdmin {
-		return errors.New("only teachers and admins can mark attendance")
-	}
+// MarkAttendance allows the course's staff to mark attendance for a course session. When
+// sectionID is set the session is that section's, and its teacher may mark it for the
+// section's students.
+func (s *AttendanceService) MarkAttendance(ctx context.Context, actor Actor, courseID, sectionID string, date string, records []AttendanceRecord) error {
 	if courseID == "" || date == "" {
 		return errors.New("course_id and date are required")
 	}
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return err
+	}
+
+	var section *string
+	var roster map[string]string // enrollment ID -> student, for a section's session
+	if sectionID != "" {
+		section = &sectionID
+		students, err := s.repo.GetEnrolledStudentsForCourse(ctx, courseID, sectionID)
+		if err != nil {
+			return err
+		}
+		roster = make(map[string]string, len(students))
+		for _, st := range students {
+			roster[st.EnrollmentID] = st.StudentUserID
+		}
+	}
 	for _, rec := range records {
+		studentID := rec.StudentUserID
+		if roster != nil {
+			var ok bool
+			if studentID, ok = roster[rec.EnrollmentID]; !ok {
+				return repository.ErrEnrollmentNotFound
+			}
+		}
 		a := &domain.Attendance{
 			EnrollmentID:  rec.EnrollmentID,
 			CourseID:      courseID,
-			StudentUserID: rec.StudentUserID,
+			SectionID:     section,
+			StudentUserID: studentID,
 			Date:          date,
 			Status:        rec.Status,
 			Note:          rec.Note,
-			MarkedBy:      markedByID,
+			MarkedBy:      actor.UserID,
 		}
 		if err := s.repo.MarkAttendance(ctx, a); err != nil {
 			return err
@@ -48,9 +77,17 @@ func (s *AttendanceService) MarkAttendance(ctx context.Context, markedByID strin
 	return nil
 }
 
-// GetSessionAttendance returns attendance + roster for a course on a specific date.
-func (s *AttendanceService) GetSessionAttendance(ctx context.Context, courseID, date string) ([]domain.Attendance, error) {
-	return s.repo.GetByCourseAndDate(ctx, courseID, date)
+// GetSessionAttendance returns attendance + roster for a course on a specific date, or for
+// one section's session when sectionID is set.
+func (s *AttendanceService) GetSessionAttendance(ctx context.Context, actor Actor, courseID, sectionID, date string) ([]domain.Attendance, error) {
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByCourseAndDate(ctx, courseID, sectionID, date)
 }
 
 // GetStudentAttendance returns a student's own attendance records.
@@ -63,13 +100,21 @@ func (s *AttendanceService) GetStudentSummary(ctx context.Context, studentUserID
 	return s.repo.GetStudentAttendanceSummary(ctx, studentUserID)
 }
 
-// GetCourseRoster returns enrolled students for a course (for the attendance form).
-func (s *AttendanceService) GetCourseRoster(ctx context.Context, courseID string) ([]struct {
+// GetCourseRoster returns enrolled students for a course, or for one of its sections (for
+// the attendance form).
+func (s *AttendanceService) GetCourseRoster(ctx context.Context, actor Actor, courseID, sectionID string) ([]struct {
 	EnrollmentID  string `json:"enrollment_id"`
 	StudentUserID string `json:"student_user_id"`
 	StudentName   string `json:"student_name"`
 }, error) {
-	raw, err := s.repo.GetEnrolledStudentsForCourse(ctx, courseID)
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return nil, err
+	}
+	raw, err := s.repo.GetEnrolledStudentsForCourse(ctx, courseID, sectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -2,8 +2,16 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/schooltj/internal/domain"
@@ -13,32 +21,124 @@ import (
 
 var ErrInvalidCredentials = errors.New("invalid credentials")
 var ErrEmailAlreadyExists = errors.New("email already exists")
+var ErrPhoneAlreadyExists = errors.New("phone number already exists")
+var ErrEmailOrPhoneRequired = errors.New("email or phone is required")
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+var ErrInvalidTwoFactorToken = errors.New("two-factor login has expired, sign in again")
+var ErrAccountLocked = errors.New("account is temporarily locked after too many failed sign-ins")
+var ErrAccountSuspended = errors.New("account is suspended")
+var ErrCannotImpersonate = errors.New("admins cannot be impersonated")
+
+// AccountLockedError is returned by VerifyTwoFactor while an account is locked; Login
+// answers a locked account as it does a wrong password. It matches ErrAccountLocked with
+// errors.Is.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string { return ErrAccountLocked.Error() }
+func (e *AccountLockedError) Unwrap() error { return ErrAccountLocked }
+
+// LoginLockout locks an account for Duration after Threshold wrong passwords in a row.
+// A zero Threshold turns lockout off.
+type LoginLockout struct {
+	Threshold int
+	Duration  time.Duration
+}
 
 type AuthService struct {
-	repo        *repository.UserRepository
-	schoolRepo  *repository.SchoolRepository
-	studentRepo *repository.StudentRepository
-	jwtSecret   []byte
-	tokenExpiry time.Duration
+	repo          *repository.UserRepository
+	schoolRepo    *repository.SchoolRepository
+	studentRepo   *repository.StudentRepository
+	sessionRepo   *repository.SessionRepository
+	verifications *EmailVerificationService
+	otps          *PhoneOTPService
+	twoFactor     *TwoFactorService
+	audit         *repository.AuditRepository
+	identities    *repository.IdentityRepository
+	providers     map[string]*OIDCProvider // sign-in providers by name
+	lockout       LoginLockout
+	jwtSecret     []byte
+	tokenExpiry   time.Duration
+	refreshExpiry time.Duration
+	loginExpiry   time.Duration // how long a password login waits for the second factor
+	impersonation time.Duration // how long an admin's support session as another user lasts
 }
 
-func NewAuthService(repo *repository.UserRepository, schoolRepo *repository.SchoolRepository, studentRepo *repository.StudentRepository, secret string) *AuthService {
+func NewAuthService(repo *repository.UserRepository, schoolRepo *repository.SchoolRepository, studentRepo *repository.StudentRepository, sessionRepo *repository.SessionRepository, verifications *EmailVerificationService, otps *PhoneOTPService, twoFactor *TwoFactorService, audit *repository.AuditRepository, identities *repository.IdentityRepository, lockout LoginLockout, secret string, providers []*OIDCProvider) *AuthService {
+	byName := make(map[string]*OIDCProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name] = p
+	}
 	return &AuthService{
-		repo:        repo,
-		schoolRepo:  schoolRepo,
-		studentRepo: studentRepo,
-		jwtSecret:   []byte(secret),
-		tokenExpiry: 24 * time.Hour,
+		repo:          repo,
+		schoolRepo:    schoolRepo,
+		studentRepo:   studentRepo,
+		sessionRepo:   sessionRepo,
+		verifications: verifications,
+		otps:          otps,
+		twoFactor:     twoFactor,
+		audit:         audit,
+		identities:    identities,
+		providers:     byName,
+		lockout:       lockout,
+		jwtSecret:     []byte(secret),
+		tokenExpiry:   15 * time.Minute,
+		refreshExpiry: 30 * 24 * time.Hour,
+		loginExpiry:   5 * time.Minute,
+		impersonation: time.Hour,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, email, password string, role domain.Role) (*domain.User, error) {
-	existing, err := s.repo.GetUserByEmail(ctx, email)
-	if err == nil && existing != nil {
-		return nil, ErrEmailAlreadyExists
+// SessionDevice describes where a session is opened or refreshed from.
+type SessionDevice struct {
+	UserAgent string
+	IP        string
+}
+
+// Register creates an account identified by an email address, a phone number, or both.
+// Only the sign-up roles may be picked; platform admins are never self-registered. ip is
+// the client's address, which the phone's verification code is rate limited by.
+func (s *AuthService) Register(ctx context.Context, email, phone, password string, role domain.Role, ip string) (*domain.User, error) {
+	if !signupRoles[role] {
+		return nil, ErrSignupRoleNotAllowed
 	}
-	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
-		return nil, err
+	if email == "" && phone == "" {
+		return nil, ErrEmailOrPhoneRequired
+	}
+	if email != "" {
+		existing, err := s.repo.GetUserByEmail(ctx, email)
+		if err == nil && existing != nil {
+			return nil, ErrEmailAlreadyExists
+		}
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+	}
+	if phone != "" {
+		normalized, err := NormalizePhone(phone)
+		if err != nil {
+			return nil, err
+		}
+		phone = normalized
+		existing, err := s.repo.GetUserByPhone(ctx, phone)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+		if err == nil && existing != nil {
+			// An account that never proved the number holds it only while its code is
+			// live; after that, whoever registers the number next may claim it.
+			if existing.PhoneVerifiedAt != nil {
+				return nil, ErrPhoneAlreadyExists
+			}
+			released, err := s.repo.ReleaseUnverifiedPhone(ctx, phone)
+			if err != nil {
+				return nil, err
+			}
+			if !released {
+				return nil, ErrPhoneAlreadyExists
+			}
+		}
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -52,22 +152,101 @@ func (s *AuthService) Register(ctx context.Context, email, password string, role
 		PasswordHash: string(hashedPassword),
 		Role:         role,
 	}
+	if phone != "" {
+		user.Phone = &phone
+		if user.Name == "" {
+			user.Name = phone
+		}
+	}
+
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.createRoleProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// The account works right away, but enrolling and paying wait for the address to be confirmed.
+	if email != "" {
+		if err := s.verifications.SendVerification(ctx, user); err != nil {
+			log.Printf("[AuthService.Register] failed to send verification to %s: %v", user.Email, err)
+		}
+	}
+	if phone != "" {
+		if err := s.otps.SendCode(ctx, phone, ip); err != nil {
+			log.Printf("[AuthService.Register] failed to send code to %s: %v", phone, err)
+		}
+	}
+
+	return user, nil
+}
+
+// CreateVerifiedAccount creates an account for an email address the caller has already
+// confirmed, such as one that followed an emailed invitation, so no verification is sent.
+func (s *AuthService) CreateVerifiedAccount(ctx context.Context, email, name, password string, role domain.Role) (*domain.User, error) {
+	user, err := s.createVerifiedUser(ctx, email, name, password, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createRoleProfile(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateStaffAccount creates a verified school_admin account for someone added to a
+// school's staff. Unlike a registered school admin it gets no school of its own, and it
+// has no usable password until the user sets one with a password link.
+func (s *AuthService) CreateStaffAccount(ctx context.Context, email, name string) (*domain.User, error) {
+	password, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	return s.createVerifiedUser(ctx, email, name, password, domain.RoleSchoolAdmin)
+}
 
+func (s *AuthService) createVerifiedUser(ctx context.Context, email, name, password string, role domain.Role) (*domain.User, error) {
+	if _, err := s.repo.GetUserByEmail(ctx, email); err == nil {
+		return nil, ErrEmailAlreadyExists
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		name = email
+	}
+	user := &domain.User{
+		Email:        email,
+		Name:         truncate(strings.TrimSpace(name), 255),
+		PasswordHash: string(hashedPassword),
+		Role:         role,
+	}
 	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return nil, err
 	}
+	if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
+// createRoleProfile creates what a new account of its role needs besides the user row.
+func (s *AuthService) createRoleProfile(ctx context.Context, user *domain.User) error {
 	// Auto-create school if role is school_admin
-	if role == domain.RoleSchoolAdmin {
+	if user.Role == domain.RoleSchoolAdmin {
 		school := &domain.School{
 			AdminUserID: user.ID,
 			Name:        "My School", // Generic name, can be updated later
 		}
 		if err := s.schoolRepo.CreateSchool(ctx, school); err != nil {
 			// Ideally rollback user creation here in a transaction
-			return nil, err
+			return err
 		}
-	} else if role == domain.RoleTeacher {
+	} else if user.Role == domain.RoleTeacher {
 		// Auto-create teacher profile for independent teachers or to valid FK
 		profile := &domain.TeacherProfile{
 			UserID:   user.ID,
@@ -76,9 +255,9 @@ func (s *AuthService) Register(ctx context.Context, email, password string, role
 			Subjects: []string{},
 		}
 		if err := s.schoolRepo.CreateTeacherProfile(ctx, profile); err != nil {
-			return nil, err
+			return err
 		}
-	} else if role == domain.RoleStudent {
+	} else if user.Role == domain.RoleStudent {
 		// Auto-create student profile
 		student := &domain.Student{
 			UserID:     user.ID,
@@ -87,42 +266,366 @@ func (s *AuthService) Register(ctx context.Context, email, password string, role
 		}
 
 		if err := s.studentRepo.Create(ctx, student); err != nil {
-			return nil, err
+			return err
 		}
 	}
-
-	return user, nil
+	return nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
-	user, err := s.repo.GetUserByEmail(ctx, email)
+// Login checks a password for the account identified by login, an email address or a
+// phone number. A phone number identifies an account only once the account proved it owns
+// it.
+func (s *AuthService) Login(ctx context.Context, login, password string, device SessionDevice) (*domain.AuthTokens, error) {
+	var user *domain.User
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = s.repo.GetUserByEmail(ctx, login)
+	} else if phone, phoneErr := NormalizePhone(login); phoneErr == nil {
+		user, err = s.repo.GetUserByPhone(ctx, phone)
+		if err == nil && user.PhoneVerifiedAt == nil {
+			user, err = nil, repository.ErrUserNotFound
+		}
+	} else {
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
-			return "", ErrInvalidCredentials
+			// Take as long as a wrong password would, so the answer does not tell whether
+			// the account exists.
+			bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+			return nil, ErrInvalidCredentials
 		}
-		return "", err
+		return nil, err
 	}
 
+	// While the account is locked its password is not checked at all, and every attempt
+	// gets the answer a wrong password gets: guessing on cannot tell a right password from
+	// a wrong one, and to anyone without it a locked account looks like any other.
+	lockedUntil, err := s.repo.GetLockedUntil(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil != nil {
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", ErrInvalidCredentials
+		s.recordLoginFailure(ctx, user, device)
+		return nil, ErrInvalidCredentials
+	}
+	return s.completeLogin(ctx, user, device)
+}
+
+// unknownUserHash is compared against when a login names no account or a locked one, so
+// that it costs the same as a wrong password.
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("no account has this password"), bcrypt.DefaultCost)
+
+// recordLoginFailure counts a wrong password or second-factor code towards the lockout. It
+// returns an AccountLockedError if this attempt locked the account, which is audited, and
+// ErrInvalidCredentials otherwise.
+func (s *AuthService) recordLoginFailure(ctx context.Context, user *domain.User, device SessionDevice) error {
+	if s.lockout.Threshold <= 0 {
+		return ErrInvalidCredentials
+	}
+	until := time.Now().Add(s.lockout.Duration)
+	locked, err := s.repo.RecordLoginFailure(ctx, user.ID, s.lockout.Threshold, until)
+	if err != nil {
+		log.Printf("[AuthService.Login] failed to record login failure for %s: %v", user.ID, err)
+		return ErrInvalidCredentials
+	}
+	if !locked {
+		return ErrInvalidCredentials
+	}
+
+	entry := &domain.AuditEntry{
+		Action:     domain.AuditAccountLocked,
+		TargetType: "user",
+		TargetID:   user.ID,
+		IPAddress:  device.IP,
+		Details:    fmt.Sprintf("locked until %s after %d failed sign-ins", until.Format(time.RFC3339), s.lockout.Threshold),
+	}
+	if err := s.audit.Create(ctx, entry); err != nil {
+		log.Printf("[AuthService.Login] failed to audit lockout of %s: %v", user.ID, err)
+	}
+	return &AccountLockedError{Until: until}
+}
+
+// LoginWithCode signs in with a one-time code texted to the phone. Entering the code also
+// verifies the phone number.
+func (s *AuthService) LoginWithCode(ctx context.Context, phone, code string, device SessionDevice) (*domain.AuthTokens, error) {
+	user, err := s.otps.VerifyCode(ctx, phone, code)
+	if err != nil {
+		if errors.Is(err, ErrPhoneNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	return s.completeLogin(ctx, user, device)
+}
+
+// completeLogin starts a session for a user who proved their first factor, or, when the
+// account has two-factor authentication on, hands back a short-lived token to present
+// with the second factor to VerifyTwoFactor. Failed sign-ins stop counting only once a
+// session starts, so that wrong second-factor codes add up across password logins.
+func (s *AuthService) completeLogin(ctx context.Context, user *domain.User, device SessionDevice) (*domain.AuthTokens, error) {
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	enabled, err := s.twoFactor.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		if err := s.repo.ResetLoginFailures(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		return s.startSession(ctx, user, device)
+	}
+
+	expiresAt := time.Now().Add(s.loginExpiry)
+	challengeID, err := s.twoFactor.StartChallenge(ctx, user.ID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"jti": challengeID,
+		"typ": "2fa",
+		"exp": expiresAt.Unix(),
+	})
+	tokenString, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AuthTokens{TwoFactorRequired: true, TwoFactorToken: tokenString}, nil
+}
+
+// VerifyTwoFactor finishes a login started with a password or SMS code by checking a
+// code from the authenticator app or a recovery code. A challenge token allows only a few
+// attempts and is spent by the first that succeeds; wrong codes count towards the
+// account lockout like wrong passwords.
+func (s *AuthService) VerifyTwoFactor(ctx context.Context, twoFactorToken, code string, device SessionDevice) (*domain.AuthTokens, error) {
+	claims, err := s.parseToken(twoFactorToken)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorToken
+	}
+	userID, _ := claims["sub"].(string)
+	challengeID, _ := claims["jti"].(string)
+	if typ, _ := claims["typ"].(string); typ != "2fa" || userID == "" || challengeID == "" {
+		return nil, ErrInvalidTwoFactorToken
+	}
+	if ok, err := s.twoFactor.UseChallengeAttempt(ctx, challengeID, userID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrInvalidTwoFactorToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	lockedUntil, err := s.repo.GetLockedUntil(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil != nil {
+		return nil, &AccountLockedError{Until: *lockedUntil}
+	}
+	if err := s.twoFactor.VerifyCode(ctx, user.ID, code); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			return nil, err
+		}
+		if lockErr := s.recordLoginFailure(ctx, user, device); errors.Is(lockErr, ErrAccountLocked) {
+			return nil, lockErr
+		}
+		return nil, err
+	}
+	if err := s.twoFactor.EndChallenge(ctx, challengeID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ResetLoginFailures(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, device)
+}
+
+// startSession opens a session for the user on a device and issues its first token pair.
+func (s *AuthService) startSession(ctx context.Context, user *domain.User, device SessionDevice) (*domain.AuthTokens, error) {
+	refreshToken, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	session := &domain.Session{
+		UserID:    user.ID,
+		UserAgent: truncate(device.UserAgent, 255),
+		IPAddress: device.IP,
+		ExpiresAt: time.Now().Add(s.refreshExpiry),
+	}
+	if err := s.sessionRepo.Create(ctx, session, hashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, session.ID, refreshToken)
+}
+
+// Refresh trades a refresh token for a new token pair. The refresh token is single-use.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, device SessionDevice) (*domain.AuthTokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	next, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sessionRepo.Rotate(ctx, hashToken(refreshToken), hashToken(next), truncate(device.UserAgent, 255), device.IP, time.Now().Add(s.refreshExpiry))
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) || errors.Is(err, repository.ErrSessionRevoked) || errors.Is(err, repository.ErrRefreshTokenReused) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRefreshToken, err)
+		}
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	return s.issueTokens(ctx, user, session.ID, next)
+}
+
+// Impersonate opens a support session in which the admin acts as the user. The session
+// cannot be refreshed and ends after an hour; it is audited, shows up in the user's
+// session list, and every change made through it is audited as well.
+func (s *AuthService) Impersonate(ctx context.Context, admin Actor, userID, reason string, device SessionDevice) (*domain.AuthTokens, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == domain.RoleAdmin {
+		return nil, ErrCannotImpersonate
+	}
+
+	// The refresh token is never handed out, so the session dies with its access token.
+	unused, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.impersonation)
+	session := &domain.Session{
+		UserID:             user.ID,
+		UserAgent:          truncate(device.UserAgent, 255),
+		IPAddress:          device.IP,
+		ExpiresAt:          expiresAt,
+		ImpersonatorUserID: &admin.UserID,
+	}
+	if err := s.sessionRepo.Create(ctx, session, hashToken(unused)); err != nil {
+		return nil, err
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub":   user.ID,
 		"email": user.Email,
 		"role":  user.Role,
-		"exp":   time.Now().Add(s.tokenExpiry).Unix(),
+		"sid":   session.ID,
+		"imp":   admin.UserID,
+		"exp":   expiresAt.Unix(),
 	})
+	tokenString, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &domain.AuditEntry{
+		ActorUserID: &admin.UserID,
+		Action:      domain.AuditImpersonationStarted,
+		TargetType:  "user",
+		TargetID:    user.ID,
+		IPAddress:   device.IP,
+		Details:     fmt.Sprintf("session %s: %s", session.ID, reason),
+	}
+	if err := s.audit.Create(ctx, entry); err != nil {
+		// No support session without its audit record.
+		s.sessionRepo.Revoke(ctx, session.ID, user.ID)
+		return nil, err
+	}
+	return &domain.AuthTokens{Token: tokenString, ExpiresIn: int(s.impersonation.Seconds())}, nil
+}
+
+// AuditImpersonatedRequest records a change an admin made while impersonating the user.
+func (s *AuthService) AuditImpersonatedRequest(ctx context.Context, adminID, userID, method, path, ip string) {
+	entry := &domain.AuditEntry{
+		ActorUserID: &adminID,
+		Action:      domain.AuditImpersonatedRequest,
+		TargetType:  "user",
+		TargetID:    userID,
+		IPAddress:   ip,
+		Details:     method + " " + path,
+	}
+	if err := s.audit.Create(ctx, entry); err != nil {
+		log.Printf("[AuthService.AuditImpersonatedRequest] failed to audit %s %s by %s: %v", method, path, adminID, err)
+	}
+}
+
+// issueTokens signs an access token for a session. Teachers whose school requires
+// two-factor authentication they have not set up get a token marked tfa_setup, which
+// AuthMiddleware only accepts for setting it up.
+func (s *AuthService) issueTokens(ctx context.Context, user *domain.User, sessionID, refreshToken string) (*domain.AuthTokens, error) {
+	needsSetup, err := s.twoFactor.NeedsSetup(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{
+		"sub":   user.ID,
+		"email": user.Email,
+		"role":  user.Role,
+		"sid":   sessionID,
+		"exp":   time.Now().Add(s.tokenExpiry).Unix(),
+	}
+	if needsSetup {
+		claims["tfa_setup"] = true
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString(s.jwtSecret)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &domain.AuthTokens{
+		Token:                  tokenString,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(s.tokenExpiry.Seconds()),
+		TwoFactorSetupRequired: needsSetup,
+	}, nil
+}
+
+// VerifyToken validates an access token and checks that its session has not been revoked.
+func (s *AuthService) VerifyToken(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil, errors.New("token has no session")
+	}
+	active, err := s.sessionRepo.IsActive(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, repository.ErrSessionRevoked
+	}
+	return claims, nil
 }
 
-func (s *AuthService) VerifyToken(tokenString string) (jwt.MapClaims, error) {
+// parseToken checks a token's signature and expiry and returns its claims.
+func (s *AuthService) parseToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -134,11 +637,63 @@ func (s *AuthService) VerifyToken(tokenString string) (jwt.MapClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// Logout ends the session the request was made with.
+func (s *AuthService) Logout(ctx context.Context, userID, sessionID string) error {
+	return s.sessionRepo.Revoke(ctx, sessionID, userID)
+}
+
+// LogoutAll ends every session of the user, signing them out on all devices.
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
+	return s.sessionRepo.RevokeAll(ctx, userID, "")
+}
+
+// ListSessions returns the user's active sessions, flagging the one currentID belongs to.
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentID string) ([]domain.Session, error) {
+	sessions, err := s.sessionRepo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	return s.sessionRepo.Revoke(ctx, sessionID, userID)
+}
+
+// newSecureToken returns a random URL-safe token for refresh tokens and emailed links.
+func newSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return nil, errors.New("invalid token")
+// hashToken is how refresh tokens are stored, so a database leak does not leak sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
 }
 
 func (s *AuthService) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
@@ -151,6 +706,7 @@ func (s *AuthService) UpdateUser(ctx context.Context, userID, name, email string
 		return nil, err
 	}
 
+	emailChanged := user.Email != email
 	user.Name = name
 	user.Email = email
 
@@ -158,6 +714,13 @@ func (s *AuthService) UpdateUser(ctx context.Context, userID, name, email string
 		return nil, err
 	}
 
+	if emailChanged && email != "" {
+		user.EmailVerifiedAt = nil
+		if err := s.verifications.SendVerification(ctx, user); err != nil {
+			log.Printf("[AuthService.UpdateUser] failed to send verification to %s: %v", user.Email, err)
+		}
+	}
+
 	return user, nil
 }
 
@@ -169,7 +732,8 @@ func (s *AuthService) DeleteAvatar(ctx context.Context, userID string) error {
 	return s.repo.UpdateAvatarURL(ctx, userID, nil)
 }
 
-func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+// ChangePassword sets a new password and signs the user out everywhere except keepSessionID.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, keepSessionID, currentPassword, newPassword string) error {
 	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return errors.New("user not found")
@@ -184,7 +748,10 @@ func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPasswor
 		return err
 	}
 
-	return s.repo.UpdatePassword(ctx, userID, string(hashedPassword))
+	if err := s.repo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeAll(ctx, userID, keepSessionID)
 }
 
 func (s *AuthService) SearchUsers(ctx context.Context, q string) ([]domain.User, error) {
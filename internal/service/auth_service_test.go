@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"ascii text", 5, "ascii"},
+		{"Салом", 4, "Са"},
+		{"Салом", 5, "Са"},
+		{"ҷ", 1, ""},
+		{"a😀b", 4, "a"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) || len(got) > tt.n {
+			t.Errorf("truncate(%q, %d) = %q is not valid UTF-8 within %d bytes", tt.s, tt.n, got, tt.n)
+		}
+	}
+}
+
+// newTestLogin returns an AuthService with the lockout, and user u1, whose password is
+// "right password".
+func newTestLogin(t *testing.T, lockout LoginLockout) (*AuthService, sqlmock.Sqlmock, domain.User) {
+	db, mock := newMockDB(t)
+	users := repository.NewUserRepository(db)
+	twoFactor := NewTwoFactorService(repository.NewTwoFactorRepository(db), users, nil)
+	s := NewAuthService(users, nil, nil, repository.NewSessionRepository(db), nil, nil, twoFactor,
+		repository.NewAuditRepository(db), nil, lockout, "test-secret", nil)
+	hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, mock, domain.User{ID: "u1", Email: "u1@example.com", PasswordHash: string(hash), Role: domain.RoleStudent}
+}
+
+// expectLockedUntil answers the lockout lookup; nil for an account that is not locked,
+// or whose lock ran out.
+func expectLockedUntil(mock sqlmock.Sqlmock, until *time.Time) {
+	rows := sqlmock.NewRows([]string{"locked_until"})
+	if until != nil {
+		rows.AddRow(*until)
+	}
+	mock.ExpectQuery(`SELECT locked_until FROM users WHERE id = \? AND locked_until > NOW\(\)`).WithArgs("u1").WillReturnRows(rows)
+}
+
+// expectFailure answers the counting of a wrong password that finds failures before it.
+func expectFailure(mock sqlmock.Sqlmock, failures, threshold int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT failed_login_count FROM users WHERE id = \? FOR UPDATE`).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"failed_login_count"}).AddRow(failures))
+	if failures+1 < threshold {
+		mock.ExpectExec(`UPDATE users SET failed_login_count = \? WHERE id = \?`).WithArgs(failures+1, "u1").WillReturnResult(sqlmock.NewResult(0, 1))
+	} else {
+		mock.ExpectExec(`UPDATE users SET failed_login_count = 0, locked_until = \? WHERE id = \?`).WithArgs(sqlmock.AnyArg(), "u1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestLoginLocksAfterRepeatedWrongPasswords(t *testing.T) {
+	s, mock, user := newTestLogin(t, LoginLockout{Threshold: 3, Duration: 15 * time.Minute})
+	ctx := context.Background()
+
+	for failures := 0; failures < 3; failures++ {
+		expectUserBy(mock, "email", user.Email, user)
+		expectLockedUntil(mock, nil)
+		expectFailure(mock, failures, 3)
+		if failures == 2 {
+			mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		// The attempt that locks the account answers like the ones before it.
+		if _, err := s.Login(ctx, user.Email, "wrong password", SessionDevice{IP: "203.0.113.7"}); err != ErrInvalidCredentials {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidCredentials", failures+1, err)
+		}
+	}
+
+	// Once the lock runs out the lookup finds none, and the right password signs in.
+	expectUserBy(mock, "email", user.Email, user)
+	expectLockedUntil(mock, nil)
+	mock.ExpectQuery(`SELECT totp_secret`).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "enabled", "totp_last_step"}).AddRow(nil, false, 0))
+	mock.ExpectExec(`UPDATE users SET failed_login_count = 0, locked_until = NULL`).WithArgs("u1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(0, 1))
+	tokens, err := s.Login(ctx, user.Email, "right password", SessionDevice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Token == "" {
+		t.Fatalf("tokens = %+v, want a session", tokens)
+	}
+}
+
+func TestLoginAnswersALockedAccountTheSameWhateverThePassword(t *testing.T) {
+	until := time.Now().Add(10 * time.Minute)
+	for _, password := range []string{"right password", "wrong password"} {
+		t.Run(password, func(t *testing.T) {
+			s, mock, user := newTestLogin(t, LoginLockout{Threshold: 3, Duration: 15 * time.Minute})
+			expectUserBy(mock, "email", user.Email, user)
+			expectLockedUntil(mock, &until)
+			// Nothing more: the attempt is neither checked nor counted.
+			if _, err := s.Login(context.Background(), user.Email, password, SessionDevice{}); err != ErrInvalidCredentials {
+				t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestLoginWithoutLockout(t *testing.T) {
+	// A zero threshold turns lockout off, so wrong passwords are not even counted.
+	s, mock, user := newTestLogin(t, LoginLockout{})
+	expectUserBy(mock, "email", user.Email, user)
+	expectLockedUntil(mock, nil)
+	if _, err := s.Login(context.Background(), user.Email, "wrong password", SessionDevice{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
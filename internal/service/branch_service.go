@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrBranchNameRequired      = errors.New("branch name is required")
+	ErrRoomNameRequired        = errors.New("room name is required")
+	ErrInvalidRoomCapacity     = errors.New("room capacity must be positive")
+	ErrIndependentCourseBranch = errors.New("only a school's courses can be at a branch")
+)
+
+type BranchService struct {
+	branches   *repository.BranchRepository
+	schoolRepo *repository.SchoolRepository
+	courseRepo *repository.CourseRepository
+	policy     *Policy
+}
+
+func NewBranchService(branches *repository.BranchRepository, schoolRepo *repository.SchoolRepository, courseRepo *repository.CourseRepository, policy *Policy) *BranchService {
+	return &BranchService{branches: branches, schoolRepo: schoolRepo, courseRepo: courseRepo, policy: policy}
+}
+
+// BranchInput is the editable part of a branch.
+type BranchInput struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	City    string `json:"city"`
+	Phone   string `json:"phone"`
+}
+
+func (in BranchInput) apply(b *domain.SchoolBranch) error {
+	b.Name = strings.TrimSpace(in.Name)
+	if b.Name == "" {
+		return ErrBranchNameRequired
+	}
+	b.Address = strings.TrimSpace(in.Address)
+	b.City = strings.TrimSpace(in.City)
+	b.Phone = strings.TrimSpace(in.Phone)
+	return nil
+}
+
+// ListBranches returns the school's branches. Where a school teaches is public, like the
+// rest of its profile.
+func (s *BranchService) ListBranches(ctx context.Context, schoolID string) ([]domain.SchoolBranch, error) {
+	if _, err := s.schoolRepo.GetSchoolByID(ctx, schoolID); err != nil {
+		return nil, err
+	}
+	return s.branches.ListBySchool(ctx, schoolID)
+}
+
+func (s *BranchService) CreateBranch(ctx context.Context, actor Actor, schoolID string, in BranchInput) (*domain.SchoolBranch, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageSchool, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	branch := &domain.SchoolBranch{SchoolID: schoolID}
+	if err := in.apply(branch); err != nil {
+		return nil, err
+	}
+	if err := s.branches.Create(ctx, branch); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// managedBranch loads a branch whose school the actor may edit.
+func (s *BranchService) managedBranch(ctx context.Context, actor Actor, branchID string) (*domain.SchoolBranch, error) {
+	branch, err := s.branches.GetByID(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionManageSchool, SchoolResource(branch.SchoolID)); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+func (s *BranchService) UpdateBranch(ctx context.Context, actor Actor, branchID string, in BranchInput) (*domain.SchoolBranch, error) {
+	branch, err := s.managedBranch(ctx, actor, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.apply(branch); err != nil {
+		return nil, err
+	}
+	if err := s.branches.Update(ctx, branch); err != nil {
+		return nil, err
+	}
+	return s.branches.GetByID(ctx, branchID)
+}
+
+// DeleteBranch removes a branch. Its courses and teachers stay with the school, and its
+// managers leave the school's staff.
+func (s *BranchService) DeleteBranch(ctx context.Context, actor Actor, branchID string) error {
+	branch, err := s.managedBranch(ctx, actor, branchID)
+	if err != nil {
+		return err
+	}
+	return s.branches.Delete(ctx, branch.ID)
+}
+
+// ListRooms returns the branch's rooms.
+func (s *BranchService) ListRooms(ctx context.Context, actor Actor, branchID string) ([]domain.BranchRoom, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageRooms, BranchResource(branchID)); err != nil {
+		return nil, err
+	}
+	return s.branches.ListRooms(ctx, branchID)
+}
+
+func (s *BranchService) CreateRoom(ctx context.Context, actor Actor, branchID, name string, capacity *int) (*domain.BranchRoom, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageRooms, BranchResource(branchID)); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrRoomNameRequired
+	}
+	if capacity != nil && *capacity <= 0 {
+		return nil, ErrInvalidRoomCapacity
+	}
+	room := &domain.BranchRoom{BranchID: branchID, Name: name, Capacity: capacity}
+	if err := s.branches.CreateRoom(ctx, room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *BranchService) DeleteRoom(ctx context.Context, actor Actor, roomID string) error {
+	room, err := s.branches.GetRoom(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionManageRooms, BranchResource(room.BranchID)); err != nil {
+		return err
+	}
+	return s.branches.DeleteRoom(ctx, room.ID)
+}
+
+// schoolBranch resolves an optional branch ID to one of the school's branches; nil or
+// empty means no branch.
+func (s *BranchService) schoolBranch(ctx context.Context, schoolID string, branchID *string) (*string, error) {
+	if branchID == nil || *branchID == "" {
+		return nil, nil
+	}
+	branch, err := s.branches.GetByID(ctx, *branchID)
+	if err != nil {
+		return nil, err
+	}
+	if branch.SchoolID != schoolID {
+		return nil, repository.ErrBranchNotFound
+	}
+	return &branch.ID, nil
+}
+
+// SetTeacherBranch assigns one of the school's teachers to a branch, or to none.
+func (s *BranchService) SetTeacherBranch(ctx context.Context, actor Actor, schoolID, teacherID string, branchID *string) error {
+	if err := s.policy.Can(ctx, actor, ActionManageTeachers, SchoolResource(schoolID)); err != nil {
+		return err
+	}
+	branchID, err := s.schoolBranch(ctx, schoolID, branchID)
+	if err != nil {
+		return err
+	}
+	return s.schoolRepo.SetTeacherBranch(ctx, schoolID, teacherID, branchID)
+}
+
+// SetCourseBranch moves a school's course to one of its branches, or to none. Moving
+// courses between branches is for staff of the whole school.
+func (s *BranchService) SetCourseBranch(ctx context.Context, actor Actor, courseID string, branchID *string) (*domain.Course, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
+		return nil, err
+	}
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	if course.SchoolID == nil {
+		return nil, ErrIndependentCourseBranch
+	}
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, SchoolResource(*course.SchoolID)); err != nil {
+		return nil, err
+	}
+	branchID, err = s.schoolBranch(ctx, *course.SchoolID, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.courseRepo.SetCourseBranch(ctx, courseID, branchID); err != nil {
+		return nil, err
+	}
+	return s.courseRepo.GetCourseByID(ctx, courseID)
+}
@@ -17,67 +17,34 @@ import (
 
 type CourseContentService struct {
 	contentRepo *repository.CourseContentRepository
-	courseRepo  *repository.CourseRepository
 	studentRepo *repository.StudentRepository
+	policy      *Policy
 }
 
-func NewCourseContentService(contentRepo *repository.CourseContentRepository, courseRepo *repository.CourseRepository, studentRepo *repository.StudentRepository) *CourseContentService {
-	return &CourseContentService{contentRepo: contentRepo, courseRepo: courseRepo, studentRepo: studentRepo}
+func NewCourseContentService(contentRepo *repository.CourseContentRepository, studentRepo *repository.StudentRepository, policy *Policy) *CourseContentService {
+	return &CourseContentService{contentRepo: contentRepo, studentRepo: studentRepo, policy: policy}
 }
 
 const uploadsDir = "uploads/courses"
 
-// ── Authorization helpers ──
-
-func (s *CourseContentService) isTeacherOfCourse(ctx context.Context, userID, courseID string) error {
-	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
-	if err != nil {
-		return errors.New("course not found")
-	}
-	if course.TeacherID == nil || *course.TeacherID != userID {
-		return errors.New("only the course teacher can perform this action")
-	}
-	return nil
-}
-
-func (s *CourseContentService) canReadCourseContent(ctx context.Context, userID string, role domain.Role, courseID string) error {
-	// Teachers of the course can always read
-	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
-	if err != nil {
-		return errors.New("course not found")
-	}
-	if course.TeacherID != nil && *course.TeacherID == userID {
-		return nil
-	}
-	// School admins of the course's school can read
-	if role == domain.RoleSchoolAdmin && course.SchoolID != nil {
-		return nil
-	}
-	// Admin can read all
-	if role == domain.RoleAdmin {
-		return nil
-	}
-	// Students must be enrolled with active status
-	if role == domain.RoleStudent {
-		enrollment, err := s.courseRepo.GetEnrollmentByStudentAndCourse(ctx, userID, courseID)
-		if err != nil || enrollment == nil || (enrollment.Status != domain.EnrollmentStatusActive && enrollment.Status != domain.EnrollmentStatusCompleted) {
-			return errors.New("you must be enrolled in this course to view its content")
-		}
-		return nil
-	}
-	return errors.New("access denied")
-}
-
 // ── Curriculum Topics ──
 
-func (s *CourseContentService) AddTopic(ctx context.Context, userID string, topic *domain.CurriculumTopic) error {
-	if err := s.isTeacherOfCourse(ctx, userID, topic.CourseID); err != nil {
+func (s *CourseContentService) AddTopic(ctx context.Context, actor Actor, topic *domain.CurriculumTopic) error {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(topic.CourseID)); err != nil {
 		return err
 	}
 	return s.contentRepo.CreateTopic(ctx, topic)
 }
 
-func (s *CourseContentService) ListTopics(ctx context.Context, userID string, role domain.Role, courseID string) ([]domain.CurriculumTopic, error) {
+// ListTopics returns the course's curriculum. The course's staff see every topic; everyone
+// else sees the visible ones, with their own completion status.
+func (s *CourseContentService) ListTopics(ctx context.Context, actor Actor, courseID string) ([]domain.CurriculumTopic, error) {
+	err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID))
+	if err != nil && !errors.Is(err, ErrForbidden) {
+		return nil, err
+	}
+	staff := err == nil
+
 	topics, err := s.contentRepo.ListTopics(ctx, courseID)
 	if err != nil {
 		return nil, err
@@ -86,51 +53,48 @@ func (s *CourseContentService) ListTopics(ctx context.Context, userID string, ro
 	if topics == nil {
 		topics = []domain.CurriculumTopic{}
 	}
+	if staff {
+		return topics, nil
+	}
 
-	// For students or public, only show visible topics and include completion status if logged in
-	if role == domain.RoleStudent || role == "" {
-		visible := make([]domain.CurriculumTopic, 0, len(topics))
-		completedMap := make(map[string]bool)
+	visible := make([]domain.CurriculumTopic, 0, len(topics))
+	completedMap := make(map[string]bool)
 
-		if userID != "" {
-			completedTopics, _ := s.studentRepo.GetCompletedTopics(ctx, userID, courseID)
-			for _, id := range completedTopics {
-				completedMap[id] = true
-			}
+	if actor.Role == domain.RoleStudent {
+		completedTopics, _ := s.studentRepo.GetCompletedTopics(ctx, actor.UserID, courseID)
+		for _, id := range completedTopics {
+			completedMap[id] = true
 		}
+	}
 
-		for _, t := range topics {
-			if t.Visible {
-				t.IsCompleted = completedMap[t.ID]
-				visible = append(visible, t)
-			}
+	for _, t := range topics {
+		if t.Visible {
+			t.IsCompleted = completedMap[t.ID]
+			visible = append(visible, t)
 		}
-		return visible, nil
 	}
-
-	// Teachers/Admins see everything
-	return topics, nil
+	return visible, nil
 }
 
-func (s *CourseContentService) UpdateTopic(ctx context.Context, userID string, topic *domain.CurriculumTopic) error {
+func (s *CourseContentService) UpdateTopic(ctx context.Context, actor Actor, topic *domain.CurriculumTopic) error {
 	// Look up course ID from the topic
 	courseID, err := s.contentRepo.GetTopicCourseID(ctx, topic.ID)
 	if err != nil {
 		return errors.New("topic not found")
 	}
-	if err := s.isTeacherOfCourse(ctx, userID, courseID); err != nil {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
 		return err
 	}
 	topic.CourseID = courseID
 	return s.contentRepo.UpdateTopic(ctx, topic)
 }
 
-func (s *CourseContentService) DeleteTopic(ctx context.Context, userID, topicID string) error {
+func (s *CourseContentService) DeleteTopic(ctx context.Context, actor Actor, topicID string) error {
 	courseID, err := s.contentRepo.GetTopicCourseID(ctx, topicID)
 	if err != nil {
 		return errors.New("topic not found")
 	}
-	if err := s.isTeacherOfCourse(ctx, userID, courseID); err != nil {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
 		return err
 	}
 	return s.contentRepo.DeleteTopic(ctx, topicID)
@@ -138,8 +102,8 @@ func (s *CourseContentService) DeleteTopic(ctx context.Context, userID, topicID
 
 // ── Course Materials ──
 
-func (s *CourseContentService) UploadMaterial(ctx context.Context, userID, courseID string, topicID *string, header *multipart.FileHeader, file multipart.File) (*domain.CourseMaterial, error) {
-	if err := s.isTeacherOfCourse(ctx, userID, courseID); err != nil {
+func (s *CourseContentService) UploadMaterial(ctx context.Context, actor Actor, courseID string, topicID *string, header *multipart.FileHeader, file multipart.File) (*domain.CourseMaterial, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
 		return nil, err
 	}
 
@@ -189,7 +153,7 @@ func (s *CourseContentService) UploadMaterial(ctx context.Context, userID, cours
 		FilePath:    destPath,
 		FileSize:    header.Size,
 		ContentType: ct,
-		UploadedBy:  userID,
+		UploadedBy:  actor.UserID,
 	}
 
 	if err := s.contentRepo.CreateMaterial(ctx, material); err != nil {
@@ -200,13 +164,13 @@ func (s *CourseContentService) UploadMaterial(ctx context.Context, userID, cours
 	return material, nil
 }
 
-func (s *CourseContentService) ListTopicMaterials(ctx context.Context, userID string, role domain.Role, topicID string) ([]domain.CourseMaterial, error) {
+func (s *CourseContentService) ListTopicMaterials(ctx context.Context, actor Actor, topicID string) ([]domain.CourseMaterial, error) {
 	// Look up the course for this topic
 	courseID, err := s.contentRepo.GetTopicCourseID(ctx, topicID)
 	if err != nil {
 		return nil, errors.New("topic not found")
 	}
-	if err := s.canReadCourseContent(ctx, userID, role, courseID); err != nil {
+	if err := s.policy.Can(ctx, actor, ActionViewCourse, CourseResource(courseID)); err != nil {
 		return nil, err
 	}
 	materials, err := s.contentRepo.ListMaterialsByTopic(ctx, topicID)
@@ -219,8 +183,8 @@ func (s *CourseContentService) ListTopicMaterials(ctx context.Context, userID st
 	return materials, nil
 }
 
-func (s *CourseContentService) ListMaterials(ctx context.Context, userID string, role domain.Role, courseID string) ([]domain.CourseMaterial, error) {
-	if err := s.canReadCourseContent(ctx, userID, role, courseID); err != nil {
+func (s *CourseContentService) ListMaterials(ctx context.Context, actor Actor, courseID string) ([]domain.CourseMaterial, error) {
+	if err := s.policy.Can(ctx, actor, ActionViewCourse, CourseResource(courseID)); err != nil {
 		return nil, err
 	}
 	materials, err := s.contentRepo.ListMaterials(ctx, courseID)
@@ -233,23 +197,23 @@ func (s *CourseContentService) ListMaterials(ctx context.Context, userID string,
 	return materials, nil
 }
 
-func (s *CourseContentService) GetMaterial(ctx context.Context, userID string, role domain.Role, materialID string) (*domain.CourseMaterial, error) {
+func (s *CourseContentService) GetMaterial(ctx context.Context, actor Actor, materialID string) (*domain.CourseMaterial, error) {
 	m, err := s.contentRepo.GetMaterial(ctx, materialID)
 	if err != nil {
 		return nil, errors.New("material not found")
 	}
-	if err := s.canReadCourseContent(ctx, userID, role, m.CourseID); err != nil {
+	if err := s.policy.Can(ctx, actor, ActionViewCourse, CourseResource(m.CourseID)); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-func (s *CourseContentService) DeleteMaterial(ctx context.Context, userID, materialID string) error {
+func (s *CourseContentService) DeleteMaterial(ctx context.Context, actor Actor, materialID string) error {
 	m, err := s.contentRepo.GetMaterial(ctx, materialID)
 	if err != nil {
 		return errors.New("material not found")
 	}
-	if err := s.isTeacherOfCourse(ctx, userID, m.CourseID); err != nil {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(m.CourseID)); err != nil {
 		return err
 	}
 
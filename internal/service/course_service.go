@@ -4,28 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
+var (
+	ErrInvalidMaxStudents   = errors.New("max_students must be positive")
+	ErrWaitlistOfferExpired = errors.New("the seat offer has expired")
+)
+
+// waitlistOfferWindow is how long a seat offered to a waitlisted student is held for them.
+const waitlistOfferWindow = 48 * time.Hour
+
 type CourseService struct {
 	courseRepo       *repository.CourseRepository
 	schoolRepo       *repository.SchoolRepository
+	branchRepo       *repository.BranchRepository
+	sections         *repository.SectionRepository
 	userRepo         *repository.UserRepository
 	studentRepo      *repository.StudentRepository
 	notificationRepo *repository.NotificationRepository
 	announcementRepo *repository.AnnouncementRepository
+	invoiceService   *InvoiceService
+	policy           *Policy
 }
 
-func NewCourseService(courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository, userRepo *repository.UserRepository, studentRepo *repository.StudentRepository, notificationRepo *repository.NotificationRepository, announcementRepo *repository.AnnouncementRepository) *CourseService {
+func NewCourseService(courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository, branchRepo *repository.BranchRepository, sections *repository.SectionRepository, userRepo *repository.UserRepository, studentRepo *repository.StudentRepository, notificationRepo *repository.NotificationRepository, announcementRepo *repository.AnnouncementRepository, invoiceService *InvoiceService, policy *Policy) *CourseService {
 	return &CourseService{
 		courseRepo:       courseRepo,
 		schoolRepo:       schoolRepo,
+		branchRepo:       branchRepo,
+		sections:         sections,
 		userRepo:         userRepo,
 		studentRepo:      studentRepo,
 		notificationRepo: notificationRepo,
 		announcementRepo: announcementRepo,
+		invoiceService:   invoiceService,
+		policy:           policy,
 	}
 }
 
@@ -36,21 +55,40 @@ func (s *CourseService) CreateCourse(
 	title, description string,
 	schedule *domain.Schedule,
 	price float64,
+	currency string,
+	billingCycle string,
 	language string,
 	categoryID *string,
 	difficulty string,
 	tags []string,
 	teacherID *string,
+	branchID *string,
+	maxStudents *int,
 ) (*domain.Course, error) {
+	billingCycle, err := normalizeBillingCycle(billingCycle)
+	if err != nil {
+		return nil, err
+	}
+	currency, err = normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if maxStudents != nil && *maxStudents <= 0 {
+		return nil, ErrInvalidMaxStudents
+	}
+
 	course := &domain.Course{
-		Title:       title,
-		Description: description,
-		Schedule:    schedule,
-		Price:       price,
-		Language:    language,
-		CategoryID:  categoryID,
-		Difficulty:  difficulty,
-		Tags:        tags,
+		Title:        title,
+		Description:  description,
+		Schedule:     schedule,
+		Price:        price,
+		Currency:     currency,
+		BillingCycle: billingCycle,
+		Language:     language,
+		CategoryID:   categoryID,
+		Difficulty:   difficulty,
+		Tags:         tags,
+		MaxStudents:  maxStudents,
 	}
 
 	if role == domain.RoleTeacher {
@@ -77,18 +115,35 @@ func (s *CourseService) CreateCourse(
 		}
 
 	} else if role == domain.RoleSchoolAdmin {
-		// School Admin creating course
+		// School staff creating course
 		// 1. Get School ID
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, creatorID)
+		school, scope, err := s.policy.MemberScope(ctx, Actor{UserID: creatorID, Role: role}, ActionManageCourse)
 		if err != nil {
-			return nil, errors.New("school not found for admin")
+			return nil, err
 		}
 		course.SchoolID = &school.ID
+		// A branch manager's courses are at their branch.
+		if scope != "" {
+			branchID = &scope
+		}
+		if branchID != nil && *branchID != "" {
+			if err := s.checkSchoolBranch(ctx, school.ID, *branchID); err != nil {
+				return nil, err
+			}
+			course.BranchID = branchID
+		}
 
-		// 2. Validate Teacher belongs to school (Optional strict check, skipping for MVP speed)
+		// 2. The teacher must be on the school's staff
 		if teacherID == nil {
 			return nil, errors.New("teacher_id is required for school courses")
 		}
+		profile, err := s.schoolRepo.GetTeacherProfile(ctx, *teacherID)
+		if err != nil && !errors.Is(err, repository.ErrTeacherProfileNotFound) {
+			return nil, err
+		}
+		if profile == nil || profile.SchoolID == nil || *profile.SchoolID != school.ID {
+			return nil, repository.ErrTeacherNotInSchool
+		}
 		course.TeacherID = teacherID
 	} else {
 		return nil, errors.New("unauthorized to create course")
@@ -106,7 +161,37 @@ func (s *CourseService) CreateCourse(
 	return course, nil
 }
 
-func (s *CourseService) ListCourses(ctx context.Context, userID string, role domain.Role) ([]*domain.Course, error) {
+// checkSchoolBranch returns ErrBranchNotFound unless the branch is one of the school's.
+func (s *CourseService) checkSchoolBranch(ctx context.Context, schoolID, branchID string) error {
+	branch, err := s.branchRepo.GetByID(ctx, branchID)
+	if err != nil {
+		return err
+	}
+	if branch.SchoolID != schoolID {
+		return repository.ErrBranchNotFound
+	}
+	return nil
+}
+
+// courseSection resolves an optional section ID to one of the course's sections; nil or
+// empty means no section.
+func (s *CourseService) courseSection(ctx context.Context, courseID string, sectionID *string) (*string, error) {
+	if sectionID == nil || *sectionID == "" {
+		return nil, nil
+	}
+	section, err := s.sections.GetByID(ctx, *sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if section.CourseID != courseID {
+		return nil, repository.ErrSectionNotFound
+	}
+	return &section.ID, nil
+}
+
+// ListCourses lists the courses the user works with. School staff can narrow the school's
+// courses to one branch; a branch manager always gets their own branch's.
+func (s *CourseService) ListCourses(ctx context.Context, userID string, role domain.Role, branchID string) ([]*domain.Course, error) {
 	filter := repository.CourseFilter{
 		UserID: &userID,
 	}
@@ -117,37 +202,36 @@ func (s *CourseService) ListCourses(ctx context.Context, userID string, role dom
 	if role == domain.RoleTeacher {
 		filter.TeacherID = &userID
 	} else if role == domain.RoleSchoolAdmin {
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, userID)
+		school, scope, err := s.policy.MemberScope(ctx, Actor{UserID: userID, Role: role}, ActionViewCourse)
 		if err == nil {
 			filter.SchoolID = &school.ID
+			if scope != "" {
+				branchID = scope
+			}
+			if branchID != "" {
+				filter.BranchID = &branchID
+			}
 		}
 	}
 
 	return s.courseRepo.ListCourses(ctx, filter)
 }
 
-func (s *CourseService) InviteStudent(ctx context.Context, inviterID string, role domain.Role, courseID, studentEmail string) error {
-	// 1. Check if course exists
+// InviteStudent invites a student to the course, into one of its sections if sectionID is set.
+func (s *CourseService) InviteStudent(ctx context.Context, inviterID string, role domain.Role, courseID, studentEmail string, sectionID *string) error {
+	// 1. Authorization: Inviter must be on the course's staff
+	if err := s.policy.Can(ctx, Actor{UserID: inviterID, Role: role}, ActionManageEnrollments, CourseResource(courseID)); err != nil {
+		return err
+	}
+
+	// 2. Load the course
 	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
 	if err != nil {
 		return err
 	}
-
-	// 2. Authorization: Inviter must be the teacher or school admin of the course
-	if role == domain.RoleTeacher {
-		if course.TeacherID == nil || *course.TeacherID != inviterID {
-			return errors.New("unauthorized to invite to this course")
-		}
-	} else if role == domain.RoleSchoolAdmin {
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, inviterID)
-		if err != nil {
-			return errors.New("school not found")
-		}
-		if course.SchoolID == nil || *course.SchoolID != school.ID {
-			return errors.New("unauthorized to invite to this course")
-		}
-	} else {
-		return errors.New("unauthorized")
+	sectionID, err = s.courseSection(ctx, courseID, sectionID)
+	if err != nil {
+		return err
 	}
 
 	// 3. Find Student by Email
@@ -158,6 +242,10 @@ func (s *CourseService) InviteStudent(ctx context.Context, inviterID string, rol
 	if studentUser.Role != domain.RoleStudent {
 		return errors.New("user is not a student")
 	}
+	// An unconfirmed address may be a typo that belongs to someone else.
+	if studentUser.EmailVerifiedAt == nil {
+		return errors.New("student has not verified their email address yet")
+	}
 
 	// 4. Check existing enrollment/invitation
 	existing, err := s.courseRepo.GetEnrollmentByStudentAndCourse(ctx, studentUser.ID, courseID)
@@ -172,6 +260,7 @@ func (s *CourseService) InviteStudent(ctx context.Context, inviterID string, rol
 	enrollment := &domain.Enrollment{
 		StudentUserID: studentUser.ID,
 		CourseID:      courseID,
+		SectionID:     sectionID,
 		Status:        domain.EnrollmentStatusInvited,
 	}
 
@@ -241,12 +330,17 @@ func (s *CourseService) InviteStudent(ctx context.Context, inviterID string, rol
 	return nil
 }
 
-func (s *CourseService) RequestEnrollment(ctx context.Context, studentID, courseID string) error {
+// RequestEnrollment asks for a place in the course, in one of its sections if sectionID is set.
+func (s *CourseService) RequestEnrollment(ctx context.Context, studentID, courseID string, sectionID *string) error {
 	// 1. Check if course exists
 	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
 	if err != nil {
 		return err
 	}
+	sectionID, err = s.courseSection(ctx, courseID, sectionID)
+	if err != nil {
+		return err
+	}
 
 	// 2. Check existing enrollment
 	existing, err := s.courseRepo.GetEnrollmentByStudentAndCourse(ctx, studentID, courseID)
@@ -266,6 +360,7 @@ func (s *CourseService) RequestEnrollment(ctx context.Context, studentID, course
 	enrollment := &domain.Enrollment{
 		StudentUserID: studentID,
 		CourseID:      courseID,
+		SectionID:     sectionID,
 		Status:        domain.EnrollmentStatusPending,
 	}
 
@@ -279,25 +374,38 @@ func (s *CourseService) RequestEnrollment(ctx context.Context, studentID, course
 	if student != nil && student.Name != "" {
 		studentName = student.Name
 	}
+	message := fmt.Sprintf("%s requested access to %s", studentName, course.Title)
+	if full, err := s.courseRepo.CourseFull(ctx, courseID, sectionKey(sectionID)); err != nil {
+		log.Printf("[CourseService.RequestEnrollment] failed to count seats of course %s: %v", courseID, err)
+	} else if full {
+		message += " (the course is full, so approving puts them on the waitlist)"
+	}
 
 	if course.TeacherID != nil {
 		_ = s.notificationRepo.Create(ctx, &domain.Notification{
 			UserID:  *course.TeacherID,
 			Type:    "enrollment_request",
 			Title:   "New Access Request",
-			Message: fmt.Sprintf("%s requested access to %s", studentName, course.Title),
+			Message: message,
 			Link:    fmt.Sprintf("/courses?view=%s", courseID),
 		})
 	}
 
 	if course.SchoolID != nil {
-		school, err := s.schoolRepo.GetSchoolByID(ctx, *course.SchoolID)
-		if err == nil && school != nil {
+		branchID := ""
+		if course.BranchID != nil {
+			branchID = *course.BranchID
+		}
+		staff, err := s.policy.SchoolStaff(ctx, *course.SchoolID, branchID, ActionManageEnrollments)
+		if err != nil {
+			log.Printf("[CourseService.RequestEnrollment] failed to load staff of school %s: %v", *course.SchoolID, err)
+		}
+		for _, member := range staff {
 			_ = s.notificationRepo.Create(ctx, &domain.Notification{
-				UserID:  school.AdminUserID,
+				UserID:  member.UserID,
 				Type:    "enrollment_request",
 				Title:   "New Access Request",
-				Message: fmt.Sprintf("%s requested access to %s", studentName, course.Title),
+				Message: message,
 				Link:    fmt.Sprintf("/courses?view=%s", courseID),
 			})
 		}
@@ -306,7 +414,10 @@ func (s *CourseService) RequestEnrollment(ctx context.Context, studentID, course
 	return nil
 }
 
-func (s *CourseService) RespondToInvitation(ctx context.Context, studentID, enrollmentID string, accept bool) error {
+// RespondToInvitation accepts or declines an invitation to a course, or a seat offered
+// from its waitlist, and returns the enrollment's new status. Accepting an invitation to a
+// full course puts the student on the waitlist.
+func (s *CourseService) RespondToInvitation(ctx context.Context, studentID, enrollmentID string, accept bool) (string, error) {
 	// 1. Verify enrollment exists and belongs to student
 	// We don't have GetEnrollmentByID directly in repo shown, but we can update directly with where clause or use existing methods.
 	// Ideally we should fetch and check ownership.
@@ -320,7 +431,7 @@ func (s *CourseService) RespondToInvitation(ctx context.Context, studentID, enro
 	// Better: Get all student enrollments and find the one matching ID.
 	enrollments, err := s.courseRepo.GetEnrollmentsByStudent(ctx, studentID)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	var targetEnrollment *domain.Enrollment
@@ -332,19 +443,119 @@ func (s *CourseService) RespondToInvitation(ctx context.Context, studentID, enro
 	}
 
 	if targetEnrollment == nil {
-		return errors.New("invitation not found")
+		return "", errors.New("invitation not found")
 	}
 
-	if targetEnrollment.Status != domain.EnrollmentStatusInvited {
-		return errors.New("enrollment is not in invited status")
+	switch targetEnrollment.Status {
+	case domain.EnrollmentStatusInvited:
+		if accept {
+			return s.admit(ctx, enrollmentID, domain.EnrollmentStatusInvited)
+		}
+		if err := s.courseRepo.UpdateEnrollmentStatus(ctx, enrollmentID, domain.EnrollmentStatusRejected); err != nil {
+			return "", err
+		}
+		return domain.EnrollmentStatusRejected, nil
+	case domain.EnrollmentStatusOffered:
+		if !accept {
+			// Declining gives up the place in line, and the seat goes to the next student.
+			if err := s.courseRepo.DeleteEnrollment(ctx, enrollmentID); err != nil {
+				return "", err
+			}
+			s.promoteWaitlist(ctx, targetEnrollment.CourseID)
+			return domain.EnrollmentStatusRejected, nil
+		}
+		if err := s.courseRepo.ActivateEnrollment(ctx, enrollmentID, domain.EnrollmentStatusOffered); err != nil {
+			if errors.Is(err, repository.ErrEnrollmentNotFound) {
+				return "", ErrWaitlistOfferExpired
+			}
+			return "", err
+		}
+		s.billEnrollment(ctx, enrollmentID)
+		return domain.EnrollmentStatusActive, nil
+	default:
+		return "", errors.New("enrollment is not in invited status")
 	}
+}
 
-	newStatus := domain.EnrollmentStatusRejected
-	if accept {
-		newStatus = domain.EnrollmentStatusActive
+// admit makes an enrollment in the from status active, or puts it on the course's
+// waitlist when the course is full, and returns the status it ended up in.
+func (s *CourseService) admit(ctx context.Context, enrollmentID, from string) (string, error) {
+	err := s.courseRepo.ActivateEnrollment(ctx, enrollmentID, from)
+	if errors.Is(err, repository.ErrCourseFull) {
+		if err := s.courseRepo.WaitlistEnrollment(ctx, enrollmentID, from); err != nil {
+			return "", err
+		}
+		return domain.EnrollmentStatusWaitlisted, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	s.billEnrollment(ctx, enrollmentID)
+	return domain.EnrollmentStatusActive, nil
+}
+
+// promoteWaitlist offers the course's free seats to the students first in its waitlist and
+// tells them how long they have to accept. Problems are only logged, as they must not undo
+// whatever freed the seat; the offers are retried when the next seat frees up.
+func (s *CourseService) promoteWaitlist(ctx context.Context, courseID string) {
+	offered, err := s.courseRepo.PromoteWaitlist(ctx, courseID, time.Now().Add(waitlistOfferWindow))
+	if err != nil {
+		log.Printf("[CourseService.promoteWaitlist] course %s: %v", courseID, err)
+		return
+	}
+	if len(offered) == 0 {
+		return
+	}
+	courseTitle := "a course"
+	if course, err := s.courseRepo.GetCourseByID(ctx, courseID); err == nil {
+		courseTitle = course.Title
+	}
+	for _, e := range offered {
+		_ = s.notificationRepo.Create(ctx, &domain.Notification{
+			UserID: e.StudentUserID,
+			Type:   "waitlist_offer",
+			Title:  "A Seat Is Available",
+			Message: fmt.Sprintf("A seat in %s is available for you. Accept it by %s or it goes to the next student in line.",
+				courseTitle, e.OfferExpiresAt.UTC().Format("Jan 2, 2006 15:04 MST")),
+			Link: fmt.Sprintf("/courses?view=%s", courseID),
+		})
 	}
+}
+
+// ExpireWaitlistOffers withdraws the seat offers nobody accepted in time, tells those
+// students, and offers the seats to the next in line. It returns how many offers expired.
+func (s *CourseService) ExpireWaitlistOffers(ctx context.Context) (int, error) {
+	expired, err := s.courseRepo.ExpireWaitlistOffers(ctx)
+	courses := make(map[string]bool)
+	for _, e := range expired {
+		courses[e.CourseID] = true
+		courseTitle := "a course"
+		if course, err := s.courseRepo.GetCourseByID(ctx, e.CourseID); err == nil {
+			courseTitle = course.Title
+		}
+		_ = s.notificationRepo.Create(ctx, &domain.Notification{
+			UserID:  e.StudentUserID,
+			Type:    "waitlist_offer_expired",
+			Title:   "Seat Offer Expired",
+			Message: fmt.Sprintf("Your seat offer for %s expired and was passed to the next student in line.", courseTitle),
+			Link:    fmt.Sprintf("/courses?view=%s", e.CourseID),
+		})
+	}
+	for courseID := range courses {
+		s.promoteWaitlist(ctx, courseID)
+	}
+	return len(expired), err
+}
 
-	return s.courseRepo.UpdateEnrollmentStatus(ctx, enrollmentID, newStatus)
+// billEnrollment issues the first invoice(s) for a newly active enrollment.
+// Billing problems must not undo the enrollment, so they are only logged.
+func (s *CourseService) billEnrollment(ctx context.Context, enrollmentID string) {
+	if s.invoiceService == nil {
+		return
+	}
+	if err := s.invoiceService.OnEnrollmentActivated(ctx, enrollmentID); err != nil {
+		log.Printf("[CourseService] invoice enrollment %s: %v", enrollmentID, err)
+	}
 }
 
 func (s *CourseService) GetStudentEnrollments(ctx context.Context, studentID string) ([]repository.EnrollmentWithCourse, error) {
@@ -377,44 +588,56 @@ func (s *CourseService) GetCourseProgress(ctx context.Context, studentID, course
 }
 
 func (s *CourseService) GetCourseEnrollments(ctx context.Context, userID string, role domain.Role, courseID string) ([]*domain.Enrollment, error) {
-	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
-	if err != nil {
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManageEnrollments, CourseResource(courseID)); err != nil {
 		return nil, err
 	}
-
-	// Authorization
-	if role == domain.RoleTeacher {
-		if course.TeacherID == nil || *course.TeacherID != userID {
-			return nil, errors.New("unauthorized")
-		}
-	} else if role == domain.RoleSchoolAdmin {
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, userID)
-		if err != nil {
-			return nil, errors.New("school not found")
-		}
-		if course.SchoolID == nil || *course.SchoolID != school.ID {
-			return nil, errors.New("unauthorized")
-		}
-	} else {
-		return nil, errors.New("unauthorized")
-	}
-
 	return s.courseRepo.GetEnrollmentsByCourse(ctx, courseID)
 }
 
-// ApproveOrRejectEnrollment allows a teacher or school_admin to approve or reject a pending enrollment request.
-func (s *CourseService) ApproveOrRejectEnrollment(ctx context.Context, userID string, role domain.Role, enrollmentID string, approve bool) error {
-	if role != domain.RoleTeacher && role != domain.RoleSchoolAdmin {
-		return errors.New("only teachers and admins can manage enrollment requests")
+// ApproveOrRejectEnrollment allows the course's staff to approve or reject a pending enrollment
+// request, and returns the enrollment's new status. Approving a request for a full course puts
+// the student on the waitlist.
+func (s *CourseService) ApproveOrRejectEnrollment(ctx context.Context, userID string, role domain.Role, enrollmentID string, approve bool) (string, error) {
+	pending, err := s.courseRepo.GetEnrollmentByID(ctx, enrollmentID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManageEnrollments, CourseResource(pending.CourseID)); err != nil {
+		return "", err
 	}
 
 	newStatus := domain.EnrollmentStatusRejected
 	if approve {
-		newStatus = domain.EnrollmentStatusActive
+		if pending.Status != domain.EnrollmentStatusPending {
+			return "", errors.New("only pending requests can be approved")
+		}
+		if newStatus, err = s.admit(ctx, enrollmentID, domain.EnrollmentStatusPending); err != nil {
+			return "", err
+		}
+	} else {
+		if err := s.courseRepo.UpdateEnrollmentStatus(ctx, enrollmentID, newStatus); err != nil {
+			return "", err
+		}
+		// Turning away a student who held or was offered a seat frees it for the waitlist.
+		if pending.Status == domain.EnrollmentStatusActive || pending.Status == domain.EnrollmentStatusOffered {
+			s.promoteWaitlist(ctx, pending.CourseID)
+		}
 	}
 
-	if err := s.courseRepo.UpdateEnrollmentStatus(ctx, enrollmentID, newStatus); err != nil {
-		return err
+	if newStatus == domain.EnrollmentStatusWaitlisted {
+		course, _ := s.courseRepo.GetCourseByID(ctx, pending.CourseID)
+		courseTitle := "a course"
+		if course != nil {
+			courseTitle = course.Title
+		}
+		_ = s.notificationRepo.Create(ctx, &domain.Notification{
+			UserID:  pending.StudentUserID,
+			Type:    "enrollment_waitlisted",
+			Title:   "Added to Waitlist",
+			Message: fmt.Sprintf("Your access request to %s has been approved, but the course is full. You are on the waitlist and will be offered a seat when one frees up.", courseTitle),
+			Link:    fmt.Sprintf("/courses?view=%s", pending.CourseID),
+		})
+		return newStatus, nil
 	}
 
 	// On approval, create an announcement
@@ -469,9 +692,11 @@ func (s *CourseService) ApproveOrRejectEnrollment(ctx context.Context, userID st
 		}
 	}
 
-	return nil
+	return newStatus, nil
 }
 
+// CancelEnrollment withdraws a student's request or waitlist place, or drops them from the
+// course. A seat freed by dropping out is offered to the next students on the waitlist.
 func (s *CourseService) CancelEnrollment(ctx context.Context, studentID, enrollmentID string) error {
 	enrollment, err := s.courseRepo.GetEnrollmentByID(ctx, enrollmentID)
 	if err != nil {
@@ -480,18 +705,41 @@ func (s *CourseService) CancelEnrollment(ctx context.Context, studentID, enrollm
 	if enrollment.StudentUserID != studentID {
 		return errors.New("unauthorized")
 	}
-	if enrollment.Status != domain.EnrollmentStatusPending {
-		return errors.New("only pending requests can be cancelled")
+	switch enrollment.Status {
+	case domain.EnrollmentStatusPending, domain.EnrollmentStatusWaitlisted:
+		return s.courseRepo.DeleteEnrollment(ctx, enrollmentID)
+	case domain.EnrollmentStatusOffered:
+		if err := s.courseRepo.DeleteEnrollment(ctx, enrollmentID); err != nil {
+			return err
+		}
+	case domain.EnrollmentStatusActive:
+		// The enrollment is kept, as its attendance and invoices are history.
+		if err := s.courseRepo.UpdateEnrollmentStatus(ctx, enrollmentID, domain.EnrollmentStatusDropped); err != nil {
+			return err
+		}
+	default:
+		return errors.New("this enrollment cannot be cancelled")
 	}
-	return s.courseRepo.DeleteEnrollment(ctx, enrollmentID)
+	s.promoteWaitlist(ctx, enrollment.CourseID)
+	return nil
 }
 
-func (s *CourseService) UpdateCoverImage(ctx context.Context, courseID string, url *string) error {
+func (s *CourseService) UpdateCoverImage(ctx context.Context, actor Actor, courseID string, url *string) error {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
+		return err
+	}
 	return s.courseRepo.UpdateCoverImage(ctx, courseID, url)
 }
 
 func (s *CourseService) GetCourseByID(ctx context.Context, userID, courseID string) (*domain.Course, error) {
-	return s.courseRepo.GetCourseByIDWithDetails(ctx, userID, courseID)
+	course, err := s.courseRepo.GetCourseByIDWithDetails(ctx, userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	if course.Sections, err = s.sections.ListByCourse(ctx, courseID); err != nil {
+		return nil, err
+	}
+	return course, nil
 }
 
 func (s *CourseService) IncrementCourseView(ctx context.Context, studentID, courseID string) error {
@@ -509,37 +757,22 @@ func (s *CourseService) UpdateCourse(
 	courseID, title, description string,
 	schedule *domain.Schedule,
 	price float64,
+	currency string,
+	billingCycle string,
 	language string,
 	categoryID *string,
 	difficulty string,
 	tags []string,
+	maxStudents *int,
 ) (*domain.Course, error) {
-	// Get existing course to verify ownership
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManageCourse, CourseResource(courseID)); err != nil {
+		return nil, err
+	}
 	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Ownership check
-	switch role {
-	case domain.RoleTeacher:
-		if course.TeacherID == nil || *course.TeacherID != userID {
-			return nil, errors.New("you do not own this course")
-		}
-	case domain.RoleSchoolAdmin:
-		if course.SchoolID == nil {
-			return nil, errors.New("this course does not belong to a school")
-		}
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, userID)
-		if err != nil || school.ID != *course.SchoolID {
-			return nil, errors.New("you do not own this course's school")
-		}
-	case domain.RoleAdmin:
-		// Admin can edit any course
-	default:
-		return nil, errors.New("insufficient permissions")
-	}
-
 	// Apply updates
 	if title != "" {
 		course.Title = title
@@ -549,6 +782,28 @@ func (s *CourseService) UpdateCourse(
 		course.Schedule = schedule
 	}
 	course.Price = price
+	if currency != "" {
+		currency, err = normalizeCurrency(currency)
+		if err != nil {
+			return nil, err
+		}
+		// Invoices and payments are kept in the course's currency, so it is fixed once billing starts.
+		if currency != course.Currency {
+			billed, err := s.courseRepo.HasBillingHistory(ctx, course.ID)
+			if err != nil {
+				return nil, err
+			}
+			if billed {
+				return nil, errors.New("currency cannot be changed after the course has been billed")
+			}
+			course.Currency = currency
+		}
+	}
+	if billingCycle != "" {
+		if course.BillingCycle, err = normalizeBillingCycle(billingCycle); err != nil {
+			return nil, err
+		}
+	}
 	if language != "" {
 		course.Language = language
 	}
@@ -557,38 +812,48 @@ func (s *CourseService) UpdateCourse(
 		course.Difficulty = difficulty
 	}
 	course.Tags = tags
+	if maxStudents != nil && *maxStudents <= 0 {
+		return nil, ErrInvalidMaxStudents
+	}
+	// A lower limit takes no seats away; it only keeps new students waiting longer.
+	course.MaxStudents = maxStudents
 
 	if err := s.courseRepo.UpdateCourse(ctx, course); err != nil {
 		return nil, err
 	}
+	// A higher limit, or none, may have freed seats for the waitlist.
+	s.promoteWaitlist(ctx, courseID)
 
 	return s.courseRepo.GetCourseByIDWithDetails(ctx, userID, courseID)
 }
 
 func (s *CourseService) DeleteCourse(ctx context.Context, userID string, role domain.Role, courseID string) error {
-	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
-	if err != nil {
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManageCourse, CourseResource(courseID)); err != nil {
 		return err
 	}
+	return s.courseRepo.DeleteCourse(ctx, courseID)
+}
 
-	switch role {
-	case domain.RoleTeacher:
-		if course.TeacherID == nil || *course.TeacherID != userID {
-			return errors.New("you do not own this course")
-		}
-	case domain.RoleSchoolAdmin:
-		if course.SchoolID == nil {
-			return errors.New("this course does not belong to a school")
-		}
-		school, err := s.schoolRepo.GetSchoolByAdminID(ctx, userID)
-		if err != nil || school.ID != *course.SchoolID {
-			return errors.New("you do not own this course's school")
-		}
-	case domain.RoleAdmin:
-		// Admin can delete any course
+// normalizeBillingCycle defaults an empty cycle to one-time and rejects unknown values.
+func normalizeBillingCycle(cycle string) (string, error) {
+	switch cycle {
+	case "", domain.BillingCycleOneTime:
+		return domain.BillingCycleOneTime, nil
+	case domain.BillingCycleMonthly:
+		return domain.BillingCycleMonthly, nil
 	default:
-		return errors.New("insufficient permissions")
+		return "", fmt.Errorf("invalid billing cycle: %s", cycle)
 	}
+}
 
-	return s.courseRepo.DeleteCourse(ctx, courseID)
+// normalizeCurrency defaults an empty currency to the base currency and rejects unsupported ones.
+func normalizeCurrency(currency string) (string, error) {
+	if currency == "" {
+		return domain.BaseCurrency, nil
+	}
+	currency = strings.ToUpper(currency)
+	if !domain.SupportedCurrencies[currency] {
+		return "", fmt.Errorf("unsupported currency: %s", currency)
+	}
+	return currency, nil
 }
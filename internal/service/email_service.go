@@ -3,14 +3,18 @@ package service
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"log"
 	"net/smtp"
 	"os"
 	"strings"
+	"time"
 )
 
 // EmailService sends transactional emails via SMTP.
 // If SMTP_HOST is not set, all sends are silently skipped (dev-friendly).
+// Without SMTP_USER no authentication is attempted, which suits a local catcher
+// such as Mailpit (see docker-compose.yml).
 type EmailService struct {
 	host string
 	port string
@@ -34,6 +38,10 @@ func (s *EmailService) enabled() bool {
 }
 
 func (s *EmailService) send(to, subject, htmlBody string) error {
+	if to == "" {
+		// Accounts registered with a phone number only have no address to write to.
+		return nil
+	}
 	if !s.enabled() {
 		log.Printf("[EmailService] SMTP not configured — skipping email to %s: %s", to, subject)
 		return nil
@@ -62,7 +70,10 @@ func (s *EmailService) send(to, subject, htmlBody string) error {
 	msg.WriteString("\r\n" + htmlBody)
 
 	addr := s.host + ":" + port
-	auth := smtp.PlainAuth("", s.user, s.pass, s.host)
+	var auth smtp.Auth
+	if s.user != "" {
+		auth = smtp.PlainAuth("", s.user, s.pass, s.host)
+	}
 
 	// Try STARTTLS first; fall back to plain if TLS is not available
 	tlsConf := &tls.Config{ServerName: s.host}
@@ -81,8 +92,10 @@ func (s *EmailService) send(to, subject, htmlBody string) error {
 		return fmt.Errorf("smtp client: %w", err)
 	}
 	defer c.Quit()
-	if err := c.Auth(auth); err != nil {
-		return fmt.Errorf("smtp auth: %w", err)
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
 	}
 	if err := c.Mail(from); err != nil {
 		return err
@@ -173,3 +186,113 @@ func (s *EmailService) SendNewMessageNotification(toEmail, recipientName, sender
 		}
 	}()
 }
+
+// SendPasswordReset emails a user the link to choose a new password.
+func (s *EmailService) SendPasswordReset(toEmail, name, link string, validFor time.Duration) {
+	subject := "Reset your SchoolTJ password"
+	body := fmt.Sprintf(`
+<html><body style="font-family:sans-serif;color:#111">
+<h2>🔑 Password Reset</h2>
+<p>Hi <strong>%s</strong>,</p>
+<p>We received a request to reset your password. Open the link below to choose a new one:</p>
+<p><a href="%s">Reset password</a></p>
+<p>The link works once and expires in %d minutes. If you did not ask for a reset, you can ignore this email.</p>
+<hr><p style="color:#999;font-size:12px">SchoolTJ Platform</p>
+</body></html>`, name, link, int(validFor.Minutes()))
+
+	go func() {
+		if err := s.send(toEmail, subject, body); err != nil {
+			log.Printf("[EmailService] password reset to %s failed: %v", toEmail, err)
+		}
+	}()
+}
+
+// SendEmailVerification asks a user to confirm their email address.
+func (s *EmailService) SendEmailVerification(toEmail, name, link string) {
+	subject := "Confirm your email for SchoolTJ"
+	body := fmt.Sprintf(`
+<html><body style="font-family:sans-serif;color:#111">
+<h2>✉️ Confirm your email</h2>
+<p>Hi <strong>%s</strong>,</p>
+<p>Please confirm that this is your email address so you can enroll in courses and make payments:</p>
+<p><a href="%s">Confirm email</a></p>
+<p>If you did not create a SchoolTJ account, you can ignore this email.</p>
+<hr><p style="color:#999;font-size:12px">SchoolTJ Platform</p>
+</body></html>`, name, link)
+
+	go func() {
+		if err := s.send(toEmail, subject, body); err != nil {
+			log.Printf("[EmailService] email verification to %s failed: %v", toEmail, err)
+		}
+	}()
+}
+
+// SendGuardianInvitation invites a parent to follow a student's progress.
+func (s *EmailService) SendGuardianInvitation(toEmail, studentName, link string, validFor time.Duration) {
+	subject := fmt.Sprintf("Follow %s on SchoolTJ", studentName)
+	body := fmt.Sprintf(`
+<html><body style="font-family:sans-serif;color:#111">
+<h2>👪 Parent Invitation</h2>
+<p>You have been invited to follow <strong>%s</strong>'s grades, attendance, homework and payments on SchoolTJ.</p>
+<p>Sign in or create a parent account, then open the link below:</p>
+<p><a href="%s">Accept invitation</a></p>
+<p>The link works once and expires in %d days. If you do not know this student, you can ignore this email.</p>
+<hr><p style="color:#999;font-size:12px">SchoolTJ Platform</p>
+</body></html>`, studentName, link, int(validFor.Hours()/24))
+
+	go func() {
+		if err := s.send(toEmail, subject, body); err != nil {
+			log.Printf("[EmailService] guardian invitation to %s failed: %v", toEmail, err)
+		}
+	}()
+}
+
+// SendTeacherInvitation invites someone to teach at a school. Someone without an account
+// creates one from the link by choosing a password.
+func (s *EmailService) SendTeacherInvitation(toEmail, schoolName, link string, hasAccount bool, validFor time.Duration) {
+	subject := fmt.Sprintf("Join %s on SchoolTJ", schoolName)
+	next := "Open the link below and choose a password to create your teacher account:"
+	if hasAccount {
+		next = "Sign in to your teacher account, then open the link below:"
+	}
+	body := fmt.Sprintf(`
+<html><body style="font-family:sans-serif;color:#111">
+<h2>🧑‍🏫 Teacher Invitation</h2>
+<p><strong>%s</strong> has invited you to teach with them on SchoolTJ.</p>
+<p>%s</p>
+<p><a href="%s">Accept invitation</a></p>
+<p>The link works once and expires in %d days. If you were not expecting this, you can ignore this email.</p>
+<hr><p style="color:#999;font-size:12px">SchoolTJ Platform</p>
+</body></html>`, html.EscapeString(schoolName), next, link, int(validFor.Hours()/24))
+
+	go func() {
+		if err := s.send(toEmail, subject, body); err != nil {
+			log.Printf("[EmailService] teacher invitation to %s failed: %v", toEmail, err)
+		}
+	}()
+}
+
+// SendStaffInvitation tells someone they were added to a school's staff. link lets a new
+// account choose its password; an existing account just signs in, and link is empty.
+func (s *EmailService) SendStaffInvitation(toEmail, schoolName, role, link string, validFor time.Duration) {
+	subject := fmt.Sprintf("You have been added to %s on SchoolTJ", schoolName)
+	next := "Sign in to your SchoolTJ account to get started."
+	if link != "" {
+		next = fmt.Sprintf(`Open the link below to choose a password for your new account:</p>
+<p><a href="%s">Set password</a></p>
+<p>The link works once and expires in %d days.`, link, int(validFor.Hours()/24))
+	}
+	body := fmt.Sprintf(`
+<html><body style="font-family:sans-serif;color:#111">
+<h2>🏫 Welcome to the Team</h2>
+<p>You have been added to the staff of <strong>%s</strong> as <strong>%s</strong>.</p>
+<p>%s</p>
+<hr><p style="color:#999;font-size:12px">SchoolTJ Platform</p>
+</body></html>`, html.EscapeString(schoolName), role, next)
+
+	go func() {
+		if err := s.send(toEmail, subject, body); err != nil {
+			log.Printf("[EmailService] staff invitation to %s failed: %v", toEmail, err)
+		}
+	}()
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage is what a client handed to the fake SMTP server.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP listens on a local port and speaks just enough SMTP to accept messages. It
+// returns the listener's address and a channel that receives each delivered message.
+func fakeSMTP(t *testing.T) (string, <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	delivered := make(chan smtpMessage, 1)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+				reply("220 fake ESMTP")
+				var msg smtpMessage
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.TrimRight(line, "\r\n")
+					switch upper := strings.ToUpper(cmd); {
+					case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+						reply("250 fake")
+					case strings.HasPrefix(upper, "MAIL FROM:"):
+						msg.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+						reply("250 ok")
+					case strings.HasPrefix(upper, "RCPT TO:"):
+						msg.to = append(msg.to, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+						reply("250 ok")
+					case upper == "DATA":
+						reply("354 go ahead")
+						var data strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+							data.WriteString(l)
+						}
+						msg.data = data.String()
+						reply("250 queued")
+						delivered <- msg
+					case upper == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						// Includes the TLS handshake the client tries first.
+						reply("500 unrecognised")
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), delivered
+}
+
+func TestEmailSendDeliversOverSMTP(t *testing.T) {
+	addr, delivered := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	s := &EmailService{host: host, port: port, from: "noreply@school.tj"}
+
+	if err := s.send("student@example.com", "Payment confirmed — Algebra", "<p>Thank you</p>"); err != nil {
+		t.Fatal(err)
+	}
+	var msg smtpMessage
+	select {
+	case msg = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+	if msg.from != "noreply@school.tj" {
+		t.Errorf("MAIL FROM %q", msg.from)
+	}
+	if len(msg.to) != 1 || msg.to[0] != "student@example.com" {
+		t.Errorf("RCPT TO %v", msg.to)
+	}
+	headers, body, ok := strings.Cut(msg.data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header/body separator: %q", msg.data)
+	}
+	for _, h := range []string{
+		"From: noreply@school.tj",
+		"To: student@example.com",
+		"Subject: Payment confirmed — Algebra",
+		"Content-Type: text/html; charset=UTF-8",
+	} {
+		if !strings.Contains(headers+"\r\n", h+"\r\n") {
+			t.Errorf("missing header %q in %q", h, headers)
+		}
+	}
+	if strings.TrimSpace(body) != "<p>Thank you</p>" {
+		t.Errorf("body %q", body)
+	}
+}
+
+func TestEmailSendSkipsWithoutAddressOrServer(t *testing.T) {
+	addr, delivered := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	if err := (&EmailService{host: host, port: port}).send("", "Hi", "<p>Hi</p>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&EmailService{}).send("student@example.com", "Hi", "<p>Hi</p>"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-delivered:
+		t.Fatalf("unexpected delivery %+v", msg)
+	default:
+	}
+}
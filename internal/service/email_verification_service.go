@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrEmailNotVerified     = errors.New("email address is not verified")
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// EmailVerificationService confirms that users own the address they registered with.
+type EmailVerificationService struct {
+	userRepo    *repository.UserRepository
+	verifyRepo  *repository.EmailVerificationRepository
+	email       *EmailService
+	appURL      string
+	tokenExpiry time.Duration
+}
+
+// NewEmailVerificationService builds the service. appURL is the web app's base URL, which
+// serves the page the emailed link opens.
+func NewEmailVerificationService(userRepo *repository.UserRepository, verifyRepo *repository.EmailVerificationRepository, email *EmailService, appURL string) *EmailVerificationService {
+	return &EmailVerificationService{
+		userRepo:    userRepo,
+		verifyRepo:  verifyRepo,
+		email:       email,
+		appURL:      strings.TrimRight(appURL, "/"),
+		tokenExpiry: 48 * time.Hour,
+	}
+}
+
+// SendVerification emails the user a link confirming their current address.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user *domain.User) error {
+	token, err := newSecureToken()
+	if err != nil {
+		return err
+	}
+	if err := s.verifyRepo.Create(ctx, user.ID, hashToken(token), time.Now().Add(s.tokenExpiry)); err != nil {
+		return err
+	}
+	link := s.appURL + "/verify-email?token=" + url.QueryEscape(token)
+	s.email.SendEmailVerification(user.Email, user.Name, link)
+	return nil
+}
+
+// Resend sends a fresh link to a signed-in user who has not verified yet, or whose address
+// was only assumed to be verified.
+func (s *EmailVerificationService) Resend(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil && !user.EmailAssumed {
+		return ErrEmailAlreadyVerified
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// Verify confirms the address a token was sent to.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	if token == "" {
+		return repository.ErrVerificationTokenInvalid
+	}
+	_, err := s.verifyRepo.Verify(ctx, hashToken(token))
+	return err
+}
+
+// RequireVerified is the policy hook for actions that need a confirmed address,
+// such as enrolling or paying. It returns ErrEmailNotVerified otherwise.
+func (s *EmailVerificationService) RequireVerified(ctx context.Context, userID string) error {
+	verified, err := s.userRepo.IsEmailVerified(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
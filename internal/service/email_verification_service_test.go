@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// capture matches any value and keeps it.
+type capture struct{ value driver.Value }
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+// expiresIn matches a time about d from now.
+type expiresIn time.Duration
+
+func (e expiresIn) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	d := time.Until(t) - time.Duration(e)
+	return ok && d <= 0 && d > -time.Minute
+}
+
+// newTestEmailVerificationService returns a service whose emails go to a fake SMTP server.
+func newTestEmailVerificationService(t *testing.T) (*EmailVerificationService, sqlmock.Sqlmock, <-chan smtpMessage) {
+	addr, delivered := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	db, mock := newMockDB(t)
+	s := NewEmailVerificationService(&repository.UserRepository{DB: db}, &repository.EmailVerificationRepository{DB: db},
+		&EmailService{host: host, port: port, from: "noreply@school.tj"}, "https://app.school.tj/")
+	return s, mock, delivered
+}
+
+// expectNewToken answers storing a new token for the user, keeping the stored hash in hash.
+func expectNewToken(mock sqlmock.Sqlmock, userID string, hash *capture) {
+	mock.ExpectBegin()
+	// Links sent earlier stop working.
+	mock.ExpectExec(`UPDATE email_verification_tokens SET used_at = NOW\(\) WHERE user_id = \? AND used_at IS NULL`).WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO email_verification_tokens`).WithArgs(sqlmock.AnyArg(), userID, hash, expiresIn(48*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestSendVerificationStoresOnlyTheTokensHash(t *testing.T) {
+	s, mock, delivered := newTestEmailVerificationService(t)
+	hash := &capture{}
+	expectNewToken(mock, "u1", hash)
+
+	if err := s.SendVerification(context.Background(), &domain.User{ID: "u1", Email: "student@example.com", Name: "Student"}); err != nil {
+		t.Fatal(err)
+	}
+	var msg smtpMessage
+	select {
+	case msg = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+	}
+	link := regexp.MustCompile(`href="https://app\.school\.tj/verify-email\?token=([^"]+)"`).FindStringSubmatch(msg.data)
+	if link == nil {
+		t.Fatalf("no verification link in %q", msg.data)
+	}
+	token, err := url.QueryUnescape(link[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash.value == token || hash.value != hashToken(token) {
+		t.Fatalf("stored %v for token %s, want its hash", hash.value, token)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("empty token", func(t *testing.T) {
+		s, _, _ := newTestEmailVerificationService(t)
+		if err := s.Verify(context.Background(), ""); !errors.Is(err, repository.ErrVerificationTokenInvalid) {
+			t.Fatalf("err = %v, want ErrVerificationTokenInvalid", err)
+		}
+	})
+
+	t.Run("unknown, used or expired token", func(t *testing.T) {
+		s, mock, _ := newTestEmailVerificationService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`WHERE token_hash = \? AND used_at IS NULL AND expires_at > NOW\(\) FOR UPDATE`).WithArgs(hashToken("stale")).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+		if err := s.Verify(context.Background(), "stale"); !errors.Is(err, repository.ErrVerificationTokenInvalid) {
+			t.Fatalf("err = %v, want ErrVerificationTokenInvalid", err)
+		}
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		s, mock, _ := newTestEmailVerificationService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`WHERE token_hash = \?`).WithArgs(hashToken("fresh")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow("tok-1", "u1"))
+		mock.ExpectExec(`UPDATE email_verification_tokens SET used_at = NOW\(\) WHERE id = \?`).WithArgs("tok-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// Confirming an address that was only assumed verified makes it verified for real.
+		mock.ExpectExec(`UPDATE users SET email_verified_at = COALESCE\(email_verified_at, NOW\(\)\), email_verification_assumed = FALSE`).
+			WithArgs("u1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if err := s.Verify(context.Background(), "fresh"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestResend(t *testing.T) {
+	verified := time.Now()
+	tests := []struct {
+		name    string
+		user    domain.User
+		wantErr error
+	}{
+		{"not verified", domain.User{ID: "u1", Email: "a@example.com"}, nil},
+		{"assumed verified", domain.User{ID: "u1", Email: "a@example.com", EmailVerifiedAt: &verified, EmailAssumed: true}, nil},
+		{"verified", domain.User{ID: "u1", Email: "a@example.com", EmailVerifiedAt: &verified}, ErrEmailAlreadyVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock, _ := newTestEmailVerificationService(t)
+			expectUser(mock, tt.user)
+			if tt.wantErr == nil {
+				expectNewToken(mock, "u1", &capture{})
+			}
+			if err := s.Resend(context.Background(), "u1"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireVerified(t *testing.T) {
+	for _, verified := range []bool{true, false} {
+		s, mock, _ := newTestEmailVerificationService(t)
+		mock.ExpectQuery(`SELECT email_verified_at IS NOT NULL OR phone_verified_at IS NOT NULL FROM users`).WithArgs("u1").
+			WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(verified))
+		err := s.RequireVerified(context.Background(), "u1")
+		if verified && err != nil || !verified && !errors.Is(err, ErrEmailNotVerified) {
+			t.Fatalf("verified %v: err = %v", verified, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// ExchangeRateService serves the rates platform admins enter by hand. Rates are quoted
+// as units of domain.BaseCurrency per unit of a currency, so the base currency is always 1.
+type ExchangeRateService struct {
+	repo   *repository.ExchangeRateRepository
+	policy *Policy
+}
+
+func NewExchangeRateService(repo *repository.ExchangeRateRepository, policy *Policy) *ExchangeRateService {
+	return &ExchangeRateService{repo: repo, policy: policy}
+}
+
+// RateAt returns how many units of the base currency one unit of currency was worth at t.
+func (s *ExchangeRateService) RateAt(ctx context.Context, currency string, t time.Time) (float64, error) {
+	if currency == "" || currency == domain.BaseCurrency {
+		return 1, nil
+	}
+	rate, err := s.repo.RateAt(ctx, currency, t)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%w for %s on %s", ErrNoExchangeRate, currency, t.Format(dateLayout))
+		}
+		return 0, err
+	}
+	return rate, nil
+}
+
+// Convert converts amount between currencies using the rates in force at t.
+func (s *ExchangeRateService) Convert(ctx context.Context, amount float64, from, to string, t time.Time) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, err := s.RateAt(ctx, from, t)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := s.RateAt(ctx, to, t)
+	if err != nil {
+		return 0, err
+	}
+	return roundMoney(amount * fromRate / toRate), nil
+}
+
+type ExchangeRateInput struct {
+	Currency    string     `json:"currency"`
+	Rate        float64    `json:"rate"`
+	EffectiveAt *time.Time `json:"effective_at"` // defaults to now
+	Source      string     `json:"source"`       // defaults to manual
+}
+
+// SetRate records a new rate. Only platform admins feed rates.
+func (s *ExchangeRateService) SetRate(ctx context.Context, actor Actor, input ExchangeRateInput) (*domain.ExchangeRate, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageExchangeRates, Platform()); err != nil {
+		return nil, err
+	}
+	currency := strings.ToUpper(input.Currency)
+	if !domain.SupportedCurrencies[currency] || currency == domain.BaseCurrency {
+		return nil, fmt.Errorf("unsupported currency: %s", input.Currency)
+	}
+	if input.Rate <= 0 {
+		return nil, errors.New("rate must be positive")
+	}
+
+	rate := &domain.ExchangeRate{
+		Currency:    currency,
+		Rate:        input.Rate,
+		EffectiveAt: time.Now(),
+		Source:      strings.TrimSpace(input.Source),
+		CreatedBy:   actor.UserID,
+	}
+	if input.EffectiveAt != nil {
+		rate.EffectiveAt = *input.EffectiveAt
+	}
+	if rate.Source == "" {
+		rate.Source = domain.RateSourceManual
+	}
+	if err := s.repo.Create(ctx, rate); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (s *ExchangeRateService) ListRates(ctx context.Context, currency string, limit int) ([]domain.ExchangeRate, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return s.repo.List(ctx, strings.ToUpper(currency), limit)
+}
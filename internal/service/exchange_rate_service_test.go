@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// expectRate answers the lookup of currency's rate; a zero rate means none was entered.
+func expectRate(mock sqlmock.Sqlmock, currency string, rate float64) {
+	q := mock.ExpectQuery(`SELECT rate FROM exchange_rates WHERE currency = \?`).WithArgs(currency, sqlmock.AnyArg())
+	if rate == 0 {
+		q.WillReturnError(sql.ErrNoRows)
+		return
+	}
+	q.WillReturnRows(sqlmock.NewRows([]string{"rate"}).AddRow(rate))
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to string
+		rates    map[string]float64 // looked up, in from/to order
+		want     float64
+		wantErr  error
+	}{
+		{"same currency", 100, domain.CurrencyUSD, domain.CurrencyUSD, nil, 100, nil},
+		{"into the base currency", 100, domain.CurrencyUSD, domain.CurrencyTJS, map[string]float64{domain.CurrencyUSD: 10.9}, 1090, nil},
+		{"out of the base currency", 109, domain.CurrencyTJS, domain.CurrencyUSD, map[string]float64{domain.CurrencyUSD: 10.9}, 10, nil},
+		{"through the base currency", 100, domain.CurrencyUSD, domain.CurrencyRUB,
+			map[string]float64{domain.CurrencyUSD: 10.9, domain.CurrencyRUB: 0.12}, 9083.33, nil},
+		{"rounded to cents", 1, domain.CurrencyTJS, domain.CurrencyEUR, map[string]float64{domain.CurrencyEUR: 12.3}, 0.08, nil},
+		{"no rate", 100, domain.CurrencyUSD, domain.CurrencyTJS, map[string]float64{domain.CurrencyUSD: 0}, 0, ErrNoExchangeRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			s := NewExchangeRateService(&repository.ExchangeRateRepository{DB: db}, nil)
+			for _, c := range []string{tt.from, tt.to} {
+				if rate, ok := tt.rates[c]; ok {
+					expectRate(mock, c, rate)
+				}
+			}
+
+			got, err := s.Convert(context.Background(), tt.amount, tt.from, tt.to, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Convert = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalanceTotalsInBaseCurrency(t *testing.T) {
+	db, mock := newMockDB(t)
+	// Currencies are converted in map order.
+	mock.MatchExpectationsInOrder(false)
+	s := NewInvoiceService(&repository.InvoiceRepository{DB: db}, nil, nil,
+		NewExchangeRateService(&repository.ExchangeRateRepository{DB: db}, nil), nil)
+
+	past, future := time.Now().AddDate(0, 0, -1).Format(dateLayout), time.Now().AddDate(0, 1, 0).Format(dateLayout)
+	invoice := func(course, currency string, amount, paid float64, due string) []driver.Value {
+		return []driver.Value{"inv-" + course + due, "enr-" + course, "st1", "Student", course, course, amount, paid, currency,
+			domain.InvoiceStatusOpen, due, nil, due, time.Now()}
+	}
+	rows := sqlmock.NewRows([]string{"id", "enrollment_id", "student_user_id", "student_name", "course_id", "course_title",
+		"amount", "amount_paid", "currency", "status", "period_start", "period_end", "due_date", "created_at"})
+	for _, inv := range [][]driver.Value{
+		invoice("math", domain.CurrencyTJS, 500, 0, past),
+		invoice("english", domain.CurrencyUSD, 100, 40, past),
+		invoice("english", domain.CurrencyUSD, 100, 0, future), // not due yet
+		invoice("french", domain.CurrencyEUR, 50, 0, past),
+	} {
+		rows.AddRow(inv...)
+	}
+	mock.ExpectQuery(`WHERE i\.student_user_id = \?`).WithArgs("st1").WillReturnRows(rows)
+	expectRate(mock, domain.CurrencyUSD, 10.9)
+	expectRate(mock, domain.CurrencyEUR, 0)
+
+	balance, err := s.MyBalance(context.Background(), "st1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 500 TJS and 60 USD at 10.9; the euros have no rate and are only listed.
+	if balance.Outstanding != 1154 {
+		t.Fatalf("outstanding = %v TJS, want 1154", balance.Outstanding)
+	}
+	if got := balance.OutstandingByCurrency; got[domain.CurrencyUSD] != 60 || got[domain.CurrencyEUR] != 50 || got[domain.CurrencyTJS] != 500 {
+		t.Fatalf("outstanding by currency = %v", got)
+	}
+	if len(balance.UnconvertedCurrencies) != 1 || balance.UnconvertedCurrencies[0] != domain.CurrencyEUR {
+		t.Fatalf("unconverted = %v, want [EUR]", balance.UnconvertedCurrencies)
+	}
+}
@@ -2,25 +2,78 @@ package service
 
 import (
 	"context"
+	"errors"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
 type GradeService struct {
-	repo *repository.GradeRepository
+	repo       *repository.GradeRepository
+	courseRepo *repository.CourseRepository
+	policy     *Policy
 }
 
-func NewGradeService(repo *repository.GradeRepository) *GradeService {
-	return &GradeService{repo: repo}
+func NewGradeService(repo *repository.GradeRepository, courseRepo *repository.CourseRepository, policy *Policy) *GradeService {
+	return &GradeService{repo: repo, courseRepo: courseRepo, policy: policy}
 }
 
-func (s *GradeService) CreateGrade(ctx context.Context, g *domain.Grade) error {
+// CreateGrade records a grade for a student enrolled in the course. The teacher of the
+// student's section may grade them too.
+func (s *GradeService) CreateGrade(ctx context.Context, actor Actor, g *domain.Grade) error {
+	enrollment, err := s.courseRepo.GetEnrollmentByStudentAndCourse(ctx, g.StudentUserID, g.CourseID)
+	if err != nil && !errors.Is(err, repository.ErrEnrollmentNotFound) {
+		return err
+	}
+	sectionID := ""
+	if enrollment != nil && enrollment.SectionID != nil {
+		sectionID = *enrollment.SectionID
+	}
+	resource, err := s.policy.CourseOrSection(ctx, g.CourseID, sectionID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Can(ctx, actor, ActionTeachCourse, resource); err != nil {
+		return err
+	}
+	if enrollment == nil || (enrollment.Status != domain.EnrollmentStatusActive && enrollment.Status != domain.EnrollmentStatusCompleted) {
+		return errors.New("student is not enrolled in this course")
+	}
+	g.SectionID = enrollment.SectionID
+	g.GradedBy = actor.UserID
 	return s.repo.Create(ctx, g)
 }
 
-func (s *GradeService) ListByCourse(ctx context.Context, courseID string) ([]domain.Grade, error) {
-	return s.repo.ListByCourse(ctx, courseID)
+// ListByCourse returns every grade in the course to its staff, and only their own grades
+// to an enrolled student. With sectionID set it returns the section's grades, which its
+// teacher may see.
+func (s *GradeService) ListByCourse(ctx context.Context, actor Actor, courseID, sectionID string) ([]domain.Grade, error) {
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.policy.Can(ctx, actor, ActionTeachCourse, resource)
+	if err != nil && !errors.Is(err, ErrForbidden) {
+		return nil, err
+	}
+	staff := err == nil
+	if !staff {
+		if err := s.policy.Can(ctx, actor, ActionViewCourse, resource); err != nil {
+			return nil, err
+		}
+	}
+
+	grades, err := s.repo.ListByCourse(ctx, courseID, sectionID)
+	if err != nil || staff {
+		return grades, err
+	}
+	own := grades[:0]
+	for _, g := range grades {
+		if g.StudentUserID == actor.UserID {
+			own = append(own, g)
+		}
+	}
+	return own, nil
 }
 
 func (s *GradeService) ListByStudent(ctx context.Context, studentID string) ([]domain.Grade, error) {
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrGuardianContactRequired = errors.New("email or phone is required")
+	ErrNotParentAccount        = errors.New("only parent accounts can accept a guardian invitation")
+	ErrGuardianInviteForOther  = errors.New("this invitation was sent to a different email address or phone number")
+)
+
+// GuardianService links parent accounts to students and gives parents a read-only view
+// of their children's grades, attendance, homework and payments. A student, their school
+// admin or a platform admin invites a parent by email or phone; the parent accepts with
+// the link they receive while signed in to a parent account. School staff looking at a
+// student see only the courses the student takes at their school.
+type GuardianService struct {
+	repo        *repository.GuardianRepository
+	userRepo    *repository.UserRepository
+	policy      *Policy
+	email       *EmailService
+	sms         SMSSender
+	grades      *GradeService
+	attendance  *AttendanceService
+	assignments *AssignmentService
+	payments    *PaymentService
+	invoices    *InvoiceService
+	appURL      string
+	inviteTTL   time.Duration
+}
+
+// NewGuardianService builds the service. appURL is the web app's base URL, which serves
+// the page the invitation link opens.
+func NewGuardianService(repo *repository.GuardianRepository, userRepo *repository.UserRepository, policy *Policy, email *EmailService, sms SMSSender,
+	grades *GradeService, attendance *AttendanceService, assignments *AssignmentService, payments *PaymentService, invoices *InvoiceService, appURL string) *GuardianService {
+	return &GuardianService{
+		repo:        repo,
+		userRepo:    userRepo,
+		policy:      policy,
+		email:       email,
+		sms:         sms,
+		grades:      grades,
+		attendance:  attendance,
+		assignments: assignments,
+		payments:    payments,
+		invoices:    invoices,
+		appURL:      strings.TrimRight(appURL, "/"),
+		inviteTTL:   7 * 24 * time.Hour,
+	}
+}
+
+// Invite sends a single-use invitation to become the student's guardian to an email
+// address or, if none is given, a phone number.
+func (s *GuardianService) Invite(ctx context.Context, actor Actor, studentID, email, phone, relationship string) (*domain.GuardianLink, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageGuardians, StudentResource(studentID)); err != nil {
+		return nil, err
+	}
+	email = strings.TrimSpace(email)
+	if email == "" && strings.TrimSpace(phone) == "" {
+		return nil, ErrGuardianContactRequired
+	}
+	if email == "" {
+		normalized, err := NormalizePhone(phone)
+		if err != nil {
+			return nil, err
+		}
+		phone = normalized
+	} else {
+		phone = ""
+	}
+	student, err := s.userRepo.GetUserByID(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.inviteTTL)
+	link := &domain.GuardianLink{
+		StudentUserID: studentID,
+		StudentName:   student.Name,
+		Relationship:  strings.TrimSpace(relationship),
+		InvitedEmail:  email,
+		InvitedPhone:  phone,
+		InvitedBy:     actor.UserID,
+		ExpiresAt:     &expiresAt,
+	}
+	if err := s.repo.CreateInvite(ctx, link, hashToken(token)); err != nil {
+		return nil, err
+	}
+
+	acceptURL := s.appURL + "/accept-guardian?token=" + url.QueryEscape(token)
+	if email != "" {
+		s.email.SendGuardianInvitation(email, student.Name, acceptURL, s.inviteTTL)
+	} else {
+		message := fmt.Sprintf("You are invited to follow %s on SchoolTJ: %s", student.Name, acceptURL)
+		if err := s.sms.Send(ctx, phone, message); err != nil {
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+// Accept links the signed-in parent to the student the invitation was for and returns
+// the student's ID. Only an account with the invited address or phone number, verified,
+// can accept.
+func (s *GuardianService) Accept(ctx context.Context, actor Actor, token string) (string, error) {
+	if actor.Role != domain.RoleParent {
+		return "", ErrNotParentAccount
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", repository.ErrGuardianInviteInvalid
+	}
+	link, err := s.repo.GetPendingByToken(ctx, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, actor.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !inviteTarget(link, user) {
+		return "", ErrGuardianInviteForOther
+	}
+	return s.repo.Accept(ctx, hashToken(token), actor.UserID)
+}
+
+// inviteTarget reports whether the user has verified the email address or phone number
+// the invitation was sent to.
+func inviteTarget(link *domain.GuardianLink, user *domain.User) bool {
+	if link.InvitedEmail != "" {
+		return user.EmailVerifiedAt != nil && strings.EqualFold(user.Email, link.InvitedEmail)
+	}
+	return link.InvitedPhone != "" && user.Phone != nil && user.PhoneVerifiedAt != nil && *user.Phone == link.InvitedPhone
+}
+
+// ListGuardians returns the student's guardians and open invitations.
+func (s *GuardianService) ListGuardians(ctx context.Context, actor Actor, studentID string) ([]domain.GuardianLink, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageGuardians, StudentResource(studentID)); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByStudent(ctx, studentID)
+}
+
+// Revoke removes a guardian or withdraws an invitation. Whoever may manage the student's
+// guardians can do it, and a guardian can remove themselves.
+func (s *GuardianService) Revoke(ctx context.Context, actor Actor, linkID string) error {
+	link, err := s.repo.GetByID(ctx, linkID)
+	if err != nil {
+		return err
+	}
+	if link.GuardianUserID == nil || *link.GuardianUserID != actor.UserID {
+		if err := s.policy.Can(ctx, actor, ActionManageGuardians, StudentResource(link.StudentUserID)); err != nil {
+			return err
+		}
+	}
+	return s.repo.Revoke(ctx, linkID)
+}
+
+// ListChildren returns the students the parent is linked to.
+func (s *GuardianService) ListChildren(ctx context.Context, actor Actor) ([]domain.Child, error) {
+	return s.repo.ListChildren(ctx, actor.UserID)
+}
+
+func (s *GuardianService) ChildGrades(ctx context.Context, actor Actor, studentID string) ([]domain.Grade, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	grades, err := s.grades.ListByStudent(ctx, studentID)
+	return filterByCourse(grades, visible.Has, func(g domain.Grade) string { return g.CourseID }), err
+}
+
+// ChildAttendance returns the student's attendance records, for one course if courseID
+// is set.
+func (s *GuardianService) ChildAttendance(ctx context.Context, actor Actor, studentID, courseID string) ([]domain.Attendance, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.attendance.GetStudentAttendance(ctx, studentID, courseID)
+	return filterByCourse(records, visible.Has, func(a domain.Attendance) string { return a.CourseID }), err
+}
+
+func (s *GuardianService) ChildAttendanceSummary(ctx context.Context, actor Actor, studentID string) ([]domain.AttendanceSummary, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.attendance.GetStudentSummary(ctx, studentID)
+	return filterByCourse(summary, visible.Has, func(a domain.AttendanceSummary) string { return a.CourseID }), err
+}
+
+func (s *GuardianService) ChildAssignments(ctx context.Context, actor Actor, studentID string) ([]domain.Assignment, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := s.assignments.ListForStudent(ctx, studentID)
+	return filterByCourse(assignments, visible.Has, func(a domain.Assignment) string { return a.CourseID }), err
+}
+
+func (s *GuardianService) ChildPayments(ctx context.Context, actor Actor, studentID string) ([]domain.Payment, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.payments.MyPayments(ctx, studentID)
+	return filterByCourse(payments, visible.Has, func(p domain.Payment) string { return p.CourseID }), err
+}
+
+func (s *GuardianService) ChildBalance(ctx context.Context, actor Actor, studentID string) (*domain.StudentBalance, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.invoices.Balance(ctx, studentID, visible.Has)
+}
+
+// ChildTeachers lists who teaches the student, so that a parent knows whom they can message.
+func (s *GuardianService) ChildTeachers(ctx context.Context, actor Actor, studentID string) ([]domain.ChildTeacher, error) {
+	visible, err := s.policy.StudentCourses(ctx, actor, ActionViewStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	teachers, err := s.repo.ListChildTeachers(ctx, studentID)
+	return filterByCourse(teachers, visible.Has, func(t domain.ChildTeacher) string { return t.CourseID }), err
+}
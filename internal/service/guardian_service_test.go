@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestInviteTarget(t *testing.T) {
+	verified := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	phone, otherPhone := "+992901234567", "+992907654321"
+	byEmail := &domain.GuardianLink{InvitedEmail: "Parent@Example.com"}
+	byPhone := &domain.GuardianLink{InvitedPhone: phone}
+
+	tests := []struct {
+		name string
+		link *domain.GuardianLink
+		user domain.User
+		want bool
+	}{
+		{"email", byEmail, domain.User{Email: "parent@example.com", EmailVerifiedAt: &verified}, true},
+		{"email unverified", byEmail, domain.User{Email: "parent@example.com"}, false},
+		{"other email", byEmail, domain.User{Email: "someone@example.com", EmailVerifiedAt: &verified}, false},
+		{"email invite, matching phone only", byEmail, domain.User{Phone: &phone, PhoneVerifiedAt: &verified}, false},
+		{"phone", byPhone, domain.User{Phone: &phone, PhoneVerifiedAt: &verified}, true},
+		{"phone unverified", byPhone, domain.User{Phone: &phone}, false},
+		{"other phone", byPhone, domain.User{Phone: &otherPhone, PhoneVerifiedAt: &verified}, false},
+		{"no phone", byPhone, domain.User{Email: "parent@example.com", EmailVerifiedAt: &verified}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inviteTarget(tt.link, &tt.user); got != tt.want {
+				t.Fatalf("inviteTarget = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// expectStudentAccess answers the policy's lookup of how a user is connected to st1.
+func expectStudentAccess(mock sqlmock.Sqlmock, userID string, schoolRole domain.SchoolRole, guardian bool) {
+	mock.ExpectQuery(`FROM users u\s+WHERE u.id = \? AND u.role = 'student'`).
+		WithArgs(userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), userID, "st1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "guardian"}).AddRow(string(schoolRole), guardian))
+}
+
+func TestStaffWithoutAnActiveEnrollmentGetNothing(t *testing.T) {
+	// A school that only invited the student, or was only asked to enroll them, is not
+	// connected to them: the repository then reports no school role.
+	db, mock := newMockDB(t)
+	policy := NewPolicy(nil, nil, repository.NewStudentRepository(db), nil, nil, nil)
+	staff := Actor{UserID: "registrar", Role: domain.RoleSchoolAdmin}
+
+	for _, action := range []Action{ActionViewStudent, ActionManageGuardians} {
+		expectStudentAccess(mock, "registrar", "", false)
+		if err := policy.Can(context.Background(), staff, action, StudentResource("st1")); !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: err = %v, want ErrForbidden", action, err)
+		}
+	}
+	expectStudentAccess(mock, "registrar", "", false)
+	if _, err := policy.StudentCourses(context.Background(), staff, ActionViewStudent, "st1"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("StudentCourses: err = %v, want ErrForbidden", err)
+	}
+}
+
+func TestChildGradesScopedToTheCallersCourses(t *testing.T) {
+	graded := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	expectGrades := func(mock sqlmock.Sqlmock) {
+		rows := sqlmock.NewRows([]string{"id", "student_user_id", "student_name", "course_id", "course_title", "title", "score", "letter_grade", "comment", "graded_by", "graded_at", "created_at"})
+		for _, course := range []string{"ours", "elsewhere", "other-branch"} {
+			rows.AddRow("g-"+course, "st1", "", course, course, "Quiz", 9.0, "A", "", "t1", graded, graded)
+		}
+		mock.ExpectQuery(`FROM grades g`).WithArgs("st1").WillReturnRows(rows)
+	}
+
+	tests := []struct {
+		name       string
+		actor      Actor
+		schoolRole domain.SchoolRole
+		guardian   bool
+		want       []string
+	}{
+		{"guardian", Actor{UserID: "parent", Role: domain.RoleParent}, "", true, []string{"ours", "elsewhere", "other-branch"}},
+		{"the student", Actor{UserID: "st1", Role: domain.RoleStudent}, "", false, []string{"ours", "elsewhere", "other-branch"}},
+		{"platform admin", Actor{UserID: "admin", Role: domain.RoleAdmin}, "", false, []string{"ours", "elsewhere", "other-branch"}},
+		{"school staff", Actor{UserID: "registrar", Role: domain.RoleSchoolAdmin}, domain.SchoolRoleRegistrar, false, []string{"ours"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			policy := NewPolicy(nil, nil, repository.NewStudentRepository(db), nil, nil, nil)
+			grades := NewGradeService(repository.NewGradeRepository(db), nil, policy)
+			s := NewGuardianService(nil, nil, policy, nil, nil, grades, nil, nil, nil, nil, "")
+
+			expectStudentAccess(mock, tt.actor.UserID, tt.schoolRole, tt.guardian)
+			if tt.schoolRole != "" {
+				mock.ExpectQuery(`SELECT DISTINCT c.id`).WithArgs(tt.actor.UserID, "st1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("ours"))
+			}
+			expectGrades(mock)
+
+			got, err := s.ChildGrades(context.Background(), tt.actor, "st1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var courses []string
+			for _, g := range got {
+				courses = append(courses, g.CourseID)
+			}
+			if strings.Join(courses, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("grades from %v, want %v", courses, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterByCourse(t *testing.T) {
+	payments := []domain.Payment{{ID: "p1", CourseID: "a"}, {ID: "p2", CourseID: "b"}, {ID: "p3", CourseID: "a"}}
+	visible := &StudentCourses{courses: map[string]bool{"a": true}}
+	got := filterByCourse(payments, visible.Has, func(p domain.Payment) string { return p.CourseID })
+	if len(got) != 2 || got[0].ID != "p1" || got[1].ID != "p3" {
+		t.Fatalf("kept %+v, want p1 and p3", got)
+	}
+	if all := (&StudentCourses{all: true}); !all.Has("anything") {
+		t.Fatal("an unrestricted scope left a course out")
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+)
+
+const (
+	defaultHumoBaseURL = "https://pay.humo.tj/api/v2"
+	// humoCallbackTolerance bounds how old a signed callback timestamp may be.
+	humoCallbackTolerance = 5 * time.Minute
+)
+
+// isoNumericCurrency maps currencies to the ISO 4217 numeric codes the card gateways expect.
+var isoNumericCurrency = map[string]string{
+	domain.CurrencyTJS: "972",
+	domain.CurrencyUSD: "840",
+	domain.CurrencyRUB: "643",
+	domain.CurrencyEUR: "978",
+}
+
+// isoNumeric returns the numeric code of a payment's currency; an unset currency is TJS.
+func isoNumeric(currency string) (string, error) {
+	if currency == "" {
+		currency = domain.BaseCurrency
+	}
+	code, ok := isoNumericCurrency[currency]
+	if !ok {
+		return "", fmt.Errorf("unsupported currency: %s", currency)
+	}
+	return code, nil
+}
+
+// HumoProvider implements the Humo e-commerce gateway.
+//
+// Humo signs with HMAC-SHA512 over "<unix timestamp>.<payload>", base64-encoded,
+// sent in the X-Humo-Signature header next to X-Humo-Timestamp. Amounts are in diram.
+type HumoProvider struct {
+	MerchantID  string
+	Secret      string
+	BaseURL     string
+	CallbackURL string
+	ReturnURL   string
+	HTTPClient  *http.Client
+	now         func() time.Time
+}
+
+func NewHumoProvider(merchantID, secret, baseURL, callbackURL, returnURL string) *HumoProvider {
+	if baseURL == "" {
+		baseURL = defaultHumoBaseURL
+	}
+	return &HumoProvider{
+		MerchantID:  merchantID,
+		Secret:      secret,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		CallbackURL: callbackURL,
+		ReturnURL:   returnURL,
+		HTTPClient:  &http.Client{Timeout: 15 * time.Second},
+		now:         time.Now,
+	}
+}
+
+func (p *HumoProvider) Name() string {
+	return domain.PaymentMethodHumo
+}
+
+type humoPaymentRequest struct {
+	MerchantID  string `json:"merchant_id"`
+	OrderID     string `json:"order_id"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	ReturnURL   string `json:"return_url,omitempty"`
+}
+
+type humoPaymentResponse struct {
+	PaymentID  string `json:"payment_id"`
+	OrderID    string `json:"order_id"`
+	PaymentURL string `json:"payment_url,omitempty"`
+	State      string `json:"state"`
+	Amount     int64  `json:"amount"`
+}
+
+func (p *HumoProvider) InitiatePayment(ctx context.Context, pay *domain.Payment) (string, string, error) {
+	currency, err := isoNumeric(pay.Currency)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := json.Marshal(humoPaymentRequest{
+		MerchantID:  p.MerchantID,
+		OrderID:     pay.ID,
+		Amount:      int64(math.Round(pay.Amount * 100)),
+		Currency:    currency,
+		CallbackURL: p.CallbackURL,
+		ReturnURL:   p.ReturnURL,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var resp humoPaymentResponse
+	if err := p.do(ctx, http.MethodPost, p.BaseURL+"/payments", body, body, &resp); err != nil {
+		return "", "", fmt.Errorf("humo create payment: %w", err)
+	}
+	if resp.PaymentID == "" || resp.PaymentURL == "" {
+		return "", "", errors.New("humo create payment: incomplete response")
+	}
+
+	return resp.PaymentURL, resp.PaymentID, nil
+}
+
+func (p *HumoProvider) HandleCallback(ctx context.Context, body []byte, header http.Header) (string, string, float64, error) {
+	ts := header.Get("X-Humo-Timestamp")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", "", 0, ErrInvalidSignature
+	}
+	if age := p.now().Sub(time.Unix(unix, 0)); age > humoCallbackTolerance || age < -humoCallbackTolerance {
+		return "", "", 0, ErrInvalidSignature
+	}
+
+	got, err := base64.StdEncoding.DecodeString(header.Get("X-Humo-Signature"))
+	if err != nil || !hmac.Equal(got, p.sign(ts, body)) {
+		return "", "", 0, ErrInvalidSignature
+	}
+
+	var payload humoPaymentResponse
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", 0, fmt.Errorf("humo callback: %w", err)
+	}
+	if payload.PaymentID == "" {
+		return "", "", 0, errors.New("humo callback: missing payment_id")
+	}
+
+	return payload.PaymentID, humoStatus(payload.State), float64(payload.Amount) / 100, nil
+}
+
+func (p *HumoProvider) GetStatus(ctx context.Context, providerID string) (string, float64, error) {
+	var resp humoPaymentResponse
+	endpoint := p.BaseURL + "/payments/" + url.PathEscape(providerID)
+	if err := p.do(ctx, http.MethodGet, endpoint, nil, []byte(providerID), &resp); err != nil {
+		return "", 0, fmt.Errorf("humo status: %w", err)
+	}
+	return humoStatus(resp.State), float64(resp.Amount) / 100, nil
+}
+
+type humoRefundRequest struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type humoRefundResponse struct {
+	RefundID string `json:"refund_id"`
+	State    string `json:"state"`
+}
+
+func (p *HumoProvider) Refund(ctx context.Context, pay *domain.Payment, amount float64, reason string) (string, error) {
+	body, err := json.Marshal(humoRefundRequest{
+		Amount: int64(math.Round(amount * 100)),
+		Reason: reason,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp humoRefundResponse
+	endpoint := p.BaseURL + "/payments/" + url.PathEscape(pay.ExternalID) + "/refunds"
+	if err := p.do(ctx, http.MethodPost, endpoint, body, body, &resp); err != nil {
+		return "", fmt.Errorf("humo refund: %w", err)
+	}
+	if humoStatus(resp.State) == domain.PaymentStatusFailed {
+		return "", fmt.Errorf("humo refund: %s", resp.State)
+	}
+	return resp.RefundID, nil
+}
+
+func (p *HumoProvider) sign(timestamp string, payload []byte) []byte {
+	mac := hmac.New(sha512.New, []byte(p.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// do sends a signed request to the Humo API and decodes the JSON response into out.
+func (p *HumoProvider) do(ctx context.Context, method, endpoint string, body, signed []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(p.now().Unix(), 10)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Humo-Merchant", p.MerchantID)
+	req.Header.Set("X-Humo-Timestamp", ts)
+	req.Header.Set("X-Humo-Signature", base64.StdEncoding.EncodeToString(p.sign(ts, signed)))
+
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// humoStatus maps Humo payment states onto our payment statuses.
+func humoStatus(s string) string {
+	switch strings.ToUpper(s) {
+	case "PAID", "CAPTURED":
+		return domain.PaymentStatusSuccess
+	case "DECLINED", "CANCELLED", "EXPIRED", "ERROR":
+		return domain.PaymentStatusFailed
+	default:
+		return domain.PaymentStatusPending
+	}
+}
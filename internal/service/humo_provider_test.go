@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+)
+
+var humoTestNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// humoStandIn is a local stand-in for the Humo API that checks every request is signed
+// over the timestamp and the signed bytes.
+func humoStandIn(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, body []byte)) *HumoProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Humo-Merchant"); got != "merchant-1" {
+			t.Errorf("X-Humo-Merchant = %q", got)
+		}
+		if got := r.Header.Get("X-Humo-Timestamp"); got != strconv.FormatInt(humoTestNow.Unix(), 10) {
+			t.Errorf("X-Humo-Timestamp = %q", got)
+		}
+		handle(w, r, body)
+	}))
+	t.Cleanup(srv.Close)
+	p := NewHumoProvider("merchant-1", "humo-secret", srv.URL, "https://school.tj/api/payments/webhook/humo", "https://school.tj/return")
+	p.now = func() time.Time { return humoTestNow }
+	return p
+}
+
+// humoSigned reports whether a request's signature covers signed.
+func humoSigned(p *HumoProvider, r *http.Request, signed []byte) bool {
+	want := base64.StdEncoding.EncodeToString(p.sign(r.Header.Get("X-Humo-Timestamp"), signed))
+	return r.Header.Get("X-Humo-Signature") == want
+}
+
+func TestHumoInitiatePayment(t *testing.T) {
+	var p *HumoProvider
+	p = humoStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.Method != http.MethodPost || r.URL.Path != "/payments" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if !humoSigned(p, r, body) {
+			t.Error("create request signature does not cover the body")
+		}
+		var req humoPaymentRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		// Amounts go in diram and currencies as ISO numeric codes.
+		if req.OrderID != "pay-1" || req.Amount != 15050 || req.Currency != "840" {
+			t.Errorf("create request %+v", req)
+		}
+		json.NewEncoder(w).Encode(humoPaymentResponse{PaymentID: "hp-1", OrderID: "pay-1", PaymentURL: "https://pay.humo.tj/hp-1", State: "NEW"})
+	})
+
+	redirect, paymentID, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 150.5, Currency: domain.CurrencyUSD})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect != "https://pay.humo.tj/hp-1" || paymentID != "hp-1" {
+		t.Fatalf("got %q, %q", redirect, paymentID)
+	}
+}
+
+func TestHumoInitiatePaymentIncompleteResponse(t *testing.T) {
+	p := humoStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		json.NewEncoder(w).Encode(humoPaymentResponse{PaymentID: "hp-1"})
+	})
+	if _, _, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 10}); err == nil {
+		t.Fatal("expected an error for a response without a payment URL")
+	}
+}
+
+func TestHumoGetStatus(t *testing.T) {
+	tests := []struct {
+		humo string
+		want string
+	}{
+		{"PAID", domain.PaymentStatusSuccess},
+		{"captured", domain.PaymentStatusSuccess},
+		{"DECLINED", domain.PaymentStatusFailed},
+		{"EXPIRED", domain.PaymentStatusFailed},
+		{"NEW", domain.PaymentStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.humo, func(t *testing.T) {
+			var p *HumoProvider
+			p = humoStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+				if r.Method != http.MethodGet || r.URL.Path != "/payments/hp-1" {
+					t.Errorf("request %s %s", r.Method, r.URL.Path)
+				}
+				if !humoSigned(p, r, []byte("hp-1")) {
+					t.Error("status request signature does not cover the payment ID")
+				}
+				json.NewEncoder(w).Encode(humoPaymentResponse{PaymentID: "hp-1", State: tt.humo, Amount: 15050})
+			})
+			got, amount, err := p.GetStatus(context.Background(), "hp-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || amount != 150.50 {
+				t.Fatalf("status %q for %v, want %q for 150.50", got, amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumoHandleCallback(t *testing.T) {
+	p := NewHumoProvider("merchant-1", "humo-secret", "", "", "")
+	p.now = func() time.Time { return humoTestNow }
+	body := []byte(`{"payment_id":"hp-1","order_id":"pay-1","state":"PAID","amount":15050}`)
+
+	signed := func(at time.Time, secret string) http.Header {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		signer := &HumoProvider{Secret: secret}
+		h := http.Header{}
+		h.Set("X-Humo-Timestamp", ts)
+		h.Set("X-Humo-Signature", base64.StdEncoding.EncodeToString(signer.sign(ts, body)))
+		return h
+	}
+
+	paymentID, status, amount, err := p.HandleCallback(context.Background(), body, signed(humoTestNow.Add(-time.Minute), "humo-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paymentID != "hp-1" || status != domain.PaymentStatusSuccess || amount != 150.50 {
+		t.Fatalf("got %q, %q, %v", paymentID, status, amount)
+	}
+
+	rejected := map[string]http.Header{
+		"unsigned":   {},
+		"wrong key":  signed(humoTestNow, "wrong-secret"),
+		"stale":      signed(humoTestNow.Add(-humoCallbackTolerance-time.Second), "humo-secret"),
+		"from ahead": signed(humoTestNow.Add(humoCallbackTolerance+time.Second), "humo-secret"),
+	}
+	for name, h := range rejected {
+		if _, _, _, err := p.HandleCallback(context.Background(), body, h); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s callback: err %v, want ErrInvalidSignature", name, err)
+		}
+	}
+	tampered := []byte(`{"payment_id":"hp-2","order_id":"pay-1","state":"PAID","amount":15050}`)
+	if _, _, _, err := p.HandleCallback(context.Background(), tampered, signed(humoTestNow, "humo-secret")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered callback: err %v, want ErrInvalidSignature", err)
+	}
+}
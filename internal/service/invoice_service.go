@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+const dateLayout = "2006-01-02"
+
+type InvoiceService struct {
+	invoiceRepo *repository.InvoiceRepository
+	courseRepo  *repository.CourseRepository
+	pricing     *PricingService
+	rates       *ExchangeRateService
+	policy      *Policy
+}
+
+func NewInvoiceService(invoiceRepo *repository.InvoiceRepository, courseRepo *repository.CourseRepository, pricing *PricingService, rates *ExchangeRateService, policy *Policy) *InvoiceService {
+	return &InvoiceService{
+		invoiceRepo: invoiceRepo,
+		courseRepo:  courseRepo,
+		pricing:     pricing,
+		rates:       rates,
+		policy:      policy,
+	}
+}
+
+// OnEnrollmentActivated bills a freshly activated enrollment and applies any
+// payments the student already made for the course.
+func (s *InvoiceService) OnEnrollmentActivated(ctx context.Context, enrollmentID string) error {
+	enrollment, err := s.courseRepo.GetEnrollmentByID(ctx, enrollmentID)
+	if err != nil {
+		return err
+	}
+	if err := s.GenerateForEnrollment(ctx, enrollment); err != nil {
+		return err
+	}
+	return s.invoiceRepo.AllocatePayments(ctx, enrollment.StudentUserID, enrollment.CourseID)
+}
+
+// AllocatePayments applies a student's unallocated payments for a course to their open invoices.
+func (s *InvoiceService) AllocatePayments(ctx context.Context, studentUserID, courseID string) error {
+	return s.invoiceRepo.AllocatePayments(ctx, studentUserID, courseID)
+}
+
+// ReleasePayment reopens invoices that were settled by money since refunded,
+// then re-applies whatever credit the student still has.
+func (s *InvoiceService) ReleasePayment(ctx context.Context, p *domain.Payment) error {
+	if err := s.invoiceRepo.ReleasePayment(ctx, p.ID); err != nil {
+		return err
+	}
+	return s.invoiceRepo.AllocatePayments(ctx, p.StudentUserID, p.CourseID)
+}
+
+// GenerateForEnrollment creates the invoices an active enrollment should have by today.
+// One-time courses get a single invoice. Monthly courses get one invoice per month,
+// anchored on the schedule's start date, up to the current period and never past the
+// schedule's end date. Each invoice is issued at the student's effective price at the
+// time, so discounts apply to the periods billed after they were granted. It is
+// idempotent, so it is safe to run again for the same enrollment.
+func (s *InvoiceService) GenerateForEnrollment(ctx context.Context, enrollment *domain.Enrollment) error {
+	if enrollment.Status != domain.EnrollmentStatusActive {
+		return nil
+	}
+	course, err := s.courseRepo.GetCourseByID(ctx, enrollment.CourseID)
+	if err != nil {
+		return err
+	}
+	price, err := s.pricing.EffectivePrice(ctx, enrollment.StudentUserID, course)
+	if err != nil {
+		return err
+	}
+	if price <= 0 {
+		return nil
+	}
+
+	first, err := s.invoiceRepo.FirstPeriodStart(ctx, enrollment.ID)
+	if err != nil {
+		return err
+	}
+	today := truncateToDay(time.Now())
+
+	if course.BillingCycle != domain.BillingCycleMonthly {
+		if first != "" {
+			return nil
+		}
+		_, err := s.invoiceRepo.CreateIfMissing(ctx, &domain.Invoice{
+			EnrollmentID:  enrollment.ID,
+			StudentUserID: enrollment.StudentUserID,
+			CourseID:      course.ID,
+			Amount:        price,
+			PeriodStart:   today.Format(dateLayout),
+			DueDate:       today.Format(dateLayout),
+		})
+		return err
+	}
+
+	var scheduleStart, scheduleEnd time.Time
+	if course.Schedule != nil {
+		scheduleStart, _ = time.Parse(dateLayout, course.Schedule.StartDate)
+		scheduleEnd, _ = time.Parse(dateLayout, course.Schedule.EndDate)
+	}
+
+	// The anchor is the first billed period once one exists, so later runs continue
+	// the same sequence; otherwise bill the period the student joins in.
+	var anchor time.Time
+	k := 0
+	if first != "" {
+		if anchor, err = time.Parse(dateLayout, first); err != nil {
+			return err
+		}
+	} else {
+		anchor = today
+		if !scheduleStart.IsZero() {
+			anchor = scheduleStart
+			for !addMonths(anchor, k+1).After(today) {
+				k++
+			}
+		}
+	}
+
+	for ; ; k++ {
+		start := addMonths(anchor, k)
+		if !scheduleEnd.IsZero() && start.After(scheduleEnd) {
+			break
+		}
+		// The first period is always issued, even if the course starts in the future.
+		if first != "" && start.After(today) {
+			break
+		}
+
+		end := addMonths(anchor, k+1).AddDate(0, 0, -1)
+		if !scheduleEnd.IsZero() && end.After(scheduleEnd) {
+			end = scheduleEnd
+		}
+		periodEnd := end.Format(dateLayout)
+
+		if _, err := s.invoiceRepo.CreateIfMissing(ctx, &domain.Invoice{
+			EnrollmentID:  enrollment.ID,
+			StudentUserID: enrollment.StudentUserID,
+			CourseID:      course.ID,
+			Amount:        price,
+			PeriodStart:   start.Format(dateLayout),
+			PeriodEnd:     &periodEnd,
+			DueDate:       start.Format(dateLayout),
+		}); err != nil {
+			return err
+		}
+		if first == "" {
+			first = start.Format(dateLayout)
+		}
+	}
+	return nil
+}
+
+// GenerateDue brings the invoices of every active enrollment up to date, issuing the
+// periods that have started since the last run. It returns how many enrollments it
+// went through; an enrollment that fails is logged and skipped.
+func (s *InvoiceService) GenerateDue(ctx context.Context) (int, error) {
+	enrollments, err := s.courseRepo.ListActiveEnrollments(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range enrollments {
+		if ctx.Err() != nil {
+			break
+		}
+		s.sync(ctx, e)
+		n++
+	}
+	return n, ctx.Err()
+}
+
+// MyBalance returns a student's invoices and outstanding balance per course. It only
+// reads: invoices are issued when an enrollment is activated and by the InvoiceWorker.
+func (s *InvoiceService) MyBalance(ctx context.Context, studentUserID string) (*domain.StudentBalance, error) {
+	return s.Balance(ctx, studentUserID, nil)
+}
+
+// Balance is MyBalance for only the courses keep accepts, or every course if keep is nil.
+func (s *InvoiceService) Balance(ctx context.Context, studentUserID string, keep func(courseID string) bool) (*domain.StudentBalance, error) {
+	invoices, err := s.invoiceRepo.ListByStudent(ctx, studentUserID)
+	if err != nil {
+		return nil, err
+	}
+	if keep != nil {
+		invoices = filterByCourse(invoices, keep, func(inv domain.Invoice) string { return inv.CourseID })
+	}
+
+	now := time.Now()
+	today := now.Format(dateLayout)
+	balance := &domain.StudentBalance{
+		OutstandingByCurrency: map[string]float64{},
+		Courses:               []domain.CourseBalance{},
+	}
+	index := make(map[string]int)
+	for _, inv := range invoices {
+		i, ok := index[inv.CourseID]
+		if !ok {
+			i = len(balance.Courses)
+			index[inv.CourseID] = i
+			balance.Courses = append(balance.Courses, domain.CourseBalance{
+				CourseID:    inv.CourseID,
+				CourseTitle: inv.CourseTitle,
+				Currency:    inv.Currency,
+			})
+		}
+		cb := &balance.Courses[i]
+		cb.Invoiced += inv.Amount
+		cb.Paid += inv.AmountPaid
+		if inv.DueDate <= today {
+			cb.Outstanding += inv.Amount - inv.AmountPaid
+		}
+		cb.Invoices = append(cb.Invoices, inv)
+	}
+	for _, cb := range balance.Courses {
+		balance.OutstandingByCurrency[cb.Currency] += cb.Outstanding
+	}
+	for currency, amount := range balance.OutstandingByCurrency {
+		converted, err := s.rates.Convert(ctx, amount, currency, domain.BaseCurrency, now)
+		if errors.Is(err, ErrNoExchangeRate) {
+			// Left out of the total and flagged, like revenue in the dashboards.
+			balance.UnconvertedCurrencies = append(balance.UnconvertedCurrencies, currency)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		balance.Outstanding += converted
+	}
+	sort.Strings(balance.UnconvertedCurrencies)
+	balance.Outstanding = roundMoney(balance.Outstanding)
+	return balance, nil
+}
+
+// CourseDebtors lists students with overdue tuition in a course, or in one of its sections
+// when sectionID is set. Only the course's staff, or the section's teacher, may see it.
+func (s *InvoiceService) CourseDebtors(ctx context.Context, userID string, role domain.Role, courseID, sectionID string) ([]domain.Debtor, error) {
+	resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionRecordPayments, resource); err != nil {
+		return nil, err
+	}
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	debtors, err := s.invoiceRepo.ListDebtorsByCourse(ctx, courseID, sectionID, time.Now().Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	for i := range debtors {
+		debtors[i].Currency = course.Currency
+	}
+	return debtors, nil
+}
+
+// sync brings an enrollment's invoices up to date and applies the student's payments to
+// them. Failures are logged rather than returned so one bad enrollment does not hold up
+// the rest.
+func (s *InvoiceService) sync(ctx context.Context, e *domain.Enrollment) {
+	if e.Status != domain.EnrollmentStatusActive {
+		return
+	}
+	if err := s.GenerateForEnrollment(ctx, e); err != nil {
+		log.Printf("[InvoiceService] generate invoices for enrollment %s: %v", e.ID, err)
+		return
+	}
+	if err := s.invoiceRepo.AllocatePayments(ctx, e.StudentUserID, e.CourseID); err != nil {
+		log.Printf("[InvoiceService] allocate payments for enrollment %s: %v", e.ID, err)
+	}
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// addMonths adds n calendar months, clamping to the last day of the target month
+// (Jan 31 + 1 month is Feb 28/29, not Mar 3).
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	if d > last {
+		d = last
+	}
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, t.Location())
+}
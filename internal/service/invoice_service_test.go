@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from string
+		n    int
+		want string
+	}{
+		{"2026-01-15", 1, "2026-02-15"},
+		{"2026-01-31", 1, "2026-02-28"},
+		{"2028-01-31", 1, "2028-02-29"},
+		{"2026-03-31", 1, "2026-04-30"},
+		{"2026-12-10", 1, "2027-01-10"},
+		{"2026-03-31", -1, "2026-02-28"},
+	}
+	for _, tt := range tests {
+		from, _ := time.Parse(dateLayout, tt.from)
+		if got := addMonths(from, tt.n).Format(dateLayout); got != tt.want {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateForEnrollment(t *testing.T) {
+	today := truncateToDay(time.Now())
+	// month(n) is the first day of the month n months from now, lastDay(n) its last.
+	month := func(n int) time.Time {
+		return time.Date(today.Year(), today.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	}
+	day := func(t time.Time) string { return t.Format(dateLayout) }
+	lastDay := func(n int) string { return day(month(n+1).AddDate(0, 0, -1)) }
+	schedule := &domain.Schedule{StartDate: day(month(-2)), EndDate: day(month(6).AddDate(0, 0, -1))}
+	endingNow := &domain.Schedule{StartDate: day(month(-2)), EndDate: day(month(0))}
+
+	type period struct{ start, end string }
+	tests := []struct {
+		name     string
+		cycle    string
+		schedule *domain.Schedule
+		first    string // earliest period already billed
+		want     []period
+	}{
+		{"joins a running course in the current period", domain.BillingCycleMonthly, schedule, "", []period{{day(month(0)), lastDay(0)}}},
+		{"catches up on the periods since the first", domain.BillingCycleMonthly, schedule, day(month(-2)),
+			[]period{{day(month(-2)), lastDay(-2)}, {day(month(-1)), lastDay(-1)}, {day(month(0)), lastDay(0)}}},
+		{"bills the first period of a future course", domain.BillingCycleMonthly,
+			&domain.Schedule{StartDate: day(month(2))}, "", []period{{day(month(2)), lastDay(2)}}},
+		{"cuts the last period at the end of the course", domain.BillingCycleMonthly, endingNow, day(month(-1)),
+			[]period{{day(month(-1)), lastDay(-1)}, {day(month(0)), day(month(0))}}},
+		{"starts on the day of joining without a schedule", domain.BillingCycleMonthly, nil, "",
+			[]period{{day(today), day(addMonths(today, 1).AddDate(0, 0, -1))}}},
+		{"one-time course", domain.BillingCycleOneTime, nil, "", []period{{day(today), ""}}},
+		{"one-time course already billed", domain.BillingCycleOneTime, nil, day(month(-1)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			s := NewInvoiceService(&repository.InvoiceRepository{DB: db}, &repository.CourseRepository{DB: db},
+				NewPricingService(&repository.PricingRepository{DB: db}, nil, nil, nil, nil), nil, nil)
+
+			expectCourse(mock, domain.Course{ID: "course-1", Price: 500, Currency: domain.CurrencyTJS, BillingCycle: tt.cycle, Schedule: tt.schedule})
+			mock.ExpectQuery(`FROM promo_codes WHERE id = \(SELECT promo_code_id FROM promo_redemptions`).WillReturnError(sql.ErrNoRows)
+			var first any
+			if tt.first != "" {
+				first = tt.first
+			}
+			mock.ExpectQuery(`SELECT DATE_FORMAT\(MIN\(period_start\)`).WithArgs("enr-1").
+				WillReturnRows(sqlmock.NewRows([]string{"start"}).AddRow(first))
+			for _, p := range tt.want {
+				var end any
+				if p.end != "" {
+					end = p.end
+				}
+				mock.ExpectExec(`INSERT IGNORE INTO invoices`).
+					WithArgs(sqlmock.AnyArg(), "enr-1", "student-1", "course-1", 500.0, domain.InvoiceStatusOpen, p.start, end, p.start).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			err := s.GenerateForEnrollment(context.Background(), &domain.Enrollment{
+				ID: "enr-1", StudentUserID: "student-1", CourseID: "course-1", Status: domain.EnrollmentStatusActive,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGenerateForEnrollmentSkipsInactive(t *testing.T) {
+	s := NewInvoiceService(nil, nil, nil, nil, nil)
+	for _, status := range []string{domain.EnrollmentStatusPending, domain.EnrollmentStatusCompleted, domain.EnrollmentStatusRejected} {
+		if err := s.GenerateForEnrollment(context.Background(), &domain.Enrollment{Status: status}); err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+	}
+}
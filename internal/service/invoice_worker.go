@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// InvoiceWorker periodically issues the tuition invoices that have come due, so that
+// reading balances and debtor lists never has to write.
+type InvoiceWorker struct {
+	*periodic
+	invoices *InvoiceService
+}
+
+func NewInvoiceWorker(invoices *InvoiceService, interval time.Duration) *InvoiceWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	w := &InvoiceWorker{invoices: invoices}
+	w.periodic = newPeriodic("Invoice worker", interval, w.runOnce)
+	return w
+}
+
+func (w *InvoiceWorker) runOnce(ctx context.Context) {
+	if _, err := w.invoices.GenerateDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("[InvoiceWorker] error: %v", err)
+	}
+}
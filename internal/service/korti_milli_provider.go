@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+)
+
+const defaultKortiMilliBaseURL = "https://ecom.kortimilli.tj/api/v1"
+
+// KortiMilliProvider implements the Korti Milli (national card scheme) e-commerce gateway.
+//
+// Korti Milli does not use HMAC: each message carries a "sign" field equal to
+// hex(SHA-256) of its fields joined with ";" and terminated by the terminal secret.
+// Amounts are in diram.
+type KortiMilliProvider struct {
+	TerminalID  string
+	Secret      string
+	BaseURL     string
+	CallbackURL string
+	ReturnURL   string
+	HTTPClient  *http.Client
+}
+
+func NewKortiMilliProvider(terminalID, secret, baseURL, callbackURL, returnURL string) *KortiMilliProvider {
+	if baseURL == "" {
+		baseURL = defaultKortiMilliBaseURL
+	}
+	return &KortiMilliProvider{
+		TerminalID:  terminalID,
+		Secret:      secret,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		CallbackURL: callbackURL,
+		ReturnURL:   returnURL,
+		HTTPClient:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *KortiMilliProvider) Name() string {
+	return domain.PaymentMethodKortiMilli
+}
+
+type kortiMilliRegisterRequest struct {
+	TerminalID  string `json:"terminal_id"`
+	OrderNumber string `json:"order_number"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	ReturnURL   string `json:"return_url,omitempty"`
+	Sign        string `json:"sign"`
+}
+
+type kortiMilliRegisterResponse struct {
+	OrderID   string `json:"order_id"`
+	FormURL   string `json:"form_url"`
+	ErrorCode string `json:"error_code,omitempty"`
+	ErrorMsg  string `json:"error_message,omitempty"`
+}
+
+type kortiMilliStatusRequest struct {
+	TerminalID string `json:"terminal_id"`
+	OrderID    string `json:"order_id"`
+	Sign       string `json:"sign"`
+}
+
+type kortiMilliOrderStatus struct {
+	TerminalID  string `json:"terminal_id"`
+	OrderID     string `json:"order_id"`
+	OrderNumber string `json:"order_number"`
+	Amount      int64  `json:"amount"`
+	Status      string `json:"status"`
+	RRN         string `json:"rrn,omitempty"`
+	Sign        string `json:"sign,omitempty"`
+	ErrorCode   string `json:"error_code,omitempty"`
+	ErrorMsg    string `json:"error_message,omitempty"`
+}
+
+func (p *KortiMilliProvider) InitiatePayment(ctx context.Context, pay *domain.Payment) (string, string, error) {
+	currency, err := isoNumeric(pay.Currency)
+	if err != nil {
+		return "", "", err
+	}
+	amount := int64(math.Round(pay.Amount * 100))
+	req := kortiMilliRegisterRequest{
+		TerminalID:  p.TerminalID,
+		OrderNumber: pay.ID,
+		Amount:      amount,
+		Currency:    currency,
+		CallbackURL: p.CallbackURL,
+		ReturnURL:   p.ReturnURL,
+	}
+	req.Sign = p.sign(req.TerminalID, req.OrderNumber, strconv.FormatInt(amount, 10), req.Currency)
+
+	var resp kortiMilliRegisterResponse
+	if err := p.post(ctx, "/orders/register", req, &resp); err != nil {
+		return "", "", fmt.Errorf("korti milli register: %w", err)
+	}
+	if resp.ErrorCode != "" && resp.ErrorCode != "0" {
+		return "", "", fmt.Errorf("korti milli register: %s %s", resp.ErrorCode, resp.ErrorMsg)
+	}
+	if resp.OrderID == "" || resp.FormURL == "" {
+		return "", "", errors.New("korti milli register: incomplete response")
+	}
+
+	return resp.FormURL, resp.OrderID, nil
+}
+
+func (p *KortiMilliProvider) HandleCallback(ctx context.Context, body []byte, header http.Header) (string, string, float64, error) {
+	var payload kortiMilliOrderStatus
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", "", 0, fmt.Errorf("korti milli callback: %w", err)
+	}
+	if !p.verify(payload) {
+		return "", "", 0, ErrInvalidSignature
+	}
+	if payload.TerminalID != p.TerminalID {
+		return "", "", 0, fmt.Errorf("korti milli callback: unexpected terminal %s", payload.TerminalID)
+	}
+	if payload.OrderID == "" {
+		return "", "", 0, errors.New("korti milli callback: missing order_id")
+	}
+
+	return payload.OrderID, kortiMilliStatus(payload.Status), float64(payload.Amount) / 100, nil
+}
+
+func (p *KortiMilliProvider) GetStatus(ctx context.Context, providerID string) (string, float64, error) {
+	req := kortiMilliStatusRequest{
+		TerminalID: p.TerminalID,
+		OrderID:    providerID,
+		Sign:       p.sign(p.TerminalID, providerID),
+	}
+	var resp kortiMilliOrderStatus
+	if err := p.post(ctx, "/orders/status", req, &resp); err != nil {
+		return "", 0, fmt.Errorf("korti milli status: %w", err)
+	}
+	if resp.ErrorCode != "" && resp.ErrorCode != "0" {
+		return "", 0, fmt.Errorf("korti milli status: %s %s", resp.ErrorCode, resp.ErrorMsg)
+	}
+	return kortiMilliStatus(resp.Status), float64(resp.Amount) / 100, nil
+}
+
+type kortiMilliRefundRequest struct {
+	TerminalID string `json:"terminal_id"`
+	OrderID    string `json:"order_id"`
+	Amount     int64  `json:"amount"`
+	Sign       string `json:"sign"`
+}
+
+type kortiMilliRefundResponse struct {
+	RefundID  string `json:"refund_id"`
+	Status    string `json:"status"`
+	ErrorCode string `json:"error_code,omitempty"`
+	ErrorMsg  string `json:"error_message,omitempty"`
+}
+
+// Refund reverses part or all of a deposited order. Korti Milli has no reason field.
+func (p *KortiMilliProvider) Refund(ctx context.Context, pay *domain.Payment, amount float64, reason string) (string, error) {
+	diram := int64(math.Round(amount * 100))
+	req := kortiMilliRefundRequest{
+		TerminalID: p.TerminalID,
+		OrderID:    pay.ExternalID,
+		Amount:     diram,
+		Sign:       p.sign(p.TerminalID, pay.ExternalID, strconv.FormatInt(diram, 10)),
+	}
+	var resp kortiMilliRefundResponse
+	if err := p.post(ctx, "/orders/refund", req, &resp); err != nil {
+		return "", fmt.Errorf("korti milli refund: %w", err)
+	}
+	if resp.ErrorCode != "" && resp.ErrorCode != "0" {
+		return "", fmt.Errorf("korti milli refund: %s %s", resp.ErrorCode, resp.ErrorMsg)
+	}
+	return resp.RefundID, nil
+}
+
+// sign returns hex(SHA-256("f1;f2;...;secret")).
+func (p *KortiMilliProvider) sign(fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append(fields, p.Secret), ";")))
+	return hex.EncodeToString(sum[:])
+}
+
+// verify checks a callback signature, which covers terminal_id;order_id;order_number;amount;status;rrn.
+func (p *KortiMilliProvider) verify(s kortiMilliOrderStatus) bool {
+	if s.Sign == "" {
+		return false
+	}
+	expected := p.sign(s.TerminalID, s.OrderID, s.OrderNumber, strconv.FormatInt(s.Amount, 10), s.Status, s.RRN)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(s.Sign))) == 1
+}
+
+func (p *KortiMilliProvider) post(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// kortiMilliStatus maps Korti Milli order states onto our payment statuses.
+func kortiMilliStatus(s string) string {
+	switch strings.ToUpper(s) {
+	case "DEPOSITED", "APPROVED":
+		return domain.PaymentStatusSuccess
+	case "DECLINED", "CANCELED", "EXPIRED", "REVERSED":
+		return domain.PaymentStatusFailed
+	default:
+		return domain.PaymentStatusPending
+	}
+}
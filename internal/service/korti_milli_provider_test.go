@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/schooltj/internal/domain"
+)
+
+// kortiMilliStandIn is a local stand-in for the Korti Milli API.
+func kortiMilliStandIn(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) *KortiMilliProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s", r.Method)
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return NewKortiMilliProvider("term-1", "km-secret", srv.URL, "https://school.tj/api/payments/webhook/korti_milli", "https://school.tj/return")
+}
+
+func TestKortiMilliInitiatePayment(t *testing.T) {
+	var p *KortiMilliProvider
+	p = kortiMilliStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orders/register" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		var req kortiMilliRegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.TerminalID != "term-1" || req.OrderNumber != "pay-1" || req.Amount != 15050 || req.Currency != "972" {
+			t.Errorf("register request %+v", req)
+		}
+		if want := p.sign("term-1", "pay-1", "15050", "972"); req.Sign != want {
+			t.Errorf("sign = %q, want %q", req.Sign, want)
+		}
+		json.NewEncoder(w).Encode(kortiMilliRegisterResponse{OrderID: "km-1", FormURL: "https://ecom.kortimilli.tj/form/km-1"})
+	})
+
+	redirect, orderID, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 150.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect != "https://ecom.kortimilli.tj/form/km-1" || orderID != "km-1" {
+		t.Fatalf("got %q, %q", redirect, orderID)
+	}
+}
+
+func TestKortiMilliInitiatePaymentError(t *testing.T) {
+	p := kortiMilliStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(kortiMilliRegisterResponse{ErrorCode: "5", ErrorMsg: "access denied"})
+	})
+	if _, _, err := p.InitiatePayment(context.Background(), &domain.Payment{ID: "pay-1", Amount: 10}); err == nil {
+		t.Fatal("expected an error for a gateway error code")
+	}
+}
+
+func TestKortiMilliGetStatus(t *testing.T) {
+	tests := []struct {
+		km   string
+		want string
+	}{
+		{"DEPOSITED", domain.PaymentStatusSuccess},
+		{"approved", domain.PaymentStatusSuccess},
+		{"DECLINED", domain.PaymentStatusFailed},
+		{"REVERSED", domain.PaymentStatusFailed},
+		{"CREATED", domain.PaymentStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.km, func(t *testing.T) {
+			var p *KortiMilliProvider
+			p = kortiMilliStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/orders/status" {
+					t.Errorf("path %s", r.URL.Path)
+				}
+				var req kortiMilliStatusRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if req.OrderID != "km-1" || req.Sign != p.sign("term-1", "km-1") {
+					t.Errorf("status request %+v", req)
+				}
+				json.NewEncoder(w).Encode(kortiMilliOrderStatus{TerminalID: "term-1", OrderID: "km-1", Status: tt.km, Amount: 15050})
+			})
+			got, amount, err := p.GetStatus(context.Background(), "km-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || amount != 150.50 {
+				t.Fatalf("status %q for %v, want %q for 150.50", got, amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestKortiMilliHandleCallback(t *testing.T) {
+	p := NewKortiMilliProvider("term-1", "km-secret", "", "", "")
+	callback := func(status kortiMilliOrderStatus, secret string) []byte {
+		signer := &KortiMilliProvider{Secret: secret}
+		status.Sign = signer.sign(status.TerminalID, status.OrderID, status.OrderNumber, strconv.FormatInt(status.Amount, 10), status.Status, status.RRN)
+		body, _ := json.Marshal(status)
+		return body
+	}
+	paid := kortiMilliOrderStatus{TerminalID: "term-1", OrderID: "km-1", OrderNumber: "pay-1", Amount: 15050, Status: "DEPOSITED", RRN: "123456"}
+
+	orderID, status, amount, err := p.HandleCallback(context.Background(), callback(paid, "km-secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orderID != "km-1" || status != domain.PaymentStatusSuccess || amount != 150.50 {
+		t.Fatalf("got %q, %q, %v", orderID, status, amount)
+	}
+
+	if _, _, _, err := p.HandleCallback(context.Background(), callback(paid, "wrong-secret"), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong key: err %v, want ErrInvalidSignature", err)
+	}
+	unsigned, _ := json.Marshal(paid)
+	if _, _, _, err := p.HandleCallback(context.Background(), unsigned, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned: err %v, want ErrInvalidSignature", err)
+	}
+	// Changing a signed field after signing breaks the signature.
+	var tampered kortiMilliOrderStatus
+	json.Unmarshal(callback(paid, "km-secret"), &tampered)
+	tampered.Amount = 1
+	body, _ := json.Marshal(tampered)
+	if _, _, _, err := p.HandleCallback(context.Background(), body, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered: err %v, want ErrInvalidSignature", err)
+	}
+	other := paid
+	other.TerminalID = "term-2"
+	if _, _, _, err := p.HandleCallback(context.Background(), callback(other, "km-secret"), nil); err == nil {
+		t.Error("callback for another terminal accepted")
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// ErrManualPayment is returned when an online operation is attempted on an offline method.
+var ErrManualPayment = errors.New("manual payment methods cannot be processed online")
+
+// ManualProvider stands in for offline methods (cash, card terminal, bank transfer)
+// so they can go through the same PaymentProvider calls as gateways.
+// Money for these methods is handed back in person, so Refund only records it.
+type ManualProvider struct {
+	method   string
+	payments *repository.PaymentRepository
+}
+
+func NewManualProvider(method string, payments *repository.PaymentRepository) *ManualProvider {
+	return &ManualProvider{method: method, payments: payments}
+}
+
+func (p *ManualProvider) Name() string {
+	return p.method
+}
+
+func (p *ManualProvider) InitiatePayment(ctx context.Context, pay *domain.Payment) (string, string, error) {
+	return "", "", ErrManualPayment
+}
+
+func (p *ManualProvider) HandleCallback(ctx context.Context, body []byte, header http.Header) (string, string, float64, error) {
+	return "", "", 0, fmt.Errorf("%w: %s has no callbacks", ErrUnknownProvider, p.method)
+}
+
+// GetStatus returns the status and amount on record: no gateway assigns manual payments
+// an ID, so providerID is the payment's own ID.
+func (p *ManualProvider) GetStatus(ctx context.Context, providerID string) (string, float64, error) {
+	payment, err := p.payments.GetByID(ctx, providerID)
+	if err != nil {
+		return "", 0, err
+	}
+	return payment.Status, payment.Amount, nil
+}
+
+func (p *ManualProvider) Refund(ctx context.Context, pay *domain.Payment, amount float64, reason string) (string, error) {
+	return "", nil
+}
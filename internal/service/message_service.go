@@ -2,20 +2,36 @@ package service
 
 import (
 	"context"
+	"errors"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
+var ErrMessageRecipientNotAllowed = errors.New("parents can only message their children's teachers")
+
 type MessageService struct {
-	repo *repository.MessageRepository
+	repo         *repository.MessageRepository
+	guardianRepo *repository.GuardianRepository
 }
 
-func NewMessageService(repo *repository.MessageRepository) *MessageService {
-	return &MessageService{repo: repo}
+func NewMessageService(repo *repository.MessageRepository, guardianRepo *repository.GuardianRepository) *MessageService {
+	return &MessageService{repo: repo, guardianRepo: guardianRepo}
 }
 
-func (s *MessageService) Send(ctx context.Context, m *domain.Message) error {
+// Send delivers a message from the actor. Parents may only write to someone who teaches
+// one of their children.
+func (s *MessageService) Send(ctx context.Context, actor Actor, m *domain.Message) error {
+	m.FromUserID = actor.UserID
+	if actor.Role == domain.RoleParent {
+		ok, err := s.guardianRepo.TeachesChildOf(ctx, actor.UserID, m.ToUserID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrMessageRecipientNotAllowed
+		}
+	}
 	return s.repo.Send(ctx, m)
 }
 
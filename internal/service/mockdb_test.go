@@ -0,0 +1,76 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+)
+
+// newMockDB returns a database that answers with the test's expected queries, in order,
+// and checks when the test ends that each of them ran.
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+// expectUser answers UserRepository's lookup of u by ID.
+func expectUser(mock sqlmock.Sqlmock, u domain.User) {
+	expectUserBy(mock, "id", u.ID, u)
+}
+
+// expectUserBy answers UserRepository's lookup of u by the column's value.
+func expectUserBy(mock sqlmock.Sqlmock, column, value string, u domain.User) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, email, email_verified_at, .* FROM users WHERE ` + column + ` = \?`).
+		WithArgs(value).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "email", "email_verified_at", "email_verification_assumed", "phone", "phone_verified_at", "name", "password_hash",
+			"role", "avatar_url", "rating_avg", "rating_count", "suspended_at", "suspension_reason", "created_at", "updated_at",
+		}).AddRow(
+			u.ID, u.Email, orNull(u.EmailVerifiedAt), u.EmailAssumed, orNull(u.Phone), orNull(u.PhoneVerifiedAt), u.Name, u.PasswordHash,
+			string(u.Role), orNull(u.AvatarURL), u.RatingAvg, u.RatingCount, orNull(u.SuspendedAt), u.SuspensionReason, created, created,
+		))
+}
+
+// expectCourse answers CourseRepository's lookup of c by ID.
+func expectCourse(mock sqlmock.Sqlmock, c domain.Course) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var schedule []byte
+	if c.Schedule != nil {
+		schedule, _ = json.Marshal(c.Schedule)
+	}
+	mock.ExpectQuery(`FROM courses c .* WHERE c\.id = \?`).
+		WithArgs(c.ID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "title", "description", "schedule", "school_id", "teacher_id", "price", "currency", "billing_cycle", "cover_image_url", "language",
+			"category_id", "category_name", "difficulty", "created_at", "updated_at", "teacher_name", "teacher_email", "avatar_url", "school_name",
+			"branch_id", "branch_name", "max_students", "rating_avg", "rating_count",
+		}).AddRow(
+			c.ID, c.Title, c.Description, schedule, orNull(c.SchoolID), orNull(c.TeacherID), c.Price, c.Currency, c.BillingCycle, nil, c.Language,
+			nil, nil, c.Difficulty, created, created, "Teacher", "", nil, "",
+			orNull(c.BranchID), c.BranchName, orNull(c.MaxStudents), c.RatingAvg, c.RatingCount,
+		))
+}
+
+// orNull is the column value of an optional field.
+func orNull[T any](p *T) driver.Value {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrOIDCEmailUnverified   = errors.New("the sign-in provider has not verified this email address")
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists; sign in with its password and confirm the email before using this provider")
+	ErrInvalidSignupToken    = errors.New("sign-up has expired, sign in with the provider again")
+	ErrSignupRoleNotAllowed  = errors.New("choose student, teacher, parent or school_admin")
+)
+
+const (
+	OIDCLoginExpiry  = 10 * time.Minute // how long the user has to come back from the provider
+	oidcSignupExpiry = 10 * time.Minute // how long a first-time user has to pick a role
+)
+
+// signupRoles are the roles a new account may pick, whether it registers with a password or
+// through a provider.
+var signupRoles = map[domain.Role]bool{
+	domain.RoleStudent:     true,
+	domain.RoleTeacher:     true,
+	domain.RoleParent:      true,
+	domain.RoleSchoolAdmin: true,
+}
+
+func (s *AuthService) oidcProvider(name string) (*OIDCProvider, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	return p, nil
+}
+
+// OIDCProviders lists the names of the configured sign-in providers.
+func (s *AuthService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginOIDCLogin starts signing in with a provider and returns the URL to send the browser
+// to and the state the provider will send back. The nonce and PKCE verifier are kept
+// server-side until the callback; the caller should tie the state to the browser.
+func (s *AuthService) BeginOIDCLogin(ctx context.Context, providerName string) (string, string, error) {
+	p, err := s.oidcProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := newSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	url, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.identities.CreateLoginState(ctx, hashToken(state), p.Name, nonce, verifier, time.Now().Add(OIDCLoginExpiry)); err != nil {
+		return "", "", err
+	}
+	return url, state, nil
+}
+
+// CompleteOIDCLogin finishes signing in with the code and state the provider sent back.
+// An identity already linked signs in as its user. Otherwise an existing account with the
+// same email is linked when both sides have verified the address, and anyone else gets a
+// signup token to create an account with CompleteOIDCSignup.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, providerName, code, state string, device SessionDevice) (*domain.AuthTokens, error) {
+	p, err := s.oidcProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" || state == "" {
+		return nil, repository.ErrLoginStateInvalid
+	}
+	stateProvider, nonce, verifier, err := s.identities.ConsumeLoginState(ctx, hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if stateProvider != p.Name {
+		return nil, repository.ErrLoginStateInvalid
+	}
+	claims, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+
+	userID, err := s.identities.GetUserID(ctx, p.Name, claims.Subject)
+	if err == nil {
+		user, err := s.repo.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.identities.RecordLogin(ctx, p.Name, claims.Subject, email); err != nil {
+			return nil, err
+		}
+		return s.completeLogin(ctx, user, device)
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err == nil {
+		// Linking on an unconfirmed address would let whoever typed it at registration
+		// take over the provider's account, or the other way round.
+		if !ownerConfirmedEmail(user) {
+			return nil, ErrOIDCAccountUnverified
+		}
+		if err := s.linkIdentity(ctx, user, p.Name, claims.Subject, email, device); err != nil {
+			return nil, err
+		}
+		return s.completeLogin(ctx, user, device)
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":      "oidc_signup",
+		"provider": p.Name,
+		"sub":      claims.Subject,
+		"email":    email,
+		"name":     claims.Name,
+		"picture":  claims.Picture,
+		"exp":      time.Now().Add(oidcSignupExpiry).Unix(),
+	})
+	tokenString, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AuthTokens{
+		SignupRequired: true,
+		SignupToken:    tokenString,
+		SignupEmail:    email,
+		SignupName:     claims.Name,
+	}, nil
+}
+
+// CompleteOIDCSignup creates the account for a first sign-in with a provider once the user
+// has picked a role, links the provider's account to it and signs in.
+func (s *AuthService) CompleteOIDCSignup(ctx context.Context, signupToken string, role domain.Role, device SessionDevice) (*domain.AuthTokens, error) {
+	claims, err := s.parseToken(signupToken)
+	if err != nil {
+		return nil, ErrInvalidSignupToken
+	}
+	providerName, _ := claims["provider"].(string)
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	picture, _ := claims["picture"].(string)
+	if typ, _ := claims["typ"].(string); typ != "oidc_signup" || subject == "" || email == "" {
+		return nil, ErrInvalidSignupToken
+	}
+	if _, err := s.oidcProvider(providerName); err != nil {
+		return nil, err
+	}
+	if !signupRoles[role] {
+		return nil, ErrSignupRoleNotAllowed
+	}
+
+	// The token may be replayed, or the email registered, while the user picked a role;
+	// CreateVerifiedAccount catches the latter.
+	if _, err := s.identities.GetUserID(ctx, providerName, subject); err == nil {
+		return nil, ErrInvalidSignupToken
+	} else if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// The account has no usable password until the user sets one with a password reset.
+	password, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.CreateVerifiedAccount(ctx, email, name, password, role)
+	if err != nil {
+		return nil, err
+	}
+	if picture != "" {
+		if err := s.repo.UpdateAvatarURL(ctx, user.ID, &picture); err != nil {
+			log.Printf("[AuthService.CompleteOIDCSignup] failed to set avatar for %s: %v", user.ID, err)
+		}
+	}
+	if err := s.linkIdentity(ctx, user, providerName, subject, email, device); err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, device)
+}
+
+// linkIdentity lets the provider's account sign in as the user and records it in the audit log.
+func (s *AuthService) linkIdentity(ctx context.Context, user *domain.User, provider, subject, email string, device SessionDevice) error {
+	identity := &domain.UserIdentity{UserID: user.ID, Provider: provider, Subject: subject, Email: email}
+	if err := s.identities.Link(ctx, identity); err != nil {
+		return err
+	}
+	if err := s.identities.RecordLogin(ctx, provider, subject, email); err != nil {
+		return err
+	}
+	entry := &domain.AuditEntry{
+		ActorUserID: &user.ID,
+		Action:      domain.AuditIdentityLinked,
+		TargetType:  "user",
+		TargetID:    user.ID,
+		IPAddress:   device.IP,
+		Details:     provider,
+	}
+	if err := s.audit.Create(ctx, entry); err != nil {
+		log.Printf("[AuthService.linkIdentity] failed to audit %s link for %s: %v", provider, user.ID, err)
+	}
+	return nil
+}
+
+// ListIdentities returns the provider accounts that can sign in as the user.
+func (s *AuthService) ListIdentities(ctx context.Context, userID string) ([]domain.UserIdentity, error) {
+	return s.identities.ListByUser(ctx, userID)
+}
+
+// ownerConfirmedEmail reports whether the user has proven they own their address, which
+// accounts whose verification was only assumed have not.
+func ownerConfirmedEmail(user *domain.User) bool {
+	return user.EmailVerifiedAt != nil && !user.EmailAssumed
+}
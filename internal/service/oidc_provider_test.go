@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/schooltj/internal/domain"
+)
+
+// fakeIssuer is a local OpenID Connect provider: it serves a discovery document, its
+// signing keys and a token endpoint that returns whatever ID token the test sets up.
+type fakeIssuer struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey
+	verifier string // the PKCE verifier the token endpoint expects
+	idToken  func(issuer string) string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                f.srv.URL,
+			AuthorizationEndpoint: f.srv.URL + "/authorize",
+			TokenEndpoint:         f.srv.URL + "/token",
+			JWKSURI:               f.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kid: "key-1",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "code-1" ||
+			r.PostForm.Get("client_id") != "client-1" || r.PostForm.Get("client_secret") != "secret-1" {
+			t.Errorf("token request %v", r.PostForm)
+		}
+		if r.PostForm.Get("code_verifier") != f.verifier {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken(f.srv.URL)})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider("fake", f.srv.URL, "client-1", "secret-1", "https://school.tj/auth/callback")
+}
+
+// signIDToken signs claims as an ID token with the given key and key ID.
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.Claims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func validClaims(issuer string) *OIDCClaims {
+	now := time.Now()
+	return &OIDCClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "sub-1",
+			Audience:  jwt.ClaimStrings{"client-1"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		Nonce:         "nonce-1",
+		Email:         "dilshod@example.com",
+		EmailVerified: true,
+	}
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	f := newFakeIssuer(t)
+	raw, err := f.provider().AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/authorize" {
+		t.Errorf("path %s", u.Path)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client-1",
+		"redirect_uri":          "https://school.tj/auth/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        pkceChallenge("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.verifier = "verifier-1"
+	f.idToken = func(issuer string) string { return signIDToken(t, f.key, "key-1", validClaims(issuer)) }
+
+	claims, err := f.provider().Exchange(context.Background(), "code-1", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "sub-1" || claims.Email != "dilshod@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("claims %+v", claims)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.verifier = "verifier-1"
+	f.idToken = func(issuer string) string { return signIDToken(t, f.key, "key-1", validClaims(issuer)) }
+
+	if _, err := f.provider().Exchange(context.Background(), "code-1", "someone-else", "nonce-1"); err == nil {
+		t.Fatal("expected an error when the token endpoint refuses the verifier")
+	}
+}
+
+func TestOIDCExchangeRejectsBadIDTokens(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		idToken func(t *testing.T, f *fakeIssuer, issuer string) string
+	}{
+		{"wrong nonce", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			c := validClaims(issuer)
+			c.Nonce = "nonce-2"
+			return signIDToken(t, f.key, "key-1", c)
+		}},
+		{"wrong audience", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			c := validClaims(issuer)
+			c.Audience = jwt.ClaimStrings{"client-2"}
+			return signIDToken(t, f.key, "key-1", c)
+		}},
+		{"wrong issuer", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			return signIDToken(t, f.key, "key-1", validClaims("https://evil.example.com"))
+		}},
+		{"expired", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			c := validClaims(issuer)
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Minute))
+			return signIDToken(t, f.key, "key-1", c)
+		}},
+		{"signed by another key", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			return signIDToken(t, other, "key-1", validClaims(issuer))
+		}},
+		{"unknown key ID", func(t *testing.T, f *fakeIssuer, issuer string) string {
+			return signIDToken(t, f.key, "key-2", validClaims(issuer))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			f.verifier = "verifier-1"
+			f.idToken = func(issuer string) string { return tt.idToken(t, f, issuer) }
+
+			_, err := f.provider().Exchange(context.Background(), "code-1", "verifier-1", "nonce-1")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOwnerConfirmedEmail(t *testing.T) {
+	verified := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		user domain.User
+		want bool
+	}{
+		{"confirmed", domain.User{EmailVerifiedAt: &verified}, true},
+		{"unverified", domain.User{}, false},
+		{"assumed when verification was introduced", domain.User{EmailVerifiedAt: &verified, EmailAssumed: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownerConfirmedEmail(&tt.user); got != tt.want {
+				t.Fatalf("ownerConfirmedEmail = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
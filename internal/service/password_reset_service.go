@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordTooShort = errors.New("password must be at least 6 characters")
+
+// PasswordResetService runs the forgot-password flow: a single-use link is emailed to
+// the user and trading it in sets a new password and signs out every session.
+type PasswordResetService struct {
+	userRepo    *repository.UserRepository
+	resetRepo   *repository.PasswordResetRepository
+	sessionRepo *repository.SessionRepository
+	email       *EmailService
+	appURL      string
+	tokenExpiry time.Duration
+}
+
+// NewPasswordResetService builds the service. appURL is the web app's base URL, which
+// serves the page the emailed link opens.
+func NewPasswordResetService(userRepo *repository.UserRepository, resetRepo *repository.PasswordResetRepository, sessionRepo *repository.SessionRepository, email *EmailService, appURL string) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:    userRepo,
+		resetRepo:   resetRepo,
+		sessionRepo: sessionRepo,
+		email:       email,
+		appURL:      strings.TrimRight(appURL, "/"),
+		tokenExpiry: time.Hour,
+	}
+}
+
+// RequestReset emails a reset link if an account uses the address. Unknown addresses are
+// not an error, so callers cannot tell whether an account exists.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := newSecureToken()
+	if err != nil {
+		return err
+	}
+	if err := s.resetRepo.Create(ctx, user.ID, hashToken(token), time.Now().Add(s.tokenExpiry)); err != nil {
+		return err
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(token)
+	s.email.SendPasswordReset(user.Email, user.Name, link, s.tokenExpiry)
+	return nil
+}
+
+// SetPasswordLink returns a single-use link for an account created on someone's behalf to
+// choose its first password. It works like a reset link but stays valid for validFor.
+func (s *PasswordResetService) SetPasswordLink(ctx context.Context, userID string, validFor time.Duration) (string, error) {
+	token, err := newSecureToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.resetRepo.Create(ctx, userID, hashToken(token), time.Now().Add(validFor)); err != nil {
+		return "", err
+	}
+	return s.appURL + "/reset-password?token=" + url.QueryEscape(token), nil
+}
+
+// ResetPassword sets a new password using an emailed token and signs the user out everywhere.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < 6 {
+		return ErrPasswordTooShort
+	}
+	if token == "" {
+		return repository.ErrResetTokenInvalid
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	userID, err := s.resetRepo.ResetPassword(ctx, hashToken(token), string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeAll(ctx, userID, "")
+}
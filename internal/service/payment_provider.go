@@ -2,10 +2,19 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net/http"
 
 	"github.com/schooltj/internal/domain"
 )
 
+var (
+	// ErrInvalidSignature is returned when a provider callback fails signature verification.
+	ErrInvalidSignature = errors.New("invalid callback signature")
+	// ErrUnknownProvider is returned when no gateway is registered under the requested name.
+	ErrUnknownProvider = errors.New("unknown payment provider")
+)
+
 // PaymentProvider defines the interface for external payment gateways.
 type PaymentProvider interface {
 	// Name returns the provider identifier (e.g., "alif", "humo").
@@ -15,11 +24,17 @@ type PaymentProvider interface {
 	// and a unique transaction ID from the provider.
 	InitiatePayment(ctx context.Context, p *domain.Payment) (redirectURL string, providerID string, err error)
 
-	// Callback handles the provider's notification (webhook).
-	// It returns the provider's transaction ID and the new status.
-	// Note: The specific payload handling might need a more flexible approach depending on the provider.
-	HandleCallback(ctx context.Context, payload interface{}) (providerID string, status string, err error)
+	// HandleCallback verifies the provider's notification (webhook) against its signature
+	// and returns the provider's transaction ID, the new status and the amount the provider
+	// reports for the transaction, in the payment's currency (0 if it reports none).
+	// The raw body is passed as-is because signatures are computed over the exact bytes sent.
+	HandleCallback(ctx context.Context, body []byte, header http.Header) (providerID string, status string, amount float64, err error)
+
+	// GetStatus checks the current status of a payment by its provider ID, and the amount
+	// the provider reports for it in the payment's currency (0 if it reports none).
+	GetStatus(ctx context.Context, providerID string) (status string, amount float64, err error)
 
-	// GetStatus checks the current status of a payment by its provider ID.
-	GetStatus(ctx context.Context, providerID string) (status string, err error)
+	// Refund returns amount (in the payment's currency) to the payer and returns the
+	// provider's refund reference. An error means no money was moved.
+	Refund(ctx context.Context, p *domain.Payment, amount float64, reason string) (refundID string, err error)
 }
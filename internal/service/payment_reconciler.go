@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PaymentReconciler periodically settles external payments whose webhook never arrived,
+// and refunds whose provider answer was never recorded.
+type PaymentReconciler struct {
+	*periodic
+	payments    *PaymentService
+	staleAfter  time.Duration
+	expireAfter time.Duration
+}
+
+func NewPaymentReconciler(payments *PaymentService, interval, staleAfter, expireAfter time.Duration) *PaymentReconciler {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	if staleAfter <= 0 {
+		staleAfter = 15 * time.Minute
+	}
+	if expireAfter < staleAfter {
+		expireAfter = 24 * time.Hour
+	}
+	r := &PaymentReconciler{
+		payments:    payments,
+		staleAfter:  staleAfter,
+		expireAfter: expireAfter,
+	}
+	r.periodic = newPeriodic("Payment reconciler", interval, r.runOnce)
+	return r
+}
+
+func (r *PaymentReconciler) runOnce(ctx context.Context) {
+	changes, err := r.payments.ReconcilePending(ctx, r.staleAfter, r.expireAfter)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[PaymentReconciler] error: %v", err)
+		}
+		return
+	}
+	if len(changes) > 0 {
+		log.Printf("[PaymentReconciler] updated %d pending payments", len(changes))
+	}
+
+	refunds, err := r.payments.ReconcileRefunds(ctx, r.staleAfter)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[PaymentReconciler] refunds error: %v", err)
+		}
+		return
+	}
+	if refunds > 0 {
+		log.Printf("[PaymentReconciler] settled %d pending refunds", refunds)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// fakeGateway answers status checks from tables of external IDs; IDs missing from
+// statuses cannot be reached. It records the refunds it is asked for and rejects them all
+// if refundErr is set.
+type fakeGateway struct {
+	statuses  map[string]string
+	captured  map[string]float64
+	refunds   []float64
+	refundErr error
+}
+
+func (g *fakeGateway) Name() string { return domain.PaymentMethodAlif }
+
+func (g *fakeGateway) InitiatePayment(ctx context.Context, p *domain.Payment) (string, string, error) {
+	return "", "", errors.New("not implemented")
+}
+
+func (g *fakeGateway) HandleCallback(ctx context.Context, body []byte, header http.Header) (string, string, float64, error) {
+	return "", "", 0, errors.New("not implemented")
+}
+
+func (g *fakeGateway) GetStatus(ctx context.Context, providerID string) (string, float64, error) {
+	status, ok := g.statuses[providerID]
+	if !ok {
+		return "", 0, errors.New("gateway unreachable")
+	}
+	return status, g.captured[providerID], nil
+}
+
+func (g *fakeGateway) Refund(ctx context.Context, p *domain.Payment, amount float64, reason string) (string, error) {
+	g.refunds = append(g.refunds, amount)
+	if g.refundErr != nil {
+		return "", g.refundErr
+	}
+	return "gw-refund", nil
+}
+
+// paymentRows answers PaymentRepository's payment lookups with ps.
+func paymentRows(ps ...domain.Payment) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "student_user_id", "student_name", "student_avatar", "course_id", "course_title", "section_id", "section_name",
+		"amount", "currency", "exchange_rate", "refunded_amount", "method", "status", "external_id", "note", "receipt_url",
+		"recorded_by", "recorded_by_name", "paid_at", "created_at"})
+	for _, p := range ps {
+		rows.AddRow(p.ID, p.StudentUserID, "Student", nil, p.CourseID, "Course", nil, "",
+			p.Amount, p.Currency, p.ExchangeRate, p.RefundedAmount, p.Method, p.Status, p.ExternalID, "", "",
+			"staff-1", "Staff", p.PaidAt, p.CreatedAt)
+	}
+	return rows
+}
+
+// expectNoPromoReservation answers a promo confirmation or release for a payment that reserved no code.
+func expectNoPromoReservation(mock sqlmock.Sqlmock, paymentID string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM promo_reservations WHERE payment_id = \? FOR UPDATE`).WithArgs(paymentID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+}
+
+func TestReconcilePending(t *testing.T) {
+	db, mock := newMockDB(t)
+	gateway := &fakeGateway{statuses: map[string]string{
+		"ext-paid":     domain.PaymentStatusSuccess,
+		"ext-declined": domain.PaymentStatusFailed,
+		"ext-waiting":  domain.PaymentStatusPending,
+		"ext-raced":    domain.PaymentStatusSuccess,
+		"ext-short":    domain.PaymentStatusSuccess,
+	}, captured: map[string]float64{
+		"ext-paid":  100,
+		"ext-raced": 100,
+		"ext-short": 60, // captured for less than the payment, and not settled
+	}}
+	s := NewPaymentService(&repository.PaymentRepository{DB: db}, nil, nil,
+		NewPricingService(&repository.PricingRepository{DB: db}, nil, nil, nil, nil), nil, nil, []PaymentProvider{gateway})
+
+	now := time.Now()
+	pending := func(id, externalID string, age time.Duration) domain.Payment {
+		return domain.Payment{ID: id, StudentUserID: "student-1", CourseID: "course-1", Amount: 100, Currency: domain.CurrencyTJS,
+			ExchangeRate: 1, Method: domain.PaymentMethodAlif, Status: domain.PaymentStatusPending, ExternalID: externalID, CreatedAt: now.Add(-age)}
+	}
+	mock.ExpectQuery(`WHERE p\.status = \? AND p\.created_at < \?`).WillReturnRows(paymentRows(
+		pending("paid", "ext-paid", time.Hour),
+		pending("declined", "ext-declined", time.Hour),
+		pending("waiting", "ext-waiting", time.Hour),
+		pending("waited-too-long", "ext-waiting", 48*time.Hour),
+		pending("never-started", "", 48*time.Hour),
+		pending("unreachable", "ext-down", time.Hour),
+		pending("raced", "ext-raced", time.Hour),
+		pending("short", "ext-short", 48*time.Hour),
+	))
+	checked := func(id string) {
+		mock.ExpectExec(`UPDATE payments SET last_checked_at = NOW\(\)`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	moved := func(id, externalID, status, reason string, applied bool) {
+		var n int64
+		if applied {
+			n = 1
+		}
+		mock.ExpectExec(`UPDATE payments SET status = \?, external_id = \?`).
+			WithArgs(status, externalID, id, domain.PaymentStatusPending).WillReturnResult(sqlmock.NewResult(0, n))
+		if !applied {
+			return
+		}
+		mock.ExpectExec(`INSERT INTO payment_reconciliations`).
+			WithArgs(sqlmock.AnyArg(), id, domain.PaymentMethodAlif, externalID, domain.PaymentStatusPending, status, reason).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectNoPromoReservation(mock, id)
+	}
+
+	checked("paid")
+	moved("paid", "ext-paid", domain.PaymentStatusSuccess, domain.ReconcileReasonProvider, true)
+	checked("declined")
+	moved("declined", "ext-declined", domain.PaymentStatusFailed, domain.ReconcileReasonProvider, true)
+	checked("waiting")
+	checked("waited-too-long")
+	moved("waited-too-long", "ext-waiting", domain.PaymentStatusFailed, domain.ReconcileReasonExpired, true)
+	checked("never-started")
+	moved("never-started", "", domain.PaymentStatusFailed, domain.ReconcileReasonExpired, true)
+	checked("unreachable")
+	checked("raced")
+	moved("raced", "ext-raced", domain.PaymentStatusSuccess, domain.ReconcileReasonProvider, false)
+	checked("short")
+
+	changes, err := s.ReconcilePending(context.Background(), 15*time.Minute, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.PaymentID+":"+c.NewStatus)
+	}
+	want := []string{"paid:success", "declined:failed", "waited-too-long:failed", "never-started:failed"}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", got, want)
+		}
+	}
+}
@@ -2,73 +2,308 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net/http"
 	"time"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
+var (
+	ErrPaymentNotFound  = errors.New("payment not found")
+	ErrPaymentForbidden = errors.New("you cannot manage this payment")
+	ErrRefundRejected   = errors.New("refund rejected by provider")
+	// ErrNotManualMethod is returned when staff record a payment under an online gateway.
+	ErrNotManualMethod = errors.New("only cash, card, bank transfer and other payments can be recorded")
+)
+
 type PaymentService struct {
 	repo      *repository.PaymentRepository
+	invoices  *InvoiceService
+	receipts  *ReceiptService
+	pricing   *PricingService
+	rates     *ExchangeRateService
+	policy    *Policy
 	providers map[string]PaymentProvider
 }
 
-func NewPaymentService(repo *repository.PaymentRepository, providers []PaymentProvider) *PaymentService {
+func NewPaymentService(repo *repository.PaymentRepository, invoices *InvoiceService, receipts *ReceiptService, pricing *PricingService, rates *ExchangeRateService, policy *Policy, providers []PaymentProvider) *PaymentService {
 	pMap := make(map[string]PaymentProvider)
 	for _, p := range providers {
 		pMap[p.Name()] = p
 	}
-	return &PaymentService{repo: repo, providers: pMap}
+	return &PaymentService{repo: repo, invoices: invoices, receipts: receipts, pricing: pricing, rates: rates, policy: policy, providers: pMap}
+}
+
+// settle redeems the promo code a settled payment reserved, applies the payment to the
+// student's open invoices and issues its receipt. Allocation and receipts can be redone
+// later (balances are recomputed on read, receipts are issued on first download), so
+// failures are only logged.
+func (s *PaymentService) settle(ctx context.Context, p *domain.Payment) {
+	if err := s.pricing.ConfirmPromoCode(ctx, p.ID); err != nil {
+		log.Printf("[PaymentService] redeem promo code for payment %s: %v", p.ID, err)
+	}
+	if s.invoices != nil {
+		if err := s.invoices.AllocatePayments(ctx, p.StudentUserID, p.CourseID); err != nil {
+			log.Printf("[PaymentService] allocate payment %s: %v", p.ID, err)
+		}
+	}
+	if s.receipts != nil {
+		if _, err := s.receipts.Issue(ctx, p.ID); err != nil && !errors.Is(err, ErrReceiptUnavailable) {
+			log.Printf("[PaymentService] issue receipt for payment %s: %v", p.ID, err)
+		}
+	}
+}
+
+// fail gives back the promo code use a failed or expired payment reserved.
+func (s *PaymentService) fail(ctx context.Context, paymentID string) {
+	if err := s.pricing.ReleasePromoCode(ctx, paymentID); err != nil {
+		log.Printf("[PaymentService] release promo code for payment %s: %v", paymentID, err)
+	}
 }
 
-func (s *PaymentService) InitiateExternalPayment(ctx context.Context, studentUserID, courseID, providerName string, amount float64) (string, error) {
+// InitiateExternalPayment starts an online checkout for the student's effective price of
+// the course. The payer is the student or, for studentUserID set to someone else, one of
+// their guardians. A promo code, if given, is held for the checkout and only redeemed for
+// the course once the payment settles.
+func (s *PaymentService) InitiateExternalPayment(ctx context.Context, payer Actor, studentUserID, courseID, providerName, promoCode string) (string, error) {
+	if studentUserID == "" {
+		studentUserID = payer.UserID
+	} else if studentUserID != payer.UserID {
+		if err := s.policy.Can(ctx, payer, ActionPayForStudent, StudentResource(studentUserID)); err != nil {
+			return "", err
+		}
+	}
 	provider, ok := s.providers[providerName]
 	if !ok {
-		return "", fmt.Errorf("provider %s not found", providerName)
+		return "", fmt.Errorf("%w: %s", ErrUnknownProvider, providerName)
+	}
+	if isManual(provider) {
+		return "", ErrManualPayment
+	}
+
+	quote, err := s.pricing.Quote(ctx, studentUserID, courseID, promoCode)
+	if err != nil {
+		return "", err
+	}
+	amount := quote.EffectivePrice
+	if amount <= 0 {
+		return "", errors.New("nothing to pay for this course")
+	}
+	now := time.Now()
+	rate, err := s.rates.RateAt(ctx, quote.Currency, now)
+	if err != nil {
+		return "", err
 	}
 
 	p := &domain.Payment{
 		StudentUserID: studentUserID,
 		CourseID:      courseID,
 		Amount:        amount,
+		Currency:      quote.Currency,
+		ExchangeRate:  rate,
 		Method:        providerName,
 		Status:        domain.PaymentStatusPending,
-		PaidAt:        time.Now(),
+		RecordedBy:    payer.UserID, // self-service: the payer initiates it
+		PaidAt:        now,
 	}
 
 	if err := s.repo.RecordPayment(ctx, p); err != nil {
 		return "", err
 	}
+	if promoCode != "" {
+		if err := s.pricing.ReservePromoCode(ctx, studentUserID, courseID, promoCode, p.ID); err != nil {
+			_, _ = s.repo.UpdateStatus(ctx, p.ID, domain.PaymentStatusFailed, "")
+			return "", err
+		}
+	}
 
 	redirectURL, externalID, err := provider.InitiatePayment(ctx, p)
 	if err != nil {
+		if failed, _ := s.repo.UpdateStatus(ctx, p.ID, domain.PaymentStatusFailed, ""); failed {
+			s.fail(ctx, p.ID)
+		}
 		return "", err
 	}
 
 	// Update with provider's internal ID
-	if err := s.repo.UpdateStatus(ctx, p.ID, domain.PaymentStatusPending, externalID); err != nil {
+	if _, err := s.repo.UpdateStatus(ctx, p.ID, domain.PaymentStatusPending, externalID); err != nil {
 		return "", err
 	}
 
 	return redirectURL, nil
 }
 
-func (s *PaymentService) ProcessWebhook(ctx context.Context, providerName string, payload interface{}) error {
+// ProcessWebhook verifies a provider callback and applies the reported status.
+// A payment that already settled is never moved back and is settled only once, so
+// replayed, concurrent or out-of-order callbacks are harmless. A success for another
+// amount than the payment's is logged and leaves the payment pending.
+func (s *PaymentService) ProcessWebhook(ctx context.Context, providerName string, body []byte, header http.Header) error {
 	provider, ok := s.providers[providerName]
 	if !ok {
-		return fmt.Errorf("provider %s not found", providerName)
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, providerName)
 	}
 
-	externalID, status, err := provider.HandleCallback(ctx, payload)
+	externalID, status, amount, err := provider.HandleCallback(ctx, body, header)
 	if err != nil {
 		return err
 	}
 
-	return s.repo.UpdateStatusByExternalID(ctx, externalID, status)
+	payment, err := s.repo.GetByExternalID(ctx, externalID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("payment with external id %s not found", externalID)
+		}
+		return err
+	}
+	if payment.Method != providerName {
+		return fmt.Errorf("payment %s does not belong to provider %s", payment.ID, providerName)
+	}
+	if payment.Status != domain.PaymentStatusPending || status == domain.PaymentStatusPending {
+		return nil
+	}
+	if status == domain.PaymentStatusSuccess && !capturedInFull(payment, amount) {
+		log.Printf("[PaymentService.ProcessWebhook] %s reported %.2f captured for payment %s of %.2f %s; left pending",
+			providerName, amount, payment.ID, payment.Amount, payment.Currency)
+		return nil
+	}
+
+	updated, err := s.repo.UpdateStatusByExternalID(ctx, externalID, status)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return nil
+	}
+	if status == domain.PaymentStatusSuccess {
+		s.settle(ctx, payment)
+	} else {
+		s.fail(ctx, payment.ID)
+	}
+	return nil
+}
+
+// capturedInFull reports whether amount, as a gateway reports it in the payment's
+// currency, is the payment's amount to the diram.
+func capturedInFull(p *domain.Payment, amount float64) bool {
+	return math.Round(amount*100) == math.Round(p.Amount*100)
+}
+
+// reconcileBatchSize caps how many stale payments one reconciliation pass handles.
+const reconcileBatchSize = 100
+
+// ReconcilePending asks providers about payments that have been pending longer than
+// staleAfter and applies the answer. Payments still unfinished after expireAfter are
+// marked failed; a payment the provider reports captured for another amount is left
+// pending. Each pass takes the payments asked about longest ago, so a payment whose
+// provider keeps failing to answer is retried after the others. It returns the changes it
+// made.
+func (s *PaymentService) ReconcilePending(ctx context.Context, staleAfter, expireAfter time.Duration) ([]domain.PaymentReconciliation, error) {
+	now := time.Now()
+	payments, err := s.repo.ListStalePending(ctx, now.Add(-staleAfter), reconcileBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []domain.PaymentReconciliation
+	for _, p := range payments {
+		if ctx.Err() != nil {
+			break
+		}
+		expired := now.Sub(p.CreatedAt) >= expireAfter
+		if err := s.repo.MarkChecked(ctx, p.ID); err != nil {
+			log.Printf("[PaymentService.ReconcilePending] mark payment %s checked: %v", p.ID, err)
+		}
+
+		newStatus, reason := domain.PaymentStatusPending, ""
+		provider, ok := s.providers[p.Method]
+		switch {
+		case !ok || p.ExternalID == "":
+			// Nothing to ask: the gateway never accepted the payment.
+			if expired {
+				newStatus, reason = domain.PaymentStatusFailed, domain.ReconcileReasonExpired
+			}
+		default:
+			status, amount, err := provider.GetStatus(ctx, p.ExternalID)
+			if err != nil {
+				log.Printf("[PaymentService.ReconcilePending] %s status for payment %s: %v", p.Method, p.ID, err)
+				continue
+			}
+			if status == domain.PaymentStatusSuccess && !capturedInFull(&p, amount) {
+				// Money moved, so the payment is neither settled nor expired; staff sort it out.
+				log.Printf("[PaymentService.ReconcilePending] %s reported %.2f captured for payment %s of %.2f %s; left pending",
+					p.Method, amount, p.ID, p.Amount, p.Currency)
+				continue
+			}
+			if status != domain.PaymentStatusPending {
+				newStatus, reason = status, domain.ReconcileReasonProvider
+			} else if expired {
+				newStatus, reason = domain.PaymentStatusFailed, domain.ReconcileReasonExpired
+			}
+		}
+		if newStatus == domain.PaymentStatusPending {
+			continue
+		}
+
+		updated, err := s.repo.UpdateStatus(ctx, p.ID, newStatus, p.ExternalID)
+		if err != nil {
+			log.Printf("[PaymentService.ReconcilePending] update payment %s: %v", p.ID, err)
+			continue
+		}
+		if !updated {
+			// A callback settled the payment while we were asking.
+			continue
+		}
+		rec := domain.PaymentReconciliation{
+			PaymentID:   p.ID,
+			Provider:    p.Method,
+			ExternalID:  p.ExternalID,
+			OldStatus:   p.Status,
+			NewStatus:   newStatus,
+			Reason:      reason,
+			StudentName: p.StudentName,
+			CourseTitle: p.CourseTitle,
+			Amount:      p.Amount,
+			CreatedAt:   now,
+		}
+		if err := s.repo.RecordReconciliation(ctx, &rec); err != nil {
+			log.Printf("[PaymentService.ReconcilePending] record change for payment %s: %v", p.ID, err)
+		}
+		if newStatus == domain.PaymentStatusSuccess {
+			s.settle(ctx, &p)
+		} else {
+			s.fail(ctx, p.ID)
+		}
+		changes = append(changes, rec)
+	}
+	return changes, nil
+}
+
+// ListReconciliations returns recent reconciler changes visible to the user. School staff
+// can narrow them to one branch; a branch manager only sees their own.
+func (s *PaymentService) ListReconciliations(ctx context.Context, actor Actor, limit int, branchID string) ([]domain.PaymentReconciliation, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	if s.policy.Can(ctx, actor, ActionRecordPayments, Platform()) == nil {
+		return s.repo.ListReconciliations(ctx, limit)
+	}
+	school, scope, err := s.policy.MemberScope(ctx, actor, ActionRecordPayments)
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		branchID = scope
+	}
+	return s.repo.ListReconciliationsBySchool(ctx, school.ID, branchID, limit)
 }
 
+// RecordPaymentInput is a manually recorded payment. Amount is in the course's currency.
 type RecordPaymentInput struct {
 	StudentUserID string  `json:"student_user_id"`
 	CourseID      string  `json:"course_id"`
@@ -79,10 +314,22 @@ type RecordPaymentInput struct {
 	PaidAt        string  `json:"paid_at"` // ISO format
 }
 
-// RecordPayment allows a teacher/admin to record a payment.
+// RecordPayment allows the course's staff, and the teacher of the student's section, to
+// record a payment made by one of the offline methods.
 func (s *PaymentService) RecordPayment(ctx context.Context, recordedBy string, role domain.Role, input RecordPaymentInput) (*domain.Payment, error) {
-	if role != domain.RoleTeacher && role != domain.RoleSchoolAdmin {
-		return nil, errors.New("only teachers and admins can record payments")
+	if !isManual(s.providers[input.Method]) {
+		return nil, ErrNotManualMethod
+	}
+	sectionID, err := s.repo.StudentSection(ctx, input.CourseID, input.StudentUserID)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := s.policy.CourseOrSection(ctx, input.CourseID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, Actor{UserID: recordedBy, Role: role}, ActionRecordPayments, resource); err != nil {
+		return nil, err
 	}
 	if input.Amount <= 0 {
 		return nil, errors.New("amount must be positive")
@@ -93,10 +340,24 @@ func (s *PaymentService) RecordPayment(ctx context.Context, recordedBy string, r
 		paidAt = time.Now()
 	}
 
+	currency, err := s.repo.CourseCurrency(ctx, input.CourseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrCourseNotFound
+		}
+		return nil, err
+	}
+	rate, err := s.rates.RateAt(ctx, currency, paidAt)
+	if err != nil {
+		return nil, err
+	}
+
 	p := &domain.Payment{
 		StudentUserID: input.StudentUserID,
 		CourseID:      input.CourseID,
 		Amount:        input.Amount,
+		Currency:      currency,
+		ExchangeRate:  rate,
 		Method:        input.Method,
 		Note:          input.Note,
 		ReceiptURL:    input.ReceiptURL,
@@ -107,19 +368,199 @@ func (s *PaymentService) RecordPayment(ctx context.Context, recordedBy string, r
 	if err := s.repo.RecordPayment(ctx, p); err != nil {
 		return nil, err
 	}
+	s.settle(ctx, p)
 	return p, nil
 }
 
-// ListPayments returns payments scoped to the user's role.
-func (s *PaymentService) ListPayments(ctx context.Context, userID string, role domain.Role, courseID string) ([]domain.Payment, error) {
+type RefundInput struct {
+	Amount float64 `json:"amount"` // 0 refunds the remaining balance
+	Reason string  `json:"reason"`
+}
+
+// RefundPayment returns money on a settled payment through the provider it was paid with.
+// The refund is reserved before the provider is called, so a failed provider call
+// or a concurrent refund can never push the total above the paid amount.
+func (s *PaymentService) RefundPayment(ctx context.Context, userID string, role domain.Role, paymentID string, input RefundInput) (*domain.Refund, error) {
+	if input.Amount < 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	payment, err := s.repo.GetByID(ctx, paymentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	if err := s.canManage(ctx, userID, role, payment); err != nil {
+		return nil, err
+	}
+
+	provider, err := s.refundProvider(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := &domain.Refund{
+		PaymentID: payment.ID,
+		Amount:    input.Amount,
+		Reason:    input.Reason,
+		CreatedBy: userID,
+	}
+	if err := s.repo.ReserveRefund(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	externalID, err := provider.Refund(ctx, payment, refund.Amount, refund.Reason)
+	if err != nil {
+		if ferr := s.repo.FailRefund(ctx, refund); ferr != nil {
+			log.Printf("[PaymentService.RefundPayment] release refund %s: %v", refund.ID, ferr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRefundRejected, err)
+	}
+	completed, err := s.repo.CompleteRefund(ctx, refund.ID, externalID)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		log.Printf("[PaymentService.RefundPayment] refund %s (provider reference %q) was settled by the reconciler first", refund.ID, externalID)
+	}
+	refund.Status = domain.RefundStatusSuccess
+	refund.ExternalID = externalID
+	refund.CreatedAt = time.Now()
+	s.releaseInvoices(ctx, payment)
+	return refund, nil
+}
+
+// refundProvider returns the provider that hands back a payment's money. A payment no
+// gateway ever took, such as one recorded by staff, has no external ID and is refunded in
+// person whatever its method says.
+func (s *PaymentService) refundProvider(p *domain.Payment) (PaymentProvider, error) {
+	if p.ExternalID == "" {
+		if provider, manual := s.providers[p.Method].(*ManualProvider); manual {
+			return provider, nil
+		}
+		return NewManualProvider(p.Method, s.repo), nil
+	}
+	provider, ok := s.providers[p.Method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, p.Method)
+	}
+	return provider, nil
+}
+
+// isManual reports whether the provider stands in for an offline method.
+func isManual(p PaymentProvider) bool {
+	_, manual := p.(*ManualProvider)
+	return manual
+}
+
+// releaseInvoices reopens the invoices a refunded payment had settled.
+func (s *PaymentService) releaseInvoices(ctx context.Context, payment *domain.Payment) {
+	if s.invoices != nil {
+		if err := s.invoices.ReleasePayment(ctx, payment); err != nil {
+			log.Printf("[PaymentService] release invoices for payment %s: %v", payment.ID, err)
+		}
+	}
+}
+
+// ReconcileRefunds settles refunds left pending for longer than staleAfter, which means
+// the server stopped between reserving a refund and recording the provider's answer.
+// Manual refunds cannot fail, so they are completed. A gateway's answer is lost and
+// asking again could return the money twice, so the refund is marked failed, releasing
+// its amount, and logged for staff to check with the gateway before refunding again.
+// It returns how many refunds it settled.
+func (s *PaymentService) ReconcileRefunds(ctx context.Context, staleAfter time.Duration) (int, error) {
+	refunds, err := s.repo.ListStalePendingRefunds(ctx, time.Now().Add(-staleAfter), reconcileBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for i := range refunds {
+		ref := &refunds[i]
+		if ctx.Err() != nil {
+			break
+		}
+		payment, err := s.repo.GetByID(ctx, ref.PaymentID)
+		if err != nil {
+			log.Printf("[PaymentService.ReconcileRefunds] payment of refund %s: %v", ref.ID, err)
+			continue
+		}
+		if provider, err := s.refundProvider(payment); err == nil && isManual(provider) {
+			completed, err := s.repo.CompleteRefund(ctx, ref.ID, "")
+			if err != nil {
+				log.Printf("[PaymentService.ReconcileRefunds] complete refund %s: %v", ref.ID, err)
+				continue
+			}
+			if completed {
+				s.releaseInvoices(ctx, payment)
+				settled++
+			}
+			continue
+		}
+		if err := s.repo.FailRefund(ctx, ref); err != nil {
+			log.Printf("[PaymentService.ReconcileRefunds] fail refund %s: %v", ref.ID, err)
+			continue
+		}
+		if ref.Status == domain.RefundStatusFailed {
+			log.Printf("[PaymentService.ReconcileRefunds] %s never answered refund %s of %.2f on payment %s; marked failed, check with the gateway",
+				payment.Method, ref.ID, ref.Amount, payment.ID)
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// ListRefunds returns the refunds of a payment the user may manage.
+func (s *PaymentService) ListRefunds(ctx context.Context, userID string, role domain.Role, paymentID string) ([]domain.Refund, error) {
+	payment, err := s.repo.GetByID(ctx, paymentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	if err := s.canManage(ctx, userID, role, payment); err != nil {
+		return nil, err
+	}
+	return s.repo.ListRefunds(ctx, paymentID)
+}
+
+// canManage allows whoever the policy lets manage the course's payments.
+func (s *PaymentService) canManage(ctx context.Context, userID string, role domain.Role, p *domain.Payment) error {
+	err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManagePayments, CourseResource(p.CourseID))
+	if errors.Is(err, ErrForbidden) {
+		return ErrPaymentForbidden
+	}
+	return err
+}
+
+// ListPayments returns payments scoped to the user's role, or a course's payments, or one
+// of its sections' when sectionID is set.
+func (s *PaymentService) ListPayments(ctx context.Context, userID string, role domain.Role, courseID, branchID, sectionID string) ([]domain.Payment, error) {
 	if courseID != "" {
-		return s.repo.ListByCourse(ctx, courseID)
+		resource, err := s.policy.CourseOrSection(ctx, courseID, sectionID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionRecordPayments, resource); err != nil {
+			return nil, err
+		}
+		return s.repo.ListByCourse(ctx, courseID, sectionID)
 	}
 	switch role {
 	case domain.RoleTeacher:
 		return s.repo.ListByTeacher(ctx, userID)
 	case domain.RoleSchoolAdmin:
-		return s.repo.ListBySchoolAdmin(ctx, userID)
+		school, scope, err := s.policy.MemberScope(ctx, Actor{UserID: userID, Role: role}, ActionRecordPayments)
+		if err != nil {
+			return nil, err
+		}
+		if scope != "" {
+			branchID = scope
+		}
+		return s.repo.ListBySchool(ctx, school.ID, branchID)
 	case domain.RoleAdmin:
 		return s.repo.ListAll(ctx)
 	default:
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestRecordPaymentRejectsGatewayMethods(t *testing.T) {
+	s := NewPaymentService(nil, nil, nil, nil, nil, nil, []PaymentProvider{
+		NewManualProvider(domain.PaymentMethodCash, nil),
+		&AlifProvider{},
+	})
+	for _, method := range []string{domain.PaymentMethodAlif, domain.PaymentMethodHumo, "", "bitcoin"} {
+		_, err := s.RecordPayment(context.Background(), "staff-1", domain.RoleSchoolAdmin, RecordPaymentInput{Method: method, Amount: 100})
+		if !errors.Is(err, ErrNotManualMethod) {
+			t.Errorf("method %q: err = %v, want ErrNotManualMethod", method, err)
+		}
+	}
+}
+
+func TestProcessWebhookChecksTheCapturedAmount(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		amount     string
+		wantStatus string // what the payment is moved to; empty to leave it pending
+	}{
+		{"paid in full", "approved", "100.00", domain.PaymentStatusSuccess},
+		{"paid to within rounding", "approved", "100.004", domain.PaymentStatusSuccess},
+		{"partial capture", "approved", "60.00", ""},
+		{"overcapture", "approved", "100.01", ""},
+		{"no amount reported", "approved", "", ""},
+		// A decline moves no money, so its amount does not matter.
+		{"declined", "declined", "0", domain.PaymentStatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			alif := NewAlifProvider("merchant-1", "alif-secret", "", "", "")
+			s := NewPaymentService(&repository.PaymentRepository{DB: db}, nil, nil,
+				NewPricingService(&repository.PricingRepository{DB: db}, nil, nil, nil, nil), nil, nil, []PaymentProvider{alif})
+
+			mock.ExpectQuery(`WHERE p\.external_id = \?`).WithArgs("tx-1").WillReturnRows(paymentRows(domain.Payment{
+				ID: "pay-1", StudentUserID: "student-1", CourseID: "course-1", Amount: 100, Currency: domain.CurrencyTJS, ExchangeRate: 1,
+				Method: domain.PaymentMethodAlif, Status: domain.PaymentStatusPending, ExternalID: "tx-1",
+			}))
+			if tt.wantStatus != "" {
+				mock.ExpectExec(`UPDATE payments SET status = \?, updated_at = NOW\(\) WHERE external_id = \? AND status = \?`).
+					WithArgs(tt.wantStatus, "tx-1", domain.PaymentStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectNoPromoReservation(mock, "pay-1")
+			}
+
+			body := []byte(`{"transaction_id":"tx-1","order_id":"pay-1","status":"` + tt.status + `","amount":"` + tt.amount + `"}`)
+			header := http.Header{}
+			header.Set("X-Signature", signHMACSHA256("alif-secret", body))
+			if err := s.ProcessWebhook(context.Background(), domain.PaymentMethodAlif, body, header); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRefundProvider(t *testing.T) {
+	cash := NewManualProvider(domain.PaymentMethodCash, nil)
+	alif := &AlifProvider{}
+	s := NewPaymentService(nil, nil, nil, nil, nil, nil, []PaymentProvider{cash, alif})
+
+	tests := []struct {
+		name    string
+		payment domain.Payment
+		manual  bool
+	}{
+		{"cash", domain.Payment{Method: domain.PaymentMethodCash}, true},
+		{"gateway checkout", domain.Payment{Method: domain.PaymentMethodAlif, ExternalID: "alif-1"}, false},
+		{"recorded under a gateway's name", domain.Payment{Method: domain.PaymentMethodAlif}, true},
+		{"recorded under an unknown method", domain.Payment{Method: "bitcoin"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := s.refundProvider(&tt.payment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isManual(provider) != tt.manual {
+				t.Fatalf("refunded through %s, manual = %v, want %v", provider.Name(), isManual(provider), tt.manual)
+			}
+		})
+	}
+
+	if _, err := s.refundProvider(&domain.Payment{Method: "bitcoin", ExternalID: "x"}); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("err = %v, want ErrUnknownProvider", err)
+	}
+}
+
+// newRefundTestService returns a payment service whose only gateway is g, acting for the
+// platform admin of coursePersonas.
+func newRefundTestService(t *testing.T, g *fakeGateway) (*PaymentService, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	policy := NewPolicy(&repository.CourseRepository{DB: db}, nil, nil, nil, nil, nil)
+	s := NewPaymentService(&repository.PaymentRepository{DB: db}, nil, nil, nil, nil, policy, []PaymentProvider{
+		NewManualProvider(domain.PaymentMethodCash, nil), g,
+	})
+	return s, mock
+}
+
+// settledPayment is a 100 TJS payment of course c1 through the gateway, of which refunded
+// is already returned.
+func settledPayment(status string, refunded float64) domain.Payment {
+	return domain.Payment{ID: "pay-1", StudentUserID: "st1", CourseID: "c1", Amount: 100, Currency: domain.CurrencyTJS, ExchangeRate: 1,
+		RefundedAmount: refunded, Method: domain.PaymentMethodAlif, Status: status, ExternalID: "ext-1", PaidAt: time.Now(), CreatedAt: time.Now()}
+}
+
+// expectRefundLookups answers the payment lookup and the policy's check that the admin
+// may refund it, then the locked read of the payment's refundable balance.
+func expectRefundLookups(mock sqlmock.Sqlmock, p domain.Payment) {
+	mock.ExpectQuery(`WHERE p\.id = \?`).WithArgs(p.ID).WillReturnRows(paymentRows(p))
+	expectCourseAccess(mock, coursePersonas[0])
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT amount, refunded_amount, status FROM payments WHERE id = \? FOR UPDATE`).WithArgs(p.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"amount", "refunded_amount", "status"}).AddRow(p.Amount, p.RefundedAmount, p.Status))
+}
+
+func TestRefundPaymentStaysWithinWhatIsLeft(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		refunded float64
+		amount   float64
+		want     float64 // refunded through the gateway
+		wantErr  error
+	}{
+		{"full refund", domain.PaymentStatusSuccess, 0, 0, 100, nil},
+		{"rest of a partly refunded payment", domain.PaymentStatusPartiallyRefunded, 40, 0, 60, nil},
+		{"part of it", domain.PaymentStatusSuccess, 0, 25.5, 25.5, nil},
+		{"exactly what is left", domain.PaymentStatusPartiallyRefunded, 40, 60, 60, nil},
+		{"rounded to cents", domain.PaymentStatusPartiallyRefunded, 40, 59.999, 60, nil},
+		{"a cent more than is left", domain.PaymentStatusPartiallyRefunded, 40, 60.01, 0, repository.ErrRefundExceedsPayment},
+		{"more than was paid", domain.PaymentStatusSuccess, 0, 150, 0, repository.ErrRefundExceedsPayment},
+		{"nothing left", domain.PaymentStatusRefunded, 100, 0, 0, repository.ErrPaymentNotRefundable},
+		{"never settled", domain.PaymentStatusPending, 0, 10, 0, repository.ErrPaymentNotRefundable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &fakeGateway{}
+			s, mock := newRefundTestService(t, g)
+			expectRefundLookups(mock, settledPayment(tt.status, tt.refunded))
+			if tt.wantErr == nil {
+				mock.ExpectExec(`INSERT INTO refunds`).
+					WithArgs(sqlmock.AnyArg(), "pay-1", tt.want, "", domain.RefundStatusPending, "admin").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE payments SET refunded_amount = refunded_amount \+ \?`).WithArgs(tt.want, "pay-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(`UPDATE refunds SET status = \?, external_id = \?`).
+					WithArgs(domain.RefundStatusSuccess, "gw-refund", sqlmock.AnyArg(), domain.RefundStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				mock.ExpectRollback()
+			}
+
+			refund, err := s.RefundPayment(context.Background(), "admin", domain.RoleAdmin, "pay-1", RefundInput{Amount: tt.amount})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(g.refunds) != 0 {
+					t.Fatalf("gateway asked to refund %v", g.refunds)
+				}
+				return
+			}
+			if refund.Amount != tt.want || len(g.refunds) != 1 || g.refunds[0] != tt.want {
+				t.Fatalf("refunded %v through the gateway (%v), want %v", refund.Amount, g.refunds, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundPaymentRejectsNegativeAmounts(t *testing.T) {
+	s, _ := newRefundTestService(t, &fakeGateway{})
+	if _, err := s.RefundPayment(context.Background(), "admin", domain.RoleAdmin, "pay-1", RefundInput{Amount: -5}); err == nil {
+		t.Fatal("negative refund accepted")
+	}
+}
+
+func TestRefundPaymentReleasesRejectedRefunds(t *testing.T) {
+	g := &fakeGateway{refundErr: errors.New("insufficient merchant balance")}
+	s, mock := newRefundTestService(t, g)
+	expectRefundLookups(mock, settledPayment(domain.PaymentStatusSuccess, 0))
+	mock.ExpectExec(`INSERT INTO refunds`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE payments SET refunded_amount = refunded_amount \+ \?`).WithArgs(30.0, "pay-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// The reserved amount is given back, so it can be refunded again.
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refunds SET status = \?`).WithArgs(domain.RefundStatusFailed, sqlmock.AnyArg(), domain.RefundStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE payments SET refunded_amount = GREATEST\(refunded_amount - \?, 0\)`).WithArgs(30.0, "pay-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := s.RefundPayment(context.Background(), "admin", domain.RoleAdmin, "pay-1", RefundInput{Amount: 30}); !errors.Is(err, ErrRefundRejected) {
+		t.Fatalf("err = %v, want ErrRefundRejected", err)
+	}
+}
+
+func TestReconcileRefunds(t *testing.T) {
+	s, mock := newRefundTestService(t, &fakeGateway{})
+	created := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`FROM refunds\s+WHERE status = \? AND created_at < \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id", "amount", "reason", "status", "external_id", "created_by", "created_at"}).
+			AddRow("ref-cash", "pay-cash", 20.0, "", domain.RefundStatusPending, "", "admin", created).
+			AddRow("ref-gw", "pay-1", 30.0, "", domain.RefundStatusPending, "", "admin", created))
+
+	// Money handed back in person is done; the refund only needs completing.
+	cash := settledPayment(domain.PaymentStatusPartiallyRefunded, 20)
+	cash.ID, cash.Method, cash.ExternalID = "pay-cash", domain.PaymentMethodCash, ""
+	mock.ExpectQuery(`WHERE p\.id = \?`).WithArgs("pay-cash").WillReturnRows(paymentRows(cash))
+	mock.ExpectExec(`UPDATE refunds SET status = \?, external_id = \?`).
+		WithArgs(domain.RefundStatusSuccess, "", "ref-cash", domain.RefundStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The gateway's answer was lost; the refund is failed rather than asked for twice.
+	mock.ExpectQuery(`WHERE p\.id = \?`).WithArgs("pay-1").WillReturnRows(paymentRows(settledPayment(domain.PaymentStatusPartiallyRefunded, 30)))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refunds SET status = \?`).WithArgs(domain.RefundStatusFailed, "ref-gw", domain.RefundStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE payments SET refunded_amount = GREATEST\(refunded_amount - \?, 0\)`).WithArgs(30.0, "pay-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	settled, err := s.ReconcileRefunds(context.Background(), 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled != 2 {
+		t.Fatalf("settled %d refunds, want 2", settled)
+	}
+}
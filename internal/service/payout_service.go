@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+const periodLayout = "2006-01"
+
+var ErrInvalidPeriod = errors.New("period must be a past or current month in YYYY-MM format")
+
+// PayoutService computes what schools owe the teachers of their courses. Statements are
+// recomputed on read until the school marks them paid, after which they are frozen.
+type PayoutService struct {
+	payoutRepo *repository.PayoutRepository
+	schoolRepo *repository.SchoolRepository
+	rates      *ExchangeRateService
+	policy     *Policy
+}
+
+func NewPayoutService(payoutRepo *repository.PayoutRepository, schoolRepo *repository.SchoolRepository, rates *ExchangeRateService, policy *Policy) *PayoutService {
+	return &PayoutService{
+		payoutRepo: payoutRepo,
+		schoolRepo: schoolRepo,
+		rates:      rates,
+		policy:     policy,
+	}
+}
+
+func (s *PayoutService) GetSettings(ctx context.Context, actor Actor) (*domain.PayoutSettings, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManagePayouts)
+	if err != nil {
+		return nil, err
+	}
+	return s.payoutRepo.GetPayoutSettings(ctx, school.ID)
+}
+
+func (s *PayoutService) UpdateSettings(ctx context.Context, actor Actor, settings domain.PayoutSettings) (*domain.PayoutSettings, error) {
+	switch settings.Mode {
+	case domain.PayoutModePercentage, domain.PayoutModeHourly:
+	default:
+		return nil, errors.New("mode must be percentage or hourly")
+	}
+	if settings.TeacherSharePercent < 0 || settings.TeacherSharePercent > 100 {
+		return nil, errors.New("teacher_share_percent must be between 0 and 100")
+	}
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManagePayouts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.payoutRepo.SetPayoutSettings(ctx, school.ID, settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// ListStatements returns the statements of the actor's school for a period (YYYY-MM,
+// defaulting to the current month), bringing pending ones up to date first.
+func (s *PayoutService) ListStatements(ctx context.Context, actor Actor, period string) ([]domain.PayoutStatement, error) {
+	month, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManagePayouts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refresh(ctx, school, month, ""); err != nil {
+		return nil, err
+	}
+	return s.payoutRepo.ListStatementsBySchool(ctx, school.ID, month.Format(periodLayout))
+}
+
+// MarkPaid records that the actor's school paid a statement out.
+func (s *PayoutService) MarkPaid(ctx context.Context, actor Actor, id, reference string) (*domain.PayoutStatement, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManagePayouts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.payoutRepo.MarkStatementPaid(ctx, id, school.ID, actor.UserID, strings.TrimSpace(reference)); err != nil {
+		return nil, err
+	}
+	return s.payoutRepo.GetStatement(ctx, id)
+}
+
+// MyEarnings returns the actor's statements from every school they teach at, which for
+// anyone who teaches at none is an empty list. The current and previous months are brought
+// up to date first.
+func (s *PayoutService) MyEarnings(ctx context.Context, actor Actor) (*domain.TeacherEarnings, error) {
+	teacherID := actor.UserID
+	schoolIDs, err := s.payoutRepo.ListTeacherSchoolIDs(ctx, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := parsePeriod("")
+	for _, schoolID := range schoolIDs {
+		school, err := s.schoolRepo.GetSchoolByID(ctx, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		for _, month := range []time.Time{current.AddDate(0, -1, 0), current} {
+			if err := s.refresh(ctx, school, month, teacherID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	statements, err := s.payoutRepo.ListStatementsByTeacher(ctx, teacherID, 36)
+	if err != nil {
+		return nil, err
+	}
+	earnings := &domain.TeacherEarnings{
+		Pending:    map[string]float64{},
+		Paid:       map[string]float64{},
+		Statements: statements,
+	}
+	if earnings.Statements == nil {
+		earnings.Statements = []domain.PayoutStatement{}
+	}
+	for _, st := range statements {
+		if st.Status == domain.PayoutStatusPaid {
+			earnings.Paid[st.Currency] = roundMoney(earnings.Paid[st.Currency] + st.Amount)
+		} else {
+			earnings.Pending[st.Currency] = roundMoney(earnings.Pending[st.Currency] + st.Amount)
+		}
+	}
+	return earnings, nil
+}
+
+// refresh recomputes the school's pending statements for month, optionally for one teacher.
+// Course teachers and section teachers each get a statement for their own sessions and
+// students. Teachers with neither revenue nor sessions in the month get no statement, and
+// lose the pending one they had.
+func (s *PayoutService) refresh(ctx context.Context, school *domain.School, month time.Time, teacherID string) error {
+	settings, err := s.payoutRepo.GetPayoutSettings(ctx, school.ID)
+	if err != nil {
+		return err
+	}
+	courses, err := s.payoutRepo.ListTeacherCourses(ctx, school.ID, teacherID)
+	if err != nil {
+		return err
+	}
+	currency := school.ReportingCurrency
+	if currency == "" {
+		currency = domain.BaseCurrency
+	}
+
+	end := month.AddDate(0, 1, 0)
+	rateDate := end
+	if now := time.Now(); now.Before(rateDate) {
+		rateDate = now
+	}
+
+	byTeacher := map[string][]domain.Course{}
+	var teachers []string
+	for _, c := range courses {
+		if _, ok := byTeacher[*c.TeacherID]; !ok {
+			teachers = append(teachers, *c.TeacherID)
+		}
+		byTeacher[*c.TeacherID] = append(byTeacher[*c.TeacherID], c)
+	}
+
+	var saved []string
+	for _, id := range teachers {
+		st := &domain.PayoutStatement{
+			SchoolID:  school.ID,
+			TeacherID: id,
+			Period:    month.Format(periodLayout),
+			Mode:      settings.Mode,
+			Currency:  currency,
+		}
+
+		var hourlyRate float64
+		if settings.Mode == domain.PayoutModeHourly {
+			// A teacher without a profile has no rate on file and earns nothing until one is set.
+			if profile, err := s.schoolRepo.GetTeacherProfile(ctx, id); err == nil && profile.HourlyRate > 0 {
+				hourlyRate, err = s.rates.Convert(ctx, profile.HourlyRate, profile.Currency, currency, rateDate)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, c := range byTeacher[id] {
+			revenue, err := s.courseRevenue(ctx, c.ID, id, currency, month, end)
+			if err != nil {
+				return err
+			}
+			held, err := s.payoutRepo.CountSessions(ctx, c.ID, id, month, end)
+			if err != nil {
+				return err
+			}
+			var sessions int
+			var hours float64
+			for _, h := range held {
+				sessions += h.Sessions
+				hours += float64(h.Sessions) * sessionHours(h.Schedule)
+			}
+			if revenue == 0 && sessions == 0 {
+				continue
+			}
+
+			line := domain.PayoutLine{
+				CourseID:    c.ID,
+				CourseTitle: c.Title,
+				Revenue:     revenue,
+				Sessions:    sessions,
+				Hours:       roundMoney(hours),
+			}
+			if settings.Mode == domain.PayoutModeHourly {
+				line.Rate = hourlyRate
+				line.Amount = roundMoney(line.Hours * hourlyRate)
+			} else {
+				line.Amount = roundMoney(revenue * settings.TeacherSharePercent / 100)
+			}
+			st.Lines = append(st.Lines, line)
+			st.Revenue += line.Revenue
+			st.Sessions += line.Sessions
+			st.Hours += line.Hours
+			st.Amount += line.Amount
+		}
+		if len(st.Lines) == 0 {
+			continue
+		}
+		st.Revenue = roundMoney(st.Revenue)
+		st.Hours = roundMoney(st.Hours)
+		st.Amount = roundMoney(st.Amount)
+
+		if err := s.payoutRepo.SaveStatement(ctx, st); err != nil && !errors.Is(err, repository.ErrPayoutStatementPaid) {
+			return err
+		}
+		saved = append(saved, id)
+	}
+	return s.payoutRepo.DeleteStalePendingStatements(ctx, school.ID, month.Format(periodLayout), teacherID, saved)
+}
+
+// courseRevenue is a course's net revenue in [from, to) from the students the teacher is
+// paid for, converted to currency at the rates in force when each payment was made, like
+// the revenue analytics.
+func (s *PayoutService) courseRevenue(ctx context.Context, courseID, teacherID, currency string, from, to time.Time) (float64, error) {
+	movements, err := s.payoutRepo.ListRevenueMovements(ctx, courseID, teacherID, from, to)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, m := range movements {
+		rate, err := s.rates.RateAt(ctx, currency, m.PaidAt)
+		if err != nil {
+			return 0, err
+		}
+		total += m.Amount * m.ExchangeRate / rate
+	}
+	return roundMoney(total), nil
+}
+
+// sessionHours is the length of one class from its schedule, one hour if it has none.
+func sessionHours(schedule *domain.Schedule) float64 {
+	if schedule == nil {
+		return 1
+	}
+	start, errStart := time.Parse("15:04", schedule.StartTime)
+	end, errEnd := time.Parse("15:04", schedule.EndTime)
+	if errStart != nil || errEnd != nil || !end.After(start) {
+		return 1
+	}
+	return end.Sub(start).Hours()
+}
+
+// parsePeriod parses a YYYY-MM month, defaulting to the current one. Future months are rejected.
+func parsePeriod(period string) (time.Time, error) {
+	now := time.Now()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if period == "" {
+		return current, nil
+	}
+	month, err := time.ParseInLocation(periodLayout, period, time.Local)
+	if err != nil || month.After(current) {
+		return time.Time{}, ErrInvalidPeriod
+	}
+	return month, nil
+}
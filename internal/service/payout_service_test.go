@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestSessionHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *domain.Schedule
+		want     float64
+	}{
+		{"no schedule", nil, 1},
+		{"ninety minutes", &domain.Schedule{StartTime: "16:00", EndTime: "17:30"}, 1.5},
+		{"no times", &domain.Schedule{}, 1},
+		{"ends before it starts", &domain.Schedule{StartTime: "18:00", EndTime: "17:00"}, 1},
+	}
+	for _, tt := range tests {
+		if got := sessionHours(tt.schedule); got != tt.want {
+			t.Errorf("%s: sessionHours = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Now()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if got, err := parsePeriod(""); err != nil || !got.Equal(current) {
+		t.Fatalf("parsePeriod(\"\") = %v, %v, want the current month", got, err)
+	}
+	if got, err := parsePeriod("2026-03"); err != nil || got.Format(periodLayout) != "2026-03" {
+		t.Fatalf("parsePeriod(2026-03) = %v, %v", got, err)
+	}
+	for _, period := range []string{current.AddDate(0, 1, 0).Format(periodLayout), "2026-13", "March"} {
+		if _, err := parsePeriod(period); err != ErrInvalidPeriod {
+			t.Errorf("parsePeriod(%s) err = %v, want ErrInvalidPeriod", period, err)
+		}
+	}
+}
+
+// payoutSchool is a school reporting in TJS.
+var payoutSchool = &domain.School{ID: "s1", ReportingCurrency: domain.CurrencyTJS}
+
+func newTestPayoutService(t *testing.T) (*PayoutService, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	return NewPayoutService(&repository.PayoutRepository{DB: db}, &repository.SchoolRepository{DB: db},
+		NewExchangeRateService(&repository.ExchangeRateRepository{DB: db}, nil), nil), mock
+}
+
+func expectPayoutSettings(mock sqlmock.Sqlmock, mode string, share float64) {
+	mock.ExpectQuery(`SELECT payout_mode, teacher_share_percent FROM schools`).WithArgs("s1").
+		WillReturnRows(sqlmock.NewRows([]string{"payout_mode", "teacher_share_percent"}).AddRow(mode, share))
+}
+
+// expectTeacherCourses answers the school's courses, each given as course ID and teacher.
+func expectTeacherCourses(mock sqlmock.Sqlmock, courses ...[2]string) {
+	rows := sqlmock.NewRows([]string{"id", "title", "schedule", "teacher_id", "teacher_name"})
+	for _, c := range courses {
+		rows.AddRow(c[0], c[0], nil, c[1], c[1])
+	}
+	mock.ExpectQuery(`SELECT c\.id, c\.title, c\.schedule, t\.teacher_id`).WithArgs("s1").WillReturnRows(rows)
+}
+
+// expectRevenue answers a course's money movements, each given as amount and the rate
+// to TJS its payment was made at.
+func expectRevenue(mock sqlmock.Sqlmock, courseID string, movements ...[2]float64) {
+	rows := sqlmock.NewRows([]string{"amount", "currency", "exchange_rate", "paid_at"})
+	for _, m := range movements {
+		rows.AddRow(m[0], "", m[1], time.Now())
+	}
+	mock.ExpectQuery(`SELECT p\.amount, p\.currency, p\.exchange_rate, p\.paid_at`).WithArgs(
+		courseID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), courseID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(rows)
+}
+
+// expectSessions answers the sessions held for a course, each given as a count and how
+// long one session of it is scheduled for ("" for no schedule).
+func expectSessions(mock sqlmock.Sqlmock, courseID string, held ...[2]any) {
+	rows := sqlmock.NewRows([]string{"sessions", "schedule"})
+	for _, h := range held {
+		var schedule any
+		if h[1] != "" {
+			schedule = h[1]
+		}
+		rows.AddRow(h[0], schedule)
+	}
+	mock.ExpectQuery(`SELECT COUNT\(DISTINCT a\.date\)`).WithArgs(courseID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(rows)
+}
+
+// expectNewStatement answers saving a first statement for the teacher, with one line per
+// amount in lines.
+func expectNewStatement(mock sqlmock.Sqlmock, teacherID, mode string, revenue float64, sessions int, hours, amount float64, lines ...float64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payout_statements`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO payout_statements`).
+		WithArgs(sqlmock.AnyArg(), "s1", teacherID, sqlmock.AnyArg(), mode, domain.CurrencyTJS, revenue, sessions, hours, amount).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, line := range lines {
+		mock.ExpectExec(`INSERT INTO payout_lines`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), line).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestRefreshPercentageSplitRoundsEachLine(t *testing.T) {
+	s, mock := newTestPayoutService(t)
+	expectPayoutSettings(mock, domain.PayoutModePercentage, 33.33)
+	expectTeacherCourses(mock, [2]string{"algebra", "t1"}, [2]string{"english", "t1"}, [2]string{"idle", "t2"})
+
+	// 100.01 TJS; the share is 33.333333, paid as 33.33.
+	expectRevenue(mock, "algebra", [2]float64{100.01, 1})
+	expectSessions(mock, "algebra")
+	// 10 USD paid at 10.9 less a 3 USD refund: 76.30 TJS, of which 25.43079 is the share.
+	expectRevenue(mock, "english", [2]float64{10, 10.9}, [2]float64{-3, 10.9})
+	expectSessions(mock, "english")
+	expectNewStatement(mock, "t1", domain.PayoutModePercentage, 176.31, 0, 0, 58.76, 33.33, 25.43)
+	// t2 took in nothing and taught nothing, so gets no statement.
+	expectRevenue(mock, "idle")
+	expectSessions(mock, "idle")
+	mock.ExpectExec(`DELETE FROM payout_statements WHERE school_id = \? AND period = \? AND status = 'pending' AND teacher_id NOT IN \(\?\)`).
+		WithArgs("s1", sqlmock.AnyArg(), "t1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	month, _ := parsePeriod("")
+	if err := s.refresh(context.Background(), payoutSchool, month, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshHourlyPaysTheConvertedRate(t *testing.T) {
+	s, mock := newTestPayoutService(t)
+	expectPayoutSettings(mock, domain.PayoutModeHourly, 0)
+	expectTeacherCourses(mock, [2]string{"algebra", "t1"})
+	created := time.Now()
+	mock.ExpectQuery(`FROM teacher_profiles WHERE user_id = \?`).WithArgs("t1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "school_id", "branch_id", "bio", "subjects", "hourly_rate", "currency", "created_at", "updated_at"}).
+			AddRow("t1", "s1", nil, "", "[]", 5.5, domain.CurrencyUSD, created, created))
+	expectRate(mock, domain.CurrencyUSD, 10.9)
+
+	expectRevenue(mock, "algebra")
+	// Three 90-minute sessions in one section and one unscheduled hour in another.
+	expectSessions(mock, "algebra", [2]any{3, `{"start_time":"16:00","end_time":"17:30"}`}, [2]any{1, ""})
+	// 5.5 USD at 10.9 is 59.95 TJS an hour, for 5.5 hours.
+	expectNewStatement(mock, "t1", domain.PayoutModeHourly, 0, 4, 5.5, 329.73, 329.73)
+	mock.ExpectExec(`DELETE FROM payout_statements`).WithArgs("s1", sqlmock.AnyArg(), "t1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	month, _ := parsePeriod("")
+	if err := s.refresh(context.Background(), payoutSchool, month, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// periodic runs a background pass at once and then every interval until it is stopped.
+// Workers embed it and supply only their pass.
+type periodic struct {
+	name     string
+	interval time.Duration
+	runOnce  func(ctx context.Context)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPeriodic(name string, interval time.Duration, runOnce func(ctx context.Context)) *periodic {
+	return &periodic{name: name, interval: interval, runOnce: runOnce}
+}
+
+// Start launches the loop. Calling Start on a running worker is a no-op.
+func (p *periodic) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go p.loop(ctx, p.done)
+	log.Printf("%s started (every %s)", p.name, p.interval)
+}
+
+// Stop cancels the loop and waits for an in-flight pass to finish.
+func (p *periodic) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	log.Printf("%s stopped", p.name)
+}
+
+func (p *periodic) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeriodicRunsAtOnceAndStopsCleanly(t *testing.T) {
+	var runs atomic.Int32
+	ran := make(chan struct{}, 1)
+	p := newPeriodic("Test worker", time.Hour, func(ctx context.Context) {
+		runs.Add(1)
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+
+	p.Start(context.Background())
+	p.Start(context.Background()) // no-op while running
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("first pass did not run at start")
+	}
+	p.Stop()
+	p.Stop() // no-op once stopped
+
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("ran %d passes, want 1", n)
+	}
+
+	// A stopped worker can be started again.
+	p.Start(context.Background())
+	<-ran
+	p.Stop()
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// defaultCountryCode is assumed for phone numbers entered without one.
+const defaultCountryCode = "+992"
+
+var (
+	ErrInvalidPhone   = errors.New("phone number must be in international format, e.g. +992901234567")
+	ErrOTPRateLimited = errors.New("too many codes requested, try again later")
+	ErrPhoneNotFound  = errors.New("no account uses this phone number")
+)
+
+var (
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+// PhoneOTPService proves that users own a phone number by texting them a short code.
+// Issuing codes is rate limited per phone and per client IP, and each code allows only a
+// few guesses.
+type PhoneOTPService struct {
+	userRepo    *repository.UserRepository
+	otpRepo     *repository.PhoneOTPRepository
+	sms         SMSSender
+	codeExpiry  time.Duration
+	resendAfter time.Duration // minimum gap between two codes for the same phone
+	perPhone    int           // codes per phone per hour
+	perIP       int           // codes per client IP per hour
+	maxAttempts int           // wrong guesses allowed per code
+}
+
+func NewPhoneOTPService(userRepo *repository.UserRepository, otpRepo *repository.PhoneOTPRepository, sms SMSSender) *PhoneOTPService {
+	return &PhoneOTPService{
+		userRepo:    userRepo,
+		otpRepo:     otpRepo,
+		sms:         sms,
+		codeExpiry:  5 * time.Minute,
+		resendAfter: time.Minute,
+		perPhone:    5,
+		perIP:       20,
+		maxAttempts: 5,
+	}
+}
+
+// NormalizePhone brings a phone number into E.164 form. Separators are dropped, a leading
+// 00 becomes +, and a bare 9-digit local number is taken to be Tajik.
+func NormalizePhone(phone string) (string, error) {
+	p := phoneSeparators.Replace(strings.TrimSpace(phone))
+	switch {
+	case strings.HasPrefix(p, "00"):
+		p = "+" + p[2:]
+	case len(p) == 9 && !strings.HasPrefix(p, "+"):
+		p = defaultCountryCode + p
+	}
+	if !e164Pattern.MatchString(p) {
+		return "", ErrInvalidPhone
+	}
+	return p, nil
+}
+
+// RequestCode texts a login code to the phone if an account uses it. Unknown numbers are
+// not an error, so callers cannot tell whether an account exists.
+func (s *PhoneOTPService) RequestCode(ctx context.Context, phone, ip string) error {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetUserByPhone(ctx, phone); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.SendCode(ctx, phone, ip)
+}
+
+// SendCode issues a fresh code for a normalized phone and texts it, replacing any earlier
+// code. It returns ErrOTPRateLimited when the phone or IP has asked for too many.
+func (s *PhoneOTPService) SendCode(ctx context.Context, phone, ip string) error {
+	now := time.Now()
+	if n, err := s.otpRepo.CountSentToPhone(ctx, phone, now.Add(-s.resendAfter)); err != nil {
+		return err
+	} else if n > 0 {
+		return ErrOTPRateLimited
+	}
+	if n, err := s.otpRepo.CountSentToPhone(ctx, phone, now.Add(-time.Hour)); err != nil {
+		return err
+	} else if n >= s.perPhone {
+		return ErrOTPRateLimited
+	}
+	if ip != "" {
+		if n, err := s.otpRepo.CountRequestedFromIP(ctx, ip, now.Add(-time.Hour)); err != nil {
+			return err
+		} else if n >= s.perIP {
+			return ErrOTPRateLimited
+		}
+	}
+
+	code, err := newOTPCode()
+	if err != nil {
+		return err
+	}
+	if err := s.otpRepo.Create(ctx, phone, hashOTP(phone, code), ip, now.Add(s.codeExpiry)); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("SchoolTJ code: %s. Valid for %d minutes. Do not share it with anyone.", code, int(s.codeExpiry.Minutes()))
+	return s.sms.Send(ctx, phone, message)
+}
+
+// VerifyCode checks a code texted to the phone and marks the phone verified. It returns
+// the account the phone belongs to.
+func (s *PhoneOTPService) VerifyCode(ctx context.Context, phone, code string) (*domain.User, error) {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, repository.ErrOTPInvalid
+	}
+	if err := s.otpRepo.Consume(ctx, phone, hashOTP(phone, code), s.maxAttempts); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByPhone(ctx, phone)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrPhoneNotFound
+		}
+		return nil, err
+	}
+	if user.PhoneVerifiedAt == nil {
+		if err := s.userRepo.MarkPhoneVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.PhoneVerifiedAt = &now
+	}
+	return user, nil
+}
+
+// newOTPCode returns a random 6-digit code.
+func newOTPCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOTP binds a code to its phone, so a stored hash says nothing about other numbers.
+func hashOTP(phone, code string) string {
+	return hashToken(phone + ":" + code)
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var ErrForbidden = errors.New("you do not have permission to do this")
+
+// Actor is the signed-in user a request acts for.
+type Actor struct {
+	UserID string
+	Role   domain.Role
+}
+
+// Action is something an actor may be allowed to do to a resource.
+type Action string
+
+const (
+	// Course content: curriculum, materials, assignments, announcements.
+	ActionViewCourse Action = "course.view"
+	// Edit the course's details, cover, curriculum and materials, or delete it.
+	ActionManageCourse Action = "course.manage"
+	// Post grades, assignments, announcements and attendance, and see the results. Asked
+	// of a section, its teacher may do this for the section's students.
+	ActionTeachCourse Action = "course.teach"
+	// See the roster, invite students and answer enrollment requests.
+	ActionManageEnrollments Action = "course.enrollments.manage"
+	// Hand in work for the course's assignments.
+	ActionSubmitWork Action = "course.submit"
+	// Record cash payments and see the course's payments and debtors.
+	ActionRecordPayments Action = "course.payments.record"
+	// Refund payments and run promotions. The money belongs to the school, so a teacher
+	// may only do this for an independent course.
+	ActionManagePayments Action = "course.payments.manage"
+	// Edit a school's profile.
+	ActionManageSchool Action = "school.manage"
+	// Delete a school.
+	ActionDeleteSchool Action = "school.delete"
+	// Add and remove a school's staff and change their roles.
+	ActionManageStaff Action = "school.staff.manage"
+	// Require two-factor authentication from a school's teachers.
+	ActionManageSecurity Action = "school.security.manage"
+	// Invite teachers to a school and remove them from it.
+	ActionManageTeachers Action = "school.teachers.manage"
+	// Configure teacher payouts and settle payout statements.
+	ActionManagePayouts Action = "school.payouts.manage"
+	// See a school's revenue analytics and export its reports.
+	ActionViewReports Action = "school.reports.view"
+	// Add and remove the rooms of a school's branch.
+	ActionManageRooms Action = "branch.rooms.manage"
+	// Post announcements to every user of the platform.
+	ActionAnnounceGlobally Action = "platform.announce"
+	// Enter the exchange rates amounts are converted at.
+	ActionManageExchangeRates Action = "platform.exchange_rates.manage"
+	// See a student's grades, attendance, homework and balance across their courses.
+	ActionViewStudent Action = "student.view"
+	// Invite and remove a student's parents and guardians.
+	ActionManageGuardians Action = "student.guardians.manage"
+	// Pay a student's course fees.
+	ActionPayForStudent Action = "student.pay"
+)
+
+// relation is a way an actor can be connected to a resource.
+type relation uint16
+
+const (
+	relPlatformAdmin relation = 1 << iota
+	relCourseTeacher
+	relSectionTeacher     // teaches the section
+	relCoTeacher          // teaches one of the course's sections
+	relIndependentTeacher // teaches a course that belongs to no school
+	relSchoolStaff        // on the staff of the school, or of the course's school, in a role allowed the action; a branch manager only for their branch and its courses
+	relEnrolledStudent    // active or completed enrollment, in the section for a section
+	relSelf               // is the student
+	relGuardian           // has an active guardian link to the student
+)
+
+// grants lists, per action, the relations that allow it.
+var grants = map[Action]relation{
+	ActionViewCourse:          relPlatformAdmin | relCourseTeacher | relSectionTeacher | relCoTeacher | relSchoolStaff | relEnrolledStudent,
+	ActionManageCourse:        relPlatformAdmin | relCourseTeacher | relSchoolStaff,
+	ActionTeachCourse:         relPlatformAdmin | relCourseTeacher | relSectionTeacher | relSchoolStaff,
+	ActionManageEnrollments:   relPlatformAdmin | relCourseTeacher | relSchoolStaff,
+	ActionSubmitWork:          relEnrolledStudent,
+	ActionRecordPayments:      relPlatformAdmin | relCourseTeacher | relSectionTeacher | relSchoolStaff,
+	ActionManagePayments:      relPlatformAdmin | relIndependentTeacher | relSchoolStaff,
+	ActionManageSchool:        relPlatformAdmin | relSchoolStaff,
+	ActionDeleteSchool:        relPlatformAdmin | relSchoolStaff,
+	ActionManageStaff:         relPlatformAdmin | relSchoolStaff,
+	ActionManageSecurity:      relPlatformAdmin | relSchoolStaff,
+	ActionManageTeachers:      relPlatformAdmin | relSchoolStaff,
+	ActionManagePayouts:       relPlatformAdmin | relSchoolStaff,
+	ActionViewReports:         relPlatformAdmin | relSchoolStaff,
+	ActionManageRooms:         relPlatformAdmin | relSchoolStaff,
+	ActionAnnounceGlobally:    relPlatformAdmin,
+	ActionManageExchangeRates: relPlatformAdmin,
+	ActionViewStudent:         relPlatformAdmin | relSelf | relGuardian | relSchoolStaff,
+	ActionManageGuardians:     relPlatformAdmin | relSelf | relSchoolStaff,
+	ActionPayForStudent:       relSelf | relGuardian,
+}
+
+// staffPermissions lists, per action, the school permissions that let a staff member do
+// it. A staff member holds relSchoolStaff only when their role has one of them.
+var staffPermissions = map[Action][]domain.SchoolPermission{
+	ActionViewCourse:        {domain.SchoolPermCourses, domain.SchoolPermEnrollments, domain.SchoolPermPayments},
+	ActionManageCourse:      {domain.SchoolPermCourses},
+	ActionTeachCourse:       {domain.SchoolPermCourses},
+	ActionManageEnrollments: {domain.SchoolPermEnrollments},
+	ActionRecordPayments:    {domain.SchoolPermPayments},
+	ActionManagePayments:    {domain.SchoolPermPayments},
+	ActionManageSchool:      {domain.SchoolPermProfile},
+	ActionDeleteSchool:      {domain.SchoolPermDelete},
+	ActionManageStaff:       {domain.SchoolPermStaff},
+	ActionManageSecurity:    {domain.SchoolPermSecurity},
+	ActionManageTeachers:    {domain.SchoolPermTeachers},
+	ActionManagePayouts:     {domain.SchoolPermPayouts},
+	ActionViewReports:       {domain.SchoolPermReports},
+	ActionManageRooms:       {domain.SchoolPermCourses},
+	ActionViewStudent:       {domain.SchoolPermStudents},
+	ActionManageGuardians:   {domain.SchoolPermStudents},
+}
+
+// staffMay reports whether a staff member with the role may perform the action.
+func staffMay(role domain.SchoolRole, action Action) bool {
+	for _, perm := range staffPermissions[action] {
+		if role.Has(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+type resourceKind uint8
+
+const (
+	resourcePlatform resourceKind = iota
+	resourceCourse
+	resourceSection
+	resourceSchool
+	resourceBranch
+	resourceStudent
+)
+
+// Resource is what an action is performed on.
+type Resource struct {
+	kind resourceKind
+	id   string
+}
+
+// Platform is the platform as a whole, for actions not tied to one course.
+func Platform() Resource { return Resource{kind: resourcePlatform} }
+
+// CourseResource is a course and everything in it.
+func CourseResource(courseID string) Resource { return Resource{kind: resourceCourse, id: courseID} }
+
+// SectionResource is one section of a course and its students. Everyone who may act on
+// the whole course may act on its sections.
+func SectionResource(sectionID string) Resource {
+	return Resource{kind: resourceSection, id: sectionID}
+}
+
+// SchoolResource is a school's own records, apart from its courses.
+func SchoolResource(schoolID string) Resource { return Resource{kind: resourceSchool, id: schoolID} }
+
+// BranchResource is one of a school's branches and its rooms.
+func BranchResource(branchID string) Resource { return Resource{kind: resourceBranch, id: branchID} }
+
+// StudentResource is a student's records across all of their courses.
+func StudentResource(studentID string) Resource {
+	return Resource{kind: resourceStudent, id: studentID}
+}
+
+// Policy decides who may do what. It is the one place that knows how course ownership,
+// school membership and enrollment turn into permissions; services ask it instead of
+// checking roles themselves.
+type Policy struct {
+	courseRepo  *repository.CourseRepository
+	schoolRepo  *repository.SchoolRepository
+	studentRepo *repository.StudentRepository
+	members     *repository.SchoolMemberRepository
+	branches    *repository.BranchRepository
+	sections    *repository.SectionRepository
+}
+
+func NewPolicy(courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository, studentRepo *repository.StudentRepository,
+	members *repository.SchoolMemberRepository, branches *repository.BranchRepository, sections *repository.SectionRepository) *Policy {
+	return &Policy{courseRepo: courseRepo, schoolRepo: schoolRepo, studentRepo: studentRepo, members: members, branches: branches, sections: sections}
+}
+
+// Can returns nil if the actor may perform the action on the resource, ErrForbidden if
+// not, and the repository's not-found error for a resource that does not exist.
+func (p *Policy) Can(ctx context.Context, actor Actor, action Action, resource Resource) error {
+	_, err := p.check(ctx, actor, action, resource)
+	return err
+}
+
+// check is Can that also returns the relations that allow the action.
+func (p *Policy) check(ctx context.Context, actor Actor, action Action, resource Resource) (relation, error) {
+	allowed, ok := grants[action]
+	if !ok || actor.UserID == "" {
+		return 0, ErrForbidden
+	}
+	held, err := p.relations(ctx, actor, action, resource)
+	if err != nil {
+		return 0, err
+	}
+	if held&allowed == 0 {
+		return 0, ErrForbidden
+	}
+	return held & allowed, nil
+}
+
+// StudentCourses is the part of a student's records an actor may see.
+type StudentCourses struct {
+	all     bool
+	courses map[string]bool
+}
+
+// Has reports whether the student's records in the course are included.
+func (c *StudentCourses) Has(courseID string) bool {
+	return c.all || c.courses[courseID]
+}
+
+// StudentCourses is Can for an action on a student's records that also returns which of
+// them it covers: all of them for the student, their guardians and platform admins, and
+// for school staff only the courses the student takes at their school, or their branch.
+func (p *Policy) StudentCourses(ctx context.Context, actor Actor, action Action, studentID string) (*StudentCourses, error) {
+	held, err := p.check(ctx, actor, action, StudentResource(studentID))
+	if err != nil {
+		return nil, err
+	}
+	if held&(relPlatformAdmin|relSelf|relGuardian) != 0 {
+		return &StudentCourses{all: true}, nil
+	}
+	ids, err := p.studentRepo.StaffCourseIDs(ctx, studentID, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	visible := &StudentCourses{courses: make(map[string]bool, len(ids))}
+	for _, id := range ids {
+		visible.courses[id] = true
+	}
+	return visible, nil
+}
+
+// filterByCourse keeps the items whose course keep accepts.
+func filterByCourse[T any](items []T, keep func(courseID string) bool, courseOf func(T) string) []T {
+	kept := items[:0]
+	for _, item := range items {
+		if keep(courseOf(item)) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// CourseOrSection returns the resource to check for acting on a course's students: the
+// section when sectionID is set, so that its teacher may act too, and otherwise the whole
+// course. It returns ErrSectionNotFound for a section of another course.
+func (p *Policy) CourseOrSection(ctx context.Context, courseID, sectionID string) (Resource, error) {
+	if sectionID == "" {
+		return CourseResource(courseID), nil
+	}
+	section, err := p.sections.GetByID(ctx, sectionID)
+	if err != nil {
+		return Resource{}, err
+	}
+	if section.CourseID != courseID {
+		return Resource{}, repository.ErrSectionNotFound
+	}
+	return SectionResource(sectionID), nil
+}
+
+// MemberSchool returns the school the actor is on the staff of, for requests that act on
+// "my school" rather than naming one. It returns ErrSchoolNotFound if the actor is on no
+// school's staff and ErrForbidden if their role does not permit the action or only lets
+// them act for one branch.
+func (p *Policy) MemberSchool(ctx context.Context, actor Actor, action Action) (*domain.School, error) {
+	school, branchID, err := p.MemberScope(ctx, actor, action)
+	if err != nil {
+		return nil, err
+	}
+	if branchID != "" {
+		return nil, ErrForbidden
+	}
+	return school, nil
+}
+
+// MemberScope is MemberSchool for requests a branch manager may also make: it returns the
+// school and, for a member limited to one branch, that branch's ID. Callers must keep such
+// a member's request to the branch.
+func (p *Policy) MemberScope(ctx context.Context, actor Actor, action Action) (*domain.School, string, error) {
+	member, err := p.members.GetByUser(ctx, actor.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSchoolMemberNotFound) {
+			return nil, "", repository.ErrSchoolNotFound
+		}
+		return nil, "", err
+	}
+	if !staffMay(member.Role, action) {
+		return nil, "", ErrForbidden
+	}
+	school, err := p.schoolRepo.GetSchoolByID(ctx, member.SchoolID)
+	if err != nil {
+		return nil, "", err
+	}
+	branchID := ""
+	if member.BranchID != nil {
+		branchID = *member.BranchID
+	}
+	return school, branchID, nil
+}
+
+// ReportScope is the part of the platform an actor's dashboards and reports cover.
+type ReportScope struct {
+	Platform  bool   // every school and course
+	SchoolID  string // the school the actor is on the staff of
+	BranchID  string // the one branch of SchoolID the actor is limited to
+	TeacherID string // the courses the actor teaches, for a teacher on no school's staff
+	// Revenue is whether the actor may see revenue figures for the scope.
+	Revenue bool
+}
+
+// Empty reports whether the scope covers nothing, as for students and parents.
+func (s *ReportScope) Empty() bool {
+	return !s.Platform && s.SchoolID == "" && s.TeacherID == ""
+}
+
+// ReportScope returns what the actor's dashboards cover: the whole platform for platform
+// admins, their school or branch for school staff, the courses they teach for teachers and
+// nothing for anyone else.
+func (p *Policy) ReportScope(ctx context.Context, actor Actor) (*ReportScope, error) {
+	if p.Can(ctx, actor, ActionViewReports, Platform()) == nil {
+		return &ReportScope{Platform: true, Revenue: true}, nil
+	}
+	member, err := p.members.GetByUser(ctx, actor.UserID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrSchoolMemberNotFound) {
+			return nil, err
+		}
+		if actor.Role == domain.RoleTeacher {
+			return &ReportScope{TeacherID: actor.UserID, Revenue: true}, nil
+		}
+		return &ReportScope{}, nil
+	}
+	scope := &ReportScope{SchoolID: member.SchoolID, Revenue: staffMay(member.Role, ActionViewReports)}
+	if member.BranchID != nil {
+		scope.BranchID = *member.BranchID
+	}
+	return scope, nil
+}
+
+// SchoolStaff returns the members of the school's staff whose role permits the action,
+// for notifying the people who can act on something. For something at a branch, pass its
+// ID to include that branch's managers; managers of other branches are left out.
+func (p *Policy) SchoolStaff(ctx context.Context, schoolID, branchID string, action Action) ([]domain.SchoolMember, error) {
+	members, err := p.members.ListBySchool(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	var permitted []domain.SchoolMember
+	for _, m := range members {
+		if staffMay(m.Role, action) && (m.BranchID == nil || *m.BranchID == branchID) {
+			permitted = append(permitted, m)
+		}
+	}
+	return permitted, nil
+}
+
+// relations works out how the actor is connected to the resource for the action.
+func (p *Policy) relations(ctx context.Context, actor Actor, action Action, resource Resource) (relation, error) {
+	var held relation
+	if actor.Role == domain.RoleAdmin {
+		held |= relPlatformAdmin
+	}
+	switch resource.kind {
+	case resourceCourse:
+		access, err := p.courseRepo.GetCourseAccess(ctx, resource.id, actor.UserID)
+		if err != nil {
+			return 0, err
+		}
+		return p.courseRelations(actor, action, access, held), nil
+	case resourceSection:
+		section, err := p.sections.GetByID(ctx, resource.id)
+		if err != nil {
+			return 0, err
+		}
+		access, err := p.courseRepo.GetCourseAccess(ctx, section.CourseID, actor.UserID)
+		if err != nil {
+			return 0, err
+		}
+		held = p.courseRelations(actor, action, access, held) &^ relCoTeacher
+		if section.TeacherID != nil && *section.TeacherID == actor.UserID {
+			held |= relSectionTeacher
+		}
+		if access.EnrollmentSection != section.ID {
+			held &^= relEnrolledStudent
+		}
+	case resourceSchool:
+		if _, err := p.schoolRepo.GetSchoolByID(ctx, resource.id); err != nil {
+			return 0, err
+		}
+		member, err := p.members.Get(ctx, resource.id, actor.UserID)
+		if err != nil && !errors.Is(err, repository.ErrSchoolMemberNotFound) {
+			return 0, err
+		}
+		// The school's own records are for staff of the whole school, not a branch.
+		if member != nil && member.BranchID == nil && staffMay(member.Role, action) {
+			held |= relSchoolStaff
+		}
+	case resourceBranch:
+		branch, err := p.branches.GetByID(ctx, resource.id)
+		if err != nil {
+			return 0, err
+		}
+		member, err := p.members.Get(ctx, branch.SchoolID, actor.UserID)
+		if err != nil && !errors.Is(err, repository.ErrSchoolMemberNotFound) {
+			return 0, err
+		}
+		if member != nil && (member.BranchID == nil || *member.BranchID == branch.ID) && staffMay(member.Role, action) {
+			held |= relSchoolStaff
+		}
+	case resourceStudent:
+		access, err := p.studentRepo.GetStudentAccess(ctx, resource.id, actor.UserID)
+		if err != nil {
+			return 0, err
+		}
+		if resource.id == actor.UserID {
+			held |= relSelf
+		}
+		if access.SchoolRole != "" && staffMay(access.SchoolRole, action) {
+			held |= relSchoolStaff
+		}
+		if access.Guardian {
+			held |= relGuardian
+		}
+	}
+	return held, nil
+}
+
+func (p *Policy) courseRelations(actor Actor, action Action, access *repository.CourseAccess, held relation) relation {
+	if access.TeacherID == actor.UserID {
+		held |= relCourseTeacher
+		if access.SchoolID == "" {
+			held |= relIndependentTeacher
+		}
+	}
+	if access.TeachesSection {
+		held |= relCoTeacher
+	}
+	if access.SchoolRole != "" && staffMay(access.SchoolRole, action) &&
+		(access.MemberBranchID == "" || access.MemberBranchID == access.BranchID) {
+		held |= relSchoolStaff
+	}
+	if actor.Role == domain.RoleStudent &&
+		(access.EnrollmentStatus == domain.EnrollmentStatusActive || access.EnrollmentStatus == domain.EnrollmentStatusCompleted) {
+		held |= relEnrolledStudent
+	}
+	return held
+}
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// The endpoints below act on the platform or on "my school" rather than on a course, so
+// their decisions come down to the actor's platform role and their school role.
+
+func TestPlatformEndpointsByRole(t *testing.T) {
+	endpoints := []struct {
+		name   string
+		action Action
+	}{
+		{"POST /api/exchange-rates", ActionManageExchangeRates},
+		{"GET /api/payments/reconciliations for every school", ActionRecordPayments},
+		{"GET /api/promo-codes for every school", ActionManagePayments},
+		{"GET /api/dashboard/stats platform-wide", ActionViewReports},
+		{"POST /api/announcements to everyone", ActionAnnounceGlobally},
+	}
+	roles := []domain.Role{domain.RoleAdmin, domain.RoleSchoolAdmin, domain.RoleTeacher, domain.RoleStudent, domain.RoleParent}
+
+	// Deciding on the platform itself needs no lookups, so the policy needs no repositories.
+	policy := &Policy{}
+	for _, ep := range endpoints {
+		for _, role := range roles {
+			t.Run(ep.name+"/"+string(role), func(t *testing.T) {
+				err := policy.Can(context.Background(), Actor{UserID: "u1", Role: role}, ep.action, Platform())
+				if role == domain.RoleAdmin && err != nil {
+					t.Fatalf("admin refused: %v", err)
+				}
+				if role != domain.RoleAdmin && !errors.Is(err, ErrForbidden) {
+					t.Fatalf("%s allowed (err %v), want ErrForbidden", role, err)
+				}
+			})
+		}
+	}
+}
+
+func TestSchoolEndpointsByStaffRole(t *testing.T) {
+	var (
+		owner      = domain.SchoolRoleOwner
+		admin      = domain.SchoolRoleAdmin
+		accountant = domain.SchoolRoleAccountant
+		registrar  = domain.SchoolRoleRegistrar
+		manager    = domain.SchoolRoleBranchManager
+	)
+	endpoints := []struct {
+		name    string
+		action  Action
+		allowed []domain.SchoolRole
+	}{
+		{"/api/schools/my/payout-settings", ActionManagePayouts, []domain.SchoolRole{owner, admin, accountant}},
+		{"POST /api/payouts/{id}/mark-paid", ActionManagePayouts, []domain.SchoolRole{owner, admin, accountant}},
+		{"/api/schools/my/two-factor-policy", ActionManageSecurity, []domain.SchoolRole{owner, admin}},
+		{"/api/scholarships", ActionManagePayments, []domain.SchoolRole{owner, admin, accountant, manager}},
+		{"PUT /api/schools/my/sibling-discount", ActionManagePayments, []domain.SchoolRole{owner, admin, accountant, manager}},
+		{"/api/promo-codes", ActionManagePayments, []domain.SchoolRole{owner, admin, accountant, manager}},
+		{"GET /api/payments/reconciliations", ActionRecordPayments, []domain.SchoolRole{owner, admin, accountant, manager}},
+		{"GET /api/analytics/revenue-trend", ActionViewReports, []domain.SchoolRole{owner, admin, accountant, manager}},
+		{"GET /api/analytics/export", ActionViewReports, []domain.SchoolRole{owner, admin, accountant, manager}},
+	}
+	roles := []domain.SchoolRole{owner, admin, accountant, registrar, manager}
+
+	for _, ep := range endpoints {
+		for _, role := range roles {
+			t.Run(ep.name+"/"+string(role), func(t *testing.T) {
+				want := false
+				for _, r := range ep.allowed {
+					want = want || r == role
+				}
+				if got := staffMay(role, ep.action); got != want {
+					t.Fatalf("staffMay = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestStaffRolePermissions(t *testing.T) {
+	actions := []Action{
+		ActionViewCourse, ActionManageCourse, ActionTeachCourse, ActionManageEnrollments, ActionRecordPayments, ActionManagePayments,
+		ActionManageSchool, ActionDeleteSchool, ActionManageStaff, ActionManageSecurity, ActionManageTeachers, ActionManagePayouts,
+		ActionViewReports, ActionManageRooms, ActionViewStudent, ActionManageGuardians,
+	}
+	// Spelled out rather than derived from domain.SchoolRolePermissions, so widening a
+	// role shows up here.
+	allowed := map[domain.SchoolRole][]Action{
+		domain.SchoolRoleOwner: actions,
+		domain.SchoolRoleAdmin: {ActionViewCourse, ActionManageCourse, ActionTeachCourse, ActionManageEnrollments, ActionRecordPayments,
+			ActionManagePayments, ActionManageSchool, ActionManageStaff, ActionManageSecurity, ActionManageTeachers, ActionManagePayouts,
+			ActionViewReports, ActionManageRooms, ActionViewStudent, ActionManageGuardians},
+		domain.SchoolRoleAccountant: {ActionViewCourse, ActionRecordPayments, ActionManagePayments, ActionManagePayouts, ActionViewReports},
+		domain.SchoolRoleRegistrar: {ActionViewCourse, ActionManageCourse, ActionTeachCourse, ActionManageEnrollments, ActionManageTeachers,
+			ActionManageRooms, ActionViewStudent, ActionManageGuardians},
+		domain.SchoolRoleBranchManager: {ActionViewCourse, ActionManageCourse, ActionTeachCourse, ActionManageEnrollments,
+			ActionRecordPayments, ActionManagePayments, ActionViewReports, ActionManageRooms, ActionViewStudent, ActionManageGuardians},
+		"retired": nil, // a role no longer in the table grants nothing
+	}
+	for role, may := range allowed {
+		for _, action := range actions {
+			want := false
+			for _, a := range may {
+				want = want || a == action
+			}
+			if got := staffMay(role, action); got != want {
+				t.Errorf("staffMay(%s, %s) = %v, want %v", role, action, got, want)
+			}
+		}
+	}
+}
+
+// expectSchool answers a lookup of school s1.
+func expectSchool(mock sqlmock.Sqlmock) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM schools WHERE id = \?`).WithArgs("s1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "admin_user_id", "name", "description", "tax_id", "phone", "email", "address", "city", "website",
+			"logo_url", "reporting_currency", "is_verified", "rating_avg", "rating_count", "created_at", "updated_at"}).
+			AddRow("s1", "owner", "School", "", "", "", "", "", "", "", "", domain.CurrencyTJS, true, 0, 0, created, created))
+}
+
+// expectMember answers a lookup of the user's school membership: role at s1, limited to
+// branch when it is set, or none when role is empty.
+func expectMember(mock sqlmock.Sqlmock, userID string, role domain.SchoolRole, branch string) {
+	rows := sqlmock.NewRows([]string{"school_id", "user_id", "name", "email", "role", "branch_id", "branch_name", "added_by", "created_at"})
+	if role != "" {
+		var branchID any
+		if branch != "" {
+			branchID = branch
+		}
+		rows.AddRow("s1", userID, "Staff", "", string(role), branchID, "", nil, time.Now())
+	}
+	mock.ExpectQuery(`FROM school_members sm .* WHERE sm\.user_id = \?`).WithArgs(userID).WillReturnRows(rows)
+}
+
+func TestSchoolRecordsByStaffRole(t *testing.T) {
+	staff := []struct {
+		role   domain.SchoolRole
+		branch string
+	}{
+		{domain.SchoolRoleOwner, ""},
+		{domain.SchoolRoleAdmin, ""},
+		{domain.SchoolRoleAccountant, ""},
+		{domain.SchoolRoleRegistrar, ""},
+		{domain.SchoolRoleBranchManager, "b1"},
+		{"", ""}, // not on the school's staff
+	}
+	actions := []struct {
+		action  Action
+		allowed []domain.SchoolRole
+	}{
+		{ActionManageSchool, []domain.SchoolRole{domain.SchoolRoleOwner, domain.SchoolRoleAdmin}},
+		{ActionDeleteSchool, []domain.SchoolRole{domain.SchoolRoleOwner}},
+		{ActionManageStaff, []domain.SchoolRole{domain.SchoolRoleOwner, domain.SchoolRoleAdmin}},
+		{ActionManageTeachers, []domain.SchoolRole{domain.SchoolRoleOwner, domain.SchoolRoleAdmin, domain.SchoolRoleRegistrar}},
+		{ActionManagePayouts, []domain.SchoolRole{domain.SchoolRoleOwner, domain.SchoolRoleAdmin, domain.SchoolRoleAccountant}},
+		// A branch manager may see reports, but only through their branch.
+		{ActionViewReports, []domain.SchoolRole{domain.SchoolRoleOwner, domain.SchoolRoleAdmin, domain.SchoolRoleAccountant}},
+	}
+	for _, a := range actions {
+		for _, m := range staff {
+			t.Run(string(a.action)+"/"+string(m.role), func(t *testing.T) {
+				db, mock := newMockDB(t)
+				policy := NewPolicy(nil, &repository.SchoolRepository{DB: db}, nil, &repository.SchoolMemberRepository{DB: db}, nil, nil)
+				expectSchool(mock)
+				expectMember(mock, "u1", m.role, m.branch)
+
+				want := false
+				for _, r := range a.allowed {
+					want = want || r == m.role
+				}
+				err := policy.Can(context.Background(), Actor{UserID: "u1", Role: domain.RoleSchoolAdmin}, a.action, SchoolResource("s1"))
+				if want && err != nil {
+					t.Fatalf("refused: %v", err)
+				}
+				if !want && !errors.Is(err, ErrForbidden) {
+					t.Fatalf("allowed (err %v), want ErrForbidden", err)
+				}
+			})
+		}
+	}
+}
+
+// The endpoints below act on one course's students, as a whole or through one section.
+// Each is run for every way a user can be connected to the course: it must be refused
+// with ErrForbidden, or get past the policy to its first write.
+
+// errReachedWrite answers the first statement an endpoint runs once the policy let it
+// through.
+var errReachedWrite = errors.New("reached the endpoint's write")
+
+// coursePersona is a user and how they are connected to course c1 of school s1, branch
+// b1. Section sec1 is taught by sec-teacher and sec2 by other-sec-teacher.
+type coursePersona struct {
+	name         string
+	userID       string
+	role         domain.Role
+	schoolRole   domain.SchoolRole
+	memberBranch string
+	enrollment   string // the persona's own enrollment status
+	teachesSec   bool
+}
+
+var coursePersonas = []coursePersona{
+	{name: "platform admin", userID: "admin", role: domain.RoleAdmin},
+	{name: "course teacher", userID: "teacher", role: domain.RoleTeacher},
+	{name: "section teacher", userID: "sec-teacher", role: domain.RoleTeacher, teachesSec: true},
+	{name: "other section's teacher", userID: "other-sec-teacher", role: domain.RoleTeacher, teachesSec: true},
+	{name: "unrelated teacher", userID: "stranger", role: domain.RoleTeacher},
+	{name: "enrolled student", userID: "classmate", role: domain.RoleStudent, enrollment: domain.EnrollmentStatusActive},
+	{name: "unenrolled student", userID: "outsider", role: domain.RoleStudent},
+	{name: "school owner", userID: "owner", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleOwner},
+	{name: "school admin", userID: "co-admin", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleAdmin},
+	{name: "accountant", userID: "accountant", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleAccountant},
+	{name: "registrar", userID: "registrar", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleRegistrar},
+	{name: "branch manager", userID: "manager", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleBranchManager, memberBranch: "b1"},
+	{name: "other branch's manager", userID: "other-manager", role: domain.RoleSchoolAdmin, schoolRole: domain.SchoolRoleBranchManager, memberBranch: "b2"},
+	{name: "parent", userID: "parent", role: domain.RoleParent},
+}
+
+// expectSection answers a lookup of section sec1.
+func expectSection(mock sqlmock.Sqlmock) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT cs.id, cs.course_id, .* WHERE cs.id = \?`).WithArgs("sec1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "course_id", "name", "schedule", "teacher_id", "teacher_name", "max_students", "student_count", "created_at", "updated_at"}).
+			AddRow("sec1", "c1", "Morning", nil, "sec-teacher", "Section Teacher", nil, 3, created, created))
+}
+
+// expectCourseAccess answers the policy's lookup of how p is connected to course c1.
+func expectCourseAccess(mock sqlmock.Sqlmock, p coursePersona) {
+	enrollmentSection := ""
+	if p.enrollment != "" {
+		enrollmentSection = "sec1"
+	}
+	mock.ExpectQuery(`FROM courses c\s+LEFT JOIN school_members sm`).WithArgs(p.userID, p.userID, p.userID, "c1").
+		WillReturnRows(sqlmock.NewRows([]string{"teacher_id", "school_id", "branch_id", "role", "member_branch_id", "status", "section_id", "teaches_section"}).
+			AddRow("teacher", "s1", "b1", string(p.schoolRole), p.memberBranch, p.enrollment, enrollmentSection, p.teachesSec))
+}
+
+// expectPolicy answers the lookups the policy makes to decide for the course, or for
+// section sec1 when inSection is set.
+func expectPolicy(mock sqlmock.Sqlmock, p coursePersona, inSection bool) {
+	if inSection {
+		expectSection(mock)
+	}
+	expectCourseAccess(mock, p)
+}
+
+type courseEndpoint struct {
+	name   string
+	action Action
+	// run calls the endpoint for the target student st1, who is in section sec1 when
+	// inSection is set, and sets up the lookups it makes around the policy's.
+	run func(t *testing.T, actor Actor, p coursePersona, inSection, allowed bool) error
+}
+
+func courseEndpoints() []courseEndpoint {
+	newPolicy := func(db *sql.DB) *Policy {
+		return NewPolicy(repository.NewCourseRepository(db), nil, nil, nil, nil, repository.NewSectionRepository(db))
+	}
+	sectionOf := func(inSection bool) *string {
+		if inSection {
+			s := "sec1"
+			return &s
+		}
+		return nil
+	}
+
+	return []courseEndpoint{
+		{"POST /api/courses/{id}/grades", ActionTeachCourse, func(t *testing.T, actor Actor, p coursePersona, inSection, allowed bool) error {
+			db, mock := newMockDB(t)
+			s := NewGradeService(repository.NewGradeRepository(db), repository.NewCourseRepository(db), newPolicy(db))
+			mock.ExpectQuery(`SELECT id, student_user_id, course_id, section_id, enrolled_at, status FROM enrollments`).WithArgs("st1", "c1").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "student_user_id", "course_id", "section_id", "enrolled_at", "status"}).
+					AddRow("e1", "st1", "c1", orNull(sectionOf(inSection)), time.Now(), domain.EnrollmentStatusActive))
+			if inSection {
+				expectSection(mock) // CourseOrSection
+			}
+			expectPolicy(mock, p, inSection)
+			if allowed {
+				mock.ExpectExec(`INSERT INTO grades`).WillReturnError(errReachedWrite)
+			}
+			return s.CreateGrade(context.Background(), actor, &domain.Grade{StudentUserID: "st1", CourseID: "c1", Title: "Quiz", Score: 9})
+		}},
+		{"POST /api/assignments", ActionTeachCourse, func(t *testing.T, actor Actor, p coursePersona, inSection, allowed bool) error {
+			db, mock := newMockDB(t)
+			s := NewAssignmentService(repository.NewAssignmentRepository(db), repository.NewCourseRepository(db), newPolicy(db))
+			if inSection {
+				expectSection(mock)
+			}
+			expectPolicy(mock, p, inSection)
+			if allowed {
+				mock.ExpectExec(`INSERT INTO assignments`).WillReturnError(errReachedWrite)
+			}
+			return s.Create(context.Background(), actor, &domain.Assignment{CourseID: "c1", SectionID: sectionOf(inSection), Title: "Essay"})
+		}},
+		{"POST /api/attendance", ActionTeachCourse, func(t *testing.T, actor Actor, p coursePersona, inSection, allowed bool) error {
+			db, mock := newMockDB(t)
+			s := NewAttendanceService(repository.NewAttendanceRepository(db), newPolicy(db))
+			sectionID := ""
+			if inSection {
+				sectionID = "sec1"
+				expectSection(mock)
+			}
+			expectPolicy(mock, p, inSection)
+			if allowed && inSection {
+				mock.ExpectQuery(`FROM enrollments`).WillReturnError(errReachedWrite) // the section's roster
+			} else if allowed {
+				mock.ExpectExec(`INSERT INTO attendance`).WillReturnError(errReachedWrite)
+			}
+			return s.MarkAttendance(context.Background(), actor, "c1", sectionID, "2026-09-01",
+				[]AttendanceRecord{{EnrollmentID: "e1", StudentUserID: "st1", Status: "present"}})
+		}},
+		{"POST /api/payments", ActionRecordPayments, func(t *testing.T, actor Actor, p coursePersona, inSection, allowed bool) error {
+			db, mock := newMockDB(t)
+			payments := repository.NewPaymentRepository(db)
+			s := NewPaymentService(payments, nil, nil, nil, nil, newPolicy(db), []PaymentProvider{NewManualProvider(domain.PaymentMethodCash, payments)})
+			sectionID := ""
+			if inSection {
+				sectionID = "sec1"
+			}
+			mock.ExpectQuery(`SELECT COALESCE\(\(SELECT section_id FROM enrollments`).WithArgs("c1", "st1").
+				WillReturnRows(sqlmock.NewRows([]string{"section_id"}).AddRow(sectionID))
+			if inSection {
+				expectSection(mock)
+			}
+			expectPolicy(mock, p, inSection)
+			if allowed {
+				mock.ExpectQuery(`SELECT currency FROM courses`).WillReturnError(errReachedWrite)
+			}
+			_, err := s.RecordPayment(context.Background(), actor.UserID, actor.Role,
+				RecordPaymentInput{StudentUserID: "st1", CourseID: "c1", Amount: 100, Method: domain.PaymentMethodCash})
+			return err
+		}},
+	}
+}
+
+func TestCourseEndpointsByRelation(t *testing.T) {
+	// allowed lists who may use each kind of endpoint for the whole course and for a
+	// student of section sec1.
+	allowed := map[Action]map[string][2]bool{
+		ActionTeachCourse: {
+			"platform admin":  {true, true},
+			"course teacher":  {true, true},
+			"section teacher": {false, true},
+			"school owner":    {true, true},
+			"school admin":    {true, true},
+			"registrar":       {true, true},
+			"branch manager":  {true, true},
+		},
+		ActionRecordPayments: {
+			"platform admin":  {true, true},
+			"course teacher":  {true, true},
+			"section teacher": {false, true},
+			"school owner":    {true, true},
+			"school admin":    {true, true},
+			"accountant":      {true, true},
+			"branch manager":  {true, true},
+		},
+	}
+
+	for _, ep := range courseEndpoints() {
+		for _, p := range coursePersonas {
+			for i, scope := range []string{"whole course", "section"} {
+				inSection := i == 1
+				want := allowed[ep.action][p.name][i]
+				t.Run(ep.name+"/"+p.name+"/"+scope, func(t *testing.T) {
+					err := ep.run(t, Actor{UserID: p.userID, Role: p.role}, p, inSection, want)
+					if want && !errors.Is(err, errReachedWrite) {
+						t.Fatalf("refused (err %v), want allowed", err)
+					}
+					if !want && !errors.Is(err, ErrForbidden) {
+						t.Fatalf("allowed (err %v), want ErrForbidden", err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestReportScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       domain.Role
+		schoolRole domain.SchoolRole
+		branch     string
+		want       ReportScope
+	}{
+		{"platform admin", domain.RoleAdmin, "", "", ReportScope{Platform: true, Revenue: true}},
+		{"school owner", domain.RoleSchoolAdmin, domain.SchoolRoleOwner, "", ReportScope{SchoolID: "s1", Revenue: true}},
+		{"accountant", domain.RoleSchoolAdmin, domain.SchoolRoleAccountant, "", ReportScope{SchoolID: "s1", Revenue: true}},
+		{"registrar", domain.RoleSchoolAdmin, domain.SchoolRoleRegistrar, "", ReportScope{SchoolID: "s1"}},
+		{"branch manager", domain.RoleSchoolAdmin, domain.SchoolRoleBranchManager, "b1", ReportScope{SchoolID: "s1", BranchID: "b1", Revenue: true}},
+		{"independent teacher", domain.RoleTeacher, "", "", ReportScope{TeacherID: "u1", Revenue: true}},
+		{"student", domain.RoleStudent, "", "", ReportScope{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			policy := NewPolicy(nil, nil, nil, &repository.SchoolMemberRepository{DB: db}, nil, nil)
+			if tt.role != domain.RoleAdmin {
+				expectMember(mock, "u1", tt.schoolRole, tt.branch)
+			}
+			scope, err := policy.ReportScope(context.Background(), Actor{UserID: "u1", Role: tt.role})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *scope != tt.want {
+				t.Fatalf("scope = %+v, want %+v", *scope, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemberScopeKeepsBranchManagersToTheirBranch(t *testing.T) {
+	db, mock := newMockDB(t)
+	policy := NewPolicy(nil, &repository.SchoolRepository{DB: db}, nil, &repository.SchoolMemberRepository{DB: db}, nil, nil)
+	actor := Actor{UserID: "manager", Role: domain.RoleSchoolAdmin}
+
+	expectMember(mock, "manager", domain.SchoolRoleBranchManager, "b1")
+	expectSchool(mock)
+	school, branchID, err := policy.MemberScope(context.Background(), actor, ActionRecordPayments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if school.ID != "s1" || branchID != "b1" {
+		t.Fatalf("scope = %s/%s, want s1/b1", school.ID, branchID)
+	}
+
+	// Requests for the whole school are not theirs to make.
+	expectMember(mock, "manager", domain.SchoolRoleBranchManager, "b1")
+	expectSchool(mock)
+	if _, err := policy.MemberSchool(context.Background(), actor, ActionRecordPayments); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("MemberSchool err = %v, want ErrForbidden", err)
+	}
+
+	expectMember(mock, "manager", "", "")
+	if _, _, err := policy.MemberScope(context.Background(), actor, ActionRecordPayments); !errors.Is(err, repository.ErrSchoolNotFound) {
+		t.Fatalf("non-member err = %v, want ErrSchoolNotFound", err)
+	}
+}
+
+func TestBranchRecordsByStaffRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   domain.SchoolRole
+		branch string
+		want   bool
+	}{
+		{"school admin", domain.SchoolRoleAdmin, "", true},
+		{"registrar", domain.SchoolRoleRegistrar, "", true},
+		{"accountant", domain.SchoolRoleAccountant, "", false},
+		{"branch manager", domain.SchoolRoleBranchManager, "b1", true},
+		{"other branch's manager", domain.SchoolRoleBranchManager, "b2", false},
+		{"not on the staff", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			policy := NewPolicy(nil, nil, nil, &repository.SchoolMemberRepository{DB: db}, &repository.BranchRepository{DB: db}, nil)
+			created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			mock.ExpectQuery(`FROM school_branches\s+WHERE id = \?`).WithArgs("b1").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "school_id", "name", "address", "city", "phone", "created_at", "updated_at"}).
+					AddRow("b1", "s1", "Khujand", "", "Khujand", "", created, created))
+			expectMember(mock, "u1", tt.role, tt.branch)
+
+			err := policy.Can(context.Background(), Actor{UserID: "u1", Role: domain.RoleSchoolAdmin}, ActionManageRooms, BranchResource("b1"))
+			if tt.want && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.want && !errors.Is(err, ErrForbidden) {
+				t.Fatalf("allowed (err %v), want ErrForbidden", err)
+			}
+		})
+	}
+}
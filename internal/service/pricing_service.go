@@ -0,0 +1,484 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrPromoCodeInvalid = errors.New("promo code is invalid or expired")
+	ErrPromoCodeTaken   = errors.New("promo code already exists")
+	ErrPricingForbidden = errors.New("you cannot manage pricing for this course")
+)
+
+type PricingService struct {
+	pricingRepo *repository.PricingRepository
+	courseRepo  *repository.CourseRepository
+	schoolRepo  *repository.SchoolRepository
+	rates       *ExchangeRateService
+	policy      *Policy
+}
+
+func NewPricingService(pricingRepo *repository.PricingRepository, courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository, rates *ExchangeRateService, policy *Policy) *PricingService {
+	return &PricingService{
+		pricingRepo: pricingRepo,
+		courseRepo:  courseRepo,
+		schoolRepo:  schoolRepo,
+		rates:       rates,
+		policy:      policy,
+	}
+}
+
+// Quote computes what a student pays for a course. Discounts stack in a fixed order,
+// each on what is left after the previous one: scholarship, sibling discount, promo code.
+// Fixed discounts are converted to the course's currency at today's rates.
+// promoCode is only previewed, not redeemed; without one, the code the student already
+// redeemed for the course applies.
+func (s *PricingService) Quote(ctx context.Context, studentUserID, courseID, promoCode string) (*domain.PriceQuote, error) {
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var promo *domain.PromoCode
+	if promoCode != "" {
+		if promo, err = s.validPromoCode(ctx, promoCode, studentUserID, course); err != nil {
+			return nil, err
+		}
+	}
+	return s.quote(ctx, studentUserID, course, promo)
+}
+
+// EffectivePrice is the per-period price a student pays for a course, used for invoices and checkout.
+func (s *PricingService) EffectivePrice(ctx context.Context, studentUserID string, course *domain.Course) (float64, error) {
+	q, err := s.quote(ctx, studentUserID, course, nil)
+	if err != nil {
+		return 0, err
+	}
+	return q.EffectivePrice, nil
+}
+
+// ApplyPromoCode redeems a code for the student's course. The discount then sticks to
+// the course, so every later invoice and checkout uses it.
+func (s *PricingService) ApplyPromoCode(ctx context.Context, studentUserID, courseID, code string) (*domain.PriceQuote, error) {
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	promo, err := s.validPromoCode(ctx, code, studentUserID, course)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pricingRepo.RedeemPromoCode(ctx, promo.ID, studentUserID, course.ID); err != nil {
+		return nil, err
+	}
+	return s.quote(ctx, studentUserID, course, promo)
+}
+
+// ReservePromoCode holds one use of a code for a checkout, so the code is only redeemed
+// once the payment settles. See ConfirmPromoCode and ReleasePromoCode.
+func (s *PricingService) ReservePromoCode(ctx context.Context, studentUserID, courseID, code, paymentID string) error {
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return err
+	}
+	promo, err := s.validPromoCode(ctx, code, studentUserID, course)
+	if err != nil {
+		return err
+	}
+	_, err = s.pricingRepo.ReservePromoCode(ctx, promo.ID, studentUserID, course.ID, paymentID)
+	return err
+}
+
+// ConfirmPromoCode redeems the code a settled payment reserved, if any.
+func (s *PricingService) ConfirmPromoCode(ctx context.Context, paymentID string) error {
+	return s.pricingRepo.ConfirmPromoReservation(ctx, paymentID)
+}
+
+// ReleasePromoCode gives back the use of a code a failed or expired payment reserved, if any.
+func (s *PricingService) ReleasePromoCode(ctx context.Context, paymentID string) error {
+	return s.pricingRepo.ReleasePromoReservation(ctx, paymentID)
+}
+
+func (s *PricingService) quote(ctx context.Context, studentUserID string, course *domain.Course, promo *domain.PromoCode) (*domain.PriceQuote, error) {
+	q := &domain.PriceQuote{
+		CourseID:     course.ID,
+		BasePrice:    course.Price,
+		Currency:     course.Currency,
+		Adjustments:  []domain.PriceAdjustment{},
+		BillingCycle: course.BillingCycle,
+	}
+	price := course.Price
+	now := time.Now()
+	apply := func(kind, label, discountType string, value float64, currency string) error {
+		if discountType == domain.DiscountTypeFixed {
+			var err error
+			if value, err = s.rates.Convert(ctx, value, currency, course.Currency, now); err != nil {
+				return err
+			}
+		}
+		off := discountAmount(price, discountType, value)
+		if off <= 0 {
+			return nil
+		}
+		price = roundMoney(price - off)
+		q.Adjustments = append(q.Adjustments, domain.PriceAdjustment{Kind: kind, Label: label, Amount: off})
+		return nil
+	}
+
+	if course.SchoolID != nil {
+		scholarship, err := s.pricingRepo.FindScholarship(ctx, *course.SchoolID, studentUserID, course.ID, now.Format(dateLayout))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if scholarship != nil {
+			label := "Scholarship"
+			if scholarship.Note != "" {
+				label += ": " + scholarship.Note
+			}
+			if err := apply(domain.PriceAdjustmentScholarship, label, scholarship.DiscountType, scholarship.Value, scholarship.Currency); err != nil {
+				return nil, err
+			}
+		}
+
+		percent, err := s.pricingRepo.GetSiblingDiscount(ctx, *course.SchoolID)
+		if err != nil {
+			return nil, err
+		}
+		if percent > 0 {
+			hasSibling, err := s.pricingRepo.HasEarlierSibling(ctx, studentUserID, *course.SchoolID)
+			if err != nil {
+				return nil, err
+			}
+			if hasSibling {
+				if err := apply(domain.PriceAdjustmentSibling, fmt.Sprintf("Sibling discount %g%%", percent), domain.DiscountTypePercent, percent, ""); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if promo == nil {
+		redeemed, err := s.pricingRepo.GetRedeemedPromoCode(ctx, studentUserID, course.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		// A redeemed code stops applying once it is deactivated, expires or no longer
+		// covers the course; the student already holds one of its uses.
+		if redeemed != nil && promoApplies(redeemed, course, now) {
+			promo = redeemed
+		}
+	}
+	if promo != nil {
+		if err := apply(domain.PriceAdjustmentPromo, "Promo code "+promo.Code, promo.DiscountType, promo.Value, promo.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	q.EffectivePrice = price
+	return q, nil
+}
+
+// validPromoCode checks a code can be used now by the student for the course. A code the
+// student already redeemed for the course stays usable when its uses run out.
+func (s *PricingService) validPromoCode(ctx context.Context, code, studentUserID string, course *domain.Course) (*domain.PromoCode, error) {
+	promo, err := s.pricingRepo.GetPromoCodeByCode(ctx, strings.TrimSpace(code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPromoCodeInvalid
+		}
+		return nil, err
+	}
+	if !promoApplies(promo, course, time.Now()) {
+		return nil, ErrPromoCodeInvalid
+	}
+	if promo.MaxUses != nil && promo.UsedCount >= *promo.MaxUses {
+		redeemed, err := s.pricingRepo.GetRedeemedPromoCode(ctx, studentUserID, course.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if redeemed == nil || redeemed.ID != promo.ID {
+			return nil, repository.ErrPromoCodeExhausted
+		}
+	}
+	return promo, nil
+}
+
+// promoApplies reports whether a code is active and in its validity window at now, and
+// covers the course.
+func promoApplies(promo *domain.PromoCode, course *domain.Course, now time.Time) bool {
+	if !promo.IsActive ||
+		(promo.ValidFrom != nil && now.Before(*promo.ValidFrom)) ||
+		(promo.ValidUntil != nil && now.After(*promo.ValidUntil)) {
+		return false
+	}
+	if promo.SchoolID != nil && (course.SchoolID == nil || *course.SchoolID != *promo.SchoolID) {
+		return false
+	}
+	return promo.CourseID == nil || *promo.CourseID == course.ID
+}
+
+type PromoCodeInput struct {
+	Code         string     `json:"code"`
+	CourseID     *string    `json:"course_id"`
+	DiscountType string     `json:"discount_type"` // percent, fixed
+	Value        float64    `json:"value"`
+	Currency     string     `json:"currency"` // of a fixed value; defaults to the course's, else TJS
+	MaxUses      *int       `json:"max_uses"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `json:"valid_until"`
+}
+
+// CreatePromoCode creates a code. School admins create codes for their school (optionally
+// one course), teachers for one of their independent courses, and admins anything, including
+// platform-wide codes.
+func (s *PricingService) CreatePromoCode(ctx context.Context, actor Actor, input PromoCodeInput) (*domain.PromoCode, error) {
+	code := strings.ToUpper(strings.TrimSpace(input.Code))
+	if code == "" || len(code) > 50 {
+		return nil, errors.New("code is required and must be at most 50 characters")
+	}
+	if err := validateDiscount(input.DiscountType, input.Value); err != nil {
+		return nil, err
+	}
+	if input.MaxUses != nil && *input.MaxUses <= 0 {
+		return nil, errors.New("max_uses must be positive")
+	}
+	if input.ValidFrom != nil && input.ValidUntil != nil && input.ValidUntil.Before(*input.ValidFrom) {
+		return nil, errors.New("valid_until must be after valid_from")
+	}
+
+	promo := &domain.PromoCode{
+		Code:         code,
+		CreatedBy:    actor.UserID,
+		DiscountType: input.DiscountType,
+		Value:        input.Value,
+		MaxUses:      input.MaxUses,
+		ValidFrom:    input.ValidFrom,
+		ValidUntil:   input.ValidUntil,
+	}
+
+	if input.CourseID != nil && *input.CourseID != "" {
+		c, err := s.courseRepo.GetCourseByID(ctx, *input.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.policy.Can(ctx, actor, ActionManagePayments, CourseResource(c.ID)); err != nil {
+			if errors.Is(err, ErrForbidden) {
+				return nil, ErrPricingForbidden
+			}
+			return nil, err
+		}
+		promo.CourseID = &c.ID
+		promo.SchoolID = c.SchoolID
+		if input.Currency == "" {
+			input.Currency = c.Currency
+		}
+	} else {
+		// A code for every course: platform-wide for admins, school-wide for school staff.
+		if s.policy.Can(ctx, actor, ActionManagePayments, Platform()) != nil {
+			school, err := s.memberSchool(ctx, actor)
+			if err != nil {
+				return nil, err
+			}
+			promo.SchoolID = &school.ID
+		}
+	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	promo.Currency = currency
+
+	if _, err := s.pricingRepo.GetPromoCodeByCode(ctx, code); err == nil {
+		return nil, ErrPromoCodeTaken
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if err := s.pricingRepo.CreatePromoCode(ctx, promo); err != nil {
+		return nil, err
+	}
+	return promo, nil
+}
+
+// memberSchool returns the school whose pricing the actor manages, and ErrPricingForbidden
+// if they are not on the staff of a school or their role does not cover payments.
+func (s *PricingService) memberSchool(ctx context.Context, actor Actor) (*domain.School, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManagePayments)
+	if errors.Is(err, ErrForbidden) || errors.Is(err, repository.ErrSchoolNotFound) {
+		return nil, ErrPricingForbidden
+	}
+	return school, err
+}
+
+// ListPromoCodes returns the codes the actor manages: every code for platform admins, the
+// school's codes for its staff, and otherwise the codes they created.
+func (s *PricingService) ListPromoCodes(ctx context.Context, actor Actor) ([]domain.PromoCode, error) {
+	if s.policy.Can(ctx, actor, ActionManagePayments, Platform()) == nil {
+		return s.pricingRepo.ListPromoCodes(ctx, "")
+	}
+	school, err := s.memberSchool(ctx, actor)
+	switch {
+	case err == nil:
+		return s.pricingRepo.ListPromoCodes(ctx, school.ID)
+	case errors.Is(err, ErrPricingForbidden):
+		return s.pricingRepo.ListPromoCodesByCreator(ctx, actor.UserID)
+	default:
+		return nil, err
+	}
+}
+
+// DeactivatePromoCode stops a code from being redeemed, and from applying to students who redeemed it.
+// A school's codes are managed by its staff, other codes by whoever created them.
+func (s *PricingService) DeactivatePromoCode(ctx context.Context, actor Actor, id string) error {
+	promo, err := s.pricingRepo.GetPromoCodeByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.policy.Can(ctx, actor, ActionManagePayments, Platform()) == nil:
+	case promo.SchoolID != nil:
+		school, err := s.memberSchool(ctx, actor)
+		if err != nil {
+			return err
+		}
+		if *promo.SchoolID != school.ID {
+			return ErrPricingForbidden
+		}
+	case promo.CreatedBy != actor.UserID:
+		return ErrPricingForbidden
+	}
+	return s.pricingRepo.DeactivatePromoCode(ctx, id)
+}
+
+type ScholarshipInput struct {
+	StudentUserID string  `json:"student_user_id"`
+	CourseID      *string `json:"course_id"`
+	DiscountType  string  `json:"discount_type"` // percent, fixed
+	Value         float64 `json:"value"`
+	Currency      string  `json:"currency"` // of a fixed value; defaults to the course's, else TJS
+	Note          string  `json:"note"`
+	ValidUntil    *string `json:"valid_until"` // YYYY-MM-DD
+}
+
+// CreateScholarship grants a student a discount at the staff member's school.
+func (s *PricingService) CreateScholarship(ctx context.Context, actor Actor, input ScholarshipInput) (*domain.Scholarship, error) {
+	school, err := s.memberSchool(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if input.StudentUserID == "" {
+		return nil, errors.New("student_user_id is required")
+	}
+	if err := validateDiscount(input.DiscountType, input.Value); err != nil {
+		return nil, err
+	}
+	if input.ValidUntil != nil {
+		if _, err := time.Parse(dateLayout, *input.ValidUntil); err != nil {
+			return nil, errors.New("valid_until must be YYYY-MM-DD")
+		}
+	}
+	if input.CourseID != nil && *input.CourseID == "" {
+		input.CourseID = nil
+	}
+	if input.CourseID != nil {
+		course, err := s.courseRepo.GetCourseByID(ctx, *input.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		if course.SchoolID == nil || *course.SchoolID != school.ID {
+			return nil, ErrPricingForbidden
+		}
+		if input.Currency == "" {
+			input.Currency = course.Currency
+		}
+	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	scholarship := &domain.Scholarship{
+		SchoolID:      school.ID,
+		StudentUserID: input.StudentUserID,
+		CourseID:      input.CourseID,
+		DiscountType:  input.DiscountType,
+		Value:         input.Value,
+		Currency:      currency,
+		Note:          input.Note,
+		ValidUntil:    input.ValidUntil,
+		CreatedBy:     actor.UserID,
+	}
+	if err := s.pricingRepo.CreateScholarship(ctx, scholarship); err != nil {
+		return nil, err
+	}
+	return scholarship, nil
+}
+
+func (s *PricingService) ListScholarships(ctx context.Context, actor Actor) ([]domain.Scholarship, error) {
+	school, err := s.memberSchool(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	return s.pricingRepo.ListScholarshipsBySchool(ctx, school.ID)
+}
+
+func (s *PricingService) DeleteScholarship(ctx context.Context, actor Actor, id string) error {
+	school, err := s.memberSchool(ctx, actor)
+	if err != nil {
+		return err
+	}
+	return s.pricingRepo.DeleteScholarship(ctx, id, school.ID)
+}
+
+// SetSiblingDiscount sets the percentage taken off for second and later siblings at the school.
+func (s *PricingService) SetSiblingDiscount(ctx context.Context, actor Actor, percent float64) error {
+	if percent < 0 || percent > 100 {
+		return errors.New("percent must be between 0 and 100")
+	}
+	school, err := s.memberSchool(ctx, actor)
+	if err != nil {
+		return err
+	}
+	return s.pricingRepo.SetSiblingDiscount(ctx, school.ID, percent)
+}
+
+func validateDiscount(discountType string, value float64) error {
+	switch discountType {
+	case domain.DiscountTypePercent:
+		if value <= 0 || value > 100 {
+			return errors.New("percent discount must be between 0 and 100")
+		}
+	case domain.DiscountTypeFixed:
+		if value <= 0 {
+			return errors.New("fixed discount must be positive")
+		}
+	default:
+		return errors.New("discount_type must be percent or fixed")
+	}
+	return nil
+}
+
+// discountAmount is how much a discount takes off price, never more than the price itself.
+func discountAmount(price float64, discountType string, value float64) float64 {
+	var off float64
+	switch discountType {
+	case domain.DiscountTypePercent:
+		off = price * value / 100
+	case domain.DiscountTypeFixed:
+		off = value
+	}
+	return roundMoney(math.Min(off, price))
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestPromoApplies(t *testing.T) {
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	yesterday, tomorrow := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	school, otherSchool := "school-1", "school-2"
+	course, otherCourse := "course-1", "course-2"
+	c := &domain.Course{ID: course, SchoolID: &school}
+
+	tests := []struct {
+		name  string
+		promo domain.PromoCode
+		want  bool
+	}{
+		{"platform-wide", domain.PromoCode{IsActive: true}, true},
+		{"deactivated", domain.PromoCode{IsActive: false}, false},
+		{"not started", domain.PromoCode{IsActive: true, ValidFrom: &tomorrow}, false},
+		{"expired", domain.PromoCode{IsActive: true, ValidUntil: &yesterday}, false},
+		{"in window", domain.PromoCode{IsActive: true, ValidFrom: &yesterday, ValidUntil: &tomorrow}, true},
+		{"same school", domain.PromoCode{IsActive: true, SchoolID: &school}, true},
+		{"other school", domain.PromoCode{IsActive: true, SchoolID: &otherSchool}, false},
+		{"same course", domain.PromoCode{IsActive: true, SchoolID: &school, CourseID: &course}, true},
+		{"other course", domain.PromoCode{IsActive: true, SchoolID: &school, CourseID: &otherCourse}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promoApplies(&tt.promo, c, now); got != tt.want {
+				t.Fatalf("promoApplies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	independent := &domain.Course{ID: course}
+	if promoApplies(&domain.PromoCode{IsActive: true, SchoolID: &school}, independent, now) {
+		t.Fatal("a school's code applied to an independent course")
+	}
+}
+
+func TestQuoteConvertsFixedDiscounts(t *testing.T) {
+	db, mock := newMockDB(t)
+	s := NewPricingService(&repository.PricingRepository{DB: db}, nil, nil,
+		NewExchangeRateService(&repository.ExchangeRateRepository{DB: db}, nil), nil)
+	school := "school-1"
+	course := &domain.Course{ID: "course-1", SchoolID: &school, Price: 100, Currency: domain.CurrencyUSD}
+
+	// A 109 TJS scholarship is 10 USD at 10.9 TJS per dollar, not 109 USD.
+	mock.ExpectQuery(`FROM scholarships sc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "school_id", "student_user_id", "name", "course_id", "title",
+			"discount_type", "value", "currency", "note", "valid_until", "created_by", "created_at"}).
+			AddRow("sch-1", school, "student-1", "Student", nil, nil,
+				domain.DiscountTypeFixed, 109, domain.CurrencyTJS, "", nil, "admin", time.Now()))
+	mock.ExpectQuery(`SELECT rate FROM exchange_rates`).WithArgs(domain.CurrencyUSD, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"rate"}).AddRow(10.9))
+	mock.ExpectQuery(`SELECT sibling_discount_percent FROM schools`).
+		WillReturnRows(sqlmock.NewRows([]string{"percent"}).AddRow(0))
+
+	promo := &domain.PromoCode{Code: "FIVE", DiscountType: domain.DiscountTypeFixed, Value: 5, Currency: domain.CurrencyUSD}
+	q, err := s.quote(context.Background(), "student-1", course, promo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.EffectivePrice != 85 || q.Currency != domain.CurrencyUSD {
+		t.Fatalf("quote = %v %s, want 85 USD", q.EffectivePrice, q.Currency)
+	}
+	if len(q.Adjustments) != 2 || q.Adjustments[0].Amount != 10 || q.Adjustments[1].Amount != 5 {
+		t.Fatalf("adjustments = %+v, want 10 then 5", q.Adjustments)
+	}
+}
+
+func TestQuoteWithoutExchangeRate(t *testing.T) {
+	db, mock := newMockDB(t)
+	s := NewPricingService(&repository.PricingRepository{DB: db}, nil, nil,
+		NewExchangeRateService(&repository.ExchangeRateRepository{DB: db}, nil), nil)
+	course := &domain.Course{ID: "course-1", Price: 500, Currency: domain.CurrencyTJS}
+
+	mock.ExpectQuery(`SELECT rate FROM exchange_rates`).WithArgs(domain.CurrencyUSD, sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+
+	promo := &domain.PromoCode{Code: "TEN", DiscountType: domain.DiscountTypeFixed, Value: 10, Currency: domain.CurrencyUSD}
+	if _, err := s.quote(context.Background(), "student-1", course, promo); !errors.Is(err, ErrNoExchangeRate) {
+		t.Fatalf("quote err = %v, want ErrNoExchangeRate", err)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schooltj/internal/repository"
+)
+
+// RateLimit allows Requests requests per Per window, refilling smoothly: a token bucket
+// holding Requests tokens that regains them all over Per.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRateLimit reads a limit written as "<requests>/<duration>", e.g. "10/1m".
+func ParseRateLimit(s string) (RateLimit, error) {
+	count, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q: want <requests>/<duration>", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: requests must be a positive integer", s)
+	}
+	per, err := time.ParseDuration(window)
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: invalid duration", s)
+	}
+	return RateLimit{Requests: n, Per: per}, nil
+}
+
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// RateLimiter counts requests against per-key token buckets.
+type RateLimiter interface {
+	// Take spends one token from key's bucket. If none is left it returns false and how
+	// long until the next one.
+	Take(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// MemoryRateLimiter keeps buckets in process memory. It suits a single API instance.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time // when the bucket will have refilled, after which it can be forgotten
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: map[string]*memoryBucket{}, lastSweep: time.Now()}
+}
+
+func (m *MemoryRateLimiter) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	burst, perSecond := float64(limit.Requests), limit.perSecond()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: burst, updatedAt: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*perSecond)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		b.tokens--
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.fullAt = now.Add(time.Duration((burst - b.tokens) / perSecond * float64(time.Second)))
+	return allowed, retryAfter, nil
+}
+
+// sweep forgets full buckets once a minute so the map does not grow without bound.
+func (m *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// DBRateLimiter keeps buckets in the database so every API instance shares them.
+type DBRateLimiter struct {
+	repo      *repository.RateLimitRepository
+	idleAfter time.Duration // buckets idle this long are purged; must exceed the longest window
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewDBRateLimiter(repo *repository.RateLimitRepository) *DBRateLimiter {
+	return &DBRateLimiter{repo: repo, idleAfter: 24 * time.Hour, lastPurge: time.Now()}
+}
+
+func (d *DBRateLimiter) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	d.purge(ctx, now)
+	return d.repo.Take(ctx, key, float64(limit.Requests), limit.perSecond(), now)
+}
+
+// purge drops idle buckets at most once an hour. Failures only delay the cleanup.
+func (d *DBRateLimiter) purge(ctx context.Context, now time.Time) {
+	d.mu.Lock()
+	due := now.Sub(d.lastPurge) >= time.Hour
+	if due {
+		d.lastPurge = now
+	}
+	d.mu.Unlock()
+	if due {
+		d.repo.DeleteIdleSince(ctx, now.Add(-d.idleAfter))
+	}
+}
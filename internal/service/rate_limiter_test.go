@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"10/1m", RateLimit{Requests: 10, Per: time.Minute}, false},
+		{" 5/30s ", RateLimit{Requests: 5, Per: 30 * time.Second}, false},
+		{"10", RateLimit{}, true},
+		{"0/1m", RateLimit{}, true},
+		{"ten/1m", RateLimit{}, true},
+		{"10/soon", RateLimit{}, true},
+		{"10/-1m", RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRateLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRateLimit(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// rewind makes the bucket under key look last used d earlier, as if d had passed.
+func (m *MemoryRateLimiter) rewind(key string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets[key].updatedAt = m.buckets[key].updatedAt.Add(-d)
+}
+
+func TestMemoryRateLimiterRefillsOverTheWindow(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryRateLimiter()
+	limit := RateLimit{Requests: 2, Per: time.Minute} // a token every 30s
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := m.Take(ctx, "ip:1", limit); !allowed {
+			t.Fatalf("request %d refused within the burst", i+1)
+		}
+	}
+	allowed, retryAfter, err := m.Take(ctx, "ip:1", limit)
+	if err != nil || allowed {
+		t.Fatalf("third request allowed = %v (err %v), want refused", allowed, err)
+	}
+	if retryAfter < 29*time.Second || retryAfter > 30*time.Second {
+		t.Fatalf("retryAfter = %v, want about 30s", retryAfter)
+	}
+
+	// Other keys have their own buckets.
+	if allowed, _, _ := m.Take(ctx, "ip:2", limit); !allowed {
+		t.Fatal("another key refused")
+	}
+
+	// Half a token back: still refused, with half the wait.
+	m.rewind("ip:1", 15*time.Second)
+	if allowed, retryAfter, _ := m.Take(ctx, "ip:1", limit); allowed || retryAfter < 14*time.Second || retryAfter > 15*time.Second {
+		t.Fatalf("after 15s allowed = %v, retryAfter = %v; want refused for about 15s", allowed, retryAfter)
+	}
+	m.rewind("ip:1", 15*time.Second)
+	if allowed, _, _ := m.Take(ctx, "ip:1", limit); !allowed {
+		t.Fatal("refused after a token refilled")
+	}
+
+	// A long pause refills the bucket only up to the burst.
+	m.rewind("ip:1", time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := m.Take(ctx, "ip:1", limit); !allowed {
+			t.Fatalf("request %d after a pause refused", i+1)
+		}
+	}
+	if allowed, _, _ := m.Take(ctx, "ip:1", limit); allowed {
+		t.Fatal("bucket refilled past its burst")
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/schooltj/internal/domain"
+)
+
+//go:embed fonts/DejaVuSansCondensed.ttf
+var receiptFontRegular []byte
+
+//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+var receiptFontBold []byte
+
+// receiptData is everything printed on a receipt.
+type receiptData struct {
+	Number      int
+	IssuedAt    time.Time
+	IssuerName  string
+	TaxID       string
+	Address     string
+	StudentName string
+	CourseTitle string
+	Amount      float64
+	Currency    string
+	Method      string
+	PaymentID   string
+	PaidAt      time.Time
+}
+
+// Receipts are trilingual: every label is printed in Tajik, Russian and English.
+var (
+	receiptTitle  = "Квитансия / Квитанция / Receipt"
+	receiptLabels = map[string]string{
+		"date":    "Сана / Дата / Date",
+		"issuer":  "Ташкилот / Организация / Issued by",
+		"tax_id":  "РМА / ИНН / Tax ID",
+		"address": "Суроға / Адрес / Address",
+		"student": "Хонанда / Ученик / Student",
+		"course":  "Курс / Курс / Course",
+		"amount":  "Маблағ / Сумма / Amount",
+		"method":  "Тарзи пардохт / Способ оплаты / Payment method",
+		"paid_at": "Санаи пардохт / Дата оплаты / Paid on",
+		"ref":     "Рақами пардохт / Номер платежа / Payment reference",
+	}
+	receiptMethods = map[string]string{
+		domain.PaymentMethodCash:       "Нақд / Наличные / Cash",
+		domain.PaymentMethodCard:       "Корт / Карта / Card",
+		domain.PaymentMethodTransfer:   "Интиқол / Перевод / Bank transfer",
+		domain.PaymentMethodAlif:       "Alif",
+		domain.PaymentMethodHumo:       "Humo",
+		domain.PaymentMethodKortiMilli: "Корти Миллӣ / Корти Милли / Korti Milli",
+		domain.PaymentMethodOther:      "Дигар / Другое / Other",
+	}
+	receiptFooter = "Квитансия ба таври электронӣ сохта шудааст. / Квитанция сформирована электронно. / This receipt was generated electronically."
+)
+
+// formatReceiptNumber renders the printed receipt number, e.g. 000042.
+func formatReceiptNumber(n int) string {
+	return fmt.Sprintf("%06d", n)
+}
+
+// renderReceiptPDF writes an A5 receipt to w.
+func renderReceiptPDF(w io.Writer, d receiptData) error {
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.AddUTF8FontFromBytes("DejaVu", "", receiptFontRegular)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", receiptFontBold)
+	pdf.SetTitle(receiptTitle+" "+formatReceiptNumber(d.Number), true)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 12)
+	pdf.AddPage()
+
+	pageW, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	contentW := pageW - left - right
+
+	pdf.SetFont("DejaVu", "B", 14)
+	pdf.CellFormat(contentW, 8, receiptTitle, "", 1, "C", false, 0, "")
+	pdf.SetFont("DejaVu", "B", 12)
+	pdf.CellFormat(contentW, 7, "№ "+formatReceiptNumber(d.Number), "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+
+	method := receiptMethods[d.Method]
+	if method == "" {
+		method = d.Method
+	}
+	currency := d.Currency
+	if currency == "" {
+		currency = "TJS"
+	}
+
+	rows := [][2]string{
+		{receiptLabels["date"], d.IssuedAt.Format("02.01.2006")},
+		{receiptLabels["issuer"], d.IssuerName},
+	}
+	if d.TaxID != "" {
+		rows = append(rows, [2]string{receiptLabels["tax_id"], d.TaxID})
+	}
+	if d.Address != "" {
+		rows = append(rows, [2]string{receiptLabels["address"], d.Address})
+	}
+	rows = append(rows,
+		[2]string{receiptLabels["student"], d.StudentName},
+		[2]string{receiptLabels["course"], d.CourseTitle},
+		[2]string{receiptLabels["amount"], fmt.Sprintf("%.2f %s", d.Amount, currency)},
+		[2]string{receiptLabels["method"], method},
+		[2]string{receiptLabels["paid_at"], d.PaidAt.Format("02.01.2006")},
+		[2]string{receiptLabels["ref"], d.PaymentID},
+	)
+
+	for _, row := range rows {
+		pdf.SetFont("DejaVu", "", 7)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.MultiCell(contentW, 4, row[0], "", "L", false)
+		pdf.SetFont("DejaVu", "B", 10)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.MultiCell(contentW, 5.5, row[1], "B", "L", false)
+		pdf.Ln(2)
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("DejaVu", "", 7)
+	pdf.SetTextColor(110, 110, 110)
+	pdf.MultiCell(contentW, 4, receiptFooter, "", "C", false)
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+// receiptsDir sits next to uploadsDir in the same local file storage.
+const receiptsDir = "uploads/receipts"
+
+var ErrReceiptUnavailable = errors.New("receipts are only issued for successful payments")
+
+type ReceiptService struct {
+	receiptRepo *repository.ReceiptRepository
+	paymentRepo *repository.PaymentRepository
+	courseRepo  *repository.CourseRepository
+	schoolRepo  *repository.SchoolRepository
+	policy      *Policy
+}
+
+func NewReceiptService(receiptRepo *repository.ReceiptRepository, paymentRepo *repository.PaymentRepository, courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository, policy *Policy) *ReceiptService {
+	return &ReceiptService{
+		receiptRepo: receiptRepo,
+		paymentRepo: paymentRepo,
+		courseRepo:  courseRepo,
+		schoolRepo:  schoolRepo,
+		policy:      policy,
+	}
+}
+
+// Issue generates the receipt for a settled payment, or returns the existing one.
+func (s *ReceiptService) Issue(ctx context.Context, paymentID string) (*domain.Receipt, error) {
+	existing, err := s.receiptRepo.GetByPaymentID(ctx, paymentID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	payment, err := s.paymentRepo.GetByID(ctx, paymentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	switch payment.Status {
+	case domain.PaymentStatusSuccess, domain.PaymentStatusPartiallyRefunded, domain.PaymentStatusRefunded:
+	default:
+		return nil, ErrReceiptUnavailable
+	}
+
+	course, err := s.courseRepo.GetCourseByID(ctx, payment.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	data := receiptData{
+		StudentName: payment.StudentName,
+		CourseTitle: payment.CourseTitle,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+		Method:      payment.Method,
+		PaymentID:   payment.ID,
+		PaidAt:      payment.PaidAt,
+	}
+
+	// Independent courses are receipted by their teacher.
+	var issuerID string
+	if course.SchoolID != nil {
+		school, err := s.schoolRepo.GetSchoolByID(ctx, *course.SchoolID)
+		if err != nil {
+			return nil, err
+		}
+		issuerID = school.ID
+		data.IssuerName = school.Name
+		data.TaxID = school.TaxID
+		data.Address = school.Address
+		if school.City != "" {
+			if data.Address != "" {
+				data.Address += ", "
+			}
+			data.Address += school.City
+		}
+	} else if course.TeacherID != nil {
+		issuerID = *course.TeacherID
+		data.IssuerName = course.TeacherName
+	} else {
+		return nil, errors.New("course has no school or teacher to issue the receipt")
+	}
+
+	var written string
+	receipt, err := s.receiptRepo.Issue(ctx, payment.ID, issuerID, func(number int) (string, error) {
+		dir := filepath.Join(receiptsDir, issuerID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create receipt directory: %w", err)
+		}
+		path := filepath.Join(dir, formatReceiptNumber(number)+".pdf")
+		f, err := os.Create(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to create receipt file: %w", err)
+		}
+		written = path
+
+		data.Number = number
+		data.IssuedAt = time.Now()
+		if err := renderReceiptPDF(f, data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return path, f.Close()
+	})
+	if err != nil {
+		if written != "" {
+			os.Remove(written)
+		}
+		return nil, err
+	}
+	receipt.CreatedAt = time.Now()
+
+	_ = s.paymentRepo.SetReceiptURL(ctx, payment.ID, fmt.Sprintf("/api/payments/%s/receipt", payment.ID))
+	return receipt, nil
+}
+
+// GetForDownload returns a payment's receipt, issuing it on first access.
+// The payer and the staff who can see the course's payments may download it.
+func (s *ReceiptService) GetForDownload(ctx context.Context, userID string, role domain.Role, paymentID string) (*domain.Receipt, error) {
+	payment, err := s.paymentRepo.GetByID(ctx, paymentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+
+	if payment.StudentUserID != userID {
+		err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionRecordPayments, CourseResource(payment.CourseID))
+		if errors.Is(err, ErrForbidden) {
+			return nil, ErrPaymentForbidden
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Issue(ctx, paymentID)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestFormatReceiptNumber(t *testing.T) {
+	for n, want := range map[int]string{1: "000001", 42: "000042", 999999: "999999", 1000000: "1000000"} {
+		if got := formatReceiptNumber(n); got != want {
+			t.Errorf("formatReceiptNumber(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+// newTestReceiptService returns a receipt service that writes its files under a fresh
+// working directory.
+func newTestReceiptService(t *testing.T) (*ReceiptService, sqlmock.Sqlmock) {
+	t.Chdir(t.TempDir())
+	db, mock := newMockDB(t)
+	return NewReceiptService(&repository.ReceiptRepository{DB: db}, &repository.PaymentRepository{DB: db},
+		&repository.CourseRepository{DB: db}, &repository.SchoolRepository{DB: db}, nil), mock
+}
+
+// expectNewReceipt answers the lookups of a payment without a receipt yet: the receipt,
+// the payment and its course, of school s1 when school is set and otherwise taught
+// independently by teacher-1.
+func expectNewReceipt(mock sqlmock.Sqlmock, p domain.Payment, school bool) {
+	mock.ExpectQuery(`FROM receipts WHERE payment_id = \?`).WithArgs(p.ID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`WHERE p\.id = \?`).WithArgs(p.ID).WillReturnRows(paymentRows(p))
+	if p.Status == domain.PaymentStatusPending {
+		return
+	}
+	teacher, schoolID := "teacher-1", "s1"
+	course := domain.Course{ID: p.CourseID, Title: "Course", TeacherID: &teacher}
+	if school {
+		course.SchoolID = &schoolID
+	}
+	expectCourse(mock, course)
+	if school {
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`FROM schools WHERE id = \?`).WithArgs("s1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "admin_user_id", "name", "description", "tax_id", "phone", "email", "address", "city",
+				"website", "logo_url", "reporting_currency", "is_verified", "rating_avg", "rating_count", "created_at", "updated_at"}).
+				AddRow("s1", "owner", "School", "", "123456789", "", "", "Rudaki 1", "Dushanbe", "", "", domain.CurrencyTJS, true, 0, 0, created, created))
+	}
+}
+
+// expectReceiptNumber answers the issuer's receipt counter, which stands at last.
+func expectReceiptNumber(mock sqlmock.Sqlmock, issuerID string, last int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT IGNORE INTO receipt_counters`).WithArgs(issuerID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT last_number FROM receipt_counters WHERE issuer_id = \? FOR UPDATE`).WithArgs(issuerID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_number"}).AddRow(last))
+}
+
+func TestIssueReceiptTakesTheIssuersNextNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		school bool
+		issuer string
+	}{
+		{"school course", true, "s1"},
+		{"independent course", false, "teacher-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestReceiptService(t)
+			expectNewReceipt(mock, settledPayment(domain.PaymentStatusSuccess, 0), tt.school)
+			expectReceiptNumber(mock, tt.issuer, 41)
+			path := filepath.Join(receiptsDir, tt.issuer, "000042.pdf")
+			mock.ExpectExec(`INSERT INTO receipts`).WithArgs(sqlmock.AnyArg(), "pay-1", tt.issuer, 42, path).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`UPDATE receipt_counters SET last_number = \?`).WithArgs(42, tt.issuer).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectExec(`UPDATE payments SET receipt_url = \?`).WithArgs("/api/payments/pay-1/receipt", "pay-1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+			receipt, err := s.Issue(context.Background(), "pay-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if receipt.Number != 42 || receipt.IssuerID != tt.issuer {
+				t.Fatalf("receipt %d of %s, want 42 of %s", receipt.Number, receipt.IssuerID, tt.issuer)
+			}
+			pdf, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(pdf, []byte("%PDF")) {
+				t.Fatalf("%s is not a PDF", path)
+			}
+		})
+	}
+}
+
+func TestIssueReceiptKeepsTheNumberWhenSavingFails(t *testing.T) {
+	s, mock := newTestReceiptService(t)
+	expectNewReceipt(mock, settledPayment(domain.PaymentStatusSuccess, 0), true)
+	expectReceiptNumber(mock, "s1", 41)
+	saveErr := errors.New("disk full")
+	mock.ExpectExec(`INSERT INTO receipts`).WillReturnError(saveErr)
+	// The counter is never moved on, so the next receipt gets 42 again.
+	mock.ExpectRollback()
+
+	if _, err := s.Issue(context.Background(), "pay-1"); !errors.Is(err, saveErr) {
+		t.Fatalf("err = %v, want %v", err, saveErr)
+	}
+	if _, err := os.Stat(filepath.Join(receiptsDir, "s1", "000042.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("the unsaved receipt's file was left behind (stat err %v)", err)
+	}
+}
+
+func TestIssueReceiptOnce(t *testing.T) {
+	s, mock := newTestReceiptService(t)
+	mock.ExpectQuery(`FROM receipts WHERE payment_id = \?`).WithArgs("pay-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id", "issuer_id", "number", "file_path", "created_at"}).
+			AddRow("rec-1", "pay-1", "s1", 7, "uploads/receipts/s1/000007.pdf", time.Now()))
+
+	receipt, err := s.Issue(context.Background(), "pay-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Number != 7 {
+		t.Fatalf("receipt number = %d, want the existing 7", receipt.Number)
+	}
+}
+
+func TestIssueReceiptOnlyForSettledPayments(t *testing.T) {
+	s, mock := newTestReceiptService(t)
+	expectNewReceipt(mock, settledPayment(domain.PaymentStatusPending, 0), true)
+
+	if _, err := s.Issue(context.Background(), "pay-1"); !errors.Is(err, ErrReceiptUnavailable) {
+		t.Fatalf("err = %v, want ErrReceiptUnavailable", err)
+	}
+}
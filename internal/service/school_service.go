@@ -3,73 +3,297 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/schooltj/internal/domain"
 	"github.com/schooltj/internal/repository"
 )
 
+var (
+	ErrTeacherEmailRequired   = errors.New("a valid email address is required")
+	ErrInviteeNotTeacher      = errors.New("this email belongs to an account that is not a teacher")
+	ErrNotTeacherAccount      = errors.New("only teacher accounts can accept a teacher invitation")
+	ErrInvitationForOtherUser = errors.New("this invitation was sent to a different email address")
+	ErrStaffEmailRequired     = errors.New("a valid email address is required")
+	ErrInvalidStaffRole       = errors.New("role must be admin, accountant, registrar or branch_manager")
+	ErrBranchRequired         = errors.New("a branch manager needs a branch_id")
+	ErrNotStaffAccount        = errors.New("this email belongs to an account that cannot join a school's staff")
+	ErrSchoolOwnerFixed       = errors.New("the school's owner cannot be changed or removed")
+	ErrOwnerManagesAdmins     = errors.New("only the school's owner can add, change or remove admins")
+)
+
+// staffRoles are the roles a member can be given. Every school has exactly one owner, the
+// account that created it.
+var staffRoles = map[domain.SchoolRole]bool{
+	domain.SchoolRoleAdmin:         true,
+	domain.SchoolRoleAccountant:    true,
+	domain.SchoolRoleRegistrar:     true,
+	domain.SchoolRoleBranchManager: true,
+}
+
 type SchoolService struct {
 	schoolRepo    *repository.SchoolRepository
+	invitations   *repository.TeacherInvitationRepository
+	members       *repository.SchoolMemberRepository
+	branches      *repository.BranchRepository
+	userRepo      *repository.UserRepository
 	authService   *AuthService
+	passwordReset *PasswordResetService
 	CourseService *CourseService // Exposed for seeding/internal use
+	email         *EmailService
+	policy        *Policy
+	appURL        string
+	inviteTTL     time.Duration
 }
 
-func NewSchoolService(schoolRepo *repository.SchoolRepository, authService *AuthService, courseService *CourseService) *SchoolService {
+// NewSchoolService builds the service. appURL is the web app's base URL, which serves the
+// page teacher invitation links open.
+func NewSchoolService(schoolRepo *repository.SchoolRepository, invitations *repository.TeacherInvitationRepository, members *repository.SchoolMemberRepository,
+	branches *repository.BranchRepository, userRepo *repository.UserRepository, authService *AuthService, passwordReset *PasswordResetService, courseService *CourseService,
+	email *EmailService, policy *Policy, appURL string) *SchoolService {
 	return &SchoolService{
 		schoolRepo:    schoolRepo,
+		invitations:   invitations,
+		members:       members,
+		branches:      branches,
+		userRepo:      userRepo,
 		authService:   authService,
+		passwordReset: passwordReset,
 		CourseService: courseService,
+		email:         email,
+		policy:        policy,
+		appURL:        strings.TrimRight(appURL, "/"),
+		inviteTTL:     7 * 24 * time.Hour,
+	}
+}
+
+// MySchool returns the school the actor is on the staff of, if their role permits the action.
+func (s *SchoolService) MySchool(ctx context.Context, actor Actor, action Action) (*domain.School, error) {
+	return s.policy.MemberSchool(ctx, actor, action)
+}
+
+// InviteTeacherToMySchool invites a teacher to the school the actor is on the staff of.
+func (s *SchoolService) InviteTeacherToMySchool(ctx context.Context, actor Actor, email, bio string) (*domain.TeacherInvitation, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManageTeachers)
+	if err != nil {
+		return nil, err
+	}
+	return s.InviteTeacher(ctx, actor, school.ID, email, bio)
+}
+
+// InviteTeacher emails a single-use invitation to teach at the school. An independent
+// teacher accepts it from their account and keeps their courses; someone new creates an
+// account from the link.
+func (s *SchoolService) InviteTeacher(ctx context.Context, actor Actor, schoolID, email, bio string) (*domain.TeacherInvitation, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageTeachers, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, ErrTeacherEmailRequired
+	}
+	school, err := s.schoolRepo.GetSchoolByID(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasAccount := false
+	existing, err := s.userRepo.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if existing.Role != domain.RoleTeacher {
+			return nil, ErrInviteeNotTeacher
+		}
+		profile, err := s.schoolRepo.GetTeacherProfile(ctx, existing.ID)
+		if err != nil && !errors.Is(err, repository.ErrTeacherProfileNotFound) {
+			return nil, err
+		}
+		if profile != nil && profile.SchoolID != nil && *profile.SchoolID == schoolID {
+			return nil, repository.ErrTeacherAlreadyInSchool
+		}
+		hasAccount = true
+	case !errors.Is(err, repository.ErrUserNotFound):
+		return nil, err
+	}
+
+	token, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	inv := &domain.TeacherInvitation{
+		SchoolID:   schoolID,
+		SchoolName: school.Name,
+		Email:      email,
+		Bio:        strings.TrimSpace(bio),
+		InvitedBy:  actor.UserID,
+		ExpiresAt:  time.Now().Add(s.inviteTTL),
 	}
+	if err := s.invitations.Create(ctx, inv, hashToken(token)); err != nil {
+		return nil, err
+	}
+	s.sendTeacherInvitation(inv, token, hasAccount)
+	return inv, nil
+}
+
+func (s *SchoolService) sendTeacherInvitation(inv *domain.TeacherInvitation, token string, hasAccount bool) {
+	link := s.appURL + "/accept-teacher-invite?token=" + url.QueryEscape(token)
+	s.email.SendTeacherInvitation(inv.Email, inv.SchoolName, link, hasAccount, s.inviteTTL)
+}
+
+// ListTeacherInvitations returns the school's pending and accepted invitations.
+func (s *SchoolService) ListTeacherInvitations(ctx context.Context, actor Actor, schoolID string) ([]domain.TeacherInvitation, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageTeachers, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	return s.invitations.ListBySchool(ctx, schoolID)
 }
 
-func (s *SchoolService) AddTeacherToSchool(ctx context.Context, adminUserID, teacherEmail, teacherPassword, bio string) (*domain.User, error) {
-	// 1. Get School of the Admin
-	school, err := s.schoolRepo.GetSchoolByAdminID(ctx, adminUserID)
+// managedInvitation loads an invitation the actor may manage.
+func (s *SchoolService) managedInvitation(ctx context.Context, actor Actor, invitationID string) (*domain.TeacherInvitation, error) {
+	inv, err := s.invitations.GetByID(ctx, invitationID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.policy.Can(ctx, actor, ActionManageTeachers, SchoolResource(inv.SchoolID)); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
 
-	// 2. Create User (Role Teacher)
-	user, err := s.authService.Register(ctx, teacherEmail, teacherPassword, domain.RoleTeacher)
+// ResendTeacherInvitation emails a pending invitation again with a fresh link and expiry.
+// Links sent earlier stop working.
+func (s *SchoolService) ResendTeacherInvitation(ctx context.Context, actor Actor, invitationID string) (*domain.TeacherInvitation, error) {
+	inv, err := s.managedInvitation(ctx, actor, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newSecureToken()
 	if err != nil {
 		return nil, err
 	}
+	expiresAt := time.Now().Add(s.inviteTTL)
+	if err := s.invitations.Renew(ctx, inv.ID, hashToken(token), expiresAt); err != nil {
+		return nil, err
+	}
+	inv.ExpiresAt = expiresAt
 
-	// 3. Link Teacher to School and update bio
-	if err := s.schoolRepo.AddTeacherToSchool(ctx, school.ID, user.ID); err != nil {
+	_, err = s.userRepo.GetUserByEmail(ctx, inv.Email)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
 		return nil, err
 	}
+	s.sendTeacherInvitation(inv, token, err == nil)
+	return inv, nil
+}
 
-	// Update bio separately if it exists
-	if bio != "" {
-		_, err = s.schoolRepo.DB.ExecContext(ctx, "UPDATE teacher_profiles SET bio = ? WHERE user_id = ?", bio, user.ID)
-		if err != nil {
+// RevokeTeacherInvitation withdraws a pending invitation.
+func (s *SchoolService) RevokeTeacherInvitation(ctx context.Context, actor Actor, invitationID string) error {
+	inv, err := s.managedInvitation(ctx, actor, invitationID)
+	if err != nil {
+		return err
+	}
+	return s.invitations.Revoke(ctx, inv.ID)
+}
+
+// LookupTeacherInvitation describes the invitation a link is for, and whether its address
+// already has an account, so the page it opens can ask to sign in or to choose a password.
+func (s *SchoolService) LookupTeacherInvitation(ctx context.Context, token string) (*domain.TeacherInvitation, bool, error) {
+	inv, err := s.invitations.GetPendingByToken(ctx, hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		return nil, false, err
+	}
+	_, err = s.userRepo.GetUserByEmail(ctx, inv.Email)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, false, err
+	}
+	return inv, err == nil, nil
+}
+
+// AcceptTeacherInvitation joins the signed-in teacher to the school. Only the account
+// with the invited address can accept.
+func (s *SchoolService) AcceptTeacherInvitation(ctx context.Context, actor Actor, token string) (*domain.TeacherInvitation, error) {
+	if actor.Role != domain.RoleTeacher {
+		return nil, ErrNotTeacherAccount
+	}
+	inv, err := s.invitations.GetPendingByToken(ctx, hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		return nil, ErrInvitationForOtherUser
+	}
+	if _, err := s.schoolRepo.GetTeacherProfile(ctx, user.ID); errors.Is(err, repository.ErrTeacherProfileNotFound) {
+		profile := &domain.TeacherProfile{UserID: user.ID, Subjects: []string{}}
+		if err := s.schoolRepo.CreateTeacherProfile(ctx, profile); err != nil {
 			return nil, err
 		}
+	} else if err != nil {
+		return nil, err
 	}
+	if err := s.invitations.Accept(ctx, inv.ID, user.ID); err != nil {
+		return nil, err
+	}
+	inv.Status = domain.TeacherInvitationAccepted
+	return inv, nil
+}
 
+// RegisterInvitedTeacher creates a teacher account for the invited address with the
+// chosen password and joins it to the school. Following the emailed link confirms the
+// address.
+func (s *SchoolService) RegisterInvitedTeacher(ctx context.Context, token, name, password string) (*domain.User, error) {
+	if len(password) < 6 {
+		return nil, ErrPasswordTooShort
+	}
+	inv, err := s.invitations.GetPendingByToken(ctx, hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.authService.CreateVerifiedAccount(ctx, inv.Email, name, password, domain.RoleTeacher)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.invitations.Accept(ctx, inv.ID, user.ID); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
-func (s *SchoolService) ListTeachers(ctx context.Context, adminUserID string) ([]domain.User, error) {
-	school, err := s.schoolRepo.GetSchoolByAdminID(ctx, adminUserID)
+// RemoveTeacher takes a teacher off the school. Their account stays, as an independent
+// teacher, and the school keeps its courses and their records; the courses and sections
+// they taught are left for the school to reassign.
+func (s *SchoolService) RemoveTeacher(ctx context.Context, actor Actor, schoolID, teacherID string) error {
+	if err := s.policy.Can(ctx, actor, ActionManageTeachers, SchoolResource(schoolID)); err != nil {
+		return err
+	}
+	return s.schoolRepo.RemoveTeacher(ctx, schoolID, teacherID)
+}
+
+// ListTeachers returns the teachers of the actor's school, or of one of its branches when
+// branchID is set.
+func (s *SchoolService) ListTeachers(ctx context.Context, actor Actor, branchID string) ([]domain.User, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManageTeachers)
 	if err != nil {
 		return nil, err
 	}
-	return s.schoolRepo.ListTeachers(ctx, school.ID)
+	return s.schoolRepo.ListTeachers(ctx, school.ID, branchID)
 }
 
 func (s *SchoolService) UpdateSchoolByID(ctx context.Context, userID string, role domain.Role, schoolID string, updates *domain.School) (*domain.School, error) {
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionManageSchool, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
 	school, err := s.schoolRepo.GetSchoolByID(ctx, schoolID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Permission check: only the school's admin or system admin
-	if role != domain.RoleAdmin && school.AdminUserID != userID {
-		return nil, errors.New("you do not have permission to edit this school")
-	}
-
 	// Apply updates
 	if updates.Name != "" {
 		school.Name = updates.Name
@@ -84,6 +308,13 @@ func (s *SchoolService) UpdateSchoolByID(ctx context.Context, userID string, rol
 	if updates.TaxID != "" {
 		school.TaxID = updates.TaxID
 	}
+	if updates.ReportingCurrency != "" {
+		currency := strings.ToUpper(updates.ReportingCurrency)
+		if !domain.SupportedCurrencies[currency] {
+			return nil, fmt.Errorf("unsupported reporting currency: %s", updates.ReportingCurrency)
+		}
+		school.ReportingCurrency = currency
+	}
 
 	if err := s.schoolRepo.UpdateSchool(ctx, school); err != nil {
 		return nil, err
@@ -93,14 +324,186 @@ func (s *SchoolService) UpdateSchoolByID(ctx context.Context, userID string, rol
 }
 
 func (s *SchoolService) DeleteSchool(ctx context.Context, userID string, role domain.Role, schoolID string) error {
+	if err := s.policy.Can(ctx, Actor{UserID: userID, Role: role}, ActionDeleteSchool, SchoolResource(schoolID)); err != nil {
+		return err
+	}
+	return s.schoolRepo.DeleteSchool(ctx, schoolID)
+}
+
+// MyMembership returns the actor's place on a school's staff and what their role allows.
+func (s *SchoolService) MyMembership(ctx context.Context, actor Actor) (*domain.SchoolMember, error) {
+	return s.members.GetByUser(ctx, actor.UserID)
+}
+
+// ListMembers returns the school's staff and their roles.
+func (s *SchoolService) ListMembers(ctx context.Context, actor Actor, schoolID string) ([]domain.SchoolMember, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageStaff, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	return s.members.ListBySchool(ctx, schoolID)
+}
+
+// checkAdminChange allows only the owner, or a platform admin, to add, change or remove an
+// admin, so admins cannot take over from each other.
+func (s *SchoolService) checkAdminChange(ctx context.Context, actor Actor, schoolID string) error {
+	if actor.Role == domain.RoleAdmin {
+		return nil
+	}
+	m, err := s.members.Get(ctx, schoolID, actor.UserID)
+	if err != nil && !errors.Is(err, repository.ErrSchoolMemberNotFound) {
+		return err
+	}
+	if m == nil || m.Role != domain.SchoolRoleOwner {
+		return ErrOwnerManagesAdmins
+	}
+	return nil
+}
+
+// memberBranch checks the branch a member with the role is limited to. A branch manager
+// must have one of the school's branches; every other role acts for the whole school.
+func (s *SchoolService) memberBranch(ctx context.Context, schoolID string, role domain.SchoolRole, branchID *string) (*domain.SchoolBranch, error) {
+	if role != domain.SchoolRoleBranchManager {
+		return nil, nil
+	}
+	if branchID == nil || *branchID == "" {
+		return nil, ErrBranchRequired
+	}
+	branch, err := s.branches.GetByID(ctx, *branchID)
+	if err != nil {
+		return nil, err
+	}
+	if branch.SchoolID != schoolID {
+		return nil, repository.ErrBranchNotFound
+	}
+	return branch, nil
+}
+
+// AddMember puts someone on the school's staff with the role; a branch manager also needs
+// the branch they manage. An address without an account gets a staff account and an
+// emailed link to choose its password; an existing account must be a school staff account
+// that is not on another school's staff.
+func (s *SchoolService) AddMember(ctx context.Context, actor Actor, schoolID, email, name string, role domain.SchoolRole, branchID *string) (*domain.SchoolMember, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageStaff, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	if !staffRoles[role] {
+		return nil, ErrInvalidStaffRole
+	}
+	branch, err := s.memberBranch(ctx, schoolID, role, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if role == domain.SchoolRoleAdmin {
+		if err := s.checkAdminChange(ctx, actor, schoolID); err != nil {
+			return nil, err
+		}
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, ErrStaffEmailRequired
+	}
 	school, err := s.schoolRepo.GetSchoolByID(ctx, schoolID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if role != domain.RoleAdmin && school.AdminUserID != userID {
-		return errors.New("you do not have permission to delete this school")
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	created := false
+	switch {
+	case err == nil:
+		if user.Role != domain.RoleSchoolAdmin {
+			return nil, ErrNotStaffAccount
+		}
+	case errors.Is(err, repository.ErrUserNotFound):
+		if user, err = s.authService.CreateStaffAccount(ctx, email, name); err != nil {
+			return nil, err
+		}
+		created = true
+	default:
+		return nil, err
 	}
 
-	return s.schoolRepo.DeleteSchool(ctx, schoolID)
+	member := &domain.SchoolMember{
+		SchoolID: schoolID,
+		UserID:   user.ID,
+		Name:     user.Name,
+		Email:    user.Email,
+		Role:     role,
+		AddedBy:  &actor.UserID,
+	}
+	if branch != nil {
+		member.BranchID = &branch.ID
+		member.BranchName = branch.Name
+	}
+	if err := s.members.Add(ctx, member); err != nil {
+		return nil, err
+	}
+
+	link := ""
+	if created {
+		if link, err = s.passwordReset.SetPasswordLink(ctx, user.ID, s.inviteTTL); err != nil {
+			return nil, err
+		}
+	}
+	s.email.SendStaffInvitation(user.Email, school.Name, string(role), link, s.inviteTTL)
+	return member, nil
+}
+
+// UpdateMemberRole changes a staff member's role, and for a branch manager the branch
+// they manage.
+func (s *SchoolService) UpdateMemberRole(ctx context.Context, actor Actor, schoolID, userID string, role domain.SchoolRole, branchID *string) (*domain.SchoolMember, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageStaff, SchoolResource(schoolID)); err != nil {
+		return nil, err
+	}
+	if !staffRoles[role] {
+		return nil, ErrInvalidStaffRole
+	}
+	branch, err := s.memberBranch(ctx, schoolID, role, branchID)
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.members.Get(ctx, schoolID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == domain.SchoolRoleOwner {
+		return nil, ErrSchoolOwnerFixed
+	}
+	if role == domain.SchoolRoleAdmin || member.Role == domain.SchoolRoleAdmin {
+		if err := s.checkAdminChange(ctx, actor, schoolID); err != nil {
+			return nil, err
+		}
+	}
+	member.BranchID, member.BranchName = nil, ""
+	if branch != nil {
+		member.BranchID = &branch.ID
+		member.BranchName = branch.Name
+	}
+	if err := s.members.UpdateRole(ctx, schoolID, userID, role, member.BranchID); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	member.Permissions = domain.SchoolRolePermissions[role]
+	return member, nil
+}
+
+// RemoveMember takes someone off the school's staff. Their account stays but can no
+// longer act for the school.
+func (s *SchoolService) RemoveMember(ctx context.Context, actor Actor, schoolID, userID string) error {
+	if err := s.policy.Can(ctx, actor, ActionManageStaff, SchoolResource(schoolID)); err != nil {
+		return err
+	}
+	member, err := s.members.Get(ctx, schoolID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == domain.SchoolRoleOwner {
+		return ErrSchoolOwnerFixed
+	}
+	if member.Role == domain.SchoolRoleAdmin {
+		if err := s.checkAdminChange(ctx, actor, schoolID); err != nil {
+			return err
+		}
+	}
+	return s.members.Remove(ctx, schoolID, userID)
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func newTestSchoolService(t *testing.T) (*SchoolService, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	return NewSchoolService(&repository.SchoolRepository{DB: db}, &repository.TeacherInvitationRepository{DB: db}, nil, nil,
+		&repository.UserRepository{DB: db}, nil, nil, nil, nil, nil, ""), mock
+}
+
+// expectPendingInvitation answers the lookup of the invitation token "invite" is for:
+// inv-1 from school s1 to teacher@example.com, or none when found is false.
+func expectPendingInvitation(mock sqlmock.Sqlmock, found bool) {
+	rows := sqlmock.NewRows([]string{"id", "school_id", "name", "email", "bio", "invited_by", "status", "expires_at", "accepted_by", "accepted_at", "created_at"})
+	if found {
+		rows.AddRow("inv-1", "s1", "School", "teacher@example.com", "Maths teacher", "owner", domain.TeacherInvitationPending,
+			time.Now().Add(time.Hour), nil, nil, time.Now())
+	}
+	mock.ExpectQuery(`WHERE ti\.token_hash = \? AND ti\.status = \? AND ti\.expires_at > NOW\(\)`).
+		WithArgs(hashToken("invite"), domain.TeacherInvitationPending).WillReturnRows(rows)
+}
+
+func TestAcceptTeacherInvitation(t *testing.T) {
+	s1, s2 := "s1", "s2"
+	tests := []struct {
+		name    string
+		email   string
+		profile *domain.TeacherProfile // nil for a teacher without one yet
+		wantErr error
+	}{
+		{"independent teacher", "teacher@example.com", &domain.TeacherProfile{}, nil},
+		{"address in another case", "Teacher@Example.com", &domain.TeacherProfile{}, nil},
+		{"teacher without a profile", "teacher@example.com", nil, nil},
+		{"someone else's invitation", "other@example.com", &domain.TeacherProfile{}, ErrInvitationForOtherUser},
+		{"teacher at another school", "teacher@example.com", &domain.TeacherProfile{SchoolID: &s2}, repository.ErrTeacherAtAnotherSchool},
+		{"teacher already at the school", "teacher@example.com", &domain.TeacherProfile{SchoolID: &s1}, repository.ErrTeacherAlreadyInSchool},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestSchoolService(t)
+			expectPendingInvitation(mock, true)
+			expectUser(mock, domain.User{ID: "t1", Email: tt.email, Role: domain.RoleTeacher})
+			if tt.wantErr != ErrInvitationForOtherUser {
+				profiles := mock.ExpectQuery(`FROM teacher_profiles WHERE user_id = \?`).WithArgs("t1")
+				if tt.profile == nil {
+					profiles.WillReturnError(sql.ErrNoRows)
+					mock.ExpectExec(`INSERT INTO teacher_profiles`).WithArgs("t1", nil, "", "[]").WillReturnResult(sqlmock.NewResult(0, 1))
+					tt.profile = &domain.TeacherProfile{}
+				} else {
+					profiles.WillReturnRows(sqlmock.NewRows([]string{"user_id", "school_id", "branch_id", "bio", "subjects", "hourly_rate", "currency", "created_at", "updated_at"}).
+						AddRow("t1", orNull(tt.profile.SchoolID), nil, "", "[]", 0, domain.CurrencyTJS, time.Now(), time.Now()))
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT school_id, COALESCE\(bio, ''\) FROM teacher_invitations`).WithArgs("inv-1", domain.TeacherInvitationPending).
+					WillReturnRows(sqlmock.NewRows([]string{"school_id", "bio"}).AddRow("s1", "Maths teacher"))
+				mock.ExpectQuery(`SELECT school_id FROM teacher_profiles WHERE user_id = \? FOR UPDATE`).WithArgs("t1").
+					WillReturnRows(sqlmock.NewRows([]string{"school_id"}).AddRow(orNull(tt.profile.SchoolID)))
+				if tt.wantErr == nil {
+					mock.ExpectExec(`UPDATE teacher_profiles SET school_id = \?`).WithArgs("s1", "Maths teacher", "t1").WillReturnResult(sqlmock.NewResult(0, 1))
+					// The link is used up.
+					mock.ExpectExec(`UPDATE teacher_invitations SET status = \?, token_hash = NULL, accepted_by = \?`).
+						WithArgs(domain.TeacherInvitationAccepted, "t1", "inv-1").WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			inv, err := s.AcceptTeacherInvitation(context.Background(), Actor{UserID: "t1", Role: domain.RoleTeacher}, " invite ")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && inv.Status != domain.TeacherInvitationAccepted {
+				t.Fatalf("invitation status = %s, want accepted", inv.Status)
+			}
+		})
+	}
+}
+
+func TestAcceptTeacherInvitationRefusesOtherAccounts(t *testing.T) {
+	s, _ := newTestSchoolService(t)
+	for _, role := range []domain.Role{domain.RoleStudent, domain.RoleParent, domain.RoleSchoolAdmin, domain.RoleAdmin} {
+		if _, err := s.AcceptTeacherInvitation(context.Background(), Actor{UserID: "u1", Role: role}, "invite"); !errors.Is(err, ErrNotTeacherAccount) {
+			t.Errorf("%s: err = %v, want ErrNotTeacherAccount", role, err)
+		}
+	}
+}
+
+func TestAcceptTeacherInvitationWithStaleLink(t *testing.T) {
+	s, mock := newTestSchoolService(t)
+	// Expired, revoked, accepted and resent-over links all fail to match a pending invitation.
+	expectPendingInvitation(mock, false)
+	if _, err := s.AcceptTeacherInvitation(context.Background(), Actor{UserID: "t1", Role: domain.RoleTeacher}, "invite"); !errors.Is(err, repository.ErrTeacherInviteInvalid) {
+		t.Fatalf("err = %v, want ErrTeacherInviteInvalid", err)
+	}
+}
+
+func TestRegisterInvitedTeacherNeedsAPassword(t *testing.T) {
+	s, _ := newTestSchoolService(t)
+	if _, err := s.RegisterInvitedTeacher(context.Background(), "invite", "Teacher", "12345"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("err = %v, want ErrPasswordTooShort", err)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+var (
+	ErrSectionNameRequired       = errors.New("section name is required")
+	ErrIndependentSectionTeacher = errors.New("the sections of an independent course are taught by its teacher")
+)
+
+type SectionService struct {
+	sections         *repository.SectionRepository
+	courseRepo       *repository.CourseRepository
+	schoolRepo       *repository.SchoolRepository
+	notificationRepo *repository.NotificationRepository
+	courses          *CourseService
+	policy           *Policy
+}
+
+func NewSectionService(sections *repository.SectionRepository, courseRepo *repository.CourseRepository, schoolRepo *repository.SchoolRepository,
+	notificationRepo *repository.NotificationRepository, courses *CourseService, policy *Policy) *SectionService {
+	return &SectionService{sections: sections, courseRepo: courseRepo, schoolRepo: schoolRepo, notificationRepo: notificationRepo, courses: courses, policy: policy}
+}
+
+// sectionKey returns an optional section ID as the policy and repositories take it, with ""
+// for no section.
+func sectionKey(sectionID *string) string {
+	if sectionID == nil {
+		return ""
+	}
+	return *sectionID
+}
+
+// SectionInput is the editable part of a section.
+type SectionInput struct {
+	Name        string           `json:"name"`
+	Schedule    *domain.Schedule `json:"schedule"`
+	TeacherID   *string          `json:"teacher_id"`
+	MaxStudents *int             `json:"max_students"` // null for no limit beyond the course's
+}
+
+// apply validates the input and copies it onto a section of the course.
+func (s *SectionService) apply(ctx context.Context, course *domain.Course, in SectionInput, section *domain.CourseSection) error {
+	section.Name = strings.TrimSpace(in.Name)
+	if section.Name == "" {
+		return ErrSectionNameRequired
+	}
+	if in.MaxStudents != nil && *in.MaxStudents <= 0 {
+		return ErrInvalidMaxStudents
+	}
+	section.Schedule = in.Schedule
+	section.MaxStudents = in.MaxStudents
+	section.TeacherID = nil
+	if in.TeacherID == nil || *in.TeacherID == "" {
+		return nil
+	}
+
+	// A school's sections are taught by its teachers; an independent course has only its own.
+	if course.SchoolID == nil {
+		if course.TeacherID == nil || *course.TeacherID != *in.TeacherID {
+			return ErrIndependentSectionTeacher
+		}
+	} else {
+		profile, err := s.schoolRepo.GetTeacherProfile(ctx, *in.TeacherID)
+		if err != nil && !errors.Is(err, repository.ErrTeacherProfileNotFound) {
+			return err
+		}
+		if profile == nil || profile.SchoolID == nil || *profile.SchoolID != *course.SchoolID {
+			return repository.ErrTeacherNotInSchool
+		}
+	}
+	section.TeacherID = in.TeacherID
+	return nil
+}
+
+// ListSections returns the course's sections. Like the rest of the course's listing, when
+// and where its groups meet is public.
+func (s *SectionService) ListSections(ctx context.Context, courseID string) ([]domain.CourseSection, error) {
+	if _, err := s.courseRepo.GetCourseByID(ctx, courseID); err != nil {
+		return nil, err
+	}
+	return s.sections.ListByCourse(ctx, courseID)
+}
+
+func (s *SectionService) CreateSection(ctx context.Context, actor Actor, courseID string, in SectionInput) (*domain.CourseSection, error) {
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(courseID)); err != nil {
+		return nil, err
+	}
+	course, err := s.courseRepo.GetCourseByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	section := &domain.CourseSection{CourseID: courseID}
+	if err := s.apply(ctx, course, in, section); err != nil {
+		return nil, err
+	}
+	if err := s.sections.Create(ctx, section); err != nil {
+		return nil, err
+	}
+	return s.sections.GetByID(ctx, section.ID)
+}
+
+// managedSection loads a section with its course, if the actor may edit the course.
+func (s *SectionService) managedSection(ctx context.Context, actor Actor, sectionID string) (*domain.CourseSection, *domain.Course, error) {
+	section, err := s.sections.GetByID(ctx, sectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionManageCourse, CourseResource(section.CourseID)); err != nil {
+		return nil, nil, err
+	}
+	course, err := s.courseRepo.GetCourseByID(ctx, section.CourseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return section, course, nil
+}
+
+// UpdateSection replaces a section's details. A lower limit takes no seats away; a higher
+// one is offered to the waitlist.
+func (s *SectionService) UpdateSection(ctx context.Context, actor Actor, sectionID string, in SectionInput) (*domain.CourseSection, error) {
+	section, course, err := s.managedSection(ctx, actor, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, course, in, section); err != nil {
+		return nil, err
+	}
+	if err := s.sections.Update(ctx, section); err != nil {
+		return nil, err
+	}
+	s.courses.promoteWaitlist(ctx, course.ID)
+	return s.sections.GetByID(ctx, sectionID)
+}
+
+// DeleteSection removes a section. Its students stay in the course, in no section.
+func (s *SectionService) DeleteSection(ctx context.Context, actor Actor, sectionID string) error {
+	section, _, err := s.managedSection(ctx, actor, sectionID)
+	if err != nil {
+		return err
+	}
+	if err := s.sections.Delete(ctx, section.ID); err != nil {
+		return err
+	}
+	// Those waiting for the section now wait for any seat in the course.
+	s.courses.promoteWaitlist(ctx, section.CourseID)
+	return nil
+}
+
+// SetEnrollmentSection moves a student to one of the course's sections, or to none, and
+// tells them. A seat freed in the old section is offered to the waitlist.
+func (s *SectionService) SetEnrollmentSection(ctx context.Context, actor Actor, enrollmentID string, sectionID *string) (*domain.Enrollment, error) {
+	enrollment, err := s.courseRepo.GetEnrollmentByID(ctx, enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Can(ctx, actor, ActionManageEnrollments, CourseResource(enrollment.CourseID)); err != nil {
+		return nil, err
+	}
+	if sectionID != nil && *sectionID == "" {
+		sectionID = nil
+	}
+	if err := s.courseRepo.SetEnrollmentSection(ctx, enrollmentID, sectionID); err != nil {
+		return nil, err
+	}
+	s.courses.promoteWaitlist(ctx, enrollment.CourseID)
+
+	moved, err := s.courseRepo.GetEnrollmentByID(ctx, enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+	if sectionID != nil {
+		section, err := s.sections.GetByID(ctx, *sectionID)
+		if err != nil {
+			return nil, err
+		}
+		moved.SectionName = section.Name
+		course, err := s.courseRepo.GetCourseByID(ctx, enrollment.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		_ = s.notificationRepo.Create(ctx, &domain.Notification{
+			UserID:  enrollment.StudentUserID,
+			Type:    "section_changed",
+			Title:   "Section Changed",
+			Message: fmt.Sprintf("You are now in the %s section of %s.", section.Name, course.Title),
+			Link:    fmt.Sprintf("/courses?view=%s", enrollment.CourseID),
+		})
+	}
+	return moved, nil
+}
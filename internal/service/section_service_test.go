@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+)
+
+func TestSectionTeacherAssignment(t *testing.T) {
+	school, other, owner := "s1", "s2", "owner-teacher"
+	tests := []struct {
+		name    string
+		course  domain.Course
+		teacher string
+		profile *string // the teacher's school; nil for a teacher with no profile
+		wantErr error
+	}{
+		{"school teacher", domain.Course{SchoolID: &school}, "t1", &school, nil},
+		{"teacher of another school", domain.Course{SchoolID: &school}, "t1", &other, repository.ErrTeacherNotInSchool},
+		{"user without a teacher profile", domain.Course{SchoolID: &school}, "t1", nil, repository.ErrTeacherNotInSchool},
+		{"independent course's own teacher", domain.Course{TeacherID: &owner}, owner, nil, nil},
+		{"someone else for an independent course", domain.Course{TeacherID: &owner}, "t1", nil, ErrIndependentSectionTeacher},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			s := &SectionService{schoolRepo: &repository.SchoolRepository{DB: db}}
+			if tt.course.SchoolID != nil {
+				profile := mock.ExpectQuery(`FROM teacher_profiles WHERE user_id = \?`).WithArgs(tt.teacher)
+				if tt.profile == nil {
+					profile.WillReturnError(sql.ErrNoRows)
+				} else {
+					profile.WillReturnRows(sqlmock.NewRows([]string{"user_id", "school_id", "branch_id", "bio", "subjects", "hourly_rate", "currency", "created_at", "updated_at"}).
+						AddRow(tt.teacher, *tt.profile, nil, "", "[]", 0, domain.CurrencyTJS, time.Now(), time.Now()))
+				}
+			}
+
+			var section domain.CourseSection
+			err := s.apply(context.Background(), &tt.course, SectionInput{Name: " Morning ", TeacherID: &tt.teacher}, &section)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (section.TeacherID == nil || *section.TeacherID != tt.teacher || section.Name != "Morning") {
+				t.Fatalf("section = %q taught by %v, want Morning taught by %s", section.Name, section.TeacherID, tt.teacher)
+			}
+		})
+	}
+}
+
+func TestSectionInputValidation(t *testing.T) {
+	zero, twelve, empty := 0, 12, ""
+	s := &SectionService{}
+	course := &domain.Course{}
+	tests := []struct {
+		name    string
+		in      SectionInput
+		wantErr error
+	}{
+		{"limited seats", SectionInput{Name: "Evening", MaxStudents: &twelve}, nil},
+		{"no limit", SectionInput{Name: "Evening"}, nil},
+		{"no seats", SectionInput{Name: "Evening", MaxStudents: &zero}, ErrInvalidMaxStudents},
+		{"blank name", SectionInput{Name: "  "}, ErrSectionNameRequired},
+		// An empty teacher leaves the section to the course's teacher.
+		{"teacher removed", SectionInput{Name: "Evening", TeacherID: &empty}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teacher := "t1"
+			section := domain.CourseSection{TeacherID: &teacher}
+			err := s.apply(context.Background(), course, tt.in, &section)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (section.TeacherID != nil || section.MaxStudents != tt.in.MaxStudents) {
+				t.Fatalf("section teacher %v, seats %v; want no teacher and %v seats", section.TeacherID, section.MaxStudents, tt.in.MaxStudents)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SMSSender delivers text messages to phone numbers.
+type SMSSender interface {
+	// Send delivers message to phone, an E.164 number. An error means it was not accepted.
+	Send(ctx context.Context, phone, message string) error
+}
+
+// LogSMSSender writes messages to the log instead of sending them. It is meant for local
+// development, where one-time codes can be read from the API's output.
+type LogSMSSender struct{}
+
+func NewLogSMSSender() *LogSMSSender {
+	return &LogSMSSender{}
+}
+
+func (s *LogSMSSender) Send(ctx context.Context, phone, message string) error {
+	log.Printf("[SMS] to %s: %s", phone, message)
+	return nil
+}
+
+// HTTPSMSSender sends messages through an SMS gateway's HTTP API. Each message is POSTed
+// as JSON {"to", "from", "text"} to the gateway URL with the API key as a bearer token;
+// any 2xx response means the gateway accepted it.
+type HTTPSMSSender struct {
+	URL        string
+	APIKey     string
+	From       string // sender name or number shown to the recipient
+	HTTPClient *http.Client
+}
+
+func NewHTTPSMSSender(url, apiKey, from string) *HTTPSMSSender {
+	return &HTTPSMSSender{
+		URL:        url,
+		APIKey:     apiKey,
+		From:       from,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type smsGatewayRequest struct {
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Text string `json:"text"`
+}
+
+func (s *HTTPSMSSender) Send(ctx context.Context, phone, message string) error {
+	body, err := json.Marshal(smsGatewayRequest{To: phone, From: s.From, Text: message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	res, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms gateway: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return fmt.Errorf("sms gateway: unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
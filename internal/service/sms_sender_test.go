@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSMSSenderPostsToGateway(t *testing.T) {
+	var got smsGatewayRequest
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sms-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	s := NewHTTPSMSSender(gateway.URL, "sms-key", "SchoolTJ")
+	if err := s.Send(context.Background(), "+992901234567", "SchoolTJ code: 123456"); err != nil {
+		t.Fatal(err)
+	}
+	want := smsGatewayRequest{To: "+992901234567", From: "SchoolTJ", Text: "SchoolTJ code: 123456"}
+	if got != want {
+		t.Fatalf("gateway got %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPSMSSenderReportsRejection(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid number"}`, http.StatusUnprocessableEntity)
+	}))
+	defer gateway.Close()
+
+	s := NewHTTPSMSSender(gateway.URL, "sms-key", "")
+	if err := s.Send(context.Background(), "+992901234567", "hello"); err == nil {
+		t.Fatal("expected an error for a rejected message")
+	}
+}
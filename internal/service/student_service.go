@@ -8,11 +8,12 @@ import (
 )
 
 type StudentService struct {
-	repo *repository.StudentRepository
+	repo   *repository.StudentRepository
+	policy *Policy
 }
 
-func NewStudentService(repo *repository.StudentRepository) *StudentService {
-	return &StudentService{repo: repo}
+func NewStudentService(repo *repository.StudentRepository, policy *Policy) *StudentService {
+	return &StudentService{repo: repo, policy: policy}
 }
 
 func (s *StudentService) GetAllStudents(ctx context.Context, limit, offset int, search string) ([]domain.User, error) {
@@ -22,7 +23,11 @@ func (s *StudentService) GetAllStudents(ctx context.Context, limit, offset int,
 func (s *StudentService) GetMyStudents(ctx context.Context, userID string, role domain.Role) ([]domain.User, error) {
 	switch role {
 	case domain.RoleSchoolAdmin:
-		return s.repo.GetStudentsBySchoolAdminID(ctx, userID)
+		school, branchID, err := s.policy.MemberScope(ctx, Actor{UserID: userID, Role: role}, ActionViewStudent)
+		if err != nil {
+			return nil, err
+		}
+		return s.repo.ListStudentsBySchool(ctx, school.ID, branchID)
 	case domain.RoleTeacher:
 		return s.repo.ListStudentsByTeacher(ctx, userID)
 	default:
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238's test vectors, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; six-digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPCodeAcceptsLowerCaseSecret(t *testing.T) {
+	got, err := totpCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil || got != "287082" {
+		t.Fatalf("code = %q, %v; want 287082", got, err)
+	}
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Fatal("expected an error for a malformed secret")
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	code := func(step int64) string {
+		c, err := totpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+		step int64
+	}{
+		{"current step", code(current), true, current},
+		{"one step behind", code(current - 1), true, current - 1},
+		{"one step ahead", code(current + 1), true, current + 1},
+		{"two steps behind", code(current - 2), false, 0},
+		{"two steps ahead", code(current + 2), false, 0},
+		{"typed with spaces", " " + code(current)[:3] + " " + code(current)[3:] + " ", true, current},
+		{"too short", code(current)[:5], false, 0},
+		{"empty", "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, tt.code, now, 0)
+			if ok != tt.ok || step != tt.step {
+				t.Fatalf("matchTOTP = (%d, %v), want (%d, %v)", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPRejectsUsedSteps(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current - 1, current} {
+		c, _ := totpCode(rfc6238Secret, step)
+		if _, ok := matchTOTP(rfc6238Secret, c, now, current); ok {
+			t.Errorf("code for step %d matched after step %d was used", step, current)
+		}
+	}
+	next, _ := totpCode(rfc6238Secret, current+1)
+	if step, ok := matchTOTP(rfc6238Secret, next, now, current); !ok || step != current+1 {
+		t.Errorf("code for the next step = (%d, %v), want (%d, true)", step, ok, current+1)
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "SchoolTJ"
+	recoveryCodeCount = 10
+	recoveryAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789" // no look-alike characters
+)
+
+var (
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted  = errors.New("start two-factor setup first")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorEnforced    = errors.New("your school requires two-factor authentication")
+)
+
+// TwoFactorService manages TOTP two-factor authentication: enrolling an authenticator
+// app, checking its codes at login, single-use recovery codes, and the school setting
+// that makes it mandatory for teachers.
+type TwoFactorService struct {
+	repo     *repository.TwoFactorRepository
+	userRepo *repository.UserRepository
+	policy   *Policy
+}
+
+func NewTwoFactorService(repo *repository.TwoFactorRepository, userRepo *repository.UserRepository, policy *Policy) *TwoFactorService {
+	return &TwoFactorService{
+		repo:     repo,
+		userRepo: userRepo,
+		policy:   policy,
+	}
+}
+
+func (s *TwoFactorService) Status(ctx context.Context, userID string) (*domain.TwoFactorStatus, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, enabled, _, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.isRequired(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	status := &domain.TwoFactorStatus{Enabled: enabled, Required: required}
+	if enabled {
+		if status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// IsEnabled reports whether logging in as the user needs a second factor.
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	_, enabled, _, err := s.repo.GetTOTP(ctx, userID)
+	return enabled, err
+}
+
+// NeedsSetup reports whether the user must enroll before doing anything else: they teach
+// at a school that requires two-factor authentication and have not turned it on.
+func (s *TwoFactorService) NeedsSetup(ctx context.Context, user *domain.User) (bool, error) {
+	required, err := s.isRequired(ctx, user)
+	if err != nil || !required {
+		return false, err
+	}
+	enabled, err := s.IsEnabled(ctx, user.ID)
+	return !enabled, err
+}
+
+func (s *TwoFactorService) isRequired(ctx context.Context, user *domain.User) (bool, error) {
+	if user.Role != domain.RoleTeacher {
+		return false, nil
+	}
+	return s.repo.IsRequiredForTeacher(ctx, user.ID)
+}
+
+// BeginSetup generates a new secret for the user's authenticator app. Two-factor
+// authentication stays off until Enable confirms a code from it.
+func (s *TwoFactorService) BeginSetup(ctx context.Context, userID string) (*domain.TwoFactorEnrollment, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingSecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" && user.Phone != nil {
+		account = *user.Phone
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", "6")
+	params.Set("period", "30")
+	otpauth := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+	return &domain.TwoFactorEnrollment{Secret: secret, OTPAuthURL: otpauth.String()}, nil
+}
+
+// Enable turns two-factor authentication on once the user enters a code from the app set
+// up by BeginSetup. It returns the recovery codes, which are not shown again.
+func (s *TwoFactorService) Enable(ctx context.Context, userID, code string) ([]string, error) {
+	secret, enabled, _, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, repository.ErrTwoFactorAlreadyEnabled
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off, and is refused while a school requires it.
+// A current code or an unused recovery code authorizes it. The password may be left out,
+// since accounts that signed up with a provider or a phone number never set one, but a
+// wrong one is refused.
+func (s *TwoFactorService) Disable(ctx context.Context, userID, password, code string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return ErrInvalidCredentials
+		}
+	}
+	required, err := s.isRequired(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorEnforced
+	}
+	if err := s.VerifyCode(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.repo.Disable(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.VerifyCode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyCode accepts a code from the authenticator app or an unused recovery code. Either
+// works only once.
+func (s *TwoFactorService) VerifyCode(ctx context.Context, userID, code string) error {
+	secret, enabled, lastStep, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := matchTOTP(secret, code, time.Now(), lastStep); ok {
+		used, err := s.repo.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashToken(normalized))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// maxChallengeAttempts is how many codes may be tried against one second-factor challenge
+// before the login has to start over.
+const maxChallengeAttempts = 5
+
+// StartChallenge opens a second-factor challenge for a login that proved its first factor.
+func (s *TwoFactorService) StartChallenge(ctx context.Context, userID string, expiresAt time.Time) (string, error) {
+	return s.repo.CreateChallenge(ctx, userID, expiresAt)
+}
+
+// UseChallengeAttempt takes one attempt at the challenge, reporting false once it has
+// expired or its attempts are used up.
+func (s *TwoFactorService) UseChallengeAttempt(ctx context.Context, challengeID, userID string) (bool, error) {
+	return s.repo.UseChallengeAttempt(ctx, challengeID, userID, maxChallengeAttempts)
+}
+
+// EndChallenge closes a challenge after it succeeded.
+func (s *TwoFactorService) EndChallenge(ctx context.Context, challengeID string) error {
+	return s.repo.DeleteChallenge(ctx, challengeID)
+}
+
+// GetSchoolPolicy reports whether the actor's school requires two-factor authentication
+// from its teachers.
+func (s *TwoFactorService) GetSchoolPolicy(ctx context.Context, actor Actor) (bool, error) {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManageSecurity)
+	if err != nil {
+		return false, err
+	}
+	return s.repo.GetSchoolPolicy(ctx, school.ID)
+}
+
+// SetSchoolPolicy turns the requirement on or off. Teachers without two-factor
+// authentication are asked to set it up the next time they sign in or refresh their token.
+func (s *TwoFactorService) SetSchoolPolicy(ctx context.Context, actor Actor, required bool) error {
+	school, err := s.policy.MemberSchool(ctx, actor, ActionManageSecurity)
+	if err != nil {
+		return err
+	}
+	return s.repo.SetSchoolPolicy(ctx, school.ID, required)
+}
+
+// newRecoveryCodes returns fresh recovery codes formatted xxxxx-xxxxx, with their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	alphabetSize := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := range codes {
+		var b strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryAlphabet[n.Int64()])
+		}
+		codes[i] = b.String()
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes case-insensitive and ignores separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
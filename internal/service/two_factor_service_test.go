@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/schooltj/internal/domain"
+	"github.com/schooltj/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestTwoFactorService(t *testing.T) (*TwoFactorService, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	return NewTwoFactorService(repository.NewTwoFactorRepository(db), repository.NewUserRepository(db), nil), mock
+}
+
+func expectTOTP(mock sqlmock.Sqlmock, userID string, lastStep int64) {
+	mock.ExpectQuery(`SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "enabled", "totp_last_step"}).AddRow(rfc6238Secret, true, lastStep))
+}
+
+func currentTOTP(t *testing.T) (string, int64) {
+	t.Helper()
+	step := time.Now().Unix() / totpPeriod
+	code, err := totpCode(rfc6238Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, step
+}
+
+func TestVerifyCodeUsesEachTOTPStepOnce(t *testing.T) {
+	s, mock := newTestTwoFactorService(t)
+	code, step := currentTOTP(t)
+
+	expectTOTP(mock, "u1", 0)
+	mock.ExpectExec(`UPDATE users SET totp_last_step = \? WHERE id = \? AND totp_last_step < \?`).
+		WithArgs(step, "u1", step).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.VerifyCode(context.Background(), "u1", code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	// Replayed once its step is recorded, the code is only tried as a recovery code.
+	expectTOTP(mock, "u1", step)
+	mock.ExpectExec(`UPDATE two_factor_recovery_codes SET used_at = NOW\(\)`).
+		WithArgs("u1", hashToken(code)).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.VerifyCode(context.Background(), "u1", code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("replay: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	// A concurrent request that recorded the step first wins.
+	expectTOTP(mock, "u1", 0)
+	mock.ExpectExec(`UPDATE users SET totp_last_step`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.VerifyCode(context.Background(), "u1", code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("race: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+}
+
+func TestVerifyCodeRecoveryCodesAreSingleUse(t *testing.T) {
+	s, mock := newTestTwoFactorService(t)
+	hash := hashToken("abcdefghjk")
+
+	expectTOTP(mock, "u1", 0)
+	mock.ExpectExec(`UPDATE two_factor_recovery_codes SET used_at = NOW\(\) WHERE user_id = \? AND code_hash = \? AND used_at IS NULL`).
+		WithArgs("u1", hash).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.VerifyCode(context.Background(), "u1", " ABCDE-fghjk "); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	expectTOTP(mock, "u1", 0)
+	mock.ExpectExec(`UPDATE two_factor_recovery_codes`).WithArgs("u1", hash).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.VerifyCode(context.Background(), "u1", "abcde-fghjk"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("second use: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("code %q is not formatted xxxxx-xxxxx", c)
+		}
+		if hashes[i] != hashToken(normalizeRecoveryCode(c)) {
+			t.Errorf("hash of %q does not match its normalized form", c)
+		}
+		if seen[c] {
+			t.Errorf("code %q repeated", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := domain.User{ID: "u1", Email: "u1@example.com", PasswordHash: string(hash), Role: domain.RoleSchoolAdmin}
+
+	expectDisabled := func(mock sqlmock.Sqlmock, step int64) {
+		expectTOTP(mock, "u1", 0)
+		mock.ExpectExec(`UPDATE users SET totp_last_step`).WithArgs(step, "u1", step).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE users SET totp_secret = NULL`).WithArgs("u1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM two_factor_recovery_codes`).WithArgs("u1").WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectCommit()
+	}
+
+	t.Run("code without a password", func(t *testing.T) {
+		// Accounts created through a sign-in provider or a phone number have no password
+		// their owner knows.
+		s, mock := newTestTwoFactorService(t)
+		code, step := currentTOTP(t)
+		expectUser(mock, user)
+		expectDisabled(mock, step)
+		if err := s.Disable(context.Background(), "u1", "", code); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("code with the password", func(t *testing.T) {
+		s, mock := newTestTwoFactorService(t)
+		code, step := currentTOTP(t)
+		expectUser(mock, user)
+		expectDisabled(mock, step)
+		if err := s.Disable(context.Background(), "u1", "secret-password", code); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		s, mock := newTestTwoFactorService(t)
+		code, _ := currentTOTP(t)
+		expectUser(mock, user)
+		if err := s.Disable(context.Background(), "u1", "guess", code); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+		}
+	})
+	t.Run("wrong code", func(t *testing.T) {
+		s, mock := newTestTwoFactorService(t)
+		expectUser(mock, user)
+		expectTOTP(mock, "u1", 0)
+		mock.ExpectExec(`UPDATE two_factor_recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+		if err := s.Disable(context.Background(), "u1", "", "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("err = %v, want ErrInvalidTwoFactorCode", err)
+		}
+	})
+	t.Run("required by the school", func(t *testing.T) {
+		s, mock := newTestTwoFactorService(t)
+		code, _ := currentTOTP(t)
+		teacher := user
+		teacher.Role = domain.RoleTeacher
+		expectUser(mock, teacher)
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs("u1", "u1").WillReturnRows(sqlmock.NewRows([]string{"required"}).AddRow(true))
+		if err := s.Disable(context.Background(), "u1", "", code); !errors.Is(err, ErrTwoFactorEnforced) {
+			t.Fatalf("err = %v, want ErrTwoFactorEnforced", err)
+		}
+	})
+}
+
+// newTestTwoFactorLogin returns an AuthService whose lockout takes three failures, and a
+// second-factor token for challenge c1 of user u1.
+func newTestTwoFactorLogin(t *testing.T) (*AuthService, sqlmock.Sqlmock, string) {
+	db, mock := newMockDB(t)
+	users := repository.NewUserRepository(db)
+	twoFactor := NewTwoFactorService(repository.NewTwoFactorRepository(db), users, nil)
+	s := NewAuthService(users, nil, nil, repository.NewSessionRepository(db), nil, nil, twoFactor,
+		repository.NewAuditRepository(db), nil, LoginLockout{Threshold: 3, Duration: 15 * time.Minute}, "test-secret", nil)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "u1",
+		"jti": "c1",
+		"typ": "2fa",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, mock, token
+}
+
+func expectChallengeAttempt(mock sqlmock.Sqlmock, ok bool) {
+	var n int64
+	if ok {
+		n = 1
+	}
+	mock.ExpectExec(`UPDATE two_factor_challenges SET attempts = attempts \+ 1`).
+		WithArgs("c1", "u1", maxChallengeAttempts).WillReturnResult(sqlmock.NewResult(0, n))
+}
+
+func expectNotLocked(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT locked_until FROM users`).WithArgs("u1").WillReturnRows(sqlmock.NewRows([]string{"locked_until"}))
+}
+
+func TestVerifyTwoFactorSpentChallenge(t *testing.T) {
+	// Once a challenge is used up or expired, nothing else is looked at, not even the code.
+	s, mock, token := newTestTwoFactorLogin(t)
+	code, _ := currentTOTP(t)
+	expectChallengeAttempt(mock, false)
+	if _, err := s.VerifyTwoFactor(context.Background(), token, code, SessionDevice{}); !errors.Is(err, ErrInvalidTwoFactorToken) {
+		t.Fatalf("err = %v, want ErrInvalidTwoFactorToken", err)
+	}
+}
+
+func TestVerifyTwoFactorRejectsOtherTokens(t *testing.T) {
+	s, _, _ := newTestTwoFactorLogin(t)
+	access, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "u1", "sid": "s1", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "u1", "jti": "c1", "typ": "2fa", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("another-secret"))
+	for name, token := range map[string]string{"access token": access, "forged": forged, "garbage": "x.y.z"} {
+		if _, err := s.VerifyTwoFactor(context.Background(), token, "123456", SessionDevice{}); !errors.Is(err, ErrInvalidTwoFactorToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidTwoFactorToken", name, err)
+		}
+	}
+}
+
+func TestVerifyTwoFactorWrongCodeCountsTowardsLockout(t *testing.T) {
+	user := domain.User{ID: "u1", Email: "u1@example.com", Role: domain.RoleSchoolAdmin}
+
+	t.Run("below the threshold", func(t *testing.T) {
+		s, mock, token := newTestTwoFactorLogin(t)
+		expectChallengeAttempt(mock, true)
+		expectUser(mock, user)
+		expectNotLocked(mock)
+		expectTOTP(mock, "u1", 0)
+		mock.ExpectExec(`UPDATE two_factor_recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT failed_login_count FROM users WHERE id = \? FOR UPDATE`).WithArgs("u1").
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_count"}).AddRow(0))
+		mock.ExpectExec(`UPDATE users SET failed_login_count = \? WHERE id = \?`).WithArgs(1, "u1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if _, err := s.VerifyTwoFactor(context.Background(), token, "000000", SessionDevice{}); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("err = %v, want ErrInvalidTwoFactorCode", err)
+		}
+	})
+
+	t.Run("reaching the threshold", func(t *testing.T) {
+		s, mock, token := newTestTwoFactorLogin(t)
+		expectChallengeAttempt(mock, true)
+		expectUser(mock, user)
+		expectNotLocked(mock)
+		expectTOTP(mock, "u1", 0)
+		mock.ExpectExec(`UPDATE two_factor_recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT failed_login_count FROM users`).WithArgs("u1").
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_count"}).AddRow(2))
+		mock.ExpectExec(`UPDATE users SET failed_login_count = 0, locked_until = \?`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := s.VerifyTwoFactor(context.Background(), token, "000000", SessionDevice{IP: "203.0.113.7"})
+		var locked *AccountLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("err = %v, want AccountLockedError", err)
+		}
+	})
+}
+
+func TestVerifyTwoFactorRefusesLockedAccount(t *testing.T) {
+	// A locked account is refused even the right code, which is not spent.
+	s, mock, token := newTestTwoFactorLogin(t)
+	code, _ := currentTOTP(t)
+	expectChallengeAttempt(mock, true)
+	expectUser(mock, domain.User{ID: "u1", Role: domain.RoleSchoolAdmin})
+	mock.ExpectQuery(`SELECT locked_until FROM users`).WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(10 * time.Minute)))
+
+	if _, err := s.VerifyTwoFactor(context.Background(), token, code, SessionDevice{}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("err = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestVerifyTwoFactorStartsSession(t *testing.T) {
+	s, mock, token := newTestTwoFactorLogin(t)
+	code, step := currentTOTP(t)
+	expectChallengeAttempt(mock, true)
+	expectUser(mock, domain.User{ID: "u1", Role: domain.RoleSchoolAdmin})
+	expectNotLocked(mock)
+	expectTOTP(mock, "u1", 0)
+	mock.ExpectExec(`UPDATE users SET totp_last_step`).WithArgs(step, "u1", step).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM two_factor_challenges WHERE id = \?`).WithArgs("c1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET failed_login_count = 0, locked_until = NULL`).WithArgs("u1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tokens, err := s.VerifyTwoFactor(context.Background(), token, code, SessionDevice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("tokens = %+v, want an access and a refresh token", tokens)
+	}
+}
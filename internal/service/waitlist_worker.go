@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WaitlistWorker periodically withdraws unaccepted waitlist seat offers whose deadline has
+// passed and offers the seats to the next students in line.
+type WaitlistWorker struct {
+	*periodic
+	courses *CourseService
+}
+
+func NewWaitlistWorker(courses *CourseService, interval time.Duration) *WaitlistWorker {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	w := &WaitlistWorker{courses: courses}
+	w.periodic = newPeriodic("Waitlist worker", interval, w.runOnce)
+	return w
+}
+
+func (w *WaitlistWorker) runOnce(ctx context.Context) {
+	expired, err := w.courses.ExpireWaitlistOffers(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[WaitlistWorker] error: %v", err)
+		}
+		return
+	}
+	if expired > 0 {
+		log.Printf("[WaitlistWorker] expired %d seat offers", expired)
+	}
+}
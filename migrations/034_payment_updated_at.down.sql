@@ -0,0 +1,2 @@
+DROP INDEX idx_payments_external_id ON payments;
+ALTER TABLE payments DROP COLUMN updated_at;
@@ -0,0 +1,3 @@
+-- UpdateStatus/UpdateStatusByExternalID write updated_at, and callbacks look payments up by external_id
+ALTER TABLE payments ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER created_at;
+CREATE INDEX idx_payments_external_id ON payments(external_id);
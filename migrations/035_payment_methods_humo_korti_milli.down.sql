@@ -0,0 +1,2 @@
+UPDATE payments SET method = 'other' WHERE method IN ('humo', 'korti_milli');
+ALTER TABLE payments MODIFY method ENUM('cash', 'card', 'transfer', 'alif', 'other') NOT NULL DEFAULT 'cash';
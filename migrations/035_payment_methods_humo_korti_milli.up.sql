@@ -0,0 +1,2 @@
+-- Add Humo and Korti Milli gateways to payment methods
+ALTER TABLE payments MODIFY method ENUM('cash', 'card', 'transfer', 'alif', 'humo', 'korti_milli', 'other') NOT NULL DEFAULT 'cash';
@@ -0,0 +1,2 @@
+DROP INDEX idx_payments_status_created ON payments;
+DROP TABLE IF EXISTS payment_reconciliations;
@@ -0,0 +1,15 @@
+-- Audit log of status changes made by the pending-payment reconciler
+CREATE TABLE IF NOT EXISTS payment_reconciliations (
+    id CHAR(36) PRIMARY KEY,
+    payment_id CHAR(36) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    external_id VARCHAR(255) DEFAULT '',
+    old_status VARCHAR(20) NOT NULL,
+    new_status VARCHAR(20) NOT NULL,
+    reason VARCHAR(255) DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+    INDEX idx_payment_reconciliations_created (created_at)
+);
+
+CREATE INDEX idx_payments_status_created ON payments(status, created_at);
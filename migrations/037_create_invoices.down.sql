@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invoice_allocations;
+DROP TABLE IF EXISTS invoices;
+ALTER TABLE courses DROP COLUMN billing_cycle;
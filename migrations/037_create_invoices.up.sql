@@ -0,0 +1,34 @@
+-- Courses bill either once on enrollment or every month of the schedule
+ALTER TABLE courses ADD COLUMN billing_cycle ENUM('one_time', 'monthly') NOT NULL DEFAULT 'one_time' AFTER price;
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id CHAR(36) PRIMARY KEY,
+    enrollment_id CHAR(36) NOT NULL,
+    student_user_id CHAR(36) NOT NULL,
+    course_id CHAR(36) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    amount_paid DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+    status ENUM('open', 'partially_paid', 'paid', 'void') NOT NULL DEFAULT 'open',
+    period_start DATE NOT NULL,
+    period_end DATE NULL,
+    due_date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_invoice_period (enrollment_id, period_start),
+    INDEX idx_invoices_student_course (student_user_id, course_id, status),
+    INDEX idx_invoices_course_due (course_id, status, due_date),
+    FOREIGN KEY (enrollment_id) REFERENCES enrollments(id) ON DELETE CASCADE,
+    FOREIGN KEY (student_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE
+);
+
+-- Which payment settled which invoice, and for how much
+CREATE TABLE IF NOT EXISTS invoice_allocations (
+    id CHAR(36) PRIMARY KEY,
+    invoice_id CHAR(36) NOT NULL,
+    payment_id CHAR(36) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE,
+    FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE
+);
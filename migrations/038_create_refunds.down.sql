@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS refunds;
+UPDATE payments SET status = 'success' WHERE status IN ('refunded', 'partially_refunded');
+ALTER TABLE payments DROP COLUMN refunded_amount;
+ALTER TABLE payments MODIFY status ENUM('pending', 'success', 'failed') NOT NULL DEFAULT 'success';
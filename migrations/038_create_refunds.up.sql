@@ -0,0 +1,18 @@
+-- Refunds: payments track how much was returned, each refund is its own record
+ALTER TABLE payments MODIFY status ENUM('pending', 'success', 'failed', 'refunded', 'partially_refunded') NOT NULL DEFAULT 'success';
+ALTER TABLE payments ADD COLUMN refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00 AFTER amount;
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id CHAR(36) PRIMARY KEY,
+    payment_id CHAR(36) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    reason TEXT,
+    status ENUM('pending', 'success', 'failed') NOT NULL DEFAULT 'pending',
+    external_id VARCHAR(255) DEFAULT '',
+    created_by CHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_refunds_payment (payment_id),
+    FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
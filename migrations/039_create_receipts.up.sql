@@ -0,0 +1,17 @@
+-- Sequential receipt numbers per issuer (the school, or the teacher for independent courses)
+CREATE TABLE IF NOT EXISTS receipt_counters (
+    issuer_id CHAR(36) PRIMARY KEY,
+    last_number INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS receipts (
+    id CHAR(36) PRIMARY KEY,
+    payment_id CHAR(36) NOT NULL,
+    issuer_id CHAR(36) NOT NULL,
+    number INT NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_receipt_payment (payment_id),
+    UNIQUE KEY uq_receipt_number (issuer_id, number),
+    FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE
+);
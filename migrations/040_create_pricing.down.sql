@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS scholarships;
+DROP TABLE IF EXISTS promo_redemptions;
+DROP TABLE IF EXISTS promo_codes;
+ALTER TABLE schools DROP COLUMN sibling_discount_percent;
@@ -0,0 +1,55 @@
+-- Automatic discount for students whose sibling is already enrolled at the same school
+ALTER TABLE schools ADD COLUMN sibling_discount_percent DECIMAL(5, 2) NOT NULL DEFAULT 0;
+
+-- Promo codes are scoped to a school and optionally a single course; global codes have neither
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id CHAR(36) PRIMARY KEY,
+    code VARCHAR(50) NOT NULL,
+    school_id CHAR(36) NULL,
+    course_id CHAR(36) NULL,
+    created_by CHAR(36) NOT NULL,
+    discount_type ENUM('percent', 'fixed') NOT NULL,
+    value DECIMAL(10, 2) NOT NULL,
+    max_uses INT NULL,
+    used_count INT NOT NULL DEFAULT 0,
+    valid_from TIMESTAMP NULL,
+    valid_until TIMESTAMP NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_promo_code (code),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE,
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- A redeemed code stays attached to the student's course, so later invoices keep the discount
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id CHAR(36) PRIMARY KEY,
+    promo_code_id CHAR(36) NOT NULL,
+    student_user_id CHAR(36) NOT NULL,
+    course_id CHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_redemption_student_course (student_user_id, course_id),
+    FOREIGN KEY (promo_code_id) REFERENCES promo_codes(id) ON DELETE CASCADE,
+    FOREIGN KEY (student_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE
+);
+
+-- Per-student scholarships; a NULL course_id covers every course of the school
+CREATE TABLE IF NOT EXISTS scholarships (
+    id CHAR(36) PRIMARY KEY,
+    school_id CHAR(36) NOT NULL,
+    student_user_id CHAR(36) NOT NULL,
+    course_id CHAR(36) NULL,
+    discount_type ENUM('percent', 'fixed') NOT NULL,
+    value DECIMAL(10, 2) NOT NULL,
+    note TEXT,
+    valid_until DATE NULL,
+    created_by CHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_scholarship_student (student_user_id, school_id),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE,
+    FOREIGN KEY (student_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS exchange_rates;
+ALTER TABLE payments DROP COLUMN exchange_rate;
+ALTER TABLE payments DROP COLUMN currency;
+ALTER TABLE schools DROP COLUMN reporting_currency;
+ALTER TABLE courses DROP COLUMN currency;
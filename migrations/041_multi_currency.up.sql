@@ -0,0 +1,20 @@
+-- Amounts are stored in their own currency; rates convert them to TJS, the base currency
+ALTER TABLE courses ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'TJS' AFTER price;
+ALTER TABLE schools ADD COLUMN reporting_currency CHAR(3) NOT NULL DEFAULT 'TJS';
+
+-- exchange_rate snapshots how many TJS one unit of the payment currency was worth when it was paid
+ALTER TABLE payments ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'TJS' AFTER amount;
+ALTER TABLE payments ADD COLUMN exchange_rate DECIMAL(18, 8) NOT NULL DEFAULT 1 AFTER currency;
+
+-- Rates are entered by platform admins; each row is valid from effective_at until the next one
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id CHAR(36) PRIMARY KEY,
+    currency CHAR(3) NOT NULL,
+    rate DECIMAL(18, 8) NOT NULL,
+    effective_at TIMESTAMP NOT NULL,
+    source VARCHAR(50) NOT NULL DEFAULT 'manual',
+    created_by CHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_exchange_rates_currency (currency, effective_at),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+);
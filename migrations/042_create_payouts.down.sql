@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payout_lines;
+DROP TABLE IF EXISTS payout_statements;
+ALTER TABLE schools DROP COLUMN teacher_share_percent;
+ALTER TABLE schools DROP COLUMN payout_mode;
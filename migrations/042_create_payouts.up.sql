@@ -0,0 +1,45 @@
+-- How a school splits course revenue with its teachers: a share of net revenue, or the
+-- teacher's hourly rate for every session taught
+ALTER TABLE schools ADD COLUMN payout_mode ENUM('percentage', 'hourly') NOT NULL DEFAULT 'percentage';
+ALTER TABLE schools ADD COLUMN teacher_share_percent DECIMAL(5, 2) NOT NULL DEFAULT 0;
+
+-- One statement per teacher and month; amounts are in the school's reporting currency.
+-- Pending statements are recomputed until the school marks them paid.
+CREATE TABLE IF NOT EXISTS payout_statements (
+    id CHAR(36) PRIMARY KEY,
+    school_id CHAR(36) NOT NULL,
+    teacher_id CHAR(36) NOT NULL,
+    period DATE NOT NULL,
+    mode ENUM('percentage', 'hourly') NOT NULL,
+    currency CHAR(3) NOT NULL,
+    revenue DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    sessions INT NOT NULL DEFAULT 0,
+    hours DECIMAL(8, 2) NOT NULL DEFAULT 0,
+    amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    status ENUM('pending', 'paid') NOT NULL DEFAULT 'pending',
+    paid_at TIMESTAMP NULL,
+    paid_by CHAR(36) NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_payout_statement (school_id, teacher_id, period),
+    INDEX idx_payout_statements_teacher (teacher_id, period),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE,
+    FOREIGN KEY (teacher_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (paid_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- The per-course breakdown behind a statement
+CREATE TABLE IF NOT EXISTS payout_lines (
+    id CHAR(36) PRIMARY KEY,
+    statement_id CHAR(36) NOT NULL,
+    course_id CHAR(36) NOT NULL,
+    revenue DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    sessions INT NOT NULL DEFAULT 0,
+    hours DECIMAL(8, 2) NOT NULL DEFAULT 0,
+    rate DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    INDEX idx_payout_lines_statement (statement_id),
+    FOREIGN KEY (statement_id) REFERENCES payout_statements(id) ON DELETE CASCADE,
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE
+);
@@ -0,0 +1,19 @@
+-- Responses to mutating requests sent with an Idempotency-Key header, replayed on retries.
+-- Keys are scoped to the user and expire after 24 hours.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status ENUM('processing', 'completed') NOT NULL DEFAULT 'processing',
+    response_status INT NULL,
+    response_content_type VARCHAR(100) NOT NULL DEFAULT '',
+    response_body MEDIUMBLOB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    UNIQUE KEY uq_idempotency_key (user_id, idempotency_key),
+    INDEX idx_idempotency_keys_created (created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
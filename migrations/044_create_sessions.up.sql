@@ -0,0 +1,18 @@
+-- One row per login. Refresh tokens are stored as SHA-256 hashes and rotated on every use;
+-- the previous hash is kept to detect a stolen token being replayed.
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    refresh_token_hash CHAR(64) NOT NULL,
+    previous_token_hash CHAR(64) NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    UNIQUE KEY uq_sessions_refresh_token (refresh_token_hash),
+    INDEX idx_sessions_previous_token (previous_token_hash),
+    INDEX idx_sessions_user (user_id, revoked_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
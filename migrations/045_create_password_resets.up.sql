@@ -0,0 +1,13 @@
+-- Forgot-password links. Only the SHA-256 hash of the emailed token is stored; a token
+-- works once and expires after an hour.
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_password_reset_token (token_hash),
+    INDEX idx_password_reset_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
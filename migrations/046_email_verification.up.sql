@@ -0,0 +1,16 @@
+-- Accounts confirm their email address before they can enroll or pay.
+-- Existing accounts predate verification and are treated as verified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL AFTER email;
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_email_verification_token (token_hash),
+    INDEX idx_email_verification_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
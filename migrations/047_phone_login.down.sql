@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS phone_otps;
+ALTER TABLE users DROP INDEX uq_users_phone;
+ALTER TABLE users DROP COLUMN phone_verified_at;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users MODIFY email VARCHAR(255) NOT NULL;
@@ -0,0 +1,20 @@
+-- Accounts can sign in with a phone number instead of an email address.
+-- A phone-only account has no email, so the column becomes optional.
+ALTER TABLE users MODIFY email VARCHAR(255) NULL;
+ALTER TABLE users ADD COLUMN phone VARCHAR(20) NULL AFTER email_verified_at;
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMP NULL AFTER phone;
+ALTER TABLE users ADD UNIQUE KEY uq_users_phone (phone);
+
+-- One-time codes sent by SMS. Only a hash of the code is stored.
+CREATE TABLE IF NOT EXISTS phone_otps (
+    id CHAR(36) PRIMARY KEY,
+    phone VARCHAR(20) NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_phone_otps_phone (phone, created_at),
+    INDEX idx_phone_otps_ip (ip_address, created_at)
+);
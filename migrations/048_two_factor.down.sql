@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+ALTER TABLE schools DROP COLUMN require_teacher_2fa;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_enabled_at;
+ALTER TABLE users DROP COLUMN totp_secret;
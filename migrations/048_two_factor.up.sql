@@ -0,0 +1,20 @@
+-- Optional TOTP two-factor authentication. totp_secret is set when enrollment starts and
+-- totp_enabled_at once the user proves their authenticator app works. totp_last_step is
+-- the newest 30-second step a code was accepted for, so a code cannot be replayed.
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Schools can make two-factor authentication mandatory for their teachers.
+ALTER TABLE schools ADD COLUMN require_teacher_2fa BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Single-use codes for signing in without the authenticator app. Only hashes are stored.
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_recovery_codes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,26 @@
+-- Brute-force protection for sign-in: accounts lock for a while after repeated wrong
+-- passwords, and request rate limits can be shared between API instances.
+ALTER TABLE users ADD COLUMN failed_login_count INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMP NULL;
+
+-- Token buckets for the database rate limiter backend.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key VARCHAR(191) PRIMARY KEY,
+    tokens DOUBLE NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    INDEX idx_rate_limit_buckets_updated (updated_at)
+);
+
+-- Security-relevant events, such as account lockouts.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id CHAR(36) PRIMARY KEY,
+    actor_user_id CHAR(36) NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL DEFAULT '',
+    target_id VARCHAR(64) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    details TEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_log_target (target_type, target_id),
+    INDEX idx_audit_log_created (created_at)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS guardian_links;
+DELETE FROM users WHERE role = 'parent';
+ALTER TABLE users MODIFY COLUMN role ENUM('admin', 'school_admin', 'teacher', 'student') NOT NULL;
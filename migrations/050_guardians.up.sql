@@ -0,0 +1,25 @@
+-- Parent and guardian accounts, linked to the students they look after.
+ALTER TABLE users MODIFY COLUMN role ENUM('admin', 'school_admin', 'teacher', 'student', 'parent') NOT NULL;
+
+-- A link starts as an invitation sent to an email address or phone number and becomes
+-- active when a parent account accepts it. A student can have several guardians and a
+-- guardian several children.
+CREATE TABLE IF NOT EXISTS guardian_links (
+    id CHAR(36) PRIMARY KEY,
+    student_user_id CHAR(36) NOT NULL,
+    guardian_user_id CHAR(36) NULL,
+    relationship VARCHAR(32) NOT NULL DEFAULT '',
+    invited_email VARCHAR(255) NOT NULL DEFAULT '',
+    invited_phone VARCHAR(20) NOT NULL DEFAULT '',
+    invited_by CHAR(36) NOT NULL,
+    token_hash CHAR(64) NULL,
+    status ENUM('pending', 'active', 'revoked') NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP NULL,
+    accepted_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_guardian_links_token (token_hash),
+    INDEX idx_guardian_links_student (student_user_id, status),
+    INDEX idx_guardian_links_guardian (guardian_user_id, status),
+    FOREIGN KEY (student_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (guardian_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
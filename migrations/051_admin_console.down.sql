@@ -0,0 +1,10 @@
+DROP INDEX idx_audit_log_actor ON audit_log;
+ALTER TABLE sessions DROP COLUMN impersonator_user_id;
+ALTER TABLE ratings DROP COLUMN moderation_note;
+ALTER TABLE ratings DROP COLUMN hidden_by;
+ALTER TABLE ratings DROP COLUMN hidden_at;
+ALTER TABLE schools DROP COLUMN verified_by;
+ALTER TABLE schools DROP COLUMN verified_at;
+ALTER TABLE schools DROP COLUMN verification_note;
+ALTER TABLE users DROP COLUMN suspension_reason;
+ALTER TABLE users DROP COLUMN suspended_at;
@@ -0,0 +1,18 @@
+-- Platform administration: suspending accounts, reviewing schools, moderating ratings and
+-- signing in as a user for support.
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN suspension_reason VARCHAR(255) NULL;
+
+ALTER TABLE schools ADD COLUMN verification_note TEXT NULL;
+ALTER TABLE schools ADD COLUMN verified_at TIMESTAMP NULL;
+ALTER TABLE schools ADD COLUMN verified_by CHAR(36) NULL;
+
+-- Hidden ratings stay in the table but are left out of listings and averages.
+ALTER TABLE ratings ADD COLUMN hidden_at TIMESTAMP NULL;
+ALTER TABLE ratings ADD COLUMN hidden_by CHAR(36) NULL;
+ALTER TABLE ratings ADD COLUMN moderation_note VARCHAR(255) NULL;
+
+-- Sessions an admin opened as another user.
+ALTER TABLE sessions ADD COLUMN impersonator_user_id CHAR(36) NULL;
+
+CREATE INDEX idx_audit_log_actor ON audit_log (actor_user_id, created_at);
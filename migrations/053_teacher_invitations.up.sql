@@ -0,0 +1,20 @@
+-- Schools invite teachers by email instead of creating their accounts. The invitation is
+-- accepted by an existing teacher account, or by setting a password for a new one.
+CREATE TABLE IF NOT EXISTS teacher_invitations (
+    id CHAR(36) PRIMARY KEY,
+    school_id CHAR(36) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    bio TEXT NULL,
+    invited_by CHAR(36) NOT NULL,
+    token_hash CHAR(64) NULL,
+    status ENUM('pending', 'accepted', 'revoked') NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP NOT NULL,
+    accepted_by CHAR(36) NULL,
+    accepted_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_teacher_invitations_token (token_hash),
+    INDEX idx_teacher_invitations_school (school_id, status),
+    INDEX idx_teacher_invitations_email (email, status),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE,
+    FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,18 @@
+-- School staff. Each member has a role whose permission set decides what they may do at
+-- the school; schools.admin_user_id stays as the owner who created the school. A staff
+-- account belongs to one school.
+CREATE TABLE IF NOT EXISTS school_members (
+    school_id CHAR(36) NOT NULL,
+    user_id CHAR(36) NOT NULL,
+    role ENUM('owner', 'admin', 'accountant', 'registrar') NOT NULL,
+    added_by CHAR(36) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (school_id, user_id),
+    UNIQUE KEY uq_school_members_user (user_id),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT IGNORE INTO school_members (school_id, user_id, role, created_at)
+SELECT id, admin_user_id, 'owner', created_at FROM schools;
@@ -0,0 +1,13 @@
+ALTER TABLE school_members DROP FOREIGN KEY fk_school_members_branch;
+ALTER TABLE school_members DROP COLUMN branch_id;
+DELETE FROM school_members WHERE role = 'branch_manager';
+ALTER TABLE school_members MODIFY COLUMN role ENUM('owner', 'admin', 'accountant', 'registrar') NOT NULL;
+
+ALTER TABLE teacher_profiles DROP FOREIGN KEY fk_teacher_profiles_branch;
+ALTER TABLE teacher_profiles DROP COLUMN branch_id;
+
+ALTER TABLE courses DROP FOREIGN KEY fk_courses_branch;
+ALTER TABLE courses DROP COLUMN branch_id;
+
+DROP TABLE IF EXISTS branch_rooms;
+DROP TABLE IF EXISTS school_branches;
@@ -0,0 +1,35 @@
+-- Branches of a school in different places. Courses, teachers and rooms can belong to a
+-- branch; a branch manager on the school's staff sees only their branch.
+CREATE TABLE IF NOT EXISTS school_branches (
+    id CHAR(36) PRIMARY KEY,
+    school_id CHAR(36) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    address TEXT NULL,
+    city VARCHAR(100) NULL,
+    phone VARCHAR(50) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_school_branches_school (school_id),
+    FOREIGN KEY (school_id) REFERENCES schools(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS branch_rooms (
+    id CHAR(36) PRIMARY KEY,
+    branch_id CHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    capacity INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_branch_rooms_name (branch_id, name),
+    FOREIGN KEY (branch_id) REFERENCES school_branches(id) ON DELETE CASCADE
+);
+
+ALTER TABLE courses ADD COLUMN branch_id CHAR(36) NULL;
+ALTER TABLE courses ADD CONSTRAINT fk_courses_branch FOREIGN KEY (branch_id) REFERENCES school_branches(id) ON DELETE SET NULL;
+
+ALTER TABLE teacher_profiles ADD COLUMN branch_id CHAR(36) NULL;
+ALTER TABLE teacher_profiles ADD CONSTRAINT fk_teacher_profiles_branch FOREIGN KEY (branch_id) REFERENCES school_branches(id) ON DELETE SET NULL;
+
+-- A branch manager's membership is tied to their branch and goes with it.
+ALTER TABLE school_members MODIFY COLUMN role ENUM('owner', 'admin', 'accountant', 'registrar', 'branch_manager') NOT NULL;
+ALTER TABLE school_members ADD COLUMN branch_id CHAR(36) NULL;
+ALTER TABLE school_members ADD CONSTRAINT fk_school_members_branch FOREIGN KEY (branch_id) REFERENCES school_branches(id) ON DELETE CASCADE;
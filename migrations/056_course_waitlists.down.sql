@@ -0,0 +1,7 @@
+DROP INDEX idx_enrollments_waitlist ON enrollments;
+ALTER TABLE enrollments DROP COLUMN offer_expires_at;
+ALTER TABLE enrollments DROP COLUMN waitlisted_at;
+DELETE FROM enrollments WHERE status IN ('waitlisted', 'offered');
+ALTER TABLE enrollments MODIFY COLUMN status ENUM('active', 'completed', 'dropped', 'invited', 'pending', 'rejected') DEFAULT 'active';
+
+ALTER TABLE courses DROP COLUMN max_students;
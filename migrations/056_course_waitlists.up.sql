@@ -0,0 +1,8 @@
+-- A course can limit its seats. Approved students who do not fit wait in line by
+-- waitlisted_at; when a seat frees up, the first is offered it until offer_expires_at.
+ALTER TABLE courses ADD COLUMN max_students INT NULL;
+
+ALTER TABLE enrollments MODIFY COLUMN status ENUM('active', 'completed', 'dropped', 'invited', 'pending', 'rejected', 'waitlisted', 'offered') DEFAULT 'active';
+ALTER TABLE enrollments ADD COLUMN waitlisted_at TIMESTAMP NULL;
+ALTER TABLE enrollments ADD COLUMN offer_expires_at TIMESTAMP NULL;
+CREATE INDEX idx_enrollments_waitlist ON enrollments (course_id, status, waitlisted_at);
@@ -0,0 +1,13 @@
+ALTER TABLE assignments DROP FOREIGN KEY fk_assignments_section;
+ALTER TABLE assignments DROP COLUMN section_id;
+
+ALTER TABLE grades DROP FOREIGN KEY fk_grades_section;
+ALTER TABLE grades DROP COLUMN section_id;
+
+ALTER TABLE attendance DROP FOREIGN KEY fk_attendance_section;
+ALTER TABLE attendance DROP COLUMN section_id;
+
+ALTER TABLE enrollments DROP FOREIGN KEY fk_enrollments_section;
+ALTER TABLE enrollments DROP COLUMN section_id;
+
+DROP TABLE IF EXISTS course_sections;
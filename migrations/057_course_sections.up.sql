@@ -0,0 +1,32 @@
+-- Sections are groups of one course that meet at their own times with their own teacher
+-- and seat limit, sharing the course's curriculum. Students, and the attendance, grades
+-- and assignments of a group, can belong to a section.
+CREATE TABLE IF NOT EXISTS course_sections (
+    id CHAR(36) PRIMARY KEY,
+    course_id CHAR(36) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    schedule JSON NULL,
+    teacher_id CHAR(36) NULL,
+    max_students INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_course_sections_name (course_id, name),
+    INDEX idx_course_sections_teacher (teacher_id),
+    FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE,
+    FOREIGN KEY (teacher_id) REFERENCES teacher_profiles(user_id) ON DELETE SET NULL
+);
+
+ALTER TABLE enrollments ADD COLUMN section_id CHAR(36) NULL;
+ALTER TABLE enrollments ADD CONSTRAINT fk_enrollments_section FOREIGN KEY (section_id) REFERENCES course_sections(id) ON DELETE SET NULL;
+
+-- The section a session was held for, or a grade given in.
+ALTER TABLE attendance ADD COLUMN section_id CHAR(36) NULL;
+ALTER TABLE attendance ADD CONSTRAINT fk_attendance_section FOREIGN KEY (section_id) REFERENCES course_sections(id) ON DELETE SET NULL;
+
+ALTER TABLE grades ADD COLUMN section_id CHAR(36) NULL;
+ALTER TABLE grades ADD CONSTRAINT fk_grades_section FOREIGN KEY (section_id) REFERENCES course_sections(id) ON DELETE SET NULL;
+
+-- An assignment for one section only; NULL means the whole course. When a section is
+-- deleted its assignments, with the work handed in, stay with the course.
+ALTER TABLE assignments ADD COLUMN section_id CHAR(36) NULL;
+ALTER TABLE assignments ADD CONSTRAINT fk_assignments_section FOREIGN KEY (section_id) REFERENCES course_sections(id) ON DELETE SET NULL;
@@ -0,0 +1,11 @@
+-- A password or SMS login waiting for its second factor. Each challenge allows a few code
+-- attempts and is deleted once it succeeds.
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_two_factor_challenges_user (user_id, expires_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+-- Teachers removed from a school used to keep its courses and sections assigned to them,
+-- and with them access. Unassign any that are no longer on the school's staff.
+UPDATE courses c
+JOIN teacher_profiles tp ON tp.user_id = c.teacher_id
+SET c.teacher_id = NULL
+WHERE c.school_id IS NOT NULL AND (tp.school_id IS NULL OR tp.school_id <> c.school_id);
+
+UPDATE course_sections cs
+JOIN courses c ON c.id = cs.course_id
+JOIN teacher_profiles tp ON tp.user_id = cs.teacher_id
+SET cs.teacher_id = NULL
+WHERE c.school_id IS NOT NULL AND (tp.school_id IS NULL OR tp.school_id <> c.school_id);
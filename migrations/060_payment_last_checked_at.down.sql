@@ -0,0 +1,2 @@
+DROP INDEX idx_payments_status_checked ON payments;
+ALTER TABLE payments DROP COLUMN last_checked_at;
@@ -0,0 +1,4 @@
+-- The reconciler asks about the payments it checked longest ago first, so that ones whose
+-- status lookups keep failing do not hold up the rest
+ALTER TABLE payments ADD COLUMN last_checked_at TIMESTAMP NULL DEFAULT NULL AFTER updated_at;
+CREATE INDEX idx_payments_status_checked ON payments(status, last_checked_at);
@@ -0,0 +1,11 @@
+-- A checkout holds one use of its promo code until the payment settles (the code is then
+-- redeemed) or fails (the use is given back)
+CREATE TABLE IF NOT EXISTS promo_reservations (
+    payment_id CHAR(36) PRIMARY KEY,
+    promo_code_id CHAR(36) NOT NULL,
+    student_user_id CHAR(36) NOT NULL,
+    course_id CHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+    FOREIGN KEY (promo_code_id) REFERENCES promo_codes(id) ON DELETE CASCADE
+);
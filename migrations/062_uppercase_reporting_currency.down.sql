@@ -0,0 +1,2 @@
+-- Nothing to undo: upper-case codes are valid before this migration too
+SELECT 1;
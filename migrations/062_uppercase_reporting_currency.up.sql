@@ -0,0 +1,2 @@
+-- Reporting currencies are compared with upper-case currency codes
+UPDATE schools SET reporting_currency = UPPER(reporting_currency);
@@ -0,0 +1 @@
+DROP INDEX idx_refunds_status_created ON refunds;
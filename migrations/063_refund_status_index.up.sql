@@ -0,0 +1,2 @@
+-- The reconciler looks for refunds left pending
+CREATE INDEX idx_refunds_status_created ON refunds(status, created_at);
@@ -0,0 +1,8 @@
+-- Migration 046 marked every existing address verified although nobody had confirmed it,
+-- and some were typed in by staff. Those accounts keep working, but sign-in providers are
+-- not linked to them by email until the owner confirms the address.
+ALTER TABLE users ADD COLUMN email_verification_assumed BOOLEAN NOT NULL DEFAULT FALSE AFTER email_verified_at;
+UPDATE users u SET email_verification_assumed = TRUE
+WHERE u.email_verified_at = u.created_at
+  AND NOT EXISTS (SELECT 1 FROM email_verification_tokens t WHERE t.user_id = u.id AND t.used_at IS NOT NULL)
+  AND NOT EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = u.id);
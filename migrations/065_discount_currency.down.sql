@@ -0,0 +1,2 @@
+ALTER TABLE scholarships DROP COLUMN currency;
+ALTER TABLE promo_codes DROP COLUMN currency;
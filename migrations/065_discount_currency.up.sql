@@ -0,0 +1,7 @@
+-- A fixed discount is an amount of money, so it needs a currency. Course-scoped discounts
+-- were meant in the course's currency; the others predate multi-currency courses and are TJS.
+ALTER TABLE promo_codes ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'TJS' AFTER value;
+ALTER TABLE scholarships ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'TJS' AFTER value;
+
+UPDATE promo_codes p JOIN courses c ON p.course_id = c.id SET p.currency = c.currency;
+UPDATE scholarships s JOIN courses c ON s.course_id = c.id SET s.currency = c.currency;
@@ -51,6 +51,11 @@ INSERT INTO schools (id, admin_user_id, name, tax_id, phone, address, city, is_v
 ('s-eurasia-001', 'u-sadmin-002', 'Eurasia STEM Academy', '987654321', '+992-37-224-5678', '42 Ismoili Somoni St', 'Dushanbe', TRUE, 4.2, 8, NOW(), NOW()),
 ('s-arts-001', 'u-sadmin-001', 'Creative Arts Studio', '555666777', '+992-37-221-9012', '8 Mirzo Tursunzade', 'Khujand', FALSE, 0, 0, NOW(), NOW());
 
+-- A staff account belongs to one school, so u-sadmin-001 runs Oxford only.
+INSERT INTO school_members (school_id, user_id, role) VALUES
+('s-oxford-001', 'u-sadmin-001', 'owner'),
+('s-eurasia-001', 'u-sadmin-002', 'owner');
+
 -- ============================================================
 -- TEACHER PROFILES
 -- ============================================================
@@ -324,3 +329,6 @@ INSERT INTO ratings (id, from_user_id, to_user_id, to_school_id, score, comment,
 ('r-006', 'u-stud-001', NULL, 's-oxford-001', 5, 'Oxford Language Center has been excellent. Great facilities and teachers.', DATE_SUB(NOW(), INTERVAL 6 DAY)),
 ('r-007', 'u-stud-003', NULL, 's-eurasia-001', 4, 'Good STEM programs, especially programming courses.', DATE_SUB(NOW(), INTERVAL 3 DAY)),
 ('r-008', 'u-stud-005', 'u-teach-004', NULL, 4, 'Helpful tutor, explains things clearly. Flexible scheduling.', DATE_SUB(NOW(), INTERVAL 2 DAY));
+
+-- Demo accounts are treated as having confirmed their email
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
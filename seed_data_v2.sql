@@ -24,6 +24,9 @@ INSERT INTO users (id, email, name, password_hash, role, created_at, updated_at)
 INSERT INTO schools (id, admin_user_id, name, tax_id, phone, address, city, is_verified, rating_avg, rating_count, created_at, updated_at) VALUES
 ('s-linguist-001', 'u-sadmin-003', 'Linguist Academy', '111222333', '+992-37-225-3456', '22 Sino St', 'Dushanbe', TRUE, 4.7, 5, NOW(), NOW());
 
+INSERT INTO school_members (school_id, user_id, role) VALUES
+('s-linguist-001', 'u-sadmin-003', 'owner');
+
 -- ============================================================
 -- NEW TEACHER PROFILES
 -- ============================================================
@@ -239,3 +242,6 @@ INSERT INTO announcements (id, course_id, author_id, title, content, is_pinned,
 ('ann-008', NULL, 'u-sadmin-003', 'Linguist Academy Now Open!', 'We are excited to announce that Linguist Academy is now accepting enrollments for Arabic, Persian, and Tajik language courses. Visit us at 22 Sino St!', TRUE, DATE_SUB(NOW(), INTERVAL 14 DAY)),
 ('ann-009', 'c-data-001', 'u-teach-003', 'Laptop Required for Next Class', 'Please bring your laptops with Python and Jupyter Notebook installed for our first hands-on data analysis session.', FALSE, DATE_SUB(NOW(), INTERVAL 1 DAY)),
 ('ann-010', 'c-rus-001', 'u-teach-005', 'Pushkin Evening', 'We will have a poetry reading evening on March 1st celebrating Pushkin''s legacy. Bring your favorite poem!', FALSE, DATE_SUB(NOW(), INTERVAL 3 DAY));
+
+-- Demo accounts are treated as having confirmed their email
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
@@ -15,7 +15,7 @@ interface AuthContextType {
     user: User | null;
     setUser: React.Dispatch<React.SetStateAction<User | null>>;
     token: string | null;
-    login: (token: string, user: User) => void;
+    login: (token: string, user: User, refreshToken?: string) => void;
     logout: () => void;
     isAuthenticated: boolean;
 }
@@ -28,7 +28,12 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
 
     // Define logout here so it's available within useEffect
     const logout = () => {
+        if (localStorage.getItem('token')) {
+            // Revoke the session server-side; the local tokens are dropped either way
+            api.post('/api/auth/logout').catch(() => {});
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         setToken(null);
         setUser(null);
     };
@@ -53,8 +58,11 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
         fetchMe();
     }, [token]);
 
-    const login = (newToken: string, newUser: User) => {
+    const login = (newToken: string, newUser: User, refreshToken?: string) => {
         localStorage.setItem('token', newToken);
+        if (refreshToken) {
+            localStorage.setItem('refresh_token', refreshToken);
+        }
         setToken(newToken);
         // User will be fetched by effect or we can set it directly if passed
         // But better to rely on Single Source of Truth if possible, or optimistic update
@@ -12,14 +12,43 @@ api.interceptors.request.use((config) => {
     return config;
 });
 
+// Refresh tokens are single-use, so concurrent 401s must share one refresh call.
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = () => {
+    if (!refreshing) {
+        const refreshToken = localStorage.getItem('refresh_token');
+        refreshing = (refreshToken
+            ? axios.post(`${api.defaults.baseURL}/api/auth/refresh`, { refresh_token: refreshToken }).then((res) => {
+                localStorage.setItem('token', res.data.token);
+                localStorage.setItem('refresh_token', res.data.refresh_token);
+                return res.data.token as string;
+            })
+            : Promise.reject(new Error('no refresh token'))
+        ).finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+};
+
 api.interceptors.response.use(
     (response) => response,
-    (error) => {
-        if (error.response?.status === 401) {
-            // Clear token and redirect to login if 401
-            localStorage.removeItem('token');
-            if (window.location.pathname !== '/login') {
-                window.location.href = '/login';
+    async (error) => {
+        const original = error.config;
+        if (error.response?.status === 401 && original && !original._retried) {
+            original._retried = true;
+            try {
+                const token = await refreshAccessToken();
+                original.headers.Authorization = `Bearer ${token}`;
+                return api(original);
+            } catch {
+                // Clear tokens and redirect to login if the session cannot be refreshed
+                localStorage.removeItem('token');
+                localStorage.removeItem('refresh_token');
+                if (window.location.pathname !== '/login') {
+                    window.location.href = '/login';
+                }
             }
         }
         return Promise.reject(error);
@@ -23,7 +23,7 @@ export default function Login() {
             // Basic mock user for now as the token endpoint only returns token string in current implementation
             const mockUser = { id: '0', email, name: email.split('@')[0], role: 'student' };
 
-            login(res.data.token, mockUser);
+            login(res.data.token, mockUser, res.data.refresh_token);
             navigate('/');
         } catch (err: any) {
             setError('Invalid credentials');
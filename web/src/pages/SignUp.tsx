@@ -24,7 +24,7 @@ export default function SignUp() {
             // We ideally fetch user profile here via the token, or let AuthProvider do it
             // For simplicity, we just set the token and user object derived from input 
             // (The AuthProvider useEffect will verify/fetch real profile anyway)
-            login(res.data.token, { id: '0', email, name: email.split('@')[0], role });
+            login(res.data.token, { id: '0', email, name: email.split('@')[0], role }, res.data.refresh_token);
             navigate(role === 'school_admin' ? '/schools/setup' : '/');
         } catch (err: any) {
             if (err.response?.status === 409) {